@@ -0,0 +1,124 @@
+package imap
+
+import (
+	"strings"
+)
+
+// ACLRight is an access control right, as defined in RFC 4314 section 2.1.
+type ACLRight byte
+
+// Rights defined in RFC 4314 section 2.1.
+const (
+	// The mailbox is visible to LIST and LSUB.
+	RightLookup ACLRight = 'l'
+	// The mailbox can be selected, fetched, searched and copied from.
+	RightRead = 'r'
+	// The \Seen flag can be kept across sessions.
+	RightSeen = 's'
+	// Flags other than \Seen and \Deleted can be written.
+	RightWrite = 'w'
+	// Messages can be appended and copied into the mailbox.
+	RightInsert = 'i'
+	// Messages can be sent to the submission address of the mailbox.
+	RightPost = 'p'
+	// Mailboxes can be created under this mailbox.
+	RightCreate = 'k'
+	// The mailbox can be deleted or renamed.
+	RightDeleteMailbox = 'x'
+	// The \Deleted flag can be written.
+	RightDeleteMessage = 't'
+	// The mailbox can be expunged.
+	RightExpunge = 'e'
+	// The ACL of the mailbox can be administered.
+	RightAdmin = 'a'
+)
+
+// ACLRights is a set of rights, represented as a string of rights, e.g. "lrs".
+type ACLRights string
+
+// AllRights contains all the rights defined in RFC 4314.
+const AllRights ACLRights = "lrswipkxtea"
+
+// Has checks if right is in the set.
+func (rights ACLRights) Has(right ACLRight) bool {
+	return strings.IndexByte(string(rights), byte(right)) >= 0
+}
+
+// HasAll checks if all the rights of other are in the set.
+func (rights ACLRights) HasAll(other ACLRights) bool {
+	for i := 0; i < len(other); i++ {
+		if !rights.Has(ACLRight(other[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Modify returns the set of rights modified by a SETACL command. Rights defined
+// in RFC 4314 are sorted in the order of AllRights, other rights follow.
+func (rights ACLRights) Modify(mode ACLMode, other ACLRights) ACLRights {
+	var set ACLRights
+	switch mode {
+	case ACLModeAdd:
+		set = rights + other
+	case ACLModeRemove:
+		for i := 0; i < len(rights); i++ {
+			if !other.Has(ACLRight(rights[i])) {
+				set += rights[i : i+1]
+			}
+		}
+	default:
+		set = other
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(AllRights); i++ {
+		if set.Has(ACLRight(AllRights[i])) {
+			b.WriteByte(AllRights[i])
+		}
+	}
+	for i := 0; i < len(set); i++ {
+		right := ACLRight(set[i])
+		if !AllRights.Has(right) && !ACLRights(b.String()).Has(right) {
+			b.WriteByte(set[i])
+		}
+	}
+	return ACLRights(b.String())
+}
+
+// ACLMode defines how rights are modified by a SETACL command, see RFC 4314
+// section 3.1.
+type ACLMode int
+
+const (
+	// The rights replace the current ones.
+	ACLModeReplace ACLMode = iota
+	// The rights are added to the current ones, with a "+" prefix.
+	ACLModeAdd
+	// The rights are removed from the current ones, with a "-" prefix.
+	ACLModeRemove
+)
+
+// ParseACLModification parses the rights argument of a SETACL command.
+func ParseACLModification(s string) (ACLMode, ACLRights) {
+	switch {
+	case strings.HasPrefix(s, "+"):
+		return ACLModeAdd, ACLRights(s[1:])
+	case strings.HasPrefix(s, "-"):
+		return ACLModeRemove, ACLRights(s[1:])
+	default:
+		return ACLModeReplace, ACLRights(s)
+	}
+}
+
+// FormatACLModification formats the rights argument of a SETACL command.
+func FormatACLModification(mode ACLMode, rights ACLRights) string {
+	switch mode {
+	case ACLModeAdd:
+		return "+" + string(rights)
+	case ACLModeRemove:
+		return "-" + string(rights)
+	default:
+		return string(rights)
+	}
+}
@@ -0,0 +1,55 @@
+package imap
+
+import (
+	"testing"
+)
+
+func TestACLRights_Has(t *testing.T) {
+	rights := ACLRights("lrs")
+	if !rights.Has(RightRead) {
+		t.Error("Expected rights to contain r")
+	}
+	if rights.Has(RightAdmin) {
+		t.Error("Expected rights not to contain a")
+	}
+	if !rights.HasAll("sl") {
+		t.Error("Expected rights to contain sl")
+	}
+	if rights.HasAll("lrw") {
+		t.Error("Expected rights not to contain lrw")
+	}
+}
+
+var aclModifyTests = []struct {
+	rights ACLRights
+	mode   ACLMode
+	other  ACLRights
+	want   ACLRights
+}{
+	{"lrs", ACLModeReplace, "ail", "lia"},
+	{"lrs", ACLModeAdd, "wr", "lrsw"},
+	{"lrswi", ACLModeRemove, "si", "lrw"},
+	{"lr", ACLModeAdd, "10", "lr10"},
+	{"", ACLModeRemove, "lr", ""},
+}
+
+func TestACLRights_Modify(t *testing.T) {
+	for _, test := range aclModifyTests {
+		if got := test.rights.Modify(test.mode, test.other); got != test.want {
+			t.Errorf("ACLRights(%q).Modify(%v, %q) = %q, want %q", test.rights, test.mode, test.other, got, test.want)
+		}
+	}
+}
+
+func TestACLModification(t *testing.T) {
+	for _, s := range []string{"lrs", "+w", "-te", ""} {
+		mode, rights := ParseACLModification(s)
+		if got := FormatACLModification(mode, rights); got != s {
+			t.Errorf("FormatACLModification(ParseACLModification(%q)) = %q", s, got)
+		}
+	}
+
+	if mode, rights := ParseACLModification("-x"); mode != ACLModeRemove || rights != "x" {
+		t.Errorf("ParseACLModification(%q) = %v, %q", "-x", mode, rights)
+	}
+}
@@ -0,0 +1,199 @@
+package imap
+
+import (
+	"bufio"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// FetchAnnotation is the name of the FETCH item containing message annotations,
+// defined in RFC 5257 section 4.2. Use AnnotationItem to request annotations.
+const FetchAnnotation FetchItem = "ANNOTATION"
+
+// StoreAnnotation is the STORE item changing message annotations, defined in
+// RFC 5257 section 4.3. Its value is formatted with FormatAnnotationValues.
+const StoreAnnotation StoreItem = "ANNOTATION"
+
+// Annotation attributes, defined in RFC 5257 section 3.3. Requesting an
+// attribute without suffix returns both the private and the shared ones.
+const (
+	AnnotationValue       = "value"
+	AnnotationValuePriv   = "value.priv"
+	AnnotationValueShared = "value.shared"
+)
+
+func formatAnnotationMatch(patterns []string) interface{} {
+	if len(patterns) == 1 {
+		return Quoted(patterns[0])
+	}
+	fields := make([]interface{}, len(patterns))
+	for i, pattern := range patterns {
+		fields[i] = Quoted(pattern)
+	}
+	return fields
+}
+
+func parseAnnotationMatch(f interface{}) ([]string, error) {
+	if l, ok := f.([]interface{}); ok {
+		return ParseStringList(l)
+	}
+	s, err := ParseString(f)
+	if err != nil {
+		return nil, err
+	}
+	return []string{s}, nil
+}
+
+// AnnotationItem returns the FETCH item requesting the annotation attributes
+// matching attribs in the entries matching entries. Entries and attributes
+// can contain the "*" and "%" wildcards.
+func AnnotationItem(entries, attribs []string) FetchItem {
+	var b strings.Builder
+	fields := []interface{}{formatAnnotationMatch(entries), formatAnnotationMatch(attribs)}
+	NewWriter(&b).writeList(fields)
+	return FetchItem(string(FetchAnnotation) + " " + b.String())
+}
+
+// ParseAnnotationItem parses a FETCH item returned by AnnotationItem.
+func ParseAnnotationItem(item FetchItem) (entries, attribs []string, err error) {
+	s := string(item)
+	if !strings.HasPrefix(s, string(FetchAnnotation)+" ") {
+		return nil, nil, errors.New("Invalid ANNOTATION item")
+	}
+
+	r := NewReader(bufio.NewReader(strings.NewReader(s[len(FetchAnnotation)+1:] + "\r\n")))
+	fields, err := r.ReadLine()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(fields) != 1 {
+		return nil, nil, errors.New("Invalid ANNOTATION item")
+	}
+	return ParseAnnotationParams(fields[0])
+}
+
+// ParseAnnotationParams parses the parameters of an ANNOTATION FETCH item,
+// i.e. a list containing the entries and attributes to match.
+func ParseAnnotationParams(f interface{}) (entries, attribs []string, err error) {
+	params, ok := f.([]interface{})
+	if !ok || len(params) != 2 {
+		return nil, nil, errors.New("ANNOTATION parameters must be a list of entries and attributes")
+	}
+	if entries, err = parseAnnotationMatch(params[0]); err != nil {
+		return nil, nil, err
+	}
+	if attribs, err = parseAnnotationMatch(params[1]); err != nil {
+		return nil, nil, err
+	}
+	return entries, attribs, nil
+}
+
+// MatchAnnotationEntry checks if an annotation entry name matches a pattern.
+// The "*" wildcard matches any string, "%" doesn't match the "/" separator.
+func MatchAnnotationEntry(pattern, entry string) bool {
+	return (&MailboxInfo{Delimiter: "/"}).match(entry, pattern)
+}
+
+// MatchAnnotationAttribute checks if an annotation attribute name matches a
+// pattern. A pattern without ".priv" or ".shared" suffix matches both.
+func MatchAnnotationAttribute(pattern, attrib string) bool {
+	info := &MailboxInfo{Delimiter: "."}
+	pattern, attrib = strings.ToLower(pattern), strings.ToLower(attrib)
+	return info.match(attrib, pattern) || info.match(attrib, pattern+".priv") || info.match(attrib, pattern+".shared")
+}
+
+// FormatAnnotations formats annotations, mapping entry names to attribute
+// values, as returned in FETCH responses. Entries and attributes are sorted by
+// name.
+func FormatAnnotations(annotations map[string]map[string]string) []interface{} {
+	values := make(map[string]map[string]*string, len(annotations))
+	for entry, attribs := range annotations {
+		values[entry] = make(map[string]*string, len(attribs))
+		for attrib, value := range attribs {
+			value := value
+			values[entry][attrib] = &value
+		}
+	}
+	return FormatAnnotationValues(values)
+}
+
+// FormatAnnotationValues formats annotation values, as sent with STORE. A nil
+// value is formatted as NIL, which removes the attribute. Entries and
+// attributes are sorted by name.
+func FormatAnnotationValues(annotations map[string]map[string]*string) []interface{} {
+	entries := make([]string, 0, len(annotations))
+	for entry := range annotations {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+
+	fields := make([]interface{}, 0, 2*len(entries))
+	for _, entry := range entries {
+		attribs := make([]string, 0, len(annotations[entry]))
+		for attrib := range annotations[entry] {
+			attribs = append(attribs, attrib)
+		}
+		sort.Strings(attribs)
+
+		values := make([]interface{}, 0, 2*len(attribs))
+		for _, attrib := range attribs {
+			var v interface{}
+			if value := annotations[entry][attrib]; value != nil {
+				v = formatIDString(*value)
+			}
+			values = append(values, Quoted(attrib), v)
+		}
+		fields = append(fields, Quoted(entry), values)
+	}
+	return fields
+}
+
+// ParseAnnotationValues parses annotation values, as returned in FETCH
+// responses or sent with STORE. NIL values are returned as nil.
+func ParseAnnotationValues(fields []interface{}) (map[string]map[string]*string, error) {
+	if len(fields)%2 != 0 {
+		return nil, errors.New("Annotations list must contain entry and attributes pairs")
+	}
+
+	annotations := make(map[string]map[string]*string, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		entry, err := ParseString(fields[i])
+		if err != nil {
+			return nil, err
+		}
+
+		values, ok := fields[i+1].([]interface{})
+		if !ok || len(values)%2 != 0 {
+			return nil, errors.New("Annotation attributes must be a list of name and value pairs")
+		}
+
+		attribs := make(map[string]*string, len(values)/2)
+		for j := 0; j < len(values); j += 2 {
+			attrib, err := ParseString(values[j])
+			if err != nil {
+				return nil, err
+			}
+			if values[j+1] == nil {
+				attribs[strings.ToLower(attrib)] = nil
+				continue
+			}
+			value, err := ParseString(values[j+1])
+			if err != nil {
+				return nil, err
+			}
+			attribs[strings.ToLower(attrib)] = &value
+		}
+		annotations[entry] = attribs
+	}
+	return annotations, nil
+}
+
+// SearchAnnotation matches messages with an annotation attribute containing a
+// value, as defined in RFC 5257 section 4.5. Entry and Attribute can contain
+// wildcards.
+type SearchAnnotation struct {
+	Entry     string
+	Attribute string
+	Value     string
+}
@@ -0,0 +1,104 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnnotationItem(t *testing.T) {
+	item := AnnotationItem([]string{"/comment"}, []string{"value.priv", "value.shared"})
+	if want := FetchItem(`ANNOTATION ("/comment" ("value.priv" "value.shared"))`); item != want {
+		t.Fatalf("AnnotationItem() = %v, want %v", item, want)
+	}
+
+	entries, attribs, err := ParseAnnotationItem(item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entries, []string{"/comment"}) {
+		t.Errorf("Invalid entries: %v", entries)
+	}
+	if !reflect.DeepEqual(attribs, []string{"value.priv", "value.shared"}) {
+		t.Errorf("Invalid attributes: %v", attribs)
+	}
+
+	if _, _, err := ParseAnnotationItem(FetchFlags); err == nil {
+		t.Error("Expected an error when parsing FLAGS")
+	}
+}
+
+func TestMatchAnnotationAttribute(t *testing.T) {
+	tests := []struct {
+		pattern, attrib string
+		want            bool
+	}{
+		{"value", "value.priv", true},
+		{"value", "value.shared", true},
+		{"value.priv", "value.shared", false},
+		{"Value.Priv", "value.priv", true},
+		{"*", "size.shared", true},
+		{"size", "value.priv", false},
+	}
+
+	for _, test := range tests {
+		if got := MatchAnnotationAttribute(test.pattern, test.attrib); got != test.want {
+			t.Errorf("MatchAnnotationAttribute(%q, %q) = %v, want %v", test.pattern, test.attrib, got, test.want)
+		}
+	}
+}
+
+func TestAnnotationValues(t *testing.T) {
+	comment := "My comment"
+	annotations := map[string]map[string]*string{
+		"/comment":    {AnnotationValuePriv: &comment, AnnotationValueShared: nil},
+		"/altsubject": {AnnotationValueShared: &comment},
+	}
+
+	fields := FormatAnnotationValues(annotations)
+	want := []interface{}{
+		Quoted("/altsubject"), []interface{}{Quoted("value.shared"), Quoted("My comment")},
+		Quoted("/comment"), []interface{}{Quoted("value.priv"), Quoted("My comment"), Quoted("value.shared"), nil},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("FormatAnnotationValues() = %v, want %v", fields, want)
+	}
+
+	parsed, err := ParseAnnotationValues([]interface{}{
+		"/altsubject", []interface{}{"VALUE.SHARED", "My comment"},
+		"/comment", []interface{}{"value.priv", "My comment", "value.shared", nil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, annotations) {
+		t.Errorf("ParseAnnotationValues() = %v, want %v", parsed, annotations)
+	}
+
+	if _, err := ParseAnnotationValues([]interface{}{"/comment"}); err == nil {
+		t.Error("Expected an error for a missing attributes list")
+	}
+}
+
+func TestMessage_Annotations(t *testing.T) {
+	msg := &Message{}
+	fields := []interface{}{
+		"ANNOTATION", []interface{}{"/comment", []interface{}{"value.priv", "My comment", "value.shared", nil}},
+	}
+	if err := msg.Parse(fields); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]map[string]string{"/comment": {"value.priv": "My comment"}}
+	if !reflect.DeepEqual(msg.Annotations, want) {
+		t.Fatalf("Invalid annotations: got %v, want %v", msg.Annotations, want)
+	}
+
+	msg = NewMessage(1, []FetchItem{AnnotationItem([]string{"/comment"}, []string{"value"})})
+	msg.Annotations = want
+	formatted := []interface{}{
+		"ANNOTATION", []interface{}{Quoted("/comment"), []interface{}{Quoted("value.priv"), Quoted("My comment")}},
+	}
+	if got := msg.Format(); !reflect.DeepEqual(got, formatted) {
+		t.Errorf("Message.Format() = %v, want %v", got, formatted)
+	}
+}
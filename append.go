@@ -0,0 +1,33 @@
+package imap
+
+import (
+	"time"
+)
+
+// AppendMessage is a message to append to a mailbox. Several messages can be
+// appended with a single APPEND command, as defined in RFC 3502.
+type AppendMessage struct {
+	// The message flags, optional.
+	Flags []string
+	// The message internal date, optional.
+	Date time.Time
+	// The message, in the RFC 2822 format.
+	Body Literal
+	// If not nil, the message is built by the server by concatenating these
+	// parts and Body is ignored, as defined in RFC 4469 (CATENATE).
+	Catenate []*CatenatePart
+	// If true, the message may contain UTF-8 headers and is sent as a literal8
+	// prefixed with UTF8, as defined in RFC 6855 section 4. This requires
+	// UTF8=ACCEPT to be enabled.
+	UTF8 bool
+}
+
+// CatenatePart is a part of a message built with CATENATE. Exactly one of URL
+// and Text must be set.
+type CatenatePart struct {
+	// An IMAP URL referencing a message or a body part, as defined in RFC
+	// 5092.
+	URL string
+	// Literal data.
+	Text Literal
+}
@@ -0,0 +1,42 @@
+package backend
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// ACLBackend is a Backend that controls access to mailboxes with access control
+// lists, as defined in RFC 4314. If SupportACL returns true, the server
+// advertises the ACL capability, and checks the rights of the user on
+// mailboxes implementing ACLMailbox before running commands.
+type ACLBackend interface {
+	Backend
+
+	// SupportACL returns true if mailboxes returned by this backend support
+	// access control lists.
+	SupportACL() bool
+}
+
+// ACLMailbox is a Mailbox with an access control list. Identifiers are usually
+// user names, the special "anyone" identifier refers to all users.
+type ACLMailbox interface {
+	Mailbox
+
+	// GetACL returns the access control list of the mailbox, mapping
+	// identifiers to their rights.
+	GetACL() (map[string]imap.ACLRights, error)
+
+	// SetACL modifies the rights granted to an identifier, see
+	// imap.ACLRights.Modify.
+	SetACL(identifier string, mode imap.ACLMode, rights imap.ACLRights) error
+
+	// DeleteACL removes an identifier from the access control list.
+	DeleteACL(identifier string) error
+
+	// ListRights returns the rights which can be granted to an identifier.
+	// Required rights are always granted, each set of optional rights can be
+	// granted independently.
+	ListRights(identifier string) (required imap.ACLRights, optional []imap.ACLRights, err error)
+
+	// MyRights returns the rights of the logged in user.
+	MyRights() (imap.ACLRights, error)
+}
@@ -0,0 +1,35 @@
+package backend
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+// ErrAnnotationTooBig can be returned by AnnotateMailbox.SetAnnotations if an
+// annotation value is too large. The server replies with the ANNOTATE TOOBIG
+// response code.
+var ErrAnnotationTooBig = errors.New("Annotation too big")
+
+// AnnotateBackend is a Backend that attaches annotations to messages, as
+// defined in RFC 5257. If SupportAnnotate returns true, the server advertises
+// the ANNOTATE-EXPERIMENT-1 capability and mailboxes must implement
+// AnnotateMailbox. Annotations are fetched by Mailbox.ListMessages with items
+// returned by imap.AnnotationItem, and searched by Mailbox.SearchMessages with
+// imap.SearchCriteria.Annotations.
+type AnnotateBackend interface {
+	Backend
+
+	// SupportAnnotate returns true if mailboxes returned by this backend
+	// support message annotations.
+	SupportAnnotate() bool
+}
+
+// AnnotateMailbox is a Mailbox whose messages can be annotated.
+type AnnotateMailbox interface {
+	Mailbox
+
+	// SetAnnotations changes the annotations of messages. Annotations map entry
+	// names to attribute values, attributes with a nil value are removed.
+	SetAnnotations(uid bool, seqset *imap.SeqSet, annotations map[string]map[string]*string) error
+}
@@ -0,0 +1,32 @@
+package backend
+
+import (
+	"errors"
+)
+
+// ErrTooBig can be returned by Mailbox.CreateMessage when the message is
+// larger than the append limit. The server replies with the TOOBIG response
+// code.
+var ErrTooBig = errors.New("Message too big")
+
+// AppendLimitBackend is a Backend limiting the size of appended messages, as
+// defined in RFC 7889. The server advertises the APPENDLIMIT capability and
+// rejects larger messages before passing them to the backend.
+type AppendLimitBackend interface {
+	Backend
+
+	// AppendLimit returns the maximum size in bytes of a message appended to
+	// any mailbox. If it returns zero, each mailbox has its own limit, which
+	// is returned by AppendLimitMailbox.
+	AppendLimit() uint64
+}
+
+// AppendLimitMailbox is a Mailbox with its own append limit. The limit is
+// returned with the STATUS APPENDLIMIT item.
+type AppendLimitMailbox interface {
+	Mailbox
+
+	// AppendLimit returns the maximum size in bytes of a message appended to
+	// this mailbox, or zero if there is no limit.
+	AppendLimit() uint64
+}
@@ -0,0 +1,70 @@
+package backendutil
+
+import (
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// FetchAnnotations returns the annotation attributes requested by an
+// ANNOTATION fetch item, see imap.ParseAnnotationItem. Entries without any
+// matching attribute are omitted.
+func FetchAnnotations(annotations map[string]map[string]string, entries, attribs []string) map[string]map[string]string {
+	fetched := make(map[string]map[string]string)
+	for entry, values := range annotations {
+		if !matchAny(entries, entry, imap.MatchAnnotationEntry) {
+			continue
+		}
+		for attrib, value := range values {
+			if !matchAny(attribs, attrib, imap.MatchAnnotationAttribute) {
+				continue
+			}
+			if fetched[entry] == nil {
+				fetched[entry] = make(map[string]string)
+			}
+			fetched[entry][attrib] = value
+		}
+	}
+	return fetched
+}
+
+func matchAny(patterns []string, name string, match func(pattern, name string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchAnnotations returns true if the annotations of a message match the
+// ANNOTATION keys of the provided criteria. A key matches if one of the
+// attributes it selects contains its value, case-insensitively.
+func MatchAnnotations(annotations map[string]map[string]string, c *imap.SearchCriteria) bool {
+	for _, sa := range c.Annotations {
+		found := false
+		fetched := FetchAnnotations(annotations, []string{sa.Entry}, []string{sa.Attribute})
+		for _, values := range fetched {
+			for _, value := range values {
+				if strings.Contains(strings.ToLower(value), strings.ToLower(sa.Value)) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for _, not := range c.Not {
+		if MatchAnnotations(annotations, not) {
+			return false
+		}
+	}
+	for _, or := range c.Or {
+		if !MatchAnnotations(annotations, or[0]) && !MatchAnnotations(annotations, or[1]) {
+			return false
+		}
+	}
+	return true
+}
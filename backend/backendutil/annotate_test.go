@@ -0,0 +1,96 @@
+package backendutil
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+var testAnnotations = map[string]map[string]string{
+	"/comment": {
+		imap.AnnotationValuePriv:   "My comment",
+		imap.AnnotationValueShared: "Group note",
+	},
+	"/altsubject": {
+		imap.AnnotationValueShared: "Spam score: 4.2",
+	},
+	"/flags/important": {
+		imap.AnnotationValuePriv: "yes",
+	},
+}
+
+var fetchAnnotationsTests = []struct {
+	entries, attribs []string
+	want             map[string]map[string]string
+}{
+	{
+		entries: []string{"/comment"},
+		attribs: []string{imap.AnnotationValuePriv},
+		want:    map[string]map[string]string{"/comment": {imap.AnnotationValuePriv: "My comment"}},
+	},
+	{
+		entries: []string{"/comment", "/altsubject"},
+		attribs: []string{imap.AnnotationValueShared},
+		want: map[string]map[string]string{
+			"/comment":    {imap.AnnotationValueShared: "Group note"},
+			"/altsubject": {imap.AnnotationValueShared: "Spam score: 4.2"},
+		},
+	},
+	{
+		entries: []string{"/comment"},
+		attribs: []string{imap.AnnotationValue},
+		want:    map[string]map[string]string{"/comment": testAnnotations["/comment"]},
+	},
+	{
+		entries: []string{"/%"},
+		attribs: []string{imap.AnnotationValuePriv},
+		want:    map[string]map[string]string{"/comment": {imap.AnnotationValuePriv: "My comment"}},
+	},
+	{
+		entries: []string{"/*"},
+		attribs: []string{imap.AnnotationValuePriv},
+		want: map[string]map[string]string{
+			"/comment":         {imap.AnnotationValuePriv: "My comment"},
+			"/flags/important": {imap.AnnotationValuePriv: "yes"},
+		},
+	},
+	{
+		entries: []string{"/unknown"},
+		attribs: []string{imap.AnnotationValue},
+		want:    map[string]map[string]string{},
+	},
+}
+
+func TestFetchAnnotations(t *testing.T) {
+	for i, test := range fetchAnnotationsTests {
+		got := FetchAnnotations(testAnnotations, test.entries, test.attribs)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Invalid annotations for #%v: got %v, want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestMatchAnnotations(t *testing.T) {
+	c := &imap.SearchCriteria{
+		Annotations: []imap.SearchAnnotation{{Entry: "/altsubject", Attribute: imap.AnnotationValue, Value: "SPAM"}},
+	}
+	if !MatchAnnotations(testAnnotations, c) {
+		t.Error("Expected to match criteria")
+	}
+	if MatchAnnotations(nil, c) {
+		t.Error("Expected a message without annotations not to match criteria")
+	}
+
+	c.Annotations[0].Attribute = imap.AnnotationValuePriv
+	if MatchAnnotations(testAnnotations, c) {
+		t.Error("Expected not to match private value")
+	}
+
+	c = &imap.SearchCriteria{Not: []*imap.SearchCriteria{{
+		Annotations: []imap.SearchAnnotation{{Entry: "/comment", Attribute: imap.AnnotationValue, Value: "comment"}},
+	}}}
+	if MatchAnnotations(testAnnotations, c) {
+		t.Error("Expected not to match NOT criteria")
+	}
+}
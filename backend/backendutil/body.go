@@ -11,11 +11,9 @@ import (
 
 var errNoSuchPart = errors.New("backendutil: no such message body part")
 
-// FetchBodySection extracts a body section from a message.
-func FetchBodySection(e *message.Entity, section *imap.BodySectionName) (imap.Literal, error) {
-	// First, find the requested part using the provided path
-	for i := len(section.Path) - 1; i >= 0; i-- {
-		n := section.Path[i]
+func findPart(e *message.Entity, path []int) (*message.Entity, error) {
+	for i := len(path) - 1; i >= 0; i-- {
+		n := path[i]
 
 		mr := e.MultipartReader()
 		if mr == nil {
@@ -36,6 +34,22 @@ func FetchBodySection(e *message.Entity, section *imap.BodySectionName) (imap.Li
 			}
 		}
 	}
+	return e, nil
+}
+
+// FetchBodySection extracts a body section from a message. If the section is
+// a BINARY section, the body part is returned with its content transfer
+// encoding decoded.
+func FetchBodySection(e *message.Entity, section *imap.BodySectionName) (imap.Literal, error) {
+	if section.Binary {
+		return fetchBinarySection(e, section)
+	}
+
+	// First, find the requested part using the provided path
+	e, err := findPart(e, section.Path)
+	if err != nil {
+		return nil, err
+	}
 
 	// Then, write the requested data to a buffer
 	b := new(bytes.Buffer)
@@ -66,3 +80,43 @@ func FetchBodySection(e *message.Entity, section *imap.BodySectionName) (imap.Li
 	}
 	return l, nil
 }
+
+func fetchBinarySection(e *message.Entity, section *imap.BodySectionName) (imap.Literal, error) {
+	// The whole message can't be decoded, BINARY[] is the same as BODY[]
+	if len(section.Path) == 0 {
+		whole := *section
+		whole.Binary = false
+		whole.Specifier = imap.EntireSpecifier
+		return FetchBodySection(e, &whole)
+	}
+
+	e, err := findPart(e, section.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The entity body is already decoded
+	b := new(bytes.Buffer)
+	if _, err := io.Copy(b, e.Body); err != nil {
+		return nil, err
+	}
+
+	var l imap.Literal = b
+	if section.Partial != nil {
+		l = bytes.NewReader(section.ExtractPartial(b.Bytes()))
+	}
+	return l, nil
+}
+
+// FetchBinarySize returns the size of a body part once its content transfer
+// encoding is decoded, as requested by the BINARY.SIZE fetch item.
+func FetchBinarySize(e *message.Entity, path []int) (uint32, error) {
+	l, err := fetchBinarySection(e, &imap.BodySectionName{
+		BodyPartName: imap.BodyPartName{Path: path},
+		Binary:       true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uint32(l.Len()), nil
+}
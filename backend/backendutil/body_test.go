@@ -97,3 +97,66 @@ func TestFetchBodySection(t *testing.T) {
 		}
 	}
 }
+
+const testBinaryMailString = "Content-Type: multipart/mixed; boundary=message-boundary\r\n" +
+	"\r\n" +
+	"--message-boundary\r\n" +
+	testTextString +
+	"\r\n--message-boundary\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"SGVsbG8AV29ybGQ=\r\n" +
+	"--message-boundary--\r\n"
+
+func TestFetchBodySection_Binary(t *testing.T) {
+	tests := []struct {
+		section string
+		body    string
+	}{
+		{section: "BINARY[2]", body: "Hello\x00World"},
+		{section: "BINARY.PEEK[2]<6.3>", body: "Wor"},
+		{section: "BINARY[1]", body: testTextBodyString},
+	}
+
+	for _, test := range tests {
+		e, err := message.Read(strings.NewReader(testBinaryMailString))
+		if err != nil {
+			t.Fatal("Expected no error while reading mail, got:", err)
+		}
+
+		section, err := imap.ParseBodySectionName(imap.FetchItem(test.section))
+		if err != nil {
+			t.Fatal("Expected no error while parsing body section name, got:", err)
+		}
+
+		r, err := FetchBodySection(e, section)
+		if err != nil {
+			t.Errorf("Expected no error while extracting body section %q, got: %v", test.section, err)
+			continue
+		}
+
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal("Expected no error while reading body section, got:", err)
+		}
+		if s := string(b); s != test.body {
+			t.Errorf("Expected body section %q to be %q but got %q", test.section, test.body, s)
+		}
+	}
+}
+
+func TestFetchBinarySize(t *testing.T) {
+	e, err := message.Read(strings.NewReader(testBinaryMailString))
+	if err != nil {
+		t.Fatal("Expected no error while reading mail, got:", err)
+	}
+
+	size, err := FetchBinarySize(e, []int{2})
+	if err != nil {
+		t.Fatal("Expected no error while fetching binary size, got:", err)
+	}
+	if size != 11 {
+		t.Errorf("Expected binary size to be 11, got %v", size)
+	}
+}
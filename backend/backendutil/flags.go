@@ -38,3 +38,13 @@ func UpdateFlags(current []string, op imap.FlagsOp, flags []string) []string {
 	}
 	return current
 }
+
+// HasFlag returns true if flags contains flag.
+func HasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
@@ -44,3 +44,13 @@ func TestUpdateFlags(t *testing.T) {
 		}
 	}
 }
+
+func TestHasFlag(t *testing.T) {
+	flags := []string{imap.SeenFlag, imap.DeletedFlag}
+	if !HasFlag(flags, imap.DeletedFlag) {
+		t.Error("Expected \\Deleted to be present")
+	}
+	if HasFlag(flags, imap.DraftFlag) {
+		t.Error("Expected \\Draft not to be present")
+	}
+}
@@ -0,0 +1,114 @@
+package backendutil
+
+import (
+	"html"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/emersion/go-message"
+)
+
+// PreviewMaxLen is the maximum length of a message preview, in characters. See
+// RFC 8970 section 3.
+const PreviewMaxLen = 256
+
+// previewMaxRead is the maximum number of bytes read from a text part to
+// generate a preview.
+const previewMaxRead = 64 * 1024
+
+func readPreviewPart(e *message.Entity) (string, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(e.Body, previewMaxRead))
+	return string(b), err
+}
+
+// findPreviewText returns the content of the first text/plain part of e. If
+// there is none, the content of the first text/html part is returned with
+// isHTML set to true.
+func findPreviewText(e *message.Entity) (text string, isHTML bool, err error) {
+	if disp, _, _ := e.Header.ContentDisposition(); strings.EqualFold(disp, "attachment") {
+		return "", false, nil
+	}
+
+	t, _, _ := e.Header.ContentType()
+	t = strings.ToLower(t)
+
+	if mr := e.MultipartReader(); mr != nil {
+		var htmlText string
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return "", false, err
+			}
+
+			text, isHTML, err := findPreviewText(p)
+			if err != nil {
+				return "", false, err
+			}
+			if text == "" {
+				continue
+			}
+			if !isHTML {
+				return text, false, nil
+			}
+			if htmlText == "" {
+				htmlText = text
+			}
+		}
+		return htmlText, htmlText != "", nil
+	}
+
+	switch t {
+	case "", "text/plain":
+		text, err := readPreviewPart(e)
+		return text, false, err
+	case "text/html":
+		text, err := readPreviewPart(e)
+		return text, true, err
+	}
+	return "", false, nil
+}
+
+// stripHTML removes tags from an HTML document and unescapes entities.
+func stripHTML(s string) string {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		b.WriteByte(' ')
+
+		j := strings.IndexByte(s[i:], '>')
+		if j < 0 {
+			break
+		}
+		s = s[i+j+1:]
+	}
+	return html.UnescapeString(b.String())
+}
+
+// FetchPreview generates a preview of a message, as requested by the PREVIEW
+// fetch item. The preview is built from the first text/plain part, or from the
+// first text/html part with tags stripped. Whitespace is collapsed and the
+// result is truncated to PreviewMaxLen characters. An empty string is returned
+// if the message has no text part.
+func FetchPreview(e *message.Entity) (string, error) {
+	text, isHTML, err := findPreviewText(e)
+	if err != nil {
+		return "", err
+	}
+	if isHTML {
+		text = stripHTML(text)
+	}
+
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > PreviewMaxLen {
+		text = string(runes[:PreviewMaxLen])
+	}
+	return text, nil
+}
@@ -0,0 +1,67 @@
+package backendutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-message"
+)
+
+var previewTests = []struct {
+	name    string
+	mail    string
+	preview string
+}{
+	{
+		name:    "multipart",
+		mail:    testMailString,
+		preview: testTextBodyString,
+	},
+	{
+		name:    "whitespace",
+		mail:    "Subject: Hi\r\n\r\n  Hello,\r\n\r\n\tthis is   a test.\r\n",
+		preview: "Hello, this is a test.",
+	},
+	{
+		name: "html",
+		mail: "Content-Type: multipart/alternative; boundary=b\r\n\r\n" +
+			"--b\r\nContent-Type: text/html\r\n\r\n<p>Hello <b>world</b> &amp; all</p>\r\n" +
+			"--b--\r\n",
+		preview: "Hello world & all",
+	},
+	{
+		name: "plain over html",
+		mail: "Content-Type: multipart/alternative; boundary=b\r\n\r\n" +
+			"--b\r\nContent-Type: text/html\r\n\r\n<p>HTML</p>\r\n" +
+			"--b\r\nContent-Type: text/plain\r\n\r\nPlain\r\n" +
+			"--b--\r\n",
+		preview: "Plain",
+	},
+	{
+		name: "attachment only",
+		mail: "Content-Type: multipart/mixed; boundary=message-boundary\r\n\r\n" +
+			"--message-boundary\r\n" + testAttachmentString + "\r\n--message-boundary--\r\n",
+		preview: "",
+	},
+	{
+		name:    "too long",
+		mail:    "Subject: Hi\r\n\r\n" + strings.Repeat("é", 300) + "\r\n",
+		preview: strings.Repeat("é", PreviewMaxLen),
+	},
+}
+
+func TestFetchPreview(t *testing.T) {
+	for _, test := range previewTests {
+		e, err := message.Read(strings.NewReader(test.mail))
+		if err != nil {
+			t.Fatal("Expected no error while reading mail, got:", err)
+		}
+
+		preview, err := FetchPreview(e)
+		if err != nil {
+			t.Errorf("Expected no error while generating preview for %v, got: %v", test.name, err)
+		} else if preview != test.preview {
+			t.Errorf("Invalid preview for %v: got %q but expected %q", test.name, preview, test.preview)
+		}
+	}
+}
@@ -59,7 +59,7 @@ func Match(e *message.Entity, c *imap.SearchCriteria) (bool, error) {
 	// TODO: support encoded header fields for Bcc, Cc, From, To
 	// TODO: add header size for Larger and Smaller
 
-	h := mail.Header{e.Header}
+	h := mail.Header{Header: e.Header}
 
 	if !c.SentBefore.IsZero() || !c.SentSince.IsZero() {
 		t, err := h.Date()
@@ -201,13 +201,40 @@ func MatchSeqNumAndUid(seqNum uint32, uid uint32, c *imap.SearchCriteria) bool {
 	return true
 }
 
+// MatchModSeq returns true if a mod-sequence matches the provided criteria.
+func MatchModSeq(modSeq uint64, c *imap.SearchCriteria) bool {
+	if c.ModSeq > 0 && modSeq < c.ModSeq {
+		return false
+	}
+
+	for _, not := range c.Not {
+		if MatchModSeq(modSeq, not) {
+			return false
+		}
+	}
+	for _, or := range c.Or {
+		if !MatchModSeq(modSeq, or[0]) && !MatchModSeq(modSeq, or[1]) {
+			return false
+		}
+	}
+	return true
+}
+
 // MatchDate returns true if a date matches the provided criteria.
 func MatchDate(date time.Time, c *imap.SearchCriteria) bool {
-	date = date.Round(24 * time.Hour)
-	if !c.Since.IsZero() && !date.After(c.Since) {
+	now := time.Now()
+	if c.Younger > 0 && !date.After(now.Add(-c.Younger)) {
+		return false
+	}
+	if c.Older > 0 && !date.Before(now.Add(-c.Older)) {
+		return false
+	}
+
+	day := date.Round(24 * time.Hour)
+	if !c.Since.IsZero() && !day.After(c.Since) {
 		return false
 	}
-	if !c.Before.IsZero() && !date.Before(c.Before) {
+	if !c.Before.IsZero() && !day.Before(c.Before) {
 		return false
 	}
 
@@ -223,3 +250,34 @@ func MatchDate(date time.Time, c *imap.SearchCriteria) bool {
 	}
 	return true
 }
+
+// MatchSaveDate returns true if the date a message was saved to its mailbox
+// matches the provided criteria. A zero date means that the message has no
+// save date, it doesn't match any SAVEDATE search key.
+func MatchSaveDate(date time.Time, c *imap.SearchCriteria) bool {
+	if date.IsZero() {
+		if c.SavedDateSupported || !c.SavedSince.IsZero() || !c.SavedBefore.IsZero() {
+			return false
+		}
+	} else {
+		day := date.Round(24 * time.Hour)
+		if !c.SavedSince.IsZero() && !day.After(c.SavedSince) {
+			return false
+		}
+		if !c.SavedBefore.IsZero() && !day.Before(c.SavedBefore) {
+			return false
+		}
+	}
+
+	for _, not := range c.Not {
+		if MatchSaveDate(date, not) {
+			return false
+		}
+	}
+	for _, or := range c.Or {
+		if !MatchSaveDate(date, or[0]) && !MatchSaveDate(date, or[1]) {
+			return false
+		}
+	}
+	return true
+}
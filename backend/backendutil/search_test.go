@@ -226,6 +226,25 @@ func TestMatchSeqNumAndUid(t *testing.T) {
 	}
 }
 
+func TestMatchModSeq(t *testing.T) {
+	modSeq := uint64(42)
+
+	c := &imap.SearchCriteria{ModSeq: 43}
+	if MatchModSeq(modSeq, c) {
+		t.Error("Expected not to match criteria")
+	}
+
+	c.ModSeq = 42
+	if !MatchModSeq(modSeq, c) {
+		t.Error("Expected to match criteria")
+	}
+
+	c.Not = []*imap.SearchCriteria{{ModSeq: 40}}
+	if MatchModSeq(modSeq, c) {
+		t.Error("Expected not to match criteria")
+	}
+}
+
 func TestMatchDate(t *testing.T) {
 	date := time.Unix(1483997966, 0)
 
@@ -262,3 +281,49 @@ func TestMatchDate(t *testing.T) {
 		t.Error("Expected to match criteria")
 	}
 }
+
+func TestMatchSaveDate(t *testing.T) {
+	date := time.Unix(1483997966, 0)
+
+	c := &imap.SearchCriteria{SavedSince: date.Add(-48 * time.Hour)}
+	if !MatchSaveDate(date, c) {
+		t.Error("Expected to match criteria")
+	}
+	if MatchSaveDate(time.Time{}, c) {
+		t.Error("Expected a message without save date not to match criteria")
+	}
+
+	c.SavedBefore = date.Add(-24 * time.Hour)
+	if MatchSaveDate(date, c) {
+		t.Error("Expected not to match criteria")
+	}
+
+	c = &imap.SearchCriteria{SavedDateSupported: true}
+	if !MatchSaveDate(date, c) {
+		t.Error("Expected to match SAVEDATESUPPORTED")
+	}
+	if MatchSaveDate(time.Time{}, c) {
+		t.Error("Expected a message without save date not to match SAVEDATESUPPORTED")
+	}
+
+	if !MatchSaveDate(time.Time{}, &imap.SearchCriteria{}) {
+		t.Error("Expected a message without save date to match empty criteria")
+	}
+}
+
+func TestMatchDate_within(t *testing.T) {
+	date := time.Now().Add(-2 * time.Hour)
+
+	if !MatchDate(date, &imap.SearchCriteria{Younger: 3 * time.Hour}) {
+		t.Error("Expected to match YOUNGER criteria")
+	}
+	if MatchDate(date, &imap.SearchCriteria{Younger: time.Hour}) {
+		t.Error("Expected not to match YOUNGER criteria")
+	}
+	if !MatchDate(date, &imap.SearchCriteria{Older: time.Hour}) {
+		t.Error("Expected to match OLDER criteria")
+	}
+	if MatchDate(date, &imap.SearchCriteria{Older: 3 * time.Hour}) {
+		t.Error("Expected not to match OLDER criteria")
+	}
+}
@@ -0,0 +1,90 @@
+package backendutil
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/sortthread"
+)
+
+// SortFetchItems contains the items messages passed to Sort must be fetched
+// with.
+var SortFetchItems = []imap.FetchItem{imap.FetchEnvelope, imap.FetchInternalDate, imap.FetchRFC822Size}
+
+func firstMailbox(addrs []*imap.Address) string {
+	if len(addrs) == 0 {
+		return ""
+	}
+	return strings.ToUpper(addrs[0].MailboxName)
+}
+
+func sentDate(msg *imap.Message) time.Time {
+	if msg.Envelope != nil && !msg.Envelope.Date.IsZero() {
+		return msg.Envelope.Date
+	}
+	return msg.InternalDate
+}
+
+func envelope(msg *imap.Message) *imap.Envelope {
+	if msg.Envelope == nil {
+		return &imap.Envelope{}
+	}
+	return msg.Envelope
+}
+
+// compareSortField returns a negative number if a sorts before b for field, a
+// positive number if it sorts after, and zero if they're equal.
+func compareSortField(field sortthread.SortField, a, b *imap.Message) int {
+	compareStrings := func(a, b string) int {
+		return strings.Compare(a, b)
+	}
+	compareTimes := func(a, b time.Time) int {
+		switch {
+		case a.Before(b):
+			return -1
+		case a.After(b):
+			return 1
+		}
+		return 0
+	}
+
+	switch field {
+	case sortthread.SortArrival:
+		return compareTimes(a.InternalDate, b.InternalDate)
+	case sortthread.SortCc:
+		return compareStrings(firstMailbox(envelope(a).Cc), firstMailbox(envelope(b).Cc))
+	case sortthread.SortDate:
+		return compareTimes(sentDate(a), sentDate(b))
+	case sortthread.SortFrom:
+		return compareStrings(firstMailbox(envelope(a).From), firstMailbox(envelope(b).From))
+	case sortthread.SortSize:
+		return int(a.Size) - int(b.Size)
+	case sortthread.SortSubject:
+		subjectA := strings.ToUpper(sortthread.BaseSubject(envelope(a).Subject))
+		subjectB := strings.ToUpper(sortthread.BaseSubject(envelope(b).Subject))
+		return compareStrings(subjectA, subjectB)
+	case sortthread.SortTo:
+		return compareStrings(firstMailbox(envelope(a).To), firstMailbox(envelope(b).To))
+	}
+	return 0
+}
+
+// Sort sorts messages according to criteria, as defined in RFC 5256 section 3.
+// Messages must have been fetched with SortFetchItems and must be in sequence
+// number order: messages with the same sort keys are kept in this order.
+func Sort(msgs []*imap.Message, criteria []sortthread.SortCriterion) {
+	sort.SliceStable(msgs, func(i, j int) bool {
+		for _, c := range criteria {
+			cmp := compareSortField(c.Field, msgs[i], msgs[j])
+			if c.Reverse {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,70 @@
+package backendutil
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/sortthread"
+)
+
+func newSortTestMessage(seqNum uint32, subject, from string, date time.Time, size uint32) *imap.Message {
+	return &imap.Message{
+		SeqNum: seqNum,
+		Envelope: &imap.Envelope{
+			Subject: subject,
+			From:    []*imap.Address{{MailboxName: from, HostName: "example.org"}},
+		},
+		InternalDate: date,
+		Size:         size,
+	}
+}
+
+var sortTests = []struct {
+	criteria []sortthread.SortCriterion
+	want     []uint32
+}{
+	{
+		criteria: []sortthread.SortCriterion{{Field: sortthread.SortSubject}},
+		want:     []uint32{2, 4, 3, 1},
+	},
+	{
+		criteria: []sortthread.SortCriterion{{Field: sortthread.SortFrom}, {Field: sortthread.SortSize}},
+		want:     []uint32{4, 1, 3, 2},
+	},
+	{
+		criteria: []sortthread.SortCriterion{{Field: sortthread.SortArrival, Reverse: true}},
+		want:     []uint32{4, 3, 2, 1},
+	},
+	{
+		criteria: []sortthread.SortCriterion{{Field: sortthread.SortDate}},
+		want:     []uint32{1, 2, 3, 4},
+	},
+	{
+		// Ties are kept in sequence number order
+		criteria: []sortthread.SortCriterion{{Field: sortthread.SortTo}},
+		want:     []uint32{1, 2, 3, 4},
+	},
+}
+
+func TestSort(t *testing.T) {
+	for _, test := range sortTests {
+		msgs := []*imap.Message{
+			newSortTestMessage(1, "Re: Your Name.", "mitsuha", testDate, 300),
+			newSortTestMessage(2, "Comet", "Taki", testDate.Add(time.Hour), 200),
+			newSortTestMessage(3, "[fwd: Your name]", "taki", testDate.Add(2*time.Hour), 100),
+			newSortTestMessage(4, "fwd: comet (fwd)", "", testDate.Add(3*time.Hour), 400),
+		}
+
+		Sort(msgs, test.criteria)
+
+		ids := make([]uint32, len(msgs))
+		for i, msg := range msgs {
+			ids[i] = msg.SeqNum
+		}
+		if !reflect.DeepEqual(ids, test.want) {
+			t.Errorf("Sort(%v) = %v, want %v", test.criteria, ids, test.want)
+		}
+	}
+}
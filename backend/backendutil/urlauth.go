@@ -0,0 +1,38 @@
+package backendutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/imapurl"
+)
+
+// URLAuthToken computes the INTERNAL token of a rump URL from a secret key, see
+// RFC 4467 section 7. Each mailbox should have its own key, so that
+// RESETKEY can invalidate all the URLs authorized for it.
+func URLAuthToken(key []byte, rump string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(rump))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckURLAuth checks that an URL has been authorized with URLAuthToken and
+// the provided key, and that it hasn't expired. It returns the rump URL.
+func CheckURLAuth(key []byte, url string) (string, bool) {
+	rump, mechanism, token, err := imap.SplitURLAuth(url)
+	if err != nil || mechanism != imap.URLAuthInternal {
+		return "", false
+	}
+	if !hmac.Equal([]byte(token), []byte(URLAuthToken(key, rump))) {
+		return "", false
+	}
+
+	u, err := imapurl.Parse(rump)
+	if err != nil || (!u.Expire.IsZero() && time.Now().After(u.Expire)) {
+		return "", false
+	}
+	return rump, true
+}
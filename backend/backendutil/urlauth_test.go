@@ -0,0 +1,30 @@
+package backendutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestCheckURLAuth(t *testing.T) {
+	key := []byte("secret")
+	rump := "imap://joe@example.com/INBOX/;uid=20;urlauth=anonymous"
+	url := imap.FormatURLAuth(rump, imap.URLAuthInternal, URLAuthToken(key, rump))
+
+	if got, ok := CheckURLAuth(key, url); !ok || got != rump {
+		t.Errorf("CheckURLAuth() = %q, %v, want %q, true", got, ok, rump)
+	}
+	if _, ok := CheckURLAuth([]byte("reset"), url); ok {
+		t.Error("Expected an URL authorized with another key not to be valid")
+	}
+	if _, ok := CheckURLAuth(key, rump+":INTERNAL:0123"); ok {
+		t.Error("Expected an URL with a bad token not to be valid")
+	}
+
+	expired := "imap://joe@example.com/INBOX/;uid=20;expire=" + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339) + ";urlauth=anonymous"
+	url = imap.FormatURLAuth(expired, imap.URLAuthInternal, URLAuthToken(key, expired))
+	if _, ok := CheckURLAuth(key, url); ok {
+		t.Error("Expected an expired URL not to be valid")
+	}
+}
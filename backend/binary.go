@@ -0,0 +1,14 @@
+package backend
+
+// BinaryBackend is a Backend that can decode the content transfer encoding of
+// body parts, as defined in RFC 3516. If SupportBinary returns true, the
+// server advertises the BINARY capability and Message.Fetch must handle the
+// BINARY[], BINARY.PEEK[] and BINARY.SIZE[] items, see
+// imap.BodySectionName.Binary and imap.BinarySizeItem.
+type BinaryBackend interface {
+	Backend
+
+	// SupportBinary returns true if messages returned by this backend support
+	// BINARY fetch items.
+	SupportBinary() bool
+}
@@ -0,0 +1,25 @@
+package backend
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+// ErrBadURL is returned by CatenateUser.ResolveURL if the URL is invalid or
+// doesn't reference any data.
+var ErrBadURL = errors.New("Invalid URL")
+
+// CatenateUser is a User that can resolve IMAP URLs, allowing clients to
+// compose messages from existing ones with APPEND CATENATE, as defined in RFC
+// 4469.
+type CatenateUser interface {
+	User
+
+	// ResolveURL returns the data referenced by an IMAP URL, as defined in RFC
+	// 5092. The URL is either absolute or relative to the server root, and
+	// references a message or a body part. If the URL is invalid or references
+	// data the user can't access, ErrBadURL must be returned. The server only
+	// passes URLs which can be parsed with imapurl.Parse.
+	ResolveURL(url string) (imap.Literal, error)
+}
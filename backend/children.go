@@ -0,0 +1,14 @@
+package backend
+
+// ChildrenMailbox is a Mailbox that can tell whether it has child mailboxes
+// without listing all mailboxes. The server uses it to return the
+// \HasChildren and \HasNoChildren attributes defined in RFC 3348 in LIST
+// responses. For other mailboxes, the server looks up children in the result
+// of User.ListMailboxes.
+type ChildrenMailbox interface {
+	Mailbox
+
+	// HasChildren checks if the mailbox has child mailboxes, which may not be
+	// selectable themselves.
+	HasChildren() (bool, error)
+}
@@ -0,0 +1,17 @@
+package backend
+
+// IDBackend is a Backend exchanging identification with clients, as defined in
+// RFC 2971. If the backend implements IDBackend, the server advertises the ID
+// capability.
+type IDBackend interface {
+	Backend
+
+	// ID is called when a client sends its identification with the ID
+	// command. clientID is nil if the client sent NIL. The returned server
+	// identification is sent back to the client, a nil map is sent as NIL.
+	//
+	// If an error is returned, e.g. to refuse a client known to be broken,
+	// the server sends a BYE response with the error and closes the
+	// connection.
+	ID(clientID map[string]string) (serverID map[string]string, err error)
+}
@@ -50,6 +50,9 @@ type Mailbox interface {
 	//
 	// If the Backend implements Updater, it must notify the client immediately
 	// via a mailbox update.
+	//
+	// body has already been read from the connection: it doesn't need to be
+	// read entirely if an error occurs.
 	CreateMessage(flags []string, date time.Time, body imap.Literal) error
 
 	// UpdateMessagesFlags alters flags for the specified message(s).
@@ -39,11 +39,13 @@ Hi there :)`
 			user: user,
 			Messages: []*Message{
 				{
-					Uid:   6,
-					Date:  time.Now(),
-					Flags: []string{"\\Seen"},
-					Size:  uint32(len(body)),
-					Body:  []byte(body),
+					Uid:      6,
+					Date:     time.Now(),
+					Flags:    []string{"\\Seen"},
+					Size:     uint32(len(body)),
+					Body:     []byte(body),
+					ModSeq:   1,
+					SaveDate: time.Now(),
 				},
 			},
 		},
@@ -1,22 +1,50 @@
 package memory
 
 import (
+	"errors"
 	"io/ioutil"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/backend"
 	"github.com/emersion/go-imap/backend/backendutil"
+	"github.com/emersion/go-imap/sortthread"
 )
 
 var Delimiter = "/"
 
+type expungedMessage struct {
+	uid    uint32
+	modSeq uint64
+}
+
 type Mailbox struct {
 	Subscribed bool
 	Messages   []*Message
 
 	name string
 	user *User
+	// The object ID, see RFC 8474. If empty, it is assigned when first
+	// requested.
+	id string
+	// The highest mod-sequence. If zero, it is computed from Messages.
+	modSeq uint64
+	// Expunged messages, used for QRESYNC.
+	expunged []expungedMessage
+	// The access control list. If nil, only the owner has rights, and they
+	// have all of them.
+	acl map[string]imap.ACLRights
+
+	idleLocker sync.Mutex
+	idlers     []*idler
+}
+
+// An idler is a client idling on a mailbox.
+type idler struct {
+	updates chan<- interface{}
+	done    <-chan struct{}
 }
 
 func (mbox *Mailbox) Name() string {
@@ -31,6 +59,14 @@ func (mbox *Mailbox) Info() (*imap.MailboxInfo, error) {
 	return info, nil
 }
 
+func (mbox *Mailbox) mailboxId() string {
+	if mbox.id == "" {
+		mbox.user.lastMailboxId++
+		mbox.id = "F" + strconv.FormatUint(mbox.user.lastMailboxId, 10)
+	}
+	return mbox.id
+}
+
 func (mbox *Mailbox) uidNext() uint32 {
 	var uid uint32
 	for _, msg := range mbox.Messages {
@@ -42,6 +78,23 @@ func (mbox *Mailbox) uidNext() uint32 {
 	return uid
 }
 
+func (mbox *Mailbox) highestModSeq() uint64 {
+	if mbox.modSeq == 0 {
+		// Messages can be created with a mod-sequence, e.g. by New
+		for _, msg := range mbox.Messages {
+			if msg.ModSeq > mbox.modSeq {
+				mbox.modSeq = msg.ModSeq
+			}
+		}
+	}
+	return mbox.modSeq
+}
+
+func (mbox *Mailbox) nextModSeq() uint64 {
+	mbox.modSeq = mbox.highestModSeq() + 1
+	return mbox.modSeq
+}
+
 func (mbox *Mailbox) flags() []string {
 	flagsMap := make(map[string]bool)
 	for _, msg := range mbox.Messages {
@@ -96,6 +149,22 @@ func (mbox *Mailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, error
 			status.Recent = 0 // TODO
 		case imap.StatusUnseen:
 			status.Unseen = 0 // TODO
+		case imap.StatusHighestModSeq:
+			status.HighestModSeq = mbox.highestModSeq()
+		case imap.StatusMailboxId:
+			status.MailboxId = mbox.mailboxId()
+		case imap.StatusSize:
+			status.Size = 0
+			for _, msg := range mbox.Messages {
+				status.Size += uint64(msg.Size)
+			}
+		case imap.StatusDeleted:
+			status.Deleted = 0
+			for _, msg := range mbox.Messages {
+				if backendutil.HasFlag(msg.Flags, imap.DeletedFlag) {
+					status.Deleted++
+				}
+			}
 		}
 	}
 
@@ -112,6 +181,10 @@ func (mbox *Mailbox) Check() error {
 }
 
 func (mbox *Mailbox) ListMessages(uid bool, seqSet *imap.SeqSet, items []imap.FetchItem, ch chan<- *imap.Message) error {
+	return mbox.ListMessagesChangedSince(uid, seqSet, 0, items, ch)
+}
+
+func (mbox *Mailbox) ListMessagesChangedSince(uid bool, seqSet *imap.SeqSet, modSeq uint64, items []imap.FetchItem, ch chan<- *imap.Message) error {
 	defer close(ch)
 
 	for i, msg := range mbox.Messages {
@@ -123,7 +196,7 @@ func (mbox *Mailbox) ListMessages(uid bool, seqSet *imap.SeqSet, items []imap.Fe
 		} else {
 			id = seqNum
 		}
-		if !seqSet.Contains(id) {
+		if !seqSet.Contains(id) || (modSeq > 0 && msg.ModSeq <= modSeq) {
 			continue
 		}
 
@@ -159,27 +232,80 @@ func (mbox *Mailbox) SearchMessages(uid bool, criteria *imap.SearchCriteria) ([]
 	return ids, nil
 }
 
-func (mbox *Mailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) error {
-	if date.IsZero() {
-		date = time.Now()
+func (mbox *Mailbox) Sort(uid bool, sortCriteria []sortthread.SortCriterion, searchCriteria *imap.SearchCriteria) ([]uint32, error) {
+	items := append([]imap.FetchItem{imap.FetchUid}, backendutil.SortFetchItems...)
+
+	var msgs []*imap.Message
+	for i, msg := range mbox.Messages {
+		seqNum := uint32(i + 1)
+
+		ok, err := msg.Match(seqNum, searchCriteria)
+		if err != nil || !ok {
+			continue
+		}
+
+		fetched, err := msg.Fetch(seqNum, items)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, fetched)
 	}
 
-	b, err := ioutil.ReadAll(body)
-	if err != nil {
-		return err
+	backendutil.Sort(msgs, sortCriteria)
+
+	ids := make([]uint32, len(msgs))
+	for i, msg := range msgs {
+		if uid {
+			ids[i] = msg.Uid
+		} else {
+			ids[i] = msg.SeqNum
+		}
 	}
+	return ids, nil
+}
 
-	mbox.Messages = append(mbox.Messages, &Message{
-		Uid:   mbox.uidNext(),
-		Date:  date,
-		Size:  uint32(len(b)),
-		Flags: flags,
-		Body:  b,
-	})
+func (mbox *Mailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) error {
+	return mbox.CreateMessages([]*imap.AppendMessage{{Flags: flags, Date: date, Body: body}})
+}
+
+func (mbox *Mailbox) CreateMessages(msgs []*imap.AppendMessage) error {
+	// Read all messages first, so that none is appended if one can't be read
+	bodies := make([][]byte, len(msgs))
+	for i, msg := range msgs {
+		b, err := ioutil.ReadAll(msg.Body)
+		if err != nil {
+			return err
+		}
+		bodies[i] = b
+	}
+
+	for i, msg := range msgs {
+		date := msg.Date
+		if date.IsZero() {
+			date = time.Now()
+		}
+
+		mbox.Messages = append(mbox.Messages, &Message{
+			Uid:      mbox.uidNext(),
+			Date:     date,
+			Size:     uint32(len(bodies[i])),
+			Flags:    msg.Flags,
+			Body:     bodies[i],
+			ModSeq:   mbox.nextModSeq(),
+			SaveDate: time.Now(),
+		})
+	}
+	mbox.notifyExists()
 	return nil
 }
 
 func (mbox *Mailbox) UpdateMessagesFlags(uid bool, seqset *imap.SeqSet, op imap.FlagsOp, flags []string) error {
+	_, err := mbox.UpdateMessagesFlagsUnchangedSince(uid, seqset, 0, op, flags)
+	return err
+}
+
+func (mbox *Mailbox) UpdateMessagesFlagsUnchangedSince(uid bool, seqset *imap.SeqSet, unchangedSince uint64, op imap.FlagsOp, flags []string) (*imap.SeqSet, error) {
+	modified := new(imap.SeqSet)
 	for i, msg := range mbox.Messages {
 		var id uint32
 		if uid {
@@ -190,19 +316,89 @@ func (mbox *Mailbox) UpdateMessagesFlags(uid bool, seqset *imap.SeqSet, op imap.
 		if !seqset.Contains(id) {
 			continue
 		}
+		if unchangedSince > 0 && msg.ModSeq > unchangedSince {
+			modified.AddNum(id)
+			continue
+		}
 
 		msg.Flags = backendutil.UpdateFlags(msg.Flags, op, flags)
+		msg.ModSeq = mbox.nextModSeq()
+
+		seqNum, msgUid, msgFlags, msgModSeq := uint32(i+1), msg.Uid, msg.Flags, msg.ModSeq
+		mbox.notifyIdlers(func() interface{} {
+			m := imap.NewMessage(seqNum, []imap.FetchItem{imap.FetchFlags})
+			m.Flags = msgFlags
+			m.Uid = msgUid
+			m.ModSeq = msgModSeq
+			return &backend.MessageUpdate{Message: m}
+		})
 	}
 
+	return modified, nil
+}
+
+func (mbox *Mailbox) SetAnnotations(uid bool, seqset *imap.SeqSet, annotations map[string]map[string]*string) error {
+	for i, msg := range mbox.Messages {
+		var id uint32
+		if uid {
+			id = msg.Uid
+		} else {
+			id = uint32(i + 1)
+		}
+		if !seqset.Contains(id) {
+			continue
+		}
+
+		for entry, attribs := range annotations {
+			for attrib, value := range attribs {
+				if value == nil {
+					delete(msg.Annotations[entry], attrib)
+					if len(msg.Annotations[entry]) == 0 {
+						delete(msg.Annotations, entry)
+					}
+					continue
+				}
+				if msg.Annotations == nil {
+					msg.Annotations = make(map[string]map[string]string)
+				}
+				if msg.Annotations[entry] == nil {
+					msg.Annotations[entry] = make(map[string]string)
+				}
+				msg.Annotations[entry][attrib] = *value
+			}
+		}
+		msg.ModSeq = mbox.nextModSeq()
+	}
 	return nil
 }
 
+func (mbox *Mailbox) CreateMessagesUid(msgs []*imap.AppendMessage) (*imap.AppendUid, error) {
+	first := mbox.uidNext()
+	if err := mbox.CreateMessages(msgs); err != nil {
+		return nil, err
+	}
+
+	uids := new(imap.SeqSet)
+	uids.AddRange(first, first+uint32(len(msgs))-1)
+	return &imap.AppendUid{UidValidity: 1, Uids: uids}, nil
+}
+
 func (mbox *Mailbox) CopyMessages(uid bool, seqset *imap.SeqSet, destName string) error {
+	_, err := mbox.CopyMessagesUid(uid, seqset, destName)
+	return err
+}
+
+func (mbox *Mailbox) CopyMessagesUid(uid bool, seqset *imap.SeqSet, destName string) (*imap.CopyUid, error) {
 	dest, ok := mbox.user.mailboxes[destName]
 	if !ok {
-		return backend.ErrNoSuchMailbox
+		return nil, backend.ErrNoSuchMailbox
 	}
 
+	data := &imap.CopyUid{
+		UidValidity: 1,
+		SourceUids:  new(imap.SeqSet),
+		DestUids:    new(imap.SeqSet),
+	}
 	for i, msg := range mbox.Messages {
 		var id uint32
 		if uid {
@@ -216,28 +412,191 @@ func (mbox *Mailbox) CopyMessages(uid bool, seqset *imap.SeqSet, destName string
 
 		msgCopy := *msg
 		msgCopy.Uid = dest.uidNext()
+		msgCopy.ModSeq = dest.nextModSeq()
+		msgCopy.SaveDate = time.Now()
 		dest.Messages = append(dest.Messages, &msgCopy)
+		dest.notifyExists()
+
+		data.SourceUids.AddNum(msg.Uid)
+		data.DestUids.AddNum(msgCopy.Uid)
 	}
 
-	return nil
+	return data, nil
 }
 
 func (mbox *Mailbox) Expunge() error {
+	return mbox.UidExpunge(nil)
+}
+
+// UidExpunge expunges deleted messages whose UID is in seqset. If seqset is
+// nil, all deleted messages are expunged.
+func (mbox *Mailbox) UidExpunge(seqset *imap.SeqSet) error {
 	for i := len(mbox.Messages) - 1; i >= 0; i-- {
 		msg := mbox.Messages[i]
+		if seqset != nil && !seqset.Contains(msg.Uid) {
+			continue
+		}
 
-		deleted := false
-		for _, flag := range msg.Flags {
-			if flag == imap.DeletedFlag {
-				deleted = true
-				break
-			}
+		if backendutil.HasFlag(msg.Flags, imap.DeletedFlag) {
+			mbox.expungeMessage(i)
+		}
+	}
+
+	return nil
+}
+
+// expungeMessage removes the message at index i.
+func (mbox *Mailbox) expungeMessage(i int) {
+	msg := mbox.Messages[i]
+	mbox.Messages = append(mbox.Messages[:i], mbox.Messages[i+1:]...)
+	mbox.expunged = append(mbox.expunged, expungedMessage{msg.Uid, mbox.nextModSeq()})
+
+	seqNum, uid := uint32(i+1), msg.Uid
+	mbox.notifyIdlers(func() interface{} {
+		return &backend.ExpungeUpdate{SeqNum: seqNum, Uid: uid}
+	})
+}
+
+func (mbox *Mailbox) MoveMessages(uid bool, seqset *imap.SeqSet, destName string) (*imap.CopyUid, error) {
+	data, err := mbox.CopyMessagesUid(uid, seqset, destName)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(mbox.Messages) - 1; i >= 0; i-- {
+		if data.SourceUids.Contains(mbox.Messages[i].Uid) {
+			mbox.expungeMessage(i)
 		}
+	}
 
-		if deleted {
-			mbox.Messages = append(mbox.Messages[:i], mbox.Messages[i+1:]...)
+	return data, nil
+}
+
+func (mbox *Mailbox) ReplaceMessage(uid bool, id uint32, destName string, msg *imap.AppendMessage) (*imap.AppendUid, error) {
+	dest, ok := mbox.user.mailboxes[destName]
+	if !ok {
+		return nil, backend.ErrNoSuchMailbox
+	}
+
+	i := -1
+	for j, m := range mbox.Messages {
+		if (uid && m.Uid == id) || (!uid && uint32(j+1) == id) {
+			i = j
+			break
 		}
 	}
+	if i < 0 {
+		return nil, errors.New("No such message")
+	}
+
+	data, err := dest.CreateMessagesUid([]*imap.AppendMessage{msg})
+	if err != nil {
+		return nil, err
+	}
 
+	mbox.expungeMessage(i)
+	return data, nil
+}
+
+func (mbox *Mailbox) ExpungedSince(modSeq uint64) ([]uint32, error) {
+	var uids []uint32
+	for _, msg := range mbox.expunged {
+		if msg.modSeq > modSeq {
+			uids = append(uids, msg.uid)
+		}
+	}
+	return uids, nil
+}
+
+func (mbox *Mailbox) GetACL() (map[string]imap.ACLRights, error) {
+	if mbox.acl == nil {
+		return map[string]imap.ACLRights{mbox.user.username: imap.AllRights}, nil
+	}
+
+	acl := make(map[string]imap.ACLRights, len(mbox.acl))
+	for identifier, rights := range mbox.acl {
+		acl[identifier] = rights
+	}
+	return acl, nil
+}
+
+func (mbox *Mailbox) SetACL(identifier string, mode imap.ACLMode, rights imap.ACLRights) error {
+	acl, err := mbox.GetACL()
+	if err != nil {
+		return err
+	}
+	acl[identifier] = acl[identifier].Modify(mode, rights)
+	mbox.acl = acl
 	return nil
 }
+
+func (mbox *Mailbox) DeleteACL(identifier string) error {
+	acl, err := mbox.GetACL()
+	if err != nil {
+		return err
+	}
+	delete(acl, identifier)
+	mbox.acl = acl
+	return nil
+}
+
+func (mbox *Mailbox) ListRights(identifier string) (imap.ACLRights, []imap.ACLRights, error) {
+	optional := make([]imap.ACLRights, len(imap.AllRights))
+	for i := range optional {
+		optional[i] = imap.AllRights[i : i+1]
+	}
+	return "", optional, nil
+}
+
+func (mbox *Mailbox) MyRights() (imap.ACLRights, error) {
+	acl, err := mbox.GetACL()
+	if err != nil {
+		return "", err
+	}
+	return acl[mbox.user.username].Modify(imap.ACLModeAdd, acl["anyone"]), nil
+}
+
+func (mbox *Mailbox) Idle(updates chan<- interface{}, done <-chan struct{}) {
+	i := &idler{updates, done}
+
+	mbox.idleLocker.Lock()
+	mbox.idlers = append(mbox.idlers, i)
+	mbox.idleLocker.Unlock()
+
+	<-done
+
+	mbox.idleLocker.Lock()
+	for j, other := range mbox.idlers {
+		if other == i {
+			mbox.idlers = append(mbox.idlers[:j], mbox.idlers[j+1:]...)
+			break
+		}
+	}
+	mbox.idleLocker.Unlock()
+}
+
+// notifyIdlers sends an update to each client idling on this mailbox.
+// newUpdate is called once per client, since an update cannot be shared. The
+// update is dropped for clients which stop idling before receiving it.
+func (mbox *Mailbox) notifyIdlers(newUpdate func() interface{}) {
+	mbox.idleLocker.Lock()
+	idlers := make([]*idler, len(mbox.idlers))
+	copy(idlers, mbox.idlers)
+	mbox.idleLocker.Unlock()
+
+	for _, i := range idlers {
+		select {
+		case i.updates <- newUpdate():
+		case <-i.done:
+		}
+	}
+}
+
+func (mbox *Mailbox) notifyExists() {
+	n := uint32(len(mbox.Messages))
+	mbox.notifyIdlers(func() interface{} {
+		status := imap.NewMailboxStatus(mbox.name, []imap.StatusItem{imap.StatusMessages})
+		status.Messages = n
+		return &backend.MailboxUpdate{MailboxStatus: status}
+	})
+}
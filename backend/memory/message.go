@@ -2,6 +2,8 @@ package memory
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"time"
 
 	"github.com/emersion/go-imap"
@@ -10,17 +12,28 @@ import (
 )
 
 type Message struct {
-	Uid   uint32
-	Date  time.Time
-	Size  uint32
-	Flags []string
-	Body  []byte
+	Uid      uint32
+	Date     time.Time
+	Size     uint32
+	Flags    []string
+	Body     []byte
+	ModSeq   uint64
+	SaveDate time.Time
+	// Annotations map entry names to attribute values, see RFC 5257.
+	Annotations map[string]map[string]string
 }
 
 func (m *Message) entity() (*message.Entity, error) {
 	return message.Read(bytes.NewReader(m.Body))
 }
 
+// emailId derives the object ID of the message from its body, which never
+// changes. Copies of the message get the same ID.
+func (m *Message) emailId() string {
+	sum := sha1.Sum(m.Body)
+	return "M" + hex.EncodeToString(sum[:12])
+}
+
 func (m *Message) Fetch(seqNum uint32, items []imap.FetchItem) (*imap.Message, error) {
 	fetched := imap.NewMessage(seqNum, items)
 	for _, item := range items {
@@ -39,7 +52,26 @@ func (m *Message) Fetch(seqNum uint32, items []imap.FetchItem) (*imap.Message, e
 			fetched.Size = m.Size
 		case imap.FetchUid:
 			fetched.Uid = m.Uid
+		case imap.FetchModSeq:
+			fetched.ModSeq = m.ModSeq
+		case imap.FetchEmailId:
+			fetched.EmailId = m.emailId()
+		case imap.FetchSaveDate:
+			fetched.SaveDate = m.SaveDate
+		case imap.FetchPreview:
+			e, _ := m.entity()
+			fetched.Preview, _ = backendutil.FetchPreview(e)
 		default:
+			if entries, attribs, err := imap.ParseAnnotationItem(item); err == nil {
+				fetched.Annotations = backendutil.FetchAnnotations(m.Annotations, entries, attribs)
+				break
+			}
+			if path, err := imap.ParseBinarySizeItem(item); err == nil {
+				e, _ := m.entity()
+				fetched.Items[item], _ = backendutil.FetchBinarySize(e, path)
+				break
+			}
+
 			section, err := imap.ParseBodySectionName(item)
 			if err != nil {
 				break
@@ -64,6 +96,15 @@ func (m *Message) Match(seqNum uint32, c *imap.SearchCriteria) (bool, error) {
 	if !backendutil.MatchFlags(m.Flags, c) {
 		return false, nil
 	}
+	if !backendutil.MatchModSeq(m.ModSeq, c) {
+		return false, nil
+	}
+	if !backendutil.MatchSaveDate(m.SaveDate, c) {
+		return false, nil
+	}
+	if !backendutil.MatchAnnotations(m.Annotations, c) {
+		return false, nil
+	}
 
 	e, _ := m.entity()
 	return backendutil.Match(e, c)
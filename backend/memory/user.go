@@ -10,6 +10,8 @@ type User struct {
 	username  string
 	password  string
 	mailboxes map[string]*Mailbox
+	// The last assigned mailbox object ID.
+	lastMailboxId uint64
 }
 
 func (u *User) Username() string {
@@ -62,14 +64,20 @@ func (u *User) RenameMailbox(existingName, newName string) error {
 		return errors.New("No such mailbox")
 	}
 
-	u.mailboxes[newName] = &Mailbox{
+	newMbox := &Mailbox{
 		name:     newName,
 		Messages: mbox.Messages,
 		user:     u,
 	}
+	u.mailboxes[newName] = newMbox
 
 	mbox.Messages = nil
 
+	// Renaming INBOX creates a new mailbox, see RFC 8474 section 4.2
+	if existingName != "INBOX" {
+		newMbox.id = mbox.id
+	}
+
 	if existingName != "INBOX" {
 		delete(u.mailboxes, existingName)
 	}
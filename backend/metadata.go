@@ -0,0 +1,42 @@
+package backend
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// MetadataBackend is a Backend that stores metadata, as defined in RFC 5464.
+// If SupportMetadata returns true, the server advertises the METADATA
+// capability, users must implement MetadataUser and mailboxes must implement
+// MetadataMailbox.
+type MetadataBackend interface {
+	Backend
+
+	// SupportMetadata returns true if users and mailboxes returned by this
+	// backend support metadata.
+	SupportMetadata() bool
+}
+
+// MetadataUser is a User that stores server metadata entries.
+type MetadataUser interface {
+	User
+
+	// GetMetadata returns the server entries matching entries with the provided
+	// depth, see imap.MatchMetadataEntry. Entries that don't exist are omitted.
+	GetMetadata(entries []string, depth imap.MetadataDepth) (map[string]string, error)
+
+	// SetMetadata sets server entries. Entries with a nil value are removed.
+	SetMetadata(entries map[string]*string) error
+}
+
+// MetadataMailbox is a Mailbox that stores metadata entries.
+type MetadataMailbox interface {
+	Mailbox
+
+	// GetMetadata returns the mailbox entries matching entries with the
+	// provided depth, see imap.MatchMetadataEntry. Entries that don't exist are
+	// omitted.
+	GetMetadata(entries []string, depth imap.MetadataDepth) (map[string]string, error)
+
+	// SetMetadata sets mailbox entries. Entries with a nil value are removed.
+	SetMetadata(entries map[string]*string) error
+}
@@ -0,0 +1,60 @@
+package backend
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// ModSeqBackend is a Backend that supports per-message mod-sequences, as
+// defined in RFC 7162. If SupportModSeq returns true, the server advertises the
+// CONDSTORE capability and mailboxes must implement ModSeqMailbox.
+type ModSeqBackend interface {
+	Backend
+
+	// SupportModSeq returns true if mailboxes returned by this backend
+	// support mod-sequences.
+	SupportModSeq() bool
+}
+
+// ModSeqMailbox is a Mailbox that keeps a mod-sequence for each message. The
+// mod-sequence of a message must be increased each time its metadata (e.g. its
+// flags) is changed. Status must populate HighestModSeq when
+// imap.StatusHighestModSeq is requested, and ListMessages must populate ModSeq
+// when imap.FetchModSeq is requested.
+type ModSeqMailbox interface {
+	Mailbox
+
+	// ListMessagesChangedSince is identical to ListMessages, but only lists
+	// messages whose mod-sequence is greater than modSeq. See RFC 7162 section
+	// 3.1.4.1.
+	ListMessagesChangedSince(uid bool, seqset *imap.SeqSet, modSeq uint64, items []imap.FetchItem, ch chan<- *imap.Message) error
+
+	// UpdateMessagesFlagsUnchangedSince is identical to UpdateMessagesFlags,
+	// but only updates messages whose mod-sequence is lower than or equal to
+	// unchangedSince. It returns the sequence numbers or UIDs of the other
+	// messages. See RFC 7162 section 3.1.3.
+	UpdateMessagesFlagsUnchangedSince(uid bool, seqset *imap.SeqSet, unchangedSince uint64, operation imap.FlagsOp, flags []string) (*imap.SeqSet, error)
+}
+
+// QResyncBackend is a ModSeqBackend that supports quick mailbox
+// resynchronization, as defined in RFC 7162 section 3.2. If SupportQResync
+// returns true, the server advertises the QRESYNC capability and mailboxes must
+// implement QResyncMailbox.
+type QResyncBackend interface {
+	ModSeqBackend
+
+	// SupportQResync returns true if mailboxes returned by this backend
+	// remember expunged messages.
+	SupportQResync() bool
+}
+
+// QResyncMailbox is a ModSeqMailbox that remembers the mod-sequence at which
+// messages have been expunged. Expunging messages must increase the mailbox
+// highest mod-sequence.
+type QResyncMailbox interface {
+	ModSeqMailbox
+
+	// ExpungedSince returns the UIDs of the messages expunged after modSeq.
+	// Backends may return more UIDs than necessary, for instance if they don't
+	// remember all expunged messages.
+	ExpungedSince(modSeq uint64) ([]uint32, error)
+}
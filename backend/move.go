@@ -0,0 +1,30 @@
+package backend
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// MoveBackend is a Backend that can move messages between mailboxes, as
+// defined in RFC 6851. If SupportMove returns true, the server advertises the
+// MOVE capability and mailboxes must implement MoveMailbox.
+type MoveBackend interface {
+	Backend
+
+	// SupportMove returns true if mailboxes returned by this backend support
+	// MOVE.
+	SupportMove() bool
+}
+
+// MoveMailbox is a Mailbox that can move messages to another mailbox.
+type MoveMailbox interface {
+	Mailbox
+
+	// MoveMessages moves messages to the mailbox named dest: they are copied
+	// to dest and expunged from this mailbox, without being visible in both
+	// mailboxes at the same time. The expunged messages must be reported with
+	// updates, like with Expunge.
+	//
+	// If the backend supports UIDPLUS, the UIDs assigned to the moved messages
+	// must be returned, otherwise the returned CopyUid can be nil.
+	MoveMessages(uid bool, seqset *imap.SeqSet, dest string) (*imap.CopyUid, error)
+}
@@ -0,0 +1,27 @@
+package backend
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// MultiAppendBackend is a Backend that supports appending several messages
+// with a single command, as defined in RFC 3502. If SupportMultiAppend returns
+// true, the server advertises the MULTIAPPEND capability and mailboxes must
+// implement MultiAppendMailbox.
+type MultiAppendBackend interface {
+	Backend
+
+	// SupportMultiAppend returns true if mailboxes returned by this backend
+	// support appending several messages atomically.
+	SupportMultiAppend() bool
+}
+
+// MultiAppendMailbox is a Mailbox that can append several messages atomically.
+type MultiAppendMailbox interface {
+	Mailbox
+
+	// CreateMessages is identical to CreateMessage, but appends several
+	// messages. Either all messages are appended, or none of them if an error
+	// occurs.
+	CreateMessages(msgs []*imap.AppendMessage) error
+}
@@ -0,0 +1,13 @@
+package backend
+
+// OAuthBackend is a Backend supporting authentication with OAuth 2.0 bearer
+// tokens. The server enables the OAUTHBEARER and XOAUTH2 SASL mechanisms.
+type OAuthBackend interface {
+	Backend
+
+	// LoginOAuth authenticates a user with a bearer token. username is empty
+	// if the client used OAUTHBEARER without an authorization identity, in
+	// which case the user must be derived from the token. If an *oauth.Error
+	// is returned, it is sent to the client.
+	LoginOAuth(username, token string) (User, error)
+}
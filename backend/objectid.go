@@ -0,0 +1,19 @@
+package backend
+
+// ObjectIdBackend is a Backend that assigns stable unique identifiers to
+// mailboxes and messages, as defined in RFC 8474. If SupportObjectId returns
+// true, the server advertises the OBJECTID capability, Mailbox.Status must
+// populate MailboxId when imap.StatusMailboxId is requested and
+// Mailbox.ListMessages must populate EmailId and ThreadId when imap.FetchEmailId
+// and imap.FetchThreadId are requested.
+//
+// A mailbox ID must not change when the mailbox is renamed, and must not be
+// reused for another mailbox. An email ID must not change for the lifetime of
+// the message.
+type ObjectIdBackend interface {
+	Backend
+
+	// SupportObjectId returns true if mailboxes and messages returned by this
+	// backend have object IDs.
+	SupportObjectId() bool
+}
@@ -0,0 +1,14 @@
+package backend
+
+// PreviewBackend is a Backend that can generate message previews, as defined
+// in RFC 8970. If SupportPreview returns true, the server advertises the
+// PREVIEW capability and Message.Fetch must populate Preview when
+// imap.FetchPreview is requested. Backends that don't store previews can
+// generate them with backendutil.FetchPreview.
+type PreviewBackend interface {
+	Backend
+
+	// SupportPreview returns true if messages returned by this backend support
+	// the PREVIEW fetch item.
+	SupportPreview() bool
+}
@@ -0,0 +1,37 @@
+package backend
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+var (
+	// ErrNoSuchQuotaRoot is returned by QuotaUser.GetQuota and
+	// QuotaUser.SetQuota when the quota root doesn't exist.
+	ErrNoSuchQuotaRoot = errors.New("No such quota root")
+	// ErrQuotaExceeded can be returned by Mailbox.CreateMessage when the
+	// message doesn't fit in a quota. The server replies with the OVERQUOTA
+	// response code.
+	ErrQuotaExceeded = errors.New("Quota exceeded")
+)
+
+// QuotaUser is a User whose resources are limited by quotas, as defined in RFC
+// 9208. If the logged in user implements QuotaUser, the server advertises the
+// QUOTA capability and checks quotas before appending messages.
+type QuotaUser interface {
+	User
+
+	// GetQuota returns the status of a quota root. If the quota root doesn't
+	// exist, it returns ErrNoSuchQuotaRoot.
+	GetQuota(root string) (*imap.Quota, error)
+
+	// GetQuotaRoots returns the names of the quota roots of a mailbox. If the
+	// mailbox doesn't exist, it returns ErrNoSuchMailbox.
+	GetQuotaRoots(mailbox string) ([]string, error)
+
+	// SetQuota changes the limits of a quota root. Resources missing from
+	// limits are not limited anymore. Backends can refuse to change limits,
+	// e.g. if the user isn't an administrator.
+	SetQuota(root string, limits map[string]uint64) error
+}
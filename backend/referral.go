@@ -0,0 +1,17 @@
+package backend
+
+// ReferralBackend is a Backend that can redirect clients to other servers, as
+// defined in RFC 2221 and RFC 2193. Login can return an *imap.ReferralError if
+// the user should log in on another server. Mailbox operations can return an
+// *imap.ReferralError if the mailbox lives on another server.
+type ReferralBackend interface {
+	Backend
+
+	// SupportLoginReferrals returns true if Login may return referrals. If it
+	// does, the server advertises the LOGIN-REFERRALS capability.
+	SupportLoginReferrals() bool
+	// SupportMailboxReferrals returns true if mailbox operations may return
+	// referrals. If it does, the server advertises the MAILBOX-REFERRALS
+	// capability.
+	SupportMailboxReferrals() bool
+}
@@ -0,0 +1,30 @@
+package backend
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// ReplaceBackend is a Backend that can replace messages, as defined in RFC
+// 8508. If SupportReplace returns true, the server advertises the REPLACE
+// capability and mailboxes must implement ReplaceMailbox.
+type ReplaceBackend interface {
+	Backend
+
+	// SupportReplace returns true if mailboxes returned by this backend
+	// support REPLACE.
+	SupportReplace() bool
+}
+
+// ReplaceMailbox is a Mailbox that can replace a message with a new one.
+type ReplaceMailbox interface {
+	Mailbox
+
+	// ReplaceMessage appends msg to the mailbox named dest and expunges the
+	// message id from this mailbox, as a single atomic operation. id is a UID
+	// if uid is true, a sequence number otherwise. The expunged message must
+	// be reported with updates, like with Expunge.
+	//
+	// If the backend supports UIDPLUS, the UID assigned to the new message
+	// must be returned, otherwise the returned AppendUid can be nil.
+	ReplaceMessage(uid bool, id uint32, dest string, msg *imap.AppendMessage) (*imap.AppendUid, error)
+}
@@ -0,0 +1,18 @@
+package backend
+
+// SaveDateBackend is a Backend that keeps the date each message was saved to
+// its mailbox, as defined in RFC 8514. If SupportSaveDate returns true, the
+// server advertises the SAVEDATE capability, Message.Fetch must populate
+// SaveDate when imap.FetchSaveDate is requested and Mailbox.SearchMessages must
+// handle the SavedSince, SavedBefore and SavedDateSupported criteria, see
+// backendutil.MatchSaveDate.
+//
+// The save date of a message is set when it is appended, copied or moved to a
+// mailbox. Mailboxes that don't keep save dates leave it zero.
+type SaveDateBackend interface {
+	Backend
+
+	// SupportSaveDate returns true if messages returned by this backend have
+	// a save date.
+	SupportSaveDate() bool
+}
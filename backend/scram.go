@@ -0,0 +1,19 @@
+package backend
+
+import (
+	"github.com/emersion/go-imap/scram"
+)
+
+// SCRAMBackend is a Backend storing SCRAM credentials. The server enables the
+// SCRAM-SHA-256 SASL mechanism, and SCRAM-SHA-256-PLUS on TLS connections, so
+// that users can authenticate without sending their password.
+type SCRAMBackend interface {
+	Backend
+
+	// SCRAMCredentials returns the SCRAM-SHA-256 credentials of a user, see
+	// scram.NewCredentials.
+	SCRAMCredentials(username string) (*scram.Credentials, error)
+	// LoginSCRAM returns a user once the client has proven that it knows the
+	// password matching its credentials.
+	LoginSCRAM(username string) (User, error)
+}
@@ -0,0 +1,21 @@
+package backend
+
+import (
+	"errors"
+)
+
+// ErrUnsupportedUseAttr is returned by SpecialUseUser.CreateMailboxWithAttributes
+// if one of the special-use attributes isn't supported.
+var ErrUnsupportedUseAttr = errors.New("Unsupported special-use attribute")
+
+// SpecialUseUser is a User that can create mailboxes with special-use
+// attributes, as defined in RFC 6154 section 3.
+type SpecialUseUser interface {
+	User
+
+	// CreateMailboxWithAttributes creates a new mailbox with the provided
+	// special-use attributes. If an attribute isn't supported or can't be set
+	// on the new mailbox, ErrUnsupportedUseAttr must be returned and no mailbox
+	// must be created.
+	CreateMailboxWithAttributes(name string, attrs []string) error
+}
@@ -0,0 +1,13 @@
+package backend
+
+// StatusSizeBackend is a Backend that can report the size of mailboxes. If
+// SupportStatusSize returns true, the server advertises the STATUS=SIZE
+// capability, defined in RFC 8438, and Mailbox.Status must populate Size and
+// Deleted when imap.StatusSize and imap.StatusDeleted are requested.
+type StatusSizeBackend interface {
+	Backend
+
+	// SupportStatusSize returns true if mailboxes returned by this backend
+	// support the SIZE and DELETED status items.
+	SupportStatusSize() bool
+}
@@ -0,0 +1,35 @@
+package backend
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// UidPlusBackend is a Backend that reports the UIDs assigned to appended and
+// copied messages, as defined in RFC 4315. If SupportUidPlus returns true, the
+// server advertises the UIDPLUS capability and mailboxes must implement
+// UidPlusMailbox.
+type UidPlusBackend interface {
+	Backend
+
+	// SupportUidPlus returns true if mailboxes returned by this backend
+	// support UIDPLUS.
+	SupportUidPlus() bool
+}
+
+// UidPlusMailbox is a Mailbox that reports the UIDs assigned to appended and
+// copied messages, and that can expunge a set of messages.
+type UidPlusMailbox interface {
+	Mailbox
+
+	// CreateMessagesUid appends messages to the mailbox, like
+	// MultiAppendMailbox.CreateMessages, and returns the UIDs assigned to them.
+	CreateMessagesUid(msgs []*imap.AppendMessage) (*imap.AppendUid, error)
+
+	// CopyMessagesUid copies messages to the mailbox named dest, like
+	// Mailbox.CopyMessages, and returns the UIDs assigned to the copies.
+	CopyMessagesUid(uid bool, seqset *imap.SeqSet, dest string) (*imap.CopyUid, error)
+
+	// UidExpunge permanently removes the messages which have the \Deleted flag
+	// set and whose UID is in seqset.
+	UidExpunge(seqset *imap.SeqSet) error
+}
@@ -48,7 +48,9 @@ type MailboxUpdate struct {
 	*imap.MailboxStatus
 }
 
-// MessageUpdate is a message update.
+// MessageUpdate is a message update. Backends supporting mod-sequences should
+// fill the message UID and mod-sequence: they are sent to clients which enabled
+// CONDSTORE, see RFC 7162 section 3.2.
 type MessageUpdate struct {
 	Update
 	*imap.Message
@@ -58,6 +60,22 @@ type MessageUpdate struct {
 type ExpungeUpdate struct {
 	Update
 	SeqNum uint32
+	// The UID of the expunged message. Backends supporting QRESYNC must fill
+	// it: clients which enabled QRESYNC are sent a VANISHED response instead
+	// of EXPUNGE, see RFC 7162 section 3.2.10.
+	Uid uint32
+}
+
+// MailboxNameUpdate is a mailbox name update, sent when a mailbox is created,
+// deleted or renamed. Update.Mailbox is the name of the mailbox. A deleted
+// mailbox has the \NonExistent attribute, a renamed mailbox has its previous
+// name in the OLDNAME extended data item.
+//
+// These updates are only reported to clients which requested them with the
+// NOTIFY command, as defined in RFC 5465 section 5.4.
+type MailboxNameUpdate struct {
+	Update
+	*imap.MailboxInfo
 }
 
 // Updater is a Backend that implements Updater is able to send unilateral
@@ -79,6 +97,20 @@ type UpdaterMailbox interface {
 	Poll() error
 }
 
+// MailboxUpdater is a Mailbox that is able to push updates to clients idling
+// on it with the IDLE command, as defined in RFC 2177.
+type MailboxUpdater interface {
+	// Idle is called when a client starts idling on this mailbox. Until done is
+	// closed, the mailbox can send *MailboxUpdate, *MessageUpdate and
+	// *ExpungeUpdate values to updates. The server translates them to EXISTS,
+	// FETCH and EXPUNGE responses. An update value must not be sent to more
+	// than one client.
+	//
+	// Idle must return once done is closed. No update must be sent after Idle
+	// has returned.
+	Idle(updates chan<- interface{}, done <-chan struct{})
+}
+
 // WaitUpdates returns a channel that's closed when all provided updates have
 // been dispatched to all clients. It panics if one of the provided value is
 // not an update.
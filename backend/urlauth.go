@@ -0,0 +1,36 @@
+package backend
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+// ErrURLAuthUnsupported is returned by URLAuthUser.GenURLAuth if the URL
+// can't be authorized, e.g. because the mechanism isn't supported or the URL
+// references another user's mailbox.
+var ErrURLAuthUnsupported = errors.New("Cannot authorize URL")
+
+// URLAuthUser is a User that can authorize IMAP URLs so that they can be
+// fetched later by another party, e.g. a submission server, as defined in RFC
+// 4467. If the logged in user implements URLAuthUser, the server advertises
+// the URLAUTH capability. The INTERNAL mechanism must be supported, see
+// backendutil.URLAuthToken.
+type URLAuthUser interface {
+	User
+
+	// GenURLAuth returns the token authorizing a rump URL with a mechanism,
+	// see imap.IsURLAuthRump. If the URL can't be authorized,
+	// ErrURLAuthUnsupported must be returned.
+	GenURLAuth(rump, mechanism string) (token string, err error)
+
+	// URLFetch returns the data referenced by an authorized URL. The backend
+	// must check the URL's token, access identifier and expiration date, see
+	// imap.SplitURLAuth. If the URL is invalid, ErrBadURL must be returned.
+	URLFetch(url string) (imap.Literal, error)
+
+	// ResetKey invalidates the URLs authorized for a mailbox, or for all
+	// mailboxes if mailbox is empty. If mechanisms isn't empty, only URLs
+	// authorized with these mechanisms are invalidated.
+	ResetKey(mailbox string, mechanisms []string) error
+}
@@ -0,0 +1,13 @@
+package backend
+
+// WithinBackend is a Backend that can search messages by age, as defined in
+// RFC 5032. If SupportWithin returns true, the server advertises the WITHIN
+// capability and Mailbox.SearchMessages must handle the Younger and Older
+// criteria, see backendutil.MatchDate.
+type WithinBackend interface {
+	Backend
+
+	// SupportWithin returns true if mailboxes returned by this backend
+	// support the YOUNGER and OLDER search keys.
+	SupportWithin() bool
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// Capabilities describes the extensions supported by the server and the ones
+// enabled by the client. It is a snapshot returned by Client.CapabilitySet and
+// Client.Negotiate: it isn't updated when capabilities change, e.g. after
+// logging in. Extensions which have a Client.SupportX method, such as IDLE,
+// can be checked with Has.
+type Capabilities struct {
+	// Caps contains the capabilities advertised by the server. Keys are
+	// upper-case.
+	Caps map[string]bool
+	// Enabled contains the capabilities enabled with the ENABLE command. Keys
+	// are upper-case.
+	Enabled map[string]bool
+}
+
+// Has checks if the server advertises cap. Capability names are
+// case-insensitive.
+func (caps *Capabilities) Has(cap string) bool {
+	return caps.Caps[strings.ToUpper(cap)]
+}
+
+// IsEnabled checks if cap has been enabled with the ENABLE command.
+func (caps *Capabilities) IsEnabled(cap string) bool {
+	return caps.Enabled[strings.ToUpper(cap)]
+}
+
+// SupportsEnable checks if the server supports the ENABLE extension, defined
+// in RFC 5161.
+func (caps *Capabilities) SupportsEnable() bool {
+	return caps.Has("ENABLE")
+}
+
+// SupportsMove checks if the server supports the MOVE extension, defined in
+// RFC 6851.
+func (caps *Capabilities) SupportsMove() bool {
+	return caps.Has("MOVE")
+}
+
+// SupportsUidPlus checks if the server supports the UIDPLUS extension, defined
+// in RFC 4315.
+func (caps *Capabilities) SupportsUidPlus() bool {
+	return caps.Has("UIDPLUS")
+}
+
+// SupportsCondStore checks if the server supports the CONDSTORE extension,
+// defined in RFC 7162. QRESYNC implies CONDSTORE.
+func (caps *Capabilities) SupportsCondStore() bool {
+	return caps.Has("CONDSTORE") || caps.Has("QRESYNC")
+}
+
+// SupportsQresync checks if the server supports the QRESYNC extension, defined
+// in RFC 7162. It must be enabled before being used.
+func (caps *Capabilities) SupportsQresync() bool {
+	return caps.Has("QRESYNC")
+}
+
+// SupportsUTF8Accept checks if the server supports UTF8=ACCEPT, defined in RFC
+// 6855. It must be enabled before being used.
+func (caps *Capabilities) SupportsUTF8Accept() bool {
+	return caps.Has(imap.UTF8Accept)
+}
+
+// SupportsESearch checks if the server supports the ESEARCH extension, defined
+// in RFC 4731.
+func (caps *Capabilities) SupportsESearch() bool {
+	return caps.Has("ESEARCH")
+}
+
+// SupportsListStatus checks if the server supports the LIST-STATUS extension,
+// defined in RFC 5819.
+func (caps *Capabilities) SupportsListStatus() bool {
+	return caps.Has("LIST-STATUS")
+}
+
+// SupportsQuota checks if the server supports the QUOTA extension, defined in
+// RFC 2087.
+func (caps *Capabilities) SupportsQuota() bool {
+	return caps.Has("QUOTA")
+}
+
+// CapabilitySet returns the capabilities advertised by the server and the ones
+// enabled by the client. If the server hasn't sent its capabilities yet, they
+// are requested.
+func (c *Client) CapabilitySet() (*Capabilities, error) {
+	c.locker.Lock()
+	ok := c.caps != nil
+	c.locker.Unlock()
+
+	if !ok {
+		if _, err := c.Capability(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	caps := &Capabilities{
+		Caps:    make(map[string]bool, len(c.caps)),
+		Enabled: make(map[string]bool, len(c.enabled)),
+	}
+	for cap := range c.caps {
+		caps.Caps[strings.ToUpper(cap)] = true
+	}
+	for cap := range c.enabled {
+		caps.Enabled[cap] = true
+	}
+	return caps, nil
+}
+
+// Negotiate enables the extensions of want which are supported by the server
+// and not enabled yet, with a single ENABLE command, and returns the resulting
+// capabilities. Extensions the server doesn't advertise are ignored, as well
+// as all of them if the server doesn't support ENABLE. Negotiate must be
+// called after logging in, since servers may advertise more capabilities to
+// authenticated clients.
+func (c *Client) Negotiate(want ...string) (*Capabilities, error) {
+	if err := c.ensureAuthenticated(); err != nil {
+		return nil, err
+	}
+
+	caps, err := c.CapabilitySet()
+	if err != nil {
+		return nil, err
+	}
+	if !caps.SupportsEnable() {
+		return caps, nil
+	}
+
+	var enable []string
+	for _, cap := range want {
+		if caps.Has(cap) && !caps.IsEnabled(cap) {
+			enable = append(enable, cap)
+		}
+	}
+	if len(enable) == 0 {
+		return caps, nil
+	}
+
+	if _, err := c.Enable(enable...); err != nil {
+		return nil, err
+	}
+	return c.CapabilitySet()
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestClient_Negotiate(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ENABLE", "QRESYNC", "MOVE", "idle"})
+
+	type result struct {
+		caps *Capabilities
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		caps, err := c.Negotiate("QRESYNC", imap.UTF8Accept)
+		done <- result{caps, err}
+	}()
+
+	// UTF8=ACCEPT isn't supported by the server
+	tag, cmd := s.ScanCmd()
+	if cmd != "ENABLE QRESYNC" {
+		t.Fatalf("client sent command %v, want %v", cmd, "ENABLE QRESYNC")
+	}
+	s.WriteString("* ENABLED QRESYNC\r\n")
+	s.WriteString(tag + " OK ENABLE completed\r\n")
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("c.Negotiate() = %v", res.err)
+	}
+
+	caps := res.caps
+	if !caps.IsEnabled("qresync") {
+		t.Error("QRESYNC hasn't been enabled")
+	}
+	if caps.IsEnabled(imap.UTF8Accept) || caps.SupportsUTF8Accept() {
+		t.Error("UTF8=ACCEPT is unexpectedly supported")
+	}
+	if !caps.SupportsMove() || !caps.Has("IDLE") || !caps.SupportsCondStore() {
+		t.Errorf("Invalid capabilities: %v", caps.Caps)
+	}
+	if caps.SupportsUidPlus() {
+		t.Error("UIDPLUS is unexpectedly supported")
+	}
+
+	// Enabled extensions aren't enabled again
+	go func() {
+		caps, err := c.Negotiate("QRESYNC")
+		done <- result{caps, err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatalf("c.Negotiate() = %v", res.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("c.Negotiate() sent a command")
+	}
+}
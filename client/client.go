@@ -2,12 +2,14 @@
 package client
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,17 +24,26 @@ var errClosed = fmt.Errorf("imap: connection closed")
 // errUnregisterHandler is returned by a response handler to unregister itself.
 var errUnregisterHandler = fmt.Errorf("imap: unregister handler")
 
+// errNotEnoughFields is returned when a unilateral response is missing fields.
+var errNotEnoughFields = fmt.Errorf("imap: not enough fields in response")
+
 // StatusUpdate is delivered when a status update is received.
 type StatusUpdate struct {
 	Status *imap.StatusResp
 }
 
-// MailboxUpdate is delivered when a mailbox status changes.
+// MailboxUpdate is delivered when a mailbox status changes. Mailbox is the
+// selected mailbox, except for notifications about other mailboxes requested
+// with Notify: in this case Mailbox has the name of the originating mailbox and
+// only contains the items sent by the server.
 type MailboxUpdate struct {
 	Mailbox *imap.MailboxStatus
 }
 
-// ExpungeUpdate is delivered when a message is deleted.
+// ExpungeUpdate is delivered when a message is deleted. Sequence numbers of
+// messages after the deleted one are decremented, so expunge updates must be
+// processed in the order they are received. See imap.ApplyExpunge and
+// imap.SeqNumTracker.
 type ExpungeUpdate struct {
 	SeqNum uint32
 }
@@ -42,10 +53,120 @@ type MessageUpdate struct {
 	Message *imap.Message
 }
 
+// VanishedUpdate is delivered instead of ExpungeUpdate when QRESYNC is enabled.
+// Uids contains the UIDs of the deleted messages. If Earlier is true, the
+// messages have been deleted before the mailbox was selected and the number of
+// messages in the mailbox is unchanged.
+type VanishedUpdate struct {
+	Uids    *imap.SeqSet
+	Earlier bool
+}
+
+// MailboxNameUpdate is delivered when a mailbox is created, deleted or renamed,
+// if these events have been requested with Notify. A deleted mailbox has the
+// \NonExistent attribute. The previous name of a renamed mailbox is in the
+// OLDNAME extended data item.
+type MailboxNameUpdate struct {
+	Mailbox *imap.MailboxInfo
+}
+
+// SearchUpdate is delivered when a search result kept updated with
+// SearchContext changes. Tag is the tag of the search command, Result contains
+// the changes in its RemoveFrom and AddTo fields, which must be applied in
+// this order.
+type SearchUpdate struct {
+	Tag    string
+	Uid    bool
+	Result *imap.SearchResult
+}
+
 // Client is an IMAP client.
+//
+// A Client is safe to use from multiple goroutines. Commands are sent one at a
+// time: a command is only sent once the previous one has completed, and
+// concurrent commands are sent in the order the corresponding methods have
+// been called. A command holds the queue until its completion, including the
+// time spent delivering its responses. Thus Idle blocks other commands until
+// it is stopped, and a command returning messages on a channel, such as
+// Fetch, blocks other commands until the channel has been drained.
+//
+// Commands can be cancelled with a context, see WithContext.
 type Client struct {
+	*session
+
+	ctx context.Context
+
+	// A channel to which unilateral updates from the server will be sent. An
+	// update can be one of: *StatusUpdate, *MailboxUpdate, *MessageUpdate,
+	// *ExpungeUpdate, *VanishedUpdate, *MailboxNameUpdate, *SearchUpdate.
+	// Note that blocking this channel blocks the whole client, so it's
+	// recommended to use a separate goroutine and a buffered channel to
+	// prevent deadlocks, or to set UpdatePolicy.
+	//
+	// Responses are read continuously in a background goroutine, so updates
+	// are delivered as soon as the server sends them, even if no command is
+	// in progress. This includes alerts (untagged OK responses with an ALERT
+	// code), which are delivered as *StatusUpdate.
+	Updates chan<- interface{}
+
+	// UpdatePolicy specifies how updates are delivered to Updates when they
+	// aren't received immediately. The default, UpdateBlock, blocks the
+	// client until they are. Updates queued before the policy is changed are
+	// delivered before the next ones.
+	UpdatePolicy UpdatePolicy
+
+	// ErrorLog specifies an optional logger for errors accepting connections and
+	// unexpected behavior from handlers. By default, logging goes to os.Stderr
+	// via the log package's standard logger. The logger must be safe to use
+	// simultaneously from multiple goroutines.
+	ErrorLog imap.Logger
+
+	// Timeout specifies a maximum amount of time to wait on a command.
+	//
+	// A Timeout of zero means no timeout. This is the default.
+	Timeout time.Duration
+
+	// CommandTimeouts specifies timeouts for some commands, overriding
+	// Timeout. Keys are upper-case command names, e.g. "NOOP" or "FETCH". UID
+	// commands use the timeout of the command they wrap, unless a timeout is
+	// set for the full name, e.g. "UID FETCH". A zero duration means no
+	// timeout.
+	//
+	// Unlike Timeout, these timeouts limit the time the command can stay
+	// without any data being sent or received: the deadlines of the
+	// connection are extended every time data is transferred, so a command
+	// streaming large literals doesn't time out as long as data keeps
+	// flowing. Once the command has completed, the idle timeout set with
+	// SetIdleTimeout applies again.
+	CommandTimeouts map[string]time.Duration
+
+	// RetryPolicy specifies how idempotent commands failing because of a
+	// transient server condition are retried. If nil, commands are never
+	// retried. This is the default.
+	RetryPolicy *RetryPolicy
+
+	// CheckAppendLimit, if true, makes the client reject messages larger than
+	// the APPENDLIMIT advertised by the server before sending them, which
+	// saves a failed round trip. By default, the server rejects them.
+	CheckAppendLimit bool
+}
+
+// session is the connection state, shared by a Client and the clients
+// returned by its WithContext method.
+type session struct {
 	conn  *imap.Conn
 	isTLS bool
+	// The TLS connection, if known.
+	tlsConn *tls.Conn
+
+	// Serializes commands.
+	queue cmdQueue
+	// Serializes writes to the connection. Commands are written while holding
+	// the queue, but some data is written by response handlers, such as DONE
+	// for IDLE and AUTHENTICATE responses.
+	writeLocker sync.Mutex
+	// Tells the writer whether the server accepts a literal.
+	continues chan<- bool
 
 	greeted   chan struct{}
 	loggedOut chan struct{}
@@ -59,27 +180,48 @@ type Client struct {
 	mailbox *imap.MailboxStatus
 	// The cached server capabilities.
 	caps map[string]bool
-	// state, mailbox and caps may be accessed in different goroutines. Protect
-	// access.
+	// The capabilities enabled with the ENABLE command.
+	enabled map[string]bool
+	// The per-mailbox append limits returned by STATUS, by mailbox name.
+	appendLimits map[string]uint64
+	// True if the client has sent LOGOUT, in which case a BYE response is
+	// expected.
+	loggingOut bool
+	// The error returned by commands after an unsolicited BYE response.
+	byeErr error
+	// The error which caused the client to close the connection, if any.
+	connErr error
+	// The tagged status response of the last completed command.
+	lastStatus *imap.StatusResp
+	// The idle timeout set with SetIdleTimeout, restored once a command with
+	// a timeout in CommandTimeouts has completed.
+	idleTimeout time.Duration
+	// The body sections writers of the FetchStream command in progress, set
+	// while it holds the command queue.
+	bodyStream *bodyStream
+	// The queue of updates not delivered yet, used by UpdateBuffer and
+	// UpdateCoalesce.
+	updateQueue *updateQueue
+	// state, mailbox, caps, enabled, appendLimits, loggingOut, byeErr,
+	// connErr, lastStatus, idleTimeout, bodyStream and updateQueue may be
+	// accessed in different goroutines. Protect access.
 	locker sync.Mutex
+}
 
-	// A channel to which unilateral updates from the server will be sent. An
-	// update can be one of: *StatusUpdate, *MailboxUpdate, *MessageUpdate,
-	// *ExpungeUpdate. Note that blocking this channel blocks the whole client,
-	// so it's recommended to use a separate goroutine and a buffered channel to
-	// prevent deadlocks.
-	Updates chan<- interface{}
-
-	// ErrorLog specifies an optional logger for errors accepting connections and
-	// unexpected behavior from handlers. By default, logging goes to os.Stderr
-	// via the log package's standard logger. The logger must be safe to use
-	// simultaneously from multiple goroutines.
-	ErrorLog imap.Logger
-
-	// Timeout specifies a maximum amount of time to wait on a command.
-	//
-	// A Timeout of zero means no timeout. This is the default.
-	Timeout time.Duration
+// chainHandlers returns a handler trying each non-nil handler in order until
+// one of them handles the response.
+func chainHandlers(hs ...responses.Handler) responses.Handler {
+	return responses.HandlerFunc(func(resp imap.Resp) error {
+		for _, h := range hs {
+			if h == nil {
+				continue
+			}
+			if err := h.Handle(resp); err != responses.ErrUnhandled {
+				return err
+			}
+		}
+		return responses.ErrUnhandled
+	})
 }
 
 func (c *Client) registerHandler(h responses.Handler) {
@@ -92,6 +234,20 @@ func (c *Client) registerHandler(h responses.Handler) {
 	c.handlersLocker.Unlock()
 }
 
+// unregisterHandler removes a handler registered with registerHandler. h must
+// be comparable.
+func (c *Client) unregisterHandler(h responses.Handler) {
+	c.handlersLocker.Lock()
+	defer c.handlersLocker.Unlock()
+
+	for i, registered := range c.handlers {
+		if registered == h {
+			c.handlers = append(c.handlers[:i], c.handlers[i+1:]...)
+			return
+		}
+	}
+}
+
 func (c *Client) handle(resp imap.Resp) error {
 	c.handlersLocker.Lock()
 	for i := len(c.handlers) - 1; i >= 0; i-- {
@@ -144,11 +300,35 @@ func (c *Client) read(greeted <-chan struct{}) error {
 			return nil
 		} else if err != nil {
 			c.ErrorLog.Println("error reading response:", err)
-			if imap.IsParseError(err) {
-				continue
-			} else {
+			if !imap.IsParseError(err) {
+				// Report the error to pending and future commands, e.g. a
+				// timeout
+				c.locker.Lock()
+				if c.connErr == nil {
+					c.connErr = err
+				}
+				c.locker.Unlock()
 				return err
 			}
+
+			// Skip the rest of the invalid response, including the contents of
+			// a literal which couldn't be read, so that they aren't parsed as
+			// responses
+			if err := c.conn.DiscardLiteral(); err != nil {
+				c.ErrorLog.Println("cannot discard literal:", err)
+
+				c.locker.Lock()
+				c.state = imap.LogoutState
+				c.mailbox = nil
+				c.connErr = err
+				c.locker.Unlock()
+
+				c.conn.Close()
+				return err
+			}
+			// If this fails, the next read fails as well
+			c.conn.DiscardLine()
+			continue
 		}
 
 		if err := c.handle(resp); err == responses.ErrUnhandled {
@@ -164,11 +344,58 @@ type handleResult struct {
 	err    error
 }
 
+// closedErr returns the error to use when the connection has been closed.
+func (c *Client) closedErr() error {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if c.byeErr != nil {
+		return c.byeErr
+	}
+	if c.connErr != nil {
+		return c.connErr
+	}
+	return errClosed
+}
+
 func (c *Client) execute(cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error) {
+	ctx := c.Context()
+	if !c.queue.acquire(ctx.Done()) {
+		return nil, ctx.Err()
+	}
+	defer c.queue.release()
+
+	return c.executeLocked(cmdr, h)
+}
+
+// executeLocked is like execute, but must be called while holding the command
+// queue.
+func (c *Client) executeLocked(cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error) {
+	// Don't try to send commands on a closed connection
+	if c.State() == imap.LogoutState {
+		return nil, c.closedErr()
+	}
+	ctx := c.Context()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	cmd := cmdr.Command()
 	cmd.Tag = generateTag()
 
-	if c.Timeout > 0 {
+	if d, ok := c.commandTimeout(cmd); ok {
+		if err := c.conn.SetDeadline(time.Time{}); err != nil {
+			return nil, err
+		}
+		if err := c.conn.SetIdleTimeout(d); err != nil {
+			return nil, err
+		}
+		defer func() {
+			c.locker.Lock()
+			d := c.idleTimeout
+			c.locker.Unlock()
+			c.conn.SetIdleTimeout(d)
+		}()
+	} else if c.Timeout > 0 {
 		err := c.conn.SetDeadline(time.Now().Add(c.Timeout))
 		if err != nil {
 			return nil, err
@@ -181,6 +408,19 @@ func (c *Client) execute(cmdr imap.Commander, h responses.Handler) (*imap.Status
 		}
 	}
 
+	// Only the responses of this command are streamed
+	if sh, ok := h.(*streamHandler); ok {
+		c.locker.Lock()
+		c.bodyStream = sh.stream
+		c.locker.Unlock()
+
+		defer func() {
+			c.locker.Lock()
+			c.bodyStream = nil
+			c.locker.Unlock()
+		}()
+	}
+
 	// Add handler before sending command, to be sure to get the response in time
 	// (in tests, the response is sent right after our command is received, so
 	// sometimes the response was received before the setup of this handler)
@@ -216,9 +456,12 @@ func (c *Client) execute(cmdr imap.Commander, h responses.Handler) (*imap.Status
 	// Send the command to the server
 	doneWrite := make(chan error, 1)
 	go func() {
-		doneWrite <- cmd.WriteTo(c.conn.Writer)
+		doneWrite <- c.writeLocked(func(w *imap.Writer) error {
+			return cmd.WriteTo(w)
+		})
 	}()
 
+	written := false
 	for {
 		select {
 		case <-c.loggedOut:
@@ -227,19 +470,122 @@ func (c *Client) execute(cmdr imap.Commander, h responses.Handler) (*imap.Status
 			// come. loggedOut is a channel that closes when the reader goroutine
 			// ends.
 			close(unregister)
-			return nil, errClosed
+			return nil, c.closedErr()
+		case <-ctx.Done():
+			// IMAP doesn't allow aborting a command once it has been sent, and
+			// a partially written command can't be completed: close the
+			// connection
+			close(unregister)
+			c.abort()
+			if !written {
+				select {
+				case c.continues <- false:
+					<-doneWrite
+				case <-doneWrite:
+				}
+			}
+			return nil, ctx.Err()
 		case err := <-doneWrite:
+			written = true
 			if err != nil {
 				// Error while sending the command
 				close(unregister)
+				if c.State() == imap.LogoutState {
+					return nil, c.closedErr()
+				}
 				return nil, err
 			}
 		case result := <-doneHandle:
+			if !written {
+				// The server has rejected the command before it has been
+				// entirely sent, for instance instead of accepting a literal:
+				// abort the write
+				select {
+				case c.continues <- false:
+					<-doneWrite
+				case <-doneWrite:
+				}
+			}
+
+			if result.status != nil {
+				c.locker.Lock()
+				c.lastStatus = result.status
+				c.locker.Unlock()
+			}
 			return result.status, result.err
 		}
 	}
 }
 
+// commandTimeout returns the timeout for cmd set in CommandTimeouts, if any.
+func (c *Client) commandTimeout(cmd *imap.Command) (time.Duration, bool) {
+	if c.CommandTimeouts == nil {
+		return 0, false
+	}
+
+	name := commandName(cmd)
+	if d, ok := c.CommandTimeouts[name]; ok {
+		return d, true
+	}
+	if strings.HasPrefix(name, "UID ") {
+		d, ok := c.CommandTimeouts[strings.TrimPrefix(name, "UID ")]
+		return d, ok
+	}
+	return 0, false
+}
+
+// commandName returns the upper-case name of a command. The name of a UID
+// command includes the name of the command it wraps, e.g. "UID FETCH".
+func commandName(cmd *imap.Command) string {
+	name := strings.ToUpper(cmd.Name)
+	if name == "UID" && len(cmd.Arguments) > 0 {
+		if inner, ok := cmd.Arguments[0].(string); ok {
+			name += " " + strings.ToUpper(inner)
+		}
+	}
+	return name
+}
+
+// abort closes the connection, without logging out.
+func (c *Client) abort() {
+	c.locker.Lock()
+	c.state = imap.LogoutState
+	c.mailbox = nil
+	c.locker.Unlock()
+
+	c.conn.Close()
+}
+
+// Context returns the client's context. It is context.Background unless the
+// client has been returned by WithContext.
+func (c *Client) Context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// WithContext returns a shallow copy of c whose commands are bound to ctx. The
+// returned client shares the connection with c, its Updates, UpdatePolicy,
+// ErrorLog, Timeout, CommandTimeouts and RetryPolicy fields are copied from c.
+//
+// If ctx is done before a command has been sent, for instance while the
+// command waits for previous commands to complete, the command fails with
+// ctx.Err() and the connection is left untouched. If ctx is done after the
+// command has been sent, even partially, the connection is closed, since IMAP
+// doesn't allow aborting a command: the command fails with ctx.Err() and the
+// following commands fail as well.
+//
+// Extension clients built on top of the returned client also use ctx.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	if ctx == nil {
+		panic("imap/client: nil context")
+	}
+	c2 := *c
+	c2.ctx = ctx
+	return &c2
+}
+
 // State returns the current connection state.
 func (c *Client) State() imap.ConnState {
 	c.locker.Lock()
@@ -248,6 +594,19 @@ func (c *Client) State() imap.ConnState {
 	return state
 }
 
+// LastStatus returns the tagged status response of the last completed command,
+// whether it succeeded or not. It can be used to read the status code and text
+// sent by the server, e.g. for diagnostics. It returns nil if no command has
+// completed yet.
+//
+// If the client is used from multiple goroutines, the last completed command
+// may have been issued by another goroutine.
+func (c *Client) LastStatus() *imap.StatusResp {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.lastStatus
+}
+
 // Mailbox returns the selected mailbox. It returns nil if there isn't one.
 func (c *Client) Mailbox() *imap.MailboxStatus {
 	// c.Mailbox fields are not supposed to change, so we can return the pointer.
@@ -271,7 +630,8 @@ func (c *Client) SetState(state imap.ConnState, mailbox *imap.MailboxStatus) {
 // Execute executes a generic command. cmdr is a value that can be converted to
 // a raw command and h is a response handler. The function returns when the
 // command has completed or failed, in this case err is nil. A non-nil err value
-// indicates a network error.
+// indicates a network error. Like other commands, it waits for previously
+// issued commands to complete first.
 //
 // This function should not be called directly, it must only be used by
 // libraries implementing extensions of the IMAP protocol.
@@ -279,6 +639,35 @@ func (c *Client) Execute(cmdr imap.Commander, h responses.Handler) (*imap.Status
 	return c.execute(cmdr, h)
 }
 
+// ExecuteUpgrade executes a command and, if the server accepts it, upgrades
+// the connection with upgrader. No other command is sent until the connection
+// has been upgraded. This is used by commands changing the connection layer,
+// such as STARTTLS.
+//
+// This function should not be called directly, it must only be used by
+// libraries implementing extensions of the IMAP protocol.
+func (c *Client) ExecuteUpgrade(cmdr imap.Commander, upgrader imap.ConnUpgrader) (*imap.StatusResp, error) {
+	ctx := c.Context()
+	if !c.queue.acquire(ctx.Done()) {
+		return nil, ctx.Err()
+	}
+	defer c.queue.release()
+
+	var status *imap.StatusResp
+	err := c.Upgrade(func(conn net.Conn) (net.Conn, error) {
+		var err error
+		if status, err = c.executeLocked(cmdr, nil); err != nil {
+			return nil, err
+		} else if status.Type != imap.StatusRespOk {
+			// Keep the connection as is
+			return conn, nil
+		}
+
+		return upgrader(conn)
+	})
+	return status, err
+}
+
 func (c *Client) handleContinuationReqs(continues chan<- bool) {
 	c.registerHandler(responses.HandlerFunc(func(resp imap.Resp) error {
 		if _, ok := resp.(*imap.ContinuationReq); ok {
@@ -296,7 +685,7 @@ func (c *Client) gotStatusCaps(args []interface{}) {
 
 	c.caps = make(map[string]bool)
 	for _, cap := range args {
-		if cap, ok := cap.(string); ok {
+		if cap, err := imap.ParseString(cap); err == nil {
 			c.caps[cap] = true
 		}
 	}
@@ -315,20 +704,19 @@ func (c *Client) handleUnilateral() {
 
 			switch resp.Type {
 			case imap.StatusRespOk, imap.StatusRespNo, imap.StatusRespBad:
-				if c.Updates != nil {
-					c.Updates <- &StatusUpdate{resp}
-				}
+				c.sendUpdate(&StatusUpdate{resp})
 			case imap.StatusRespBye:
 				c.locker.Lock()
 				c.state = imap.LogoutState
 				c.mailbox = nil
+				if !c.loggingOut {
+					c.byeErr = &imap.ByeError{Code: resp.Code, Info: resp.Info}
+				}
 				c.locker.Unlock()
 
 				c.conn.Close()
 
-				if c.Updates != nil {
-					c.Updates <- &StatusUpdate{resp}
-				}
+				c.sendUpdate(&StatusUpdate{resp})
 			default:
 				return responses.ErrUnhandled
 			}
@@ -342,6 +730,9 @@ func (c *Client) handleUnilateral() {
 			case "CAPABILITY":
 				c.gotStatusCaps(fields)
 			case "EXISTS":
+				if len(fields) < 1 {
+					return errNotEnoughFields
+				}
 				if c.Mailbox() == nil {
 					break
 				}
@@ -356,10 +747,28 @@ func (c *Client) handleUnilateral() {
 					c.mailbox.ItemsLocker.Unlock()
 				}
 
-				if c.Updates != nil {
-					c.Updates <- &MailboxUpdate{c.Mailbox()}
+				c.sendUpdate(&MailboxUpdate{c.Mailbox()})
+			case "FLAGS":
+				// The server can send FLAGS at any time, e.g. when a keyword
+				// has been created
+				if len(fields) < 1 {
+					return errNotEnoughFields
+				}
+				if c.Mailbox() == nil {
+					break
+				}
+
+				if flags := responses.ParseFlagList(fields[0]); flags != nil {
+					c.locker.Lock()
+					c.mailbox.Flags = flags
+					c.locker.Unlock()
 				}
+
+				c.sendUpdate(&MailboxUpdate{c.Mailbox()})
 			case "RECENT":
+				if len(fields) < 1 {
+					return errNotEnoughFields
+				}
 				if c.Mailbox() == nil {
 					break
 				}
@@ -374,17 +783,58 @@ func (c *Client) handleUnilateral() {
 					c.mailbox.ItemsLocker.Unlock()
 				}
 
-				if c.Updates != nil {
-					c.Updates <- &MailboxUpdate{c.Mailbox()}
+				c.sendUpdate(&MailboxUpdate{c.Mailbox()})
+			case "STATUS":
+				// Sent for mailboxes other than the selected one if NOTIFY
+				// is enabled
+				res := &responses.Status{Mailbox: new(imap.MailboxStatus)}
+				if err := res.Handle(resp); err != nil {
+					break
 				}
+
+				c.sendUpdate(&MailboxUpdate{res.Mailbox})
 			case "EXPUNGE":
-				seqNum, _ := imap.ParseNumber(fields[0])
+				if len(fields) < 1 {
+					return errNotEnoughFields
+				}
+				seqNum, err := imap.ParseNumber(fields[0])
+				if err != nil {
+					return err
+				}
+
+				c.sendUpdate(&ExpungeUpdate{seqNum})
+			case "VANISHED":
+				res := new(responses.Vanished)
+				if err := res.Handle(resp); err != nil {
+					break
+				}
+
+				c.sendUpdate(&VanishedUpdate{res.Uids, res.Earlier})
+			case "LIST":
+				// Sent when a mailbox name changes if NOTIFY is enabled
+				info := new(imap.MailboxInfo)
+				if err := info.Parse(fields); err != nil {
+					break
+				}
 
-				if c.Updates != nil {
-					c.Updates <- &ExpungeUpdate{seqNum}
+				c.sendUpdate(&MailboxNameUpdate{info})
+			case "ESEARCH":
+				// Results kept updated are changed with ESEARCH responses,
+				// other ones are returned by the search command
+				res := &responses.ESearch{Updates: true}
+				if err := res.Handle(resp); err != nil {
+					return responses.ErrUnhandled
 				}
+
+				c.sendUpdate(&SearchUpdate{res.Tag, res.Uid, res.Result})
 			case "FETCH":
-				seqNum, _ := imap.ParseNumber(fields[0])
+				if len(fields) < 2 {
+					return errNotEnoughFields
+				}
+				seqNum, err := imap.ParseNumber(fields[0])
+				if err != nil {
+					return err
+				}
 				fields, _ := fields[1].([]interface{})
 
 				msg := &imap.Message{SeqNum: seqNum}
@@ -392,9 +842,7 @@ func (c *Client) handleUnilateral() {
 					break
 				}
 
-				if c.Updates != nil {
-					c.Updates <- &MessageUpdate{msg}
-				}
+				c.sendUpdate(&MessageUpdate{msg})
 			default:
 				return responses.ErrUnhandled
 			}
@@ -422,6 +870,7 @@ func (c *Client) handleGreetAndStartReading() error {
 			c.state = imap.AuthenticatedState
 		case imap.StatusRespBye:
 			c.state = imap.LogoutState
+			c.byeErr = &imap.ByeError{Code: status.Code, Info: status.Info}
 		case imap.StatusRespOk:
 			c.state = imap.NotAuthenticatedState
 		default:
@@ -445,7 +894,18 @@ func (c *Client) handleGreetAndStartReading() error {
 	// some messages will be lost.
 	go c.read(greeted)
 
-	return <-done
+	select {
+	case err := <-done:
+		return err
+	case <-c.loggedOut:
+		// The connection has been closed, possibly right after the greeting
+		select {
+		case err := <-done:
+			return err
+		default:
+			return fmt.Errorf("imap: connection closed before greeting")
+		}
+	}
 }
 
 // Upgrade a connection, e.g. wrap an unencrypted connection with an encrypted
@@ -465,11 +925,38 @@ func (c *Client) Writer() *imap.Writer {
 	return c.conn.Writer
 }
 
+// writeLocked calls f with the connection's writer, ensuring no other data is
+// written at the same time.
+func (c *Client) writeLocked(f func(w *imap.Writer) error) error {
+	c.writeLocker.Lock()
+	defer c.writeLocker.Unlock()
+
+	// Use non-synchronizing literals if the server supports them, see RFC 7888
+	c.locker.Lock()
+	c.conn.Writer.LiteralPlus = c.caps["LITERAL+"]
+	c.conn.Writer.LiteralMinus = c.caps["LITERAL-"]
+	// Mailbox names are sent in UTF-8 once UTF8=ACCEPT is enabled, see RFC 6855
+	c.conn.Writer.UTF8 = c.enabled[imap.UTF8Accept]
+	c.locker.Unlock()
+
+	return f(c.conn.Writer)
+}
+
 // IsTLS checks if this client's connection has TLS enabled.
 func (c *Client) IsTLS() bool {
 	return c.isTLS
 }
 
+// TLSConnectionState returns the state of the TLS connection, e.g. to compute
+// its channel binding. ok is false if TLS isn't enabled, or if the client has
+// been created with New from a connection which isn't a *tls.Conn.
+func (c *Client) TLSConnectionState() (state tls.ConnectionState, ok bool) {
+	if c.tlsConn == nil {
+		return tls.ConnectionState{}, false
+	}
+	return c.tlsConn.ConnectionState(), true
+}
+
 // LoggedOut returns a channel which is closed when the connection to the server
 // is closed.
 func (c *Client) LoggedOut() <-chan struct{} {
@@ -482,6 +969,17 @@ func (c *Client) SetDebug(w io.Writer) {
 	c.conn.SetDebug(w)
 }
 
+// SetIdleTimeout sets the maximum amount of time the connection can stay
+// inactive, see imap.Conn.SetIdleTimeout. Unlike Timeout, it doesn't limit the
+// duration of commands transferring a lot of data or waiting for updates, such
+// as Idle, as long as the server keeps sending data.
+func (c *Client) SetIdleTimeout(d time.Duration) error {
+	c.locker.Lock()
+	c.idleTimeout = d
+	c.locker.Unlock()
+	return c.conn.SetIdleTimeout(d)
+}
+
 // New creates a new client from an existing connection.
 func New(conn net.Conn) (*Client, error) {
 	continues := make(chan bool)
@@ -489,11 +987,18 @@ func New(conn net.Conn) (*Client, error) {
 	r := imap.NewReader(nil)
 
 	c := &Client{
-		conn:      imap.NewConn(conn, r, w),
-		greeted:   make(chan struct{}),
-		loggedOut: make(chan struct{}),
-		state:     imap.ConnectingState,
-		ErrorLog:  log.New(os.Stderr, "imap/client: ", log.LstdFlags),
+		session: &session{
+			conn:      imap.NewConn(conn, r, w),
+			continues: continues,
+			greeted:   make(chan struct{}),
+			loggedOut: make(chan struct{}),
+			state:     imap.ConnectingState,
+		},
+		ErrorLog: log.New(os.Stderr, "imap/client: ", log.LstdFlags),
+	}
+	r.StreamLiteral = c.streamLiteral
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		c.tlsConn = tlsConn
 	}
 
 	c.handleContinuationReqs(continues)
@@ -504,75 +1009,181 @@ func New(conn net.Conn) (*Client, error) {
 
 // Dial connects to an IMAP server using an unencrypted connection.
 func Dial(addr string) (c *Client, err error) {
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
-		return
-	}
-
-	c, err = New(conn)
-	return
+	return DialWithOptions(context.Background(), addr, nil)
 }
 
 // DialWithDialer connects to an IMAP server using an unencrypted connection
 // using dialer.Dial.
 //
 // Among other uses, this allows to apply a dial timeout.
+//
+// Deprecated: Use DialWithOptions instead.
 func DialWithDialer(dialer *net.Dialer, address string) (c *Client, err error) {
-	conn, err := dialer.Dial("tcp", address)
-	if err != nil {
-		return nil, err
-	}
-
-	// We don't return to the caller until we try to receive a greeting. As such,
-	// there is no way to set the client's Timeout for that action. As a
-	// workaround, if the dialer has a timeout set, use that for the connection's
-	// deadline.
-	if dialer.Timeout > 0 {
-		err = conn.SetDeadline(time.Now().Add(dialer.Timeout))
-		if err != nil {
-			return
-		}
-	}
-
-	c, err = New(conn)
-	return
+	return DialWithOptions(context.Background(), address, &DialOptions{
+		Dialer:  dialer,
+		Timeout: dialer.Timeout,
+	})
 }
 
-// DialTLS connects to an IMAP server using an encrypted connection.
+// DialTLS connects to an IMAP server using an encrypted connection. A nil
+// tlsConfig is equivalent to the zero configuration.
 func DialTLS(addr string, tlsConfig *tls.Config) (c *Client, err error) {
-	conn, err := tls.Dial("tcp", addr, tlsConfig)
-	if err != nil {
-		return
+	if tlsConfig == nil {
+		tlsConfig = new(tls.Config)
 	}
-
-	c, err = New(conn)
-	c.isTLS = true
-	return
+	return DialWithOptions(context.Background(), addr, &DialOptions{TLSConfig: tlsConfig})
 }
 
 // DialWithDialerTLS connects to an IMAP server using an encrypted connection
 // using dialer.Dial.
 //
 // Among other uses, this allows to apply a dial timeout.
+//
+// Deprecated: Use DialWithOptions instead.
 func DialWithDialerTLS(dialer *net.Dialer, addr string,
 	tlsConfig *tls.Config) (c *Client, err error) {
-	conn, err := tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	if tlsConfig == nil {
+		tlsConfig = new(tls.Config)
+	}
+	return DialWithOptions(context.Background(), addr, &DialOptions{
+		Dialer:    dialer,
+		TLSConfig: tlsConfig,
+		Timeout:   dialer.Timeout,
+	})
+}
+
+// DialOptions contains options for DialWithOptions.
+type DialOptions struct {
+	// Dialer establishes the connection, e.g. a *net.Dialer or a proxy dialer
+	// returned by NewProxyDialer or golang.org/x/net/proxy. If it implements
+	// ContextDialer, DialContext is used. If nil, a net.Dialer is used.
+	Dialer Dialer
+	// TLSConfig enables TLS on top of the connection if not nil, e.g. for
+	// port 993. If its ServerName is empty, the host of the address is used.
+	TLSConfig *tls.Config
+
+	// LocalAddr is the local address to bind the connection to. If nil, it is
+	// chosen by the system.
+	LocalAddr net.Addr
+	// FallbackDelay is how long to wait for an IPv6 connection before racing
+	// an IPv4 one when the host has both kinds of addresses, as described in
+	// RFC 6555 ("Happy Eyeballs"). If zero, a default of 300ms is used. If
+	// negative, the fallback is disabled.
+	//
+	// LocalAddr and FallbackDelay are only used if Dialer is nil or a
+	// *net.Dialer, in which case they override its own settings.
+	FallbackDelay time.Duration
+
+	// Timeout bounds the whole connection phase, including the TLS handshake
+	// and the server greeting. If zero, there is no timeout.
+	Timeout time.Duration
+}
+
+func (opts *DialOptions) contextDialer() ContextDialer {
+	switch dialer := opts.Dialer.(type) {
+	case nil:
+		return &net.Dialer{LocalAddr: opts.LocalAddr, FallbackDelay: opts.FallbackDelay}
+	case *net.Dialer:
+		d := *dialer
+		if opts.LocalAddr != nil {
+			d.LocalAddr = opts.LocalAddr
+		}
+		if opts.FallbackDelay != 0 {
+			d.FallbackDelay = opts.FallbackDelay
+		}
+		return &d
+	case ContextDialer:
+		return dialer
+	default:
+		return contextDialer{dialer}
+	}
+}
+
+// DialWithOptions connects to an IMAP server. If opts is nil, the zero
+// options are used: the connection is unencrypted and has no timeout.
+//
+// ctx bounds the whole connection phase, like with DialContext.
+func DialWithOptions(ctx context.Context, addr string, opts *DialOptions) (*Client, error) {
+	if opts == nil {
+		opts = new(DialOptions)
+	}
+
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	return DialContext(ctx, opts.contextDialer(), addr, opts.TLSConfig)
+}
+
+// ContextDialer establishes connections. It is implemented by *net.Dialer, and
+// can be implemented by proxies and custom transports.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// DialContext connects to an IMAP server with dialer. If tlsConfig is not nil,
+// TLS is used on top of the connection. If dialer is nil, a zero net.Dialer is
+// used.
+//
+// ctx bounds the whole connection phase, including the TLS handshake and the
+// server greeting. It has no effect once DialContext has returned.
+func DialContext(ctx context.Context, dialer ContextDialer, addr string, tlsConfig *tls.Config) (*Client, error) {
+	if dialer == nil {
+		dialer = new(net.Dialer)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	// We don't return to the caller until we try to receive a greeting. As such,
-	// there is no way to set the client's Timeout for that action. As a
-	// workaround, if the dialer has a timeout set, use that for the connection's
-	// deadline.
-	if dialer.Timeout > 0 {
-		err = conn.SetDeadline(time.Now().Add(dialer.Timeout))
-		if err != nil {
-			return
+	// Interrupt the handshake and the greeting when ctx is done
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
 		}
+	}()
+
+	c, err := dialContext(conn, addr, tlsConfig)
+
+	close(stop)
+	if <-interrupted {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func dialContext(conn net.Conn, addr string, tlsConfig *tls.Config) (*Client, error) {
+	if tlsConfig != nil {
+		if tlsConfig.ServerName == "" {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(addr)
+		}
+
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		conn = tlsConn
 	}
 
-	c, err = New(conn)
-	c.isTLS = true
-	return
+	c, err := New(conn)
+	if err != nil {
+		return nil, err
+	}
+	c.isTLS = tlsConfig != nil
+	return c, nil
 }
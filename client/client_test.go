@@ -3,12 +3,19 @@ package client
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/internal"
 )
 
 type cmdScanner struct {
@@ -151,6 +158,22 @@ func TestClient_unilateral(t *testing.T) {
 		t.Errorf("Invalid expunged sequence number: expected %v but got %v", 65535, update.SeqNum)
 	}
 
+	s.WriteString("* VANISHED 405,407,410:425\r\n")
+	if update, ok := (<-updates).(*VanishedUpdate); !ok || update.Earlier || update.Uids.String() != "405,407,410:425" {
+		t.Errorf("Invalid vanished update: got %+v", update)
+	}
+
+	s.WriteString("* LIST (\\NonExistent) \"/\" Archive\r\n")
+	if update, ok := (<-updates).(*MailboxNameUpdate); !ok || update.Mailbox.Name != "Archive" {
+		t.Errorf("Invalid mailbox name update: got %+v", update)
+	}
+
+	// Invalid flags are skipped
+	s.WriteString("* FLAGS (\\Seen (invalid) $Forwarded \\*)\r\n")
+	if update, ok := (<-updates).(*MailboxUpdate); !ok || strings.Join(update.Mailbox.Flags, " ") != "\\Seen $Forwarded \\*" {
+		t.Errorf("Invalid flags: got %v", update.Mailbox.Flags)
+	}
+
 	s.WriteString("* 431 FETCH (FLAGS (\\Seen))\r\n")
 	if update, ok := (<-updates).(*MessageUpdate); !ok || update.Message.SeqNum != 431 {
 		t.Errorf("Invalid expunged sequence number: expected %v but got %v", 431, update.Message.SeqNum)
@@ -171,3 +194,647 @@ func TestClient_unilateral(t *testing.T) {
 		t.Errorf("Invalid error: got %v", update.Status.Info)
 	}
 }
+
+func TestClient_unilateralMissingFields(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+
+	updates := make(chan interface{}, 1)
+	c.Updates = updates
+
+	// Responses with missing fields are ignored
+	s.WriteString("* EXISTS\r\n")
+	s.WriteString("* RECENT\r\n")
+	s.WriteString("* FLAGS\r\n")
+	s.WriteString("* EXPUNGE\r\n")
+	s.WriteString("* 1 FETCH\r\n")
+	s.WriteString("* FETCH\r\n")
+
+	s.WriteString("* 42 EXISTS\r\n")
+	if update, ok := (<-updates).(*MailboxUpdate); !ok || update.Mailbox.Messages != 42 {
+		t.Errorf("Invalid update: got %+v", update)
+	}
+}
+
+func TestClient_unilateralBetweenCommands(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+
+	updates := make(chan interface{}, 1)
+	c.Updates = updates
+
+	// No command is in progress: updates must be delivered right away
+	s.WriteString("* 42 EXISTS\r\n")
+	if update, ok := (<-updates).(*MailboxUpdate); !ok || update.Mailbox.Messages != 42 {
+		t.Errorf("Invalid update: got %v", update)
+	}
+
+	s.WriteString("* OK [ALERT] System shutdown in 10 minutes\r\n")
+	if update, ok := (<-updates).(*StatusUpdate); !ok || update.Status.Code != imap.CodeAlert {
+		t.Errorf("Invalid alert: got %v", update)
+	}
+
+	// The next command must still complete normally
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want NOOP", cmd)
+	}
+	s.WriteString("* 43 EXISTS\r\n")
+	s.WriteString(tag + " OK NOOP completed\r\n")
+
+	if update, ok := (<-updates).(*MailboxUpdate); !ok || update.Mailbox.Messages != 43 {
+		t.Errorf("Invalid update: got %v", update)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("c.Noop() = %v", err)
+	}
+}
+
+func TestClient_literalDiscarded(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+	c.conn.MaxLiteralSize = 16
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want NOOP", cmd)
+	}
+
+	// The literal is too large to be read, its contents must not be parsed
+	literal := "Subject: Hi\r\n\r\n" + tag + " NO Not a response\r\n"
+	s.WriteString("* 1 FETCH (BODY[] {" + strconv.Itoa(len(literal)) + "}\r\n")
+	s.WriteString(literal + ")\r\n")
+	s.WriteString(tag + " OK NOOP completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Noop() = %v", err)
+	}
+
+	// The next command must complete normally
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want NOOP", cmd)
+	}
+	s.WriteString(tag + " OK NOOP completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Noop() = %v", err)
+	}
+}
+
+func TestClient_literalPartiallyRead(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+
+	seqset, _ := imap.ParseSeqSet("1")
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqset, []imap.FetchItem{"BODY[]"}, messages)
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("* 1 FETCH (BODY[] {16}\r\n")
+	s.WriteString("I love potatoes.)\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Fetch() = %v", err)
+	}
+
+	// Stop reading the literal before its end: it has been read from the
+	// connection before being delivered, the next command is unaffected
+	msg := <-messages
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(msg.GetBody("BODY[]"), b); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want NOOP", cmd)
+	}
+	s.WriteString(tag + " OK NOOP completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Noop() = %v", err)
+	}
+}
+
+func TestClient_literalDesync(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Listener.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+	c.conn.MaxLiteralSize = 16
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Noop()
+	}()
+
+	_, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want NOOP", cmd)
+	}
+
+	// The connection is closed before the end of the literal
+	s.WriteString("* 1 FETCH (BODY[] {100}\r\n")
+	s.WriteString("Subject: Hi\r\n")
+	s.Conn.Close()
+
+	if err := <-done; err != imap.ErrLiteralDesync {
+		t.Fatalf("c.Noop() = %v, want %v", err, imap.ErrLiteralDesync)
+	}
+	if err := c.Noop(); err != imap.ErrLiteralDesync {
+		t.Fatalf("c.Noop() = %v, want %v", err, imap.ErrLiteralDesync)
+	}
+}
+
+// pipeDialer is an in-memory dialer. The server side of each connection is
+// sent to conns.
+type pipeDialer struct {
+	addrs []string
+	conns chan net.Conn
+}
+
+func (d *pipeDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.addrs = append(d.addrs, addr)
+	c, s := net.Pipe()
+	d.conns <- s
+	return c, nil
+}
+
+func (d *pipeDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+func TestDialContext(t *testing.T) {
+	dialer := &pipeDialer{conns: make(chan net.Conn, 1)}
+
+	go func() {
+		s := <-dialer.conns
+		io.WriteString(s, "* OK [CAPABILITY IMAP4rev1] Server ready.\r\n")
+	}()
+
+	c, err := DialContext(context.Background(), dialer, "mail.example.org:143", nil)
+	if err != nil {
+		t.Fatalf("DialContext() = %v", err)
+	}
+
+	if len(dialer.addrs) != 1 || dialer.addrs[0] != "mail.example.org:143" {
+		t.Errorf("Invalid dialed addresses: %v", dialer.addrs)
+	}
+	if state := c.State(); state != imap.NotAuthenticatedState {
+		t.Errorf("c.State() = %v, want %v", state, imap.NotAuthenticatedState)
+	}
+	if c.IsTLS() {
+		t.Error("Expected client not to use TLS")
+	}
+}
+
+func TestDialContext_TLS(t *testing.T) {
+	cert, err := tls.X509KeyPair(internal.LocalhostCert, internal.LocalhostKey)
+	if err != nil {
+		t.Fatal("cannot load test certificate:", err)
+	}
+
+	dialer := &pipeDialer{conns: make(chan net.Conn, 1)}
+
+	serverName := make(chan string, 1)
+	go func() {
+		s := tls.Server(<-dialer.conns, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				serverName <- hello.ServerName
+				return nil, nil
+			},
+		})
+		io.WriteString(s, "* OK [CAPABILITY IMAP4rev1] Server ready.\r\n")
+	}()
+
+	c, err := DialContext(context.Background(), dialer, "example.com:993", &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("DialContext() = %v", err)
+	}
+
+	if name := <-serverName; name != "example.com" {
+		t.Errorf("Invalid TLS server name: %v", name)
+	}
+	if !c.IsTLS() {
+		t.Error("Expected client to use TLS")
+	}
+	if ok, err := c.Support("IMAP4rev1"); err != nil || !ok {
+		t.Errorf("c.Support(IMAP4rev1) = %v, %v", ok, err)
+	}
+}
+
+func TestDialContext_Timeout(t *testing.T) {
+	dialer := &pipeDialer{conns: make(chan net.Conn, 1)}
+
+	// The server never sends a greeting
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := DialContext(ctx, dialer, "mail.example.org:143", nil); err != context.DeadlineExceeded {
+		t.Fatalf("DialContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	(<-dialer.conns).Close()
+}
+
+func TestDialWithOptions_Timeout(t *testing.T) {
+	dialer := &pipeDialer{conns: make(chan net.Conn, 1)}
+
+	// The server never sends a greeting
+	opts := &DialOptions{Dialer: dialer, Timeout: 50 * time.Millisecond}
+	if _, err := DialWithOptions(context.Background(), "mail.example.org:143", opts); err != context.DeadlineExceeded {
+		t.Fatalf("DialWithOptions() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	(<-dialer.conns).Close()
+}
+
+func TestDialWithOptions_LocalAddr(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	remoteAddrs := make(chan net.Addr, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		remoteAddrs <- conn.RemoteAddr()
+		io.WriteString(conn, "* OK [CAPABILITY IMAP4rev1] Server ready.\r\n")
+		io.Copy(ioutil.Discard, conn)
+	}()
+
+	localAddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	c, err := DialWithOptions(context.Background(), l.Addr().String(), &DialOptions{
+		Dialer:        &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1)}},
+		LocalAddr:     localAddr,
+		FallbackDelay: -1,
+	})
+	if err != nil {
+		t.Fatalf("DialWithOptions() = %v", err)
+	}
+	defer c.conn.Close()
+
+	addr := (<-remoteAddrs).(*net.TCPAddr)
+	if !addr.IP.Equal(localAddr.IP) {
+		t.Errorf("Connection bound to %v, want %v", addr.IP, localAddr.IP)
+	}
+	if state := c.State(); state != imap.NotAuthenticatedState {
+		t.Errorf("c.State() = %v, want %v", state, imap.NotAuthenticatedState)
+	}
+}
+
+func TestClient_ConcurrentCommands(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, &imap.MailboxStatus{Name: "INBOX", Messages: 100})
+
+	const n = 50
+
+	// Read commands in the background, to detect a command sent before the
+	// previous one has completed
+	cmds := make(chan [2]string, n)
+	go func() {
+		for i := 0; i < n; i++ {
+			tag, cmd := s.ScanCmd()
+			cmds <- [2]string{tag, cmd}
+		}
+	}()
+
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			if i%2 == 0 {
+				errs <- c.Noop()
+				return
+			}
+
+			seqset, _ := imap.ParseSeqSet(strconv.Itoa(i))
+			messages := make(chan *imap.Message, 1)
+			if err := c.Fetch(seqset, []imap.FetchItem{imap.FetchUid}, messages); err != nil {
+				errs <- err
+				return
+			}
+			msg := <-messages
+			if msg == nil || msg.SeqNum != uint32(i) || msg.Uid != uint32(i+1000) {
+				errs <- fmt.Errorf("invalid message for FETCH %v: %v", i, msg)
+				return
+			}
+			errs <- nil
+		}(i)
+	}
+
+	for i := 0; i < n; i++ {
+		cmd := <-cmds
+
+		time.Sleep(time.Millisecond)
+		select {
+		case next := <-cmds:
+			t.Fatalf("client sent %v before %v completed", next[1], cmd[1])
+		default:
+		}
+
+		switch {
+		case cmd[1] == "NOOP":
+		case strings.HasPrefix(cmd[1], "FETCH "):
+			seqNum, err := strconv.Atoi(strings.Fields(cmd[1])[1])
+			if err != nil {
+				t.Fatalf("client sent invalid command %v", cmd[1])
+			}
+			s.WriteString(fmt.Sprintf("* %v FETCH (UID %v)\r\n", seqNum, seqNum+1000))
+		default:
+			t.Fatalf("client sent unexpected command %v", cmd[1])
+		}
+		s.WriteString(cmd[0] + " OK " + strings.Fields(cmd[1])[0] + " completed\r\n")
+	}
+
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestClient_CommandOrder(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	const n = 10
+
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			errs <- c.Create(fmt.Sprintf("mbox%v", i))
+		}(i)
+
+		// Wait for the command to be queued before issuing the next one
+		for {
+			c.queue.locker.Lock()
+			queued := c.queue.busy && len(c.queue.waiting) == i
+			c.queue.locker.Unlock()
+			if queued {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		tag, cmd := s.ScanCmd()
+		if want := fmt.Sprintf("CREATE mbox%v", i); cmd != want {
+			t.Fatalf("client sent command %v, want %v", cmd, want)
+		}
+		s.WriteString(tag + " OK CREATE completed\r\n")
+	}
+
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Error("c.Create() =", err)
+		}
+	}
+}
+
+func TestClient_WithContext(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, &imap.MailboxStatus{Name: "INBOX", Messages: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		seqset, _ := imap.ParseSeqSet("1")
+		messages := make(chan *imap.Message, 1)
+		done <- c.WithContext(ctx).Fetch(seqset, []imap.FetchItem{imap.FetchUid}, messages)
+	}()
+
+	_, cmd := s.ScanCmd()
+	if cmd != "FETCH 1 (UID)" {
+		t.Fatal("Bad command:", cmd)
+	}
+
+	// The server hangs
+	cancel()
+
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("c.Fetch() = %v, want %v", err, context.Canceled)
+	}
+	if state := c.State(); state != imap.LogoutState {
+		t.Errorf("c.State() = %v, want %v", state, imap.LogoutState)
+	}
+	if err := c.Noop(); err == nil {
+		t.Error("c.Noop() succeeded after the connection has been closed")
+	}
+}
+
+func TestClient_WithContext_NotSent(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.WithContext(ctx).Create("foo"); err != context.Canceled {
+		t.Fatalf("c.Create() = %v, want %v", err, context.Canceled)
+	}
+
+	// The connection is still usable
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Create("bar")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "CREATE bar" {
+		t.Fatal("Bad command:", cmd)
+	}
+	s.WriteString(tag + " OK CREATE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatal("c.Create() =", err)
+	}
+}
+
+func TestClient_WithContext_Queued(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	first := make(chan error, 1)
+	go func() {
+		first <- c.Create("foo")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "CREATE foo" {
+		t.Fatal("Bad command:", cmd)
+	}
+
+	// The second command waits for the first one to complete
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.WithContext(ctx).Create("bar"); err != context.DeadlineExceeded {
+		t.Fatalf("c.Create() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	s.WriteString(tag + " OK CREATE completed\r\n")
+	if err := <-first; err != nil {
+		t.Fatal("c.Create() =", err)
+	}
+
+	// The cancelled command has left the queue
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Delete("foo")
+	}()
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "DELETE foo" {
+		t.Fatal("Bad command:", cmd)
+	}
+	s.WriteString(tag + " OK DELETE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatal("c.Delete() =", err)
+	}
+}
+
+func TestClient_WithContext_Literal(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		msg := bytes.NewBufferString("Hello World!")
+		done <- c.WithContext(ctx).Append("INBOX", nil, time.Time{}, msg)
+	}()
+
+	_, cmd := s.ScanCmd()
+	if cmd != "APPEND INBOX {12}" {
+		t.Fatal("Bad command:", cmd)
+	}
+
+	// The server never accepts the literal
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("c.Append() = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("c.Append() is still blocked after cancellation")
+	}
+}
+
+func TestClient_CommandTimeouts(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, &imap.MailboxStatus{Name: "INBOX", Messages: 1})
+
+	c.Timeout = 50 * time.Millisecond
+	c.CommandTimeouts = map[string]time.Duration{"FETCH": 100 * time.Millisecond, "NOOP": 0}
+
+	// NOOP has no timeout
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatal("Bad command:", cmd)
+	}
+	time.Sleep(100 * time.Millisecond)
+	s.WriteString(tag + " OK NOOP completed\r\n")
+	if err := <-done; err != nil {
+		t.Fatal("c.Noop() =", err)
+	}
+
+	// UID FETCH streams a literal slower than Timeout, but faster than the
+	// FETCH idle timeout
+	go func() {
+		seqset, _ := imap.ParseSeqSet("6")
+		messages := make(chan *imap.Message, 1)
+		done <- c.UidFetch(seqset, []imap.FetchItem{imap.FetchRFC822}, messages)
+	}()
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "UID FETCH 6 (RFC822)" {
+		t.Fatal("Bad command:", cmd)
+	}
+	s.WriteString("* 1 FETCH (UID 6 RFC822 {5}\r\n")
+	for i := 0; i < 5; i++ {
+		time.Sleep(30 * time.Millisecond)
+		s.WriteString("a")
+	}
+	s.WriteString(")\r\n")
+	s.WriteString(tag + " OK UID FETCH completed\r\n")
+	if err := <-done; err != nil {
+		t.Fatal("c.UidFetch() =", err)
+	}
+
+	// The server stops responding
+	go func() {
+		seqset, _ := imap.ParseSeqSet("1")
+		messages := make(chan *imap.Message, 1)
+		done <- c.Fetch(seqset, []imap.FetchItem{imap.FetchUid}, messages)
+	}()
+
+	s.ScanCmd()
+	select {
+	case err := <-done:
+		if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+			t.Fatalf("c.Fetch() = %v, want a timeout error", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("c.Fetch() hasn't timed out")
+	}
+}
@@ -2,15 +2,29 @@ package client
 
 import (
 	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
 )
 
 // ErrAlreadyLoggedOut is returned if Logout is called when the client is
 // already logged out.
 var ErrAlreadyLoggedOut = errors.New("Already logged out")
 
+// ErrLogoutConnDropped is returned by Logout if the connection is closed
+// before the server has sent a BYE response.
+var ErrLogoutConnDropped = errors.New("Connection closed during logout without BYE response")
+
+// ErrIDUnsupported is returned by ID if the server doesn't support ID.
+var ErrIDUnsupported = errors.New("ID is not supported by the server")
+
 // Capability requests a listing of capabilities that the server supports.
 // Capabilities are often returned by the server with the greeting or with the
 // STARTTLS and LOGIN responses, so usually explicitly requesting capabilities
@@ -68,15 +82,28 @@ func (c *Client) Noop() error {
 }
 
 // Logout gracefully closes the connection.
+//
+// Many servers close the connection right after sending the BYE response,
+// without sending the tagged response to LOGOUT: this is not considered as an
+// error. If the connection is closed before any BYE response is received,
+// ErrLogoutConnDropped is returned.
 func (c *Client) Logout() error {
 	if c.State() == imap.LogoutState {
 		return ErrAlreadyLoggedOut
 	}
 
+	c.locker.Lock()
+	c.loggingOut = true
+	c.locker.Unlock()
+
 	cmd := new(commands.Logout)
 
 	if status, err := c.execute(cmd, nil); err == errClosed {
-		// Server closed connection, that's what we want anyway
+		// Server closed connection, that's what we want anyway, as long as it
+		// said goodbye: the BYE handler switches to the logout state
+		if c.State() != imap.LogoutState {
+			return ErrLogoutConnDropped
+		}
 		return nil
 	} else if err != nil {
 		return err
@@ -85,3 +112,63 @@ func (c *Client) Logout() error {
 	}
 	return nil
 }
+
+// DefaultID returns the ID parameters sent by ID when they aren't provided by
+// the caller: the name and version of the main module, as recorded in the
+// build information, and the operating system. If the build information is
+// not available, the name of the executable is used instead.
+func DefaultID() map[string]string {
+	id := map[string]string{imap.IDOS: runtime.GOOS}
+
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Path != "" {
+		id[imap.IDName] = path.Base(info.Main.Path)
+		if v := info.Main.Version; v != "" && v != "(devel)" {
+			id[imap.IDVersion] = v
+		}
+	} else if len(os.Args) > 0 {
+		id[imap.IDName] = filepath.Base(os.Args[0])
+	}
+
+	return id
+}
+
+// SupportID checks if the server supports the ID extension.
+func (c *Client) SupportID() (bool, error) {
+	return c.Support("ID")
+}
+
+// ID sends the client identification to the server and returns the server
+// identification, as defined in RFC 2971. The parameters returned by DefaultID
+// are sent along with clientID, which overrides them: set a parameter to an
+// empty string to avoid sending it. Keys are case-insensitive. The returned
+// map is nil if the server didn't send any identification.
+//
+// Some servers refuse other commands until the client has identified itself.
+func (c *Client) ID(clientID map[string]string) (map[string]string, error) {
+	if ok, err := c.SupportID(); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrIDUnsupported
+	}
+
+	id := DefaultID()
+	for k, v := range clientID {
+		k = strings.ToLower(k)
+		if v == "" {
+			delete(id, k)
+		} else {
+			id[k] = v
+		}
+	}
+
+	cmd := &commands.ID{ID: id}
+	res := &responses.ID{}
+
+	status, err := c.execute(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+	return res.ID, nil
+}
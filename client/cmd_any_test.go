@@ -1,6 +1,10 @@
 package client
 
 import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/emersion/go-imap"
@@ -26,7 +30,7 @@ func TestClient_Capability(t *testing.T) {
 	s.WriteString(tag + " OK CAPABILITY completed.\r\n")
 
 	if err := <-done; err != nil {
-		t.Errorf("c.Capability() = ", err)
+		t.Errorf("c.Capability() = %v", err)
 	}
 
 	if !caps["XTEST"] {
@@ -34,6 +38,33 @@ func TestClient_Capability(t *testing.T) {
 	}
 }
 
+func TestClient_Capability_Literal(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	var caps map[string]bool
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		caps, err = c.Capability()
+		done <- err
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("* CAPABILITY IMAP4rev1 {5}\r\nXTEST IDLE\r\n")
+	s.WriteString(tag + " OK CAPABILITY completed.\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Capability() = %v", err)
+	}
+
+	for _, cap := range []string{"IMAP4rev1", "XTEST", "IDLE"} {
+		if !caps[cap] {
+			t.Errorf("%v capability missing", cap)
+		}
+	}
+}
+
 func TestClient_Noop(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
@@ -54,6 +85,49 @@ func TestClient_Noop(t *testing.T) {
 	}
 }
 
+func TestClient_LastStatus(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	if status := c.LastStatus(); status != nil {
+		t.Fatalf("c.LastStatus() = %v, want nil", status)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString(tag + " OK [X-SERVER-HINT 42] NOOP completed in 0.001 secs\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatal("c.Noop() =", err)
+	}
+
+	status := c.LastStatus()
+	if status == nil {
+		t.Fatal("c.LastStatus() = nil")
+	}
+	if status.Tag != tag || status.Type != imap.StatusRespOk || status.Code != "X-SERVER-HINT" || status.Info != "NOOP completed in 0.001 secs" {
+		t.Errorf("Invalid last status: %+v", status)
+	}
+
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, _ = s.ScanCmd()
+	s.WriteString(tag + " NO Not now\r\n")
+
+	if err := <-done; err == nil {
+		t.Fatal("c.Noop() = nil, want an error")
+	}
+	if status := c.LastStatus(); status.Tag != tag || status.Type != imap.StatusRespNo {
+		t.Errorf("Invalid last status: %+v", status)
+	}
+}
+
 func TestClient_Logout(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
@@ -77,4 +151,136 @@ func TestClient_Logout(t *testing.T) {
 	if state := c.State(); state != imap.LogoutState {
 		t.Errorf("c.State() = %v, want %v", state, imap.LogoutState)
 	}
+
+	// The BYE response was expected
+	if err := c.Noop(); err == nil {
+		t.Error("Expected an error when sending a command after logging out")
+	} else if _, ok := err.(*imap.ByeError); ok {
+		t.Errorf("c.Noop() = %v, want an error not caused by an unsolicited BYE", err)
+	}
+}
+
+func TestClient_Logout_CloseAfterBye(t *testing.T) {
+	c, s := newTestClient(t)
+	// The connection is closed by the test
+	defer s.Listener.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Logout()
+	}()
+
+	s.ScanCmd()
+	// The server doesn't send the tagged response
+	s.WriteString("* BYE Client asked to close the connection.\r\n")
+	s.Conn.Close()
+
+	if err := <-done; err != nil {
+		t.Error("c.Logout() =", err)
+	}
+	if state := c.State(); state != imap.LogoutState {
+		t.Errorf("c.State() = %v, want %v", state, imap.LogoutState)
+	}
+}
+
+func TestClient_Logout_Dropped(t *testing.T) {
+	c, s := newTestClient(t)
+	// The connection is closed by the test
+	defer s.Listener.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Logout()
+	}()
+
+	s.ScanCmd()
+	s.Conn.Close()
+
+	if err := <-done; err != ErrLogoutConnDropped {
+		t.Errorf("c.Logout() = %v, want %v", err, ErrLogoutConnDropped)
+	}
+}
+
+func TestClient_ID(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ID"})
+
+	var serverID map[string]string
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		serverID, err = c.ID(map[string]string{
+			"Name":        "mail-app",
+			"version":     "1.0",
+			"os":          "",
+			"vendor":      "Example Inc.",
+			"support-url": "mailto:support@example.org",
+		})
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	want := `ID ("name" "mail-app" "support-url" "mailto:support@example.org" "vendor" "Example Inc." "version" "1.0")`
+	if cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString("* ID (\"name\" \"Dovecot\" \"vendor\" NIL)\r\n")
+	s.WriteString(tag + " OK ID completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.ID() = %v", err)
+	}
+
+	if want := map[string]string{"name": "Dovecot", "vendor": ""}; !reflect.DeepEqual(serverID, want) {
+		t.Errorf("c.ID() = %v, want %v", serverID, want)
+	}
+}
+
+func TestClient_ID_Defaults(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ID"})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.ID(nil)
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	for k, v := range DefaultID() {
+		if pair := strconv.Quote(k) + " " + strconv.Quote(v); !strings.Contains(cmd, pair) {
+			t.Errorf("client sent command %v, want it to contain %v", cmd, pair)
+		}
+	}
+	s.WriteString("* ID NIL\r\n")
+	s.WriteString(tag + " OK ID completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.ID() = %v", err)
+	}
+}
+
+func TestClient_ID_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1"})
+
+	if _, err := c.ID(nil); err != ErrIDUnsupported {
+		t.Errorf("c.ID() = %v, want %v", err, ErrIDUnsupported)
+	}
+}
+
+func TestDefaultID(t *testing.T) {
+	id := DefaultID()
+	if id[imap.IDName] == "" {
+		t.Error("DefaultID() has no name")
+	}
+	if id[imap.IDOS] != runtime.GOOS {
+		t.Errorf("DefaultID() os = %v, want %v", id[imap.IDOS], runtime.GOOS)
+	}
 }
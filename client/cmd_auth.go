@@ -2,6 +2,8 @@ package client
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/emersion/go-imap"
@@ -9,9 +11,65 @@ import (
 	"github.com/emersion/go-imap/responses"
 )
 
-// ErrNotLoggedIn is returned if a function that requires the client to be
-// logged in is called then the client isn't.
-var ErrNotLoggedIn = errors.New("Not logged in")
+var (
+	// ErrNotLoggedIn is returned if a function that requires the client to be
+	// logged in is called then the client isn't.
+	ErrNotLoggedIn = errors.New("Not logged in")
+	// ErrAppendTooBig is returned by Append if Client.CheckAppendLimit is set
+	// and the message is larger than the limit advertised by the server with
+	// the APPENDLIMIT capability. The message is not sent in this case.
+	ErrAppendTooBig = errors.New("Message is larger than the server's APPENDLIMIT")
+	// ErrNotifyUnsupported is returned by Notify if the server doesn't support
+	// NOTIFY.
+	ErrNotifyUnsupported = errors.New("NOTIFY is not supported by the server")
+	// ErrListExtendedUnsupported is returned by ListExtended if the server
+	// doesn't support LIST-EXTENDED.
+	ErrListExtendedUnsupported = errors.New("LIST-EXTENDED is not supported by the server")
+	// ErrRecursiveMatchAlone is returned by ListExtended if the RECURSIVEMATCH
+	// selection option isn't combined with another selection option.
+	ErrRecursiveMatchAlone = errors.New("RECURSIVEMATCH must be combined with another selection option")
+	// ErrListStatusUnsupported is returned by ListStatus if the server doesn't
+	// support LIST-STATUS.
+	ErrListStatusUnsupported = errors.New("LIST-STATUS is not supported by the server")
+	// ErrNoMessageId is returned by AppendIfAbsent if the Message-ID is empty.
+	ErrNoMessageId = errors.New("Message-ID is empty")
+	// ErrMetadataUnsupported is returned by GetMetadata and SetMetadata if the
+	// server doesn't support METADATA.
+	ErrMetadataUnsupported = errors.New("METADATA is not supported by the server")
+	// ErrCatenateUnsupported is returned by AppendMultiple and AppendCatenate
+	// if the server doesn't support CATENATE.
+	ErrCatenateUnsupported = errors.New("CATENATE is not supported by the server")
+	// ErrMultiAppendUnsupported is returned by AppendMultiple if the server
+	// doesn't support MULTIAPPEND.
+	ErrMultiAppendUnsupported = errors.New("MULTIAPPEND is not supported by the server")
+	// ErrQuotaUnsupported is returned by GetQuota, GetQuotaRoot and SetQuota if
+	// the server doesn't support QUOTA.
+	ErrQuotaUnsupported = errors.New("QUOTA is not supported by the server")
+	// ErrQResyncUnsupported is returned if a command requiring the QRESYNC
+	// extension is called and the server doesn't support it.
+	ErrQResyncUnsupported = errors.New("QRESYNC is not supported by the server")
+	// ErrSpecialUseUnsupported is returned by CreateSpecialUse if the server
+	// doesn't support CREATE-SPECIAL-USE.
+	ErrSpecialUseUnsupported = errors.New("CREATE-SPECIAL-USE is not supported by the server")
+	// ErrACLUnsupported is returned by SetACL, DeleteACL, GetACL, ListRights
+	// and MyRights if the server doesn't support ACL.
+	ErrACLUnsupported = errors.New("ACL is not supported by the server")
+	// ErrUTF8NotEnabled is returned by AppendMultiple if a UTF-8 message is
+	// appended before UTF8=ACCEPT has been enabled with Enable.
+	ErrUTF8NotEnabled = errors.New("UTF8=ACCEPT is not enabled")
+	// ErrURLAuthUnsupported is returned by GenURLAuth, URLFetch and ResetKey
+	// if the server doesn't support URLAUTH.
+	ErrURLAuthUnsupported = errors.New("URLAUTH is not supported by the server")
+	// ErrMoveUnsupported is returned by Move and UidMove if the server
+	// supports neither MOVE nor IMAP4rev2.
+	ErrMoveUnsupported = errors.New("MOVE is not supported by the server")
+	// ErrUnauthenticateUnsupported is returned by Unauthenticate if the server
+	// doesn't support UNAUTHENTICATE.
+	ErrUnauthenticateUnsupported = errors.New("UNAUTHENTICATE is not supported by the server")
+	// ErrXListUnsupported is returned by XList if the server doesn't support
+	// XLIST.
+	ErrXListUnsupported = errors.New("XLIST is not supported by the server")
+)
 
 func (c *Client) ensureAuthenticated() error {
 	state := c.State()
@@ -26,16 +84,22 @@ func (c *Client) ensureAuthenticated() error {
 // Even if the readOnly parameter is set to false, the server can decide to open
 // the mailbox in read-only mode.
 func (c *Client) Select(name string, readOnly bool) (*imap.MailboxStatus, error) {
-	if err := c.ensureAuthenticated(); err != nil {
-		return nil, err
-	}
-
-	cmd := &commands.Select{
+	return c.selectMailbox(&commands.Select{
 		Mailbox:  name,
 		ReadOnly: readOnly,
+	}, nil)
+}
+
+// selectMailbox executes a SELECT or EXAMINE command. If h is not nil, it is
+// given a chance to handle responses before the SELECT response handler.
+func (c *Client) selectMailbox(cmd *commands.Select, h responses.Handler) (*imap.MailboxStatus, error) {
+	if err := c.ensureAuthenticated(); err != nil {
+		return nil, err
 	}
 
-	mbox := &imap.MailboxStatus{Name: name, Items: make(map[imap.StatusItem]interface{})}
+	// INBOX is case-insensitive, track the selected mailbox by its canonical
+	// name
+	mbox := &imap.MailboxStatus{Name: imap.CanonicalMailboxName(cmd.Mailbox), Items: make(map[imap.StatusItem]interface{})}
 	res := &responses.Select{
 		Mailbox: mbox,
 	}
@@ -43,7 +107,7 @@ func (c *Client) Select(name string, readOnly bool) (*imap.MailboxStatus, error)
 	c.mailbox = mbox
 	c.locker.Unlock()
 
-	status, err := c.execute(cmd, res)
+	status, err := c.executeRetry(cmd, chainHandlers(h, res))
 	if err != nil {
 		c.locker.Lock()
 		c.mailbox = nil
@@ -58,12 +122,90 @@ func (c *Client) Select(name string, readOnly bool) (*imap.MailboxStatus, error)
 	}
 
 	c.locker.Lock()
-	mbox.ReadOnly = (status.Code == imap.CodeReadOnly)
+	// EXAMINE always opens the mailbox in read-only mode
+	mbox.ReadOnly = cmd.ReadOnly || status.Code == imap.CodeReadOnly
 	c.state = imap.SelectedState
 	c.locker.Unlock()
 	return mbox, nil
 }
 
+// SelectQResync selects a mailbox with the QRESYNC parameter, as defined in RFC
+// 7162 section 3.2.5. params describes the state of the mailbox cached by the
+// client. If QRESYNC hasn't been enabled yet, it is enabled first: this is
+// only allowed in the authenticated state. If the server doesn't support
+// QRESYNC, ErrQResyncUnsupported is returned.
+//
+// If the mailbox UIDVALIDITY is params.UidValidity, the server reports the
+// changes since params.ModSeq: the UIDs of expunged messages are returned, and
+// messages whose flags have changed are delivered on Updates as
+// *MessageUpdate.
+func (c *Client) SelectQResync(name string, readOnly bool, params *imap.QResyncParams) (*imap.MailboxStatus, *imap.SeqSet, error) {
+	if err := c.ensureAuthenticated(); err != nil {
+		return nil, nil, err
+	}
+
+	c.locker.Lock()
+	enabled := c.enabled["QRESYNC"]
+	c.locker.Unlock()
+	if !enabled {
+		if ok, err := c.Support("QRESYNC"); err != nil {
+			return nil, nil, err
+		} else if !ok {
+			return nil, nil, ErrQResyncUnsupported
+		}
+
+		if _, err := c.Enable("QRESYNC"); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	cmd := &commands.Select{
+		Mailbox:  name,
+		ReadOnly: readOnly,
+		QResync:  params,
+	}
+
+	vanished := new(imap.SeqSet)
+	res := &responses.Vanished{}
+	h := responses.HandlerFunc(func(resp imap.Resp) error {
+		if err := res.Handle(resp); err != nil {
+			return err
+		}
+		vanished.AddSet(res.Uids)
+		return nil
+	})
+
+	mbox, err := c.selectMailbox(cmd, h)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mbox, vanished, nil
+}
+
+// SelectAndCheckValidity selects a mailbox and checks that its UIDVALIDITY is
+// expectedValidity. If it isn't, all UIDs cached for this mailbox are invalid
+// and an *imap.UidValidityError is returned together with the mailbox status:
+// the mailbox stays selected.
+func (c *Client) SelectAndCheckValidity(name string, expectedValidity uint32) (*imap.MailboxStatus, error) {
+	mbox, err := c.Select(name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if mbox.UidValidity != expectedValidity {
+		return mbox, &imap.UidValidityError{Old: expectedValidity, New: mbox.UidValidity}
+	}
+	return mbox, nil
+}
+
+// Examine selects a mailbox in read-only mode with the EXAMINE command. The
+// returned status is populated as with Select, and its ReadOnly field is
+// always true. Commands modifying the mailbox, such as Store and Expunge, fail
+// with ErrMailboxReadOnly.
+func (c *Client) Examine(name string) (*imap.MailboxStatus, error) {
+	return c.Select(name, true)
+}
+
 // Create creates a mailbox with the given name.
 func (c *Client) Create(name string) error {
 	if err := c.ensureAuthenticated(); err != nil {
@@ -81,6 +223,32 @@ func (c *Client) Create(name string) error {
 	return status.Err()
 }
 
+// CreateSpecialUse creates a mailbox with the given name and special-use
+// attributes, e.g. imap.SentAttr. It requires the CREATE-SPECIAL-USE extension,
+// defined in RFC 6154.
+func (c *Client) CreateSpecialUse(name string, attrs []string) error {
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+
+	if ok, err := c.Support("CREATE-SPECIAL-USE"); err != nil {
+		return err
+	} else if !ok {
+		return ErrSpecialUseUnsupported
+	}
+
+	cmd := &commands.Create{
+		Mailbox:    name,
+		SpecialUse: attrs,
+	}
+
+	status, err := c.execute(cmd, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
 // Delete permanently removes the mailbox with the given name.
 func (c *Client) Delete(name string) error {
 	if err := c.ensureAuthenticated(); err != nil {
@@ -99,6 +267,14 @@ func (c *Client) Delete(name string) error {
 }
 
 // Rename changes the name of a mailbox.
+//
+// Some servers reset UIDVALIDITY when a mailbox is renamed. If the renamed
+// mailbox is the selected one, it is selected again under its new name after
+// the rename: the selected mailbox returned by Mailbox is replaced with the new
+// status, and a *MailboxUpdate is sent to Updates.
+//
+// Renaming INBOX is permitted and moves all its messages to the new mailbox,
+// leaving an empty INBOX. If INBOX is selected, it stays selected.
 func (c *Client) Rename(existingName, newName string) error {
 	if err := c.ensureAuthenticated(); err != nil {
 		return err
@@ -113,7 +289,36 @@ func (c *Client) Rename(existingName, newName string) error {
 	if err != nil {
 		return err
 	}
-	return status.Err()
+	if err := status.Err(); err != nil {
+		return err
+	}
+
+	mbox := c.Mailbox()
+	if mbox == nil || imap.CanonicalMailboxName(mbox.Name) != imap.CanonicalMailboxName(existingName) {
+		return nil
+	}
+
+	name := newName
+	if imap.CanonicalMailboxName(existingName) == imap.InboxName {
+		name = imap.InboxName
+	}
+	return c.refreshRenamed(mbox, name)
+}
+
+// refreshRenamed re-selects the selected mailbox mbox after it has been renamed
+// to name. STATUS must not be used on the selected mailbox (RFC 3501 section
+// 6.3.10), so the new status is read from the SELECT responses.
+func (c *Client) refreshRenamed(mbox *imap.MailboxStatus, name string) error {
+	renamed, err := c.selectMailbox(&commands.Select{
+		Mailbox:  name,
+		ReadOnly: mbox.ReadOnly,
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	c.sendUpdate(&MailboxUpdate{renamed})
+	return nil
 }
 
 // Subscribe adds the specified mailbox name to the server's set of "active" or
@@ -205,6 +410,200 @@ func (c *Client) Lsub(ref, name string, ch chan *imap.MailboxInfo) error {
 	return status.Err()
 }
 
+// XList is like List, but uses the XLIST command supported by some legacy
+// servers which don't implement RFC 6154. XLIST attributes are converted to
+// special-use attributes, e.g. imap.XListAllMailAttr becomes imap.AllAttr, so
+// that mailboxes can be handled in the same way as with other servers. The
+// INBOX may have a localized name, it has the imap.XListInboxAttr attribute.
+//
+// If the server doesn't support XLIST, ErrXListUnsupported is returned.
+func (c *Client) XList(ref, name string, ch chan *imap.MailboxInfo) error {
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+
+	defer close(ch)
+
+	if ok, err := c.Support("XLIST"); err != nil {
+		return err
+	} else if !ok {
+		return ErrXListUnsupported
+	}
+
+	cmd := &commands.XList{
+		Reference: ref,
+		Mailbox:   name,
+	}
+	res := &responses.XList{Mailboxes: ch}
+
+	status, err := c.execute(cmd, res)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// SupportListExtended checks if the server supports the LIST-EXTENDED
+// extension.
+func (c *Client) SupportListExtended() (bool, error) {
+	return c.Support("LIST-EXTENDED")
+}
+
+// ListSubscribed returns the subscribed mailboxes matching name, like Lsub.
+// LSUB is deprecated by RFC 5258: if the server supports LIST-EXTENDED, LIST
+// with the SUBSCRIBED selection option is used instead.
+//
+// The imap.SubscribedAttr attribute is set on each returned mailbox, whichever
+// command is used. Subscribed mailboxes which don't exist anymore may have the
+// imap.NonExistentAttr (with LIST) or imap.NoSelectAttr (with LSUB)
+// attribute.
+func (c *Client) ListSubscribed(ref, name string, ch chan *imap.MailboxInfo) error {
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+
+	defer close(ch)
+
+	extended, err := c.SupportListExtended()
+	if err != nil {
+		return err
+	}
+
+	cmd := &commands.List{
+		Reference:  ref,
+		Mailbox:    name,
+		Subscribed: !extended,
+	}
+	if extended {
+		cmd.SelectOpts = []string{imap.ListSelectSubscribed}
+	}
+
+	mailboxes := make(chan *imap.MailboxInfo)
+	done := make(chan struct{})
+	go func() {
+		for mbox := range mailboxes {
+			if !hasAttr(mbox.Attributes, imap.SubscribedAttr) {
+				mbox.Attributes = append(mbox.Attributes, imap.SubscribedAttr)
+			}
+			ch <- mbox
+		}
+		close(done)
+	}()
+
+	res := &responses.List{
+		Mailboxes:  mailboxes,
+		Subscribed: !extended,
+	}
+
+	status, err := c.execute(cmd, res)
+	close(mailboxes)
+	<-done
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// ListExtended is like List, but uses the LIST-EXTENDED extension (RFC 5258)
+// to match several patterns at once and to pass selection and return options,
+// such as imap.ListSelectSubscribed or imap.ListReturnChildren. The server must
+// support LIST-EXTENDED, otherwise ErrListExtendedUnsupported is returned.
+//
+// With the imap.ListSelectRecursiveMatch selection option, mailboxes whose
+// children match the other selection options are returned too, with the
+// matched options in ChildInfo.
+func (c *Client) ListExtended(ref string, patterns []string, selectOpts, returnOpts []string, ch chan *imap.MailboxInfo) error {
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+
+	defer close(ch)
+
+	if ok, err := c.SupportListExtended(); err != nil {
+		return err
+	} else if !ok {
+		return ErrListExtendedUnsupported
+	}
+
+	for _, opt := range selectOpts {
+		if strings.EqualFold(opt, imap.ListSelectRecursiveMatch) && len(selectOpts) == 1 {
+			return ErrRecursiveMatchAlone
+		}
+	}
+
+	cmd := &commands.List{
+		Reference:  ref,
+		Patterns:   patterns,
+		SelectOpts: selectOpts,
+		ReturnOpts: returnOpts,
+	}
+	res := &responses.List{Mailboxes: ch}
+
+	status, err := c.execute(cmd, res)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// ListStatus is like List, but also requests the status of each listed
+// mailbox, as defined in RFC 5819. Listed mailboxes are sent to ch and their
+// status to statuses; mailboxes which can't be selected have no status. If the
+// server doesn't support LIST-STATUS, ErrListStatusUnsupported is returned.
+func (c *Client) ListStatus(ref string, patterns []string, items []imap.StatusItem, ch chan *imap.MailboxInfo, statuses chan *imap.MailboxStatus) error {
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+
+	defer close(ch)
+	defer close(statuses)
+
+	if ok, err := c.Support("LIST-STATUS"); err != nil {
+		return err
+	} else if !ok {
+		return ErrListStatusUnsupported
+	}
+
+	if items == nil {
+		items = []imap.StatusItem{}
+	}
+
+	cmd := &commands.List{
+		Reference:    ref,
+		Patterns:     patterns,
+		ReturnStatus: items,
+	}
+	listRes := &responses.List{Mailboxes: ch}
+	h := responses.HandlerFunc(func(resp imap.Resp) error {
+		if err := listRes.Handle(resp); err != responses.ErrUnhandled {
+			return err
+		}
+		statusRes := &responses.Status{}
+		if err := statusRes.Handle(resp); err != nil {
+			return err
+		}
+		statuses <- statusRes.Mailbox
+		return nil
+	})
+
+	status, err := c.execute(cmd, h)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// hasAttr checks if a mailbox attribute is in attrs. Attributes are
+// case-insensitive.
+func hasAttr(attrs []string, attr string) bool {
+	for _, a := range attrs {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
 // Status requests the status of the indicated mailbox. It does not change the
 // currently selected mailbox, nor does it affect the state of any messages in
 // the queried mailbox.
@@ -223,32 +622,690 @@ func (c *Client) Status(name string, items []imap.StatusItem) (*imap.MailboxStat
 		Mailbox: new(imap.MailboxStatus),
 	}
 
-	status, err := c.execute(cmd, res)
+	status, err := c.executeRetry(cmd, res)
 	if err != nil {
 		return nil, err
 	}
-	return res.Mailbox, status.Err()
+	if err := status.Err(); err != nil {
+		return res.Mailbox, err
+	}
+
+	// Remember the mailbox append limit, so that Append can check it
+	if _, ok := res.Mailbox.Items[imap.StatusAppendLimit]; ok {
+		c.locker.Lock()
+		if c.appendLimits == nil {
+			c.appendLimits = make(map[string]uint64)
+		}
+		c.appendLimits[imap.CanonicalMailboxName(name)] = res.Mailbox.AppendLimit
+		c.locker.Unlock()
+	}
+
+	return res.Mailbox, nil
+}
+
+// AppendLimit returns the maximum size of a message accepted by the server, as
+// advertised with the APPENDLIMIT capability (RFC 7889). ok is false if the
+// server hasn't advertised a limit valid for all mailboxes, in which case
+// per-mailbox limits can be requested with the imap.StatusAppendLimit item.
+//
+// AppendLimit only looks at cached capabilities and never requests them.
+func (c *Client) AppendLimit() (limit int64, ok bool) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	for cap := range c.caps {
+		if !strings.HasPrefix(strings.ToUpper(cap), "APPENDLIMIT=") {
+			continue
+		}
+		n, err := strconv.ParseInt(cap[len("APPENDLIMIT="):], 10, 64)
+		if err != nil || n < 0 {
+			continue
+		}
+		return n, true
+	}
+	return 0, false
 }
 
 // Append appends the literal argument as a new message to the end of the
 // specified destination mailbox. This argument SHOULD be in the format of an
 // RFC 2822 message. flags and date are optional arguments and can be set to
 // nil.
+//
+// If Client.CheckAppendLimit is set and the message is larger than the
+// APPENDLIMIT advertised by the server, or returned for mbox by a previous
+// Status call, ErrAppendTooBig is returned without sending the command.
 func (c *Client) Append(mbox string, flags []string, date time.Time, msg imap.Literal) error {
+	return c.AppendMultiple(mbox, []*imap.AppendMessage{{Flags: flags, Date: date, Body: msg}})
+}
+
+// AppendWithUid is like Append, but also returns the UID assigned to the
+// message, as defined in RFC 4315. If the server doesn't support UIDPLUS or
+// didn't return it, a nil AppendUid is returned.
+func (c *Client) AppendWithUid(mbox string, flags []string, date time.Time, msg imap.Literal) (*imap.AppendUid, error) {
+	return c.AppendMultipleWithUid(mbox, []*imap.AppendMessage{{Flags: flags, Date: date, Body: msg}})
+}
+
+// AppendCatenate is like Append, but the server builds the message by
+// concatenating parts, which are either literals or IMAP URLs referencing
+// existing messages, as defined in RFC 4469. If the server doesn't support
+// CATENATE, ErrCatenateUnsupported is returned.
+func (c *Client) AppendCatenate(mbox string, flags []string, date time.Time, parts []*imap.CatenatePart) error {
+	return c.AppendMultiple(mbox, []*imap.AppendMessage{{Flags: flags, Date: date, Catenate: parts}})
+}
+
+// AppendMultiple is like Append, but appends several messages with a single
+// command, as defined in RFC 3502. The server appends either all messages or
+// none of them. If there is more than one message and the server doesn't
+// support MULTIAPPEND, ErrMultiAppendUnsupported is returned. If a message has
+// CATENATE parts and the server doesn't support CATENATE,
+// ErrCatenateUnsupported is returned.
+//
+// ErrAppendTooBig is returned if Client.CheckAppendLimit is set and one of the
+// messages is larger than the APPENDLIMIT. If a message is a UTF-8 message and
+// UTF8=ACCEPT hasn't been enabled, ErrUTF8NotEnabled is returned.
+func (c *Client) AppendMultiple(mbox string, msgs []*imap.AppendMessage) error {
+	_, err := c.AppendMultipleWithUid(mbox, msgs)
+	return err
+}
+
+// AppendMultipleWithUid is like AppendMultiple, but also returns the UIDs
+// assigned to the messages, see AppendWithUid.
+func (c *Client) AppendMultipleWithUid(mbox string, msgs []*imap.AppendMessage) (*imap.AppendUid, error) {
 	if err := c.ensureAuthenticated(); err != nil {
-		return err
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("imap: no message to append")
+	}
+	if len(msgs) > 1 {
+		if ok, err := c.Support("MULTIAPPEND"); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, ErrMultiAppendUnsupported
+		}
+	}
+
+	if err := c.checkAppend(mbox, msgs); err != nil {
+		return nil, err
 	}
 
 	cmd := &commands.Append{
-		Mailbox: mbox,
-		Flags:   flags,
-		Date:    date,
-		Message: msg,
+		Mailbox:    mbox,
+		Flags:      msgs[0].Flags,
+		Date:       msgs[0].Date,
+		Message:    msgs[0].Body,
+		Catenate:   msgs[0].Catenate,
+		UTF8:       msgs[0].UTF8,
+		Additional: msgs[1:],
 	}
 
+	status, err := c.execute(cmd, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := status.Err(); err != nil {
+		return nil, err
+	}
+
+	if status.Code != imap.CodeAppendUid {
+		return nil, nil
+	}
+	data := new(imap.AppendUid)
+	if err := data.Parse(status.Arguments); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// checkAppend checks that msgs can be appended to mbox, without sending any
+// command.
+func (c *Client) checkAppend(mbox string, msgs []*imap.AppendMessage) error {
+	globalLimit, hasGlobalLimit := c.AppendLimit()
+	c.locker.Lock()
+	limit := c.appendLimits[imap.CanonicalMailboxName(mbox)]
+	utf8Enabled := c.enabled[imap.UTF8Accept]
+	c.locker.Unlock()
+	for _, msg := range msgs {
+		if msg.UTF8 && !utf8Enabled {
+			return ErrUTF8NotEnabled
+		}
+		if msg.Catenate != nil {
+			if ok, err := c.Support("CATENATE"); err != nil {
+				return err
+			} else if !ok {
+				return ErrCatenateUnsupported
+			}
+			continue
+		}
+		if !c.CheckAppendLimit {
+			continue
+		}
+		if hasGlobalLimit && int64(msg.Body.Len()) > globalLimit {
+			return ErrAppendTooBig
+		}
+		if limit > 0 && uint64(msg.Body.Len()) > limit {
+			return ErrAppendTooBig
+		}
+	}
+	return nil
+}
+
+// AppendIfAbsent is like Append, but the message is only appended if mbox
+// doesn't already contain a message with the same Message-ID header field. This
+// avoids creating duplicates when mirroring messages. appended is false if a
+// message already exists.
+//
+// Messages are looked up with a UID SEARCH in mbox, which is selected in
+// read-only mode if it isn't the currently selected mailbox. mbox stays
+// selected afterwards.
+func (c *Client) AppendIfAbsent(mbox string, messageId string, flags []string, date time.Time, msg imap.Literal) (appended bool, err error) {
+	if err := c.ensureAuthenticated(); err != nil {
+		return false, err
+	}
+
+	// Searching for an empty string would match all messages
+	messageId = strings.TrimSpace(messageId)
+	if messageId == "" {
+		return false, ErrNoMessageId
+	}
+
+	if cur := c.Mailbox(); cur == nil || cur.Name != imap.CanonicalMailboxName(mbox) {
+		if _, err := c.Select(mbox, true); err != nil {
+			return false, err
+		}
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Header.Add("Message-Id", messageId)
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return false, err
+	} else if len(uids) > 0 {
+		return false, nil
+	}
+
+	if err := c.Append(mbox, flags, date, msg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SupportIdle checks if the server supports the IDLE extension.
+func (c *Client) SupportIdle() (bool, error) {
+	return c.Support("IDLE")
+}
+
+// Idle indicates to the server that the client is ready to receive unsolicited
+// mailbox updates, as defined in RFC 2177. Updates are sent to Updates. Idle
+// blocks until stop is closed and the server has ended the command, no other
+// command can be sent meanwhile. To end IDLE while handling an update, use
+// StartIdle instead.
+//
+// IDLE is restarted every 29 minutes so that the server doesn't log out the
+// client, and whenever the server ends it before stop is closed. If the server
+// doesn't support IDLE, NOOP is sent every minute instead. Use IdleWithOptions
+// to change these intervals.
+func (c *Client) Idle(stop <-chan struct{}) error {
+	return c.IdleWithOptions(stop, nil)
+}
+
+// SupportNotify checks if the server supports the NOTIFY extension.
+func (c *Client) SupportNotify() (bool, error) {
+	return c.Support("NOTIFY")
+}
+
+// Notify requests the server to report events happening in several mailboxes,
+// as defined in RFC 5465. If spec is nil, all notifications are disabled with
+// NOTIFY NONE.
+//
+// Notifications are delivered to Updates. Events in the selected mailbox are
+// reported as usual, while status changes of other mailboxes are delivered as
+// *MailboxUpdate with the name of the originating mailbox. Mailbox name
+// changes are delivered as *MailboxNameUpdate. Unlike Idle, Notify returns
+// right away and notifications keep being delivered while other commands are
+// executed.
+func (c *Client) Notify(spec *imap.NotifySpec) error {
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+
+	if ok, err := c.SupportNotify(); err != nil {
+		return err
+	} else if !ok {
+		return ErrNotifyUnsupported
+	}
+
+	if spec != nil {
+		if err := spec.Validate(); err != nil {
+			return err
+		}
+	}
+
+	cmd := &commands.Notify{Spec: spec}
+
+	status, err := c.execute(cmd, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// SupportMetadata checks if the server supports the METADATA extension. If
+// mailbox is empty, METADATA-SERVER is enough: it only allows server entries.
+func (c *Client) SupportMetadata(mailbox string) (bool, error) {
+	if ok, err := c.Support("METADATA"); err != nil || ok || mailbox != "" {
+		return ok, err
+	}
+	return c.Support("METADATA-SERVER")
+}
+
+// GetMetadata retrieves metadata entries, as defined in RFC 5464 section 4.2.
+// If mailbox is empty, server entries are retrieved. opts can be nil. Entries
+// that don't exist, or that are larger than opts.MaxSize, are omitted. If the
+// server doesn't support METADATA, ErrMetadataUnsupported is returned.
+func (c *Client) GetMetadata(mailbox string, entries []string, opts *imap.MetadataOptions) (map[string]string, error) {
+	if err := c.ensureAuthenticated(); err != nil {
+		return nil, err
+	}
+	if ok, err := c.SupportMetadata(mailbox); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrMetadataUnsupported
+	}
+
+	cmd := &commands.GetMetadata{
+		Mailbox: mailbox,
+		Entries: entries,
+		Options: opts,
+	}
+	res := &responses.Metadata{}
+
+	status, err := c.execute(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(res.Entries))
+	for k, v := range res.Entries {
+		if v != nil {
+			values[k] = *v
+		}
+	}
+	return values, nil
+}
+
+// SetMetadata sets metadata entries, as defined in RFC 5464 section 4.3. If
+// mailbox is empty, server entries are set. Entries with a nil value are
+// removed. If the server doesn't support METADATA, ErrMetadataUnsupported is
+// returned.
+func (c *Client) SetMetadata(mailbox string, entries map[string]*string) error {
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+	if ok, err := c.SupportMetadata(mailbox); err != nil {
+		return err
+	} else if !ok {
+		return ErrMetadataUnsupported
+	}
+
+	cmd := &commands.SetMetadata{
+		Mailbox: mailbox,
+		Entries: entries,
+	}
+
+	status, err := c.execute(cmd, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+func (c *Client) ensureQuota() error {
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+	if ok, err := c.Support("QUOTA"); err != nil {
+		return err
+	} else if !ok {
+		return ErrQuotaUnsupported
+	}
+	return nil
+}
+
+// GetQuota retrieves the status of a quota root, as defined in RFC 9208
+// section 4.2. If the server doesn't support QUOTA, ErrQuotaUnsupported is
+// returned.
+func (c *Client) GetQuota(root string) (*imap.Quota, error) {
+	if err := c.ensureQuota(); err != nil {
+		return nil, err
+	}
+
+	cmd := &commands.GetQuota{Root: root}
+	res := &responses.Quota{}
+
+	status, err := c.execute(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, quota := range res.Quotas {
+		if quota.Root == root {
+			return quota, nil
+		}
+	}
+	return nil, errors.New("imap: server didn't return the requested quota root")
+}
+
+// GetQuotaRoot retrieves the quota roots of a mailbox and their status, as
+// defined in RFC 9208 section 4.3. If the server doesn't support QUOTA,
+// ErrQuotaUnsupported is returned.
+func (c *Client) GetQuotaRoot(mailbox string) ([]*imap.Quota, error) {
+	if err := c.ensureQuota(); err != nil {
+		return nil, err
+	}
+
+	cmd := &commands.GetQuotaRoot{Mailbox: mailbox}
+	rootRes := &responses.QuotaRoot{}
+	quotaRes := &responses.Quota{}
+	h := responses.HandlerFunc(func(resp imap.Resp) error {
+		if err := rootRes.Handle(resp); err != responses.ErrUnhandled {
+			return err
+		}
+		return quotaRes.Handle(resp)
+	})
+
+	status, err := c.execute(cmd, h)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+
+	// Return quotas in the order of the QUOTAROOT response, a root without a
+	// QUOTA response still gets an empty status
+	quotas := make([]*imap.Quota, 0, len(rootRes.Roots))
+	for _, root := range rootRes.Roots {
+		quota := &imap.Quota{Root: root}
+		for _, q := range quotaRes.Quotas {
+			if q.Root == root {
+				quota = q
+				break
+			}
+		}
+		quotas = append(quotas, quota)
+	}
+	return quotas, nil
+}
+
+// SetQuota changes the resource limits of a quota root, as defined in RFC 9208
+// section 4.4. Resources missing from limits are not limited anymore. If the
+// server doesn't support QUOTA, ErrQuotaUnsupported is returned.
+func (c *Client) SetQuota(root string, limits map[string]uint64) error {
+	if err := c.ensureQuota(); err != nil {
+		return err
+	}
+
+	cmd := &commands.SetQuota{Root: root, Limits: limits}
+
 	status, err := c.execute(cmd, nil)
 	if err != nil {
 		return err
 	}
 	return status.Err()
 }
+
+func (c *Client) ensureACL() error {
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+	if ok, err := c.Support("ACL"); err != nil {
+		return err
+	} else if !ok {
+		return ErrACLUnsupported
+	}
+	return nil
+}
+
+// SetACL changes the rights granted to identifier on a mailbox, as defined in
+// RFC 4314 section 3.1. Depending on mode, rights replace, are added to or are
+// removed from the current ones. If the server doesn't support ACL,
+// ErrACLUnsupported is returned.
+func (c *Client) SetACL(mailbox, identifier string, mode imap.ACLMode, rights imap.ACLRights) error {
+	if err := c.ensureACL(); err != nil {
+		return err
+	}
+
+	cmd := &commands.SetACL{
+		Mailbox:    mailbox,
+		Identifier: identifier,
+		Mode:       mode,
+		Rights:     rights,
+	}
+
+	status, err := c.execute(cmd, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// DeleteACL removes identifier from the access control list of a mailbox, as
+// defined in RFC 4314 section 3.2. If the server doesn't support ACL,
+// ErrACLUnsupported is returned.
+func (c *Client) DeleteACL(mailbox, identifier string) error {
+	if err := c.ensureACL(); err != nil {
+		return err
+	}
+
+	cmd := &commands.DeleteACL{Mailbox: mailbox, Identifier: identifier}
+
+	status, err := c.execute(cmd, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// GetACL retrieves the access control list of a mailbox, mapping identifiers to
+// their rights, as defined in RFC 4314 section 3.3. If the server doesn't
+// support ACL, ErrACLUnsupported is returned.
+func (c *Client) GetACL(mailbox string) (map[string]imap.ACLRights, error) {
+	if err := c.ensureACL(); err != nil {
+		return nil, err
+	}
+
+	cmd := &commands.GetACL{Mailbox: mailbox}
+	res := &responses.ACL{}
+
+	status, err := c.execute(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+	return res.Rights, nil
+}
+
+// ListRights retrieves the rights which can be granted to identifier on a
+// mailbox, as defined in RFC 4314 section 3.4. Required rights are always
+// granted, each set of optional rights can be granted independently. If the
+// server doesn't support ACL, ErrACLUnsupported is returned.
+func (c *Client) ListRights(mailbox, identifier string) (required imap.ACLRights, optional []imap.ACLRights, err error) {
+	if err := c.ensureACL(); err != nil {
+		return "", nil, err
+	}
+
+	cmd := &commands.ListRights{Mailbox: mailbox, Identifier: identifier}
+	res := &responses.ListRights{}
+
+	status, err := c.execute(cmd, res)
+	if err != nil {
+		return "", nil, err
+	} else if err := status.Err(); err != nil {
+		return "", nil, err
+	}
+	return res.Required, res.Optional, nil
+}
+
+// MyRights retrieves the rights of the logged in user on a mailbox, as defined
+// in RFC 4314 section 3.5. If the server doesn't support ACL,
+// ErrACLUnsupported is returned.
+func (c *Client) MyRights(mailbox string) (imap.ACLRights, error) {
+	if err := c.ensureACL(); err != nil {
+		return "", err
+	}
+
+	cmd := &commands.MyRights{Mailbox: mailbox}
+	res := &responses.MyRights{}
+
+	status, err := c.execute(cmd, res)
+	if err != nil {
+		return "", err
+	} else if err := status.Err(); err != nil {
+		return "", err
+	}
+	return res.Rights, nil
+}
+
+func (c *Client) ensureURLAuth() error {
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+	if ok, err := c.Support("URLAUTH"); err != nil {
+		return err
+	} else if !ok {
+		return ErrURLAuthUnsupported
+	}
+	return nil
+}
+
+// GenURLAuth authorizes a rump URL with a mechanism, usually
+// imap.URLAuthInternal, and returns the authorized URL, as defined in RFC 4467
+// section 7. The rump URL must end with an ";urlauth=" access identifier, see
+// imap.IsURLAuthRump. If the server doesn't support URLAUTH,
+// ErrURLAuthUnsupported is returned.
+func (c *Client) GenURLAuth(rump, mechanism string) (string, error) {
+	if err := c.ensureURLAuth(); err != nil {
+		return "", err
+	}
+
+	cmd := &commands.GenURLAuth{
+		Requests: []commands.URLAuthRequest{{URL: rump, Mechanism: mechanism}},
+	}
+	res := &responses.GenURLAuth{}
+
+	status, err := c.execute(cmd, res)
+	if err != nil {
+		return "", err
+	} else if err := status.Err(); err != nil {
+		return "", err
+	}
+
+	if len(res.URLs) != 1 {
+		return "", errors.New("imap: server didn't return the authorized URL")
+	}
+	return res.URLs[0], nil
+}
+
+// URLFetch retrieves the data referenced by authorized URLs, as defined in RFC
+// 4467 section 7. Invalid URLs are mapped to nil literals. If the server
+// doesn't support URLAUTH, ErrURLAuthUnsupported is returned.
+func (c *Client) URLFetch(urls ...string) (map[string]imap.Literal, error) {
+	if err := c.ensureURLAuth(); err != nil {
+		return nil, err
+	}
+
+	cmd := &commands.URLFetch{URLs: urls}
+	res := &responses.URLFetch{}
+
+	status, err := c.execute(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+	return res.Data, nil
+}
+
+// ResetKey invalidates the URLs authorized for a mailbox, as defined in RFC
+// 4467 section 7. If mechanisms are provided, only URLs authorized with them
+// are invalidated. If mailbox is empty, the URLs of all mailboxes are
+// invalidated and mechanisms are ignored. If the server doesn't support
+// URLAUTH, ErrURLAuthUnsupported is returned.
+func (c *Client) ResetKey(mailbox string, mechanisms ...string) error {
+	if err := c.ensureURLAuth(); err != nil {
+		return err
+	}
+
+	cmd := &commands.ResetKey{Mailbox: mailbox, Mechanisms: mechanisms}
+
+	status, err := c.execute(cmd, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// Unauthenticate returns the connection to the not authenticated state, as
+// defined in RFC 8437. The selected mailbox and the extensions enabled with
+// Enable are reset, and another user can then log in on the same connection.
+func (c *Client) Unauthenticate() error {
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+	if ok, err := c.Support("UNAUTHENTICATE"); err != nil {
+		return err
+	} else if !ok {
+		return ErrUnauthenticateUnsupported
+	}
+
+	status, err := c.execute(&commands.Unauthenticate{}, nil)
+	if err != nil {
+		return err
+	}
+	if err := status.Err(); err != nil {
+		return err
+	}
+
+	c.locker.Lock()
+	c.state = imap.NotAuthenticatedState
+	c.mailbox = nil
+	c.enabled = nil
+	c.caps = nil // Capabilities change when user is logged out
+	c.locker.Unlock()
+	return nil
+}
+
+// Enable enables server extensions, as defined in RFC 5161. It returns the
+// extensions that have been enabled by the server, which can be a subset of
+// caps. ENABLE is only valid in the authenticated state.
+func (c *Client) Enable(caps ...string) ([]string, error) {
+	if err := c.ensureAuthenticated(); err != nil {
+		return nil, err
+	}
+
+	cmd := &commands.Enable{Caps: caps}
+	res := &responses.Enabled{}
+
+	status, err := c.execute(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+
+	c.locker.Lock()
+	if c.enabled == nil {
+		c.enabled = make(map[string]bool)
+	}
+	for _, cap := range res.Caps {
+		c.enabled[strings.ToUpper(cap)] = true
+	}
+	c.locker.Unlock()
+
+	return res.Caps, nil
+}
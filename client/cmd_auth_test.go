@@ -59,301 +59,2162 @@ func TestClient_Select(t *testing.T) {
 	}
 }
 
+func TestClient_Select_HighestModSeq(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	var mbox *imap.MailboxStatus
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		mbox, err = c.Select("INBOX", false)
+		done <- err
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("* 172 EXISTS\r\n")
+	s.WriteString("* OK [HIGHESTMODSEQ 715194045007] Highest\r\n")
+	s.WriteString(tag + " OK SELECT completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Select() = %v", err)
+	}
+
+	if mbox.HighestModSeq != 715194045007 {
+		t.Errorf("Invalid HIGHESTMODSEQ: got %v, want %v", mbox.HighestModSeq, 715194045007)
+	}
+	if _, ok := mbox.Items[imap.StatusHighestModSeq]; !ok {
+		t.Error("HIGHESTMODSEQ is missing from mailbox items")
+	}
+}
+
+func TestClient_Select_MailboxId(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	var mbox *imap.MailboxStatus
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		mbox, err = c.Select("INBOX", false)
+		done <- err
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("* 172 EXISTS\r\n")
+	s.WriteString("* OK [MAILBOXID (F2212ea87-6097-4256-9d51-71338625)] Ok\r\n")
+	s.WriteString(tag + " OK SELECT completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Select() = %v", err)
+	}
+
+	if mbox.MailboxId != "F2212ea87-6097-4256-9d51-71338625" {
+		t.Errorf("Invalid MAILBOXID: got %v", mbox.MailboxId)
+	}
+	if _, ok := mbox.Items[imap.StatusMailboxId]; !ok {
+		t.Error("MAILBOXID is missing from mailbox items")
+	}
+}
+
+func TestClient_SelectQResync(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "CONDSTORE", "ENABLE", "QRESYNC"})
+
+	updates := make(chan interface{}, 1)
+	c.Updates = updates
+
+	uids, _ := imap.ParseSeqSet("41,43:211,214:541")
+	params := &imap.QResyncParams{
+		UidValidity: 67890007,
+		ModSeq:      20050715194045000,
+		KnownUids:   uids,
+	}
+
+	var mbox *imap.MailboxStatus
+	var vanished *imap.SeqSet
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		mbox, vanished, err = c.SelectQResync("INBOX", false, params)
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "ENABLE QRESYNC" {
+		t.Fatalf("client sent command %v, want ENABLE QRESYNC", cmd)
+	}
+	s.WriteString("* ENABLED QRESYNC\r\n")
+	s.WriteString(tag + " OK ENABLE completed\r\n")
+
+	wantCmd := "SELECT INBOX (QRESYNC (67890007 20050715194045000 41,43:211,214:541))"
+	tag, cmd = s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+	s.WriteString("* 314 EXISTS\r\n")
+	s.WriteString("* OK [UIDVALIDITY 67890007] UIDVALIDITY\r\n")
+	s.WriteString("* OK [HIGHESTMODSEQ 20060115194045000] Highest mod-sequence\r\n")
+	s.WriteString("* VANISHED (EARLIER) 41,43:116,118,120:211\r\n")
+	s.WriteString("* 49 FETCH (UID 117 FLAGS (\\Seen \\Answered) MODSEQ (90060115194045001))\r\n")
+
+	// Skip the EXISTS update
+	var update *MessageUpdate
+	for update == nil {
+		update, _ = (<-updates).(*MessageUpdate)
+	}
+	if update.Message.Uid != 117 || update.Message.ModSeq != 90060115194045001 {
+		t.Errorf("Invalid message update: got %+v", update)
+	}
+
+	s.WriteString(tag + " OK [READ-WRITE] mailbox selected\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.SelectQResync() = %v", err)
+	}
+
+	if mbox.HighestModSeq != 20060115194045000 {
+		t.Errorf("Invalid HIGHESTMODSEQ: got %v", mbox.HighestModSeq)
+	}
+	if vanished.String() != "41,43:116,118,120:211" {
+		t.Errorf("Invalid vanished UIDs: got %v", vanished)
+	}
+}
+
+func TestClient_SelectQResync_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "CONDSTORE"})
+
+	params := &imap.QResyncParams{UidValidity: 67890007, ModSeq: 20050715194045000}
+	if _, _, err := c.SelectQResync("INBOX", false, params); err != ErrQResyncUnsupported {
+		t.Fatalf("c.SelectQResync() = %v, want %v", err, ErrQResyncUnsupported)
+	}
+}
+
+func testClientSelectAndCheckValidity(t *testing.T, expected uint32) (*imap.MailboxStatus, error) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	var mbox *imap.MailboxStatus
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		mbox, err = c.SelectAndCheckValidity("INBOX", expected)
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "SELECT INBOX" {
+		t.Fatalf("client sent command %v, want SELECT INBOX", cmd)
+	}
+
+	s.WriteString("* 172 EXISTS\r\n")
+	s.WriteString("* OK [UIDVALIDITY 3857529045] UIDs valid\r\n")
+	s.WriteString(tag + " OK SELECT completed\r\n")
+
+	err := <-done
+	if c.State() != imap.SelectedState {
+		t.Errorf("client state = %v, want %v", c.State(), imap.SelectedState)
+	}
+	return mbox, err
+}
+
+func TestClient_SelectAndCheckValidity(t *testing.T) {
+	mbox, err := testClientSelectAndCheckValidity(t, 3857529045)
+	if err != nil {
+		t.Fatalf("c.SelectAndCheckValidity() = %v", err)
+	}
+	if mbox.UidValidity != 3857529045 {
+		t.Errorf("mbox.UidValidity = %v, want %v", mbox.UidValidity, 3857529045)
+	}
+}
+
+func TestClient_SelectAndCheckValidity_Mismatch(t *testing.T) {
+	mbox, err := testClientSelectAndCheckValidity(t, 42)
+
+	verr, ok := err.(*imap.UidValidityError)
+	if !ok {
+		t.Fatalf("c.SelectAndCheckValidity() = %v, want an *imap.UidValidityError", err)
+	}
+	if verr.Old != 42 || verr.New != 3857529045 {
+		t.Errorf("c.SelectAndCheckValidity() = %+v, want Old = 42 and New = 3857529045", verr)
+	}
+	if mbox == nil || mbox.Messages != 172 {
+		t.Errorf("c.SelectAndCheckValidity() returned mailbox %v", mbox)
+	}
+}
+
 func TestClient_Select_ReadOnly(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
-	setClientState(c, imap.AuthenticatedState, nil)
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	var mbox *imap.MailboxStatus
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		mbox, err = c.Select("INBOX", true)
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "EXAMINE INBOX" {
+		t.Fatalf("client sent command %v, want EXAMINE INBOX", cmd)
+	}
+
+	s.WriteString(tag + " OK [READ-ONLY] EXAMINE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Select() = %v", err)
+	}
+
+	if !mbox.ReadOnly {
+		t.Errorf("c.Select().ReadOnly = false, want true")
+	}
+}
+
+func TestClient_Select_CaseInsensitiveInbox(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Select("inbox/Sub", false)
+		done <- err
+	}()
+
+	// The name is sent as provided
+	tag, cmd := s.ScanCmd()
+	if cmd != "SELECT inbox/Sub" {
+		t.Fatalf("client sent command %v, want SELECT inbox/Sub", cmd)
+	}
+	s.WriteString("* 3 EXISTS\r\n")
+	s.WriteString(tag + " OK SELECT completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Select() = %v", err)
+	}
+
+	if name := c.Mailbox().Name; name != "INBOX/Sub" {
+		t.Errorf("Invalid selected mailbox name: expected %q but got %q", "INBOX/Sub", name)
+	}
+}
+
+func TestClient_Examine(t *testing.T) {
+	responses := func(s *serverConn, tag, code string) {
+		s.WriteString("* 172 EXISTS\r\n")
+		s.WriteString("* OK [UIDVALIDITY 3857529045] UIDs valid\r\n")
+		s.WriteString("* OK [UIDNEXT 4392] Predicted next UID\r\n")
+		s.WriteString("* FLAGS (\\Answered \\Seen)\r\n")
+		s.WriteString("* OK [PERMANENTFLAGS ()] No permanent flags permitted\r\n")
+		s.WriteString(tag + " OK " + code + "completed\r\n")
+	}
+
+	open := func(examine bool) (*Client, *serverConn, *imap.MailboxStatus) {
+		c, s := newTestClient(t)
+		setClientState(c, imap.AuthenticatedState, nil)
+
+		var mbox *imap.MailboxStatus
+		done := make(chan error, 1)
+		go func() {
+			var err error
+			if examine {
+				mbox, err = c.Examine("INBOX")
+			} else {
+				mbox, err = c.Select("INBOX", false)
+			}
+			done <- err
+		}()
+
+		tag, cmd := s.ScanCmd()
+		if examine {
+			if cmd != "EXAMINE INBOX" {
+				t.Fatalf("client sent command %v, want EXAMINE INBOX", cmd)
+			}
+			// Some servers omit the READ-ONLY code
+			responses(s, tag, "")
+		} else {
+			responses(s, tag, "[READ-WRITE] ")
+		}
+
+		if err := <-done; err != nil {
+			t.Fatalf("Cannot open mailbox: %v", err)
+		}
+		return c, s, mbox
+	}
+
+	_, s, selected := open(false)
+	s.Close()
+	c, s, examined := open(true)
+	defer s.Close()
+
+	if selected.ReadOnly {
+		t.Error("Expected selected mailbox to be read-write")
+	}
+	if !examined.ReadOnly {
+		t.Error("Expected examined mailbox to be read-only")
+	}
+
+	selected.Items, examined.Items = nil, nil
+	selected.ReadOnly = true
+	if !reflect.DeepEqual(selected, examined) {
+		t.Errorf("Examine and Select statuses differ: \n%+v\n%+v", examined, selected)
+	}
+
+	seqset, _ := imap.ParseSeqSet("1")
+	if err := c.Store(seqset, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.SeenFlag}, nil); err != ErrMailboxReadOnly {
+		t.Errorf("c.Store() = %v, want %v", err, ErrMailboxReadOnly)
+	}
+	if err := c.Expunge(nil); err != ErrMailboxReadOnly {
+		t.Errorf("c.Expunge() = %v, want %v", err, ErrMailboxReadOnly)
+	}
+}
+
+func TestClient_Select_Keywords(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	var mbox *imap.MailboxStatus
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		mbox, err = c.Select("INBOX", false)
+		done <- err
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("* FLAGS (\\Seen \\Deleted $Forwarded $MDNSent Junk)\r\n")
+	s.WriteString("* OK [PERMANENTFLAGS (\\Seen \\Deleted $Forwarded $MDNSent Junk \\*)] Limited\r\n")
+	s.WriteString(tag + " OK SELECT completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Select() = %v", err)
+	}
+
+	wantFlags := []string{imap.SeenFlag, imap.DeletedFlag, "$Forwarded", "$MDNSent", "Junk"}
+	if !reflect.DeepEqual(mbox.Flags, wantFlags) {
+		t.Errorf("Invalid flags: got %v, want %v", mbox.Flags, wantFlags)
+	}
+	wantPermanentFlags := append(wantFlags, imap.TryCreateFlag)
+	if !reflect.DeepEqual(mbox.PermanentFlags, wantPermanentFlags) {
+		t.Errorf("Invalid permanent flags: got %v, want %v", mbox.PermanentFlags, wantPermanentFlags)
+	}
+	if !mbox.CanCreateKeywords() {
+		t.Error("Expected keywords to be creatable")
+	}
+
+	// A new keyword has been created
+	updates := make(chan interface{}, 1)
+	c.Updates = updates
+
+	s.WriteString("* FLAGS (\\Seen \\Deleted $Forwarded $MDNSent Junk $Phishing)\r\n")
+
+	if update, ok := (<-updates).(*MailboxUpdate); !ok {
+		t.Fatalf("Invalid update: %v", update)
+	}
+	wantFlags = append(wantFlags, "$Phishing")
+	if flags := c.Mailbox().Flags; !reflect.DeepEqual(flags, wantFlags) {
+		t.Errorf("Invalid flags after update: got %v, want %v", flags, wantFlags)
+	}
+}
+
+func TestClient_Create(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Create("New Mailbox")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "CREATE \"New Mailbox\"" {
+		t.Fatalf("client sent command %v, want %v", cmd, "CREATE \"New Mailbox\"")
+	}
+
+	s.WriteString(tag + " OK CREATE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Create() = %v", err)
+	}
+}
+
+func TestClient_CreateSpecialUse(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "CREATE-SPECIAL-USE"})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.CreateSpecialUse("Sent", []string{imap.SentAttr})
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if want := "CREATE Sent (USE (\\Sent))"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+
+	s.WriteString(tag + " OK CREATE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.CreateSpecialUse() = %v", err)
+	}
+}
+
+func TestClient_CreateSpecialUse_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	if err := c.CreateSpecialUse("Sent", []string{imap.SentAttr}); err != ErrSpecialUseUnsupported {
+		t.Fatalf("c.CreateSpecialUse() = %v, want %v", err, ErrSpecialUseUnsupported)
+	}
+}
+
+func TestClient_Delete(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Delete("Old Mailbox")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "DELETE \"Old Mailbox\"" {
+		t.Fatalf("client sent command %v, want %v", cmd, "DELETE \"Old Mailbox\"")
+	}
+
+	s.WriteString(tag + " OK DELETE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Delete() = %v", err)
+	}
+}
+
+func TestClient_Rename(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Rename("Old Mailbox", "New Mailbox")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "RENAME \"Old Mailbox\" \"New Mailbox\"" {
+		t.Fatalf("client sent command %v, want %v", cmd, "RENAME \"Old Mailbox\" \"New Mailbox\"")
+	}
+
+	s.WriteString(tag + " OK RENAME completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Rename() = %v", err)
+	}
+}
+
+func TestClient_Rename_Selected(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	mbox := imap.NewMailboxStatus("Old Mailbox", nil)
+	mbox.UidValidity = 1
+	setClientState(c, imap.SelectedState, mbox)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Rename("Old Mailbox", "New Mailbox")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "RENAME \"Old Mailbox\" \"New Mailbox\"" {
+		t.Fatalf("client sent command %v, want %v", cmd, "RENAME \"Old Mailbox\" \"New Mailbox\"")
+	}
+	s.WriteString(tag + " OK RENAME completed\r\n")
+
+	// The selected mailbox must not be queried with STATUS
+	tag, cmd = s.ScanCmd()
+	if cmd != "SELECT \"New Mailbox\"" {
+		t.Fatalf("client sent command %v, want %v", cmd, "SELECT \"New Mailbox\"")
+	}
+	s.WriteString("* OK [UIDNEXT 12] Predicted next UID\r\n")
+	s.WriteString("* OK [UIDVALIDITY 2] UIDs valid\r\n")
+	s.WriteString(tag + " OK [READ-WRITE] SELECT completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Rename() = %v", err)
+	}
+
+	mbox = c.Mailbox()
+	if mbox.Name != "New Mailbox" {
+		t.Errorf("Bad selected mailbox name: got %q, want %q", mbox.Name, "New Mailbox")
+	}
+	if mbox.UidValidity != 2 {
+		t.Errorf("Bad UIDVALIDITY: got %v, want %v", mbox.UidValidity, 2)
+	}
+	if mbox.UidNext != 12 {
+		t.Errorf("Bad UIDNEXT: got %v, want %v", mbox.UidNext, 12)
+	}
+}
+
+func TestClient_Rename_Inbox(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	mbox := imap.NewMailboxStatus("INBOX", nil)
+	mbox.Messages = 42
+	mbox.UidValidity = 1
+	setClientState(c, imap.SelectedState, mbox)
+
+	updates := make(chan interface{}, 10)
+	c.Updates = updates
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Rename("inbox", "Old")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "RENAME inbox Old" {
+		t.Fatalf("client sent command %v, want %v", cmd, "RENAME inbox Old")
+	}
+	s.WriteString(tag + " OK RENAME completed\r\n")
+
+	// INBOX has been emptied and stays selected
+	tag, cmd = s.ScanCmd()
+	if cmd != "SELECT INBOX" {
+		t.Fatalf("client sent command %v, want %v", cmd, "SELECT INBOX")
+	}
+	s.WriteString("* 0 EXISTS\r\n")
+	s.WriteString("* OK [UIDNEXT 1] Predicted next UID\r\n")
+	s.WriteString("* OK [UIDVALIDITY 3] UIDs valid\r\n")
+	s.WriteString(tag + " OK [READ-WRITE] SELECT completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Rename() = %v", err)
+	}
+
+	// The last update contains the status of the selected INBOX
+	var update interface{}
+	for len(updates) > 0 {
+		update = <-updates
+	}
+	if update, ok := update.(*MailboxUpdate); !ok || update.Mailbox.Name != "INBOX" || update.Mailbox.UidValidity != 3 {
+		t.Errorf("Invalid update: got %v", update)
+	}
+
+	mbox = c.Mailbox()
+	if mbox.Name != "INBOX" {
+		t.Errorf("Bad selected mailbox name: got %q, want %q", mbox.Name, "INBOX")
+	}
+	if mbox.Messages != 0 {
+		t.Errorf("Bad messages count: got %v, want %v", mbox.Messages, 0)
+	}
+	if mbox.UidValidity != 3 {
+		t.Errorf("Bad UIDVALIDITY: got %v, want %v", mbox.UidValidity, 3)
+	}
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Subscribe("Mailbox")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "SUBSCRIBE Mailbox" {
+		t.Fatalf("client sent command %v, want %v", cmd, "SUBSCRIBE Mailbox")
+	}
+
+	s.WriteString(tag + " OK SUBSCRIBE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Subscribe() = %v", err)
+	}
+}
+
+func TestClient_Unsubscribe(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Unsubscribe("Mailbox")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "UNSUBSCRIBE Mailbox" {
+		t.Fatalf("client sent command %v, want %v", cmd, "UNSUBSCRIBE Mailbox")
+	}
+
+	s.WriteString(tag + " OK UNSUBSCRIBE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Unsubscribe() = %v", err)
+	}
+}
+
+func TestClient_List(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	mailboxes := make(chan *imap.MailboxInfo, 3)
+	go func() {
+		done <- c.List("", "%", mailboxes)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "LIST \"\" %" {
+		t.Fatalf("client sent command %v, want %v", cmd, "LIST \"\" %")
+	}
+
+	s.WriteString("* LIST (flag1) \"/\" INBOX\r\n")
+	s.WriteString("* LIST (flag2 flag3) \"/\" Drafts\r\n")
+	s.WriteString("* LIST () \"/\" Sent\r\n")
+	s.WriteString(tag + " OK LIST completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.List() = %v", err)
+	}
+
+	want := []struct {
+		name       string
+		attributes []string
+	}{
+		{"INBOX", []string{"flag1"}},
+		{"Drafts", []string{"flag2", "flag3"}},
+		{"Sent", []string{}},
+	}
+
+	i := 0
+	for mbox := range mailboxes {
+		if mbox.Name != want[i].name {
+			t.Errorf("Bad mailbox name for %v: %v, want %v", i, mbox.Name, want[i].name)
+		}
+
+		if !reflect.DeepEqual(mbox.Attributes, want[i].attributes) {
+			t.Errorf("Bad mailbox attributes for %v: %v, want %v", i, mbox.Attributes, want[i].attributes)
+		}
+
+		i++
+	}
+}
+
+func TestClient_List_Literal(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	mailboxes := make(chan *imap.MailboxInfo, 2)
+	go func() {
+		done <- c.List("", "%", mailboxes)
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("* LIST (\\HasNoChildren) {1}\r\n/ {12}\r\nSent Message\r\n")
+	s.WriteString("* LIST ({7}\r\n\\Marked) \"/\" Drafts\r\n")
+	s.WriteString(tag + " OK LIST completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.List() = %v", err)
+	}
+
+	want := []imap.MailboxInfo{
+		{Attributes: []string{"\\HasNoChildren"}, Delimiter: "/", Name: "Sent Message"},
+		{Attributes: []string{"\\Marked"}, Delimiter: "/", Name: "Drafts"},
+	}
+	i := 0
+	for mbox := range mailboxes {
+		if !reflect.DeepEqual(*mbox, want[i]) {
+			t.Errorf("Bad mailbox info for %v: %+v, want %+v", i, mbox, want[i])
+		}
+		i++
+	}
+	if i != len(want) {
+		t.Errorf("Got %v mailboxes, want %v", i, len(want))
+	}
+}
+
+func TestClient_ListExtended(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "LIST-EXTENDED"})
+
+	done := make(chan error, 1)
+	mailboxes := make(chan *imap.MailboxInfo, 3)
+	go func() {
+		done <- c.ListExtended("", []string{"INBOX", "Archive/%"},
+			[]string{imap.ListSelectSubscribed, imap.ListSelectRecursiveMatch},
+			[]string{imap.ListReturnChildren}, mailboxes)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if want := "LIST (SUBSCRIBED RECURSIVEMATCH) \"\" (INBOX Archive/%) RETURN (CHILDREN)"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+
+	s.WriteString("* LIST (\\Subscribed \\HasNoChildren) \"/\" INBOX\r\n")
+	s.WriteString("* LIST (\\HasChildren) \"/\" Archive/2017 (\"CHILDINFO\" (\"SUBSCRIBED\"))\r\n")
+	s.WriteString("* LIST (\\Subscribed \\HasNoChildren) \"/\" Archive/2018 (\"X-COLOR\" \"red\")\r\n")
+	s.WriteString(tag + " OK LIST completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.ListExtended() = %v", err)
+	}
+
+	want := []imap.MailboxInfo{
+		{Attributes: []string{imap.SubscribedAttr, imap.HasNoChildrenAttr}, Delimiter: "/", Name: "INBOX"},
+		{Attributes: []string{imap.HasChildrenAttr}, Delimiter: "/", Name: "Archive/2017", ChildInfo: []string{"SUBSCRIBED"}},
+		{
+			Attributes: []string{imap.SubscribedAttr, imap.HasNoChildrenAttr},
+			Delimiter:  "/",
+			Name:       "Archive/2018",
+			Extended:   map[string]interface{}{"X-COLOR": "red"},
+		},
+	}
+	i := 0
+	for mbox := range mailboxes {
+		if !reflect.DeepEqual(*mbox, want[i]) {
+			t.Errorf("Bad mailbox info for %v: %+v, want %+v", i, mbox, want[i])
+		}
+		i++
+	}
+	if i != len(want) {
+		t.Errorf("Got %v mailboxes, want %v", i, len(want))
+	}
+}
+
+func TestClient_ListStatus(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "LIST-EXTENDED", "LIST-STATUS"})
+
+	done := make(chan error, 1)
+	mailboxes := make(chan *imap.MailboxInfo, 2)
+	statuses := make(chan *imap.MailboxStatus, 2)
+	go func() {
+		done <- c.ListStatus("", []string{"*"}, []imap.StatusItem{imap.StatusMessages, imap.StatusUnseen}, mailboxes, statuses)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if want := "LIST \"\" (*) RETURN (STATUS (MESSAGES UNSEEN))"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+
+	s.WriteString("* LIST () \".\" INBOX\r\n")
+	s.WriteString("* STATUS INBOX (MESSAGES 17 UNSEEN 16)\r\n")
+	s.WriteString("* LIST (\\Noselect) \".\" foo\r\n")
+	s.WriteString(tag + " OK LIST completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.ListStatus() = %v", err)
+	}
+
+	var names []string
+	for mbox := range mailboxes {
+		names = append(names, mbox.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"INBOX", "foo"}) {
+		t.Errorf("Bad listed mailboxes: %v", names)
+	}
+
+	n := 0
+	for status := range statuses {
+		if status.Name != "INBOX" || status.Messages != 17 || status.Unseen != 16 {
+			t.Errorf("Bad mailbox status: %+v", status)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Errorf("Got %v mailbox statuses, want 1", n)
+	}
+}
+
+func TestClient_ListStatus_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	err := c.ListStatus("", []string{"*"}, nil, make(chan *imap.MailboxInfo), make(chan *imap.MailboxStatus))
+	if err != ErrListStatusUnsupported {
+		t.Fatalf("c.ListStatus() = %v, want %v", err, ErrListStatusUnsupported)
+	}
+}
+
+func TestClient_ListExtended_Invalid(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "LIST-EXTENDED"})
+	err := c.ListExtended("", []string{"*"}, []string{imap.ListSelectRecursiveMatch}, nil, make(chan *imap.MailboxInfo))
+	if err != ErrRecursiveMatchAlone {
+		t.Errorf("c.ListExtended(RECURSIVEMATCH) = %v, want %v", err, ErrRecursiveMatchAlone)
+	}
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1"})
+	err = c.ListExtended("", []string{"*"}, nil, nil, make(chan *imap.MailboxInfo))
+	if err != ErrListExtendedUnsupported {
+		t.Errorf("c.ListExtended() = %v, want %v", err, ErrListExtendedUnsupported)
+	}
+}
+
+func TestClient_ListSubscribed_Extended(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "LIST-EXTENDED"})
+
+	done := make(chan error, 1)
+	mailboxes := make(chan *imap.MailboxInfo, 2)
+	go func() {
+		done <- c.ListSubscribed("", "*", mailboxes)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if want := "LIST (SUBSCRIBED) \"\" *"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+
+	s.WriteString("* LIST (\\Subscribed) \"/\" INBOX\r\n")
+	s.WriteString("* LIST (\\Subscribed \\NonExistent) \"/\" Old\r\n")
+	s.WriteString(tag + " OK LIST completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.ListSubscribed() = %v", err)
+	}
+
+	want := []imap.MailboxInfo{
+		{Attributes: []string{imap.SubscribedAttr}, Delimiter: "/", Name: "INBOX"},
+		{Attributes: []string{imap.SubscribedAttr, imap.NonExistentAttr}, Delimiter: "/", Name: "Old"},
+	}
+	i := 0
+	for mbox := range mailboxes {
+		if !reflect.DeepEqual(*mbox, want[i]) {
+			t.Errorf("Bad mailbox info for %v: %+v, want %+v", i, mbox, want[i])
+		}
+		i++
+	}
+	if i != len(want) {
+		t.Errorf("Got %v mailboxes, want %v", i, len(want))
+	}
+}
+
+func TestClient_ListSubscribed_Lsub(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1"})
+
+	done := make(chan error, 1)
+	mailboxes := make(chan *imap.MailboxInfo, 1)
+	go func() {
+		done <- c.ListSubscribed("", "*", mailboxes)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if want := "LSUB \"\" *"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+
+	s.WriteString("* LSUB () \"/\" INBOX\r\n")
+	s.WriteString(tag + " OK LSUB completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.ListSubscribed() = %v", err)
+	}
+
+	mbox := <-mailboxes
+	want := imap.MailboxInfo{Attributes: []string{imap.SubscribedAttr}, Delimiter: "/", Name: "INBOX"}
+	if mbox == nil || !reflect.DeepEqual(*mbox, want) {
+		t.Errorf("Bad mailbox info: %+v, want %+v", mbox, want)
+	}
+}
+
+func TestClient_Lsub(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	mailboxes := make(chan *imap.MailboxInfo, 1)
+	go func() {
+		done <- c.Lsub("", "%", mailboxes)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "LSUB \"\" %" {
+		t.Fatalf("client sent command %v, want %v", cmd, "LSUB \"\" %")
+	}
+
+	s.WriteString("* LSUB () \"/\" INBOX\r\n")
+	s.WriteString(tag + " OK LSUB completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Lsub() = %v", err)
+	}
+
+	mbox := <-mailboxes
+	if mbox.Name != "INBOX" {
+		t.Errorf("Bad mailbox name: %v", mbox.Name)
+	}
+	if len(mbox.Attributes) != 0 {
+		t.Errorf("Bad mailbox flags: %v", mbox.Attributes)
+	}
+}
+
+func TestClient_XList(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "XLIST"})
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	mailboxes := make(chan *imap.MailboxInfo, 2)
+	go func() {
+		done <- c.XList("", "*", mailboxes)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "XLIST \"\" *" {
+		t.Fatalf("client sent command %v, want %v", cmd, "XLIST \"\" *")
+	}
+
+	s.WriteString("* XLIST (\\HasNoChildren \\Inbox) \"/\" Inbox\r\n")
+	s.WriteString("* XLIST (\\HasNoChildren \\AllMail) \"/\" \"[Gmail]/All Mail\"\r\n")
+	s.WriteString(tag + " OK XLIST completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.XList() = %v", err)
+	}
+
+	want := map[string][]string{
+		"INBOX":            {imap.HasNoChildrenAttr, imap.XListInboxAttr},
+		"[Gmail]/All Mail": {imap.HasNoChildrenAttr, imap.AllAttr},
+	}
+	got := make(map[string][]string)
+	for mbox := range mailboxes {
+		got[mbox.Name] = mbox.Attributes
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("c.XList() returned %v, want %v", got, want)
+	}
+}
+
+func TestClient_XList_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1"})
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	mailboxes := make(chan *imap.MailboxInfo)
+	if err := c.XList("", "*", mailboxes); err != ErrXListUnsupported {
+		t.Fatalf("c.XList() = %v, want %v", err, ErrXListUnsupported)
+	}
+}
+
+func TestClient_Status(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	var mbox *imap.MailboxStatus
+	go func() {
+		var err error
+		mbox, err = c.Status("INBOX", []imap.StatusItem{imap.StatusMessages, imap.StatusRecent})
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "STATUS INBOX (MESSAGES RECENT)" {
+		t.Fatalf("client sent command %v, want %v", cmd, "STATUS INBOX (MESSAGES RECENT)")
+	}
+
+	s.WriteString("* STATUS INBOX (MESSAGES 42 RECENT 1)\r\n")
+	s.WriteString(tag + " OK STATUS completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Status() = %v", err)
+	}
+
+	if mbox.Messages != 42 {
+		t.Errorf("Bad mailbox messages: %v", mbox.Messages)
+	}
+	if mbox.Recent != 1 {
+		t.Errorf("Bad mailbox recent: %v", mbox.Recent)
+	}
+}
+
+func TestClient_Status_Literal(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	var mbox *imap.MailboxStatus
+	go func() {
+		var err error
+		mbox, err = c.Status("Sent Messages", []imap.StatusItem{imap.StatusMessages, imap.StatusUidNext})
+		done <- err
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("* STATUS {13}\r\nSent Messages ({8}\r\nMESSAGES {2}\r\n42 UIDNEXT 100)\r\n")
+	s.WriteString(tag + " OK STATUS completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Status() = %v", err)
+	}
+
+	if mbox.Name != "Sent Messages" {
+		t.Errorf("Bad mailbox name: %v", mbox.Name)
+	}
+	if mbox.Messages != 42 {
+		t.Errorf("Bad mailbox messages: %v", mbox.Messages)
+	}
+	if mbox.UidNext != 100 {
+		t.Errorf("Bad mailbox uidnext: %v", mbox.UidNext)
+	}
+}
+
+func TestClient_Status_AppendLimit(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	var mbox *imap.MailboxStatus
+	go func() {
+		var err error
+		mbox, err = c.Status("INBOX", []imap.StatusItem{imap.StatusAppendLimit})
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "STATUS INBOX (APPENDLIMIT)" {
+		t.Fatalf("client sent command %v, want %v", cmd, "STATUS INBOX (APPENDLIMIT)")
+	}
+
+	s.WriteString("* STATUS INBOX (APPENDLIMIT 35651584)\r\n")
+	s.WriteString(tag + " OK STATUS completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Status() = %v", err)
+	}
+
+	if mbox.AppendLimit != 35651584 {
+		t.Errorf("Bad mailbox append limit: %v", mbox.AppendLimit)
+	}
+}
+
+func TestClient_AppendLimit(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	if _, ok := c.AppendLimit(); ok {
+		t.Error("Expected no append limit without the APPENDLIMIT capability")
+	}
+
+	// Per-mailbox limits only
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "APPENDLIMIT"})
+	if _, ok := c.AppendLimit(); ok {
+		t.Error("Expected no global append limit with a bare APPENDLIMIT capability")
+	}
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "APPENDLIMIT=35651584"})
+	if limit, ok := c.AppendLimit(); !ok || limit != 35651584 {
+		t.Errorf("c.AppendLimit() = %v, %v, want %v, true", limit, ok, 35651584)
+	}
+}
+
+func TestClient_Append_TooBig(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "APPENDLIMIT=16"})
+	c.CheckAppendLimit = true
+
+	msg := "Hello World!\r\nHello Gophers!\r\n"
+	err := c.Append("INBOX", nil, time.Time{}, bytes.NewBufferString(msg))
+	if err != ErrAppendTooBig {
+		t.Fatalf("c.Append() = %v, want %v", err, ErrAppendTooBig)
+	}
+
+	// The client must not have sent anything, check that the next command is
+	// a NOOP
+	go c.Noop()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want NOOP", cmd)
+	}
+	s.WriteString(tag + " OK NOOP completed\r\n")
+}
+
+func TestClient_Append_TooBigUnchecked(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "APPENDLIMIT=16"})
+
+	// The server rejects the message
+	msg := "Hello World!\r\nHello Gophers!\r\n"
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Append("INBOX", nil, time.Time{}, bytes.NewBufferString(msg))
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if want := "APPEND INBOX {30}"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString(tag + " NO [TOOBIG] Message too big\r\n")
+
+	if err := <-done; err == nil || err == ErrAppendTooBig {
+		t.Fatalf("c.Append() = %v, want the server error", err)
+	}
+}
+
+func TestClient_Append_MailboxTooBig(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "APPENDLIMIT"})
+	c.CheckAppendLimit = true
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Status("INBOX", []imap.StatusItem{imap.StatusAppendLimit})
+		done <- err
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("* STATUS INBOX (APPENDLIMIT 16)\r\n")
+	s.WriteString(tag + " OK STATUS completed\r\n")
+	if err := <-done; err != nil {
+		t.Fatalf("c.Status() = %v", err)
+	}
+
+	msg := "Hello World!\r\nHello Gophers!\r\n"
+	err := c.Append("INBOX", nil, time.Time{}, bytes.NewBufferString(msg))
+	if err != ErrAppendTooBig {
+		t.Fatalf("c.Append() = %v, want %v", err, ErrAppendTooBig)
+	}
+}
+
+func TestClient_Append(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	msg := "Hello World!\r\nHello Gophers!\r\n"
+	date := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	flags := []string{imap.SeenFlag, imap.DraftFlag}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Append("INBOX", flags, date, bytes.NewBufferString(msg))
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "APPEND INBOX (\\Seen \\Draft) \"10-Nov-2009 23:00:00 +0000\" {30}" {
+		t.Fatalf("client sent command %v, want %v", cmd, "APPEND INBOX (\\Seen \\Draft) \"10-Nov-2009 23:00:00 +0000\" {30}")
+	}
+
+	s.WriteString("+ send literal\r\n")
+
+	b := make([]byte, 30)
+	if _, err := io.ReadFull(s, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != msg {
+		t.Fatal("Bad literal:", string(b))
+	}
+
+	s.WriteString(tag + " OK APPEND completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Append() = %v", err)
+	}
+}
+
+func TestClient_AppendWithUid(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	type result struct {
+		data *imap.AppendUid
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := c.AppendWithUid("INBOX", nil, time.Time{}, bytes.NewBufferString("Hello"))
+		done <- result{data, err}
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "APPEND INBOX {5}" {
+		t.Fatalf("client sent command %v, want %v", cmd, "APPEND INBOX {5}")
+	}
+
+	s.WriteString("+ send literal\r\n")
+	if line := s.ScanLine(); line != "Hello" {
+		t.Fatal("Bad literal:", line)
+	}
+
+	s.WriteString(tag + " OK [APPENDUID 38505 3955] APPEND completed\r\n")
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("c.AppendWithUid() = %v", res.err)
+	}
+	if res.data == nil {
+		t.Fatal("Expected APPENDUID data")
+	}
+	if res.data.UidValidity != 38505 || res.data.Uids.String() != "3955" {
+		t.Errorf("Invalid APPENDUID data: %+v", res.data)
+	}
+}
+
+func TestClient_Append_LiteralPlus(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "LITERAL+"})
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Append("INBOX", nil, time.Time{}, bytes.NewBufferString("Hello World"))
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "APPEND INBOX {11+}" {
+		t.Fatalf("client sent command %v, want %v", cmd, "APPEND INBOX {11+}")
+	}
+
+	// The literal is sent without waiting for a continuation request
+	if line := s.ScanLine(); line != "Hello World" {
+		t.Fatalf("Bad literal: %q", line)
+	}
+
+	s.WriteString(tag + " OK APPEND completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Append() = %v", err)
+	}
+}
+
+func TestClient_Append_UTF8(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "LITERAL+", "ENABLE", "UTF8=ACCEPT"})
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	msgs := []*imap.AppendMessage{{Body: bytes.NewBufferString("Subject: ☺"), UTF8: true}}
+	if err := c.AppendMultiple("Entwürfe", msgs); err != ErrUTF8NotEnabled {
+		t.Fatalf("c.AppendMultiple() = %v, want %v", err, ErrUTF8NotEnabled)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Enable(imap.UTF8Accept)
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "ENABLE UTF8=ACCEPT" {
+		t.Fatalf("client sent command %v, want %v", cmd, "ENABLE UTF8=ACCEPT")
+	}
+	s.WriteString("* ENABLED UTF8=ACCEPT\r\n")
+	s.WriteString(tag + " OK ENABLE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Enable() = %v", err)
+	}
+
+	go func() {
+		done <- c.AppendMultiple("Entwürfe", msgs)
+	}()
+
+	tag, cmd = s.ScanCmd()
+	if want := "APPEND \"Entwürfe\" UTF8 (~{12+}"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	if line := s.ScanLine(); line != "Subject: ☺)" {
+		t.Fatalf("Bad literal: %q", line)
+	}
+
+	s.WriteString(tag + " OK APPEND completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.AppendMultiple() = %v", err)
+	}
+}
+
+func TestClient_AppendMultiple(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "MULTIAPPEND"})
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	date := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	msgs := []*imap.AppendMessage{
+		{Flags: []string{imap.SeenFlag}, Date: date, Body: bytes.NewBufferString("Hello World")},
+		{Flags: []string{imap.DraftFlag}, Body: bytes.NewBufferString("Hello")},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.AppendMultiple("INBOX", msgs)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "APPEND INBOX (\\Seen) \"10-Nov-2009 23:00:00 +0000\" {11}" {
+		t.Fatalf("client sent command %v, want %v", cmd, "APPEND INBOX (\\Seen) \"10-Nov-2009 23:00:00 +0000\" {11}")
+	}
+	s.WriteString("+ send literal\r\n")
+
+	b := make([]byte, len("Hello World (\\Draft) {5}\r\n"))
+	if _, err := io.ReadFull(s, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "Hello World (\\Draft) {5}\r\n" {
+		t.Fatalf("Bad literal: %q", string(b))
+	}
+	s.WriteString("+ send literal\r\n")
+
+	b = make([]byte, len("Hello\r\n"))
+	if _, err := io.ReadFull(s, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "Hello\r\n" {
+		t.Fatalf("Bad literal: %q", string(b))
+	}
+
+	s.WriteString(tag + " OK APPEND completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.AppendMultiple() = %v", err)
+	}
+}
+
+func TestClient_AppendMultiple_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	msgs := []*imap.AppendMessage{
+		{Body: bytes.NewBufferString("Hello")},
+		{Body: bytes.NewBufferString("World")},
+	}
+	if err := c.AppendMultiple("INBOX", msgs); err != ErrMultiAppendUnsupported {
+		t.Fatalf("c.AppendMultiple() = %v, want %v", err, ErrMultiAppendUnsupported)
+	}
+}
+
+func TestClient_AppendCatenate(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "CATENATE"})
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	parts := []*imap.CatenatePart{
+		{URL: "/INBOX/;UID=6"},
+		{Text: bytes.NewBufferString("Footer")},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.AppendCatenate("INBOX", nil, time.Time{}, parts)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "APPEND INBOX CATENATE (URL /INBOX/;UID=6 TEXT {6}" {
+		t.Fatalf("client sent command %v, want %v", cmd, "APPEND INBOX CATENATE (URL /INBOX/;UID=6 TEXT {6}")
+	}
+	s.WriteString("+ send literal\r\n")
+
+	b := make([]byte, len("Footer)\r\n"))
+	if _, err := io.ReadFull(s, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "Footer)\r\n" {
+		t.Fatalf("Bad literal: %q", string(b))
+	}
+
+	s.WriteString(tag + " OK APPEND completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.AppendCatenate() = %v", err)
+	}
+}
+
+func TestClient_Append_Rejected(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Append("INBOX", nil, time.Time{}, bytes.NewBufferString("Hello World!\r\n"))
+	}()
+
+	// The server rejects the command instead of asking for the literal
+	tag, _ := s.ScanCmd()
+	s.WriteString(tag + " NO [TRYCREATE] No such mailbox\r\n")
+
+	if err := <-done; err == nil {
+		t.Fatal("c.Append() = nil, want an error")
+	}
+
+	// The connection must still be usable
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want NOOP", cmd)
+	}
+	s.WriteString(tag + " OK NOOP completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Noop() = %v", err)
+	}
+}
+
+func TestClient_AppendIfAbsent_Present(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	var appended bool
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		appended, err = c.AppendIfAbsent("Archive", "<1234@example.org>", nil, time.Time{}, bytes.NewBufferString("Hello World!\r\n"))
+		done <- err
+	}()
+
+	// The mailbox isn't selected yet
+	tag, cmd := s.ScanCmd()
+	if cmd != "EXAMINE Archive" {
+		t.Fatalf("client sent command %v, want EXAMINE Archive", cmd)
+	}
+	s.WriteString("* 2 EXISTS\r\n")
+	s.WriteString(tag + " OK [READ-ONLY] EXAMINE completed\r\n")
+
+	tag, cmd = s.ScanCmd()
+	if want := "UID SEARCH CHARSET UTF-8 HEADER Message-Id <1234@example.org>"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString("* SEARCH 42\r\n")
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.AppendIfAbsent() = %v", err)
+	}
+	if appended {
+		t.Error("c.AppendIfAbsent() appended a message already present")
+	}
+}
+
+func TestClient_AppendIfAbsent_Absent(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("Archive", nil))
+
+	msg := "Hello World!\r\n"
+	var appended bool
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		appended, err = c.AppendIfAbsent("Archive", "<5678 \"x\"@example.org>", nil, time.Time{}, bytes.NewBufferString(msg))
+		done <- err
+	}()
+
+	// The mailbox is already selected, the Message-ID must be quoted
+	tag, cmd := s.ScanCmd()
+	if want := `UID SEARCH CHARSET UTF-8 HEADER Message-Id "<5678 \"x\"@example.org>"`; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString("* SEARCH\r\n")
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	tag, cmd = s.ScanCmd()
+	if want := "APPEND Archive {14}"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString("+ send literal\r\n")
+
+	b := make([]byte, len(msg))
+	if _, err := io.ReadFull(s, b); err != nil {
+		t.Fatal(err)
+	}
+	s.WriteString(tag + " OK APPEND completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.AppendIfAbsent() = %v", err)
+	}
+	if !appended {
+		t.Error("c.AppendIfAbsent() didn't append the message")
+	}
+}
+
+func TestClient_AppendIfAbsent_NoMessageId(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	if _, err := c.AppendIfAbsent("Archive", " ", nil, time.Time{}, bytes.NewBufferString("Hi")); err != ErrNoMessageId {
+		t.Errorf("c.AppendIfAbsent() = %v, want %v", err, ErrNoMessageId)
+	}
+}
+
+func TestClient_Idle(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "IDLE"})
+
+	updates := make(chan interface{}, 1)
+	c.Updates = updates
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Idle(stop)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "IDLE" {
+		t.Fatalf("client sent command %v, want %v", cmd, "IDLE")
+	}
+
+	s.WriteString("+ idling\r\n")
+	s.WriteString("* 3 EXISTS\r\n")
+
+	if update, ok := (<-updates).(*MailboxUpdate); !ok || update.Mailbox.Messages != 3 {
+		t.Fatalf("Invalid update: %v", update)
+	}
+
+	close(stop)
+
+	if line := s.ScanLine(); line != "DONE" {
+		t.Fatalf("client sent %v, want DONE", line)
+	}
+
+	s.WriteString(tag + " OK IDLE terminated\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Idle() = %v", err)
+	}
+}
+
+func TestClient_Notify(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "NOTIFY"})
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("Drafts", nil))
+
+	updates := make(chan interface{}, 1)
+	c.Updates = updates
+
+	spec := &imap.NotifySpec{
+		Status: true,
+		Groups: []*imap.NotifyEventGroup{
+			{
+				Filter:     imap.NotifySelected,
+				Events:     []imap.NotifyEvent{imap.NotifyMessageNew, imap.NotifyMessageExpunge, imap.NotifyFlagChange},
+				FetchItems: []imap.FetchItem{imap.FetchUid, imap.FetchFlags},
+			},
+			{
+				Filter:    imap.NotifyMailboxes,
+				Mailboxes: []string{"INBOX"},
+				Events:    []imap.NotifyEvent{imap.NotifyMessageNew, imap.NotifyMessageExpunge},
+			},
+		},
+	}
 
-	var mbox *imap.MailboxStatus
 	done := make(chan error, 1)
 	go func() {
-		var err error
-		mbox, err = c.Select("INBOX", true)
-		done <- err
+		done <- c.Notify(spec)
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "EXAMINE INBOX" {
-		t.Fatalf("client sent command %v, want EXAMINE INBOX", cmd)
+	want := "NOTIFY SET STATUS (SELECTED (MessageNew (UID FLAGS) MessageExpunge FlagChange)) (MAILBOXES (INBOX) (MessageNew MessageExpunge))"
+	if cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
 	}
 
-	s.WriteString(tag + " OK [READ-ONLY] EXAMINE completed\r\n")
+	s.WriteString("* STATUS INBOX (MESSAGES 3 UIDNEXT 10)\r\n")
+	s.WriteString(tag + " OK NOTIFY completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Select() = %v", err)
+		t.Fatalf("c.Notify() = %v", err)
 	}
 
-	if !mbox.ReadOnly {
-		t.Errorf("c.Select().ReadOnly = false, want true")
+	update, ok := (<-updates).(*MailboxUpdate)
+	if !ok || update.Mailbox.Name != "INBOX" || update.Mailbox.Messages != 3 || update.Mailbox.UidNext != 10 {
+		t.Fatalf("Invalid update: %v", update)
+	}
+
+	// Events in the selected mailbox are reported as usual
+	s.WriteString("* 4 EXISTS\r\n")
+	if update, ok := (<-updates).(*MailboxUpdate); !ok || update.Mailbox.Name != "Drafts" || update.Mailbox.Messages != 4 {
+		t.Fatalf("Invalid update: %v", update)
+	}
+
+	go func() {
+		done <- c.Notify(nil)
+	}()
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "NOTIFY NONE" {
+		t.Fatalf("client sent command %v, want %v", cmd, "NOTIFY NONE")
+	}
+	s.WriteString(tag + " OK NOTIFY completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Notify(nil) = %v", err)
 	}
 }
 
-func TestClient_Create(t *testing.T) {
+func TestClient_Notify_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1"})
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	spec := &imap.NotifySpec{
+		Groups: []*imap.NotifyEventGroup{
+			{Filter: imap.NotifyInboxes, Events: []imap.NotifyEvent{imap.NotifyMessageNew}},
+		},
+	}
+	if err := c.Notify(spec); err != ErrNotifyUnsupported {
+		t.Fatalf("c.Notify() = %v, want %v", err, ErrNotifyUnsupported)
+	}
+}
+
+func TestClient_Notify_InvalidEvents(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "NOTIFY"})
 	setClientState(c, imap.AuthenticatedState, nil)
 
+	// MessageNew requires MessageExpunge: the command must not be sent
+	spec := &imap.NotifySpec{
+		Groups: []*imap.NotifyEventGroup{
+			{Filter: imap.NotifyInboxes, Events: []imap.NotifyEvent{imap.NotifyMessageNew}},
+		},
+	}
+	if err := c.Notify(spec); err == nil {
+		t.Fatal("Expected an error when requesting MessageNew without MessageExpunge")
+	}
+}
+
+func TestClient_Idle_Recent(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "IDLE"})
+
+	updates := make(chan interface{}, 2)
+	c.Updates = updates
+
+	stop := make(chan struct{})
 	done := make(chan error, 1)
 	go func() {
-		done <- c.Create("New Mailbox")
+		done <- c.Idle(stop)
 	}()
 
-	tag, cmd := s.ScanCmd()
-	if cmd != "CREATE \"New Mailbox\"" {
-		t.Fatalf("client sent command %v, want %v", cmd, "CREATE \"New Mailbox\"")
+	tag, _ := s.ScanCmd()
+	s.WriteString("+ idling\r\n")
+	s.WriteString("* 2 RECENT\r\n")
+
+	if update, ok := (<-updates).(*MailboxUpdate); !ok || update.Mailbox.Recent != 2 {
+		t.Fatalf("Invalid update: %v", update)
+	}
+	if recent := c.Mailbox().Recent; recent != 2 {
+		t.Errorf("Invalid recent count: expected %v but got %v", 2, recent)
 	}
 
-	s.WriteString(tag + " OK CREATE completed\r\n")
+	// The \Recent flag reported by the server is preserved
+	s.WriteString("* 5 FETCH (FLAGS (\\Recent \\Seen))\r\n")
+	update, ok := (<-updates).(*MessageUpdate)
+	if !ok || update.Message.SeqNum != 5 {
+		t.Fatalf("Invalid update: %v", update)
+	}
+	if flags := update.Message.Flags; len(flags) != 2 || flags[0] != imap.RecentFlag || flags[1] != imap.SeenFlag {
+		t.Errorf("Invalid flags: %v", flags)
+	}
+
+	close(stop)
+	s.ScanLine()
+	s.WriteString(tag + " OK IDLE terminated\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Create() = %v", err)
+		t.Fatalf("c.Idle() = %v", err)
 	}
 }
 
-func TestClient_Delete(t *testing.T) {
+func TestClient_GetMetadata(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "METADATA"})
 	setClientState(c, imap.AuthenticatedState, nil)
 
 	done := make(chan error, 1)
+	var entries map[string]string
 	go func() {
-		done <- c.Delete("Old Mailbox")
+		var err error
+		opts := &imap.MetadataOptions{MaxSize: 1024, Depth: imap.MetadataDepthOne}
+		entries, err = c.GetMetadata("INBOX", []string{"/private/comment", "/shared"}, opts)
+		done <- err
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "DELETE \"Old Mailbox\"" {
-		t.Fatalf("client sent command %v, want %v", cmd, "DELETE \"Old Mailbox\"")
+	want := "GETMETADATA (MAXSIZE 1024 DEPTH 1) \"INBOX\" (/private/comment /shared)"
+	if cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
 	}
 
-	s.WriteString(tag + " OK DELETE completed\r\n")
+	s.WriteString("* METADATA \"INBOX\" (/private/comment \"My comment\" /shared/comment NIL)\r\n")
+	s.WriteString("* METADATA \"INBOX\" (/shared/vendor {5}\r\n")
+	s.WriteString("Hello)\r\n")
+	s.WriteString(tag + " OK GETMETADATA completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Delete() = %v", err)
+		t.Fatalf("c.GetMetadata() = %v", err)
+	}
+
+	want2 := map[string]string{"/private/comment": "My comment", "/shared/vendor": "Hello"}
+	if !reflect.DeepEqual(entries, want2) {
+		t.Errorf("c.GetMetadata() = %v, want %v", entries, want2)
 	}
 }
 
-func TestClient_Rename(t *testing.T) {
+func TestClient_SetMetadata(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "METADATA-SERVER"})
 	setClientState(c, imap.AuthenticatedState, nil)
 
+	// Mailbox entries require METADATA
+	if err := c.SetMetadata("INBOX", nil); err != ErrMetadataUnsupported {
+		t.Fatalf("c.SetMetadata() = %v, want %v", err, ErrMetadataUnsupported)
+	}
+
 	done := make(chan error, 1)
 	go func() {
-		done <- c.Rename("Old Mailbox", "New Mailbox")
+		admin := "mailto:admin@example.org"
+		done <- c.SetMetadata("", map[string]*string{"/shared/admin": &admin, "/shared/comment": nil})
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "RENAME \"Old Mailbox\" \"New Mailbox\"" {
-		t.Fatalf("client sent command %v, want %v", cmd, "RENAME \"Old Mailbox\" \"New Mailbox\"")
+	want := "SETMETADATA \"\" (/shared/admin \"mailto:admin@example.org\" /shared/comment NIL)"
+	if cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
 	}
-
-	s.WriteString(tag + " OK RENAME completed\r\n")
+	s.WriteString(tag + " OK SETMETADATA completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Rename() = %v", err)
+		t.Fatalf("c.SetMetadata() = %v", err)
 	}
 }
 
-func TestClient_Subscribe(t *testing.T) {
+func TestClient_GetQuotaRoot(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
 	setClientState(c, imap.AuthenticatedState, nil)
 
+	if _, err := c.GetQuotaRoot("INBOX"); err != ErrQuotaUnsupported {
+		t.Fatalf("c.GetQuotaRoot() = %v, want %v", err, ErrQuotaUnsupported)
+	}
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "QUOTA"})
+
 	done := make(chan error, 1)
+	var quotas []*imap.Quota
 	go func() {
-		done <- c.Subscribe("Mailbox")
+		var err error
+		quotas, err = c.GetQuotaRoot("INBOX")
+		done <- err
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "SUBSCRIBE Mailbox" {
-		t.Fatalf("client sent command %v, want %v", cmd, "SUBSCRIBE Mailbox")
+	if cmd != "GETQUOTAROOT INBOX" {
+		t.Fatalf("client sent command %v, want %v", cmd, "GETQUOTAROOT INBOX")
 	}
-
-	s.WriteString(tag + " OK SUBSCRIBE completed\r\n")
+	s.WriteString("* QUOTAROOT INBOX \"\" user\r\n")
+	s.WriteString("* QUOTA \"\" (STORAGE 10 512)\r\n")
+	s.WriteString(tag + " OK GETQUOTAROOT completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Subscribe() = %v", err)
+		t.Fatalf("c.GetQuotaRoot() = %v", err)
+	}
+
+	want := []*imap.Quota{
+		{Root: "", Resources: map[string]*imap.QuotaResource{
+			imap.QuotaStorage: {Usage: 10, Limit: 512},
+		}},
+		{Root: "user"},
+	}
+	if !reflect.DeepEqual(quotas, want) {
+		t.Errorf("c.GetQuotaRoot() = %v, want %v", quotas, want)
 	}
 }
 
-func TestClient_Unsubscribe(t *testing.T) {
+func TestClient_SetQuota(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "QUOTA"})
 	setClientState(c, imap.AuthenticatedState, nil)
 
 	done := make(chan error, 1)
 	go func() {
-		done <- c.Unsubscribe("Mailbox")
+		done <- c.SetQuota("", map[string]uint64{imap.QuotaStorage: 512})
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "UNSUBSCRIBE Mailbox" {
-		t.Fatalf("client sent command %v, want %v", cmd, "UNSUBSCRIBE Mailbox")
+	if cmd != "SETQUOTA \"\" (STORAGE 512)" {
+		t.Fatalf("client sent command %v, want %v", cmd, "SETQUOTA \"\" (STORAGE 512)")
 	}
-
-	s.WriteString(tag + " OK UNSUBSCRIBE completed\r\n")
+	s.WriteString("* QUOTA \"\" (STORAGE 10 512)\r\n")
+	s.WriteString(tag + " OK SETQUOTA completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Unsubscribe() = %v", err)
+		t.Fatalf("c.SetQuota() = %v", err)
 	}
 }
 
-func TestClient_List(t *testing.T) {
+func TestClient_SetACL(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ACL"})
 	setClientState(c, imap.AuthenticatedState, nil)
 
 	done := make(chan error, 1)
-	mailboxes := make(chan *imap.MailboxInfo, 3)
 	go func() {
-		done <- c.List("", "%", mailboxes)
+		done <- c.SetACL("INBOX", "fred", imap.ACLModeAdd, "lr")
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "LIST \"\" %" {
-		t.Fatalf("client sent command %v, want %v", cmd, "LIST \"\" %")
+	if want := "SETACL INBOX fred +lr"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
 	}
-
-	s.WriteString("* LIST (flag1) \"/\" INBOX\r\n")
-	s.WriteString("* LIST (flag2 flag3) \"/\" Drafts\r\n")
-	s.WriteString("* LIST () \"/\" Sent\r\n")
-	s.WriteString(tag + " OK LIST completed\r\n")
+	s.WriteString(tag + " OK SETACL completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.List() = %v", err)
+		t.Fatalf("c.SetACL() = %v", err)
 	}
+}
 
-	want := []struct {
-		name       string
-		attributes []string
-	}{
-		{"INBOX", []string{"flag1"}},
-		{"Drafts", []string{"flag2", "flag3"}},
-		{"Sent", []string{}},
-	}
+func TestClient_GetACL(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
 
-	i := 0
-	for mbox := range mailboxes {
-		if mbox.Name != want[i].name {
-			t.Errorf("Bad mailbox name for %v: %v, want %v", i, mbox.Name, want[i].name)
-		}
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ACL"})
+	setClientState(c, imap.AuthenticatedState, nil)
 
-		if !reflect.DeepEqual(mbox.Attributes, want[i].attributes) {
-			t.Errorf("Bad mailbox attributes for %v: %v, want %v", i, mbox.Attributes, want[i].attributes)
-		}
+	done := make(chan error, 1)
+	var acl map[string]imap.ACLRights
+	go func() {
+		var err error
+		acl, err = c.GetACL("INBOX")
+		done <- err
+	}()
 
-		i++
+	tag, cmd := s.ScanCmd()
+	if want := "GETACL INBOX"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString("* ACL INBOX Fred rwipslxetad \"Chris Newman\" lrs\r\n")
+	s.WriteString(tag + " OK GETACL completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.GetACL() = %v", err)
+	}
+
+	want := map[string]imap.ACLRights{"Fred": "rwipslxetad", "Chris Newman": "lrs"}
+	if !reflect.DeepEqual(acl, want) {
+		t.Errorf("c.GetACL() = %v, want %v", acl, want)
 	}
 }
 
-func TestClient_Lsub(t *testing.T) {
+func TestClient_ListRights(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ACL"})
 	setClientState(c, imap.AuthenticatedState, nil)
 
 	done := make(chan error, 1)
-	mailboxes := make(chan *imap.MailboxInfo, 1)
+	var required imap.ACLRights
+	var optional []imap.ACLRights
 	go func() {
-		done <- c.Lsub("", "%", mailboxes)
+		var err error
+		required, optional, err = c.ListRights("~/Mail/saved", "smith")
+		done <- err
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "LSUB \"\" %" {
-		t.Fatalf("client sent command %v, want %v", cmd, "LSUB \"\" %")
+	if want := "LISTRIGHTS ~/Mail/saved smith"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
 	}
-
-	s.WriteString("* LSUB () \"/\" INBOX\r\n")
-	s.WriteString(tag + " OK LSUB completed\r\n")
+	s.WriteString("* LISTRIGHTS ~/Mail/saved smith la r swicdkxte\r\n")
+	s.WriteString(tag + " OK LISTRIGHTS completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Lsub() = %v", err)
+		t.Fatalf("c.ListRights() = %v", err)
 	}
-
-	mbox := <-mailboxes
-	if mbox.Name != "INBOX" {
-		t.Errorf("Bad mailbox name: %v", mbox.Name)
+	if required != "la" {
+		t.Errorf("Invalid required rights: %q", required)
 	}
-	if len(mbox.Attributes) != 0 {
-		t.Errorf("Bad mailbox flags: %v", mbox.Attributes)
+	if want := []imap.ACLRights{"r", "swicdkxte"}; !reflect.DeepEqual(optional, want) {
+		t.Errorf("Invalid optional rights: %v, want %v", optional, want)
 	}
 }
 
-func TestClient_Status(t *testing.T) {
+func TestClient_MyRights(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ACL"})
 	setClientState(c, imap.AuthenticatedState, nil)
 
 	done := make(chan error, 1)
-	var mbox *imap.MailboxStatus
+	var rights imap.ACLRights
 	go func() {
 		var err error
-		mbox, err = c.Status("INBOX", []imap.StatusItem{imap.StatusMessages, imap.StatusRecent})
+		rights, err = c.MyRights("INBOX")
 		done <- err
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "STATUS INBOX (MESSAGES RECENT)" {
-		t.Fatalf("client sent command %v, want %v", cmd, "STATUS INBOX (MESSAGES RECENT)")
+	if want := "MYRIGHTS INBOX"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
 	}
-
-	s.WriteString("* STATUS INBOX (MESSAGES 42 RECENT 1)\r\n")
-	s.WriteString(tag + " OK STATUS completed\r\n")
+	s.WriteString("* MYRIGHTS INBOX rwiptsldaex\r\n")
+	s.WriteString(tag + " OK MYRIGHTS completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Status() = %v", err)
-	}
-
-	if mbox.Messages != 42 {
-		t.Errorf("Bad mailbox messages: %v", mbox.Messages)
+		t.Fatalf("c.MyRights() = %v", err)
 	}
-	if mbox.Recent != 1 {
-		t.Errorf("Bad mailbox recent: %v", mbox.Recent)
+	if rights != "rwiptsldaex" {
+		t.Errorf("c.MyRights() = %q", rights)
 	}
 }
 
-func TestClient_Append(t *testing.T) {
+func TestClient_ACL_Unsupported(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
 	setClientState(c, imap.AuthenticatedState, nil)
 
-	msg := "Hello World!\r\nHello Gophers!\r\n"
-	date := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
-	flags := []string{imap.SeenFlag, imap.DraftFlag}
+	if _, err := c.MyRights("INBOX"); err != ErrACLUnsupported {
+		t.Fatalf("c.MyRights() = %v, want %v", err, ErrACLUnsupported)
+	}
+}
+
+func TestClient_GenURLAuth(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "URLAUTH"})
+	setClientState(c, imap.AuthenticatedState, nil)
 
+	rump := "imap://joe@example.com/INBOX/;uid=20/;section=1.2;urlauth=submit+fred"
 	done := make(chan error, 1)
+	var url string
 	go func() {
-		done <- c.Append("INBOX", flags, date, bytes.NewBufferString(msg))
+		var err error
+		url, err = c.GenURLAuth(rump, imap.URLAuthInternal)
+		done <- err
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "APPEND INBOX (\\Seen \\Draft) \"10-Nov-2009 23:00:00 +0000\" {30}" {
-		t.Fatalf("client sent command %v, want %v", cmd, "APPEND INBOX (\\Seen \\Draft) \"10-Nov-2009 23:00:00 +0000\" {30}")
+	if want := "GENURLAUTH \"" + rump + "\" INTERNAL"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
 	}
+	s.WriteString("* GENURLAUTH \"" + rump + ":INTERNAL:91354a473744909de610943775f92038\"\r\n")
+	s.WriteString(tag + " OK GENURLAUTH completed\r\n")
 
-	s.WriteString("+ send literal\r\n")
+	if err := <-done; err != nil {
+		t.Fatalf("c.GenURLAuth() = %v", err)
+	}
+	if want := rump + ":INTERNAL:91354a473744909de610943775f92038"; url != want {
+		t.Errorf("c.GenURLAuth() = %v, want %v", url, want)
+	}
+}
 
-	b := make([]byte, 30)
-	if _, err := io.ReadFull(s, b); err != nil {
+func TestClient_URLFetch(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "URLAUTH"})
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	valid := "imap://joe@example.com/INBOX/;uid=20;urlauth=anonymous:INTERNAL:91354a47"
+	invalid := "imap://joe@example.com/INBOX/;uid=20;urlauth=anonymous:INTERNAL:0000"
+	done := make(chan error, 1)
+	var data map[string]imap.Literal
+	go func() {
+		var err error
+		data, err = c.URLFetch(valid, invalid)
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if want := "URLFETCH \"" + valid + "\" \"" + invalid + "\""; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString("* URLFETCH \"" + valid + "\" {5}\r\n")
+	s.WriteString("Hello \"" + invalid + "\" NIL\r\n")
+	s.WriteString(tag + " OK URLFETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.URLFetch() = %v", err)
+	}
+	if len(data) != 2 || data[invalid] != nil {
+		t.Fatalf("c.URLFetch() = %v", data)
+	}
+	var b bytes.Buffer
+	if _, err := io.Copy(&b, data[valid]); err != nil {
 		t.Fatal(err)
+	} else if b.String() != "Hello" {
+		t.Errorf("c.URLFetch() data = %q, want %q", b.String(), "Hello")
 	}
+}
 
-	if string(b) != msg {
-		t.Fatal("Bad literal:", string(b))
+func TestClient_URLFetch_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1"})
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	if _, err := c.URLFetch("imap://joe@example.com/INBOX/;uid=20;urlauth=anonymous:INTERNAL:0000"); err != ErrURLAuthUnsupported {
+		t.Fatalf("c.URLFetch() = %v, want %v", err, ErrURLAuthUnsupported)
 	}
+}
 
-	s.WriteString(tag + " OK APPEND completed\r\n")
+func TestClient_Unauthenticate(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "UNAUTHENTICATE"})
+	setClientState(c, imap.SelectedState, &imap.MailboxStatus{Name: "INBOX"})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Unauthenticate()
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "UNAUTHENTICATE" {
+		t.Fatalf("client sent command %v, want %v", cmd, "UNAUTHENTICATE")
+	}
+	s.WriteString(tag + " OK UNAUTHENTICATE completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Append() = %v", err)
+		t.Fatalf("c.Unauthenticate() = %v", err)
+	}
+	if state := c.State(); state != imap.NotAuthenticatedState {
+		t.Errorf("c.State() = %v, want %v", state, imap.NotAuthenticatedState)
+	}
+	if mbox := c.Mailbox(); mbox != nil {
+		t.Errorf("c.Mailbox() = %v, want nil", mbox)
+	}
+}
+
+func TestClient_Unauthenticate_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1"})
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	if err := c.Unauthenticate(); err != ErrUnauthenticateUnsupported {
+		t.Fatalf("c.Unauthenticate() = %v, want %v", err, ErrUnauthenticateUnsupported)
 	}
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/oauth"
 	"github.com/emersion/go-imap/responses"
 	"github.com/emersion/go-sasl"
 )
@@ -18,10 +19,11 @@ var (
 	// ErrTLSAlreadyEnabled is returned if StartTLS is called when TLS is already
 	// enabled.
 	ErrTLSAlreadyEnabled = errors.New("TLS is already enabled")
-	// ErrLoginDisabled is returned if Login or Authenticate is called when the
-	// server has disabled authentication. Most of the time, calling enabling TLS
-	// solves the problem.
-	ErrLoginDisabled = errors.New("Login is disabled in current state")
+	// ErrLoginDisabled is returned if Login is called when the server has
+	// advertised the LOGINDISABLED capability. The password is never sent in
+	// this case. Most of the time, enabling TLS with StartTLS or using
+	// Authenticate solves the problem.
+	ErrLoginDisabled = errors.New("Login is disabled in current state, use STARTTLS or AUTHENTICATE")
 )
 
 // SupportStartTLS checks if the server supports STARTTLS.
@@ -37,14 +39,10 @@ func (c *Client) StartTLS(tlsConfig *tls.Config) error {
 
 	cmd := new(commands.StartTLS)
 
-	err := c.Upgrade(func(conn net.Conn) (net.Conn, error) {
-		if status, err := c.execute(cmd, nil); err != nil {
-			return nil, err
-		} else if err := status.Err(); err != nil {
-			return nil, err
-		}
-
-		tlsConn := tls.Client(conn, tlsConfig)
+	// No other command must be sent until the TLS handshake is complete
+	var tlsConn *tls.Conn
+	status, err := c.ExecuteUpgrade(cmd, func(conn net.Conn) (net.Conn, error) {
+		tlsConn = tls.Client(conn, tlsConfig)
 		if err := tlsConn.Handshake(); err != nil {
 			return nil, err
 		}
@@ -58,9 +56,12 @@ func (c *Client) StartTLS(tlsConfig *tls.Config) error {
 	})
 	if err != nil {
 		return err
+	} else if err := status.Err(); err != nil {
+		return err
 	}
 
 	c.isTLS = true
+	c.tlsConn = tlsConn
 	return nil
 }
 
@@ -72,6 +73,13 @@ func (c *Client) SupportAuth(mech string) (bool, error) {
 // Authenticate indicates a SASL authentication mechanism to the server. If the
 // server supports the requested authentication mechanism, it performs an
 // authentication protocol exchange to authenticate and identify the client.
+//
+// If the mechanism has an initial response and the server advertises SASL-IR,
+// the initial response is sent with the command, saving a round trip.
+//
+// To authenticate with an OAuth 2.0 token, use the mechanisms of the oauth
+// package: if authentication fails, the error sent by the server, an
+// *oauth.Error, is returned.
 func (c *Client) Authenticate(auth sasl.Client) error {
 	if c.State() != imap.NotAuthenticatedState {
 		return ErrAlreadyLoggedIn
@@ -86,17 +94,36 @@ func (c *Client) Authenticate(auth sasl.Client) error {
 		Mechanism: mech,
 	}
 
+	if ir != nil {
+		if saslIR, err := c.Support("SASL-IR"); err != nil {
+			return err
+		} else if saslIR {
+			cmd.InitialResponse, ir = ir, nil
+		}
+	}
+
 	res := &responses.Authenticate{
 		Mechanism:       auth,
 		InitialResponse: ir,
 		Writer:          c.Writer(),
 	}
 
-	status, err := c.execute(cmd, res)
+	// The handler writes responses to the server's challenges
+	h := responses.HandlerFunc(func(resp imap.Resp) error {
+		c.writeLocker.Lock()
+		defer c.writeLocker.Unlock()
+		return res.Handle(resp)
+	})
+
+	status, err := c.execute(cmd, h)
 	if err != nil {
 		return err
 	}
 	if err = status.Err(); err != nil {
+		// The error sent in a challenge is more detailed than the status
+		if errAuth, ok := auth.(oauth.ErrorClient); ok && errAuth.Err() != nil {
+			return errAuth.Err()
+		}
 		return err
 	}
 
@@ -114,15 +141,19 @@ func (c *Client) Authenticate(auth sasl.Client) error {
 
 // Login identifies the client to the server and carries the plaintext password
 // authenticating this user.
+//
+// If the server advertises LOGINDISABLED, ErrLoginDisabled is returned before
+// the credentials are sent. If capabilities are not cached yet, they are
+// requested first.
 func (c *Client) Login(username, password string) error {
 	if c.State() != imap.NotAuthenticatedState {
 		return ErrAlreadyLoggedIn
 	}
 
-	c.locker.Lock()
-	loginDisabled := c.caps != nil && c.caps["LOGINDISABLED"]
-	c.locker.Unlock()
-	if loginDisabled {
+	// Don't leak the password to a server which will reject it anyway
+	if loginDisabled, err := c.Support("LOGINDISABLED"); err != nil {
+		return err
+	} else if loginDisabled {
 		return ErrLoginDisabled
 	}
 
@@ -1,8 +1,10 @@
 package client
 
 import (
+	"bytes"
 	"crypto/tls"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/emersion/go-imap"
@@ -111,6 +113,60 @@ func TestClient_Authenticate(t *testing.T) {
 	}
 }
 
+func TestClient_Authenticate_InitialResponse(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "AUTH=PLAIN", "SASL-IR"})
+
+	sasl := sasl.NewPlainClient("", "username", "password")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Authenticate(sasl)
+	}()
+
+	wantCmd := "AUTHENTICATE PLAIN AHVzZXJuYW1lAHBhc3N3b3Jk"
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	s.WriteString(tag + " OK AUTHENTICATE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Authenticate() = %v", err)
+	}
+
+	if state := c.State(); state != imap.AuthenticatedState {
+		t.Errorf("c.State() = %v, want %v", state, imap.AuthenticatedState)
+	}
+}
+
+func TestClient_Authenticate_EmptyInitialResponse(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "AUTH=EXTERNAL", "SASL-IR"})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Authenticate(sasl.NewExternalClient(""))
+	}()
+
+	wantCmd := "AUTHENTICATE EXTERNAL ="
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	s.WriteString(tag + " OK AUTHENTICATE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Authenticate() = %v", err)
+	}
+}
+
 func TestClient_Login_Success(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
@@ -158,3 +214,61 @@ func TestClient_Login_Error(t *testing.T) {
 		t.Errorf("c.State() = %v, want %v", state, imap.NotAuthenticatedState)
 	}
 }
+
+func TestClient_Login_Referral(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Login("username", "password")
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString(tag + " NO [REFERRAL IMAP://username;AUTH=*@SERVER2/] Try SERVER2\r\n")
+
+	err := <-done
+	if referralErr, ok := err.(*imap.ReferralError); !ok {
+		t.Fatalf("c.Login() = %v, want a *imap.ReferralError", err)
+	} else if referralErr.URL != "IMAP://username;AUTH=*@SERVER2/" {
+		t.Errorf("Invalid referral URL: %v", referralErr.URL)
+	}
+}
+
+func TestClient_Login_Disabled(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	var b bytes.Buffer
+	c.SetDebug(imap.NewDebugWriter(&b, nil))
+
+	// Forget capabilities sent with the greeting, the client must request
+	// them again before sending credentials
+	c.locker.Lock()
+	c.caps = nil
+	c.locker.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Login("username", "password")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "CAPABILITY" {
+		t.Fatalf("client sent command %v, want CAPABILITY", cmd)
+	}
+	s.WriteString("* CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED\r\n")
+	s.WriteString(tag + " OK CAPABILITY completed\r\n")
+
+	if err := <-done; err != ErrLoginDisabled {
+		t.Fatalf("c.Login() = %v, want %v", err, ErrLoginDisabled)
+	}
+
+	if strings.Contains(b.String(), "password") {
+		t.Errorf("client sent the password while LOGINDISABLED is advertised: %q", b.String())
+	}
+
+	if state := c.State(); state != imap.NotAuthenticatedState {
+		t.Errorf("c.State() = %v, want %v", state, imap.NotAuthenticatedState)
+	}
+}
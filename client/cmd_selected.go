@@ -2,15 +2,62 @@ package client
 
 import (
 	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/commands"
 	"github.com/emersion/go-imap/responses"
 )
 
-// ErrNoMailboxSelected is returned if a command that requires a mailbox to be
-// selected is called when there isn't.
-var ErrNoMailboxSelected = errors.New("No mailbox selected")
+var (
+	// ErrNoMailboxSelected is returned if a command that requires a mailbox to
+	// be selected is called when there isn't.
+	ErrNoMailboxSelected = errors.New("No mailbox selected")
+	// ErrMailboxReadOnly is returned if a command that modifies the selected
+	// mailbox is called when it has been opened in read-only mode, e.g. with
+	// Examine.
+	ErrMailboxReadOnly = errors.New("Mailbox is opened in read-only mode")
+	// ErrCondStoreUnsupported is returned if a command requiring the CONDSTORE
+	// extension is called when the server doesn't support it.
+	ErrCondStoreUnsupported = errors.New("CONDSTORE is not supported by the server")
+	// ErrSearchResUnsupported is returned if a search result is saved or
+	// referred to when the server doesn't support the SEARCHRES extension.
+	ErrSearchResUnsupported = errors.New("SEARCHRES is not supported by the server")
+	// ErrSearchNotSaved is returned if the server couldn't save a search
+	// result, or if a command refers to a saved result which is not available
+	// anymore.
+	ErrSearchNotSaved = errors.New("Search result has not been saved")
+	// ErrRecentFlag is returned by Store if the \Recent flag is added,
+	// removed or set. This flag is managed by the server and cannot be
+	// altered by clients.
+	ErrRecentFlag = errors.New("The \\Recent flag cannot be stored")
+	// ErrUidPlusUnsupported is returned by UidExpunge if the server doesn't
+	// support the UIDPLUS extension.
+	ErrUidPlusUnsupported = errors.New("UIDPLUS is not supported by the server")
+	// ErrSearchContextUnsupported is returned by SearchContext and
+	// UidSearchContext if the server doesn't support CONTEXT=SEARCH.
+	ErrSearchContextUnsupported = errors.New("CONTEXT=SEARCH is not supported by the server")
+	// ErrAnnotateUnsupported is returned by SetAnnotations if the server
+	// doesn't support the ANNOTATE-EXPERIMENT-1 extension.
+	ErrAnnotateUnsupported = errors.New("ANNOTATE-EXPERIMENT-1 is not supported by the server")
+)
+
+// ensureWritable checks that a mailbox is selected in read-write mode.
+func (c *Client) ensureWritable() error {
+	if c.State() != imap.SelectedState {
+		return ErrNoMailboxSelected
+	}
+	if mbox := c.Mailbox(); mbox != nil && mbox.ReadOnly {
+		return ErrMailboxReadOnly
+	}
+	return nil
+}
 
 // Check requests a checkpoint of the currently selected mailbox. A checkpoint
 // refers to any implementation-dependent housekeeping associated with the
@@ -56,10 +103,11 @@ func (c *Client) Close() error {
 
 // Expunge permanently removes all messages that have the \Deleted flag set from
 // the currently selected mailbox. If ch is not nil, sends sequence IDs of each
-// deleted message to this channel.
+// deleted message to this channel. ErrMailboxReadOnly is returned if the
+// mailbox is opened in read-only mode.
 func (c *Client) Expunge(ch chan uint32) error {
-	if c.State() != imap.SelectedState {
-		return ErrNoMailboxSelected
+	if err := c.ensureWritable(); err != nil {
+		return err
 	}
 
 	cmd := new(commands.Expunge)
@@ -77,39 +125,402 @@ func (c *Client) Expunge(ch chan uint32) error {
 	return status.Err()
 }
 
-func (c *Client) executeSearch(uid bool, criteria *imap.SearchCriteria, charset string) (ids []uint32, status *imap.StatusResp, err error) {
+// UidExpunge is like Expunge, but only removes the messages whose UID is in
+// seqset, as defined in RFC 4315 section 2.1. If the server doesn't support
+// UIDPLUS, ErrUidPlusUnsupported is returned.
+func (c *Client) UidExpunge(seqset *imap.SeqSet, ch chan uint32) error {
+	if err := c.ensureWritable(); err != nil {
+		return err
+	}
+	if ok, err := c.Support("UIDPLUS"); err != nil {
+		return err
+	} else if !ok {
+		return ErrUidPlusUnsupported
+	}
+
+	var h responses.Handler
+	if ch != nil {
+		h = &responses.Expunge{SeqNums: ch}
+		defer close(ch)
+	}
+
+	cmd := &commands.Uid{Cmd: &commands.Expunge{SeqSet: seqset}}
+	status, err := c.execute(cmd, h)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+func (c *Client) executeSearch(uid bool, criteria *imap.SearchCriteria, charset string, save bool) (ids []uint32, status *imap.StatusResp, err error) {
 	if c.State() != imap.SelectedState {
 		err = ErrNoMailboxSelected
 		return
 	}
 
-	var cmd imap.Commander
-	cmd = &commands.Search{
+	search := &commands.Search{
 		Charset:  charset,
 		Criteria: criteria,
 	}
+	if save {
+		search.Return = []string{imap.SearchReturnSave}
+	}
+
+	var cmd imap.Commander = search
 	if uid {
 		cmd = &commands.Uid{Cmd: cmd}
 	}
 
 	res := new(responses.Search)
+	// IMAP4rev2 servers reply with ESEARCH instead, see RFC 9051 section 6.4.4
+	eres := new(responses.ESearch)
 
-	status, err = c.execute(cmd, res)
+	status, err = c.executeRetry(cmd, chainHandlers(res, eres))
 	if err != nil {
 		return
 	}
 
+	if save && status.Code == imap.CodeNotSaved {
+		err = ErrSearchNotSaved
+		return
+	}
+
 	err, ids = status.Err(), res.Ids
+	if eres.Result != nil && eres.Result.All != nil {
+		ids = seqSetNums(eres.Result.All)
+	}
 	return
 }
 
-func (c *Client) search(uid bool, criteria *imap.SearchCriteria) (ids []uint32, err error) {
-	ids, status, err := c.executeSearch(uid, criteria, "UTF-8")
-	if status != nil && status.Code == imap.CodeBadCharset {
-		// Some servers don't support UTF-8
-		ids, _, err = c.executeSearch(uid, criteria, "US-ASCII")
+// seqSetNums returns the numbers contained in a sequence set without "*".
+func seqSetNums(seqset *imap.SeqSet) []uint32 {
+	var nums []uint32
+	for _, seq := range seqset.Set {
+		for n := seq.Start; n <= seq.Stop && n != 0; n++ {
+			nums = append(nums, n)
+		}
 	}
-	return
+	return nums
+}
+
+// search executes a SEARCH command. If save is true, the server is asked to
+// save the result instead of returning it.
+func (c *Client) search(uid bool, criteria *imap.SearchCriteria, save bool) (ids []uint32, err error) {
+	if usesModSeq(criteria) {
+		if ok, err := c.Support("CONDSTORE"); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, ErrCondStoreUnsupported
+		}
+	}
+	if usesWithin(criteria) {
+		if within, err := c.Support("WITHIN"); err != nil {
+			return nil, err
+		} else if !within {
+			c.ErrorLog.Println("server doesn't support WITHIN, computing search dates from the local clock")
+			criteria = withinToDates(criteria, time.Now())
+		}
+	}
+
+	// Servers limit the length of command lines, split huge sequence sets into
+	// several searches. A saved result can't be split.
+	if sets := splitSeqSet(criteria.Uid, maxSearchSeqSetLen); len(sets) > 1 && !save {
+		return c.searchSplit(uid, criteria, sets, func(c *imap.SearchCriteria, set *imap.SeqSet) { c.Uid = set })
+	}
+	if sets := splitSeqSet(criteria.SeqNum, maxSearchSeqSetLen); len(sets) > 1 && !save {
+		return c.searchSplit(uid, criteria, sets, func(c *imap.SearchCriteria, set *imap.SeqSet) { c.SeqNum = set })
+	}
+	if n := searchLineLen(criteria.Format()); n > maxCommandLineLen {
+		c.ErrorLog.Printf("search command line is about %v bytes long, the server may reject it", n)
+	}
+
+	ids, status, err := c.executeSearch(uid, criteria, "UTF-8", save)
+	if status == nil || status.Code != imap.CodeBadCharset {
+		return
+	}
+
+	// Some servers don't support UTF-8, retry once with the first charset
+	// supported by the server that can encode the criteria
+	charsets := badCharsetList(status.Arguments)
+	if len(charsets) == 0 {
+		charsets = []string{"US-ASCII"}
+	}
+	for _, charset := range charsets {
+		if strings.EqualFold(charset, "UTF-8") {
+			continue
+		}
+
+		encoded, encErr := encodeSearchCriteria(criteria, charset)
+		if encErr != nil {
+			continue
+		}
+
+		ids, _, err = c.executeSearch(uid, encoded, charset, save)
+		return
+	}
+
+	return nil, fmt.Errorf("UTF-8 is not supported by the server and search criteria cannot be encoded in any of its charsets: %v", strings.Join(charsets, ", "))
+}
+
+const (
+	// RFC 7162 section 4 recommends clients to limit command lines to 8192
+	// octets.
+	maxCommandLineLen = 8192
+	// Sequence sets longer than this are split into several searches.
+	maxSearchSeqSetLen = 4096
+)
+
+// searchSplit runs one search per sequence set in sets, set in a copy of
+// criteria by setSeqSet, and returns the union of the results. Messages match
+// criteria if they match the search for one of the sets.
+func (c *Client) searchSplit(uid bool, criteria *imap.SearchCriteria, sets []*imap.SeqSet, setSeqSet func(*imap.SearchCriteria, *imap.SeqSet)) ([]uint32, error) {
+	found := make(map[uint32]bool)
+	for _, set := range sets {
+		part := *criteria
+		setSeqSet(&part, set)
+
+		partIds, err := c.search(uid, &part, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range partIds {
+			found[id] = true
+		}
+	}
+
+	ids := make([]uint32, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// splitSeqSet splits set into several sets whose string representations are
+// at most maxLen bytes long. A nil slice is returned if set is nil.
+func splitSeqSet(set *imap.SeqSet, maxLen int) []*imap.SeqSet {
+	if set == nil {
+		return nil
+	}
+
+	var sets []*imap.SeqSet
+	cur, curLen := new(imap.SeqSet), 0
+	for _, seq := range set.Set {
+		l := len(seq.String()) + 1
+		if curLen > 0 && curLen+l > maxLen {
+			sets = append(sets, cur)
+			cur, curLen = new(imap.SeqSet), 0
+		}
+		cur.Set = append(cur.Set, seq)
+		curLen += l
+	}
+	return append(sets, cur)
+}
+
+// searchLineLen estimates the length of the longest line of a command with the
+// provided search criteria fields. Literals start a new line.
+func searchLineLen(fields []interface{}) int {
+	n, max := 0, 0
+	for _, f := range fields {
+		switch f := f.(type) {
+		case string:
+			if len(f) > commands.MaxSearchQuotedLen {
+				// Sent as a literal, only its header is on this line
+				n += len(fmt.Sprintf("{%v}", len(f)))
+				if n > max {
+					max = n
+				}
+				n = 0
+			} else {
+				n += len(f) + 2
+			}
+		case []interface{}:
+			if l := searchLineLen(f); l > max {
+				max = l
+			}
+			n += len(fmt.Sprint(f))
+		default:
+			n += len(fmt.Sprint(f))
+		}
+		n++
+	}
+	if n > max {
+		max = n
+	}
+	return max
+}
+
+// usesWithin checks if criteria contain relative times, defined in the WITHIN
+// extension.
+func usesWithin(criteria *imap.SearchCriteria) bool {
+	if criteria.Younger > 0 || criteria.Older > 0 {
+		return true
+	}
+	for _, not := range criteria.Not {
+		if usesWithin(not) {
+			return true
+		}
+	}
+	for _, or := range criteria.Or {
+		if usesWithin(or[0]) || usesWithin(or[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// usesModSeq returns true if criteria or one of its sub-criteria uses the
+// MODSEQ search key.
+func usesModSeq(criteria *imap.SearchCriteria) bool {
+	if criteria.ModSeq > 0 {
+		return true
+	}
+	for _, not := range criteria.Not {
+		if usesModSeq(not) {
+			return true
+		}
+	}
+	for _, or := range criteria.Or {
+		if usesModSeq(or[0]) || usesModSeq(or[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// withinToDates returns a copy of criteria where relative times are replaced
+// with dates computed from now. Dates have a one-day granularity, so YOUNGER
+// is widened to the start of its day and OLDER is narrowed to the start of its
+// day.
+func withinToDates(criteria *imap.SearchCriteria, now time.Time) *imap.SearchCriteria {
+	startOfDay := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+
+	converted := *criteria
+	converted.Younger, converted.Older = 0, 0
+
+	if criteria.Younger > 0 {
+		since := startOfDay(now.Add(-criteria.Younger))
+		if converted.Since.IsZero() || since.After(converted.Since) {
+			converted.Since = since
+		}
+	}
+	if criteria.Older > 0 {
+		before := startOfDay(now.Add(-criteria.Older))
+		if converted.Before.IsZero() || before.Before(converted.Before) {
+			converted.Before = before
+		}
+	}
+
+	if criteria.Not != nil {
+		converted.Not = make([]*imap.SearchCriteria, len(criteria.Not))
+		for i, not := range criteria.Not {
+			converted.Not[i] = withinToDates(not, now)
+		}
+	}
+	if criteria.Or != nil {
+		converted.Or = make([][2]*imap.SearchCriteria, len(criteria.Or))
+		for i, or := range criteria.Or {
+			converted.Or[i] = [2]*imap.SearchCriteria{withinToDates(or[0], now), withinToDates(or[1], now)}
+		}
+	}
+
+	return &converted
+}
+
+// badCharsetList returns the charsets listed in a BADCHARSET response code.
+func badCharsetList(args []interface{}) []string {
+	if len(args) == 1 {
+		if list, ok := args[0].([]interface{}); ok {
+			args = list
+		}
+	}
+
+	var charsets []string
+	for _, arg := range args {
+		if charset, err := imap.ParseString(arg); err == nil {
+			charsets = append(charsets, charset)
+		}
+	}
+	return charsets
+}
+
+func encodeString(charset, s string) (string, error) {
+	switch charset = strings.ToLower(charset); charset {
+	case "utf-8":
+		return s, nil
+	case "us-ascii":
+		for i := 0; i < len(s); i++ {
+			if s[i] > 0x7f {
+				return "", errors.New("String contains non-ASCII characters")
+			}
+		}
+		return s, nil
+	}
+
+	if imap.CharsetEncoder == nil {
+		return "", fmt.Errorf("Unsupported charset: %v", charset)
+	}
+	return imap.CharsetEncoder(charset, s)
+}
+
+// encodeSearchCriteria returns a copy of criteria with all strings encoded in
+// the provided charset.
+func encodeSearchCriteria(criteria *imap.SearchCriteria, charset string) (*imap.SearchCriteria, error) {
+	encodeStrings := func(values []string) ([]string, error) {
+		if values == nil {
+			return nil, nil
+		}
+
+		encoded := make([]string, len(values))
+		for i, v := range values {
+			var err error
+			if encoded[i], err = encodeString(charset, v); err != nil {
+				return nil, err
+			}
+		}
+		return encoded, nil
+	}
+
+	encoded := *criteria
+	var err error
+
+	if criteria.Header != nil {
+		encoded.Header = make(textproto.MIMEHeader, len(criteria.Header))
+		for k, values := range criteria.Header {
+			if encoded.Header[k], err = encodeStrings(values); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if encoded.Body, err = encodeStrings(criteria.Body); err != nil {
+		return nil, err
+	}
+	if encoded.Text, err = encodeStrings(criteria.Text); err != nil {
+		return nil, err
+	}
+
+	if criteria.Not != nil {
+		encoded.Not = make([]*imap.SearchCriteria, len(criteria.Not))
+		for i, not := range criteria.Not {
+			if encoded.Not[i], err = encodeSearchCriteria(not, charset); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if criteria.Or != nil {
+		encoded.Or = make([][2]*imap.SearchCriteria, len(criteria.Or))
+		for i, or := range criteria.Or {
+			for j := range or {
+				if encoded.Or[i][j], err = encodeSearchCriteria(or[j], charset); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	return &encoded, nil
 }
 
 // Search searches the mailbox for messages that match the given searching
@@ -119,43 +530,348 @@ func (c *Client) search(uid bool, criteria *imap.SearchCriteria) (ids []uint32,
 // the intersection (AND function) of all the messages that match those keys.
 // Criteria must be UTF-8 encoded. See RFC 3501 section 6.4.4 for a list of
 // searching criteria.
+//
+// If the server rejects UTF-8 with a BADCHARSET response, the search is retried
+// once with the first charset listed by the server that can encode the
+// criteria. Charsets other than US-ASCII require imap.CharsetEncoder.
+//
+// Relative times (Younger and Older) require the WITHIN capability. If the
+// server doesn't support it, they are converted to SINCE and BEFORE dates
+// computed from the local clock, which is less precise.
+//
+// The ModSeq criterion requires the CONDSTORE capability, otherwise
+// ErrCondStoreUnsupported is returned.
 func (c *Client) Search(criteria *imap.SearchCriteria) (seqNums []uint32, err error) {
-	return c.search(false, criteria)
+	return c.search(false, criteria, false)
 }
 
 // UidSearch is identical to Search, but UIDs are returned instead of message
 // sequence numbers.
 func (c *Client) UidSearch(criteria *imap.SearchCriteria) (uids []uint32, err error) {
-	return c.search(true, criteria)
+	return c.search(true, criteria, false)
 }
 
-func (c *Client) fetch(uid bool, seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+// SearchExtended is identical to Search, but only returns the items requested
+// with options, such as the number of matching messages, as defined in RFC
+// 4731. Options are imap.SearchReturn* values, if empty all matching messages
+// are returned as a sequence set.
+//
+// If the server doesn't support ESEARCH, a regular SEARCH is executed and the
+// result is computed locally.
+func (c *Client) SearchExtended(criteria *imap.SearchCriteria, options []string) (*imap.SearchResult, error) {
+	return c.searchExtended(false, criteria, options, nil)
+}
+
+// UidSearchExtended is identical to SearchExtended, but UIDs are returned
+// instead of message sequence numbers.
+func (c *Client) UidSearchExtended(criteria *imap.SearchCriteria, options []string) (*imap.SearchResult, error) {
+	return c.searchExtended(true, criteria, options, nil)
+}
+
+// SearchPartial is like SearchExtended, but only the matching messages in the
+// range r are returned, in the Partial field of the result, as defined in RFC
+// 9394. This allows paging through large results. Other options can be
+// requested along with PARTIAL.
+//
+// If the server doesn't support PARTIAL, all the matching messages are
+// requested and the range is applied locally.
+func (c *Client) SearchPartial(criteria *imap.SearchCriteria, r *imap.PartialRange, options []string) (*imap.SearchResult, error) {
+	return c.searchExtended(false, criteria, options, r)
+}
+
+// UidSearchPartial is identical to SearchPartial, but UIDs are returned
+// instead of message sequence numbers.
+func (c *Client) UidSearchPartial(criteria *imap.SearchCriteria, r *imap.PartialRange, options []string) (*imap.SearchResult, error) {
+	return c.searchExtended(true, criteria, options, r)
+}
+
+func (c *Client) searchExtended(uid bool, criteria *imap.SearchCriteria, options []string, partial *imap.PartialRange) (*imap.SearchResult, error) {
 	if c.State() != imap.SelectedState {
-		return ErrNoMailboxSelected
+		return nil, ErrNoMailboxSelected
 	}
 
-	defer close(ch)
+	esearch, err := c.Support("ESEARCH")
+	if err != nil {
+		return nil, err
+	}
+	if partial != nil && esearch {
+		if esearch, err = c.Support("PARTIAL"); err != nil {
+			return nil, err
+		}
+	}
+	if !esearch {
+		ids, err := c.search(uid, criteria, false)
+		if err != nil {
+			return nil, err
+		}
+		if partial == nil {
+			return imap.NewSearchResult(ids, options), nil
+		}
 
-	var cmd imap.Commander
-	cmd = &commands.Fetch{
-		SeqSet: seqset,
-		Items:  items,
+		// PARTIAL alone doesn't return all messages, unknown options are
+		// ignored by NewSearchResult
+		res := imap.NewSearchResult(ids, append(options[:len(options):len(options)], imap.SearchReturnPartial))
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		res.SetPartial(ids, partial)
+		return res, nil
+	}
+	if usesModSeq(criteria) {
+		if ok, err := c.Support("CONDSTORE"); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, ErrCondStoreUnsupported
+		}
+	}
+	if usesWithin(criteria) {
+		if within, err := c.Support("WITHIN"); err != nil {
+			return nil, err
+		} else if !within {
+			c.ErrorLog.Println("server doesn't support WITHIN, computing search dates from the local clock")
+			criteria = withinToDates(criteria, time.Now())
+		}
+	}
+
+	var cmd imap.Commander = &commands.Search{
+		Charset:  "UTF-8",
+		Criteria: criteria,
+		Return:   append([]string{}, options...),
+		Partial:  partial,
 	}
 	if uid {
 		cmd = &commands.Uid{Cmd: cmd}
 	}
 
-	res := &responses.Fetch{Messages: ch}
+	res := new(responses.ESearch)
+
+	status, err := c.executeRetry(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+
+	// Be lenient with servers which omit ESEARCH if no message matches
+	if res.Result == nil {
+		res.Result = new(imap.SearchResult)
+	}
+	return res.Result, nil
+}
+
+// SearchSave is identical to Search, but the server saves the result instead
+// of returning it, as defined in RFC 5182. The saved result can then be used
+// in subsequent commands with a sequence set whose Saved field is true, which
+// avoids sending huge sequence sets back to the server. The server must
+// support SEARCHRES, otherwise ErrSearchResUnsupported is returned.
+//
+// If the server couldn't save the result, ErrSearchNotSaved is returned.
+func (c *Client) SearchSave(criteria *imap.SearchCriteria) error {
+	return c.searchSave(false, criteria)
+}
+
+// UidSearchSave is identical to SearchSave, but criteria are evaluated as
+// with UidSearch.
+func (c *Client) UidSearchSave(criteria *imap.SearchCriteria) error {
+	return c.searchSave(true, criteria)
+}
+
+func (c *Client) searchSave(uid bool, criteria *imap.SearchCriteria) error {
+	if ok, err := c.Support("SEARCHRES"); err != nil {
+		return err
+	} else if !ok {
+		return ErrSearchResUnsupported
+	}
+
+	_, err := c.search(uid, criteria, true)
+	return err
+}
+
+// SearchContext is a search result kept updated by the server, as defined in
+// RFC 5267 section 4. Changes are delivered to Client.Updates as
+// *SearchUpdate values with the same Tag, until updates are cancelled with
+// CancelUpdate or the mailbox is closed.
+type SearchContext struct {
+	Tag    string
+	Result *imap.SearchResult
+}
+
+// SearchContext is like SearchExtended, but the server keeps the result
+// updated. The server must support CONTEXT=SEARCH, otherwise
+// ErrSearchContextUnsupported is returned.
+func (c *Client) SearchContext(criteria *imap.SearchCriteria, options []string) (*SearchContext, error) {
+	return c.searchContext(false, criteria, options)
+}
+
+// UidSearchContext is identical to SearchContext, but UIDs are returned
+// instead of message sequence numbers, in the result and in its updates.
+func (c *Client) UidSearchContext(criteria *imap.SearchCriteria, options []string) (*SearchContext, error) {
+	return c.searchContext(true, criteria, options)
+}
+
+func (c *Client) searchContext(uid bool, criteria *imap.SearchCriteria, options []string) (*SearchContext, error) {
+	if c.State() != imap.SelectedState {
+		return nil, ErrNoMailboxSelected
+	}
+	if ok, err := c.Support("CONTEXT=SEARCH"); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrSearchContextUnsupported
+	}
+
+	var cmd imap.Commander = &commands.Search{
+		Charset:  "UTF-8",
+		Criteria: criteria,
+		Return:   append(append([]string{}, options...), imap.SearchReturnUpdate),
+	}
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	res := new(responses.ESearch)
 
 	status, err := c.execute(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+
+	if res.Result == nil {
+		res.Result = new(imap.SearchResult)
+	}
+	return &SearchContext{Tag: status.Tag, Result: res.Result}, nil
+}
+
+// CancelUpdate stops the updates of search results kept updated, identified
+// by their tags.
+func (c *Client) CancelUpdate(tags ...string) error {
+	if c.State() != imap.SelectedState {
+		return ErrNoMailboxSelected
+	}
+
+	status, err := c.execute(&commands.CancelUpdate{Tags: tags}, nil)
 	if err != nil {
 		return err
 	}
 	return status.Err()
 }
 
+// ensureSavedSupported checks that the server supports SEARCHRES if seqset is
+// a reference to a saved search result.
+func (c *Client) ensureSavedSupported(seqset *imap.SeqSet) error {
+	if seqset == nil || !seqset.Saved {
+		return nil
+	}
+
+	if ok, err := c.Support("SEARCHRES"); err != nil {
+		return err
+	} else if !ok {
+		return ErrSearchResUnsupported
+	}
+	return nil
+}
+
+// seqSetErr is like status.Err, but returns ErrSearchNotSaved if seqset is a
+// reference to a saved search result which is not available anymore.
+func seqSetErr(seqset *imap.SeqSet, status *imap.StatusResp) error {
+	if seqset != nil && seqset.Saved && status.Code == imap.CodeNotSaved {
+		return ErrSearchNotSaved
+	}
+	return status.Err()
+}
+
+func (c *Client) fetch(uid bool, seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	return c.executeFetch(uid, &commands.Fetch{SeqSet: seqset, Items: items}, ch, nil, nil, nil)
+}
+
+// executeFetch executes a FETCH command. If h is not nil, it is given a chance
+// to handle responses before the FETCH response handler. If keep is not nil,
+// only messages for which it returns true are sent to ch. If stream is not nil,
+// body sections are streamed to its writers.
+func (c *Client) executeFetch(uid bool, fetch *commands.Fetch, ch chan *imap.Message, h responses.Handler, keep func(*imap.Message) bool, stream *bodyStream) error {
+	if c.State() != imap.SelectedState {
+		return ErrNoMailboxSelected
+	}
+	if err := c.ensureSavedSupported(fetch.SeqSet); err != nil {
+		return err
+	}
+
+	defer close(ch)
+
+	var cmd imap.Commander = fetch
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	// Servers can split the data of a message across multiple FETCH responses,
+	// merge them
+	fetched := make(chan *imap.Message)
+	merged := make(chan struct{})
+	go func() {
+		mergeMessages(fetched, ch, keep)
+		close(merged)
+	}()
+
+	// Once responses have been delivered, retrying would deliver them twice
+	delivered := false
+	res := &responses.Fetch{Messages: fetched}
+	chain := chainHandlers(h, res)
+	var handler responses.Handler = responses.HandlerFunc(func(resp imap.Resp) error {
+		err := chain.Handle(resp)
+		if err == nil {
+			delivered = true
+		}
+		return err
+	})
+	if stream != nil {
+		handler = &streamHandler{handler, stream}
+	}
+
+	status, err := c.executeRetryIf(cmd, handler, func() bool {
+		return !delivered
+	})
+	close(fetched)
+	<-merged
+	if err != nil {
+		return err
+	}
+	return seqSetErr(fetch.SeqSet, status)
+}
+
+// mergeMessages forwards messages from in to out. Consecutive messages with the
+// same sequence number (and the same UID, if present) are merged. If keep is
+// not nil, merged messages for which it returns false are dropped.
+func mergeMessages(in <-chan *imap.Message, out chan<- *imap.Message, keep func(*imap.Message) bool) {
+	send := func(msg *imap.Message) {
+		if keep == nil || keep(msg) {
+			out <- msg
+		}
+	}
+
+	var pending *imap.Message
+	for msg := range in {
+		if pending != nil && pending.SeqNum == msg.SeqNum && (pending.Uid == 0 || msg.Uid == 0 || pending.Uid == msg.Uid) {
+			pending.Merge(msg)
+			continue
+		}
+
+		if pending != nil {
+			send(pending)
+		}
+		pending = msg
+	}
+
+	if pending != nil {
+		send(pending)
+	}
+}
+
 // Fetch retrieves data associated with a message in the mailbox. See RFC 3501
 // section 6.4.5 for a list of items that can be requested.
+//
+// Messages are sent to ch as they are received. Servers are allowed to split
+// the data of a message across multiple FETCH responses: consecutive responses
+// for the same message are merged in a single *imap.Message, which is sent
+// once a response for another message is received or the command completes.
 func (c *Client) Fetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
 	return c.fetch(false, seqset, items, ch)
 }
@@ -166,9 +882,209 @@ func (c *Client) UidFetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *
 	return c.fetch(true, seqset, items, ch)
 }
 
+// A BodyWriterFunc returns the writer to which the contents of a body section
+// of the message with the sequence number seqNum are streamed. size is the
+// length of the section in bytes. If it returns nil, the section is kept in
+// memory as usual.
+type BodyWriterFunc func(seqNum uint32, section *imap.BodySectionName, size int64) io.Writer
+
+// bodyStream holds the state of a FetchStream command.
+type bodyStream struct {
+	f BodyWriterFunc
+
+	locker sync.Mutex
+	// The first error returned by a writer.
+	err error
+}
+
+func (s *bodyStream) setErr(err error) {
+	s.locker.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.locker.Unlock()
+}
+
+// streamHandler is the response handler of a command whose body sections are
+// streamed. The stream is installed by executeLocked, once the command holds
+// the command queue.
+type streamHandler struct {
+	responses.Handler
+	stream *bodyStream
+}
+
+// bodyStreamWriter writes a body section to the writer returned by a
+// BodyWriterFunc. Once the writer has failed, the rest of the section is
+// discarded, so that the response can still be read.
+type bodyStreamWriter struct {
+	s      *bodyStream
+	w      io.Writer
+	failed bool
+}
+
+func (w *bodyStreamWriter) Write(b []byte) (int, error) {
+	if w.failed {
+		return len(b), nil
+	}
+	if _, err := w.w.Write(b); err != nil {
+		w.failed = true
+		w.s.setErr(err)
+	}
+	return len(b), nil
+}
+
+// streamLiteral is the StreamLiteral function of the connection reader. It
+// returns a writer for body sections in FETCH responses received while a
+// FetchStream command is in progress.
+func (c *Client) streamLiteral(line []interface{}, name string, size int64) io.Writer {
+	c.locker.Lock()
+	s := c.bodyStream
+	c.locker.Unlock()
+	if s == nil || len(line) != 2 {
+		return nil
+	}
+
+	if respName, ok := line[1].(string); !ok || !strings.EqualFold(respName, "FETCH") {
+		return nil
+	}
+	seqNum, err := imap.ParseNumber(line[0])
+	if err != nil {
+		return nil
+	}
+	section, err := imap.ParseBodySectionName(imap.FetchItem(name))
+	if err != nil {
+		return nil
+	}
+
+	w := s.f(seqNum, section, size)
+	if w == nil {
+		return nil
+	}
+	return &bodyStreamWriter{s: s, w: w}
+}
+
+func (c *Client) fetchStream(uid bool, seqset *imap.SeqSet, items []imap.FetchItem, f BodyWriterFunc, ch chan *imap.Message) error {
+	s := &bodyStream{f: f}
+	cmd := &commands.Fetch{SeqSet: seqset, Items: items}
+	if err := c.executeFetch(uid, cmd, ch, nil, nil, s); err != nil {
+		return err
+	}
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.err
+}
+
+// FetchStream is identical to Fetch, but the contents of body sections are
+// copied to the writers returned by f as they are received, instead of being
+// kept in memory. This allows to fetch messages larger than the available
+// memory. Streamed sections are present in the Body of the messages sent to
+// ch, with a nil literal.
+//
+// Messages are identified by sequence number, since their UID may be received
+// after their body. f is called by the goroutine reading responses: it must
+// not execute commands, and writers must not block for long since no other
+// response can be read in the meantime. If a writer returns an error, the rest
+// of the section is discarded and the first error is returned once the command
+// has completed.
+func (c *Client) FetchStream(seqset *imap.SeqSet, items []imap.FetchItem, f BodyWriterFunc, ch chan *imap.Message) error {
+	return c.fetchStream(false, seqset, items, f, ch)
+}
+
+// UidFetchStream is identical to FetchStream, but seqset is interpreted as
+// containing unique identifiers instead of message sequence numbers.
+func (c *Client) UidFetchStream(seqset *imap.SeqSet, items []imap.FetchItem, f BodyWriterFunc, ch chan *imap.Message) error {
+	return c.fetchStream(true, seqset, items, f, ch)
+}
+
+func (c *Client) fetchChangedSince(uid bool, seqset *imap.SeqSet, modSeq uint64, items []imap.FetchItem, ch chan *imap.Message) error {
+	if ok, err := c.Support("CONDSTORE"); err != nil {
+		return err
+	} else if !ok {
+		return ErrCondStoreUnsupported
+	}
+
+	cmd := &commands.Fetch{
+		SeqSet: seqset,
+		// RFC 7162 section 3.1.4.1: MODSEQ is implicitly requested
+		Items:        withFetchItem(items, imap.FetchModSeq),
+		ChangedSince: modSeq,
+	}
+	return c.executeFetch(uid, cmd, ch, nil, nil, nil)
+}
+
+// withFetchItem returns items with item appended if it's missing. items is
+// never modified.
+func withFetchItem(items []imap.FetchItem, item imap.FetchItem) []imap.FetchItem {
+	for _, it := range items {
+		if it == item {
+			return items
+		}
+	}
+	return append(append([]imap.FetchItem(nil), items...), item)
+}
+
+// FetchChangedSince is identical to Fetch, but only retrieves messages whose
+// mod-sequence is greater than modSeq, with the CHANGEDSINCE modifier defined
+// in RFC 7162. The MODSEQ item is always fetched. The server must support
+// CONDSTORE, otherwise ErrCondStoreUnsupported is returned. Using
+// CHANGEDSINCE enables CONDSTORE for the rest of the session.
+func (c *Client) FetchChangedSince(seqset *imap.SeqSet, modSeq uint64, items []imap.FetchItem, ch chan *imap.Message) error {
+	return c.fetchChangedSince(false, seqset, modSeq, items, ch)
+}
+
+// UidFetchChangedSince is identical to FetchChangedSince, but seqset is
+// interpreted as containing unique identifiers instead of message sequence
+// numbers.
+func (c *Client) UidFetchChangedSince(seqset *imap.SeqSet, modSeq uint64, items []imap.FetchItem, ch chan *imap.Message) error {
+	return c.fetchChangedSince(true, seqset, modSeq, items, ch)
+}
+
+// UidFetchVanished is identical to UidFetchChangedSince, but also returns the
+// UIDs in seqset of the messages expunged since modSeq, with the VANISHED
+// modifier defined in RFC 7162 section 3.2.6. QRESYNC must have been enabled,
+// for instance with SelectQResync, otherwise ErrQResyncUnsupported is
+// returned.
+func (c *Client) UidFetchVanished(seqset *imap.SeqSet, modSeq uint64, items []imap.FetchItem, ch chan *imap.Message) (*imap.SeqSet, error) {
+	c.locker.Lock()
+	enabled := c.enabled["QRESYNC"]
+	c.locker.Unlock()
+	if !enabled {
+		return nil, ErrQResyncUnsupported
+	}
+
+	cmd := &commands.Fetch{
+		SeqSet:       seqset,
+		Items:        withFetchItem(items, imap.FetchModSeq),
+		ChangedSince: modSeq,
+		Vanished:     true,
+	}
+
+	vanished := new(imap.SeqSet)
+	res := &responses.Vanished{}
+	h := responses.HandlerFunc(func(resp imap.Resp) error {
+		if err := res.Handle(resp); err != nil {
+			return err
+		}
+		vanished.AddSet(res.Uids)
+		return nil
+	})
+
+	if err := c.executeFetch(true, cmd, ch, h, nil, nil); err != nil {
+		return nil, err
+	}
+	return vanished, nil
+}
+
 func (c *Client) store(uid bool, seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error {
-	if c.State() != imap.SelectedState {
-		return ErrNoMailboxSelected
+	if err := c.ensureWritable(); err != nil {
+		return err
+	}
+	if err := c.ensureSavedSupported(seqset); err != nil {
+		return err
+	}
+	if _, _, err := imap.ParseFlagsOp(item); err == nil && hasRecentFlag(value) {
+		return ErrRecentFlag
 	}
 
 	// If ch is nil, the updated values are data which will be lost, so don't
@@ -200,12 +1116,36 @@ func (c *Client) store(uid bool, seqset *imap.SeqSet, item imap.StoreItem, value
 	if err != nil {
 		return err
 	}
-	return status.Err()
+	return seqSetErr(seqset, status)
+}
+
+// hasRecentFlag checks if a list of flags contains \Recent.
+func hasRecentFlag(value interface{}) bool {
+	var flags []interface{}
+	switch value := value.(type) {
+	case []interface{}:
+		flags = value
+	case []string:
+		for _, f := range value {
+			flags = append(flags, f)
+		}
+	default:
+		flags = []interface{}{value}
+	}
+
+	for _, f := range flags {
+		if s, ok := f.(string); ok && imap.CanonicalFlag(s) == imap.RecentFlag {
+			return true
+		}
+	}
+	return false
 }
 
 // Store alters data associated with a message in the mailbox. If ch is not nil,
 // the updated value of the data will be sent to this channel. See RFC 3501
-// section 6.4.6 for a list of items that can be updated.
+// section 6.4.6 for a list of items that can be updated. ErrMailboxReadOnly is
+// returned if the mailbox is opened in read-only mode. The \Recent flag is set
+// by the server and cannot be stored, ErrRecentFlag is returned in this case.
 func (c *Client) Store(seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error {
 	return c.store(false, seqset, item, value, ch)
 }
@@ -216,9 +1156,36 @@ func (c *Client) UidStore(seqset *imap.SeqSet, item imap.StoreItem, value interf
 	return c.store(true, seqset, item, value, ch)
 }
 
-func (c *Client) copy(uid bool, seqset *imap.SeqSet, dest string) error {
+func (c *Client) setAnnotations(uid bool, seqset *imap.SeqSet, annotations map[string]map[string]*string) error {
+	if ok, err := c.Support("ANNOTATE-EXPERIMENT-1"); err != nil {
+		return err
+	} else if !ok {
+		return ErrAnnotateUnsupported
+	}
+
+	return c.store(uid, seqset, imap.StoreAnnotation, imap.FormatAnnotationValues(annotations), nil)
+}
+
+// SetAnnotations changes the annotations of messages, as defined in RFC 5257
+// section 4.3. Annotations map entry names to attribute values, e.g.
+// imap.AnnotationValuePriv, attributes with a nil value are removed.
+// Annotations can be fetched with imap.AnnotationItem.
+func (c *Client) SetAnnotations(seqset *imap.SeqSet, annotations map[string]map[string]*string) error {
+	return c.setAnnotations(false, seqset, annotations)
+}
+
+// UidSetAnnotations is identical to SetAnnotations, but seqset is interpreted
+// as containing unique identifiers instead of message sequence numbers.
+func (c *Client) UidSetAnnotations(seqset *imap.SeqSet, annotations map[string]map[string]*string) error {
+	return c.setAnnotations(true, seqset, annotations)
+}
+
+func (c *Client) copy(uid bool, seqset *imap.SeqSet, dest string) (*imap.CopyUid, error) {
 	if c.State() != imap.SelectedState {
-		return ErrNoMailboxSelected
+		return nil, ErrNoMailboxSelected
+	}
+	if err := c.ensureSavedSupported(seqset); err != nil {
+		return nil, err
 	}
 
 	var cmd imap.Commander = &commands.Copy{
@@ -231,19 +1198,293 @@ func (c *Client) copy(uid bool, seqset *imap.SeqSet, dest string) error {
 
 	status, err := c.execute(cmd, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return status.Err()
+	if err := seqSetErr(seqset, status); err != nil {
+		return nil, err
+	}
+
+	if status.Code != imap.CodeCopyUid {
+		return nil, nil
+	}
+	data := new(imap.CopyUid)
+	if err := data.Parse(status.Arguments); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
 // Copy copies the specified message(s) to the end of the specified destination
 // mailbox.
 func (c *Client) Copy(seqset *imap.SeqSet, dest string) error {
-	return c.copy(false, seqset, dest)
+	_, err := c.copy(false, seqset, dest)
+	return err
 }
 
 // UidCopy is identical to Copy, but seqset is interpreted as containing unique
 // identifiers instead of message sequence numbers.
 func (c *Client) UidCopy(seqset *imap.SeqSet, dest string) error {
+	_, err := c.copy(true, seqset, dest)
+	return err
+}
+
+func (c *Client) move(uid bool, seqset *imap.SeqSet, dest string) (*imap.CopyUid, error) {
+	if c.State() != imap.SelectedState {
+		return nil, ErrNoMailboxSelected
+	}
+	if move, err := c.Support("MOVE"); err != nil {
+		return nil, err
+	} else if !move {
+		if rev2, err := c.Support(imap.IMAP4rev2); err != nil {
+			return nil, err
+		} else if !rev2 {
+			return nil, ErrMoveUnsupported
+		}
+	}
+	if err := c.ensureSavedSupported(seqset); err != nil {
+		return nil, err
+	}
+
+	var cmd imap.Commander = &commands.Move{
+		SeqSet:  seqset,
+		Mailbox: dest,
+	}
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	// With UIDPLUS, COPYUID is sent in an untagged OK response, see RFC 6851
+	// section 4.3
+	var data *imap.CopyUid
+	h := responses.HandlerFunc(func(resp imap.Resp) error {
+		res, ok := resp.(*imap.StatusResp)
+		if !ok || res.Tag != "*" || res.Code != imap.CodeCopyUid {
+			return responses.ErrUnhandled
+		}
+		data = new(imap.CopyUid)
+		return data.Parse(res.Arguments)
+	})
+
+	status, err := c.execute(cmd, h)
+	if err != nil {
+		return nil, err
+	}
+	if err := seqSetErr(seqset, status); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Move moves the specified message(s) to the end of the specified destination
+// mailbox, as defined in RFC 6851. The moved messages are expunged from the
+// selected mailbox. If the server supports UIDPLUS, the UIDs of the moved
+// messages are returned, otherwise the returned CopyUid is nil.
+func (c *Client) Move(seqset *imap.SeqSet, dest string) (*imap.CopyUid, error) {
+	return c.move(false, seqset, dest)
+}
+
+// UidMove is identical to Move, but seqset is interpreted as containing unique
+// identifiers instead of message sequence numbers.
+func (c *Client) UidMove(seqset *imap.SeqSet, dest string) (*imap.CopyUid, error) {
+	return c.move(true, seqset, dest)
+}
+
+func (c *Client) replace(uid bool, id uint32, dest string, msg *imap.AppendMessage) (*imap.AppendUid, error) {
+	if err := c.ensureWritable(); err != nil {
+		return nil, err
+	}
+	if ok, err := c.Support("REPLACE"); err != nil {
+		return nil, err
+	} else if !ok {
+		return c.replaceFallback(uid, id, dest, msg)
+	}
+	if err := c.checkAppend(dest, []*imap.AppendMessage{msg}); err != nil {
+		return nil, err
+	}
+
+	var cmd imap.Commander = &commands.Replace{
+		SeqNum:  id,
+		Mailbox: dest,
+		Message: msg,
+	}
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	// With UIDPLUS, APPENDUID is sent in an untagged OK response, see RFC 8508
+	// section 3.3
+	var data *imap.AppendUid
+	h := responses.HandlerFunc(func(resp imap.Resp) error {
+		res, ok := resp.(*imap.StatusResp)
+		if !ok || res.Tag != "*" || res.Code != imap.CodeAppendUid {
+			return responses.ErrUnhandled
+		}
+		data = new(imap.AppendUid)
+		return data.Parse(res.Arguments)
+	})
+
+	status, err := c.execute(cmd, h)
+	if err != nil {
+		return nil, err
+	}
+	if err := status.Err(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// replaceFallback replaces a message without REPLACE: the new message is
+// appended and the old one is marked as deleted. With UIDPLUS, a message
+// identified by its UID is also expunged.
+func (c *Client) replaceFallback(uid bool, id uint32, dest string, msg *imap.AppendMessage) (*imap.AppendUid, error) {
+	data, err := c.AppendMultipleWithUid(dest, []*imap.AppendMessage{msg})
+	if err != nil {
+		return nil, err
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(id)
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	if err := c.store(uid, seqset, item, []interface{}{imap.DeletedFlag}, nil); err != nil {
+		return data, err
+	}
+
+	if !uid {
+		return data, nil
+	}
+	if ok, err := c.Support("UIDPLUS"); err != nil || !ok {
+		return data, err
+	}
+	return data, c.UidExpunge(seqset, nil)
+}
+
+// Replace replaces the message with the sequence number seqNum by msg, which
+// is appended to dest, as defined in RFC 8508. If the server supports
+// UIDPLUS, the UID of the new message is returned, otherwise the returned
+// AppendUid is nil.
+//
+// If the server doesn't support REPLACE, msg is appended and the old message
+// is marked as deleted, but not expunged. This isn't atomic.
+func (c *Client) Replace(seqNum uint32, dest string, msg *imap.AppendMessage) (*imap.AppendUid, error) {
+	return c.replace(false, seqNum, dest, msg)
+}
+
+// UidReplace is identical to Replace, but the message is identified by its
+// UID. If the server doesn't support REPLACE but supports UIDPLUS, the old
+// message is expunged with UID EXPUNGE.
+func (c *Client) UidReplace(uid uint32, dest string, msg *imap.AppendMessage) (*imap.AppendUid, error) {
+	return c.replace(true, uid, dest, msg)
+}
+
+// CopyWithUid is like Copy, but also returns the UIDs of the copied messages
+// and of their copies, as defined in RFC 4315. If the server doesn't support
+// UIDPLUS or didn't return them, a nil CopyUid is returned.
+func (c *Client) CopyWithUid(seqset *imap.SeqSet, dest string) (*imap.CopyUid, error) {
+	return c.copy(false, seqset, dest)
+}
+
+// UidCopyWithUid is identical to CopyWithUid, but seqset is interpreted as
+// containing unique identifiers instead of message sequence numbers.
+func (c *Client) UidCopyWithUid(seqset *imap.SeqSet, dest string) (*imap.CopyUid, error) {
 	return c.copy(true, seqset, dest)
 }
+
+// FetchWithUid is identical to Fetch, but the UID of each message is always
+// requested, even if imap.FetchUid is missing from items. Every message sent
+// to ch has a non-zero Uid: messages for which the server didn't send a UID
+// are dropped.
+func (c *Client) FetchWithUid(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	cmd := &commands.Fetch{
+		SeqSet: seqset,
+		Items:  withFetchItem(items, imap.FetchUid),
+	}
+	return c.executeFetch(false, cmd, ch, nil, func(msg *imap.Message) bool {
+		if msg.Uid == 0 {
+			c.ErrorLog.Printf("server didn't send the UID of message %v", msg.SeqNum)
+			return false
+		}
+		return true
+	}, nil)
+}
+
+// SeqToUid returns the UIDs of the messages with the provided sequence
+// numbers, as a map from sequence numbers to UIDs. Messages which don't exist
+// are missing from the map.
+func (c *Client) SeqToUid(seqNums []uint32) (map[uint32]uint32, error) {
+	if c.State() != imap.SelectedState {
+		return nil, ErrNoMailboxSelected
+	}
+
+	uids := make(map[uint32]uint32, len(seqNums))
+	seqset := new(imap.SeqSet)
+	for _, seqNum := range seqNums {
+		if seqNum > 0 {
+			seqset.AddNum(seqNum)
+		}
+	}
+	if seqset.Empty() {
+		return uids, nil
+	}
+
+	ch := make(chan *imap.Message, 10)
+	done := make(chan struct{})
+	go func() {
+		for msg := range ch {
+			uids[msg.SeqNum] = msg.Uid
+		}
+		close(done)
+	}()
+
+	err := c.FetchWithUid(seqset, []imap.FetchItem{imap.FetchUid}, ch)
+	<-done
+	return uids, err
+}
+
+// FetchHeaders retrieves the header of messages, already parsed with
+// imap.ParseMessageHeader. If fields is not empty, only the listed header
+// fields are requested. The \Seen flag of the messages is left unchanged.
+//
+// Messages whose header cannot be parsed are dropped and the error is logged
+// to ErrorLog.
+func (c *Client) FetchHeaders(seqset *imap.SeqSet, fields []string, ch chan *imap.MessageHeaders) error {
+	defer close(ch)
+
+	section := &imap.BodySectionName{
+		BodyPartName: imap.BodyPartName{
+			Specifier: imap.HeaderSpecifier,
+			Fields:    fields,
+		},
+		Peek: true,
+	}
+	items := []imap.FetchItem{imap.FetchUid, section.FetchItem()}
+
+	messages := make(chan *imap.Message, 10)
+	done := make(chan struct{})
+	go func() {
+		for msg := range messages {
+			var literal imap.Literal
+			for section, l := range msg.Body {
+				if section.Specifier == imap.HeaderSpecifier {
+					literal = l
+					break
+				}
+			}
+			if literal == nil {
+				continue
+			}
+
+			h, err := imap.ParseMessageHeader(literal)
+			if err != nil {
+				c.ErrorLog.Printf("cannot parse header of message %v: %v", msg.SeqNum, err)
+				continue
+			}
+
+			ch <- &imap.MessageHeaders{SeqNum: msg.SeqNum, Uid: msg.Uid, Header: h}
+		}
+		close(done)
+	}()
+
+	err := c.Fetch(seqset, items, messages)
+	<-done
+	return err
+}
@@ -1,9 +1,14 @@
 package client
 
 import (
+	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
 	"net/textproto"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -56,10 +61,10 @@ func TestClient_Close(t *testing.T) {
 	}
 
 	if c.State() != imap.AuthenticatedState {
-		t.Errorf("Bad state: %v", c.State)
+		t.Errorf("Bad state: %v", c.State())
 	}
 	if c.Mailbox() != nil {
-		t.Errorf("Client selected mailbox is not nil: %v", c.Mailbox)
+		t.Errorf("Client selected mailbox is not nil: %v", c.Mailbox())
 	}
 }
 
@@ -144,258 +149,1796 @@ func TestClient_Search(t *testing.T) {
 	}
 }
 
+func TestClient_Search_ESearch(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	criteria := &imap.SearchCriteria{WithFlags: []string{imap.DeletedFlag}}
+
+	done := make(chan error, 1)
+	var results []uint32
+	go func() {
+		var err error
+		results, err = c.Search(criteria)
+		done <- err
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("* ESEARCH (TAG \"" + tag + "\") ALL 2,4:6\r\n")
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Search() = %v", err)
+	}
+
+	want := []uint32{2, 4, 5, 6}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("c.Search() = %v, want %v", results, want)
+	}
+}
+
+func TestClient_SearchExtended(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ESEARCH"})
+	setClientState(c, imap.SelectedState, nil)
+
+	criteria := &imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}}
+
+	done := make(chan error, 1)
+	var result *imap.SearchResult
+	go func() {
+		var err error
+		result, err = c.UidSearchExtended(criteria, []string{imap.SearchReturnMin, imap.SearchReturnAll, imap.SearchReturnCount})
+		done <- err
+	}()
+
+	wantCmd := "UID SEARCH RETURN (MIN ALL COUNT) CHARSET UTF-8 UNSEEN"
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	s.WriteString("* ESEARCH (TAG \"" + tag + "\") UID MIN 2 ALL 2,10:11 COUNT 3\r\n")
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidSearchExtended() = %v", err)
+	}
+
+	all, _ := imap.ParseSeqSet("2,10:11")
+	want := &imap.SearchResult{Min: 2, All: all, Count: 3}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("c.UidSearchExtended() = %+v, want %+v", result, want)
+	}
+}
+
+func TestClient_SearchExtended_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1"})
+	setClientState(c, imap.SelectedState, nil)
+
+	criteria := &imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}}
+
+	done := make(chan error, 1)
+	var result *imap.SearchResult
+	go func() {
+		var err error
+		result, err = c.SearchExtended(criteria, []string{imap.SearchReturnMax, imap.SearchReturnCount})
+		done <- err
+	}()
+
+	wantCmd := "SEARCH CHARSET UTF-8 UNSEEN"
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	s.WriteString("* SEARCH 2 84 882\r\n")
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.SearchExtended() = %v", err)
+	}
+
+	want := &imap.SearchResult{Max: 882, Count: 3}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("c.SearchExtended() = %+v, want %+v", result, want)
+	}
+}
+
+func TestClient_UidSearchPartial(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ESEARCH", "PARTIAL"})
+	setClientState(c, imap.SelectedState, nil)
+
+	criteria := &imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}}
+	r := &imap.PartialRange{First: -1, Last: -100}
+
+	done := make(chan error, 1)
+	var result *imap.SearchResult
+	go func() {
+		var err error
+		result, err = c.UidSearchPartial(criteria, r, []string{imap.SearchReturnCount})
+		done <- err
+	}()
+
+	wantCmd := "UID SEARCH RETURN (COUNT PARTIAL -1:-100) CHARSET UTF-8 UNSEEN"
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	s.WriteString("* ESEARCH (TAG \"" + tag + "\") UID COUNT 300 PARTIAL (-1:-100 400:499)\r\n")
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidSearchPartial() = %v", err)
+	}
+
+	partial, _ := imap.ParseSeqSet("400:499")
+	want := &imap.SearchResult{Count: 300, PartialRange: r, Partial: partial}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("c.UidSearchPartial() = %+v, want %+v", result, want)
+	}
+}
+
+func TestClient_SearchPartial_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ESEARCH"})
+	setClientState(c, imap.SelectedState, nil)
+
+	criteria := &imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}}
+	r := &imap.PartialRange{First: 2, Last: 3}
+
+	done := make(chan error, 1)
+	var result *imap.SearchResult
+	go func() {
+		var err error
+		result, err = c.SearchPartial(criteria, r, nil)
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if wantCmd := "SEARCH CHARSET UTF-8 UNSEEN"; cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	s.WriteString("* SEARCH 882 2 84\r\n")
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.SearchPartial() = %v", err)
+	}
+
+	partial, _ := imap.ParseSeqSet("84,882")
+	want := &imap.SearchResult{PartialRange: r, Partial: partial}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("c.SearchPartial() = %+v, want %+v", result, want)
+	}
+}
+
+func TestClient_UidSearchContext(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ESEARCH", "CONTEXT=SEARCH"})
+	setClientState(c, imap.SelectedState, nil)
+
+	criteria := &imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}}
+
+	done := make(chan error, 1)
+	var sc *SearchContext
+	go func() {
+		var err error
+		sc, err = c.UidSearchContext(criteria, []string{imap.SearchReturnCount})
+		done <- err
+	}()
+
+	wantCmd := "UID SEARCH RETURN (COUNT UPDATE) CHARSET UTF-8 UNSEEN"
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	s.WriteString("* ESEARCH (TAG \"" + tag + "\") UID COUNT 2\r\n")
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidSearchContext() = %v", err)
+	}
+	if sc.Tag != tag || sc.Result.Count != 2 {
+		t.Errorf("c.UidSearchContext() = %+v, want tag %v and count 2", sc, tag)
+	}
+
+	updates := make(chan interface{}, 1)
+	c.Updates = updates
+
+	s.WriteString("* ESEARCH (TAG \"" + tag + "\") UID REMOVEFROM (0 3) ADDTO (0 5:6)\r\n")
+
+	update, ok := (<-updates).(*SearchUpdate)
+	if !ok {
+		t.Fatalf("Invalid update: %v", update)
+	}
+	removed, _ := imap.ParseSeqSet("3")
+	added, _ := imap.ParseSeqSet("5:6")
+	want := &SearchUpdate{
+		Tag: tag,
+		Uid: true,
+		Result: &imap.SearchResult{
+			RemoveFrom: []imap.SearchContextUpdate{{Ids: removed}},
+			AddTo:      []imap.SearchContextUpdate{{Ids: added}},
+		},
+	}
+	if !reflect.DeepEqual(update, want) {
+		t.Errorf("Invalid update: got %+v, want %+v", update, want)
+	}
+
+	go func() {
+		done <- c.CancelUpdate(sc.Tag)
+	}()
+
+	tag, cmd = s.ScanCmd()
+	if wantCmd := "CANCELUPDATE \"" + sc.Tag + "\""; cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+	s.WriteString(tag + " OK CANCELUPDATE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.CancelUpdate() = %v", err)
+	}
+}
+
+func TestClient_SearchContext_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ESEARCH"})
+	setClientState(c, imap.SelectedState, nil)
+
+	criteria := &imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}}
+	if _, err := c.SearchContext(criteria, nil); err != ErrSearchContextUnsupported {
+		t.Fatalf("c.SearchContext() = %v, want %v", err, ErrSearchContextUnsupported)
+	}
+}
+
+func TestClient_Search_ModSeq(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "CONDSTORE"})
+
+	criteria := &imap.SearchCriteria{ModSeq: 620162338}
+
+	done := make(chan error, 1)
+	var results []uint32
+	go func() {
+		var err error
+		results, err = c.Search(criteria)
+		done <- err
+	}()
+
+	wantCmd := `SEARCH CHARSET UTF-8 MODSEQ 620162338`
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	s.WriteString("* SEARCH 2 5 6 7 11 12 18 19 20 23 (MODSEQ 917162500)\r\n")
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Search() = %v", err)
+	}
+
+	want := []uint32{2, 5, 6, 7, 11, 12, 18, 19, 20, 23}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("c.Search() = %v, want %v", results, want)
+	}
+}
+
+func TestClient_Search_ModSeqUnsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	criteria := &imap.SearchCriteria{
+		Not: []*imap.SearchCriteria{{ModSeq: 620162338}},
+	}
+	if _, err := c.Search(criteria); err != ErrCondStoreUnsupported {
+		t.Fatalf("c.Search() = %v, want %v", err, ErrCondStoreUnsupported)
+	}
+}
+
 func TestClient_Search_Uid(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
-	setClientState(c, imap.SelectedState, nil)
+	setClientState(c, imap.SelectedState, nil)
+
+	criteria := &imap.SearchCriteria{
+		WithoutFlags: []string{imap.DeletedFlag},
+	}
+
+	done := make(chan error, 1)
+	var results []uint32
+	go func() {
+		var err error
+		results, err = c.UidSearch(criteria)
+		done <- err
+	}()
+
+	wantCmd := "UID SEARCH CHARSET UTF-8 UNDELETED"
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	s.WriteString("* SEARCH 1 78 2010\r\n")
+	s.WriteString(tag + " OK UID SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Search() = %v", err)
+	}
+
+	want := []uint32{1, 78, 2010}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("c.Search() = %v, want %v", results, want)
+	}
+}
+
+func TestClient_Search_HugeSeqSet(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	// Odd UIDs can't be merged into ranges
+	remaining := make(map[uint32]bool)
+	criteria := &imap.SearchCriteria{Uid: new(imap.SeqSet)}
+	for uid := uint32(1); uid < 20000; uid += 2 {
+		criteria.Uid.AddNum(uid)
+		remaining[uid] = true
+	}
+
+	done := make(chan error, 1)
+	var results []uint32
+	go func() {
+		var err error
+		results, err = c.UidSearch(criteria)
+		done <- err
+	}()
+
+	var want []uint32
+	for n := 0; len(remaining) > 0; n++ {
+		tag, cmd := s.ScanCmd()
+		if len(tag)+len(cmd)+3 > 8192 {
+			t.Fatalf("client sent a %v bytes long command line", len(tag)+len(cmd)+3)
+		}
+		if !strings.HasPrefix(cmd, "UID SEARCH CHARSET UTF-8 UID ") {
+			t.Fatalf("client sent command %v", cmd)
+		}
+
+		set, err := imap.ParseSeqSet(strings.TrimPrefix(cmd, "UID SEARCH CHARSET UTF-8 UID "))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, seq := range set.Set {
+			for uid := seq.Start; uid <= seq.Stop; uid++ {
+				if !remaining[uid] {
+					t.Fatalf("UID %v requested twice or not in the original set", uid)
+				}
+				delete(remaining, uid)
+			}
+		}
+
+		// Answer with the first UID of each search
+		first := set.Set[0].Start
+		want = append(want, first)
+		s.WriteString("* SEARCH " + strconv.Itoa(int(first)) + "\r\n")
+		s.WriteString(tag + " OK UID SEARCH completed\r\n")
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidSearch() = %v", err)
+	}
+
+	if len(want) < 2 {
+		t.Fatalf("Expected the search to be split, got %v commands", len(want))
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("c.UidSearch() = %v, want %v", results, want)
+	}
+}
+
+func TestClient_Search_LongString(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	value := strings.Repeat("a", 2000)
+	criteria := &imap.SearchCriteria{Body: []string{value}}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Search(criteria)
+		done <- err
+	}()
+
+	wantCmd := "SEARCH CHARSET UTF-8 BODY {2000}"
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	s.WriteString("+ send literal\r\n")
+
+	if line := s.ScanLine(); line != value {
+		t.Fatalf("Bad literal: %v", line)
+	}
+
+	s.WriteString("* SEARCH 1\r\n")
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Search() = %v", err)
+	}
+}
+
+func TestClient_Search_Within(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "WITHIN"})
+
+	criteria := &imap.SearchCriteria{
+		Younger: 24 * time.Hour,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Search(criteria)
+		done <- err
+	}()
+
+	wantCmd := "SEARCH CHARSET UTF-8 YOUNGER 86400"
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Search() = %v", err)
+	}
+}
+
+func TestClient_Search_WithinUnsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	criteria := &imap.SearchCriteria{
+		Not: []*imap.SearchCriteria{{
+			Older: 48 * time.Hour,
+		}},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Search(criteria)
+		done <- err
+	}()
+
+	before := time.Now().Add(-48 * time.Hour).Format("2-Jan-2006")
+	wantCmd := `SEARCH CHARSET UTF-8 NOT (BEFORE "` + before + `")`
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Search() = %v", err)
+	}
+
+	if criteria.Not[0].Older != 48*time.Hour || !criteria.Not[0].Before.IsZero() {
+		t.Error("Search criteria have been modified")
+	}
+}
+
+func latin1Encoder(charset, s string) (string, error) {
+	if charset != "iso-8859-1" {
+		return "", errors.New("unsupported charset")
+	}
+
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xff {
+			return "", errors.New("cannot encode character")
+		}
+		b = append(b, byte(r))
+	}
+	return string(b), nil
+}
+
+func TestClient_Search_BadCharset(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	imap.CharsetEncoder = latin1Encoder
+	defer func() {
+		imap.CharsetEncoder = nil
+	}()
+
+	criteria := &imap.SearchCriteria{
+		Body: []string{"café"},
+	}
+
+	done := make(chan error, 1)
+	var results []uint32
+	go func() {
+		var err error
+		results, err = c.Search(criteria)
+		done <- err
+	}()
+
+	wantCmd := "SEARCH CHARSET UTF-8 BODY {5}"
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+	s.WriteString("+ send literal\r\n")
+	if line := s.ScanLine(); line != "café" {
+		t.Fatalf("client sent literal %q, want %q", line, "café")
+	}
+
+	s.WriteString(tag + " NO [BADCHARSET (US-ASCII ISO-8859-1)] UTF-8 not supported\r\n")
+
+	wantCmd = "SEARCH CHARSET ISO-8859-1 BODY {4}"
+	tag, cmd = s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+	s.WriteString("+ send literal\r\n")
+	if line := s.ScanLine(); line != "caf\xe9" {
+		t.Fatalf("client sent literal %q, want %q", line, "caf\xe9")
+	}
+
+	s.WriteString("* SEARCH 3\r\n")
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Search() = %v", err)
+	}
+
+	want := []uint32{3}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("c.Search() = %v, want %v", results, want)
+	}
+
+	// The provided criteria must not have been modified
+	if criteria.Body[0] != "café" {
+		t.Errorf("Search criteria have been modified: %q", criteria.Body[0])
+	}
+}
+
+func TestClient_Search_BadCharsetAscii(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	criteria := &imap.SearchCriteria{
+		Text: []string{"gopher"},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Search(criteria)
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "SEARCH CHARSET UTF-8 TEXT gopher" {
+		t.Fatalf("client sent command %v, want %v", cmd, "SEARCH CHARSET UTF-8 TEXT gopher")
+	}
+	s.WriteString(tag + " NO [BADCHARSET] UTF-8 not supported\r\n")
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "SEARCH CHARSET US-ASCII TEXT gopher" {
+		t.Fatalf("client sent command %v, want %v", cmd, "SEARCH CHARSET US-ASCII TEXT gopher")
+	}
+	s.WriteString(tag + " OK SEARCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Search() = %v", err)
+	}
+}
+
+func TestClient_Search_NoCommonCharset(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	imap.CharsetEncoder = latin1Encoder
+	defer func() {
+		imap.CharsetEncoder = nil
+	}()
+
+	criteria := &imap.SearchCriteria{
+		Header: textproto.MIMEHeader{"Subject": {"日本"}},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Search(criteria)
+		done <- err
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("+ send literal\r\n")
+	s.ScanLine()
+	s.WriteString(tag + " NO [BADCHARSET (US-ASCII ISO-8859-1)] UTF-8 not supported\r\n")
+
+	if err := <-done; err == nil {
+		t.Fatal("c.Search() = nil, want an error")
+	} else if !strings.Contains(err.Error(), "ISO-8859-1") {
+		t.Errorf("c.Search() = %v, want an error listing supported charsets", err)
+	}
+}
+
+func TestClient_Fetch(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("2:3")
+	fields := []imap.FetchItem{imap.FetchUid, imap.FetchItem("BODY[]")}
+
+	done := make(chan error, 1)
+	messages := make(chan *imap.Message, 2)
+	go func() {
+		done <- c.Fetch(seqset, fields, messages)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "FETCH 2:3 (UID BODY[])" {
+		t.Fatalf("client sent command %v, want %v", cmd, "FETCH 2:3 (UID BODY[])")
+	}
+
+	s.WriteString("* 2 FETCH (UID 42 BODY[] {16}\r\n")
+	s.WriteString("I love potatoes.")
+	s.WriteString(")\r\n")
+
+	s.WriteString("* 3 FETCH (UID 28 BODY[] {12}\r\n")
+	s.WriteString("Hello World!")
+	s.WriteString(")\r\n")
+
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Fetch() = %v", err)
+	}
+
+	msg := <-messages
+	if msg.SeqNum != 2 {
+		t.Errorf("First message has bad sequence number: %v", msg.SeqNum)
+	}
+	if msg.Uid != 42 {
+		t.Errorf("First message has bad UID: %v", msg.Uid)
+	}
+	if body, _ := ioutil.ReadAll(msg.GetBody("BODY[]")); string(body) != "I love potatoes." {
+		t.Errorf("First message has bad body: %q", body)
+	}
+
+	msg = <-messages
+	if msg.SeqNum != 3 {
+		t.Errorf("First message has bad sequence number: %v", msg.SeqNum)
+	}
+	if msg.Uid != 28 {
+		t.Errorf("Second message has bad UID: %v", msg.Uid)
+	}
+	if body, _ := ioutil.ReadAll(msg.GetBody("BODY[]")); string(body) != "Hello World!" {
+		t.Errorf("Second message has bad body: %q", body)
+	}
+}
+
+func TestClient_FetchStream(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("2:3")
+	fields := []imap.FetchItem{imap.FetchUid, imap.FetchItem("BODY.PEEK[]")}
+
+	bodies := make(map[uint32]*bytes.Buffer)
+	f := func(seqNum uint32, section *imap.BodySectionName, size int64) io.Writer {
+		if section.FetchItem() != "BODY[]" {
+			t.Errorf("Invalid section: %v", section.FetchItem())
+		}
+		if seqNum == 3 {
+			return nil
+		}
+		bodies[seqNum] = new(bytes.Buffer)
+		return bodies[seqNum]
+	}
+
+	done := make(chan error, 1)
+	messages := make(chan *imap.Message, 2)
+	go func() {
+		done <- c.FetchStream(seqset, fields, f, messages)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "FETCH 2:3 (UID BODY.PEEK[])" {
+		t.Fatalf("client sent command %v, want %v", cmd, "FETCH 2:3 (UID BODY.PEEK[])")
+	}
+
+	s.WriteString("* 2 FETCH (UID 42 BODY[] {16}\r\n")
+	s.WriteString("I love potatoes.")
+	s.WriteString(")\r\n")
+
+	s.WriteString("* 3 FETCH (UID 28 BODY[] {12}\r\n")
+	s.WriteString("Hello World!")
+	s.WriteString(")\r\n")
+
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.FetchStream() = %v", err)
+	}
+
+	if body := bodies[2]; body == nil || body.String() != "I love potatoes." {
+		t.Errorf("Invalid streamed body: %v", body)
+	}
+
+	msg := <-messages
+	if msg.SeqNum != 2 || msg.Uid != 42 {
+		t.Errorf("First message has bad sequence number or UID: %v %v", msg.SeqNum, msg.Uid)
+	}
+	if len(msg.Body) != 1 || msg.GetBody("BODY[]") != nil {
+		t.Errorf("Streamed body section should be present with a nil literal: %v", msg.Body)
+	}
+
+	// The writer returned nil, the body is kept in memory
+	msg = <-messages
+	if body, _ := ioutil.ReadAll(msg.GetBody("BODY[]")); string(body) != "Hello World!" {
+		t.Errorf("Second message has bad body: %q", body)
+	}
+}
+
+func TestClient_FetchStream_Queued(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("1")
+	fields := []imap.FetchItem{imap.FetchItem("BODY[]")}
+
+	fetchDone := make(chan error, 1)
+	messages := make(chan *imap.Message, 1)
+	go func() {
+		fetchDone <- c.Fetch(seqset, fields, messages)
+	}()
+	tag, _ := s.ScanCmd()
+
+	var streamed bytes.Buffer
+	f := func(seqNum uint32, section *imap.BodySectionName, size int64) io.Writer {
+		if seqNum != 2 {
+			t.Errorf("Body of message %v streamed", seqNum)
+			return nil
+		}
+		return &streamed
+	}
+
+	// FetchStream waits for the previous FETCH to complete
+	streamDone := make(chan error, 1)
+	streamMessages := make(chan *imap.Message, 1)
+	go func() {
+		seqset, _ := imap.ParseSeqSet("2")
+		streamDone <- c.FetchStream(seqset, fields, f, streamMessages)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	s.WriteString("* 1 FETCH (BODY[] {12}\r\n")
+	s.WriteString("Hello World!")
+	s.WriteString(")\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-fetchDone; err != nil {
+		t.Fatalf("c.Fetch() = %v", err)
+	}
+	if body, _ := ioutil.ReadAll((<-messages).GetBody("BODY[]")); string(body) != "Hello World!" {
+		t.Errorf("Fetched message has bad body: %q", body)
+	}
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "FETCH 2 (BODY[])" {
+		t.Fatalf("client sent command %v, want %v", cmd, "FETCH 2 (BODY[])")
+	}
+	s.WriteString("* 2 FETCH (BODY[] {16}\r\n")
+	s.WriteString("I love potatoes.")
+	s.WriteString(")\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-streamDone; err != nil {
+		t.Fatalf("c.FetchStream() = %v", err)
+	}
+	if streamed.String() != "I love potatoes." {
+		t.Errorf("Invalid streamed body: %q", streamed.String())
+	}
+}
+
+func TestClient_FetchStream_WriterError(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("2")
+	fields := []imap.FetchItem{imap.FetchItem("BODY[]")}
+
+	writeErr := errors.New("disk full")
+	f := func(seqNum uint32, section *imap.BodySectionName, size int64) io.Writer {
+		return errWriter{writeErr}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.FetchStream(seqset, fields, f, make(chan *imap.Message, 1))
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("* 2 FETCH (BODY[] {16}\r\n")
+	s.WriteString("I love potatoes.")
+	s.WriteString(" UID 42)\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != writeErr {
+		t.Fatalf("c.FetchStream() = %v, want %v", err, writeErr)
+	}
+
+	// The connection is still usable
+	go func() {
+		done <- c.Noop()
+	}()
+	tag, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatal("Bad command:", cmd)
+	}
+	s.WriteString(tag + " OK NOOP completed\r\n")
+	if err := <-done; err != nil {
+		t.Fatal("c.Noop() =", err)
+	}
+}
+
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) Write(b []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestClient_Fetch_Binary(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("2")
+	section := &imap.BodySectionName{BodyPartName: imap.BodyPartName{Path: []int{2}}, Binary: true, Peek: true}
+	fields := []imap.FetchItem{imap.BinarySizeItem([]int{2}), section.FetchItem()}
+
+	done := make(chan error, 1)
+	messages := make(chan *imap.Message, 1)
+	go func() {
+		done <- c.Fetch(seqset, fields, messages)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "FETCH 2 (BINARY.SIZE[2] BINARY.PEEK[2])" {
+		t.Fatalf("client sent command %v, want %v", cmd, "FETCH 2 (BINARY.SIZE[2] BINARY.PEEK[2])")
+	}
+
+	s.WriteString("* 2 FETCH (BINARY.SIZE[2] 11 BINARY[2] ~{11}\r\n")
+	s.WriteString("Hello\x00World")
+	s.WriteString(")\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Fetch() = %v", err)
+	}
+
+	msg := <-messages
+	if size, ok := msg.BinarySize([]int{2}); !ok || size != 11 {
+		t.Errorf("Message has bad binary size: %v", size)
+	}
+	if body, _ := ioutil.ReadAll(msg.GetBody("BINARY[2]")); string(body) != "Hello\x00World" {
+		t.Errorf("Message has bad binary body: %q", body)
+	}
+}
+func TestClient_Fetch_Split(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("2:3")
+	fields := []imap.FetchItem{imap.FetchUid, imap.FetchFlags, imap.FetchItem("BODY[]")}
+
+	done := make(chan error, 1)
+	messages := make(chan *imap.Message, 3)
+	go func() {
+		done <- c.Fetch(seqset, fields, messages)
+	}()
+
+	tag, _ := s.ScanCmd()
+
+	s.WriteString("* 2 FETCH (UID 42 FLAGS (\\Seen))\r\n")
+	s.WriteString("* 2 FETCH (UID 42 BODY[] {16}\r\n")
+	s.WriteString("I love potatoes.")
+	s.WriteString(")\r\n")
+
+	s.WriteString("* 3 FETCH (FLAGS ())\r\n")
+	s.WriteString("* 3 FETCH (UID 28)\r\n")
+
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Fetch() = %v", err)
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %v", len(messages))
+	}
+
+	msg := <-messages
+	if msg.SeqNum != 2 || msg.Uid != 42 {
+		t.Errorf("First message has bad sequence number or UID: %v, %v", msg.SeqNum, msg.Uid)
+	}
+	if !reflect.DeepEqual(msg.Flags, []string{imap.SeenFlag}) {
+		t.Errorf("First message has bad flags: %v", msg.Flags)
+	}
+	if body, _ := ioutil.ReadAll(msg.GetBody("BODY[]")); string(body) != "I love potatoes." {
+		t.Errorf("First message has bad body: %q", body)
+	}
+
+	msg = <-messages
+	if msg.SeqNum != 3 || msg.Uid != 28 {
+		t.Errorf("Second message has bad sequence number or UID: %v, %v", msg.SeqNum, msg.Uid)
+	}
+	if msg.Flags == nil || len(msg.Flags) != 0 {
+		t.Errorf("Second message has bad flags: %v", msg.Flags)
+	}
+}
+
+func TestClient_UidFetchChangedSince(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "CONDSTORE"})
+
+	seqset, _ := imap.ParseSeqSet("1:*")
+	fields := []imap.FetchItem{imap.FetchFlags}
+
+	done := make(chan error, 1)
+	messages := make(chan *imap.Message, 2)
+	go func() {
+		done <- c.UidFetchChangedSince(seqset, 12345, fields, messages)
+	}()
+
+	wantCmd := "UID FETCH 1:* (FLAGS MODSEQ) (CHANGEDSINCE 12345)"
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	// Only changed messages are returned
+	s.WriteString("* 2 FETCH (UID 6 MODSEQ (12346) FLAGS (\\Seen))\r\n")
+	s.WriteString("* 5 FETCH (UID 9 MODSEQ (12400) FLAGS ())\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidFetchChangedSince() = %v", err)
+	}
+
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %v", len(messages))
+	}
+	for _, want := range []struct {
+		uid    uint32
+		modSeq uint64
+	}{{6, 12346}, {9, 12400}} {
+		msg := <-messages
+		if msg.Uid != want.uid || msg.ModSeq != want.modSeq {
+			t.Errorf("Invalid message: got UID %v and MODSEQ %v, want %v and %v", msg.Uid, msg.ModSeq, want.uid, want.modSeq)
+		}
+	}
+
+	if len(fields) != 1 {
+		t.Errorf("The items slice has been modified: %v", fields)
+	}
+}
+
+func TestClient_UidFetchVanished(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+	c.enabled = map[string]bool{"QRESYNC": true}
+
+	seqset, _ := imap.ParseSeqSet("300:310")
+	fields := []imap.FetchItem{imap.FetchFlags}
+
+	var vanished *imap.SeqSet
+	done := make(chan error, 1)
+	messages := make(chan *imap.Message, 2)
+	go func() {
+		var err error
+		vanished, err = c.UidFetchVanished(seqset, 12345, fields, messages)
+		done <- err
+	}()
+
+	wantCmd := "UID FETCH 300:310 (FLAGS MODSEQ) (CHANGEDSINCE 12345 VANISHED)"
+	tag, cmd := s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+
+	s.WriteString("* VANISHED (EARLIER) 300:303,305\r\n")
+	s.WriteString("* 2 FETCH (UID 304 MODSEQ (12346) FLAGS (\\Seen))\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidFetchVanished() = %v", err)
+	}
+
+	if vanished.String() != "300:303,305" {
+		t.Errorf("Invalid vanished UIDs: got %v", vanished)
+	}
+	if msg := <-messages; msg.Uid != 304 || msg.ModSeq != 12346 {
+		t.Errorf("Invalid message: got UID %v and MODSEQ %v", msg.Uid, msg.ModSeq)
+	}
+}
+
+func TestClient_FetchChangedSince_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("1:*")
+	messages := make(chan *imap.Message, 1)
+	if err := c.FetchChangedSince(seqset, 12345, []imap.FetchItem{imap.FetchFlags}, messages); err != ErrCondStoreUnsupported {
+		t.Fatalf("c.FetchChangedSince() = %v, want %v", err, ErrCondStoreUnsupported)
+	}
+}
+
+func TestClient_Fetch_Bye(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("1:2")
+	fields := []imap.FetchItem{imap.FetchUid}
+
+	done := make(chan error, 1)
+	messages := make(chan *imap.Message, 2)
+	go func() {
+		done <- c.Fetch(seqset, fields, messages)
+	}()
+
+	s.ScanCmd()
+	s.WriteString("* 1 FETCH (UID 42)\r\n")
+	s.WriteString("* BYE [UNAVAILABLE] server shutting down\r\n")
+
+	err := <-done
+	bye, ok := err.(*imap.ByeError)
+	if !ok {
+		t.Fatalf("c.Fetch() = %v, want a *imap.ByeError", err)
+	}
+	if bye.Code != "UNAVAILABLE" || bye.Info != "server shutting down" {
+		t.Errorf("Invalid BYE error: code %q, info %q", bye.Code, bye.Info)
+	}
+
+	if state := c.State(); state != imap.LogoutState {
+		t.Errorf("c.State() = %v, want %v", state, imap.LogoutState)
+	}
+
+	// Subsequent commands must fail immediately
+	if err := c.Noop(); err != bye {
+		t.Errorf("c.Noop() = %v, want %v", err, bye)
+	}
+}
+
+func TestClient_Fetch_Partial(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("1")
+	fields := []imap.FetchItem{imap.FetchItem("BODY.PEEK[]<0.10>")}
+
+	done := make(chan error, 1)
+	messages := make(chan *imap.Message, 1)
+	go func() {
+		done <- c.Fetch(seqset, fields, messages)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "FETCH 1 (BODY.PEEK[]<0.10>)" {
+		t.Fatalf("client sent command %v, want %v", cmd, "FETCH 1 (BODY.PEEK[]<0.10>)")
+	}
+
+	s.WriteString("* 1 FETCH (BODY[]<0> {10}\r\n")
+	s.WriteString("I love pot")
+	s.WriteString(")\r\n")
+
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Fetch() = %v", err)
+	}
+
+	msg := <-messages
+	if body, _ := ioutil.ReadAll(msg.GetBody("BODY[]<0>")); string(body) != "I love pot" {
+		t.Errorf("Message has bad body: %q", body)
+	}
+}
+
+func TestClient_Fetch_Uid(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("1:867")
+	fields := []imap.FetchItem{imap.FetchFlags}
+
+	done := make(chan error, 1)
+	messages := make(chan *imap.Message, 1)
+	go func() {
+		done <- c.UidFetch(seqset, fields, messages)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "UID FETCH 1:867 (FLAGS)" {
+		t.Fatalf("client sent command %v, want %v", cmd, "UID FETCH 1:867 (FLAGS)")
+	}
+
+	s.WriteString("* 23 FETCH (UID 42 FLAGS (\\Seen))\r\n")
+	s.WriteString(tag + " OK UID FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidFetch() = %v", err)
+	}
+
+	msg := <-messages
+	if msg.SeqNum != 23 {
+		t.Errorf("First message has bad sequence number: %v", msg.SeqNum)
+	}
+	if msg.Uid != 42 {
+		t.Errorf("Message has bad UID: %v", msg.Uid)
+	}
+	if len(msg.Flags) != 1 || msg.Flags[0] != "\\Seen" {
+		t.Errorf("Message has bad flags: %v", msg.Flags)
+	}
+}
+
+func TestClient_Store(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("2")
+
+	done := make(chan error, 1)
+	updates := make(chan *imap.Message, 1)
+	go func() {
+		done <- c.Store(seqset, imap.AddFlags, []interface{}{imap.SeenFlag}, updates)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "STORE 2 +FLAGS (\\Seen)" {
+		t.Fatalf("client sent command %v, want %v", cmd, "STORE 2 +FLAGS (\\Seen)")
+	}
+
+	s.WriteString("* 2 FETCH (FLAGS (\\Seen))\r\n")
+	s.WriteString(tag + " OK STORE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Store() = %v", err)
+	}
+
+	msg := <-updates
+	if len(msg.Flags) != 1 || msg.Flags[0] != "\\Seen" {
+		t.Errorf("Bad message flags: %v", msg.Flags)
+	}
+}
+
+func TestClient_Store_Silent(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("2:3")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Store(seqset, imap.AddFlags, []interface{}{imap.SeenFlag}, nil)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "STORE 2:3 +FLAGS.SILENT (\\Seen)" {
+		t.Fatalf("client sent command %v, want %v", cmd, "STORE 2:3 +FLAGS.SILENT (\\Seen)")
+	}
+
+	s.WriteString(tag + " OK STORE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Store() = %v", err)
+	}
+}
+
+func TestClient_Store_Uid(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("27:901")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidStore(seqset, imap.AddFlags, []interface{}{imap.DeletedFlag}, nil)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "UID STORE 27:901 +FLAGS.SILENT (\\Deleted)" {
+		t.Fatalf("client sent command %v, want %v", cmd, "UID STORE 27:901 +FLAGS.SILENT (\\Deleted)")
+	}
+
+	s.WriteString(tag + " OK STORE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidStore() = %v", err)
+	}
+}
+
+func TestClient_Copy(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("2:4")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Copy(seqset, "Sent")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "COPY 2:4 Sent" {
+		t.Fatalf("client sent command %v, want %v", cmd, "COPY 2:4 Sent")
+	}
+
+	s.WriteString(tag + " OK COPY completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Copy() = %v", err)
+	}
+}
+
+func TestClient_Move(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "MOVE", "UIDPLUS"})
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("2:4")
+
+	done := make(chan error, 1)
+	var data *imap.CopyUid
+	go func() {
+		var err error
+		data, err = c.Move(seqset, "Sent")
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "MOVE 2:4 Sent" {
+		t.Fatalf("client sent command %v, want %v", cmd, "MOVE 2:4 Sent")
+	}
+
+	s.WriteString("* OK [COPYUID 38 10:12 20:22] Moved\r\n")
+	s.WriteString("* 2 EXPUNGE\r\n")
+	s.WriteString("* 2 EXPUNGE\r\n")
+	s.WriteString("* 2 EXPUNGE\r\n")
+	s.WriteString(tag + " OK MOVE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Move() = %v", err)
+	}
+	if data == nil || data.UidValidity != 38 || data.DestUids.String() != "20:22" {
+		t.Errorf("c.Move() = %v, want COPYUID 38 10:12 20:22", data)
+	}
+}
+
+func TestClient_Move_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1"})
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("2:4")
+	if _, err := c.UidMove(seqset, "Sent"); err != ErrMoveUnsupported {
+		t.Fatalf("c.UidMove() = %v, want %v", err, ErrMoveUnsupported)
+	}
+}
+
+func TestClient_UidReplace(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "REPLACE", "UIDPLUS"})
+	setClientState(c, imap.SelectedState, &imap.MailboxStatus{Name: "Drafts"})
+
+	msg := "Hello World!\r\n"
+	done := make(chan error, 1)
+	var data *imap.AppendUid
+	go func() {
+		var err error
+		data, err = c.UidReplace(42, "Drafts", &imap.AppendMessage{
+			Flags: []string{imap.DraftFlag},
+			Body:  bytes.NewBufferString(msg),
+		})
+		done <- err
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if want := "UID REPLACE 42 Drafts (\\Draft) {14}"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+
+	s.WriteString("+ send literal\r\n")
+	b := make([]byte, len(msg))
+	if _, err := io.ReadFull(s, b); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != msg {
+		t.Fatal("Bad literal:", string(b))
+	}
+
+	s.WriteString("* OK [APPENDUID 38 43] Replacement message appended\r\n")
+	s.WriteString("* 3 EXPUNGE\r\n")
+	s.WriteString(tag + " OK REPLACE completed\r\n")
 
-	criteria := &imap.SearchCriteria{
-		WithoutFlags: []string{imap.DeletedFlag},
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidReplace() = %v", err)
 	}
+	if data == nil || data.UidValidity != 38 || data.Uids.String() != "43" {
+		t.Errorf("c.UidReplace() = %v, want APPENDUID 38 43", data)
+	}
+}
+
+func TestClient_UidReplace_Fallback(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "LITERAL+", "UIDPLUS"})
+	setClientState(c, imap.SelectedState, &imap.MailboxStatus{Name: "Drafts"})
 
 	done := make(chan error, 1)
-	var results []uint32
 	go func() {
-		var err error
-		results, err = c.UidSearch(criteria)
+		_, err := c.UidReplace(42, "Drafts", &imap.AppendMessage{
+			Body: bytes.NewBufferString("Hello"),
+		})
 		done <- err
 	}()
 
-	wantCmd := "UID SEARCH CHARSET UTF-8 UNDELETED"
 	tag, cmd := s.ScanCmd()
-	if cmd != wantCmd {
-		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	if want := "APPEND Drafts {5+}"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
 	}
+	if line := s.ScanLine(); line != "Hello" {
+		t.Fatalf("Bad literal: %q", line)
+	}
+	s.WriteString(tag + " OK [APPENDUID 38 43] APPEND completed\r\n")
 
-	s.WriteString("* SEARCH 1 78 2010\r\n")
-	s.WriteString(tag + " OK UID SEARCH completed\r\n")
+	tag, cmd = s.ScanCmd()
+	if want := "UID STORE 42 +FLAGS.SILENT (\\Deleted)"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString(tag + " OK STORE completed\r\n")
+
+	tag, cmd = s.ScanCmd()
+	if want := "UID EXPUNGE 42"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString("* 3 EXPUNGE\r\n")
+	s.WriteString(tag + " OK EXPUNGE completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Search() = %v", err)
+		t.Fatalf("c.UidReplace() = %v", err)
 	}
+}
 
-	want := []uint32{1, 78, 2010}
-	if !reflect.DeepEqual(results, want) {
-		t.Errorf("c.Search() = %v, want %v", results, want)
+func TestClient_Copy_Uid(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("78:102")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidCopy(seqset, "Drafts")
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "UID COPY 78:102 Drafts" {
+		t.Fatalf("client sent command %v, want %v", cmd, "UID COPY 78:102 Drafts")
+	}
+
+	s.WriteString(tag + " OK UID COPY completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidCopy() = %v", err)
 	}
 }
 
-func TestClient_Fetch(t *testing.T) {
+func TestClient_UidSearchSave(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
 	setClientState(c, imap.SelectedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "SEARCHRES"})
 
-	seqset, _ := imap.ParseSeqSet("2:3")
-	fields := []imap.FetchItem{imap.FetchUid, imap.FetchItem("BODY[]")}
+	criteria := &imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}}
 
 	done := make(chan error, 1)
-	messages := make(chan *imap.Message, 2)
 	go func() {
-		done <- c.Fetch(seqset, fields, messages)
+		done <- c.UidSearchSave(criteria)
 	}()
 
+	wantCmd := "UID SEARCH RETURN (SAVE) CHARSET UTF-8 UNSEEN"
 	tag, cmd := s.ScanCmd()
-	if cmd != "FETCH 2:3 (UID BODY[])" {
-		t.Fatalf("client sent command %v, want %v", cmd, "FETCH 2:3 (UID BODY[])")
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
 	}
+	s.WriteString(tag + " OK SEARCH completed, result saved\r\n")
 
-	s.WriteString("* 2 FETCH (UID 42 BODY[] {16}\r\n")
-	s.WriteString("I love potatoes.")
-	s.WriteString(")\r\n")
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidSearchSave() = %v", err)
+	}
 
-	s.WriteString("* 3 FETCH (UID 28 BODY[] {12}\r\n")
-	s.WriteString("Hello World!")
-	s.WriteString(")\r\n")
+	// Fetch the saved result
+	seqset := &imap.SeqSet{Saved: true}
+	messages := make(chan *imap.Message, 2)
+	go func() {
+		done <- c.UidFetch(seqset, []imap.FetchItem{imap.FetchFlags}, messages)
+	}()
 
+	wantCmd = "UID FETCH $ (FLAGS)"
+	tag, cmd = s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
+	}
+	s.WriteString("* 2 FETCH (UID 5 FLAGS ())\r\n")
+	s.WriteString("* 4 FETCH (UID 9 FLAGS (\\Flagged))\r\n")
 	s.WriteString(tag + " OK FETCH completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Fetch() = %v", err)
+		t.Fatalf("c.UidFetch() = %v", err)
 	}
-
-	msg := <-messages
-	if msg.SeqNum != 2 {
-		t.Errorf("First message has bad sequence number: %v", msg.SeqNum)
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %v", len(messages))
 	}
-	if msg.Uid != 42 {
-		t.Errorf("First message has bad UID: %v", msg.Uid)
+	if msg := <-messages; msg.Uid != 5 {
+		t.Errorf("Invalid first message: UID %v", msg.Uid)
 	}
-	if body, _ := ioutil.ReadAll(msg.GetBody("BODY[]")); string(body) != "I love potatoes." {
-		t.Errorf("First message has bad body: %q", body)
+	if msg := <-messages; msg.Uid != 9 {
+		t.Errorf("Invalid second message: UID %v", msg.Uid)
 	}
 
-	msg = <-messages
-	if msg.SeqNum != 3 {
-		t.Errorf("First message has bad sequence number: %v", msg.SeqNum)
+	// The saved result has expired
+	go func() {
+		done <- c.UidStore(seqset, imap.AddFlags, []interface{}{imap.SeenFlag}, nil)
+	}()
+
+	wantCmd = "UID STORE $ +FLAGS.SILENT (\\Seen)"
+	tag, cmd = s.ScanCmd()
+	if cmd != wantCmd {
+		t.Fatalf("client sent command %v, want %v", cmd, wantCmd)
 	}
-	if msg.Uid != 28 {
-		t.Errorf("Second message has bad UID: %v", msg.Uid)
+	s.WriteString(tag + " NO [NOTSAVED] No saved search result\r\n")
+
+	if err := <-done; err != ErrSearchNotSaved {
+		t.Fatalf("c.UidStore() = %v, want %v", err, ErrSearchNotSaved)
 	}
-	if body, _ := ioutil.ReadAll(msg.GetBody("BODY[]")); string(body) != "Hello World!" {
-		t.Errorf("Second message has bad body: %q", body)
+}
+
+func TestClient_SearchSave_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1"})
+
+	if err := c.SearchSave(&imap.SearchCriteria{}); err != ErrSearchResUnsupported {
+		t.Errorf("c.SearchSave() = %v, want %v", err, ErrSearchResUnsupported)
+	}
+	if err := c.Copy(&imap.SeqSet{Saved: true}, "Archive"); err != ErrSearchResUnsupported {
+		t.Errorf("c.Copy() = %v, want %v", err, ErrSearchResUnsupported)
 	}
 }
 
-func TestClient_Fetch_Partial(t *testing.T) {
+func TestClient_Store_Recent(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
 	setClientState(c, imap.SelectedState, nil)
 
-	seqset, _ := imap.ParseSeqSet("1")
-	fields := []imap.FetchItem{imap.FetchItem("BODY.PEEK[]<0.10>")}
+	seqset, _ := imap.ParseSeqSet("2")
+	values := []interface{}{
+		[]interface{}{imap.SeenFlag, imap.RecentFlag},
+		[]string{"\\recent"},
+		imap.RecentFlag,
+	}
+	for _, value := range values {
+		if err := c.Store(seqset, imap.AddFlags, value, nil); err != ErrRecentFlag {
+			t.Errorf("c.Store(%v) = %v, want %v", value, err, ErrRecentFlag)
+		}
+	}
 
+	// Nothing has been sent to the server
 	done := make(chan error, 1)
-	messages := make(chan *imap.Message, 1)
 	go func() {
-		done <- c.Fetch(seqset, fields, messages)
+		done <- c.Noop()
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "FETCH 1 (BODY.PEEK[]<0.10>)" {
-		t.Fatalf("client sent command %v, want %v", cmd, "FETCH 1 (BODY.PEEK[]<0.10>)")
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want NOOP", cmd)
 	}
-
-	s.WriteString("* 1 FETCH (BODY[]<0> {10}\r\n")
-	s.WriteString("I love pot")
-	s.WriteString(")\r\n")
-
-	s.WriteString(tag + " OK FETCH completed\r\n")
+	s.WriteString(tag + " OK NOOP completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Fetch() = %v", err)
-	}
-
-	msg := <-messages
-	if body, _ := ioutil.ReadAll(msg.GetBody("BODY[]<0>")); string(body) != "I love pot" {
-		t.Errorf("Message has bad body: %q", body)
+		t.Fatalf("c.Noop() = %v", err)
 	}
 }
 
-func TestClient_Fetch_Uid(t *testing.T) {
+func TestClient_FetchWithUid(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
 	setClientState(c, imap.SelectedState, nil)
 
-	seqset, _ := imap.ParseSeqSet("1:867")
+	seqset, _ := imap.ParseSeqSet("2:4")
 	fields := []imap.FetchItem{imap.FetchFlags}
 
 	done := make(chan error, 1)
-	messages := make(chan *imap.Message, 1)
+	messages := make(chan *imap.Message, 3)
 	go func() {
-		done <- c.UidFetch(seqset, fields, messages)
+		done <- c.FetchWithUid(seqset, fields, messages)
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "UID FETCH 1:867 (FLAGS)" {
-		t.Fatalf("client sent command %v, want %v", cmd, "UID FETCH 1:867 (FLAGS)")
+	if cmd != "FETCH 2:4 (FLAGS UID)" {
+		t.Fatalf("client sent command %v, want %v", cmd, "FETCH 2:4 (FLAGS UID)")
 	}
 
-	s.WriteString("* 23 FETCH (UID 42 FLAGS (\\Seen))\r\n")
-	s.WriteString(tag + " OK UID FETCH completed\r\n")
+	s.WriteString("* 2 FETCH (FLAGS (\\Seen) UID 42)\r\n")
+	// The UID is sent in a separate response
+	s.WriteString("* 3 FETCH (FLAGS ())\r\n")
+	s.WriteString("* 3 FETCH (UID 43)\r\n")
+	// The UID is missing
+	s.WriteString("* 4 FETCH (FLAGS ())\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.UidFetch() = %v", err)
+		t.Fatalf("c.FetchWithUid() = %v", err)
 	}
 
-	msg := <-messages
-	if msg.SeqNum != 23 {
-		t.Errorf("First message has bad sequence number: %v", msg.SeqNum)
+	if len(fields) != 1 {
+		t.Errorf("The items slice has been modified: %v", fields)
 	}
-	if msg.Uid != 42 {
-		t.Errorf("Message has bad UID: %v", msg.Uid)
+
+	var uids []uint32
+	for msg := range messages {
+		if msg.Uid == 0 {
+			t.Errorf("Message %v has no UID", msg.SeqNum)
+		}
+		uids = append(uids, msg.Uid)
 	}
-	if len(msg.Flags) != 1 || msg.Flags[0] != "\\Seen" {
-		t.Errorf("Message has bad flags: %v", msg.Flags)
+	if len(uids) != 2 || uids[0] != 42 || uids[1] != 43 {
+		t.Errorf("Invalid UIDs: %v", uids)
 	}
 }
 
-func TestClient_Store(t *testing.T) {
+func TestClient_SeqToUid(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
 	setClientState(c, imap.SelectedState, nil)
 
-	seqset, _ := imap.ParseSeqSet("2")
-
 	done := make(chan error, 1)
-	updates := make(chan *imap.Message, 1)
+	var uids map[uint32]uint32
 	go func() {
-		done <- c.Store(seqset, imap.AddFlags, []interface{}{imap.SeenFlag}, updates)
+		var err error
+		uids, err = c.SeqToUid([]uint32{5, 1, 2})
+		done <- err
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "STORE 2 +FLAGS (\\Seen)" {
-		t.Fatalf("client sent command %v, want %v", cmd, "STORE 2 +FLAGS (\\Seen)")
+	if cmd != "FETCH 1:2,5 (UID)" {
+		t.Fatalf("client sent command %v, want %v", cmd, "FETCH 1:2,5 (UID)")
 	}
 
-	s.WriteString("* 2 FETCH (FLAGS (\\Seen))\r\n")
-	s.WriteString(tag + " OK STORE completed\r\n")
+	s.WriteString("* 1 FETCH (UID 10)\r\n")
+	s.WriteString("* 2 FETCH (UID 12)\r\n")
+	s.WriteString("* 5 FETCH (UID 20)\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Store() = %v", err)
+		t.Fatalf("c.SeqToUid() = %v", err)
 	}
 
-	msg := <-updates
-	if len(msg.Flags) != 1 || msg.Flags[0] != "\\Seen" {
-		t.Errorf("Bad message flags: %v", msg.Flags)
+	want := map[uint32]uint32{1: 10, 2: 12, 5: 20}
+	if !reflect.DeepEqual(uids, want) {
+		t.Errorf("c.SeqToUid() = %v, want %v", uids, want)
 	}
 }
 
-func TestClient_Store_Silent(t *testing.T) {
+func TestClient_FetchHeaders(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
 	setClientState(c, imap.SelectedState, nil)
 
-	seqset, _ := imap.ParseSeqSet("2:3")
+	seqset, _ := imap.ParseSeqSet("1:2")
 
 	done := make(chan error, 1)
+	headers := make(chan *imap.MessageHeaders, 2)
 	go func() {
-		done <- c.Store(seqset, imap.AddFlags, []interface{}{imap.SeenFlag}, nil)
+		done <- c.FetchHeaders(seqset, []string{"Subject", "From"}, headers)
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "STORE 2:3 +FLAGS.SILENT (\\Seen)" {
-		t.Fatalf("client sent command %v, want %v", cmd, "STORE 2:3 +FLAGS.SILENT (\\Seen)")
+	if want := "FETCH 1:2 (UID BODY.PEEK[HEADER.FIELDS (Subject From)])"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
 	}
 
-	s.WriteString(tag + " OK STORE completed\r\n")
+	header := "Subject: =?utf-8?q?Caf=C3=A9?= and\r\n" +
+		" croissants\r\n" +
+		"From: Mitsuha Miyamizu\r\n" +
+		"\t<mitsuha.miyamizu@example.org>\r\n" +
+		"\r\n"
+	s.WriteString("* 1 FETCH (UID 42 BODY[HEADER.FIELDS (SUBJECT FROM)] {" + strconv.Itoa(len(header)) + "}\r\n")
+	s.WriteString(header + ")\r\n")
+	s.WriteString("* 2 FETCH (UID 43 BODY[HEADER.FIELDS (SUBJECT FROM)] {13}\r\n")
+	s.WriteString("Subject: Hi\r\n)\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.Store() = %v", err)
+		t.Fatalf("c.FetchHeaders() = %v", err)
+	}
+
+	want := []*imap.MessageHeaders{
+		{
+			SeqNum: 1,
+			Uid:    42,
+			Header: textproto.MIMEHeader{
+				"Subject": {"Café and croissants"},
+				"From":    {"Mitsuha Miyamizu <mitsuha.miyamizu@example.org>"},
+			},
+		},
+		{
+			SeqNum: 2,
+			Uid:    43,
+			Header: textproto.MIMEHeader{"Subject": {"Hi"}},
+		},
+	}
+
+	i := 0
+	for h := range headers {
+		if i >= len(want) {
+			t.Fatalf("Too many messages")
+		}
+		if !reflect.DeepEqual(h, want[i]) {
+			t.Errorf("Invalid headers for message #%v: got %+v, want %+v", i, h, want[i])
+		}
+		i++
+	}
+	if i != len(want) {
+		t.Errorf("Got %v messages, want %v", i, len(want))
 	}
 }
 
-func TestClient_Store_Uid(t *testing.T) {
+func TestClient_UidExpunge(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "UIDPLUS"})
 	setClientState(c, imap.SelectedState, nil)
 
-	seqset, _ := imap.ParseSeqSet("27:901")
+	seqset, _ := imap.ParseSeqSet("3000:3002")
 
 	done := make(chan error, 1)
+	expunged := make(chan uint32, 2)
 	go func() {
-		done <- c.UidStore(seqset, imap.AddFlags, []interface{}{imap.DeletedFlag}, nil)
+		done <- c.UidExpunge(seqset, expunged)
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "UID STORE 27:901 +FLAGS.SILENT (\\Deleted)" {
-		t.Fatalf("client sent command %v, want %v", cmd, "UID STORE 27:901 +FLAGS.SILENT (\\Deleted)")
+	if cmd != "UID EXPUNGE 3000:3002" {
+		t.Fatalf("client sent command %v, want %v", cmd, "UID EXPUNGE 3000:3002")
 	}
 
-	s.WriteString(tag + " OK STORE completed\r\n")
+	s.WriteString("* 3 EXPUNGE\r\n")
+	s.WriteString("* 3 EXPUNGE\r\n")
+	s.WriteString(tag + " OK UID EXPUNGE completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.UidStore() = %v", err)
+		t.Fatalf("c.UidExpunge() = %v", err)
+	}
+
+	n := 0
+	for id := range expunged {
+		if id != 3 {
+			t.Errorf("Bad expunged sequence number: got %v instead of 3", id)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 expunged messages, got %v", n)
 	}
 }
 
-func TestClient_Copy(t *testing.T) {
+func TestClient_UidExpunge_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("3000")
+	if err := c.UidExpunge(seqset, nil); err != ErrUidPlusUnsupported {
+		t.Fatalf("c.UidExpunge() = %v, want %v", err, ErrUidPlusUnsupported)
+	}
+}
+
+func TestClient_CopyWithUid(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
@@ -403,9 +1946,14 @@ func TestClient_Copy(t *testing.T) {
 
 	seqset, _ := imap.ParseSeqSet("2:4")
 
-	done := make(chan error, 1)
+	type result struct {
+		data *imap.CopyUid
+		err  error
+	}
+	done := make(chan result, 1)
 	go func() {
-		done <- c.Copy(seqset, "Sent")
+		data, err := c.CopyWithUid(seqset, "Sent")
+		done <- result{data, err}
 	}()
 
 	tag, cmd := s.ScanCmd()
@@ -413,34 +1961,90 @@ func TestClient_Copy(t *testing.T) {
 		t.Fatalf("client sent command %v, want %v", cmd, "COPY 2:4 Sent")
 	}
 
-	s.WriteString(tag + " OK COPY completed\r\n")
+	s.WriteString(tag + " OK [COPYUID 38505 304,319:320 3956:3958] Done\r\n")
 
-	if err := <-done; err != nil {
-		t.Fatalf("c.Copy() = %v", err)
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("c.CopyWithUid() = %v", res.err)
+	}
+	if res.data == nil {
+		t.Fatal("Expected COPYUID data")
+	}
+	if res.data.UidValidity != 38505 || res.data.SourceUids.String() != "304,319:320" || res.data.DestUids.String() != "3956:3958" {
+		t.Errorf("Invalid COPYUID data: %+v", res.data)
 	}
 }
 
-func TestClient_Copy_Uid(t *testing.T) {
+func TestClient_Fetch_Annotation(t *testing.T) {
 	c, s := newTestClient(t)
 	defer s.Close()
 
 	setClientState(c, imap.SelectedState, nil)
 
-	seqset, _ := imap.ParseSeqSet("78:102")
+	seqset, _ := imap.ParseSeqSet("1")
+	items := []imap.FetchItem{imap.FetchUid, imap.AnnotationItem([]string{"/comment"}, []string{imap.AnnotationValue})}
 
 	done := make(chan error, 1)
+	messages := make(chan *imap.Message, 1)
 	go func() {
-		done <- c.UidCopy(seqset, "Drafts")
+		done <- c.Fetch(seqset, items, messages)
 	}()
 
 	tag, cmd := s.ScanCmd()
-	if cmd != "UID COPY 78:102 Drafts" {
-		t.Fatalf("client sent command %v, want %v", cmd, "UID COPY 78:102 Drafts")
+	if want := "FETCH 1 (UID ANNOTATION (\"/comment\" \"value\"))"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
 	}
 
-	s.WriteString(tag + " OK UID COPY completed\r\n")
+	s.WriteString("* 1 FETCH (UID 42 ANNOTATION (/comment (value.priv \"My comment\" value.shared NIL)))\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
 
 	if err := <-done; err != nil {
-		t.Fatalf("c.UidCopy() = %v", err)
+		t.Fatalf("c.Fetch() = %v", err)
+	}
+
+	msg := <-messages
+	want := map[string]map[string]string{"/comment": {imap.AnnotationValuePriv: "My comment"}}
+	if !reflect.DeepEqual(msg.Annotations, want) {
+		t.Errorf("Invalid annotations: got %v, want %v", msg.Annotations, want)
+	}
+}
+
+func TestClient_SetAnnotations(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "ANNOTATE-EXPERIMENT-1"})
+
+	seqset, _ := imap.ParseSeqSet("3")
+	comment := "My new comment"
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidSetAnnotations(seqset, map[string]map[string]*string{
+			"/comment": {imap.AnnotationValuePriv: &comment},
+		})
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if want := "UID STORE 3 ANNOTATION (\"/comment\" (\"value.priv\" \"My new comment\"))"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString(tag + " OK STORE completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidSetAnnotations() = %v", err)
+	}
+}
+
+func TestClient_SetAnnotations_Unsupported(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("1")
+	if err := c.SetAnnotations(seqset, nil); err != ErrAnnotateUnsupported {
+		t.Fatalf("c.SetAnnotations() = %v, want %v", err, ErrAnnotateUnsupported)
 	}
 }
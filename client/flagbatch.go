@@ -0,0 +1,256 @@
+package client
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// errFlagBatcherOp is returned by FlagBatcher.Add if the operation isn't
+// supported.
+var errFlagBatcherOp = errors.New("FlagBatcher only supports adding and removing flags")
+
+// A FlagBatcher coalesces flag changes on many messages into as few UID STORE
+// commands as possible. For instance, marking 10,000 messages as seen one by
+// one results in a single command.
+//
+// Changes are sent when Flush is called, or automatically after Window if it
+// is not zero. For each message, the last change of a flag wins: adding then
+// removing \Seen only removes it. A FlagBatcher is safe to use from multiple
+// goroutines.
+type FlagBatcher struct {
+	// Window, if not zero, is the maximum amount of time a change is kept
+	// before being sent. Errors occurring while sending changes automatically
+	// are returned by the next call to Flush.
+	Window time.Duration
+
+	c *Client
+
+	locker sync.Mutex
+	// pending[uid][flag] is true if flag is added to message uid, false if
+	// it's removed.
+	pending map[uint32]map[string]bool
+	timer   *time.Timer
+	err     error
+}
+
+// NewFlagBatcher creates a new FlagBatcher sending changes with c. A mailbox
+// must be selected when changes are sent.
+func (c *Client) NewFlagBatcher() *FlagBatcher {
+	return &FlagBatcher{c: c, pending: make(map[uint32]map[string]bool)}
+}
+
+// Add records that flags must be added to or removed from the message with the
+// provided UID. op must be either imap.AddFlags or imap.RemoveFlags.
+func (b *FlagBatcher) Add(uid uint32, op imap.FlagsOp, flags []string) error {
+	if op != imap.AddFlags && op != imap.RemoveFlags {
+		return errFlagBatcherOp
+	}
+
+	b.locker.Lock()
+	defer b.locker.Unlock()
+
+	changes := b.pending[uid]
+	if changes == nil {
+		changes = make(map[string]bool)
+		b.pending[uid] = changes
+	}
+	for _, flag := range flags {
+		changes[imap.CanonicalFlag(flag)] = op == imap.AddFlags
+	}
+
+	b.schedule()
+	return nil
+}
+
+// schedule arms the timer sending pending changes automatically, if Window is
+// not zero. It must be called with the lock held.
+func (b *FlagBatcher) schedule() {
+	if b.Window <= 0 || b.timer != nil {
+		return
+	}
+	b.timer = time.AfterFunc(b.Window, func() {
+		err := b.Flush()
+
+		b.locker.Lock()
+		if b.err == nil {
+			b.err = err
+		}
+		b.locker.Unlock()
+	})
+}
+
+// Flush sends all pending changes to the server. If sending fails, the changes
+// which haven't been sent are kept, and sent by the next call to Flush or after
+// Window.
+//
+// If an error occurred while sending changes automatically, it is returned
+// once the pending changes have been sent.
+func (b *FlagBatcher) Flush() error {
+	b.locker.Lock()
+	pending := b.pending
+	b.pending = make(map[uint32]map[string]bool)
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	autoErr := b.err
+	b.err = nil
+	b.locker.Unlock()
+
+	stores := batchStores(pending)
+	for i, st := range stores {
+		sets := splitSeqSet(st.seqset, maxSearchSeqSetLen)
+		for j, set := range sets {
+			flags := make([]interface{}, len(st.flags))
+			for k, flag := range st.flags {
+				flags[k] = flag
+			}
+
+			item := imap.FormatFlagsOp(st.op, true)
+			if err := b.c.UidStore(set, item, flags, nil); err != nil {
+				b.locker.Lock()
+				b.restore(st, sets[j:])
+				for _, st := range stores[i+1:] {
+					b.restore(st, []*imap.SeqSet{st.seqset})
+				}
+				// The error of a previous automatic flush is still to be
+				// returned
+				if b.err == nil {
+					b.err = autoErr
+				}
+				b.schedule()
+				b.locker.Unlock()
+				return err
+			}
+		}
+	}
+	return autoErr
+}
+
+// restore puts the changes of st on the messages in sets back into the pending
+// changes, unless the flags have been changed again in the meantime. It must
+// be called with the lock held.
+func (b *FlagBatcher) restore(st *batchStore, sets []*imap.SeqSet) {
+	for _, set := range sets {
+		for _, seq := range set.Set {
+			for uid := seq.Start; ; uid++ {
+				changes := b.pending[uid]
+				if changes == nil {
+					changes = make(map[string]bool)
+					b.pending[uid] = changes
+				}
+				for _, flag := range st.flags {
+					if _, ok := changes[flag]; !ok {
+						changes[flag] = st.op == imap.AddFlags
+					}
+				}
+
+				if uid == seq.Stop {
+					break
+				}
+			}
+		}
+	}
+}
+
+// batchStore is a STORE command changing flags on a set of messages.
+type batchStore struct {
+	op     imap.FlagsOp
+	flags  []string
+	seqset *imap.SeqSet
+}
+
+// batchStores computes the STORE commands applying the changes in pending,
+// for each operation choosing the smallest solution among two strategies: one
+// command per set of flags changed together on a message, or one command per
+// set of messages on which a flag is changed.
+func batchStores(pending map[uint32]map[string]bool) []*batchStore {
+	var stores []*batchStore
+	for _, op := range []imap.FlagsOp{imap.AddFlags, imap.RemoveFlags} {
+		add := op == imap.AddFlags
+
+		// Flags changed by op for each message
+		byUid := make(map[uint32][]string)
+		for uid, changes := range pending {
+			for flag, added := range changes {
+				if added == add {
+					byUid[uid] = append(byUid[uid], flag)
+				}
+			}
+		}
+
+		byFlags := groupByFlags(op, byUid)
+		byMessages := groupByMessages(op, byUid)
+		if len(byMessages) < len(byFlags) {
+			stores = append(stores, byMessages...)
+		} else {
+			stores = append(stores, byFlags...)
+		}
+	}
+	return stores
+}
+
+// groupByFlags returns one command per distinct set of flags.
+func groupByFlags(op imap.FlagsOp, byUid map[uint32][]string) []*batchStore {
+	groups := make(map[string]*batchStore)
+	for uid, flags := range byUid {
+		sort.Strings(flags)
+		k := strings.Join(flags, " ")
+		st, ok := groups[k]
+		if !ok {
+			st = &batchStore{op: op, flags: flags, seqset: new(imap.SeqSet)}
+			groups[k] = st
+		}
+		st.seqset.AddNum(uid)
+	}
+	return sortBatchStores(groups)
+}
+
+// groupByMessages returns one command per distinct set of messages a flag is
+// changed on.
+func groupByMessages(op imap.FlagsOp, byUid map[uint32][]string) []*batchStore {
+	sets := make(map[string]*imap.SeqSet)
+	for uid, flags := range byUid {
+		for _, flag := range flags {
+			if sets[flag] == nil {
+				sets[flag] = new(imap.SeqSet)
+			}
+			sets[flag].AddNum(uid)
+		}
+	}
+
+	groups := make(map[string]*batchStore)
+	for flag, set := range sets {
+		k := set.String()
+		st, ok := groups[k]
+		if !ok {
+			st = &batchStore{op: op, seqset: set}
+			groups[k] = st
+		}
+		st.flags = append(st.flags, flag)
+	}
+	for _, st := range groups {
+		sort.Strings(st.flags)
+	}
+	return sortBatchStores(groups)
+}
+
+// sortBatchStores returns the commands in groups in a stable order.
+func sortBatchStores(groups map[string]*batchStore) []*batchStore {
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	stores := make([]*batchStore, len(keys))
+	for i, k := range keys {
+		stores[i] = groups[k]
+	}
+	return stores
+}
@@ -0,0 +1,213 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func expectStores(t *testing.T, s *serverConn, done <-chan error, want []string) {
+	for i, w := range want {
+		tag, cmd := s.ScanCmd()
+		if cmd != w {
+			t.Fatalf("client sent command #%v %v, want %v", i, cmd, w)
+		}
+		s.WriteString(tag + " OK STORE completed\r\n")
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("b.Flush() = %v", err)
+	}
+}
+
+func TestFlagBatcher(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	b := c.NewFlagBatcher()
+
+	// Mark a whole mailbox as read, flag the first messages and mark some of
+	// them as unread again
+	for uid := uint32(1000); uid > 0; uid-- {
+		b.Add(uid, imap.AddFlags, []string{imap.SeenFlag})
+	}
+	for uid := uint32(1); uid <= 500; uid++ {
+		b.Add(uid, imap.AddFlags, []string{imap.FlaggedFlag})
+	}
+	for uid := uint32(200); uid <= 300; uid++ {
+		b.Add(uid, imap.RemoveFlags, []string{imap.SeenFlag})
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Flush()
+	}()
+
+	expectStores(t, s, done, []string{
+		"UID STORE 1:199,301:1000 +FLAGS.SILENT (\\Seen)",
+		"UID STORE 1:500 +FLAGS.SILENT (\\Flagged)",
+		"UID STORE 200:300 -FLAGS.SILENT (\\Seen)",
+	})
+
+	// Nothing is pending anymore
+	if err := b.Flush(); err != nil {
+		t.Fatalf("b.Flush() = %v", err)
+	}
+}
+
+func TestFlagBatcher_groupByFlags(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	b := c.NewFlagBatcher()
+	b.Add(1, imap.AddFlags, []string{imap.SeenFlag, imap.AnsweredFlag})
+	b.Add(2, imap.AddFlags, []string{imap.SeenFlag, imap.DraftFlag})
+	b.Add(3, imap.AddFlags, []string{imap.DraftFlag, imap.SeenFlag})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Flush()
+	}()
+
+	expectStores(t, s, done, []string{
+		"UID STORE 1 +FLAGS.SILENT (\\Answered \\Seen)",
+		"UID STORE 2:3 +FLAGS.SILENT (\\Draft \\Seen)",
+	})
+}
+
+func TestFlagBatcher_Window(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	b := c.NewFlagBatcher()
+	b.Window = 10 * time.Millisecond
+
+	for uid := uint32(1); uid <= 10; uid++ {
+		b.Add(uid, imap.AddFlags, []string{imap.DeletedFlag})
+	}
+
+	tag, cmd := s.ScanCmd()
+	if want := "UID STORE 1:10 +FLAGS.SILENT (\\Deleted)"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString(tag + " NO Mailbox is read-only\r\n")
+
+	// Wait for the automatic flush to fail
+	for i := 0; i < 100; i++ {
+		b.locker.Lock()
+		err := b.err
+		b.locker.Unlock()
+		if err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The changes are sent again automatically, and the error is reported by
+	// the next call to Flush
+	tag, cmd = s.ScanCmd()
+	if want := "UID STORE 1:10 +FLAGS.SILENT (\\Deleted)"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString(tag + " OK STORE completed\r\n")
+
+	// Wait for the automatic flush to complete
+	for i := 0; i < 100; i++ {
+		b.locker.Lock()
+		err := b.err
+		b.locker.Unlock()
+		if err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := b.Flush(); err == nil {
+		t.Fatal("b.Flush() = nil, want an error")
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatalf("b.Flush() = %v", err)
+	}
+}
+
+func TestFlagBatcher_FlushError(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	b := c.NewFlagBatcher()
+	b.Add(1, imap.AddFlags, []string{imap.SeenFlag})
+	b.Add(2, imap.RemoveFlags, []string{imap.SeenFlag})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Flush()
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString(tag + " NO Try again later\r\n")
+	if err := <-done; err == nil {
+		t.Fatal("b.Flush() = nil, want an error")
+	}
+
+	// Changes made in the meantime win over the unsent ones
+	b.Add(2, imap.AddFlags, []string{imap.SeenFlag})
+
+	go func() {
+		done <- b.Flush()
+	}()
+	expectStores(t, s, done, []string{
+		"UID STORE 1:2 +FLAGS.SILENT (\\Seen)",
+	})
+}
+
+func TestFlagBatcher_FlushErrorKeepsAutoErr(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	b := c.NewFlagBatcher()
+	autoErr := errors.New("automatic flush failed")
+	b.err = autoErr
+	b.Add(1, imap.AddFlags, []string{imap.SeenFlag})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Flush()
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString(tag + " NO Try again later\r\n")
+	if err := <-done; err == nil || err == autoErr {
+		t.Fatalf("b.Flush() = %v, want the STORE error", err)
+	}
+
+	go func() {
+		done <- b.Flush()
+	}()
+	tag, _ = s.ScanCmd()
+	s.WriteString(tag + " OK STORE completed\r\n")
+	if err := <-done; err != autoErr {
+		t.Fatalf("b.Flush() = %v, want %v", err, autoErr)
+	}
+}
+
+func TestFlagBatcher_SetFlags(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	b := c.NewFlagBatcher()
+	if err := b.Add(1, imap.SetFlags, []string{imap.SeenFlag}); err == nil {
+		t.Error("b.Add(SetFlags) = nil, want an error")
+	}
+}
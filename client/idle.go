@@ -0,0 +1,222 @@
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+)
+
+const idleDoneLine = "DONE"
+
+// RFC 2177 recommends to re-issue IDLE at least every 29 minutes, to avoid
+// being logged off for inactivity.
+const idleRestartInterval = 29 * time.Minute
+
+// defaultIdlePollInterval is the default interval at which Idle polls servers
+// which don't support IDLE.
+const defaultIdlePollInterval = time.Minute
+
+// Idler is a running IDLE command, as defined in RFC 2177. It is created with
+// Client.StartIdle.
+//
+// Stop can be called from any goroutine, any number of times, including from
+// the goroutine receiving from the client's Updates channel while it handles
+// an update: it never waits for the client to read a response from the server.
+type Idler struct {
+	c    *Client
+	done chan struct{}
+	err  error
+
+	locker   sync.Mutex
+	accepted bool
+	stopped  bool
+
+	stopOnce sync.Once
+	stopErr  error
+}
+
+// StartIdle sends an IDLE command and returns immediately. Updates are
+// delivered on the client's Updates channel until Stop is called. The client
+// must not be used until Wait has returned.
+func (c *Client) StartIdle() (*Idler, error) {
+	if err := c.ensureAuthenticated(); err != nil {
+		return nil, err
+	}
+
+	i := &Idler{c: c, done: make(chan struct{})}
+	go func() {
+		defer close(i.done)
+
+		status, err := c.execute(new(commands.Idle), i)
+		if err == nil {
+			err = status.Err()
+		}
+		i.err = err
+	}()
+	return i, nil
+}
+
+// Handle implements responses.Handler. It waits for the server to accept the
+// IDLE command.
+func (i *Idler) Handle(resp imap.Resp) error {
+	if _, ok := resp.(*imap.ContinuationReq); !ok {
+		return responses.ErrUnhandled
+	}
+
+	i.locker.Lock()
+	if i.accepted {
+		i.locker.Unlock()
+		return responses.ErrUnhandled
+	}
+	i.accepted = true
+	stopped := i.stopped
+	i.locker.Unlock()
+
+	if stopped {
+		// Responses are handled in the reading goroutine, don't block it
+		go i.sendDone()
+	}
+	return nil
+}
+
+func (i *Idler) sendDone() error {
+	i.stopOnce.Do(func() {
+		i.stopErr = i.c.writeLocked(func(w *imap.Writer) error {
+			if _, err := w.Write([]byte(idleDoneLine + "\r\n")); err != nil {
+				return err
+			}
+			return w.Flush()
+		})
+	})
+	return i.stopErr
+}
+
+// Stop ends IDLE. If the server has accepted the command, DONE is sent and
+// Stop returns once it has been written. Otherwise DONE will be sent as soon
+// as the server accepts the command, and Stop returns immediately. DONE is
+// sent exactly once, even if Stop is called concurrently: all calls return
+// the error that occurred while sending it, if any.
+//
+// Stop doesn't wait for the server to acknowledge the end of IDLE, so that it
+// can't deadlock when called while handling an update. Use Wait for this.
+func (i *Idler) Stop() error {
+	i.locker.Lock()
+	i.stopped = true
+	accepted := i.accepted
+	i.locker.Unlock()
+
+	if !accepted {
+		return nil
+	}
+	return i.sendDone()
+}
+
+// Done returns a channel which is closed when the IDLE command has completed.
+func (i *Idler) Done() <-chan struct{} {
+	return i.done
+}
+
+// Wait blocks until the IDLE command has completed and returns its error. It
+// returns once Stop has been called, or earlier if the server ends IDLE by
+// itself. Wait must not be called from the goroutine receiving from the
+// client's Updates channel, because the client may be blocked sending an
+// update.
+func (i *Idler) Wait() error {
+	<-i.done
+	return i.err
+}
+
+// IdleOptions holds options for Client.IdleWithOptions.
+type IdleOptions struct {
+	// LogoutTimeout is the interval after which IDLE is restarted, so that
+	// the server doesn't log out the client for inactivity. Zero means 29
+	// minutes, as recommended by RFC 2177.
+	LogoutTimeout time.Duration
+	// PollInterval is the interval at which NOOP is sent to servers which
+	// don't support IDLE, in order to receive updates. Zero means one minute.
+	PollInterval time.Duration
+}
+
+// IdleWithOptions is identical to Idle, but the intervals at which IDLE is
+// restarted and at which servers without IDLE are polled are taken from opts,
+// which may be nil.
+func (c *Client) IdleWithOptions(stop <-chan struct{}, opts *IdleOptions) error {
+	if opts == nil {
+		opts = &IdleOptions{}
+	}
+
+	if err := c.ensureAuthenticated(); err != nil {
+		return err
+	}
+
+	if ok, err := c.SupportIdle(); err != nil {
+		return err
+	} else if !ok {
+		interval := opts.PollInterval
+		if interval <= 0 {
+			interval = defaultIdlePollInterval
+		}
+		return c.idlePoll(stop, interval)
+	}
+
+	timeout := opts.LogoutTimeout
+	if timeout <= 0 {
+		timeout = idleRestartInterval
+	}
+	for {
+		if err := c.idleUntil(stop, timeout); err != nil {
+			return err
+		}
+
+		// IDLE is restarted until stop is closed, even if the server has
+		// ended it by itself
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+	}
+}
+
+// idleUntil runs IDLE until stop is closed, timeout expires or the server ends
+// the command.
+func (c *Client) idleUntil(stop <-chan struct{}, timeout time.Duration) error {
+	i, err := c.StartIdle()
+	if err != nil {
+		return err
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-stop:
+		i.Stop()
+	case <-t.C:
+		i.Stop()
+	case <-i.Done():
+	}
+	return i.Wait()
+}
+
+// idlePoll sends NOOP every interval until stop is closed.
+func (c *Client) idlePoll(stop <-chan struct{}, interval time.Duration) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			if err := c.Noop(); err != nil {
+				return err
+			}
+		case <-stop:
+			return nil
+		case <-c.LoggedOut():
+			return c.closedErr()
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package client
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestIdler_StopFromUpdate(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+
+	// Unbuffered, so that the client blocks until each update is handled
+	updates := make(chan interface{})
+	c.Updates = updates
+
+	i, err := c.StartIdle()
+	if err != nil {
+		t.Fatalf("c.StartIdle() = %v", err)
+	}
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "IDLE" {
+		t.Fatalf("client sent command %v, want %v", cmd, "IDLE")
+	}
+
+	s.WriteString("+ idling\r\n")
+	s.WriteString("* 3 EXISTS\r\n")
+	s.WriteString("* 4 EXISTS\r\n")
+
+	handled := make(chan error, 1)
+	go func() {
+		first := true
+		for update := range updates {
+			if _, ok := update.(*MailboxUpdate); ok && first {
+				first = false
+
+				// Stop concurrently from within the handler
+				var wg sync.WaitGroup
+				errs := make([]error, 3)
+				for j := range errs {
+					wg.Add(1)
+					go func(j int) {
+						defer wg.Done()
+						errs[j] = i.Stop()
+					}(j)
+				}
+				wg.Wait()
+
+				var err error
+				for _, e := range errs {
+					if e != nil {
+						err = e
+					}
+				}
+				handled <- err
+			}
+		}
+	}()
+
+	if line := s.ScanLine(); line != "DONE" {
+		t.Fatalf("client sent %v, want DONE", line)
+	}
+	if err := <-handled; err != nil {
+		t.Fatalf("i.Stop() = %v", err)
+	}
+	if err := i.Stop(); err != nil {
+		t.Fatalf("i.Stop() = %v", err)
+	}
+
+	s.WriteString(tag + " OK IDLE terminated\r\n")
+
+	if err := i.Wait(); err != nil {
+		t.Fatalf("i.Wait() = %v", err)
+	}
+
+	// DONE must have been sent only once
+	s.WriteString("* 5 EXISTS\r\n")
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want %v", cmd, "NOOP")
+	}
+	s.WriteString(tag + " OK NOOP completed\r\n")
+	if err := <-done; err != nil {
+		t.Fatalf("c.Noop() = %v", err)
+	}
+}
+
+func TestIdler_StopBeforeAccepted(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+
+	i, err := c.StartIdle()
+	if err != nil {
+		t.Fatalf("c.StartIdle() = %v", err)
+	}
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "IDLE" {
+		t.Fatalf("client sent command %v, want %v", cmd, "IDLE")
+	}
+
+	if err := i.Stop(); err != nil {
+		t.Fatalf("i.Stop() = %v", err)
+	}
+
+	s.WriteString("+ idling\r\n")
+
+	if line := s.ScanLine(); line != "DONE" {
+		t.Fatalf("client sent %v, want DONE", line)
+	}
+
+	s.WriteString(tag + " OK IDLE terminated\r\n")
+
+	if err := i.Wait(); err != nil {
+		t.Fatalf("i.Wait() = %v", err)
+	}
+}
+
+func TestClient_IdleWithOptions_Restart(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "IDLE"})
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.IdleWithOptions(stop, &IdleOptions{LogoutTimeout: 20 * time.Millisecond})
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "IDLE" {
+		t.Fatalf("client sent command %v, want %v", cmd, "IDLE")
+	}
+	s.WriteString("+ idling\r\n")
+
+	// IDLE is restarted once LogoutTimeout has expired
+	if line := s.ScanLine(); line != "DONE" {
+		t.Fatalf("client sent %v, want DONE", line)
+	}
+	s.WriteString(tag + " OK IDLE terminated\r\n")
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "IDLE" {
+		t.Fatalf("client sent command %v, want %v", cmd, "IDLE")
+	}
+	s.WriteString("+ idling\r\n")
+
+	close(stop)
+
+	if line := s.ScanLine(); line != "DONE" {
+		t.Fatalf("client sent %v, want DONE", line)
+	}
+	s.WriteString(tag + " OK IDLE terminated\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.IdleWithOptions() = %v", err)
+	}
+}
+
+func TestClient_Idle_EndedByServer(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "IDLE"})
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Idle(stop)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "IDLE" {
+		t.Fatalf("client sent command %v, want %v", cmd, "IDLE")
+	}
+	s.WriteString("+ idling\r\n")
+
+	// The server ends IDLE by itself, e.g. after a timeout
+	s.WriteString(tag + " OK IDLE terminated\r\n")
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "IDLE" {
+		t.Fatalf("client sent command %v, want %v", cmd, "IDLE")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("c.Idle() = %v before stop was closed", err)
+	default:
+	}
+	s.WriteString("+ idling\r\n")
+
+	close(stop)
+
+	if line := s.ScanLine(); line != "DONE" {
+		t.Fatalf("client sent %v, want DONE", line)
+	}
+	s.WriteString(tag + " OK IDLE terminated\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Idle() = %v", err)
+	}
+}
+
+func TestClient_IdleWithOptions_Poll(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+
+	updates := make(chan interface{}, 1)
+	c.Updates = updates
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- c.IdleWithOptions(stop, &IdleOptions{PollInterval: 20 * time.Millisecond})
+	}()
+
+	// The server doesn't support IDLE, NOOP is sent instead
+	tag, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want %v", cmd, "NOOP")
+	}
+	s.WriteString("* 3 EXISTS\r\n")
+	s.WriteString(tag + " OK NOOP completed\r\n")
+
+	if update, ok := (<-updates).(*MailboxUpdate); !ok || update.Mailbox.Messages != 3 {
+		t.Fatalf("Invalid update: %v", update)
+	}
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want %v", cmd, "NOOP")
+	}
+	close(stop)
+	s.WriteString(tag + " OK NOOP completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.IdleWithOptions() = %v", err)
+	}
+}
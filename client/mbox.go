@@ -0,0 +1,228 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// mboxDateLayout is the layout of dates in mbox "From " lines, as produced by
+// asctime.
+const mboxDateLayout = "Mon Jan _2 15:04:05 2006"
+
+// mboxUnknownSender is the sender used in "From " lines when a message has no
+// From address.
+const mboxUnknownSender = "MAILER-DAEMON"
+
+// ExportMbox writes the messages in seqset to w in the mboxrd format. The
+// \Seen flag of the messages is left unchanged.
+//
+// Each message is preceded by a "From " line with its sender and internal date.
+// Lines starting with "From ", optionally preceded by '>' characters, are
+// quoted with an additional '>'. Line endings are converted to LF. Bodies are
+// streamed to w as they are received, so that messages don't need to fit in
+// memory. An error is returned if the server doesn't send the body of a
+// message.
+func (c *Client) ExportMbox(w io.Writer, seqset *imap.SeqSet) error {
+	// The body of a message may be received before its envelope, so the
+	// "From " lines are fetched first
+	messages := make(chan *imap.Message, 10)
+	done := make(chan map[uint32]string, 1)
+	go func() {
+		fromLines := make(map[uint32]string)
+		for msg := range messages {
+			fromLines[msg.SeqNum] = mboxFromLine(msg.Envelope, msg.InternalDate)
+		}
+		done <- fromLines
+	}()
+
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchInternalDate}
+	err := c.Fetch(seqset, items, messages)
+	fromLines := <-done
+	if err != nil {
+		return err
+	}
+
+	// f is called by the goroutine reading responses, once per message: the
+	// previous message is complete by then. Write errors are sticky and
+	// returned by Flush.
+	bw := bufio.NewWriter(w)
+	var mw *mboxWriter
+	streamed := make(map[uint32]bool)
+	f := func(seqNum uint32, section *imap.BodySectionName, size int64) io.Writer {
+		if mw != nil {
+			mw.Close()
+		}
+		fromLine, ok := fromLines[seqNum]
+		if !ok {
+			fromLine = mboxFromLine(nil, time.Time{})
+		}
+		bw.WriteString(fromLine)
+		streamed[seqNum] = true
+		mw = newMboxWriter(bw)
+		return mw
+	}
+
+	messages = make(chan *imap.Message, 10)
+	received := make(chan []uint32, 1)
+	go func() {
+		var seqNums []uint32
+		for msg := range messages {
+			seqNums = append(seqNums, msg.SeqNum)
+		}
+		received <- seqNums
+	}()
+
+	section := &imap.BodySectionName{Peek: true}
+	err = c.FetchStream(seqset, []imap.FetchItem{section.FetchItem()}, f, messages)
+	seqNums := <-received
+	if err != nil {
+		return err
+	}
+	for _, seqNum := range seqNums {
+		if !streamed[seqNum] {
+			return fmt.Errorf("imap: no body received for message %v", seqNum)
+		}
+	}
+	if mw != nil {
+		mw.Close()
+	}
+	return bw.Flush()
+}
+
+func mboxSender(env *imap.Envelope) string {
+	if env == nil {
+		return mboxUnknownSender
+	}
+	for _, addr := range env.From {
+		if addr.MailboxName == "" || addr.HostName == "" {
+			continue
+		}
+		if sender := addr.MailboxName + "@" + addr.HostName; !strings.ContainsAny(sender, " \t") {
+			return sender
+		}
+	}
+	return mboxUnknownSender
+}
+
+func mboxFromLine(env *imap.Envelope, date time.Time) string {
+	if date.IsZero() {
+		date = time.Unix(0, 0)
+	}
+	return "From " + mboxSender(env) + " " + date.UTC().Format(mboxDateLayout) + "\n"
+}
+
+// mboxFrom is matched at the start of lines to find the ones to quote.
+const mboxFrom = "From "
+
+// mboxWriter quotes the lines of a message written to it and converts its line
+// endings to LF. The start of a line which may need to be quoted is held back
+// until it has been matched.
+type mboxWriter struct {
+	w *bufio.Writer
+	// The number of '>' characters and of bytes of mboxFrom held back at the
+	// start of the current line
+	quotes, matched int
+	// Whether the start of the current line is being matched
+	matching bool
+	// Whether the last byte was a '\r' which hasn't been written yet
+	cr bool
+	// Whether the current line isn't empty
+	inLine bool
+}
+
+func newMboxWriter(w *bufio.Writer) *mboxWriter {
+	return &mboxWriter{w: w, matching: true}
+}
+
+func (mw *mboxWriter) Write(b []byte) (int, error) {
+	for i, ch := range b {
+		if mw.cr {
+			mw.cr = false
+			if ch != '\n' {
+				if err := mw.writeByte('\r'); err != nil {
+					return i, err
+				}
+			}
+		}
+		if ch == '\r' {
+			mw.cr = true
+		} else if err := mw.writeByte(ch); err != nil {
+			return i, err
+		}
+	}
+	return len(b), nil
+}
+
+func (mw *mboxWriter) writeByte(ch byte) error {
+	if ch == '\n' {
+		if err := mw.flushStart(); err != nil {
+			return err
+		}
+		mw.matching = true
+		mw.inLine = false
+		return mw.w.WriteByte(ch)
+	}
+
+	mw.inLine = true
+	if mw.matching {
+		if ch == '>' && mw.matched == 0 {
+			mw.quotes++
+			return nil
+		}
+		if ch == mboxFrom[mw.matched] {
+			mw.matched++
+			if mw.matched < len(mboxFrom) {
+				return nil
+			}
+			if err := mw.w.WriteByte('>'); err != nil {
+				return err
+			}
+			return mw.flushStart()
+		}
+		if err := mw.flushStart(); err != nil {
+			return err
+		}
+	}
+	return mw.w.WriteByte(ch)
+}
+
+// flushStart writes the start of the current line which has been held back.
+func (mw *mboxWriter) flushStart() error {
+	for ; mw.quotes > 0; mw.quotes-- {
+		if err := mw.w.WriteByte('>'); err != nil {
+			return err
+		}
+	}
+	if _, err := mw.w.WriteString(mboxFrom[:mw.matched]); err != nil {
+		return err
+	}
+	mw.matched = 0
+	mw.matching = false
+	return nil
+}
+
+// Close terminates the message. It doesn't close the underlying writer.
+func (mw *mboxWriter) Close() error {
+	if mw.cr {
+		mw.cr = false
+		if err := mw.writeByte('\r'); err != nil {
+			return err
+		}
+	}
+	if err := mw.flushStart(); err != nil {
+		return err
+	}
+	if mw.inLine {
+		if err := mw.w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	// Messages are separated by an empty line
+	return mw.w.WriteByte('\n')
+}
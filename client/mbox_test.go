@@ -0,0 +1,164 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestClient_ExportMbox(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("1:2")
+
+	var b bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- c.ExportMbox(&b, seqset)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if want := "FETCH 1:2 (ENVELOPE INTERNALDATE)"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	s.WriteString("* 1 FETCH (ENVELOPE (NIL \"Hi\" ((\"Mitsuha Miyamizu\" NIL \"mitsuha.miyamizu\" \"example.org\")) NIL NIL NIL NIL NIL NIL NIL) INTERNALDATE \"17-Jul-1996 02:44:25 -0700\")\r\n")
+	s.WriteString("* 2 FETCH (ENVELOPE (NIL \"No sender\" NIL NIL NIL NIL NIL NIL NIL NIL) INTERNALDATE \"01-Jan-2017 00:00:00 +0000\")\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	tag, cmd = s.ScanCmd()
+	if want := "FETCH 1:2 (BODY.PEEK[])"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+
+	body1 := "From: Mitsuha Miyamizu <mitsuha.miyamizu@example.org>\r\n" +
+		"Subject: Hi\r\n" +
+		"\r\n" +
+		"From the mountains,\r\n" +
+		">From the lake\r\n" +
+		"Fromage\r\n"
+	body2 := "Subject: No sender\r\n" +
+		"\r\n" +
+		"No final newline"
+
+	s.WriteString("* 1 FETCH (BODY[] {" + strconv.Itoa(len(body1)) + "}\r\n")
+	s.WriteString(body1 + ")\r\n")
+	s.WriteString("* 2 FETCH (BODY[] {" + strconv.Itoa(len(body2)) + "}\r\n")
+	s.WriteString(body2 + ")\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.ExportMbox() = %v", err)
+	}
+
+	want := "From mitsuha.miyamizu@example.org Wed Jul 17 09:44:25 1996\n" +
+		"From: Mitsuha Miyamizu <mitsuha.miyamizu@example.org>\n" +
+		"Subject: Hi\n" +
+		"\n" +
+		">From the mountains,\n" +
+		">>From the lake\n" +
+		"Fromage\n" +
+		"\n" +
+		"From MAILER-DAEMON Sun Jan  1 00:00:00 2017\n" +
+		"Subject: No sender\n" +
+		"\n" +
+		"No final newline\n" +
+		"\n"
+	if got := b.String(); got != want {
+		t.Errorf("c.ExportMbox() wrote \n%q\n want \n%q", got, want)
+	}
+}
+
+func TestClient_ExportMbox_NoBody(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("1")
+
+	var b bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- c.ExportMbox(&b, seqset)
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString("* 1 FETCH (INTERNALDATE \"01-Jan-2017 00:00:00 +0000\")\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	tag, _ = s.ScanCmd()
+	s.WriteString("* 1 FETCH (BODY[] NIL)\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err == nil {
+		t.Fatal("c.ExportMbox() succeeded, want an error")
+	}
+}
+
+func TestClient_ExportMbox_LongLine(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+
+	seqset, _ := imap.ParseSeqSet("1")
+
+	var b bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		done <- c.ExportMbox(&b, seqset)
+	}()
+
+	// No envelope nor internal date is received
+	tag, _ := s.ScanCmd()
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	long := strings.Repeat("From ", 2000)
+	body := long + "\r\n" + long + "\r\n"
+	tag, _ = s.ScanCmd()
+	s.WriteString("* 1 FETCH (BODY[] {" + strconv.Itoa(len(body)) + "}\r\n")
+	s.WriteString(body + ")\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.ExportMbox() = %v", err)
+	}
+
+	want := "From MAILER-DAEMON Thu Jan  1 00:00:00 1970\n" +
+		">" + long + "\n" +
+		">" + long + "\n" +
+		"\n"
+	if b.String() != want {
+		t.Errorf("c.ExportMbox() wrote %v bytes, want %v", b.Len(), len(want))
+	}
+}
+
+func TestMboxWriter_Split(t *testing.T) {
+	body := "From a\r\n>From b\r\nFrom\r\nFro\rm\r\n>>>\r\n"
+
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	mw := newMboxWriter(w)
+	// CRLF and "From " are split across writes
+	for i := 0; i < len(body); i++ {
+		if _, err := mw.Write([]byte{body[i]}); err != nil {
+			t.Fatalf("mw.Write() = %v", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("mw.Close() = %v", err)
+	}
+	w.Flush()
+
+	want := ">From a\n>>From b\nFrom\nFro\rm\n>>>\n\n"
+	if b.String() != want {
+		t.Errorf("mboxWriter wrote %q, want %q", b.String(), want)
+	}
+}
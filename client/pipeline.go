@@ -0,0 +1,327 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+)
+
+// ErrPipelineClosed is returned when a command is added to a closed pipeline.
+var ErrPipelineClosed = errors.New("imap: pipeline closed")
+
+// unpipelinable contains the commands which can't be pipelined, because they
+// change the connection state or negotiate with the server.
+var unpipelinable = map[string]bool{
+	"AUTHENTICATE":   true,
+	"CLOSE":          true,
+	"COMPRESS":       true,
+	"ENABLE":         true,
+	"EXAMINE":        true,
+	"IDLE":           true,
+	"LOGIN":          true,
+	"LOGOUT":         true,
+	"SELECT":         true,
+	"STARTTLS":       true,
+	"UNAUTHENTICATE": true,
+	"UNSELECT":       true,
+}
+
+// seqNumCommands contains the commands using message sequence numbers.
+var seqNumCommands = map[string]bool{
+	"COPY":   true,
+	"FETCH":  true,
+	"MOVE":   true,
+	"SEARCH": true,
+	"STORE":  true,
+}
+
+// noExpungeCommands contains the commands during which the server must not send
+// EXPUNGE responses, see RFC 3501 section 7.4.1.
+var noExpungeCommands = map[string]bool{
+	"FETCH":  true,
+	"SEARCH": true,
+	"STORE":  true,
+}
+
+// A Pipeline sends commands without waiting for the completion of the previous
+// ones, as allowed by RFC 3501 section 5.5. This saves a round trip per
+// command, which matters on high-latency links.
+//
+// A Pipeline holds the command queue of its client until it is closed: other
+// commands wait for Close. Commands are added with Execute, which, like
+// Client.Execute, works with raw commands and response handlers. Untagged
+// responses are passed to the handler of the oldest pending command first,
+// since servers process commands in order. Unhandled responses are processed
+// as usual, e.g. delivered to Client.Updates.
+//
+// Commands changing the connection state, such as SELECT or LOGOUT, can't be
+// pipelined. A command using message sequence numbers is only sent once the
+// pending commands during which the server can send EXPUNGE responses have
+// completed, so that sequence numbers are not ambiguous.
+//
+// The context of the client is honored while waiting for commands, see
+// Client.WithContext. Timeout and CommandTimeouts don't apply to pipelined
+// commands.
+type Pipeline struct {
+	c *Client
+
+	// Serializes Execute calls, so that commands are pending in the order
+	// they are sent.
+	sendLocker sync.Mutex
+
+	locker  sync.Mutex
+	pending []*PipelinedCommand
+	closed  bool
+}
+
+// A PipelinedCommand is a command sent in a pipeline.
+type PipelinedCommand struct {
+	p    *Pipeline
+	name string
+	tag  string
+	h    responses.Handler
+
+	done   chan struct{}
+	status *imap.StatusResp
+	err    error
+}
+
+// Pipeline starts a pipeline. It waits for previously issued commands to
+// complete. The pipeline must be closed to allow other commands to be sent.
+func (c *Client) Pipeline() (*Pipeline, error) {
+	ctx := c.Context()
+	if !c.queue.acquire(ctx.Done()) {
+		return nil, ctx.Err()
+	}
+	if c.State() == imap.LogoutState {
+		c.queue.release()
+		return nil, c.closedErr()
+	}
+
+	p := &Pipeline{c: c}
+	c.registerHandler(p)
+	return p, nil
+}
+
+// Execute sends a command in the pipeline. It doesn't wait for the command to
+// complete, the result can be retrieved with the Wait method of the returned
+// command. h is passed the untagged responses of the command, it can be nil.
+//
+// Execute returns once the command has been sent. If the command contains a
+// synchronizing literal, this requires the server to accept the literal.
+func (p *Pipeline) Execute(cmdr imap.Commander, h responses.Handler) *PipelinedCommand {
+	p.sendLocker.Lock()
+	defer p.sendLocker.Unlock()
+
+	cmd := cmdr.Command()
+	cmd.Tag = generateTag()
+	pc := &PipelinedCommand{
+		p:    p,
+		name: commandName(cmd),
+		tag:  cmd.Tag,
+		h:    h,
+		done: make(chan struct{}),
+	}
+
+	if unpipelinable[pc.name] {
+		pc.complete(nil, fmt.Errorf("imap: %v can't be pipelined", pc.name))
+		return pc
+	}
+
+	if seqNumCommands[pc.name] {
+		for _, pending := range p.pendingCommands() {
+			if !noExpungeCommands[pending.name] {
+				pending.Wait()
+			}
+		}
+	}
+
+	p.locker.Lock()
+	if p.closed {
+		p.locker.Unlock()
+		pc.complete(nil, ErrPipelineClosed)
+		return pc
+	}
+	p.pending = append(p.pending, pc)
+	p.locker.Unlock()
+
+	// The command may have already been completed, e.g. by Wait if the
+	// connection has been closed
+	if err := p.send(cmd, pc); err != nil && p.remove(pc) {
+		pc.complete(nil, err)
+	}
+	return pc
+}
+
+// send writes a command, aborting if it's rejected before it has been
+// entirely sent.
+func (p *Pipeline) send(cmd *imap.Command, pc *PipelinedCommand) error {
+	c := p.c
+	if c.State() == imap.LogoutState {
+		return c.closedErr()
+	}
+	ctx := c.Context()
+
+	doneWrite := make(chan error, 1)
+	go func() {
+		doneWrite <- c.writeLocked(func(w *imap.Writer) error {
+			return cmd.WriteTo(w)
+		})
+	}()
+
+	select {
+	case err := <-doneWrite:
+		if err != nil && c.State() == imap.LogoutState {
+			return c.closedErr()
+		}
+		return err
+	case <-pc.done:
+		// The server has rejected the command instead of accepting a literal
+		select {
+		case c.continues <- false:
+			<-doneWrite
+		case <-doneWrite:
+		}
+		return nil
+	case <-c.loggedOut:
+		return c.closedErr()
+	case <-ctx.Done():
+		c.abort()
+		select {
+		case c.continues <- false:
+			<-doneWrite
+		case <-doneWrite:
+		}
+		return ctx.Err()
+	}
+}
+
+// Close waits for all pending commands to complete and releases the command
+// queue. It returns an error if the connection has been closed while waiting.
+// The results of the commands can still be retrieved after Close.
+func (p *Pipeline) Close() error {
+	p.sendLocker.Lock()
+	defer p.sendLocker.Unlock()
+
+	p.locker.Lock()
+	if p.closed {
+		p.locker.Unlock()
+		return ErrPipelineClosed
+	}
+	p.closed = true
+	p.locker.Unlock()
+
+	for _, pc := range p.pendingCommands() {
+		pc.Wait()
+	}
+
+	p.c.unregisterHandler(p)
+	p.c.queue.release()
+
+	if p.c.State() == imap.LogoutState {
+		return p.c.closedErr()
+	}
+	return nil
+}
+
+func (p *Pipeline) pendingCommands() []*PipelinedCommand {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	return append([]*PipelinedCommand(nil), p.pending...)
+}
+
+func (p *Pipeline) remove(pc *PipelinedCommand) bool {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	for i, pending := range p.pending {
+		if pending == pc {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Handle implements responses.Handler. It must not be called directly.
+func (p *Pipeline) Handle(resp imap.Resp) error {
+	if _, ok := resp.(*imap.ContinuationReq); ok {
+		return responses.ErrUnhandled
+	}
+
+	if status, ok := resp.(*imap.StatusResp); ok && status.Tag != "" && status.Tag != "*" {
+		for _, pc := range p.pendingCommands() {
+			if pc.tag != status.Tag {
+				continue
+			}
+			if p.remove(pc) {
+				p.c.locker.Lock()
+				p.c.lastStatus = status
+				p.c.locker.Unlock()
+				pc.complete(status, nil)
+			}
+			return nil
+		}
+		return responses.ErrUnhandled
+	}
+
+	for _, pc := range p.pendingCommands() {
+		if pc.h == nil {
+			continue
+		}
+		if err := pc.h.Handle(resp); err == responses.ErrUnhandled {
+			continue
+		} else if err != nil {
+			// If the response handler returns an error, abort the command
+			if p.remove(pc) {
+				pc.complete(nil, err)
+			}
+		}
+		return nil
+	}
+	return responses.ErrUnhandled
+}
+
+// fail completes all pending commands with err.
+func (p *Pipeline) fail(err error) {
+	for _, pc := range p.pendingCommands() {
+		if p.remove(pc) {
+			pc.complete(nil, err)
+		}
+	}
+}
+
+func (pc *PipelinedCommand) complete(status *imap.StatusResp, err error) {
+	pc.status = status
+	pc.err = err
+	close(pc.done)
+}
+
+// Done returns a channel which is closed when the command has completed.
+func (pc *PipelinedCommand) Done() <-chan struct{} {
+	return pc.done
+}
+
+// Wait waits for the command to complete. Like Client.Execute, it returns the
+// tagged status response of the command, or an error if the command couldn't
+// be sent or if the connection has been closed.
+func (pc *PipelinedCommand) Wait() (*imap.StatusResp, error) {
+	c := pc.p.c
+	ctx := c.Context()
+
+	select {
+	case <-pc.done:
+	case <-c.loggedOut:
+		pc.p.fail(c.closedErr())
+	case <-ctx.Done():
+		// Like other commands, the connection is closed
+		c.abort()
+		pc.p.fail(ctx.Err())
+	}
+
+	<-pc.done
+	return pc.status, pc.err
+}
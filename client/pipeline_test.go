@@ -0,0 +1,197 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+)
+
+func TestPipeline(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	p, err := c.Pipeline()
+	if err != nil {
+		t.Fatal("c.Pipeline() =", err)
+	}
+
+	names := []string{"INBOX", "Sent", "Trash"}
+	statuses := make([]*responses.Status, len(names))
+	cmds := make([]*PipelinedCommand, len(names))
+	for i, name := range names {
+		statuses[i] = &responses.Status{}
+		cmd := &commands.Status{Mailbox: name, Items: []imap.StatusItem{imap.StatusMessages}}
+		cmds[i] = p.Execute(cmd, statuses[i])
+	}
+
+	// All commands are sent before any response
+	tags := make([]string, len(names))
+	for i, name := range names {
+		var cmd string
+		tags[i], cmd = s.ScanCmd()
+		if want := "STATUS " + name + " (MESSAGES)"; cmd != want {
+			t.Fatalf("client sent command %v, want %v", cmd, want)
+		}
+	}
+
+	for i, name := range names {
+		s.WriteString(fmt.Sprintf("* STATUS %v (MESSAGES %v)\r\n", name, i+1))
+		if i == 1 {
+			s.WriteString(tags[i] + " NO No such mailbox\r\n")
+		} else {
+			s.WriteString(tags[i] + " OK STATUS completed\r\n")
+		}
+	}
+
+	for i, name := range names {
+		status, err := cmds[i].Wait()
+		if err != nil {
+			t.Fatalf("Wait() for %v = %v", name, err)
+		}
+		want := imap.StatusRespOk
+		if i == 1 {
+			want = imap.StatusRespNo
+		}
+		if status.Type != want {
+			t.Errorf("status type for %v = %v, want %v", name, status.Type, want)
+		}
+		if mbox := statuses[i].Mailbox; mbox == nil || mbox.Name != name || mbox.Messages != uint32(i+1) {
+			t.Errorf("invalid status for %v: %+v", name, mbox)
+		}
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal("p.Close() =", err)
+	}
+
+	// The queue has been released
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Noop()
+	}()
+	tag, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatal("Bad command:", cmd)
+	}
+	s.WriteString(tag + " OK NOOP completed\r\n")
+	if err := <-done; err != nil {
+		t.Fatal("c.Noop() =", err)
+	}
+}
+
+func TestPipeline_SeqNums(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, &imap.MailboxStatus{Name: "INBOX", Messages: 10})
+
+	p, err := c.Pipeline()
+	if err != nil {
+		t.Fatal("c.Pipeline() =", err)
+	}
+	defer p.Close()
+
+	seqset, _ := imap.ParseSeqSet("1:2")
+	uidCopy := p.Execute(&commands.Uid{Cmd: &commands.Copy{SeqSet: seqset, Mailbox: "Archive"}}, nil)
+
+	// The server may send EXPUNGE responses during UID COPY, the FETCH
+	// command must wait
+	fetched := make(chan *PipelinedCommand, 1)
+	go func() {
+		fetch := &commands.Fetch{SeqSet: seqset, Items: []imap.FetchItem{imap.FetchUid}}
+		fetched <- p.Execute(fetch, nil)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "UID COPY 1:2 Archive" {
+		t.Fatal("Bad command:", cmd)
+	}
+
+	select {
+	case <-fetched:
+		t.Fatal("FETCH has been sent before UID COPY has completed")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	s.WriteString(tag + " OK UID COPY completed\r\n")
+	if _, err := uidCopy.Wait(); err != nil {
+		t.Fatal("Wait() =", err)
+	}
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "FETCH 1:2 (UID)" {
+		t.Fatal("Bad command:", cmd)
+	}
+	s.WriteString(tag + " OK FETCH completed\r\n")
+	if _, err := (<-fetched).Wait(); err != nil {
+		t.Fatal("Wait() =", err)
+	}
+}
+
+func TestPipeline_Unpipelinable(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+
+	p, err := c.Pipeline()
+	if err != nil {
+		t.Fatal("c.Pipeline() =", err)
+	}
+
+	_, err = p.Execute(&commands.Select{Mailbox: "INBOX"}, nil).Wait()
+	if err == nil || !strings.Contains(err.Error(), "SELECT") {
+		t.Errorf("Wait() = %v, want an error", err)
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal("p.Close() =", err)
+	}
+	if _, err := p.Execute(&commands.Noop{}, nil).Wait(); err != ErrPipelineClosed {
+		t.Errorf("Wait() = %v, want %v", err, ErrPipelineClosed)
+	}
+}
+
+func TestPipeline_SendAfterFail(t *testing.T) {
+	// The outcome depends on which goroutine notices the closed connection
+	// first, try several times
+	for i := 0; i < 20; i++ {
+		c, s := newTestClient(t)
+		setClientState(c, imap.AuthenticatedState, nil)
+
+		p, err := c.Pipeline()
+		if err != nil {
+			t.Fatal("c.Pipeline() =", err)
+		}
+
+		status := p.Execute(&commands.Status{Mailbox: "INBOX", Items: []imap.StatusItem{imap.StatusMessages}}, nil)
+		s.ScanCmd()
+
+		done := make(chan *PipelinedCommand, 1)
+		go func() {
+			msg := bytes.NewBufferString("Hello World!")
+			done <- p.Execute(&commands.Append{Mailbox: "INBOX", Message: msg}, nil)
+		}()
+
+		// The connection dies while the literal is being sent, Wait fails
+		// the pending commands
+		s.ScanCmd()
+		s.Close()
+		if _, err := status.Wait(); err == nil {
+			t.Fatal("Wait() succeeded after the connection was closed")
+		}
+
+		if _, err := (<-done).Wait(); err == nil {
+			t.Fatal("Wait() succeeded after the connection was closed")
+		}
+		p.Close()
+	}
+}
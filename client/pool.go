@@ -0,0 +1,228 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// ErrPoolClosed is returned by Pool.Get once the pool has been closed.
+var ErrPoolClosed = errors.New("imap: pool closed")
+
+// A Pool maintains up to Size authenticated connections to an account, for
+// instance to synchronize several mailboxes concurrently. Clients are checked
+// out with Get and returned with Put, or used with Do. Connections are opened
+// on demand, kept open while idle and sent NOOP commands every KeepAlive so
+// that the server doesn't close them. Dead connections are discarded and
+// replaced by new ones.
+//
+// Clients are checked out in the state the previous user left them in, e.g.
+// with a mailbox selected.
+//
+// A Pool is safe to use from multiple goroutines. Its fields must not be
+// changed once it's in use.
+type Pool struct {
+	// Dial opens a new connection, e.g. with DialTLS. It must be set.
+	Dial func() (*Client, error)
+	// Login authenticates a new connection, e.g. with Client.Login. It isn't
+	// called if the server has pre-authenticated the connection.
+	Login func(c *Client) error
+
+	// Size is the maximum number of connections. It must be positive.
+	Size int
+	// KeepAlive, if not zero, is the interval at which NOOP commands are sent
+	// on idle connections.
+	KeepAlive time.Duration
+
+	initOnce sync.Once
+	// Contains a value per open connection.
+	slots chan struct{}
+	idle  chan *pooledClient
+	stop  chan struct{}
+	done  chan struct{}
+
+	locker sync.Mutex
+	closed bool
+}
+
+type pooledClient struct {
+	c *Client
+	// The time the client has been returned to the pool, or the time of the
+	// last keepalive.
+	since time.Time
+}
+
+func (p *Pool) init() {
+	p.initOnce.Do(func() {
+		p.slots = make(chan struct{}, p.Size)
+		p.idle = make(chan *pooledClient, p.Size)
+		p.stop = make(chan struct{})
+		p.done = make(chan struct{})
+		if p.KeepAlive > 0 {
+			go p.keepAlive()
+		} else {
+			close(p.done)
+		}
+	})
+}
+
+func (p *Pool) isClosed() bool {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	return p.closed
+}
+
+// Get checks out a client, waiting for one to be available if Size
+// connections are in use. The client must be returned with Put.
+func (p *Pool) Get(ctx context.Context) (*Client, error) {
+	p.init()
+
+	for {
+		if p.isClosed() {
+			return nil, ErrPoolClosed
+		}
+
+		var pc *pooledClient
+		select {
+		case pc = <-p.idle:
+		default:
+			select {
+			case pc = <-p.idle:
+			case p.slots <- struct{}{}:
+				c, err := p.connect()
+				if err != nil {
+					<-p.slots
+					return nil, err
+				}
+				return c, nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if !isClosed(pc.c) {
+			return pc.c, nil
+		}
+		p.discard(pc.c)
+	}
+}
+
+// connect opens and authenticates a new connection.
+func (p *Pool) connect() (*Client, error) {
+	c, err := p.Dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Login != nil && c.State() == imap.NotAuthenticatedState {
+		if err := p.Login(c); err != nil {
+			c.abort()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// discard closes a connection and frees its slot.
+func (p *Pool) discard(c *Client) {
+	if !isClosed(c) {
+		c.Logout()
+	}
+	<-p.slots
+}
+
+// Put returns a client checked out with Get to the pool. Clients whose
+// connection has been closed are discarded.
+func (p *Pool) Put(c *Client) {
+	p.locker.Lock()
+	if !p.closed && !isClosed(c) {
+		p.idle <- &pooledClient{c, time.Now()}
+		p.locker.Unlock()
+		return
+	}
+	p.locker.Unlock()
+
+	p.discard(c)
+}
+
+// Do checks out a client, calls f with it and returns it to the pool. The
+// error returned by f is returned.
+func (p *Pool) Do(ctx context.Context, f func(c *Client) error) error {
+	c, err := p.Get(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.Put(c)
+
+	return f(c)
+}
+
+func (p *Pool) keepAlive() {
+	defer close(p.done)
+
+	// Check idle connections twice per interval, so that they're not kept
+	// idle much longer than KeepAlive
+	interval := p.KeepAlive / 2
+	if interval <= 0 {
+		interval = p.KeepAlive
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+
+		for n := len(p.idle); n > 0; n-- {
+			var pc *pooledClient
+			select {
+			case pc = <-p.idle:
+			default:
+			}
+			if pc == nil {
+				break
+			}
+
+			if time.Since(pc.since) >= p.KeepAlive {
+				if err := pc.c.Noop(); err != nil {
+					p.discard(pc.c)
+					continue
+				}
+				pc.since = time.Now()
+			}
+			p.idle <- pc
+		}
+	}
+}
+
+// Close logs out idle connections. Connections checked out are logged out
+// when they are returned to the pool. Get can't be called anymore.
+func (p *Pool) Close() error {
+	p.init()
+
+	p.locker.Lock()
+	if p.closed {
+		p.locker.Unlock()
+		return ErrPoolClosed
+	}
+	p.closed = true
+	p.locker.Unlock()
+
+	close(p.stop)
+	<-p.done
+
+	for {
+		select {
+		case pc := <-p.idle:
+			p.discard(pc.c)
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// poolServer accepts connections and answers OK to all commands. Received
+// commands are sent to cmds, accepted connections to conns.
+func poolServer(t *testing.T) (l net.Listener, conns chan net.Conn, cmds chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conns = make(chan net.Conn, 10)
+	cmds = make(chan string, 100)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+
+			go func() {
+				io.WriteString(conn, "* OK [CAPABILITY IMAP4rev1] Server ready.\r\n")
+
+				s := newCmdScanner(conn)
+				for s.scanner.Scan() {
+					parts := strings.SplitN(s.scanner.Text(), " ", 2)
+					cmds <- parts[1]
+					if parts[1] == "LOGOUT" {
+						io.WriteString(conn, "* BYE\r\n")
+					}
+					io.WriteString(conn, parts[0]+" OK Completed\r\n")
+				}
+			}()
+		}
+	}()
+	return l, conns, cmds
+}
+
+func TestPool(t *testing.T) {
+	l, conns, cmds := poolServer(t)
+	defer l.Close()
+
+	p := &Pool{
+		Dial: func() (*Client, error) {
+			return Dial(l.Addr().String())
+		},
+		Login: func(c *Client) error {
+			return c.Login("username", "password")
+		},
+		Size: 2,
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	c1, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal("p.Get() =", err)
+	}
+	c2, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal("p.Get() =", err)
+	}
+	if c1 == c2 {
+		t.Fatal("p.Get() returned the same client twice")
+	}
+	for i := 0; i < 2; i++ {
+		if cmd := <-cmds; cmd != "LOGIN username password" {
+			t.Fatalf("client sent command %v, want LOGIN", cmd)
+		}
+	}
+
+	// The pool is full
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(timeoutCtx); err != context.DeadlineExceeded {
+		t.Fatalf("p.Get() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Idle connections are reused
+	p.Put(c1)
+	if c, err := p.Get(ctx); err != nil {
+		t.Fatal("p.Get() =", err)
+	} else if c != c1 {
+		t.Fatal("p.Get() didn't reuse the idle client")
+	}
+
+	// Dead connections are replaced
+	(<-conns).Close()
+	<-c1.LoggedOut()
+	p.Put(c1)
+
+	c3, err := p.Get(ctx)
+	if err != nil {
+		t.Fatal("p.Get() =", err)
+	}
+	if c3 == c1 {
+		t.Fatal("p.Get() returned a dead client")
+	}
+	if cmd := <-cmds; cmd != "LOGIN username password" {
+		t.Fatalf("client sent command %v, want LOGIN", cmd)
+	}
+
+	p.Put(c2)
+	p.Put(c3)
+}
+
+func TestPool_KeepAlive(t *testing.T) {
+	l, _, cmds := poolServer(t)
+	defer l.Close()
+
+	p := &Pool{
+		Dial: func() (*Client, error) {
+			return Dial(l.Addr().String())
+		},
+		Size:      1,
+		KeepAlive: 20 * time.Millisecond,
+	}
+
+	if err := p.Do(context.Background(), func(c *Client) error { return nil }); err != nil {
+		t.Fatal("p.Do() =", err)
+	}
+
+	select {
+	case cmd := <-cmds:
+		if cmd != "NOOP" {
+			t.Fatalf("client sent command %v, want NOOP", cmd)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no NOOP sent on the idle connection")
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal("p.Close() =", err)
+	}
+	for cmd := range cmds {
+		if cmd == "LOGOUT" {
+			break
+		}
+	}
+	if _, err := p.Get(context.Background()); err != ErrPoolClosed {
+		t.Fatalf("p.Get() = %v, want %v", err, ErrPoolClosed)
+	}
+}
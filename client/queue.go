@@ -0,0 +1,65 @@
+package client
+
+import (
+	"sync"
+)
+
+// cmdQueue is a first-in, first-out lock used to send commands one at a time.
+// Goroutines waiting for the queue are granted it in the order they called
+// acquire. The zero value is an empty queue.
+type cmdQueue struct {
+	locker  sync.Mutex
+	busy    bool
+	waiting []chan struct{}
+}
+
+// acquire blocks until all commands queued before have completed. It returns
+// false if done is closed before, in which case the queue isn't acquired.
+func (q *cmdQueue) acquire(done <-chan struct{}) bool {
+	q.locker.Lock()
+	if !q.busy {
+		q.busy = true
+		q.locker.Unlock()
+		return true
+	}
+
+	ch := make(chan struct{})
+	q.waiting = append(q.waiting, ch)
+	q.locker.Unlock()
+
+	select {
+	case <-ch:
+		return true
+	case <-done:
+	}
+
+	q.locker.Lock()
+	for i, waiting := range q.waiting {
+		if waiting == ch {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			q.locker.Unlock()
+			return false
+		}
+	}
+	q.locker.Unlock()
+
+	// The queue has been handed over in the meantime, pass it on
+	q.release()
+	return false
+}
+
+// release hands the queue over to the next waiting goroutine, if any.
+func (q *cmdQueue) release() {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	if len(q.waiting) == 0 {
+		q.busy = false
+		return
+	}
+
+	// The queue stays busy, ownership is transferred
+	ch := q.waiting[0]
+	q.waiting = q.waiting[1:]
+	close(ch)
+}
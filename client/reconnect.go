@@ -0,0 +1,252 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// ErrReconnectorClosed is returned by Reconnector methods once it has been
+// closed.
+var ErrReconnectorClosed = errors.New("imap: reconnector closed")
+
+// ReconnectUpdate is delivered on Reconnector.Updates when a dropped
+// connection has been replaced. Err is the error which caused the previous
+// connection to be closed. Mailbox is the status of the mailbox selected
+// again, nil if no mailbox was selected. Its UidValidity should be checked
+// against the previous one, since messages may have been renumbered.
+type ReconnectUpdate struct {
+	Err     error
+	Mailbox *imap.MailboxStatus
+}
+
+// A Reconnector keeps a session to a server alive across dropped connections.
+// When the connection has been closed, the next call to Client or Do dials a
+// new one, authenticates, enables the capabilities which were enabled with
+// Client.Enable and selects the previously selected mailbox again, in the same
+// mode.
+//
+// The session state is recorded when Client and Do are called. Commands which
+// failed because the connection dropped are not sent again, since they may
+// have been executed by the server: it's up to the caller to retry them.
+//
+// A Reconnector is safe to use from multiple goroutines.
+type Reconnector struct {
+	// Dial opens a new connection, e.g. with DialTLS. It must be set.
+	Dial func() (*Client, error)
+	// Login authenticates a new connection, e.g. with Client.Login. It isn't
+	// called if the server has pre-authenticated the connection.
+	Login func(c *Client) error
+
+	// Updates, if not nil, is set as the Updates channel of each client and
+	// receives a *ReconnectUpdate after each reconnection.
+	Updates chan<- interface{}
+
+	// RetryPolicy specifies how connection attempts are retried when they
+	// fail. If nil, a single attempt is made by each call to Client or Do.
+	RetryPolicy *RetryPolicy
+
+	// done is closed by Close, to interrupt the delay between connection
+	// attempts.
+	doneOnce  sync.Once
+	closeOnce sync.Once
+	done      chan struct{}
+
+	locker   sync.Mutex
+	c        *Client
+	closed   bool
+	mailbox  string
+	readOnly bool
+	enabled  []string
+}
+
+// Client returns the current client, connecting first if the connection has
+// been closed. The client must not be logged out directly, see Close.
+func (r *Reconnector) Client() (*Client, error) {
+	c, update, err := r.client()
+	if update != nil {
+		// The lock isn't held, since the receiver may call Client as well
+		r.Updates <- update
+	}
+	return c, err
+}
+
+// doneChan returns the channel closed by Close.
+func (r *Reconnector) doneChan() chan struct{} {
+	r.doneOnce.Do(func() {
+		r.done = make(chan struct{})
+	})
+	return r.done
+}
+
+// client returns the current client, connecting first if the connection has
+// been closed. If a new connection replaces a dropped one, the update to
+// deliver is returned.
+func (r *Reconnector) client() (*Client, *ReconnectUpdate, error) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.closed {
+		return nil, nil, ErrReconnectorClosed
+	}
+	if r.c != nil && !isClosed(r.c) {
+		r.record(r.c)
+		return r.c, nil, nil
+	}
+
+	old := r.c
+	r.c = nil
+	if old != nil {
+		r.record(old)
+	}
+
+	var (
+		c    *Client
+		mbox *imap.MailboxStatus
+		err  error
+	)
+	delay := time.Duration(0)
+	if r.RetryPolicy != nil {
+		delay = r.RetryPolicy.Delay
+	}
+	for i := 0; ; i++ {
+		c, mbox, err = r.connect()
+		if err == nil || r.RetryPolicy == nil || i >= r.RetryPolicy.MaxRetries {
+			break
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-r.doneChan():
+			return nil, nil, ErrReconnectorClosed
+		}
+
+		delay *= 2
+		if r.RetryPolicy.MaxDelay > 0 && delay > r.RetryPolicy.MaxDelay {
+			delay = r.RetryPolicy.MaxDelay
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	r.c = c
+
+	if old != nil && r.Updates != nil {
+		return c, &ReconnectUpdate{Err: old.closedErr(), Mailbox: mbox}, nil
+	}
+	return c, nil, nil
+}
+
+// connect dials a new connection and restores the session state.
+func (r *Reconnector) connect() (*Client, *imap.MailboxStatus, error) {
+	c, err := r.Dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.Updates != nil {
+		c.Updates = r.Updates
+	}
+
+	mbox, err := r.restore(c)
+	if err != nil {
+		c.abort()
+		return nil, nil, err
+	}
+	return c, mbox, nil
+}
+
+func (r *Reconnector) restore(c *Client) (*imap.MailboxStatus, error) {
+	if r.Login != nil && c.State() == imap.NotAuthenticatedState {
+		if err := r.Login(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(r.enabled) > 0 {
+		if _, err := c.Enable(r.enabled...); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.mailbox == "" {
+		return nil, nil
+	}
+	return c.Select(r.mailbox, r.readOnly)
+}
+
+// record saves the session state of a client. It must be called with r.locker
+// held.
+func (r *Reconnector) record(c *Client) {
+	// The state of a client which has logged out, e.g. because a command has
+	// been cancelled, has been reset. A client whose connection has been
+	// dropped by the server still has its last state.
+	if c.State() == imap.LogoutState {
+		return
+	}
+
+	if mbox := c.Mailbox(); mbox != nil {
+		r.mailbox, r.readOnly = mbox.Name, mbox.ReadOnly
+	} else {
+		r.mailbox, r.readOnly = "", false
+	}
+
+	c.locker.Lock()
+	r.enabled = r.enabled[:0]
+	for cap := range c.enabled {
+		r.enabled = append(r.enabled, cap)
+	}
+	c.locker.Unlock()
+}
+
+// Do calls f with the current client, connecting first if the connection has
+// been closed. The error returned by f is returned.
+func (r *Reconnector) Do(f func(c *Client) error) error {
+	c, err := r.Client()
+	if err != nil {
+		return err
+	}
+
+	err = f(c)
+
+	r.locker.Lock()
+	if r.c == c {
+		r.record(c)
+	}
+	r.locker.Unlock()
+
+	return err
+}
+
+// Close logs out the current client, if it's connected. The reconnector can't
+// be used anymore. A call to Client or Do waiting to retry a connection attempt
+// is interrupted.
+func (r *Reconnector) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.doneChan())
+	})
+
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.closed {
+		return ErrReconnectorClosed
+	}
+	r.closed = true
+
+	if r.c == nil || isClosed(r.c) {
+		return nil
+	}
+	return r.c.Logout()
+}
+
+// isClosed checks if the connection of a client has been closed.
+func isClosed(c *Client) bool {
+	select {
+	case <-c.LoggedOut():
+		return true
+	default:
+		return c.State() == imap.LogoutState
+	}
+}
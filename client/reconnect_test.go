@@ -0,0 +1,213 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// serveScript accepts a connection and answers the expected commands with the
+// provided untagged responses, then closes the connection.
+func serveScript(t *testing.T, l net.Listener, script [][2]string) {
+	conn, err := l.Accept()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "* OK [CAPABILITY IMAP4rev1 ENABLE] Server ready.\r\n")
+
+	s := newCmdScanner(conn)
+	for _, step := range script {
+		tag, cmd := s.ScanCmd()
+		if cmd != step[0] {
+			t.Errorf("client sent command %v, want %v", cmd, step[0])
+			return
+		}
+		io.WriteString(conn, step[1]+tag+" OK Completed\r\n")
+	}
+}
+
+func TestReconnector(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		serveScript(t, l, [][2]string{
+			{"LOGIN username password", ""},
+			{"ENABLE UTF8=ACCEPT", "* ENABLED UTF8=ACCEPT\r\n"},
+			{"EXAMINE INBOX", "* 3 EXISTS\r\n* OK [UIDVALIDITY 42] UIDs valid\r\n"},
+		})
+
+		// The connection has been dropped, the session is restored
+		serveScript(t, l, [][2]string{
+			{"LOGIN username password", ""},
+			{"ENABLE UTF8=ACCEPT", "* ENABLED UTF8=ACCEPT\r\n"},
+			{"EXAMINE INBOX", "* 4 EXISTS\r\n* OK [UIDVALIDITY 42] UIDs valid\r\n"},
+			{"NOOP", ""},
+		})
+	}()
+
+	updates := make(chan interface{}, 10)
+	r := &Reconnector{
+		Dial: func() (*Client, error) {
+			return Dial(l.Addr().String())
+		},
+		Login: func(c *Client) error {
+			return c.Login("username", "password")
+		},
+		Updates: updates,
+	}
+
+	var first *Client
+	err = r.Do(func(c *Client) error {
+		first = c
+		if _, err := c.Enable(imap.UTF8Accept); err != nil {
+			return err
+		}
+		_, err := c.Select("INBOX", true)
+		return err
+	})
+	if err != nil {
+		t.Fatal("r.Do() =", err)
+	}
+
+	<-first.LoggedOut()
+
+	err = r.Do(func(c *Client) error {
+		if c == first {
+			t.Error("r.Do() called f with the closed client")
+		}
+		if mbox := c.Mailbox(); mbox == nil || mbox.Name != "INBOX" || !mbox.ReadOnly {
+			t.Errorf("mailbox not selected again: %+v", mbox)
+		}
+		return c.Noop()
+	})
+	if err != nil {
+		t.Fatal("r.Do() =", err)
+	}
+
+	<-done
+
+	var update *ReconnectUpdate
+	for len(updates) > 0 {
+		if u, ok := (<-updates).(*ReconnectUpdate); ok {
+			update = u
+		}
+	}
+	if update == nil {
+		t.Fatal("no ReconnectUpdate delivered")
+	}
+	if update.Mailbox == nil || update.Mailbox.Messages != 4 || update.Mailbox.UidValidity != 42 {
+		t.Errorf("invalid mailbox in ReconnectUpdate: %+v", update.Mailbox)
+	}
+}
+
+func TestReconnector_UpdatesFull(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serveScript(t, l, nil)
+		serveScript(t, l, [][2]string{{"NOOP", ""}})
+	}()
+
+	updates := make(chan interface{}, 1)
+	dialed := make(chan struct{}, 2)
+	r := &Reconnector{
+		Dial: func() (*Client, error) {
+			defer func() { dialed <- struct{}{} }()
+			return Dial(l.Addr().String())
+		},
+		Updates: updates,
+	}
+
+	first, err := r.Client()
+	if err != nil {
+		t.Fatal("r.Client() =", err)
+	}
+	<-dialed
+	<-first.LoggedOut()
+
+	// The reconnection update can't be delivered until the channel is drained
+	updates <- "full"
+	reconnected := make(chan error, 1)
+	go func() {
+		_, err := r.Client()
+		reconnected <- err
+	}()
+	<-dialed
+
+	// Other calls don't wait for the update to be delivered
+	got := make(chan *Client, 1)
+	go func() {
+		c, _ := r.Client()
+		got <- c
+	}()
+	var c *Client
+	select {
+	case c = <-got:
+	case <-time.After(time.Second):
+		t.Fatal("r.Client() blocked by the pending update")
+	}
+	if c == nil || c == first {
+		t.Fatal("r.Client() didn't return the new client")
+	}
+
+	<-updates
+	if _, ok := (<-updates).(*ReconnectUpdate); !ok {
+		t.Error("no ReconnectUpdate delivered")
+	}
+	if err := <-reconnected; err != nil {
+		t.Fatal("r.Client() =", err)
+	}
+
+	if err := c.Noop(); err != nil {
+		t.Fatal("c.Noop() =", err)
+	}
+	<-done
+}
+
+func TestReconnector_CloseDuringRetry(t *testing.T) {
+	dialErr := errors.New("connection refused")
+	r := &Reconnector{
+		Dial: func() (*Client, error) {
+			return nil, dialErr
+		},
+		RetryPolicy: &RetryPolicy{MaxRetries: 10, Delay: time.Hour},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Client()
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	r.Close()
+
+	select {
+	case err := <-done:
+		if err != ErrReconnectorClosed {
+			t.Fatalf("r.Client() = %v, want %v", err, ErrReconnectorClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("r.Client() is still waiting to retry after Close")
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+)
+
+// RetryPolicy describes how commands are retried when the server reports a
+// transient failure with the INUSE or SERVERBUG response codes (RFC 5530).
+//
+// Only idempotent commands are retried: SELECT, EXAMINE, FETCH, SEARCH and
+// STATUS. Other commands, such as STORE or APPEND, always fail on the first
+// error. FETCH is only retried if the server hasn't sent any response yet,
+// since the messages already received would be delivered twice. If all
+// attempts fail, the last status response is returned, so the error still
+// carries the original response code.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of times a command is sent again.
+	MaxRetries int
+	// Delay is the time to wait before the first retry. It is doubled after
+	// each attempt.
+	Delay time.Duration
+	// MaxDelay, if not zero, caps the time to wait between two attempts.
+	MaxDelay time.Duration
+}
+
+// retryable checks if a command that failed with status can be sent again.
+func (p *RetryPolicy) retryable(status *imap.StatusResp) bool {
+	if status == nil || status.Type != imap.StatusRespNo {
+		return false
+	}
+	return status.Code == imap.CodeInUse || status.Code == imap.CodeServerBug
+}
+
+// executeRetry executes an idempotent command, retrying it according to
+// c.RetryPolicy.
+func (c *Client) executeRetry(cmdr imap.Commander, h responses.Handler) (*imap.StatusResp, error) {
+	return c.executeRetryIf(cmdr, h, nil)
+}
+
+// executeRetryIf is like executeRetry, but if canRetry is not nil, the command
+// is only retried if it returns true.
+func (c *Client) executeRetryIf(cmdr imap.Commander, h responses.Handler, canRetry func() bool) (*imap.StatusResp, error) {
+	status, err := c.execute(cmdr, h)
+
+	p := c.RetryPolicy
+	if p == nil {
+		return status, err
+	}
+
+	delay := p.Delay
+	for i := 0; i < p.MaxRetries && err == nil && p.retryable(status) && (canRetry == nil || canRetry()); i++ {
+		select {
+		case <-time.After(delay):
+		case <-c.loggedOut:
+			return nil, c.closedErr()
+		case <-c.Context().Done():
+			return nil, c.Context().Err()
+		}
+
+		delay *= 2
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+
+		status, err = c.execute(cmdr, h)
+	}
+	return status, err
+}
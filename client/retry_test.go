@@ -0,0 +1,158 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestClient_Select_Retry(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.RetryPolicy = &RetryPolicy{MaxRetries: 3, Delay: time.Millisecond}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Select("INBOX", false)
+		done <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		tag, cmd := s.ScanCmd()
+		if cmd != "SELECT INBOX" {
+			t.Fatalf("client sent command %v, want SELECT INBOX", cmd)
+		}
+		s.WriteString(tag + " NO [INUSE] Mailbox locked\r\n")
+	}
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "SELECT INBOX" {
+		t.Fatalf("client sent command %v, want SELECT INBOX", cmd)
+	}
+	s.WriteString("* 3 EXISTS\r\n")
+	s.WriteString(tag + " OK SELECT completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Select() = %v", err)
+	}
+	if mbox := c.Mailbox(); mbox == nil || mbox.Messages != 3 {
+		t.Fatalf("Invalid mailbox: %v", mbox)
+	}
+}
+
+func TestClient_Status_RetryExhausted(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.AuthenticatedState, nil)
+	c.RetryPolicy = &RetryPolicy{MaxRetries: 2, Delay: time.Millisecond}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Status("INBOX", []imap.StatusItem{imap.StatusMessages})
+		done <- err
+	}()
+
+	for i := 0; i < 3; i++ {
+		tag, cmd := s.ScanCmd()
+		if cmd != "STATUS INBOX (MESSAGES)" {
+			t.Fatalf("client sent command %v, want STATUS INBOX (MESSAGES)", cmd)
+		}
+		s.WriteString(tag + " NO [SERVERBUG] Internal error\r\n")
+	}
+
+	err := <-done
+	if statusErr, ok := err.(*imap.StatusError); !ok || statusErr.Code != imap.CodeServerBug {
+		t.Fatalf("c.Status() = %v, want a SERVERBUG error", err)
+	}
+}
+
+func TestClient_Store_NoRetry(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+	c.RetryPolicy = &RetryPolicy{MaxRetries: 3, Delay: time.Millisecond}
+
+	seqset, _ := imap.ParseSeqSet("2")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Store(seqset, imap.AddFlags, []interface{}{imap.SeenFlag}, nil)
+	}()
+
+	tag, _ := s.ScanCmd()
+	s.WriteString(tag + " NO [INUSE] Mailbox locked\r\n")
+
+	err := <-done
+	if statusErr, ok := err.(*imap.StatusError); !ok || statusErr.Code != imap.CodeInUse {
+		t.Fatalf("c.Store() = %v, want an INUSE error", err)
+	}
+
+	// The next command must not be a retried STORE
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want NOOP", cmd)
+	}
+	s.WriteString(tag + " OK NOOP completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Noop() = %v", err)
+	}
+}
+
+func TestClient_Fetch_RetryAfterData(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, nil)
+	c.RetryPolicy = &RetryPolicy{MaxRetries: 3, Delay: time.Millisecond}
+
+	seqset, _ := imap.ParseSeqSet("1:2")
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Fetch(seqset, []imap.FetchItem{imap.FetchUid}, messages)
+	}()
+
+	// Nothing has been delivered yet, the command is retried
+	tag, _ := s.ScanCmd()
+	s.WriteString(tag + " NO [INUSE] Mailbox locked\r\n")
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "FETCH 1:2 (UID)" {
+		t.Fatalf("client sent command %v, want FETCH 1:2 (UID)", cmd)
+	}
+	s.WriteString("* 1 FETCH (UID 42)\r\n")
+	s.WriteString(tag + " NO [SERVERBUG] Internal error\r\n")
+
+	err := <-done
+	if statusErr, ok := err.(*imap.StatusError); !ok || statusErr.Code != imap.CodeServerBug {
+		t.Fatalf("c.Fetch() = %v, want a SERVERBUG error", err)
+	}
+	if n := len(messages); n != 1 {
+		t.Errorf("c.Fetch() delivered %v messages, want 1", n)
+	}
+
+	// The next command must not be a retried FETCH
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatalf("client sent command %v, want NOOP", cmd)
+	}
+	s.WriteString(tag + " OK NOOP completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.Noop() = %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"sync"
+)
+
+// UpdatePolicy specifies how updates are delivered to Client.Updates when the
+// receiver is slower than the server.
+type UpdatePolicy int
+
+const (
+	// UpdateBlock delivers updates synchronously: no response is read until
+	// the update has been received. This is the default.
+	UpdateBlock UpdatePolicy = iota
+	// UpdateBuffer queues updates in memory until they are received, so that
+	// responses keep being read and commands complete while the receiver is
+	// busy. The queue is unbounded.
+	UpdateBuffer
+	// UpdateCoalesce queues updates like UpdateBuffer, but merges an update
+	// with the previous one if it hasn't been received yet and is about the
+	// same mailbox or message. For instance, repeated EXISTS responses for the
+	// selected mailbox result in a single *MailboxUpdate.
+	UpdateCoalesce
+	// UpdateDrop discards updates which can't be sent to Updates immediately.
+	// Since sequence numbers can't be tracked anymore once an *ExpungeUpdate
+	// has been dropped, this is only suitable when updates are used as hints,
+	// e.g. to trigger a synchronization.
+	UpdateDrop
+)
+
+// sendUpdate delivers an update to c.Updates according to c.UpdatePolicy.
+func (c *Client) sendUpdate(update interface{}) {
+	if c.Updates == nil {
+		return
+	}
+
+	// Updates still queued for the channel, if the policy has changed, must
+	// be delivered first
+	c.locker.Lock()
+	q := c.updateQueue
+	if q != nil && q.ch != c.Updates {
+		// Updates queued for the previous channel are still delivered to it
+		q = nil
+	}
+
+	switch c.UpdatePolicy {
+	case UpdateBuffer, UpdateCoalesce:
+		if q == nil {
+			q = &updateQueue{ch: c.Updates}
+			c.updateQueue = q
+		}
+		c.locker.Unlock()
+
+		q.push(update, c.UpdatePolicy == UpdateCoalesce)
+	case UpdateDrop:
+		c.locker.Unlock()
+
+		if q != nil && q.busy() {
+			break
+		}
+		select {
+		case c.Updates <- update:
+		default:
+		}
+	default:
+		c.locker.Unlock()
+
+		if q != nil {
+			q.wait()
+		}
+		c.Updates <- update
+	}
+}
+
+// updateQueue delivers queued updates to a channel in a separate goroutine.
+type updateQueue struct {
+	ch chan<- interface{}
+
+	locker sync.Mutex
+	// Updates not delivered yet, in order.
+	pending []interface{}
+	// True if a goroutine is delivering pending updates.
+	delivering bool
+	// Signaled when all pending updates have been delivered.
+	drained *sync.Cond
+}
+
+// push queues an update. If coalesce is true, it may be merged with the last
+// update not delivered yet.
+func (q *updateQueue) push(update interface{}, coalesce bool) {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	if coalesce && len(q.pending) > 0 && coalesceUpdate(q.pending[len(q.pending)-1], update) {
+		return
+	}
+
+	q.pending = append(q.pending, update)
+	if !q.delivering {
+		q.delivering = true
+		go q.deliver()
+	}
+}
+
+func (q *updateQueue) deliver() {
+	for {
+		q.locker.Lock()
+		if len(q.pending) == 0 {
+			q.delivering = false
+			if q.drained != nil {
+				q.drained.Broadcast()
+			}
+			q.locker.Unlock()
+			return
+		}
+		update := q.pending[0]
+		q.pending[0] = nil
+		q.pending = q.pending[1:]
+		q.locker.Unlock()
+
+		q.ch <- update
+	}
+}
+
+// busy checks if some updates haven't been delivered yet.
+func (q *updateQueue) busy() bool {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+	return q.delivering
+}
+
+// wait blocks until all pending updates have been delivered.
+func (q *updateQueue) wait() {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	if q.drained == nil {
+		q.drained = sync.NewCond(&q.locker)
+	}
+	for q.delivering {
+		q.drained.Wait()
+	}
+}
+
+// coalesceUpdate merges next into prev, an update which hasn't been delivered
+// yet. It returns false if both updates must be delivered.
+func coalesceUpdate(prev, next interface{}) bool {
+	switch prev := prev.(type) {
+	case *MailboxUpdate:
+		// Updates about the selected mailbox all point to its status, which
+		// has been updated in place. Updates about other mailboxes only
+		// contain the items which have changed, they can't be replaced.
+		next, ok := next.(*MailboxUpdate)
+		return ok && prev.Mailbox == next.Mailbox
+	case *MessageUpdate:
+		next, ok := next.(*MessageUpdate)
+		if !ok || prev.Message.SeqNum != next.Message.SeqNum {
+			return false
+		}
+		if prev.Message.Uid != 0 && next.Message.Uid != 0 && prev.Message.Uid != next.Message.Uid {
+			return false
+		}
+		prev.Message.Merge(next.Message)
+		return true
+	}
+	return false
+}
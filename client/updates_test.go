@@ -0,0 +1,149 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+// noopWithResponses executes NOOP, the server sends the provided responses
+// before completing it.
+func noopWithResponses(t *testing.T, c *Client, s *serverConn, responses string) {
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Noop()
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "NOOP" {
+		t.Fatal("Bad command:", cmd)
+	}
+	s.WriteString(responses)
+	s.WriteString(tag + " OK NOOP completed\r\n")
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal("c.Noop() =", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("c.Noop() blocked by a slow receiver")
+	}
+}
+
+func TestClient_UpdatePolicy_Buffer(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, &imap.MailboxStatus{Name: "INBOX", Items: make(map[imap.StatusItem]interface{})})
+
+	updates := make(chan interface{})
+	c.Updates = updates
+	c.UpdatePolicy = UpdateBuffer
+
+	noopWithResponses(t, c, s, "* 1 FETCH (FLAGS (\\Seen))\r\n* 2 FETCH (FLAGS (\\Seen))\r\n* 3 EXISTS\r\n")
+
+	for _, seqNum := range []uint32{1, 2} {
+		update, ok := (<-updates).(*MessageUpdate)
+		if !ok || update.Message.SeqNum != seqNum {
+			t.Fatalf("Expected a message update for %v, got %v", seqNum, update)
+		}
+	}
+	if update, ok := (<-updates).(*MailboxUpdate); !ok || update.Mailbox.Messages != 3 {
+		t.Fatalf("Expected a mailbox update, got %v", update)
+	}
+}
+
+func TestClient_UpdatePolicy_Coalesce(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, &imap.MailboxStatus{Name: "INBOX", Items: make(map[imap.StatusItem]interface{})})
+
+	updates := make(chan interface{})
+	c.Updates = updates
+	c.UpdatePolicy = UpdateCoalesce
+
+	noopWithResponses(t, c, s, "* 3 EXISTS\r\n* 4 EXISTS\r\n* 5 EXISTS\r\n* 1 EXPUNGE\r\n* 4 EXISTS\r\n")
+
+	// The first update may have been taken from the queue before the next
+	// ones have been received
+	var mailboxUpdates int
+	for {
+		update := <-updates
+		if _, ok := update.(*ExpungeUpdate); ok {
+			break
+		}
+		if _, ok := update.(*MailboxUpdate); !ok {
+			t.Fatalf("Expected a mailbox update, got %v", update)
+		}
+		mailboxUpdates++
+	}
+	if mailboxUpdates == 0 || mailboxUpdates > 2 {
+		t.Errorf("Expected 1 or 2 mailbox updates, got %v", mailboxUpdates)
+	}
+
+	// Updates are not merged across an expunge
+	if update, ok := (<-updates).(*MailboxUpdate); !ok || update.Mailbox.Messages != 4 {
+		t.Fatalf("Expected a mailbox update, got %v", update)
+	}
+}
+
+func TestClient_UpdatePolicy_Drop(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, &imap.MailboxStatus{Name: "INBOX", Items: make(map[imap.StatusItem]interface{})})
+
+	updates := make(chan interface{}, 1)
+	c.Updates = updates
+	c.UpdatePolicy = UpdateDrop
+
+	noopWithResponses(t, c, s, "* 3 EXISTS\r\n* 2 EXPUNGE\r\n")
+
+	if update, ok := (<-updates).(*MailboxUpdate); !ok {
+		t.Fatalf("Expected a mailbox update, got %v", update)
+	}
+	select {
+	case update := <-updates:
+		t.Fatalf("Update %v hasn't been dropped", update)
+	default:
+	}
+}
+
+func TestClient_UpdatePolicy_Change(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, &imap.MailboxStatus{Name: "INBOX", Items: make(map[imap.StatusItem]interface{})})
+
+	updates := make(chan interface{})
+	c.Updates = updates
+	c.UpdatePolicy = UpdateBuffer
+
+	noopWithResponses(t, c, s, "* 1 FETCH (FLAGS (\\Seen))\r\n* 2 FETCH (FLAGS (\\Seen))\r\n")
+
+	c.UpdatePolicy = UpdateCoalesce
+	noopWithResponses(t, c, s, "* 3 FETCH (FLAGS (\\Seen))\r\n")
+
+	// The queued updates are delivered before the blocking one
+	c.UpdatePolicy = UpdateBlock
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Noop()
+	}()
+	tag, _ := s.ScanCmd()
+	s.WriteString("* 4 FETCH (FLAGS (\\Seen))\r\n")
+	s.WriteString(tag + " OK NOOP completed\r\n")
+
+	for _, seqNum := range []uint32{1, 2, 3, 4} {
+		update, ok := (<-updates).(*MessageUpdate)
+		if !ok || update.Message.SeqNum != seqNum {
+			t.Fatalf("Expected a message update for %v, got %v", seqNum, update)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal("c.Noop() =", err)
+	}
+}
@@ -0,0 +1,120 @@
+package client
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+)
+
+// errWatcherStopped is returned by Watcher.Do when the watcher has stopped
+// without error.
+var errWatcherStopped = errors.New("Watcher is stopped")
+
+// Watcher keeps a client idling with Client.Idle to receive mailbox updates on
+// the client's Updates channel. Commands can be run in between with Do and
+// Execute. A Watcher is created with Client.Watch.
+type Watcher struct {
+	c *Client
+
+	cmds     chan *watchCmd
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	err      error
+}
+
+type watchCmd struct {
+	f    func() error
+	done chan error
+}
+
+// Watch starts idling in a background goroutine until Stop is called. The
+// client must not be used directly until then: commands must be run with the
+// watcher's Do or Execute methods. Like Idle, NOOP is sent every minute
+// instead if the server doesn't support IDLE.
+func (c *Client) Watch() (*Watcher, error) {
+	if err := c.ensureAuthenticated(); err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		c:    c,
+		cmds: make(chan *watchCmd),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+
+	for {
+		stop := make(chan struct{})
+		idleDone := make(chan error, 1)
+		go func() {
+			idleDone <- w.c.Idle(stop)
+		}()
+
+		select {
+		case cmd := <-w.cmds:
+			close(stop)
+			if err := <-idleDone; err != nil {
+				w.err = err
+				cmd.done <- err
+				return
+			}
+			cmd.done <- cmd.f()
+		case <-w.stop:
+			close(stop)
+			w.err = <-idleDone
+			return
+		case err := <-idleDone:
+			// Idle restarts IDLE by itself, it only returns early on error
+			close(stop)
+			w.err = err
+			return
+		}
+	}
+}
+
+// Do ends IDLE, calls f and enters IDLE again once f has returned. f can use
+// the client to send commands. Calls are serialized, so that only one command
+// is in flight at a time. The error returned by f is returned.
+func (w *Watcher) Do(f func() error) error {
+	cmd := &watchCmd{f: f, done: make(chan error, 1)}
+
+	select {
+	case w.cmds <- cmd:
+	case <-w.done:
+		if w.err != nil {
+			return w.err
+		}
+		return errWatcherStopped
+	}
+	return <-cmd.done
+}
+
+// Execute ends IDLE, executes a generic command and enters IDLE again. See
+// Client.Execute.
+func (w *Watcher) Execute(cmdr imap.Commander, h responses.Handler) (status *imap.StatusResp, err error) {
+	err = w.Do(func() error {
+		var err error
+		status, err = w.c.Execute(cmdr, h)
+		return err
+	})
+	return
+}
+
+// Stop ends IDLE and stops the watcher. The client can be used again once Stop
+// has returned. The error that stopped the watcher, if any, is returned.
+func (w *Watcher) Stop() error {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+	return w.err
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestWatcher_Do(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+	c.gotStatusCaps([]interface{}{"IMAP4rev1", "IDLE"})
+
+	updates := make(chan interface{}, 1)
+	c.Updates = updates
+
+	w, err := c.Watch()
+	if err != nil {
+		t.Fatalf("c.Watch() = %v", err)
+	}
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "IDLE" {
+		t.Fatalf("client sent command %v, want %v", cmd, "IDLE")
+	}
+	s.WriteString("+ idling\r\n")
+	s.WriteString("* 2 EXISTS\r\n")
+
+	if update, ok := (<-updates).(*MailboxUpdate); !ok || update.Mailbox.Messages != 2 {
+		t.Fatalf("Invalid update: %v", update)
+	}
+
+	// Fetch the new message
+	done := make(chan error, 1)
+	var msg *imap.Message
+	go func() {
+		done <- w.Do(func() error {
+			seqset := new(imap.SeqSet)
+			seqset.AddNum(2)
+
+			ch := make(chan *imap.Message, 1)
+			if err := c.Fetch(seqset, []imap.FetchItem{imap.FetchUid}, ch); err != nil {
+				return err
+			}
+			msg = <-ch
+			return nil
+		})
+	}()
+
+	if line := s.ScanLine(); line != "DONE" {
+		t.Fatalf("client sent %v, want DONE", line)
+	}
+	s.WriteString(tag + " OK IDLE terminated\r\n")
+
+	tag, cmd = s.ScanCmd()
+	if cmd != "FETCH 2 (UID)" {
+		t.Fatalf("client sent command %v, want %v", cmd, "FETCH 2 (UID)")
+	}
+	s.WriteString("* 2 FETCH (UID 42)\r\n")
+	s.WriteString(tag + " OK FETCH completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("w.Do() = %v", err)
+	}
+	if msg == nil || msg.Uid != 42 {
+		t.Fatalf("Invalid fetched message: %v", msg)
+	}
+
+	// IDLE must be resumed
+	tag, cmd = s.ScanCmd()
+	if cmd != "IDLE" {
+		t.Fatalf("client sent command %v, want %v", cmd, "IDLE")
+	}
+	s.WriteString("+ idling\r\n")
+
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- w.Stop()
+	}()
+
+	if line := s.ScanLine(); line != "DONE" {
+		t.Fatalf("client sent %v, want DONE", line)
+	}
+	s.WriteString(tag + " OK IDLE terminated\r\n")
+
+	if err := <-stopped; err != nil {
+		t.Fatalf("w.Stop() = %v", err)
+	}
+
+	// The watcher can't be used anymore
+	if err := w.Do(func() error { return nil }); err == nil {
+		t.Error("Expected an error when using a stopped watcher")
+	}
+}
+
+func TestWatcher_Poll(t *testing.T) {
+	c, s := newTestClient(t)
+	defer s.Close()
+
+	setClientState(c, imap.SelectedState, imap.NewMailboxStatus("INBOX", nil))
+
+	w, err := c.Watch()
+	if err != nil {
+		t.Fatalf("c.Watch() = %v", err)
+	}
+
+	// The server doesn't support IDLE, commands can still be run
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Do(c.Check)
+	}()
+
+	tag, cmd := s.ScanCmd()
+	if cmd != "CHECK" {
+		t.Fatalf("client sent command %v, want %v", cmd, "CHECK")
+	}
+	s.WriteString(tag + " OK CHECK completed\r\n")
+
+	if err := <-done; err != nil {
+		t.Fatalf("w.Do() = %v", err)
+	}
+	if err := w.Stop(); err != nil {
+		t.Fatalf("w.Stop() = %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+func parseACLMailbox(f interface{}) (string, error) {
+	mailbox, err := imap.ParseString(f)
+	if err != nil {
+		return "", err
+	}
+	if mailbox, err = imap.DecodeMailboxName(mailbox); err != nil {
+		return "", err
+	}
+	return imap.CanonicalMailboxName(mailbox), nil
+}
+
+// SetACL is a SETACL command, as defined in RFC 4314 section 3.1.
+type SetACL struct {
+	Mailbox    string
+	Identifier string
+	Mode       imap.ACLMode
+	Rights     imap.ACLRights
+}
+
+func (cmd *SetACL) Command() *imap.Command {
+	mailbox := imap.FormatMailboxName(cmd.Mailbox)
+
+	return &imap.Command{
+		Name:      "SETACL",
+		Arguments: []interface{}{mailbox, cmd.Identifier, imap.FormatACLModification(cmd.Mode, cmd.Rights)},
+	}
+}
+
+func (cmd *SetACL) Parse(fields []interface{}) error {
+	if len(fields) < 3 {
+		return errors.New("No enough arguments")
+	}
+
+	var err error
+	if cmd.Mailbox, err = parseACLMailbox(fields[0]); err != nil {
+		return err
+	}
+	if cmd.Identifier, err = imap.ParseString(fields[1]); err != nil {
+		return err
+	}
+
+	rights, err := imap.ParseString(fields[2])
+	if err != nil {
+		return err
+	}
+	cmd.Mode, cmd.Rights = imap.ParseACLModification(rights)
+	return nil
+}
+
+// DeleteACL is a DELETEACL command, as defined in RFC 4314 section 3.2.
+type DeleteACL struct {
+	Mailbox    string
+	Identifier string
+}
+
+func (cmd *DeleteACL) Command() *imap.Command {
+	mailbox := imap.FormatMailboxName(cmd.Mailbox)
+
+	return &imap.Command{
+		Name:      "DELETEACL",
+		Arguments: []interface{}{mailbox, cmd.Identifier},
+	}
+}
+
+func (cmd *DeleteACL) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("No enough arguments")
+	}
+
+	var err error
+	if cmd.Mailbox, err = parseACLMailbox(fields[0]); err != nil {
+		return err
+	}
+	cmd.Identifier, err = imap.ParseString(fields[1])
+	return err
+}
+
+// GetACL is a GETACL command, as defined in RFC 4314 section 3.3.
+type GetACL struct {
+	Mailbox string
+}
+
+func (cmd *GetACL) Command() *imap.Command {
+	mailbox := imap.FormatMailboxName(cmd.Mailbox)
+
+	return &imap.Command{
+		Name:      "GETACL",
+		Arguments: []interface{}{mailbox},
+	}
+}
+
+func (cmd *GetACL) Parse(fields []interface{}) error {
+	if len(fields) < 1 {
+		return errors.New("No enough arguments")
+	}
+
+	var err error
+	cmd.Mailbox, err = parseACLMailbox(fields[0])
+	return err
+}
+
+// ListRights is a LISTRIGHTS command, as defined in RFC 4314 section 3.4.
+type ListRights struct {
+	Mailbox    string
+	Identifier string
+}
+
+func (cmd *ListRights) Command() *imap.Command {
+	mailbox := imap.FormatMailboxName(cmd.Mailbox)
+
+	return &imap.Command{
+		Name:      "LISTRIGHTS",
+		Arguments: []interface{}{mailbox, cmd.Identifier},
+	}
+}
+
+func (cmd *ListRights) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("No enough arguments")
+	}
+
+	var err error
+	if cmd.Mailbox, err = parseACLMailbox(fields[0]); err != nil {
+		return err
+	}
+	cmd.Identifier, err = imap.ParseString(fields[1])
+	return err
+}
+
+// MyRights is a MYRIGHTS command, as defined in RFC 4314 section 3.5.
+type MyRights struct {
+	Mailbox string
+}
+
+func (cmd *MyRights) Command() *imap.Command {
+	mailbox := imap.FormatMailboxName(cmd.Mailbox)
+
+	return &imap.Command{
+		Name:      "MYRIGHTS",
+		Arguments: []interface{}{mailbox},
+	}
+}
+
+func (cmd *MyRights) Parse(fields []interface{}) error {
+	if len(fields) < 1 {
+		return errors.New("No enough arguments")
+	}
+
+	var err error
+	cmd.Mailbox, err = parseACLMailbox(fields[0])
+	return err
+}
@@ -2,39 +2,119 @@ package commands
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/emersion/go-imap"
-	"github.com/emersion/go-imap/utf7"
 )
 
 // Append is an APPEND command, as defined in RFC 3501 section 6.3.11.
+//
+// Additional contains the messages appended after the first one in the same
+// command, as defined in RFC 3502 (MULTIAPPEND). If Catenate is not nil, the
+// first message is built from these parts instead of Message, as defined in
+// RFC 4469 (CATENATE). If UTF8 is true, the first message is sent as a UTF-8
+// message, as defined in RFC 6855 section 4.
 type Append struct {
-	Mailbox string
-	Flags   []string
-	Date    time.Time
-	Message imap.Literal
+	Mailbox  string
+	Flags    []string
+	Date     time.Time
+	Message  imap.Literal
+	Catenate []*imap.CatenatePart
+	UTF8     bool
+
+	Additional []*imap.AppendMessage
 }
 
-func (cmd *Append) Command() *imap.Command {
+func formatAppendMessage(msg *imap.AppendMessage) []interface{} {
 	var args []interface{}
 
-	mailbox, _ := utf7.Encoding.NewEncoder().String(cmd.Mailbox)
-	args = append(args, mailbox)
-
-	if cmd.Flags != nil {
-		flags := make([]interface{}, len(cmd.Flags))
-		for i, flag := range cmd.Flags {
+	if msg.Flags != nil {
+		flags := make([]interface{}, len(msg.Flags))
+		for i, flag := range msg.Flags {
 			flags[i] = flag
 		}
 		args = append(args, flags)
 	}
 
-	if !cmd.Date.IsZero() {
-		args = append(args, cmd.Date)
+	if !msg.Date.IsZero() {
+		args = append(args, msg.Date)
+	}
+
+	if msg.Catenate != nil {
+		parts := make([]interface{}, 0, 2*len(msg.Catenate))
+		for _, part := range msg.Catenate {
+			if part.Text != nil {
+				parts = append(parts, "TEXT", part.Text)
+			} else {
+				parts = append(parts, "URL", part.URL)
+			}
+		}
+		return append(args, "CATENATE", parts)
+	}
+
+	if msg.UTF8 {
+		return append(args, "UTF8", []interface{}{imap.Literal8{Literal: msg.Body}})
+	}
+
+	return append(args, msg.Body)
+}
+
+func parseCatenateParts(fields []interface{}) ([]*imap.CatenatePart, error) {
+	if len(fields)%2 != 0 || len(fields) == 0 {
+		return nil, errors.New("Invalid CATENATE parts")
 	}
 
-	args = append(args, cmd.Message)
+	parts := make([]*imap.CatenatePart, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		kind, ok := fields[i].(string)
+		if !ok {
+			return nil, errors.New("Invalid CATENATE part type")
+		}
+
+		part := new(imap.CatenatePart)
+		switch strings.ToUpper(kind) {
+		case "URL":
+			url, err := imap.ParseString(fields[i+1])
+			if err != nil {
+				return nil, err
+			}
+			part.URL = url
+		case "TEXT":
+			lit, ok := fields[i+1].(imap.Literal)
+			if !ok {
+				return nil, errors.New("CATENATE text must be a literal")
+			}
+			part.Text = lit
+		default:
+			return nil, errors.New("Unknown CATENATE part type: " + kind)
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// Messages returns all the messages appended by the command.
+func (cmd *Append) Messages() []*imap.AppendMessage {
+	first := &imap.AppendMessage{
+		Flags:    cmd.Flags,
+		Date:     cmd.Date,
+		Body:     cmd.Message,
+		Catenate: cmd.Catenate,
+		UTF8:     cmd.UTF8,
+	}
+	return append([]*imap.AppendMessage{first}, cmd.Additional...)
+}
+
+func (cmd *Append) Command() *imap.Command {
+	var args []interface{}
+
+	mailbox := imap.FormatMailboxName(cmd.Mailbox)
+	args = append(args, mailbox)
+
+	for _, msg := range cmd.Messages() {
+		args = append(args, formatAppendMessage(msg)...)
+	}
 
 	return &imap.Command{
 		Name:      "APPEND",
@@ -50,44 +130,96 @@ func (cmd *Append) Parse(fields []interface{}) (err error) {
 	// Parse mailbox name
 	if mailbox, err := imap.ParseString(fields[0]); err != nil {
 		return err
-	} else if mailbox, err = utf7.Encoding.NewDecoder().String(mailbox); err != nil {
+	} else if mailbox, err = imap.DecodeMailboxName(mailbox); err != nil {
 		return err
 	} else {
 		cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
 	}
 
-	// Parse message literal
-	litIndex := len(fields) - 1
-	var ok bool
-	if cmd.Message, ok = fields[litIndex].(imap.Literal); !ok {
-		return errors.New("Message must be a literal")
-	}
-
-	// Remaining fields a optional
-	fields = fields[1:litIndex]
-	if len(fields) > 0 {
-		// Parse flags list
-		if flags, ok := fields[0].([]interface{}); ok {
-			if cmd.Flags, err = imap.ParseStringList(flags); err != nil {
+	// Parse messages: each one has optional flags and date, followed by a
+	// literal, by UTF8 and a literal8 in a list or by CATENATE and a list of
+	// parts
+	var msgs []*imap.AppendMessage
+	msg := new(imap.AppendMessage)
+	catenate := false
+	for _, f := range fields[1:] {
+		switch f := f.(type) {
+		case []interface{}:
+			if msg.UTF8 {
+				if len(f) != 1 {
+					return errors.New("UTF8 must be followed by a literal8 in a list")
+				}
+				lit, ok := f[0].(imap.Literal8)
+				if !ok {
+					return errors.New("UTF8 must be followed by a literal8 in a list")
+				}
+				msg.Body = lit.Literal
+				msgs = append(msgs, msg)
+				msg = new(imap.AppendMessage)
+				break
+			}
+			if catenate {
+				if msg.Catenate, err = parseCatenateParts(f); err != nil {
+					return err
+				}
+				msgs = append(msgs, msg)
+				msg = new(imap.AppendMessage)
+				catenate = false
+				break
+			}
+			if msg.Flags != nil || !msg.Date.IsZero() {
+				return errors.New("Flags must precede the date and the message")
+			}
+			if msg.Flags, err = imap.ParseStringList(f); err != nil {
 				return err
 			}
-
-			for i, flag := range cmd.Flags {
-				cmd.Flags[i] = imap.CanonicalFlag(flag)
+			for i, flag := range msg.Flags {
+				msg.Flags[i] = imap.CanonicalFlag(flag)
 			}
-
-			fields = fields[1:]
-		}
-
-		// Parse date
-		if len(fields) > 0 {
-			if date, ok := fields[0].(string); !ok {
-				return errors.New("Date must be a string")
-			} else if cmd.Date, err = time.Parse(imap.DateTimeLayout, date); err != nil {
+		case string:
+			if catenate {
+				return errors.New("CATENATE must be followed by a list")
+			}
+			if msg.UTF8 {
+				return errors.New("UTF8 must be followed by a list")
+			}
+			if strings.EqualFold(f, "CATENATE") {
+				catenate = true
+				break
+			}
+			if strings.EqualFold(f, "UTF8") {
+				msg.UTF8 = true
+				break
+			}
+			if !msg.Date.IsZero() {
+				return errors.New("Message must be a literal")
+			}
+			if msg.Date, err = time.Parse(imap.DateTimeLayout, f); err != nil {
 				return err
 			}
+		case imap.Literal:
+			if catenate {
+				return errors.New("CATENATE must be followed by a list")
+			}
+			if msg.UTF8 {
+				return errors.New("UTF8 must be followed by a list")
+			}
+			msg.Body = f
+			msgs = append(msgs, msg)
+			msg = new(imap.AppendMessage)
+		default:
+			return errors.New("Message must be a literal")
 		}
 	}
+	if catenate || msg.UTF8 || msg.Flags != nil || !msg.Date.IsZero() || len(msgs) == 0 {
+		return errors.New("Message must be a literal")
+	}
 
+	cmd.Flags, cmd.Date, cmd.Message = msgs[0].Flags, msgs[0].Date, msgs[0].Body
+	cmd.Catenate, cmd.UTF8 = msgs[0].Catenate, msgs[0].UTF8
+	cmd.Additional = msgs[1:]
+	if len(cmd.Additional) == 0 {
+		cmd.Additional = nil
+	}
 	return
 }
@@ -23,12 +23,25 @@ type AuthenticateConn interface {
 // 6.2.2.
 type Authenticate struct {
 	Mechanism string
+	// InitialResponse, if not nil, is sent with the command as defined in RFC
+	// 4959. The server must support the SASL-IR capability.
+	InitialResponse []byte
 }
 
 func (cmd *Authenticate) Command() *imap.Command {
+	args := []interface{}{cmd.Mechanism}
+	if cmd.InitialResponse != nil {
+		// An empty initial response is sent as "="
+		encoded := "="
+		if len(cmd.InitialResponse) > 0 {
+			encoded = base64.StdEncoding.EncodeToString(cmd.InitialResponse)
+		}
+		args = append(args, encoded)
+	}
+
 	return &imap.Command{
 		Name:      "AUTHENTICATE",
-		Arguments: []interface{}{cmd.Mechanism},
+		Arguments: args,
 	}
 }
 
@@ -43,6 +56,23 @@ func (cmd *Authenticate) Parse(fields []interface{}) error {
 	}
 
 	cmd.Mechanism = strings.ToUpper(cmd.Mechanism)
+
+	if len(fields) > 1 {
+		encoded, ok := fields[1].(string)
+		if !ok {
+			return errors.New("Initial response must be a string")
+		}
+
+		// An empty initial response is sent as "="
+		cmd.InitialResponse = []byte{}
+		if encoded != "=" {
+			var err error
+			if cmd.InitialResponse, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -54,7 +84,7 @@ func (cmd *Authenticate) Handle(mechanisms map[string]sasl.Server, conn Authenti
 
 	scanner := bufio.NewScanner(conn)
 
-	var response []byte
+	response := cmd.InitialResponse
 	for {
 		challenge, done, err := sasl.Next(response)
 		if err != nil || done {
@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+// CancelUpdate is a CANCELUPDATE command, as defined in RFC 5267 section 4.3.
+// Tags are the tags of the commands which requested search result updates.
+type CancelUpdate struct {
+	Tags []string
+}
+
+func (cmd *CancelUpdate) Command() *imap.Command {
+	args := make([]interface{}, len(cmd.Tags))
+	for i, tag := range cmd.Tags {
+		args[i] = imap.Quoted(tag)
+	}
+
+	return &imap.Command{
+		Name:      "CANCELUPDATE",
+		Arguments: args,
+	}
+}
+
+func (cmd *CancelUpdate) Parse(fields []interface{}) error {
+	if len(fields) == 0 {
+		return errors.New("No enough arguments")
+	}
+
+	cmd.Tags = make([]string, len(fields))
+	for i, f := range fields {
+		tag, err := imap.ParseString(f)
+		if err != nil {
+			return err
+		}
+		cmd.Tags[i] = tag
+	}
+	return nil
+}
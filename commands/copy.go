@@ -4,7 +4,6 @@ import (
 	"errors"
 
 	"github.com/emersion/go-imap"
-	"github.com/emersion/go-imap/utf7"
 )
 
 // Copy is a COPY command, as defined in RFC 3501 section 6.4.7.
@@ -14,7 +13,7 @@ type Copy struct {
 }
 
 func (cmd *Copy) Command() *imap.Command {
-	mailbox, _ := utf7.Encoding.NewEncoder().String(cmd.Mailbox)
+	mailbox := imap.FormatMailboxName(cmd.Mailbox)
 
 	return &imap.Command{
 		Name:      "COPY",
@@ -37,7 +36,7 @@ func (cmd *Copy) Parse(fields []interface{}) error {
 
 	if mailbox, err := imap.ParseString(fields[1]); err != nil {
 		return err
-	} else if mailbox, err := utf7.Encoding.NewDecoder().String(mailbox); err != nil {
+	} else if mailbox, err := imap.DecodeMailboxName(mailbox); err != nil {
 		return err
 	} else {
 		cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
@@ -2,22 +2,33 @@ package commands
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/emersion/go-imap"
-	"github.com/emersion/go-imap/utf7"
 )
 
 // Create is a CREATE command, as defined in RFC 3501 section 6.3.3.
+//
+// SpecialUse is the list of special-use attributes of the new mailbox, sent
+// with the USE parameter defined in RFC 6154 section 3.
 type Create struct {
-	Mailbox string
+	Mailbox    string
+	SpecialUse []string
 }
 
+const createUse = "USE"
+
 func (cmd *Create) Command() *imap.Command {
-	mailbox, _ := utf7.Encoding.NewEncoder().String(cmd.Mailbox)
+	mailbox := imap.FormatMailboxName(cmd.Mailbox)
+
+	args := []interface{}{mailbox}
+	if len(cmd.SpecialUse) > 0 {
+		args = append(args, []interface{}{createUse, imap.FormatStringList(cmd.SpecialUse)})
+	}
 
 	return &imap.Command{
 		Name:      "CREATE",
-		Arguments: []interface{}{mailbox},
+		Arguments: args,
 	}
 }
 
@@ -28,11 +39,33 @@ func (cmd *Create) Parse(fields []interface{}) error {
 
 	if mailbox, err := imap.ParseString(fields[0]); err != nil {
 		return err
-	} else if mailbox, err := utf7.Encoding.NewDecoder().String(mailbox); err != nil {
+	} else if mailbox, err := imap.DecodeMailboxName(mailbox); err != nil {
 		return err
 	} else {
 		cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
 	}
 
+	cmd.SpecialUse = nil
+	if len(fields) > 1 {
+		params, ok := fields[1].([]interface{})
+		if !ok || len(params)%2 != 0 {
+			return errors.New("CREATE parameters must be a list")
+		}
+
+		for i := 0; i < len(params); i += 2 {
+			name, err := imap.ParseString(params[i])
+			if err != nil {
+				return err
+			}
+			if !strings.EqualFold(name, createUse) {
+				return errors.New("Unsupported CREATE parameter: " + name)
+			}
+
+			if cmd.SpecialUse, err = imap.ParseStringList(params[i+1]); err != nil {
+				return err
+			}
+		}
+	}
+
 	return nil
 }
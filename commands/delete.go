@@ -4,7 +4,6 @@ import (
 	"errors"
 
 	"github.com/emersion/go-imap"
-	"github.com/emersion/go-imap/utf7"
 )
 
 // Delete is a DELETE command, as defined in RFC 3501 section 6.3.3.
@@ -13,7 +12,7 @@ type Delete struct {
 }
 
 func (cmd *Delete) Command() *imap.Command {
-	mailbox, _ := utf7.Encoding.NewEncoder().String(cmd.Mailbox)
+	mailbox := imap.FormatMailboxName(cmd.Mailbox)
 
 	return &imap.Command{
 		Name:      "DELETE",
@@ -28,7 +27,7 @@ func (cmd *Delete) Parse(fields []interface{}) error {
 
 	if mailbox, err := imap.ParseString(fields[0]); err != nil {
 		return err
-	} else if mailbox, err := utf7.Encoding.NewDecoder().String(mailbox); err != nil {
+	} else if mailbox, err := imap.DecodeMailboxName(mailbox); err != nil {
 		return err
 	} else {
 		cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
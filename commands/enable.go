@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+// Enable is an ENABLE command, as defined in RFC 5161 section 3.1.
+type Enable struct {
+	Caps []string
+}
+
+func (cmd *Enable) Command() *imap.Command {
+	args := make([]interface{}, len(cmd.Caps))
+	for i, cap := range cmd.Caps {
+		args[i] = cap
+	}
+
+	return &imap.Command{
+		Name:      "ENABLE",
+		Arguments: args,
+	}
+}
+
+func (cmd *Enable) Parse(fields []interface{}) error {
+	if len(fields) < 1 {
+		return errors.New("No enough arguments")
+	}
+
+	var err error
+	cmd.Caps, err = imap.ParseStringList(fields)
+	return err
+}
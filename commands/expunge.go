@@ -1,16 +1,42 @@
 package commands
 
 import (
+	"errors"
+
 	"github.com/emersion/go-imap"
 )
 
 // Expunge is an EXPUNGE command, as defined in RFC 3501 section 6.4.3.
-type Expunge struct{}
+//
+// SeqSet is only used with UID EXPUNGE, as defined in RFC 4315 section 2.1:
+// only messages whose UID is in the set are expunged.
+type Expunge struct {
+	SeqSet *imap.SeqSet
+}
 
 func (cmd *Expunge) Command() *imap.Command {
-	return &imap.Command{Name: "EXPUNGE"}
+	var args []interface{}
+	if cmd.SeqSet != nil {
+		args = append(args, cmd.SeqSet)
+	}
+
+	return &imap.Command{
+		Name:      "EXPUNGE",
+		Arguments: args,
+	}
 }
 
 func (cmd *Expunge) Parse(fields []interface{}) error {
-	return nil
+	if len(fields) == 0 {
+		return nil
+	}
+
+	seqset, ok := fields[0].(string)
+	if !ok {
+		return errors.New("Sequence set must be an atom")
+	}
+
+	var err error
+	cmd.SeqSet, err = imap.ParseSeqSet(seqset)
+	return err
 }
@@ -11,6 +11,16 @@ import (
 type Fetch struct {
 	SeqSet *imap.SeqSet
 	Items  []imap.FetchItem
+	// ChangedSince, if not zero, restricts the command to messages whose
+	// mod-sequence is greater, as defined in RFC 7162 section 3.1.4.
+	ChangedSince uint64
+	// Vanished requests a VANISHED (EARLIER) response listing messages expunged
+	// since ChangedSince. It requires QRESYNC and can only be used with UID
+	// FETCH, see RFC 7162 section 3.2.6.
+	Vanished bool
+	// Partial, if not nil, restricts the command to the messages of SeqSet in
+	// this range, as defined in RFC 9394 section 3.2.
+	Partial *imap.PartialRange
 }
 
 func (cmd *Fetch) Command() *imap.Command {
@@ -19,13 +29,29 @@ func (cmd *Fetch) Command() *imap.Command {
 		if section, err := imap.ParseBodySectionName(item); err == nil {
 			items[i] = section
 		} else {
-			items[i] = string(item)
+			// Items defined in extensions may contain brackets
+			items[i] = imap.RawString(item)
 		}
 	}
 
+	args := []interface{}{cmd.SeqSet, items}
+	var modifiers []interface{}
+	if cmd.ChangedSince > 0 {
+		modifiers = append(modifiers, "CHANGEDSINCE", cmd.ChangedSince)
+		if cmd.Vanished {
+			modifiers = append(modifiers, "VANISHED")
+		}
+	}
+	if cmd.Partial != nil {
+		modifiers = append(modifiers, imap.SearchReturnPartial, cmd.Partial.String())
+	}
+	if modifiers != nil {
+		args = append(args, modifiers)
+	}
+
 	return &imap.Command{
 		Name:      "FETCH",
-		Arguments: []interface{}{cmd.SeqSet, items},
+		Arguments: args,
 	}
 }
 
@@ -43,17 +69,75 @@ func (cmd *Fetch) Parse(fields []interface{}) error {
 
 	switch items := fields[1].(type) {
 	case string: // A macro or a single item
-		cmd.Items = imap.FetchItem(strings.ToUpper(items)).Expand()
+		item := imap.FetchItem(strings.ToUpper(items))
+		if item == imap.FetchAnnotation && len(fields) > 2 {
+			// ANNOTATION is followed by its parameters, see RFC 5257
+			// section 4.2
+			entries, attribs, err := imap.ParseAnnotationParams(fields[2])
+			if err != nil {
+				return err
+			}
+			cmd.Items = []imap.FetchItem{imap.AnnotationItem(entries, attribs)}
+			fields = fields[1:]
+		} else {
+			cmd.Items = item.Expand()
+		}
 	case []interface{}: // A list of items
 		cmd.Items = make([]imap.FetchItem, 0, len(items))
-		for _, v := range items {
-			itemStr, _ := v.(string)
+		for i := 0; i < len(items); i++ {
+			itemStr, _ := items[i].(string)
 			item := imap.FetchItem(strings.ToUpper(itemStr))
+			if item == imap.FetchAnnotation && i+1 < len(items) {
+				entries, attribs, err := imap.ParseAnnotationParams(items[i+1])
+				if err != nil {
+					return err
+				}
+				cmd.Items = append(cmd.Items, imap.AnnotationItem(entries, attribs))
+				i++
+				continue
+			}
 			cmd.Items = append(cmd.Items, item.Expand()...)
 		}
 	default:
 		return errors.New("Items must be either a string or a list")
 	}
 
+	// Fetch modifiers
+	if len(fields) > 2 {
+		modifiers, ok := fields[2].([]interface{})
+		if !ok {
+			return errors.New("Fetch modifiers must be a list")
+		}
+		for i := 0; i < len(modifiers); i++ {
+			name, _ := modifiers[i].(string)
+			switch strings.ToUpper(name) {
+			case "CHANGEDSINCE":
+				if i+1 >= len(modifiers) {
+					return errors.New("Missing CHANGEDSINCE mod-sequence")
+				}
+				if cmd.ChangedSince, err = imap.ParseNumber64(modifiers[i+1]); err != nil {
+					return err
+				}
+				i++
+			case "VANISHED":
+				cmd.Vanished = true
+			case imap.SearchReturnPartial:
+				if i+1 >= len(modifiers) {
+					return errors.New("Missing PARTIAL range")
+				}
+				r, ok := modifiers[i+1].(string)
+				if !ok {
+					return errors.New("PARTIAL range must be an atom")
+				}
+				if cmd.Partial, err = imap.ParsePartialRange(r); err != nil {
+					return err
+				}
+				i++
+			default:
+				return errors.New("Unknown fetch modifier: " + name)
+			}
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+// ID is an ID command, as defined in RFC 2971 section 3.1. If ID is nil, NIL
+// is sent.
+type ID struct {
+	ID map[string]string
+}
+
+func (cmd *ID) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "ID",
+		Arguments: []interface{}{imap.FormatID(cmd.ID)},
+	}
+}
+
+func (cmd *ID) Parse(fields []interface{}) error {
+	if len(fields) < 1 {
+		return errors.New("No enough arguments")
+	}
+
+	var err error
+	cmd.ID, err = imap.ParseID(fields[0])
+	return err
+}
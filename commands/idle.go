@@ -0,0 +1,18 @@
+package commands
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// Idle is an IDLE command, as defined in RFC 2177.
+type Idle struct{}
+
+func (cmd *Idle) Command() *imap.Command {
+	return &imap.Command{
+		Name: "IDLE",
+	}
+}
+
+func (cmd *Idle) Parse(fields []interface{}) error {
+	return nil
+}
@@ -2,59 +2,190 @@ package commands
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/emersion/go-imap"
-	"github.com/emersion/go-imap/utf7"
 )
 
 // List is a LIST command, as defined in RFC 3501 section 6.3.8. If Subscribed
 // is set to true, LSUB will be used instead.
+//
+// SelectOpts, Patterns and ReturnOpts are LIST-EXTENDED arguments, defined in
+// RFC 5258. If Patterns is not empty, it is used instead of Mailbox.
+//
+// ReturnStatus is the list of items requested with the STATUS return option,
+// defined in RFC 5819. If it is not nil, a STATUS response is returned for each
+// listed mailbox.
 type List struct {
 	Reference string
 	Mailbox   string
 
 	Subscribed bool
+
+	SelectOpts   []string
+	Patterns     []string
+	ReturnOpts   []string
+	ReturnStatus []imap.StatusItem
 }
 
+const listReturnStatus = "STATUS"
+
 func (cmd *List) Command() *imap.Command {
 	name := "LIST"
 	if cmd.Subscribed {
 		name = "LSUB"
 	}
 
-	enc := utf7.Encoding.NewEncoder()
-	ref, _ := enc.String(cmd.Reference)
-	mailbox, _ := enc.String(cmd.Mailbox)
+	ref := imap.FormatMailboxName(cmd.Reference)
+
+	var args []interface{}
+	if len(cmd.SelectOpts) > 0 {
+		args = append(args, formatListOpts(cmd.SelectOpts))
+	}
+	args = append(args, ref)
+
+	if len(cmd.Patterns) > 0 {
+		patterns := make([]interface{}, len(cmd.Patterns))
+		for i, pattern := range cmd.Patterns {
+			patterns[i] = imap.FormatMailboxName(pattern)
+		}
+		args = append(args, patterns)
+	} else {
+		mailbox := imap.FormatMailboxName(cmd.Mailbox)
+		args = append(args, mailbox)
+	}
+
+	if len(cmd.ReturnOpts) > 0 || cmd.ReturnStatus != nil {
+		opts := formatListOpts(cmd.ReturnOpts)
+		if cmd.ReturnStatus != nil {
+			items := make([]interface{}, len(cmd.ReturnStatus))
+			for i, item := range cmd.ReturnStatus {
+				items[i] = string(item)
+			}
+			opts = append(opts, listReturnStatus, items)
+		}
+		args = append(args, "RETURN", opts)
+	}
 
 	return &imap.Command{
 		Name:      name,
-		Arguments: []interface{}{ref, mailbox},
+		Arguments: args,
+	}
+}
+
+func formatListOpts(opts []string) []interface{} {
+	fields := make([]interface{}, len(opts))
+	for i, opt := range opts {
+		fields[i] = opt
+	}
+	return fields
+}
+
+func parseListOpts(f interface{}) ([]string, error) {
+	opts, err := imap.ParseStringList(f)
+	if err != nil {
+		return nil, err
 	}
+	for i, opt := range opts {
+		opts[i] = strings.ToUpper(opt)
+	}
+	return opts, nil
+}
+
+func (cmd *List) parseReturnOpts(f interface{}) error {
+	fields, ok := f.([]interface{})
+	if !ok {
+		return errors.New("LIST return options must be a list")
+	}
+
+	cmd.ReturnOpts = []string{}
+	for i := 0; i < len(fields); i++ {
+		opt, err := imap.ParseString(fields[i])
+		if err != nil {
+			return err
+		}
+		opt = strings.ToUpper(opt)
+
+		if opt != listReturnStatus {
+			cmd.ReturnOpts = append(cmd.ReturnOpts, opt)
+			continue
+		}
+
+		// STATUS is followed by a list of status items, see RFC 5819
+		i++
+		if i >= len(fields) {
+			return errors.New("LIST STATUS return option requires a list of items")
+		}
+		items, err := parseListOpts(fields[i])
+		if err != nil {
+			return err
+		}
+		cmd.ReturnStatus = make([]imap.StatusItem, len(items))
+		for j, item := range items {
+			cmd.ReturnStatus[j] = imap.StatusItem(item)
+		}
+	}
+	return nil
 }
 
 func (cmd *List) Parse(fields []interface{}) error {
+	cmd.SelectOpts, cmd.Patterns, cmd.ReturnOpts, cmd.ReturnStatus = nil, nil, nil, nil
+
+	if len(fields) > 0 {
+		if _, ok := fields[0].([]interface{}); ok {
+			opts, err := parseListOpts(fields[0])
+			if err != nil {
+				return err
+			}
+			cmd.SelectOpts = opts
+			fields = fields[1:]
+		}
+	}
+
 	if len(fields) < 2 {
 		return errors.New("No enough arguments")
 	}
 
-	dec := utf7.Encoding.NewDecoder()
-
 	if mailbox, err := imap.ParseString(fields[0]); err != nil {
 		return err
-	} else if mailbox, err := dec.String(mailbox); err != nil {
+	} else if mailbox, err := imap.DecodeMailboxName(mailbox); err != nil {
 		return err
 	} else {
 		// TODO: canonical mailbox path
 		cmd.Reference = imap.CanonicalMailboxName(mailbox)
 	}
 
-	if mailbox, err := imap.ParseString(fields[1]); err != nil {
+	if patterns, ok := fields[1].([]interface{}); ok {
+		for _, f := range patterns {
+			if pattern, err := imap.ParseString(f); err != nil {
+				return err
+			} else if pattern, err := imap.DecodeMailboxName(pattern); err != nil {
+				return err
+			} else {
+				cmd.Patterns = append(cmd.Patterns, imap.CanonicalMailboxName(pattern))
+			}
+		}
+		if len(cmd.Patterns) == 0 {
+			return errors.New("LIST patterns list is empty")
+		}
+		cmd.Mailbox = cmd.Patterns[0]
+	} else if mailbox, err := imap.ParseString(fields[1]); err != nil {
 		return err
-	} else if mailbox, err := dec.String(mailbox); err != nil {
+	} else if mailbox, err := imap.DecodeMailboxName(mailbox); err != nil {
 		return err
 	} else {
 		cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
 	}
 
+	fields = fields[2:]
+	if len(fields) > 0 {
+		if s, ok := fields[0].(string); !ok || strings.ToUpper(s) != "RETURN" || len(fields) < 2 {
+			return errors.New("Invalid LIST return options")
+		}
+		if err := cmd.parseReturnOpts(fields[1]); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
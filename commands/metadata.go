@@ -0,0 +1,156 @@
+package commands
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// GetMetadata is a GETMETADATA command, as defined in RFC 5464 section 4.2. An
+// empty Mailbox refers to server entries. If Options is nil, no option is sent.
+type GetMetadata struct {
+	Mailbox string
+	Entries []string
+	Options *imap.MetadataOptions
+}
+
+func (cmd *GetMetadata) Command() *imap.Command {
+	var args []interface{}
+	if opts := cmd.Options; opts != nil {
+		var optsFields []interface{}
+		if opts.MaxSize > 0 {
+			optsFields = append(optsFields, "MAXSIZE", opts.MaxSize)
+		}
+		if opts.Depth != imap.MetadataDepthZero {
+			optsFields = append(optsFields, "DEPTH", opts.Depth.String())
+		}
+		if len(optsFields) > 0 {
+			args = append(args, optsFields)
+		}
+	}
+
+	mailbox := imap.FormatQuotedMailboxName(cmd.Mailbox)
+
+	entries := make([]interface{}, len(cmd.Entries))
+	for i, entry := range cmd.Entries {
+		entries[i] = entry
+	}
+
+	args = append(args, mailbox, entries)
+	return &imap.Command{
+		Name:      "GETMETADATA",
+		Arguments: args,
+	}
+}
+
+func (cmd *GetMetadata) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("No enough arguments")
+	}
+
+	cmd.Options = nil
+	if optsFields, ok := fields[0].([]interface{}); ok {
+		cmd.Options = new(imap.MetadataOptions)
+		if len(optsFields)%2 != 0 {
+			return errors.New("Invalid GETMETADATA options")
+		}
+		for i := 0; i < len(optsFields); i += 2 {
+			name, _ := optsFields[i].(string)
+			switch strings.ToUpper(name) {
+			case "MAXSIZE":
+				n, err := imap.ParseNumber(optsFields[i+1])
+				if err != nil {
+					return err
+				}
+				cmd.Options.MaxSize = n
+			case "DEPTH":
+				s, _ := optsFields[i+1].(string)
+				depth, err := imap.ParseMetadataDepth(s)
+				if err != nil {
+					return err
+				}
+				cmd.Options.Depth = depth
+			default:
+				return errors.New("Unknown GETMETADATA option: " + name)
+			}
+		}
+
+		fields = fields[1:]
+		if len(fields) < 2 {
+			return errors.New("No enough arguments")
+		}
+	}
+
+	if mailbox, err := imap.ParseString(fields[0]); err != nil {
+		return err
+	} else if mailbox, err := imap.DecodeMailboxName(mailbox); err != nil {
+		return err
+	} else if mailbox != "" {
+		cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
+	} else {
+		cmd.Mailbox = ""
+	}
+
+	// A single entry can be sent without a list
+	entries, ok := fields[1].([]interface{})
+	if !ok {
+		entries = fields[1:2]
+	}
+	cmd.Entries = make([]string, len(entries))
+	for i, f := range entries {
+		entry, err := imap.ParseString(f)
+		if err != nil {
+			return err
+		}
+		if err := imap.CheckMetadataEntry(entry); err != nil {
+			return err
+		}
+		cmd.Entries[i] = strings.ToLower(entry)
+	}
+
+	return nil
+}
+
+// SetMetadata is a SETMETADATA command, as defined in RFC 5464 section 4.3. An
+// empty Mailbox refers to server entries. Entries with a nil value are removed.
+type SetMetadata struct {
+	Mailbox string
+	Entries map[string]*string
+}
+
+func (cmd *SetMetadata) Command() *imap.Command {
+	mailbox := imap.FormatQuotedMailboxName(cmd.Mailbox)
+
+	return &imap.Command{
+		Name:      "SETMETADATA",
+		Arguments: []interface{}{mailbox, imap.FormatMetadata(cmd.Entries)},
+	}
+}
+
+func (cmd *SetMetadata) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("No enough arguments")
+	}
+
+	if mailbox, err := imap.ParseString(fields[0]); err != nil {
+		return err
+	} else if mailbox, err := imap.DecodeMailboxName(mailbox); err != nil {
+		return err
+	} else if mailbox != "" {
+		cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
+	} else {
+		cmd.Mailbox = ""
+	}
+
+	var err error
+	if cmd.Entries, err = imap.ParseMetadata(fields[1]); err != nil {
+		return err
+	}
+	for entry := range cmd.Entries {
+		if err := imap.CheckMetadataEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
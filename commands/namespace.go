@@ -0,0 +1,18 @@
+package commands
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// Namespace is a NAMESPACE command, as defined in RFC 2342 section 5.
+type Namespace struct{}
+
+func (cmd *Namespace) Command() *imap.Command {
+	return &imap.Command{
+		Name: "NAMESPACE",
+	}
+}
+
+func (cmd *Namespace) Parse(fields []interface{}) error {
+	return nil
+}
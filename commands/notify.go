@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// Notify is a NOTIFY command, as defined in RFC 5465 section 3. If Spec is
+// nil, NOTIFY NONE is sent to stop all notifications.
+type Notify struct {
+	Spec *imap.NotifySpec
+}
+
+func (cmd *Notify) Command() *imap.Command {
+	args := []interface{}{"NONE"}
+	if cmd.Spec != nil {
+		args = append([]interface{}{"SET"}, cmd.Spec.Format()...)
+	}
+
+	return &imap.Command{
+		Name:      "NOTIFY",
+		Arguments: args,
+	}
+}
+
+func (cmd *Notify) Parse(fields []interface{}) error {
+	if len(fields) < 1 {
+		return errors.New("No enough arguments")
+	}
+
+	name, ok := fields[0].(string)
+	if !ok {
+		return errors.New("NOTIFY argument must be an atom")
+	}
+
+	switch strings.ToUpper(name) {
+	case "NONE":
+		cmd.Spec = nil
+		return nil
+	case "SET":
+		cmd.Spec = new(imap.NotifySpec)
+		return cmd.Spec.Parse(fields[1:])
+	default:
+		return errors.New("NOTIFY argument must be SET or NONE")
+	}
+}
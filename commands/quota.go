@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+// GetQuota is a GETQUOTA command, as defined in RFC 9208 section 4.2.
+type GetQuota struct {
+	Root string
+}
+
+func (cmd *GetQuota) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "GETQUOTA",
+		Arguments: []interface{}{imap.Quoted(cmd.Root)},
+	}
+}
+
+func (cmd *GetQuota) Parse(fields []interface{}) error {
+	if len(fields) < 1 {
+		return errors.New("No enough arguments")
+	}
+
+	var err error
+	cmd.Root, err = imap.ParseString(fields[0])
+	return err
+}
+
+// GetQuotaRoot is a GETQUOTAROOT command, as defined in RFC 9208 section 4.3.
+type GetQuotaRoot struct {
+	Mailbox string
+}
+
+func (cmd *GetQuotaRoot) Command() *imap.Command {
+	mailbox := imap.FormatMailboxName(cmd.Mailbox)
+
+	return &imap.Command{
+		Name:      "GETQUOTAROOT",
+		Arguments: []interface{}{mailbox},
+	}
+}
+
+func (cmd *GetQuotaRoot) Parse(fields []interface{}) error {
+	if len(fields) < 1 {
+		return errors.New("No enough arguments")
+	}
+
+	if mailbox, err := imap.ParseString(fields[0]); err != nil {
+		return err
+	} else if mailbox, err := imap.DecodeMailboxName(mailbox); err != nil {
+		return err
+	} else {
+		cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
+	}
+	return nil
+}
+
+// SetQuota is a SETQUOTA command, as defined in RFC 9208 section 4.4. Limits
+// maps resource names to their new limit. Resources missing from Limits are
+// not limited anymore.
+type SetQuota struct {
+	Root   string
+	Limits map[string]uint64
+}
+
+func (cmd *SetQuota) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "SETQUOTA",
+		Arguments: []interface{}{imap.Quoted(cmd.Root), imap.FormatQuotaLimits(cmd.Limits)},
+	}
+}
+
+func (cmd *SetQuota) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("No enough arguments")
+	}
+
+	var err error
+	if cmd.Root, err = imap.ParseString(fields[0]); err != nil {
+		return err
+	}
+
+	limits, ok := fields[1].([]interface{})
+	if !ok {
+		return errors.New("SETQUOTA limits must be a list")
+	}
+	cmd.Limits, err = imap.ParseQuotaLimits(limits)
+	return err
+}
@@ -4,7 +4,6 @@ import (
 	"errors"
 
 	"github.com/emersion/go-imap"
-	"github.com/emersion/go-imap/utf7"
 )
 
 // Rename is a RENAME command, as defined in RFC 3501 section 6.3.5.
@@ -14,9 +13,8 @@ type Rename struct {
 }
 
 func (cmd *Rename) Command() *imap.Command {
-	enc := utf7.Encoding.NewEncoder()
-	existingName, _ := enc.String(cmd.Existing)
-	newName, _ := enc.String(cmd.New)
+	existingName := imap.FormatMailboxName(cmd.Existing)
+	newName := imap.FormatMailboxName(cmd.New)
 
 	return &imap.Command{
 		Name:      "RENAME",
@@ -29,11 +27,9 @@ func (cmd *Rename) Parse(fields []interface{}) error {
 		return errors.New("No enough arguments")
 	}
 
-	dec := utf7.Encoding.NewDecoder()
-
 	if existingName, err := imap.ParseString(fields[0]); err != nil {
 		return err
-	} else if existingName, err := dec.String(existingName); err != nil {
+	} else if existingName, err := imap.DecodeMailboxName(existingName); err != nil {
 		return err
 	} else {
 		cmd.Existing = imap.CanonicalMailboxName(existingName)
@@ -41,7 +37,7 @@ func (cmd *Rename) Parse(fields []interface{}) error {
 
 	if newName, err := imap.ParseString(fields[1]); err != nil {
 		return err
-	} else if newName, err := dec.String(newName); err != nil {
+	} else if newName, err := imap.DecodeMailboxName(newName); err != nil {
 		return err
 	} else {
 		cmd.New = imap.CanonicalMailboxName(newName)
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+// Replace is a REPLACE command, as defined in RFC 8508 section 3.3. SeqNum is
+// the sequence number of the message to replace, or its UID when wrapped in a
+// UID command.
+type Replace struct {
+	SeqNum  uint32
+	Mailbox string
+	Message *imap.AppendMessage
+}
+
+func (cmd *Replace) Command() *imap.Command {
+	args := []interface{}{cmd.SeqNum, imap.FormatMailboxName(cmd.Mailbox)}
+	args = append(args, formatAppendMessage(cmd.Message)...)
+
+	return &imap.Command{
+		Name:      "REPLACE",
+		Arguments: args,
+	}
+}
+
+func (cmd *Replace) Parse(fields []interface{}) error {
+	if len(fields) < 3 {
+		return errors.New("No enough arguments")
+	}
+
+	seqNum, err := imap.ParseNumber(fields[0])
+	if err != nil || seqNum == 0 {
+		return errors.New("Invalid message number")
+	}
+	cmd.SeqNum = seqNum
+
+	// The rest of the command is the same as APPEND with a single message
+	var appendCmd Append
+	if err := appendCmd.Parse(fields[1:]); err != nil {
+		return err
+	}
+	if appendCmd.Additional != nil {
+		return errors.New("Only one message can be replaced")
+	}
+
+	cmd.Mailbox = appendCmd.Mailbox
+	cmd.Message = appendCmd.Messages()[0]
+	return nil
+}
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"strings"
@@ -8,18 +9,53 @@ import (
 	"github.com/emersion/go-imap"
 )
 
+// MaxSearchQuotedLen is the maximum length of a SEARCH string argument. Longer
+// strings are sent as literals, to keep command lines short.
+const MaxSearchQuotedLen = 1024
+
 // Search is a SEARCH command, as defined in RFC 3501 section 6.4.4.
 type Search struct {
 	Charset  string
 	Criteria *imap.SearchCriteria
+	// Return contains the result options, as defined in RFC 4731 section 3,
+	// e.g. SAVE (RFC 5182).
+	Return []string
+	// Partial, if not nil, requests the matching messages in this range with
+	// the PARTIAL result option, as defined in RFC 9394.
+	Partial *imap.PartialRange
+}
+
+// searchLiterals replaces long strings in fields with literals.
+func searchLiterals(fields []interface{}) []interface{} {
+	for i, f := range fields {
+		switch f := f.(type) {
+		case string:
+			if len(f) > MaxSearchQuotedLen {
+				fields[i] = bytes.NewBufferString(f)
+			}
+		case []interface{}:
+			fields[i] = searchLiterals(f)
+		}
+	}
+	return fields
 }
 
 func (cmd *Search) Command() *imap.Command {
 	var args []interface{}
+	if cmd.Return != nil || cmd.Partial != nil {
+		ret := make([]interface{}, 0, len(cmd.Return)+2)
+		for _, opt := range cmd.Return {
+			ret = append(ret, opt)
+		}
+		if cmd.Partial != nil {
+			ret = append(ret, imap.SearchReturnPartial, cmd.Partial.String())
+		}
+		args = append(args, "RETURN", ret)
+	}
 	if cmd.Charset != "" {
 		args = append(args, "CHARSET", cmd.Charset)
 	}
-	args = append(args, cmd.Criteria.Format()...)
+	args = append(args, searchLiterals(cmd.Criteria.Format())...)
 
 	return &imap.Command{
 		Name:      "SEARCH",
@@ -32,6 +68,44 @@ func (cmd *Search) Parse(fields []interface{}) error {
 		return errors.New("Missing search criteria")
 	}
 
+	// Parse result options
+	if f, ok := fields[0].(string); ok && strings.EqualFold(f, "RETURN") {
+		if len(fields) < 2 {
+			return errors.New("Missing RETURN options")
+		}
+		opts, ok := fields[1].([]interface{})
+		if !ok {
+			return errors.New("RETURN options must be a list")
+		}
+		cmd.Return = make([]string, 0, len(opts))
+		for i := 0; i < len(opts); i++ {
+			s, ok := opts[i].(string)
+			if !ok {
+				return errors.New("RETURN option must be an atom")
+			}
+			s = strings.ToUpper(s)
+
+			// PARTIAL is followed by a range, see RFC 9394 section 3.1
+			if s == imap.SearchReturnPartial && i+1 < len(opts) {
+				r, ok := opts[i+1].(string)
+				if !ok {
+					return errors.New("PARTIAL range must be an atom")
+				}
+				var err error
+				if cmd.Partial, err = imap.ParsePartialRange(r); err != nil {
+					return err
+				}
+				i++
+				continue
+			}
+			cmd.Return = append(cmd.Return, s)
+		}
+		fields = fields[2:]
+		if len(fields) == 0 {
+			return errors.New("Missing search criteria")
+		}
+	}
+
 	// Parse charset
 	if f, ok := fields[0].(string); ok && strings.EqualFold(f, "CHARSET") {
 		if len(fields) < 2 {
@@ -2,16 +2,22 @@ package commands
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/emersion/go-imap"
-	"github.com/emersion/go-imap/utf7"
 )
 
 // Select is a SELECT command, as defined in RFC 3501 section 6.3.1. If ReadOnly
 // is set to true, the EXAMINE command will be used instead.
+//
+// If CondStore is set to true, the CONDSTORE parameter defined in RFC 7162
+// section 3.1.8 is sent. If QResync is not nil, the QRESYNC parameter defined
+// in RFC 7162 section 3.2.5 is sent.
 type Select struct {
-	Mailbox  string
-	ReadOnly bool
+	Mailbox   string
+	ReadOnly  bool
+	CondStore bool
+	QResync   *imap.QResyncParams
 }
 
 func (cmd *Select) Command() *imap.Command {
@@ -20,11 +26,24 @@ func (cmd *Select) Command() *imap.Command {
 		name = "EXAMINE"
 	}
 
-	mailbox, _ := utf7.Encoding.NewEncoder().String(cmd.Mailbox)
+	mailbox := imap.FormatMailboxName(cmd.Mailbox)
+
+	args := []interface{}{mailbox}
+
+	var params []interface{}
+	if cmd.CondStore {
+		params = append(params, "CONDSTORE")
+	}
+	if cmd.QResync != nil {
+		params = append(params, "QRESYNC", cmd.QResync.Format())
+	}
+	if len(params) > 0 {
+		args = append(args, params)
+	}
 
 	return &imap.Command{
 		Name:      name,
-		Arguments: []interface{}{mailbox},
+		Arguments: args,
 	}
 }
 
@@ -35,11 +54,41 @@ func (cmd *Select) Parse(fields []interface{}) error {
 
 	if mailbox, err := imap.ParseString(fields[0]); err != nil {
 		return err
-	} else if mailbox, err := utf7.Encoding.NewDecoder().String(mailbox); err != nil {
+	} else if mailbox, err := imap.DecodeMailboxName(mailbox); err != nil {
 		return err
 	} else {
 		cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
 	}
 
+	cmd.CondStore, cmd.QResync = false, nil
+	if len(fields) > 1 {
+		params, ok := fields[1].([]interface{})
+		if !ok {
+			return errors.New("SELECT parameters must be a list")
+		}
+		for i := 0; i < len(params); i++ {
+			name, _ := params[i].(string)
+			switch strings.ToUpper(name) {
+			case "CONDSTORE":
+				cmd.CondStore = true
+			case "QRESYNC":
+				if i+1 >= len(params) {
+					return errors.New("Missing QRESYNC parameters")
+				}
+				l, ok := params[i+1].([]interface{})
+				if !ok {
+					return errors.New("QRESYNC parameters must be a list")
+				}
+				cmd.QResync = new(imap.QResyncParams)
+				if err := cmd.QResync.Parse(l); err != nil {
+					return err
+				}
+				i++
+			default:
+				return errors.New("Unknown SELECT parameter: " + name)
+			}
+		}
+	}
+
 	return nil
 }
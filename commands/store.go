@@ -10,14 +10,24 @@ import (
 // Store is a STORE command, as defined in RFC 3501 section 6.4.6.
 type Store struct {
 	SeqSet *imap.SeqSet
-	Item   imap.StoreItem
-	Value  interface{}
+	// UnchangedSince, if not zero, restricts the command to messages whose
+	// mod-sequence is lower than or equal to UnchangedSince. This is the
+	// UNCHANGEDSINCE modifier defined in RFC 7162 section 3.1.3.
+	UnchangedSince uint64
+	Item           imap.StoreItem
+	Value          interface{}
 }
 
 func (cmd *Store) Command() *imap.Command {
+	args := []interface{}{cmd.SeqSet}
+	if cmd.UnchangedSince > 0 {
+		args = append(args, []interface{}{"UNCHANGEDSINCE", cmd.UnchangedSince})
+	}
+	args = append(args, string(cmd.Item), cmd.Value)
+
 	return &imap.Command{
 		Name:      "STORE",
-		Arguments: []interface{}{cmd.SeqSet, string(cmd.Item), cmd.Value},
+		Arguments: args,
 	}
 }
 
@@ -34,6 +44,24 @@ func (cmd *Store) Parse(fields []interface{}) (err error) {
 		return err
 	}
 
+	cmd.UnchangedSince = 0
+	if modifiers, ok := fields[1].([]interface{}); ok {
+		if len(modifiers) != 2 {
+			return errors.New("Invalid STORE modifiers")
+		}
+		if name, ok := modifiers[0].(string); !ok || strings.ToUpper(name) != "UNCHANGEDSINCE" {
+			return errors.New("Unknown STORE modifier")
+		}
+		if cmd.UnchangedSince, err = imap.ParseNumber64(modifiers[1]); err != nil {
+			return err
+		}
+
+		fields = fields[1:]
+		if len(fields) < 3 {
+			return errors.New("No enough arguments")
+		}
+	}
+
 	if item, ok := fields[1].(string); !ok {
 		return errors.New("Item name must be a string")
 	} else {
@@ -0,0 +1,19 @@
+package commands
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// Unauthenticate is an UNAUTHENTICATE command, as defined in RFC 8437 section
+// 3.
+type Unauthenticate struct{}
+
+func (cmd *Unauthenticate) Command() *imap.Command {
+	return &imap.Command{
+		Name: "UNAUTHENTICATE",
+	}
+}
+
+func (cmd *Unauthenticate) Parse(fields []interface{}) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+package commands
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+// Unselect is an UNSELECT command, as defined in RFC 3691 section 2.
+type Unselect struct{}
+
+func (cmd *Unselect) Command() *imap.Command {
+	return &imap.Command{
+		Name: "UNSELECT",
+	}
+}
+
+func (cmd *Unselect) Parse(fields []interface{}) error {
+	return nil
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// URLAuthRequest is a rump URL to authorize with a mechanism.
+type URLAuthRequest struct {
+	URL       string
+	Mechanism string
+}
+
+// GenURLAuth is a GENURLAUTH command, as defined in RFC 4467 section 7.
+type GenURLAuth struct {
+	Requests []URLAuthRequest
+}
+
+func (cmd *GenURLAuth) Command() *imap.Command {
+	args := make([]interface{}, 0, 2*len(cmd.Requests))
+	for _, req := range cmd.Requests {
+		args = append(args, imap.Quoted(req.URL), req.Mechanism)
+	}
+
+	return &imap.Command{
+		Name:      "GENURLAUTH",
+		Arguments: args,
+	}
+}
+
+func (cmd *GenURLAuth) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("No enough arguments")
+	} else if len(fields)%2 != 0 {
+		return errors.New("GENURLAUTH arguments must be URL and mechanism pairs")
+	}
+
+	cmd.Requests = make([]URLAuthRequest, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		var req URLAuthRequest
+		var err error
+		if req.URL, err = imap.ParseString(fields[i]); err != nil {
+			return err
+		}
+		if req.Mechanism, err = imap.ParseString(fields[i+1]); err != nil {
+			return err
+		}
+		req.Mechanism = strings.ToUpper(req.Mechanism)
+		cmd.Requests = append(cmd.Requests, req)
+	}
+	return nil
+}
+
+// URLFetch is an URLFETCH command, as defined in RFC 4467 section 7.
+type URLFetch struct {
+	URLs []string
+}
+
+func (cmd *URLFetch) Command() *imap.Command {
+	args := make([]interface{}, len(cmd.URLs))
+	for i, url := range cmd.URLs {
+		args[i] = imap.Quoted(url)
+	}
+
+	return &imap.Command{
+		Name:      "URLFETCH",
+		Arguments: args,
+	}
+}
+
+func (cmd *URLFetch) Parse(fields []interface{}) error {
+	if len(fields) < 1 {
+		return errors.New("No enough arguments")
+	}
+
+	var err error
+	cmd.URLs, err = imap.ParseStringList(fields)
+	return err
+}
+
+// ResetKey is a RESETKEY command, as defined in RFC 4467 section 7. If
+// Mechanisms is empty, the keys of all mechanisms are reset. If Mailbox is
+// empty, the keys of all mailboxes are reset and Mechanisms is ignored.
+type ResetKey struct {
+	Mailbox    string
+	Mechanisms []string
+}
+
+func (cmd *ResetKey) Command() *imap.Command {
+	var args []interface{}
+	if cmd.Mailbox != "" {
+		mailbox := imap.FormatMailboxName(cmd.Mailbox)
+		args = append(args, mailbox)
+		for _, mech := range cmd.Mechanisms {
+			args = append(args, mech)
+		}
+	}
+
+	return &imap.Command{
+		Name:      "RESETKEY",
+		Arguments: args,
+	}
+}
+
+func (cmd *ResetKey) Parse(fields []interface{}) error {
+	cmd.Mailbox, cmd.Mechanisms = "", nil
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if mailbox, err := imap.ParseString(fields[0]); err != nil {
+		return err
+	} else if mailbox, err := imap.DecodeMailboxName(mailbox); err != nil {
+		return err
+	} else {
+		cmd.Mailbox = imap.CanonicalMailboxName(mailbox)
+	}
+
+	for _, f := range fields[1:] {
+		mech, err := imap.ParseString(f)
+		if err != nil {
+			return err
+		}
+		cmd.Mechanisms = append(cmd.Mechanisms, strings.ToUpper(mech))
+	}
+	return nil
+}
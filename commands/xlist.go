@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+// XList is an XLIST command. It predates RFC 6154 and behaves like LIST, but
+// special-use mailboxes are returned with XLIST attributes, e.g.
+// imap.XListAllMailAttr.
+type XList struct {
+	Reference string
+	Mailbox   string
+}
+
+func (cmd *XList) Command() *imap.Command {
+	return &imap.Command{
+		Name: "XLIST",
+		Arguments: []interface{}{
+			imap.FormatMailboxName(cmd.Reference),
+			imap.FormatMailboxName(cmd.Mailbox),
+		},
+	}
+}
+
+func (cmd *XList) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("No enough arguments")
+	}
+
+	names := make([]string, 2)
+	for i, f := range fields[:2] {
+		name, err := imap.ParseString(f)
+		if err != nil {
+			return err
+		}
+		if name, err = imap.DecodeMailboxName(name); err != nil {
+			return err
+		}
+		names[i] = imap.CanonicalMailboxName(name)
+	}
+
+	cmd.Reference, cmd.Mailbox = names[0], names[1]
+	return nil
+}
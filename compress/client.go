@@ -0,0 +1,53 @@
+package compress
+
+import (
+	"errors"
+	"net"
+
+	"github.com/emersion/go-imap/client"
+)
+
+// ErrCompressionActive is returned by Client.Compress if compression is
+// already enabled.
+var ErrCompressionActive = errors.New("Compression is already active")
+
+// Client is a COMPRESS client.
+type Client struct {
+	c *client.Client
+
+	active bool
+}
+
+// NewClient creates a new client.
+func NewClient(c *client.Client) *Client {
+	return &Client{c: c}
+}
+
+// SupportCompress checks if the server supports a compression mechanism.
+func (c *Client) SupportCompress(mech string) (bool, error) {
+	return c.c.Support(Capability + "=" + mech)
+}
+
+// Compress enables compression with the provided mechanism. Only Deflate is
+// supported. Compression stays enabled until the connection is closed.
+func (c *Client) Compress(mech string) error {
+	if c.active {
+		return ErrCompressionActive
+	}
+	if mech != Deflate {
+		return errors.New("Unsupported compression mechanism: " + mech)
+	}
+
+	cmd := &Command{Mechanism: mech}
+	status, err := c.c.ExecuteUpgrade(cmd, func(conn net.Conn) (net.Conn, error) {
+		return newConn(conn)
+	})
+	if err != nil {
+		return err
+	} else if err := status.Err(); err != nil {
+		return err
+	}
+
+	c.active = true
+	return nil
+}
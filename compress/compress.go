@@ -0,0 +1,90 @@
+// Package compress implements the IMAP COMPRESS extension, as defined in RFC
+// 4978.
+package compress
+
+import (
+	"compress/flate"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// The COMPRESS capability prefix. The capability advertised for a mechanism is
+// Capability + "=" + mechanism, e.g. "COMPRESS=DEFLATE".
+const Capability = "COMPRESS"
+
+// Deflate is the DEFLATE compression mechanism, defined in RFC 1951.
+const Deflate = "DEFLATE"
+
+// CodeCompressionActive is returned when compression is already active on the
+// connection.
+const CodeCompressionActive imap.StatusRespCode = "COMPRESSIONACTIVE"
+
+// Command is a COMPRESS command, as defined in RFC 4978 section 3.
+type Command struct {
+	Mechanism string
+}
+
+func (cmd *Command) Command() *imap.Command {
+	return &imap.Command{
+		Name:      Capability,
+		Arguments: []interface{}{cmd.Mechanism},
+	}
+}
+
+func (cmd *Command) Parse(fields []interface{}) error {
+	if len(fields) < 1 {
+		return errors.New("No enough arguments")
+	}
+
+	mech, ok := fields[0].(string)
+	if !ok {
+		return errors.New("Compression mechanism must be an atom")
+	}
+	cmd.Mechanism = strings.ToUpper(mech)
+	return nil
+}
+
+// conn is a connection compressed with DEFLATE. Written data is buffered by
+// the compressor until Flush is called.
+type conn struct {
+	net.Conn
+
+	r io.ReadCloser
+	w *flate.Writer
+}
+
+func newConn(c net.Conn) (*conn, error) {
+	w, err := flate.NewWriter(c, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn{
+		Conn: c,
+		r:    flate.NewReader(c),
+		w:    w,
+	}, nil
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	return c.w.Write(b)
+}
+
+// Flush writes all pending compressed data to the underlying connection. It is
+// called by imap.Writer after each command or response.
+func (c *conn) Flush() error {
+	return c.w.Flush()
+}
+
+func (c *conn) Close() error {
+	c.r.Close()
+	return c.Conn.Close()
+}
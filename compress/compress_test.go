@@ -0,0 +1,63 @@
+package compress_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/compress"
+	"github.com/emersion/go-imap/server"
+)
+
+func TestCompress(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot listen:", err)
+	}
+
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.Enable(compress.NewExtension())
+	defer s.Close()
+
+	go s.Serve(l)
+
+	c, err := client.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal("Cannot connect to server:", err)
+	}
+	defer c.Logout()
+
+	cc := compress.NewClient(c)
+	if ok, err := cc.SupportCompress(compress.Deflate); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("Server doesn't advertise COMPRESS=DEFLATE")
+	}
+
+	if err := cc.Compress(compress.Deflate); err != nil {
+		t.Fatal("Cannot enable compression:", err)
+	}
+	if err := cc.Compress(compress.Deflate); err != compress.ErrCompressionActive {
+		t.Fatalf("cc.Compress() = %v, want %v", err, compress.ErrCompressionActive)
+	}
+
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatal("Cannot login:", err)
+	}
+
+	mbox, err := c.Select("INBOX", false)
+	if err != nil {
+		t.Fatal("Cannot select INBOX:", err)
+	}
+	if mbox.Messages != 1 {
+		t.Errorf("Invalid number of messages: got %v, want 1", mbox.Messages)
+	}
+
+	if ok, err := cc.SupportCompress(compress.Deflate); err != nil {
+		t.Fatal(err)
+	} else if ok {
+		t.Error("Server still advertises COMPRESS=DEFLATE once compression is active")
+	}
+}
@@ -0,0 +1,90 @@
+package compress
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/server"
+)
+
+type handler struct {
+	Command
+
+	ext *extension
+}
+
+func (h *handler) Handle(conn server.Conn) error {
+	if h.Mechanism != Deflate {
+		return errors.New("Unsupported compression mechanism")
+	}
+	if h.ext.isActive(conn) {
+		return server.ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespNo,
+			Code: CodeCompressionActive,
+			Info: "DEFLATE active via COMPRESS",
+		})
+	}
+	return nil
+}
+
+func (h *handler) Upgrade(conn server.Conn) error {
+	err := conn.Upgrade(func(c net.Conn) (net.Conn, error) {
+		return newConn(c)
+	})
+	if err != nil {
+		return err
+	}
+
+	h.ext.setActive(conn)
+	return nil
+}
+
+type extension struct {
+	locker sync.Mutex
+	active map[server.Conn]bool
+}
+
+// NewExtension creates a server extension advertising COMPRESS=DEFLATE and
+// handling the COMPRESS command.
+func NewExtension() server.Extension {
+	return &extension{active: make(map[server.Conn]bool)}
+}
+
+func (ext *extension) isActive(conn server.Conn) bool {
+	ext.locker.Lock()
+	defer ext.locker.Unlock()
+	return ext.active[conn]
+}
+
+func (ext *extension) setActive(conn server.Conn) {
+	ext.locker.Lock()
+	ext.active[conn] = true
+	ext.locker.Unlock()
+
+	go func() {
+		<-conn.Context().LoggedOut
+
+		ext.locker.Lock()
+		delete(ext.active, conn)
+		ext.locker.Unlock()
+	}()
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if ext.isActive(c) {
+		return nil
+	}
+	return []string{Capability + "=" + Deflate}
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name != Capability {
+		return nil
+	}
+
+	return func() server.Handler {
+		return &handler{ext: ext}
+	}
+}
@@ -0,0 +1,145 @@
+package condstore
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+)
+
+// ErrNotSupported is returned if the server doesn't support CONDSTORE.
+var ErrNotSupported = errors.New("CONDSTORE is not supported by the server")
+
+// Client is a CONDSTORE client.
+type Client struct {
+	c *client.Client
+}
+
+// NewClient creates a new client.
+func NewClient(c *client.Client) *Client {
+	return &Client{c: c}
+}
+
+// SupportCondStore checks if the server supports the CONDSTORE extension.
+func (c *Client) SupportCondStore() (bool, error) {
+	return c.c.Support(Capability)
+}
+
+func (c *Client) ensureSupported() error {
+	if ok, err := c.SupportCondStore(); err != nil {
+		return err
+	} else if !ok {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+// Select is identical to client.Client.Select, but sends the CONDSTORE
+// parameter. This enables CONDSTORE for the rest of the session: the returned
+// status contains the HIGHESTMODSEQ item.
+func (c *Client) Select(name string, readOnly bool) (*imap.MailboxStatus, error) {
+	if err := c.ensureSupported(); err != nil {
+		return nil, err
+	}
+	if state := c.c.State(); state != imap.AuthenticatedState && state != imap.SelectedState {
+		return nil, client.ErrNotLoggedIn
+	}
+
+	cmd := &commands.Select{
+		Mailbox:   name,
+		ReadOnly:  readOnly,
+		CondStore: true,
+	}
+
+	mbox := &imap.MailboxStatus{Name: imap.CanonicalMailboxName(name), Items: make(map[imap.StatusItem]interface{})}
+	res := &responses.Select{Mailbox: mbox}
+
+	// Track the mailbox being selected so that unilateral responses update it
+	state := c.c.State()
+	c.c.SetState(state, mbox)
+
+	status, err := c.c.Execute(cmd, res)
+	if err == nil {
+		err = status.Err()
+	}
+	if err != nil {
+		c.c.SetState(imap.AuthenticatedState, nil)
+		return nil, err
+	}
+
+	mbox.ReadOnly = readOnly || status.Code == imap.CodeReadOnly
+	c.c.SetState(imap.SelectedState, mbox)
+	return mbox, nil
+}
+
+func (c *Client) store(uid bool, seqset *imap.SeqSet, unchangedSince uint64, item imap.StoreItem, value interface{}, ch chan *imap.Message) (*imap.SeqSet, error) {
+	if err := c.ensureSupported(); err != nil {
+		if ch != nil {
+			close(ch)
+		}
+		return nil, err
+	}
+	if c.c.State() != imap.SelectedState {
+		if ch != nil {
+			close(ch)
+		}
+		return nil, client.ErrNoMailboxSelected
+	}
+
+	var cmd imap.Commander = &commands.Store{
+		SeqSet:         seqset,
+		UnchangedSince: unchangedSince,
+		Item:           item,
+		Value:          value,
+	}
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	var h responses.Handler
+	if ch != nil {
+		h = &responses.Fetch{Messages: ch}
+		defer close(ch)
+	}
+
+	status, err := c.c.Execute(cmd, h)
+	if err != nil {
+		return nil, err
+	}
+	if err := status.Err(); err != nil {
+		return nil, err
+	}
+
+	modified := new(imap.SeqSet)
+	if status.Code == imap.CodeModified {
+		if len(status.Arguments) != 1 {
+			return nil, errors.New("Invalid MODIFIED response code")
+		}
+		s, ok := status.Arguments[0].(string)
+		if !ok {
+			return nil, errors.New("MODIFIED response code argument must be a string")
+		}
+		if modified, err = imap.ParseSeqSet(s); err != nil {
+			return nil, err
+		}
+	}
+	return modified, nil
+}
+
+// Store is identical to client.Client.Store, but only alters messages whose
+// mod-sequence is lower than or equal to unchangedSince, with the
+// UNCHANGEDSINCE modifier defined in RFC 7162 section 3.1.3. The messages that
+// failed this test are left untouched and returned. If ch is not nil, the
+// updated messages are sent to it with their new mod-sequence.
+func (c *Client) Store(seqset *imap.SeqSet, unchangedSince uint64, item imap.StoreItem, value interface{}, ch chan *imap.Message) (*imap.SeqSet, error) {
+	return c.store(false, seqset, unchangedSince, item, value, ch)
+}
+
+// UidStore is identical to Store, but seqset is interpreted as containing
+// unique identifiers instead of message sequence numbers. The returned set
+// contains unique identifiers too.
+func (c *Client) UidStore(seqset *imap.SeqSet, unchangedSince uint64, item imap.StoreItem, value interface{}, ch chan *imap.Message) (*imap.SeqSet, error) {
+	return c.store(true, seqset, unchangedSince, item, value, ch)
+}
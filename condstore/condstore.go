@@ -0,0 +1,16 @@
+// Package condstore implements the IMAP CONDSTORE extension, as defined in RFC
+// 7162 section 3.1.
+//
+// The core packages already handle the parts of CONDSTORE that extend
+// existing commands and responses: FETCH CHANGEDSINCE and the MODSEQ item
+// (client.Client.FetchChangedSince), the SEARCH MODSEQ criterion
+// (imap.SearchCriteria.ModSeq) and the HIGHESTMODSEQ status item
+// (imap.StatusHighestModSeq). Servers advertise CONDSTORE when their backend
+// implements backend.ModSeqBackend.
+//
+// This package provides a client for the remaining commands: SELECT with the
+// CONDSTORE parameter and conditional STORE.
+package condstore
+
+// The CONDSTORE capability.
+const Capability = "CONDSTORE"
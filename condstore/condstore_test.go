@@ -0,0 +1,85 @@
+package condstore_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/condstore"
+	"github.com/emersion/go-imap/server"
+)
+
+type modSeqBackend struct {
+	*memory.Backend
+}
+
+func (be *modSeqBackend) SupportModSeq() bool {
+	return true
+}
+
+func TestCondStore(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot listen:", err)
+	}
+
+	s := server.New(&modSeqBackend{memory.New()})
+	s.AllowInsecureAuth = true
+	defer s.Close()
+
+	go s.Serve(l)
+
+	c, err := client.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal("Cannot connect to server:", err)
+	}
+	defer c.Logout()
+
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatal("Cannot login:", err)
+	}
+
+	cc := condstore.NewClient(c)
+	if ok, err := cc.SupportCondStore(); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("Server doesn't advertise CONDSTORE")
+	}
+
+	mbox, err := cc.Select("INBOX", false)
+	if err != nil {
+		t.Fatal("Cannot select INBOX:", err)
+	}
+	if mbox.HighestModSeq != 1 {
+		t.Errorf("Invalid highest mod-sequence: got %v, want 1", mbox.HighestModSeq)
+	}
+	if c.State() != imap.SelectedState {
+		t.Errorf("Invalid state: got %v, want selected", c.State())
+	}
+
+	seqset, _ := imap.ParseSeqSet("1")
+	item := imap.FormatFlagsOp(imap.AddFlags, false)
+
+	ch := make(chan *imap.Message, 1)
+	modified, err := cc.Store(seqset, 1, item, []interface{}{imap.FlaggedFlag}, ch)
+	if err != nil {
+		t.Fatal("Cannot store flags:", err)
+	}
+	if !modified.Empty() {
+		t.Errorf("Invalid modified messages: got %v, want none", modified)
+	}
+	if msg := <-ch; msg == nil || msg.ModSeq != 2 {
+		t.Errorf("Invalid updated message: %v", msg)
+	}
+
+	// The message has been modified since mod-sequence 1
+	modified, err = cc.Store(seqset, 1, item, []interface{}{imap.DeletedFlag}, nil)
+	if err != nil {
+		t.Fatal("Cannot store flags:", err)
+	}
+	if modified.String() != "1" {
+		t.Errorf("Invalid modified messages: got %v, want 1", modified)
+	}
+}
@@ -2,8 +2,12 @@ package imap
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // A connection state.
@@ -64,6 +68,41 @@ func NewDebugWriter(local, remote io.Writer) io.Writer {
 	return &debugWriter{Writer: local, local: local, remote: remote}
 }
 
+// debugWriters are the writers network activity is logged to.
+type debugWriters struct {
+	local  io.Writer
+	remote io.Writer
+}
+
+// debugReader logs data read from the connection to the remote debug writer.
+type debugReader struct {
+	io.Reader
+	c *Conn
+}
+
+func (r *debugReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if n > 0 {
+		r.c.logDebug(false, b[:n])
+	}
+	return n, err
+}
+
+// debugConnWriter logs data written to the connection to the local debug
+// writer.
+type debugConnWriter struct {
+	io.Writer
+	c *Conn
+}
+
+func (w *debugConnWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	if n > 0 {
+		w.c.logDebug(true, b[:n])
+	}
+	return n, err
+}
+
 type multiFlusher struct {
 	flushers []flusher
 }
@@ -81,6 +120,33 @@ func newMultiFlusher(flushers ...flusher) flusher {
 	return &multiFlusher{flushers}
 }
 
+// idleConn extends the read or write deadline of a connection before each read
+// or write, if an idle timeout is set.
+type idleConn struct {
+	net.Conn
+
+	// The idle timeout, in nanoseconds. Accessed atomically.
+	timeout *int64
+}
+
+func (c *idleConn) Read(b []byte) (int, error) {
+	if d := time.Duration(atomic.LoadInt64(c.timeout)); d > 0 {
+		if err := c.Conn.SetReadDeadline(time.Now().Add(d)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *idleConn) Write(b []byte) (int, error) {
+	if d := time.Duration(atomic.LoadInt64(c.timeout)); d > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(d)); err != nil {
+			return 0, err
+		}
+	}
+	return c.Conn.Write(b)
+}
+
 // An IMAP connection.
 type Conn struct {
 	net.Conn
@@ -90,10 +156,23 @@ type Conn struct {
 	br *bufio.Reader
 	bw *bufio.Writer
 
-	waits chan struct{}
+	// Buffer sizes, zero means the bufio default.
+	readBufSize, writeBufSize int
+	// Data read before the buffers have been resized.
+	pending []byte
+
+	waits       chan struct{}
+	waitsLocker sync.Mutex
 
-	// Print all commands and responses to this io.Writer.
-	debug io.Writer
+	// The idle timeout, in nanoseconds. Accessed atomically.
+	idleTimeout int64
+
+	// Print all commands and responses to these writers. Contains a
+	// *debugWriters, accessed atomically.
+	debug atomic.Value
+	// Serializes writes to the debug writers, which are shared by reads and
+	// writes.
+	debugLocker sync.Mutex
 }
 
 // NewConn creates a new IMAP connection.
@@ -105,32 +184,26 @@ func NewConn(conn net.Conn, r *Reader, w *Writer) *Conn {
 }
 
 func (c *Conn) init() {
-	r := io.Reader(c.Conn)
-	w := io.Writer(c.Conn)
-
-	if c.debug != nil {
-		localDebug, remoteDebug := c.debug, c.debug
-		if debug, ok := c.debug.(*debugWriter); ok {
-			localDebug, remoteDebug = debug.local, debug.remote
-		}
-
-		if localDebug != nil {
-			w = io.MultiWriter(c.Conn, localDebug)
-		}
-		if remoteDebug != nil {
-			r = io.TeeReader(c.Conn, remoteDebug)
-		}
+	idle := &idleConn{c.Conn, &c.idleTimeout}
+	r := io.Reader(&debugReader{idle, c})
+	w := io.Writer(&debugConnWriter{idle, c})
+
+	if c.pending != nil {
+		// Pending data has already been logged, don't read it through the
+		// debug reader
+		r = io.MultiReader(bytes.NewReader(c.pending), r)
+		c.pending = nil
 	}
 
-	if c.br == nil {
-		c.br = bufio.NewReader(r)
+	if c.br == nil || c.br.Size() != bufSize(c.readBufSize) {
+		c.br = bufio.NewReaderSize(r, bufSize(c.readBufSize))
 		c.Reader.reader = c.br
 	} else {
 		c.br.Reset(r)
 	}
 
-	if c.bw == nil {
-		c.bw = bufio.NewWriter(w)
+	if c.bw == nil || c.bw.Size() != bufSize(c.writeBufSize) {
+		c.bw = bufio.NewWriterSize(w, bufSize(c.writeBufSize))
 		c.Writer.Writer = c.bw
 	} else {
 		c.bw.Reset(w)
@@ -147,6 +220,39 @@ func (c *Conn) init() {
 	}
 }
 
+// The default buffer size, same as bufio's.
+const defaultBufSize = 4096
+
+func bufSize(size int) int {
+	if size <= 0 {
+		return defaultBufSize
+	}
+	return size
+}
+
+// SetBufferSizes sets the size of the read and write buffers. Larger buffers
+// reduce the number of system calls when transferring large messages. A zero
+// size stands for the default size of 4096 bytes. The sizes are kept when the
+// connection is upgraded.
+//
+// Buffered output is flushed, and data that has already been buffered but not
+// read yet is kept. SetBufferSizes must not be called concurrently with reads
+// or writes.
+func (c *Conn) SetBufferSizes(readSize, writeSize int) error {
+	if err := c.Flush(); err != nil {
+		return err
+	}
+
+	if n := c.br.Buffered(); n > 0 {
+		b, _ := c.br.Peek(n)
+		c.pending = append([]byte(nil), b...)
+	}
+
+	c.readBufSize, c.writeBufSize = readSize, writeSize
+	c.init()
+	return nil
+}
+
 // Write implements io.Writer.
 func (c *Conn) Write(b []byte) (n int, err error) {
 	return c.Writer.Write(b)
@@ -166,8 +272,11 @@ func (c *Conn) Upgrade(upgrader ConnUpgrader) error {
 	}
 
 	// Block reads and writes during the upgrading process
-	c.waits = make(chan struct{})
-	defer close(c.waits)
+	waits := make(chan struct{})
+	c.waitsLocker.Lock()
+	c.waits = waits
+	c.waitsLocker.Unlock()
+	defer close(waits)
 
 	upgraded, err := upgrader(c.Conn)
 	if err != nil {
@@ -179,16 +288,63 @@ func (c *Conn) Upgrade(upgrader ConnUpgrader) error {
 	return nil
 }
 
+// SetIdleTimeout sets the maximum amount of time the connection can stay
+// inactive. The read and write deadlines are extended every time data is read
+// or written, so the connection only fails after d of genuine inactivity: long
+// transfers and IDLE commands don't time out as long as data keeps flowing.
+// The idle timeout is kept when the connection is upgraded, e.g. with TLS or
+// compression.
+//
+// While an idle timeout is set, it overrides deadlines set with SetDeadline,
+// SetReadDeadline and SetWriteDeadline. The deadlines of pending reads and
+// writes are reset to d from now. A zero duration disables the idle timeout
+// and clears the deadlines. SetIdleTimeout can be called concurrently with
+// reads and writes.
+func (c *Conn) SetIdleTimeout(d time.Duration) error {
+	atomic.StoreInt64(&c.idleTimeout, int64(d))
+	if d <= 0 {
+		return c.Conn.SetDeadline(time.Time{})
+	}
+	return c.Conn.SetDeadline(time.Now().Add(d))
+}
+
 // Wait waits for the connection to be ready for reads and writes.
 func (c *Conn) Wait() {
-	if c.waits != nil {
-		<-c.waits
+	c.waitsLocker.Lock()
+	waits := c.waits
+	c.waitsLocker.Unlock()
+
+	if waits != nil {
+		<-waits
 	}
 }
 
 // SetDebug defines an io.Writer to which all network activity will be logged.
-// If nil is provided, network activity will not be logged.
+// If nil is provided, network activity will not be logged. SetDebug can be
+// called concurrently with reads and writes.
 func (c *Conn) SetDebug(w io.Writer) {
-	c.debug = w
-	c.init()
+	local, remote := w, w
+	if debug, ok := w.(*debugWriter); ok {
+		local, remote = debug.local, debug.remote
+	}
+	c.debug.Store(&debugWriters{local, remote})
+}
+
+func (c *Conn) logDebug(local bool, b []byte) {
+	debug, _ := c.debug.Load().(*debugWriters)
+	if debug == nil {
+		return
+	}
+
+	w := debug.remote
+	if local {
+		w = debug.local
+	}
+	if w == nil {
+		return
+	}
+
+	c.debugLocker.Lock()
+	w.Write(b)
+	c.debugLocker.Unlock()
 }
@@ -2,9 +2,11 @@ package imap_test
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/emersion/go-imap"
 )
@@ -104,3 +106,126 @@ func TestConn_Upgrade(t *testing.T) {
 		t.Errorf("Expected %v but received %v", expected, received)
 	}
 }
+
+// countingConn counts writes and discards written data.
+type countingConn struct {
+	net.Conn
+	writes int
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	c.writes++
+	return len(b), nil
+}
+
+func TestConn_SetBufferSizes(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	ic := imap.NewConn(c, imap.NewReader(nil), imap.NewWriter(nil))
+
+	go io.WriteString(s, "* OK first\r\n* OK second\r\n")
+
+	if _, err := imap.ReadResp(ic.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second response has already been buffered, it must not be lost
+	if err := ic.SetBufferSizes(64*1024, 64*1024); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := imap.ReadResp(ic.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, ok := resp.(*imap.StatusResp); !ok || status.Info != "second" {
+		t.Fatalf("Invalid response after resizing buffers: %#v", resp)
+	}
+
+	// Sizes must be kept after an upgrade
+	counting := &countingConn{}
+	if err := ic.Upgrade(func(conn net.Conn) (net.Conn, error) {
+		counting.Conn = conn
+		return counting, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ic.Write(make([]byte, 10000))
+	if counting.writes != 0 {
+		t.Errorf("Expected data to be buffered, got %v writes", counting.writes)
+	}
+	ic.Flush()
+	if counting.writes != 1 {
+		t.Errorf("Expected a single write, got %v", counting.writes)
+	}
+}
+
+func BenchmarkConn_Write(b *testing.B) {
+	msg := bytes.Repeat([]byte("0123456789abcdef"), 64*1024) // 1 MiB
+
+	for _, size := range []int{0, 64 * 1024} {
+		b.Run(fmt.Sprintf("BufferSize%v", size), func(b *testing.B) {
+			counting := &countingConn{}
+			ic := imap.NewConn(counting, imap.NewReader(nil), imap.NewWriter(nil))
+			if err := ic.SetBufferSizes(size, size); err != nil {
+				b.Fatal(err)
+			}
+
+			b.SetBytes(int64(len(msg)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Responses are written in small chunks
+				for j := 0; j < len(msg); j += 512 {
+					if _, err := ic.Write(msg[j : j+512]); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := ic.Flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(counting.writes)/float64(b.N), "writes/op")
+		})
+	}
+}
+
+func TestConn_SetIdleTimeout(t *testing.T) {
+	c, s := net.Pipe()
+	defer s.Close()
+
+	ic := imap.NewConn(c, imap.NewReader(nil), imap.NewWriter(nil))
+	defer ic.Close()
+
+	if err := ic.SetIdleTimeout(100 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// The idle timeout is kept across upgrades
+	if err := ic.Upgrade(func(conn net.Conn) (net.Conn, error) {
+		return &upgraded{conn}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A slow but steady stream, which takes much longer than the idle timeout
+	go func() {
+		io.WriteString(s, "* 1 FETCH (BODY[] {10}\r\n")
+		for i := 0; i < 10; i++ {
+			time.Sleep(30 * time.Millisecond)
+			io.WriteString(s, "a")
+		}
+		io.WriteString(s, ")\r\n")
+	}()
+
+	if _, err := imap.ReadResp(ic.Reader); err != nil {
+		t.Fatalf("ReadResp() = %v", err)
+	}
+
+	// Nothing is sent anymore
+	_, err := imap.ReadResp(ic.Reader)
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Fatalf("ReadResp() = %v, want a timeout error", err)
+	}
+}
@@ -2,6 +2,7 @@ package imap
 
 import (
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -70,3 +71,30 @@ func parseMessageDateTime(maybeDate string) (time.Time, error) {
 	}
 	return time.Time{}, fmt.Errorf("date %s could not be parsed", maybeDate)
 }
+
+// Layouts of date-time values sent by servers in the wild, e.g. in INTERNALDATE
+// fetch items. DateTimeLayout is tried first.
+var dateTimeLayouts = [...]string{
+	DateTimeLayout,
+	"_2-Jan-2006 15:04:05 -07:00",
+	"_2-Jan-2006 15:04:05 MST",
+	"_2-Jan-2006 15:04:05",
+	"_2-Jan-2006 15:04 -0700",
+	"_2-Jan-06 15:04:05 -0700",
+}
+
+// Try parsing a date-time value as defined in RFC 3501, tolerating common
+// deviations: missing or extra whitespace and alternative timezone formats.
+func parseDateTime(maybeDate string) (time.Time, error) {
+	// Collapse runs of whitespace, servers sometimes add extra spaces to pad
+	// single-digit days
+	s := strings.Join(strings.Fields(maybeDate), " ")
+
+	for _, layout := range dateTimeLayouts {
+		parsed, err := time.Parse(layout, s)
+		if err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("date-time %s could not be parsed", maybeDate)
+}
@@ -71,6 +71,42 @@ func TestParseDateTime(t *testing.T) {
 	}
 }
 
+func TestParseDateTime_lenient(t *testing.T) {
+	tests := []struct {
+		in  string
+		out time.Time
+		ok  bool
+	}{
+		{"2-Nov-2009 23:00:00 -0600", expectedDateTime, true},
+		{"02-Nov-2009 23:00:00 -0600", expectedDateTime, true},
+		{" 2-Nov-2009 23:00:00 -0600", expectedDateTime, true},
+		{"2-Nov-2009  23:00:00  -0600 ", expectedDateTime, true},
+		{"2-nov-2009 23:00:00 -0600", expectedDateTime, true},
+		{"2-Nov-2009 23:00:00 -06:00", expectedDateTime, true},
+		{"2-Nov-2009 23:00 -0600", expectedDateTime, true},
+		{"2-Nov-09 23:00:00 -0600", expectedDateTime, true},
+		{"2-Nov-2009 05:00:00 GMT", time.Date(2009, time.November, 2, 5, 0, 0, 0, time.UTC), true},
+		{"2-Nov-2009 05:00:00", time.Date(2009, time.November, 2, 5, 0, 0, 0, time.UTC), true},
+
+		// invalid
+		{"", time.Time{}, false},
+		{"2-Nov-2009", time.Time{}, false},
+		{"2 Nov 2009 23:00:00 -0600", time.Time{}, false},
+	}
+	for _, test := range tests {
+		out, err := parseDateTime(test.in)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("parseDateTime(%q) expected error; got %q", test.in, out)
+			}
+		} else if err != nil {
+			t.Errorf("parseDateTime(%q) expected %q; got %v", test.in, test.out, err)
+		} else if !out.Equal(test.out) {
+			t.Errorf("parseDateTime(%q) expected %q; got %q", test.in, test.out, out)
+		}
+	}
+}
+
 func TestParseDate(t *testing.T) {
 	tests := []struct {
 		in  string
@@ -0,0 +1,167 @@
+package imap_test
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/emersion/go-imap"
+)
+
+// Responses sent by real servers, used as the seed corpus of FuzzReadResp.
+var fuzzRespCorpus = []string{
+	"* OK [CAPABILITY IMAP4rev1 SASL-IR LOGIN-REFERRALS ID ENABLE IDLE LITERAL+ STARTTLS AUTH=PLAIN] Dovecot ready.\r\n",
+	"* CAPABILITY IMAP4rev1 UNSELECT IDLE NAMESPACE QUOTA ID XLIST CHILDREN X-GM-EXT-1 UIDPLUS COMPRESS=DEFLATE ENABLE MOVE CONDSTORE ESEARCH UTF8=ACCEPT LIST-EXTENDED LIST-STATUS LITERAL- SPECIAL-USE APPENDLIMIT=35651584\r\n",
+	"a001 OK [READ-WRITE] SELECT completed\r\n",
+	"* FLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft $Forwarded)\r\n",
+	"* OK [PERMANENTFLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft $Forwarded \\*)] Flags permitted.\r\n",
+	"* 172 EXISTS\r\n",
+	"* OK [UIDVALIDITY 3857529045] UIDs valid\r\n",
+	"* OK [UIDNEXT 4392] Predicted next UID\r\n",
+	"* LIST (\\HasNoChildren) \"/\" \"INBOX\"\r\n",
+	"* LIST (\\HasChildren \\Noselect) \"/\" \"[Gmail]\"\r\n",
+	"* LIST (\\HasNoChildren) \"/\" {12}\r\nSent Message\r\n",
+	"* STATUS blurdybloop (MESSAGES 231 UIDNEXT 44292)\r\n",
+	"* SEARCH 2 84 882\r\n",
+	"* 12 FETCH (FLAGS (\\Seen) INTERNALDATE \"17-Jul-1996 02:44:25 -0700\" RFC822.SIZE 4286 UID 1234)\r\n",
+	"* 12 FETCH (ENVELOPE (\"Wed, 17 Jul 1996 02:23:25 -0700 (PDT)\" \"IMAP4rev1 WG mtg summary and minutes\" ((\"Terry Gray\" NIL \"gray\" \"cac.washington.edu\")) ((\"Terry Gray\" NIL \"gray\" \"cac.washington.edu\")) ((\"Terry Gray\" NIL \"gray\" \"cac.washington.edu\")) ((NIL NIL \"imap\" \"cac.washington.edu\")) ((NIL NIL \"minutes\" \"CNRI.Reston.VA.US\")(\"John Klensin\" NIL \"KLENSIN\" \"MIT.EDU\")) NIL NIL \"<B27397-0100000@cac.washington.edu>\"))\r\n",
+	"* 12 FETCH (BODYSTRUCTURE ((\"TEXT\" \"PLAIN\" (\"CHARSET\" \"US-ASCII\") NIL NIL \"7BIT\" 1152 23)(\"TEXT\" \"PLAIN\" (\"CHARSET\" \"US-ASCII\" \"NAME\" \"cc.diff\") \"<960723163407.20117h@cac.washington.edu>\" \"Compiler diff\" \"BASE64\" 4554 73) \"MIXED\"))\r\n",
+	"* 1 FETCH (UID 42 BODY[HEADER.FIELDS (SUBJECT)] {13}\r\nSubject: Hi\r\n)\r\n",
+	"* 2 FETCH (MODSEQ (624140003) FLAGS (\\Seen))\r\n",
+	"* 3 EXPUNGE\r\n",
+	"* ID (\"name\" \"Dovecot\" \"vendor\" NIL)\r\n",
+	"+ Ready for literal data\r\n",
+	"+\r\n",
+	"* NO [ALERT] System shutdown in 10 minutes\r\n",
+	"* BYE Autologout; idle for too long\r\n",
+	"a002 NO [INUSE] Mailbox in use\r\n",
+	"a003 OK [APPENDUID 38505 3955] APPEND completed\r\n",
+	"a004 NO [BADCHARSET (UTF-8 US-ASCII)] Unsupported charset\r\n",
+}
+
+// Syntactically valid responses with invalid contents.
+var fuzzRespInvalid = []string{
+	"* STATUS INBOX (MESSAGES 99999999999999999999)\r\n",
+	"* 99999999999999999999 EXISTS\r\n",
+	"* 1 FETCH (ENVELOPE (NIL NIL (NIL) ((NIL)) NIL NIL NIL NIL NIL))\r\n",
+	"* 1 FETCH (BODYSTRUCTURE (() \"MIXED\"))\r\n",
+	"* 1 FETCH (BODYSTRUCTURE (\"TEXT\" \"PLAIN\" NIL NIL NIL NIL \"x\"))\r\n",
+	"* 1 FETCH (BODY[1.2.3.HEADER.FIELDS] NIL UID)\r\n",
+	"* LIST () NIL NIL\r\n",
+	"* ID (\"name\")\r\n",
+	"* OK [UIDVALIDITY] Missing argument\r\n",
+	"* OK [] Empty code\r\n",
+	"* OK [CODE \"unterminated] text\r\n",
+}
+
+// Malformed responses, which must be rejected by ReadResp.
+var fuzzRespMalformed = []string{
+	"* LIST (\\HasNoChildren \"/\" INBOX\r\n",
+	"* LIST \\HasNoChildren) \"/\" INBOX\r\n",
+	"* 1 FETCH (BODY[] {4294967295}\r\nabc",
+	"* 1 FETCH (BODY[] {99999999999999999999}\r\n\r\n",
+	"* 1 FETCH (BODY[] {10}\r\nabc",
+	"* 1 FETCH (BODY[] {-1}\r\n\r\n",
+	"* 1 FETCH (BODY[] {1\r\n",
+	"* 1 FETCH (" + string(bytes.Repeat([]byte("("), 10000)) + "\r\n",
+	"* OK [" + string(bytes.Repeat([]byte("["), 10000)),
+	"* SEARCH \"unterminated\r\n",
+	"* FETCH \"\\x\"\r\n",
+	"a005 OK",
+	"*",
+	"",
+	"\r\n",
+	")\r\n",
+}
+
+// fuzzMaxLiteralSize is the maximum literal size used when fuzzing, so that
+// huge literal lengths don't exhaust memory.
+const fuzzMaxLiteralSize = 64 * 1024
+
+// parseFuzzResps reads all responses in b and tries to parse their contents.
+func parseFuzzResps(b []byte) {
+	r := imap.NewReader(bufio.NewReader(bytes.NewReader(b)))
+	r.MaxLiteralSize = fuzzMaxLiteralSize
+
+	// Each response consumes at least one byte, so this is enough to read all
+	// of them
+	for i := 0; i <= len(b); i++ {
+		resp, err := imap.ReadResp(r)
+		if err != nil {
+			if imap.IsParseError(err) {
+				// The client skips invalid responses
+				continue
+			}
+			return
+		}
+
+		name, fields, ok := imap.ParseNamedResp(resp)
+		if !ok {
+			continue
+		}
+
+		switch name {
+		case "FETCH":
+			msg := &imap.Message{}
+			if len(fields) > 0 {
+				if l, ok := fields[0].([]interface{}); ok {
+					msg.Parse(l)
+				}
+			}
+		case "LIST", "LSUB":
+			(&imap.MailboxInfo{}).Parse(fields)
+		case "STATUS":
+			if len(fields) > 1 {
+				if l, ok := fields[1].([]interface{}); ok {
+					(&imap.MailboxStatus{}).Parse(l)
+				}
+			}
+		case "ID":
+			if len(fields) > 0 {
+				imap.ParseID(fields[0])
+			}
+		}
+	}
+}
+
+func FuzzReadResp(f *testing.F) {
+	for _, s := range fuzzRespCorpus {
+		f.Add([]byte(s))
+	}
+	for _, s := range fuzzRespInvalid {
+		f.Add([]byte(s))
+	}
+	for _, s := range fuzzRespMalformed {
+		f.Add([]byte(s))
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		parseFuzzResps(b)
+	})
+}
+
+func TestReadResp_malformed(t *testing.T) {
+	for _, s := range fuzzRespMalformed {
+		r := imap.NewReader(bufio.NewReader(bytes.NewBufferString(s)))
+		r.MaxLiteralSize = fuzzMaxLiteralSize
+
+		if resp, err := imap.ReadResp(r); err == nil {
+			t.Errorf("ReadResp(%.40q) = %v, expected an error", s, resp)
+		}
+	}
+}
+
+func TestReadResp_corpus(t *testing.T) {
+	for _, s := range fuzzRespCorpus {
+		r := imap.NewReader(bufio.NewReader(bytes.NewBufferString(s)))
+
+		if _, err := imap.ReadResp(r); err != nil {
+			t.Errorf("ReadResp(%.40q) = %v", s, err)
+		}
+	}
+
+	// Parsing the contents of invalid responses must not panic
+	for _, s := range fuzzRespInvalid {
+		parseFuzzResps([]byte(s))
+	}
+}
@@ -0,0 +1,111 @@
+package gmail
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/responses"
+)
+
+// ErrNotSupported is returned if the server doesn't support the Gmail
+// extensions.
+var ErrNotSupported = errors.New("X-GM-EXT-1 is not supported by the server")
+
+// Client is a client for the Gmail extensions.
+type Client struct {
+	c *client.Client
+}
+
+// NewClient creates a new client.
+func NewClient(c *client.Client) *Client {
+	return &Client{c: c}
+}
+
+// SupportGmail checks if the server supports the Gmail extensions.
+func (c *Client) SupportGmail() (bool, error) {
+	return c.c.Support(Capability)
+}
+
+func (c *Client) ensureSupported() error {
+	if ok, err := c.SupportGmail(); err != nil {
+		return err
+	} else if !ok {
+		return ErrNotSupported
+	}
+	return nil
+}
+
+// StoreLabels alters the labels of messages. If ch is not nil, the updated
+// messages are sent to it, their labels can be read with Labels.
+func (c *Client) StoreLabels(seqset *imap.SeqSet, op LabelsOp, labels []string, ch chan *imap.Message) error {
+	if err := c.ensureSupported(); err != nil {
+		if ch != nil {
+			close(ch)
+		}
+		return err
+	}
+	return c.c.Store(seqset, FormatLabelsOp(op, ch == nil), FormatLabels(labels), ch)
+}
+
+// UidStoreLabels is identical to StoreLabels, but seqset is interpreted as
+// containing unique identifiers instead of message sequence numbers.
+func (c *Client) UidStoreLabels(seqset *imap.SeqSet, op LabelsOp, labels []string, ch chan *imap.Message) error {
+	if err := c.ensureSupported(); err != nil {
+		if ch != nil {
+			close(ch)
+		}
+		return err
+	}
+	return c.c.UidStore(seqset, FormatLabelsOp(op, ch == nil), FormatLabels(labels), ch)
+}
+
+// SearchCommand is a SEARCH command with the X-GM-RAW search key, which takes
+// a query in the Gmail search syntax.
+type SearchCommand struct {
+	Query string
+}
+
+func (cmd *SearchCommand) Command() *imap.Command {
+	return &imap.Command{
+		Name:      "SEARCH",
+		Arguments: []interface{}{"CHARSET", "UTF-8", searchRaw, cmd.Query},
+	}
+}
+
+func (c *Client) search(uid bool, query string) ([]uint32, error) {
+	if c.c.State() != imap.SelectedState {
+		return nil, client.ErrNoMailboxSelected
+	}
+	if err := c.ensureSupported(); err != nil {
+		return nil, err
+	}
+
+	var cmd imap.Commander = &SearchCommand{Query: query}
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	res := new(responses.Search)
+
+	status, err := c.c.Execute(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+	return res.Ids, nil
+}
+
+// Search searches messages with a query in the Gmail search syntax, e.g.
+// "has:attachment in:unread", and returns their sequence numbers.
+func (c *Client) Search(query string) ([]uint32, error) {
+	return c.search(false, query)
+}
+
+// UidSearch is identical to Search, but UIDs are returned instead of sequence
+// numbers.
+func (c *Client) UidSearch(query string) ([]uint32, error) {
+	return c.search(true, query)
+}
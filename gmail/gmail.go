@@ -0,0 +1,120 @@
+// Package gmail implements the Gmail IMAP extensions, as documented in
+// https://developers.google.com/gmail/imap/imap-extensions.
+//
+// Gmail message IDs, thread IDs and labels are fetched as regular items with
+// client.Client.Fetch, and read from the returned messages with MsgId, ThrId
+// and Labels. This package provides a client for the commands which take
+// Gmail-specific arguments: storing labels and searching with the Gmail
+// search syntax.
+package gmail
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+// The Gmail extensions capability.
+const Capability = "X-GM-EXT-1"
+
+// Gmail fetch items.
+const (
+	// A unique and immutable message ID, the same in all mailboxes.
+	FetchMsgId imap.FetchItem = "X-GM-MSGID"
+	// The ID of the conversation the message belongs to.
+	FetchThrId imap.FetchItem = "X-GM-THRID"
+	// The labels of the message.
+	FetchLabels imap.FetchItem = "X-GM-LABELS"
+)
+
+// The search key taking a query in the Gmail search syntax, e.g.
+// "has:attachment in:unread".
+const searchRaw = "X-GM-RAW"
+
+// System labels. Labels starting with a backslash are system labels, other
+// labels are mailbox names.
+const (
+	InboxLabel     = "\\Inbox"
+	DraftsLabel    = "\\Drafts"
+	ImportantLabel = "\\Important"
+	SentLabel      = "\\Sent"
+	SpamLabel      = "\\Spam"
+	StarredLabel   = "\\Starred"
+	TrashLabel     = "\\Trash"
+)
+
+// LabelsOp is an operation applied on message labels with STORE.
+type LabelsOp string
+
+const (
+	// SetLabels replaces existing labels by new ones.
+	SetLabels LabelsOp = "X-GM-LABELS"
+	// AddLabels adds new labels.
+	AddLabels LabelsOp = "+X-GM-LABELS"
+	// RemoveLabels removes existing labels.
+	RemoveLabels LabelsOp = "-X-GM-LABELS"
+)
+
+// FormatLabelsOp returns the StoreItem that executes the labels operation op.
+func FormatLabelsOp(op LabelsOp, silent bool) imap.StoreItem {
+	s := string(op)
+	if silent {
+		s += ".SILENT"
+	}
+	return imap.StoreItem(s)
+}
+
+func parseId(msg *imap.Message, item imap.FetchItem) (uint64, error) {
+	f, ok := msg.Items[item]
+	if !ok {
+		return 0, errors.New("gmail: " + string(item) + " hasn't been fetched")
+	}
+	return imap.ParseNumber64(f)
+}
+
+// MsgId returns the Gmail message ID of a message fetched with FetchMsgId.
+func MsgId(msg *imap.Message) (uint64, error) {
+	return parseId(msg, FetchMsgId)
+}
+
+// ThrId returns the Gmail thread ID of a message fetched with FetchThrId.
+func ThrId(msg *imap.Message) (uint64, error) {
+	return parseId(msg, FetchThrId)
+}
+
+// Labels returns the labels of a message fetched with FetchLabels. Names of
+// labels which aren't system labels are decoded like mailbox names.
+func Labels(msg *imap.Message) ([]string, error) {
+	f, ok := msg.Items[FetchLabels]
+	if !ok {
+		return nil, errors.New("gmail: " + string(FetchLabels) + " hasn't been fetched")
+	}
+
+	labels, err := imap.ParseStringList(f)
+	if err != nil {
+		return nil, err
+	}
+	for i, label := range labels {
+		if strings.HasPrefix(label, "\\") {
+			continue
+		}
+		if labels[i], err = imap.DecodeMailboxName(label); err != nil {
+			return nil, err
+		}
+	}
+	return labels, nil
+}
+
+// FormatLabels formats labels to a list, as used by STORE.
+func FormatLabels(labels []string) []interface{} {
+	fields := make([]interface{}, len(labels))
+	for i, label := range labels {
+		if strings.HasPrefix(label, "\\") {
+			fields[i] = label
+		} else {
+			fields[i] = imap.FormatMailboxName(label)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,123 @@
+package gmail_test
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/gmail"
+)
+
+func TestMessageItems(t *testing.T) {
+	msg := &imap.Message{}
+	fields := []interface{}{
+		string(gmail.FetchMsgId), "1278455344230334865",
+		string(gmail.FetchThrId), "1266894439832287888",
+		string(gmail.FetchLabels), []interface{}{"\\Inbox", "Friends", "&AMk-t&AOk-"},
+	}
+	if err := msg.Parse(fields); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := gmail.MsgId(msg); err != nil || id != 1278455344230334865 {
+		t.Errorf("gmail.MsgId() = %v, %v, want 1278455344230334865", id, err)
+	}
+	if id, err := gmail.ThrId(msg); err != nil || id != 1266894439832287888 {
+		t.Errorf("gmail.ThrId() = %v, %v, want 1266894439832287888", id, err)
+	}
+	want := []string{gmail.InboxLabel, "Friends", "Été"}
+	if labels, err := gmail.Labels(msg); err != nil || !reflect.DeepEqual(labels, want) {
+		t.Errorf("gmail.Labels() = %v, %v, want %v", labels, err, want)
+	}
+
+	if _, err := gmail.Labels(&imap.Message{}); err == nil {
+		t.Error("Expected an error when labels haven't been fetched")
+	}
+}
+
+// testClient returns a client connected to a fake server advertising the
+// Gmail extensions, with a mailbox selected.
+func testClient(t *testing.T) (*gmail.Client, *bufio.ReadWriter, net.Conn) {
+	cc, sc := net.Pipe()
+	rw := bufio.NewReadWriter(bufio.NewReader(sc), bufio.NewWriter(sc))
+
+	// The greeting is written while the client reads it, the writer must only
+	// be used by the test once it has been sent
+	greeted := make(chan struct{})
+	go func() {
+		rw.WriteString("* OK [CAPABILITY IMAP4rev1 X-GM-EXT-1] Gimap ready\r\n")
+		rw.Flush()
+		close(greeted)
+	}()
+
+	c, err := client.New(cc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-greeted
+	c.SetState(imap.SelectedState, &imap.MailboxStatus{Name: "INBOX"})
+	return gmail.NewClient(c), rw, sc
+}
+
+func readCmd(t *testing.T, rw *bufio.ReadWriter) (tag, cmd string) {
+	line, err := rw.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.SplitN(strings.TrimSuffix(line, "\r\n"), " ", 2)
+	return parts[0], parts[1]
+}
+
+func TestClient_UidSearch(t *testing.T) {
+	c, rw, conn := testClient(t)
+	defer conn.Close()
+
+	done := make(chan error, 1)
+	var uids []uint32
+	go func() {
+		var err error
+		uids, err = c.UidSearch("has:attachment in:unread")
+		done <- err
+	}()
+
+	tag, cmd := readCmd(t, rw)
+	if want := "UID SEARCH CHARSET UTF-8 X-GM-RAW \"has:attachment in:unread\""; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	rw.WriteString("* SEARCH 4 12\r\n")
+	rw.WriteString(tag + " OK SEARCH completed\r\n")
+	rw.Flush()
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.UidSearch() = %v", err)
+	}
+	if want := []uint32{4, 12}; !reflect.DeepEqual(uids, want) {
+		t.Errorf("c.UidSearch() = %v, want %v", uids, want)
+	}
+}
+
+func TestClient_StoreLabels(t *testing.T) {
+	c, rw, conn := testClient(t)
+	defer conn.Close()
+
+	seqset, _ := imap.ParseSeqSet("1:2")
+	done := make(chan error, 1)
+	go func() {
+		done <- c.StoreLabels(seqset, gmail.AddLabels, []string{gmail.StarredLabel, "My Label"}, nil)
+	}()
+
+	tag, cmd := readCmd(t, rw)
+	if want := "STORE 1:2 +X-GM-LABELS.SILENT (\\Starred \"My Label\")"; cmd != want {
+		t.Fatalf("client sent command %v, want %v", cmd, want)
+	}
+	rw.WriteString(tag + " OK STORE completed\r\n")
+	rw.Flush()
+
+	if err := <-done; err != nil {
+		t.Fatalf("c.StoreLabels() = %v", err)
+	}
+}
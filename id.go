@@ -0,0 +1,88 @@
+package imap
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ID parameters, as defined in RFC 2971 section 3.3.
+const (
+	IDName        = "name"
+	IDVersion     = "version"
+	IDOS          = "os"
+	IDOSVersion   = "os-version"
+	IDVendor      = "vendor"
+	IDSupportURL  = "support-url"
+	IDAddress     = "address"
+	IDDate        = "date"
+	IDCommand     = "command"
+	IDArguments   = "arguments"
+	IDEnvironment = "environment"
+)
+
+// formatIDString formats an ID key or value. ID strings cannot be atoms: they
+// are sent as quoted strings, or as literals if they can't be quoted.
+func formatIDString(s string) interface{} {
+	for _, c := range s {
+		if c < 0x20 || c > 0x7e {
+			return bytes.NewBufferString(s)
+		}
+	}
+	return Quoted(s)
+}
+
+// FormatID formats ID parameters to a field. A nil or empty map is formatted
+// as NIL. Parameters are sorted by key.
+func FormatID(id map[string]string) interface{} {
+	if len(id) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(id))
+	for k := range id {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fields := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		fields = append(fields, formatIDString(k), formatIDString(id[k]))
+	}
+	return fields
+}
+
+// ParseID parses ID parameters from a field. NIL is parsed as a nil map. Keys
+// are converted to lower case, since they are case-insensitive. NIL values are
+// parsed as empty strings.
+func ParseID(f interface{}) (map[string]string, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	fields, ok := f.([]interface{})
+	if !ok {
+		return nil, errors.New("ID parameters must be a list or NIL")
+	} else if len(fields)%2 != 0 {
+		return nil, errors.New("ID parameters list must have an even number of fields")
+	}
+
+	id := make(map[string]string, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		k, err := ParseString(fields[i])
+		if err != nil {
+			return nil, errors.New("ID parameter key must be a string")
+		}
+
+		var v string
+		if fields[i+1] != nil {
+			if v, err = ParseString(fields[i+1]); err != nil {
+				return nil, errors.New("ID parameter value must be a string or NIL")
+			}
+		}
+
+		id[strings.ToLower(k)] = v
+	}
+	return id, nil
+}
@@ -0,0 +1,48 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormatID(t *testing.T) {
+	id := map[string]string{
+		IDName:   "go-imap",
+		IDVendor: "Café \"Gopher\"",
+		IDOS:     "linux",
+	}
+
+	w, b := newWriter()
+	if err := w.writeField(FormatID(id)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "(\"name\" \"go-imap\" \"os\" \"linux\" \"vendor\" {14}\r\nCafé \"Gopher\")"
+	if b.String() != want {
+		t.Errorf("Invalid formatted ID: got %q but expected %q", b.String(), want)
+	}
+
+	if f := FormatID(map[string]string{}); f != nil {
+		t.Errorf("Empty ID formatted as %v, expected NIL", f)
+	}
+}
+
+func TestParseID(t *testing.T) {
+	fields := []interface{}{"Name", "Dovecot", "version", nil}
+	id, err := ParseID(fields)
+	if err != nil {
+		t.Fatal("Cannot parse ID:", err)
+	}
+
+	want := map[string]string{IDName: "Dovecot", IDVersion: ""}
+	if !reflect.DeepEqual(id, want) {
+		t.Errorf("Invalid parsed ID: got %v but expected %v", id, want)
+	}
+
+	if id, err := ParseID(nil); err != nil || id != nil {
+		t.Errorf("ParseID(nil) = %v, %v, expected nil, nil", id, err)
+	}
+	if _, err := ParseID([]interface{}{"name"}); err == nil {
+		t.Error("Expected an error when parsing an odd number of fields")
+	}
+}
@@ -17,6 +17,22 @@ const (
 	StatusUidNext = "UIDNEXT"
 	StatusUidValidity = "UIDVALIDITY"
 	StatusUnseen = "UNSEEN"
+
+	// The maximum size of a message that can be appended to the mailbox, as
+	// defined in RFC 7889.
+	StatusAppendLimit = "APPENDLIMIT"
+
+	// The highest mod-sequence of all messages in the mailbox, as defined in
+	// RFC 7162.
+	StatusHighestModSeq = "HIGHESTMODSEQ"
+
+	// The unique identifier of the mailbox, as defined in RFC 8474.
+	StatusMailboxId = "MAILBOXID"
+
+	// The total size of the messages in the mailbox, as defined in RFC 8438.
+	StatusSize = "SIZE"
+	// The number of messages with the \Deleted flag, as defined in RFC 9051.
+	StatusDeleted = "DELETED"
 )
 
 // A FetchItem is a message data item that can be fetched.
@@ -40,6 +56,20 @@ const (
 	FetchRFC822Size = "RFC822.SIZE"
 	FetchRFC822Text = "RFC822.TEXT"
 	FetchUid = "UID"
+
+	// The mod-sequence of the message, defined in RFC 7162.
+	FetchModSeq = "MODSEQ"
+
+	// The unique identifiers of the message and of its thread, defined in RFC
+	// 8474.
+	FetchEmailId = "EMAILID"
+	FetchThreadId = "THREADID"
+
+	// A server-generated preview of the message text, defined in RFC 8970.
+	FetchPreview = "PREVIEW"
+
+	// The date the message was saved to its mailbox, defined in RFC 8514.
+	FetchSaveDate = "SAVEDATE"
 )
 
 // Expand expands the item if it's a macro.
@@ -104,3 +134,9 @@ func ParseFlagsOp(item StoreItem) (op FlagsOp, silent bool, err error) {
 // lower-case. utf-8 and us-ascii charsets are handled by default. One of the
 // the CharsetReader's result values must be non-nil.
 var CharsetReader func(charset string, r io.Reader) (io.Reader, error)
+
+// CharsetEncoder, if non-nil, defines a function to convert UTF-8 text into the
+// provided charset. It's the reverse of CharsetReader and is used by the client
+// to retry a search with a charset supported by the server. Charsets are always
+// lower-case. utf-8 and us-ascii charsets are handled by default.
+var CharsetEncoder func(charset string, s string) (string, error)
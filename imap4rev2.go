@@ -0,0 +1,6 @@
+package imap
+
+// IMAP4rev2 is the capability of servers implementing IMAP4rev2, as defined in
+// RFC 9051. Servers supporting both revisions only switch to IMAP4rev2 once it
+// has been enabled, see RFC 9051 section 6.3.1.
+const IMAP4rev2 = "IMAP4rev2"
@@ -0,0 +1,365 @@
+// Package imapurl parses and formats IMAP URLs, as defined in RFC 5092.
+//
+// IMAP URLs reference a server, a mailbox, a search or a message part. They
+// are used by the CATENATE (RFC 4469), URLAUTH (RFC 4467) and BURL (RFC 4468)
+// extensions.
+package imapurl
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scheme is the IMAP URL scheme.
+const Scheme = "imap"
+
+// ErrInvalid is returned by Parse if the URL isn't a valid IMAP URL.
+var ErrInvalid = errors.New("imapurl: invalid URL")
+
+// Partial is a byte range of a message part, see RFC 5092 section 5.
+type Partial struct {
+	// The offset of the first octet.
+	Offset uint32
+	// The number of octets. Zero means up to the end of the part.
+	Length uint32
+}
+
+// URL is an IMAP URL. Mailbox names, searches, sections and user names are
+// stored decoded.
+//
+// If Host is empty, the URL is relative to the server root, e.g.
+// "/INBOX/;UID=20", as accepted by CATENATE.
+type URL struct {
+	// The user name, empty if not specified.
+	User string
+	// The authentication mechanism, "*" for any mechanism, empty if not
+	// specified.
+	Auth string
+	// The server host, with an optional port.
+	Host string
+
+	// The mailbox name, empty for a server URL.
+	Mailbox string
+	// The UIDVALIDITY of the mailbox, zero if not specified.
+	UidValidity uint32
+	// A search criteria string, only valid for mailbox URLs.
+	Search string
+
+	// The UID of the referenced message, zero for a mailbox URL.
+	Uid uint32
+	// The body section, e.g. "1.2" or "HEADER", empty for the whole message.
+	Section string
+	// The byte range, nil for the whole part.
+	Partial *Partial
+
+	// The expiration date of an URLAUTH-authorized URL, zero if none.
+	Expire time.Time
+	// The URLAUTH access identifier, e.g. "anonymous" or "submit+fred". An URL
+	// with an access identifier but without a mechanism is a rump URL.
+	Access string
+	// The URLAUTH mechanism, e.g. "INTERNAL".
+	Mechanism string
+	// The URLAUTH token.
+	Token string
+}
+
+// Parse parses an IMAP URL. Both absolute URLs and URLs relative to the server
+// root are accepted.
+func Parse(s string) (*URL, error) {
+	u := &URL{}
+
+	path := s
+	if len(s) >= len(Scheme)+3 && strings.EqualFold(s[:len(Scheme)+3], Scheme+"://") {
+		rest := s[len(Scheme)+3:]
+		i := strings.IndexByte(rest, '/')
+		if i < 0 {
+			i = len(rest)
+		}
+		if err := u.parseServer(rest[:i]); err != nil {
+			return nil, err
+		}
+		path = rest[i:]
+		if path == "" {
+			return u, nil
+		}
+	} else if !strings.HasPrefix(s, "/") {
+		return nil, ErrInvalid
+	}
+
+	if err := u.parsePath(path[1:]); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (u *URL) parseServer(s string) error {
+	if i := strings.LastIndexByte(s, '@'); i >= 0 {
+		userinfo := s[:i]
+		s = s[i+1:]
+
+		if j := indexFold(userinfo, ";AUTH="); j >= 0 {
+			auth, err := url.PathUnescape(userinfo[j+len(";AUTH="):])
+			if err != nil || auth == "" {
+				return ErrInvalid
+			}
+			u.Auth = auth
+			userinfo = userinfo[:j]
+		}
+
+		user, err := url.PathUnescape(userinfo)
+		if err != nil || (user == "" && u.Auth == "") {
+			return ErrInvalid
+		}
+		u.User = user
+	}
+
+	if s == "" {
+		return ErrInvalid
+	}
+	u.Host = s
+	return nil
+}
+
+func (u *URL) parsePath(s string) error {
+	if s == "" {
+		return nil
+	}
+
+	hasSearch := false
+	if i := strings.IndexByte(s, '?'); i >= 0 {
+		search, err := url.PathUnescape(s[i+1:])
+		if err != nil || search == "" {
+			return ErrInvalid
+		}
+		u.Search = search
+		s = s[:i]
+		hasSearch = true
+	}
+
+	// The mailbox name ends with the first parameter. The slash preceding a
+	// parameter is a separator.
+	params := ""
+	slash := false
+	if i := strings.IndexByte(s, ';'); i >= 0 {
+		s, params = s[:i], s[i+1:]
+		if strings.HasSuffix(s, "/") {
+			s = strings.TrimSuffix(s, "/")
+			slash = true
+		}
+	}
+	mailbox, err := url.PathUnescape(s)
+	if err != nil || mailbox == "" {
+		return ErrInvalid
+	}
+	u.Mailbox = mailbox
+
+	if params == "" {
+		return nil
+	}
+
+	// Parameters must appear in this order, each at most once
+	const (
+		stateUidValidity = iota
+		stateUid
+		stateSection
+		statePartial
+		stateExpire
+		stateURLAuth
+		stateDone
+	)
+	state := stateUidValidity
+	for _, param := range strings.Split(params, ";") {
+		nextSlash := strings.HasSuffix(param, "/")
+		param = strings.TrimSuffix(param, "/")
+
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return ErrInvalid
+		}
+		k, v := strings.ToUpper(kv[0]), kv[1]
+
+		var next int
+		switch k {
+		case "UIDVALIDITY":
+			next = stateUidValidity
+			u.UidValidity, err = parseNumber(v)
+		case "UID":
+			next = stateUid
+			u.Uid, err = parseNumber(v)
+		case "SECTION":
+			next = stateSection
+			u.Section, err = url.PathUnescape(v)
+		case "PARTIAL":
+			next = statePartial
+			u.Partial, err = parsePartial(v)
+		case "EXPIRE":
+			next = stateExpire
+			u.Expire, err = time.Parse(time.RFC3339, v)
+		case "URLAUTH":
+			next = stateURLAuth
+			err = u.parseURLAuth(v)
+		default:
+			return ErrInvalid
+		}
+		if err != nil || next < state {
+			return ErrInvalid
+		}
+
+		// UID, SECTION and PARTIAL are path segments, the other parameters
+		// are appended to the previous segment
+		wantSlash := next == stateUid || next == stateSection || next == statePartial
+		if slash != wantSlash || (next > stateUidValidity && hasSearch) {
+			return ErrInvalid
+		}
+		if next > stateUid && u.Uid == 0 {
+			return ErrInvalid
+		}
+
+		state = next + 1
+		slash = nextSlash
+	}
+	if slash {
+		return ErrInvalid
+	}
+	return nil
+}
+
+func (u *URL) parseURLAuth(s string) error {
+	parts := strings.SplitN(s, ":", 3)
+	access, err := url.PathUnescape(parts[0])
+	if err != nil || access == "" {
+		return ErrInvalid
+	}
+	u.Access = access
+
+	switch len(parts) {
+	case 1:
+		return nil
+	case 3:
+		if parts[1] == "" || parts[2] == "" {
+			return ErrInvalid
+		}
+		u.Mechanism = strings.ToUpper(parts[1])
+		u.Token = parts[2]
+		return nil
+	default:
+		return ErrInvalid
+	}
+}
+
+func parseNumber(s string) (uint32, error) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n == 0 {
+		return 0, ErrInvalid
+	}
+	return uint32(n), nil
+}
+
+func parsePartial(s string) (*Partial, error) {
+	parts := strings.SplitN(s, ".", 2)
+	offset, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+
+	p := &Partial{Offset: uint32(offset)}
+	if len(parts) == 2 {
+		if p.Length, err = parseNumber(parts[1]); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// indexFold is like strings.Index, but case-insensitive. substr must be
+// upper-case.
+func indexFold(s, substr string) int {
+	return strings.Index(strings.ToUpper(s), substr)
+}
+
+// String formats the URL. Parameters are written in upper-case, as in the
+// examples of RFC 5092.
+func (u *URL) String() string {
+	var b strings.Builder
+
+	if u.Host != "" {
+		b.WriteString(Scheme + "://")
+		if u.User != "" || u.Auth != "" {
+			b.WriteString(escape(u.User, false))
+			if u.Auth == "*" {
+				b.WriteString(";AUTH=*")
+			} else if u.Auth != "" {
+				b.WriteString(";AUTH=" + escape(u.Auth, false))
+			}
+			b.WriteByte('@')
+		}
+		b.WriteString(u.Host)
+	}
+	b.WriteByte('/')
+
+	if u.Mailbox == "" {
+		return b.String()
+	}
+	b.WriteString(escape(u.Mailbox, true))
+	if u.UidValidity != 0 {
+		b.WriteString(";UIDVALIDITY=" + strconv.FormatUint(uint64(u.UidValidity), 10))
+	}
+	if u.Search != "" {
+		b.WriteString("?" + escape(u.Search, true))
+		return b.String()
+	}
+
+	if u.Uid == 0 {
+		return b.String()
+	}
+	b.WriteString("/;UID=" + strconv.FormatUint(uint64(u.Uid), 10))
+	if u.Section != "" {
+		b.WriteString("/;SECTION=" + escape(u.Section, true))
+	}
+	if u.Partial != nil {
+		b.WriteString("/;PARTIAL=" + strconv.FormatUint(uint64(u.Partial.Offset), 10))
+		if u.Partial.Length != 0 {
+			b.WriteString("." + strconv.FormatUint(uint64(u.Partial.Length), 10))
+		}
+	}
+	if !u.Expire.IsZero() {
+		b.WriteString(";EXPIRE=" + u.Expire.Format(time.RFC3339))
+	}
+	if u.Access != "" {
+		b.WriteString(";URLAUTH=" + escape(u.Access, false))
+		if u.Mechanism != "" {
+			b.WriteString(":" + u.Mechanism + ":" + u.Token)
+		}
+	}
+
+	return b.String()
+}
+
+// escape percent-encodes a string. If path is true, characters allowed in
+// path components (bchar in RFC 5092) are left as is, otherwise only
+// characters allowed in user names (achar) are.
+func escape(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAChar(c) || (path && (c == ':' || c == '@' || c == '/')) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte("0123456789ABCDEF"[c>>4])
+			b.WriteByte("0123456789ABCDEF"[c&0xF])
+		}
+	}
+	return b.String()
+}
+
+func isAChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("-._~!$'()*+,&=", c) >= 0
+}
@@ -0,0 +1,147 @@
+package imapurl
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var urlTests = []struct {
+	s   string
+	url *URL
+}{
+	{
+		s:   "imap://minbari.example.org/",
+		url: &URL{Host: "minbari.example.org"},
+	},
+	{
+		s:   "imap://psicorp.example.org/~peter/%E6%97%A5%E6%9C%AC%E8%AA%9E/%E5%8F%B0%E5%8C%97",
+		url: &URL{Host: "psicorp.example.org", Mailbox: "~peter/日本語/台北"},
+	},
+	{
+		s: "imap://michael@example.org:143/INBOX;UIDVALIDITY=385759045/;UID=20/;SECTION=1.2/;PARTIAL=0.1024",
+		url: &URL{
+			User:        "michael",
+			Host:        "example.org:143",
+			Mailbox:     "INBOX",
+			UidValidity: 385759045,
+			Uid:         20,
+			Section:     "1.2",
+			Partial:     &Partial{Offset: 0, Length: 1024},
+		},
+	},
+	{
+		s:   "imap://;AUTH=*@minbari.example.org/gray%20council?SUBJECT%20shadows",
+		url: &URL{Auth: "*", Host: "minbari.example.org", Mailbox: "gray council", Search: "SUBJECT shadows"},
+	},
+	{
+		s: "imap://joe;AUTH=GSSAPI@example.org/Drafts;UIDVALIDITY=1/;UID=42;EXPIRE=2006-04-16T10:00:00Z;URLAUTH=submit+fred:INTERNAL:91354a473744909de610943775f92038",
+		url: &URL{
+			User:        "joe",
+			Auth:        "GSSAPI",
+			Host:        "example.org",
+			Mailbox:     "Drafts",
+			UidValidity: 1,
+			Uid:         42,
+			Expire:      time.Date(2006, 4, 16, 10, 0, 0, 0, time.UTC),
+			Access:      "submit+fred",
+			Mechanism:   "INTERNAL",
+			Token:       "91354a473744909de610943775f92038",
+		},
+	},
+	{
+		s:   "imap://fred@example.org/INBOX/;UID=6;URLAUTH=anonymous",
+		url: &URL{User: "fred", Host: "example.org", Mailbox: "INBOX", Uid: 6, Access: "anonymous"},
+	},
+	{
+		s:   "/INBOX/;UID=6/;SECTION=HEADER",
+		url: &URL{Mailbox: "INBOX", Uid: 6, Section: "HEADER"},
+	},
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range urlTests {
+		u, err := Parse(test.s)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.s, err)
+			continue
+		}
+		if u.Expire.Equal(test.url.Expire) {
+			u.Expire = test.url.Expire
+		}
+		if !reflect.DeepEqual(u, test.url) {
+			t.Errorf("Parse(%q) = %+v, want %+v", test.s, u, test.url)
+		}
+	}
+}
+
+func TestParse_Lowercase(t *testing.T) {
+	u, err := Parse("IMAP://fred;auth=plain@example.org/INBOX/;uid=6;urlauth=anonymous:internal:abc")
+	if err != nil {
+		t.Fatal("Parse():", err)
+	}
+	want := &URL{
+		User:      "fred",
+		Auth:      "plain",
+		Host:      "example.org",
+		Mailbox:   "INBOX",
+		Uid:       6,
+		Access:    "anonymous",
+		Mechanism: "INTERNAL",
+		Token:     "abc",
+	}
+	if !reflect.DeepEqual(u, want) {
+		t.Errorf("Parse() = %+v, want %+v", u, want)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"INBOX/;UID=6",
+		"http://example.org/INBOX",
+		"imap://",
+		"imap://@example.org/",
+		"imap://example.org/INBOX;UID=6",
+		"imap://example.org/INBOX/;UIDVALIDITY=1",
+		"imap://example.org/INBOX/;UID=0",
+		"imap://example.org/INBOX/;UID=abc",
+		"imap://example.org/INBOX/;SECTION=1",
+		"imap://example.org/INBOX/;UID=6/;SECTION=1/;UID=7",
+		"imap://example.org/INBOX/;UID=6/",
+		"imap://example.org/INBOX/;UID=6/;FOO=bar",
+		"imap://example.org/INBOX/;UID=6?ALL",
+		"imap://example.org/INBOX/;UID=6;URLAUTH=anonymous:internal",
+		"imap://example.org/INBOX/;UID=6;EXPIRE=tomorrow",
+		"imap://example.org/%ZZ",
+	}
+	for _, s := range invalid {
+		if u, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) = %+v, want an error", s, u)
+		}
+	}
+}
+
+func TestURL_String(t *testing.T) {
+	for _, test := range urlTests {
+		if s := test.url.String(); s != test.s {
+			t.Errorf("String() = %q, want %q", s, test.s)
+		}
+	}
+}
+
+func TestURL_String_Escape(t *testing.T) {
+	u := &URL{User: "a@b", Host: "example.org", Mailbox: "100% ;?#/x"}
+	want := "imap://a%40b@example.org/100%25%20%3B%3F%23/x"
+	if s := u.String(); s != want {
+		t.Errorf("String() = %q, want %q", s, want)
+	}
+
+	parsed, err := Parse(want)
+	if err != nil {
+		t.Fatal("Parse():", err)
+	}
+	if !reflect.DeepEqual(parsed, u) {
+		t.Errorf("Parse(%q) = %+v, want %+v", want, parsed, u)
+	}
+}
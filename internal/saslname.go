@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"strings"
+)
+
+// EscapeSaslName escapes a name sent in a SASL message, see RFC 5802 section
+// 5.1. It's also used by the GS2 header of RFC 5801 section 4.
+func EscapeSaslName(s string) string {
+	s = strings.Replace(s, "=", "=3D", -1)
+	return strings.Replace(s, ",", "=2C", -1)
+}
+
+// UnescapeSaslName reverses EscapeSaslName. It returns false if the name
+// contains a comma or an equal sign which isn't part of an escape sequence.
+func UnescapeSaslName(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == ',':
+			return "", false
+		case s[i] != '=':
+			b.WriteByte(s[i])
+		case strings.HasPrefix(s[i:], "=2C"):
+			b.WriteByte(',')
+			i += 2
+		case strings.HasPrefix(s[i:], "=3D"):
+			b.WriteByte('=')
+			i += 2
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
@@ -0,0 +1,22 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestSaslName(t *testing.T) {
+	name := "user=name,with,commas"
+	escaped := EscapeSaslName(name)
+	if escaped != "user=3Dname=2Cwith=2Ccommas" {
+		t.Errorf("EscapeSaslName() = %q", escaped)
+	}
+	if got, ok := UnescapeSaslName(escaped); !ok || got != name {
+		t.Errorf("UnescapeSaslName() = %q, %v, want %q", got, ok, name)
+	}
+
+	for _, s := range []string{"a,b", "a=b", "a=2", "a=3d"} {
+		if _, ok := UnescapeSaslName(s); ok {
+			t.Errorf("UnescapeSaslName(%q) succeeded, want an error", s)
+		}
+	}
+}
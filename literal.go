@@ -1,7 +1,11 @@
 package imap
 
 import (
+	"bytes"
+	"errors"
 	"io"
+	"io/ioutil"
+	"os"
 )
 
 // A literal, as defined in RFC 3501 section 4.3.
@@ -11,3 +15,136 @@ type Literal interface {
 	// Len returns the number of bytes of the literal.
 	Len() int
 }
+
+// Literal8 is a literal which can contain any octet, including NUL, as defined
+// in RFC 3516 section 4.1. It is written as "~{n}" instead of "{n}". Messages
+// appended as a Literal8 don't need to be encoded, but the server must support
+// BINARY.
+type Literal8 struct {
+	Literal
+}
+
+// DefaultSpillThreshold is the default size above which a SpillLiteral is
+// stored in a temporary file.
+const DefaultSpillThreshold = 1024 * 1024
+
+var errSpillLiteralReading = errors.New("imap: cannot write to a literal being read")
+
+// SpillLiteral is a Literal which keeps its data in memory as long as it is
+// small, and stores it in a temporary file once it grows larger than its
+// threshold. This allows large literals to be buffered without using too much
+// memory, e.g. when receiving or sending big messages.
+//
+// The literal is filled with Write, then read with Read. It can be read again
+// from the beginning after Rewind. Close must be called when the literal isn't
+// needed anymore, to remove the temporary file.
+type SpillLiteral struct {
+	threshold int
+
+	buf  bytes.Buffer
+	file *os.File
+	size int
+
+	// The current reader, nil while the literal is being written.
+	r io.Reader
+}
+
+// NewSpillLiteral creates a new empty literal, stored in a temporary file once
+// larger than threshold bytes. If threshold is zero, DefaultSpillThreshold is
+// used.
+func NewSpillLiteral(threshold int) *SpillLiteral {
+	if threshold <= 0 {
+		threshold = DefaultSpillThreshold
+	}
+	return &SpillLiteral{threshold: threshold}
+}
+
+// Write appends data to the literal. It fails if reading has already started.
+func (l *SpillLiteral) Write(b []byte) (int, error) {
+	if l.r != nil {
+		return 0, errSpillLiteralReading
+	}
+
+	if l.file == nil && l.size+len(b) > l.threshold {
+		if err := l.spill(); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int
+	var err error
+	if l.file != nil {
+		n, err = l.file.Write(b)
+	} else {
+		n, err = l.buf.Write(b)
+	}
+	l.size += n
+	return n, err
+}
+
+// spill moves the in-memory data to a temporary file.
+func (l *SpillLiteral) spill() error {
+	f, err := ioutil.TempFile("", "go-imap-literal-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(l.buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	l.file = f
+	l.buf = bytes.Buffer{}
+	return nil
+}
+
+// Len returns the number of bytes written to the literal.
+func (l *SpillLiteral) Len() int {
+	return l.size
+}
+
+// Read reads data from the literal. No data can be written once reading has
+// started.
+func (l *SpillLiteral) Read(b []byte) (int, error) {
+	if l.r == nil {
+		if err := l.Rewind(); err != nil {
+			return 0, err
+		}
+	}
+	return l.r.Read(b)
+}
+
+// Rewind makes the next Read start again from the beginning of the literal.
+func (l *SpillLiteral) Rewind() error {
+	if l.file == nil {
+		l.r = bytes.NewReader(l.buf.Bytes())
+		return nil
+	}
+
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	l.r = io.LimitReader(l.file, int64(l.size))
+	return nil
+}
+
+// Close releases the resources used by the literal and removes its temporary
+// file, if any.
+func (l *SpillLiteral) Close() error {
+	l.buf = bytes.Buffer{}
+	l.r = bytes.NewReader(nil)
+
+	if l.file == nil {
+		return nil
+	}
+
+	f := l.file
+	l.file = nil
+	err := f.Close()
+	if rmErr := os.Remove(f.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
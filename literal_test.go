@@ -0,0 +1,79 @@
+package imap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSpillLiteral_memory(t *testing.T) {
+	l := NewSpillLiteral(16)
+	defer l.Close()
+
+	if _, err := l.Write([]byte("Hello World!")); err != nil {
+		t.Fatal("Cannot write to literal:", err)
+	}
+	if l.file != nil {
+		t.Error("Expected a small literal to be kept in memory")
+	}
+	if l.Len() != 12 {
+		t.Errorf("Invalid length: expected %v but got %v", 12, l.Len())
+	}
+
+	b, err := ioutil.ReadAll(l)
+	if err != nil {
+		t.Fatal("Cannot read literal:", err)
+	}
+	if string(b) != "Hello World!" {
+		t.Errorf("Invalid literal: expected %q but got %q", "Hello World!", string(b))
+	}
+
+	if _, err := l.Write([]byte("more")); err == nil {
+		t.Error("Expected an error when writing to a literal being read")
+	}
+}
+
+func TestSpillLiteral_file(t *testing.T) {
+	l := NewSpillLiteral(16)
+
+	want := bytes.Repeat([]byte("0123456789"), 10)
+	for i := 0; i < len(want); i += 7 {
+		end := i + 7
+		if end > len(want) {
+			end = len(want)
+		}
+		if _, err := l.Write(want[i:end]); err != nil {
+			t.Fatal("Cannot write to literal:", err)
+		}
+	}
+
+	if l.file == nil {
+		t.Fatal("Expected a large literal to be stored in a file")
+	}
+	name := l.file.Name()
+	if l.Len() != len(want) {
+		t.Errorf("Invalid length: expected %v but got %v", len(want), l.Len())
+	}
+
+	// The literal can be read several times
+	for i := 0; i < 2; i++ {
+		if err := l.Rewind(); err != nil {
+			t.Fatal("Cannot rewind literal:", err)
+		}
+		b, err := ioutil.ReadAll(l)
+		if err != nil {
+			t.Fatal("Cannot read literal:", err)
+		}
+		if !bytes.Equal(b, want) {
+			t.Errorf("Invalid literal #%v: expected %q but got %q", i, want, b)
+		}
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal("Cannot close literal:", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Expected temporary file %v to be removed, got %v", name, err)
+	}
+}
@@ -3,10 +3,9 @@ package imap
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
-
-	"github.com/emersion/go-imap/utf7"
 )
 
 // The primary mailbox, as defined in RFC 3501 section 5.1.
@@ -15,10 +14,21 @@ const InboxName = "INBOX"
 // Returns the canonical form of a mailbox name. Mailbox names can be
 // case-sensitive or case-insensitive depending on the backend implementation.
 // The special INBOX mailbox is case-insensitive.
+//
+// The first hierarchy level of children of INBOX, such as "inbox/Sub", is
+// case-insensitive too and is converted to upper case, while the rest of the
+// name is left untouched. The usual hierarchy delimiters "/" and "." are
+// recognized.
 func CanonicalMailboxName(name string) string {
-	if strings.ToUpper(name) == InboxName {
+	if len(name) < len(InboxName) || !strings.EqualFold(name[:len(InboxName)], InboxName) {
+		return name
+	}
+	if len(name) == len(InboxName) {
 		return InboxName
 	}
+	if delim := name[len(InboxName)]; delim == '/' || delim == '.' {
+		return InboxName + name[len(InboxName):]
+	}
 	return name
 }
 
@@ -38,6 +48,113 @@ const (
 	UnmarkedAttr = "\\Unmarked"
 )
 
+// Mailbox attributes defined in RFC 5258 section 3.
+const (
+	// The mailbox name doesn't refer to an existing mailbox.
+	NonExistentAttr = "\\NonExistent"
+	// The mailbox is subscribed to.
+	SubscribedAttr = "\\Subscribed"
+	// The mailbox is a remote mailbox.
+	RemoteAttr = "\\Remote"
+	// The mailbox has child mailboxes.
+	HasChildrenAttr = "\\HasChildren"
+	// The mailbox has no child mailboxes.
+	HasNoChildrenAttr = "\\HasNoChildren"
+)
+
+// Special-use mailbox attributes defined in RFC 6154 section 2.
+const (
+	// The mailbox presents all messages in the user's message store.
+	AllAttr = "\\All"
+	// The mailbox is used to archive messages.
+	ArchiveAttr = "\\Archive"
+	// The mailbox is used to hold draft messages.
+	DraftsAttr = "\\Drafts"
+	// The mailbox presents all messages marked as important.
+	FlaggedAttr = "\\Flagged"
+	// The mailbox is where messages deemed to be junk mail are held.
+	JunkAttr = "\\Junk"
+	// The mailbox is used to hold copies of messages that have been sent.
+	SentAttr = "\\Sent"
+	// The mailbox is used to hold messages that have been deleted or marked
+	// for deletion.
+	TrashAttr = "\\Trash"
+)
+
+// Mailbox attributes returned by the XLIST command, which predates RFC 6154
+// and is only supported by legacy servers.
+const (
+	// The mailbox is the INBOX, whose name may be localized.
+	XListInboxAttr = "\\Inbox"
+	// The mailbox presents all messages, see AllAttr.
+	XListAllMailAttr = "\\AllMail"
+	// The mailbox holds junk mail, see JunkAttr.
+	XListSpamAttr = "\\Spam"
+	// The mailbox presents all flagged messages, see FlaggedAttr.
+	XListStarredAttr = "\\Starred"
+	// The mailbox presents all messages marked as important.
+	XListImportantAttr = "\\Important"
+)
+
+var xlistAttrs = map[string]string{
+	XListAllMailAttr: AllAttr,
+	XListSpamAttr:    JunkAttr,
+	XListStarredAttr: FlaggedAttr,
+}
+
+// FromXListAttrs replaces the XLIST attributes which have a special-use
+// equivalent with the attributes defined in RFC 6154. Other attributes, such
+// as XListInboxAttr, are kept.
+func FromXListAttrs(attrs []string) []string {
+	converted := make([]string, len(attrs))
+	for i, attr := range attrs {
+		converted[i] = attr
+		for xattr, sattr := range xlistAttrs {
+			if strings.EqualFold(attr, xattr) {
+				converted[i] = sattr
+				break
+			}
+		}
+	}
+	return converted
+}
+
+// ToXListAttrs replaces the special-use attributes defined in RFC 6154 with
+// their XLIST equivalent. It is the inverse of FromXListAttrs.
+func ToXListAttrs(attrs []string) []string {
+	converted := make([]string, len(attrs))
+	for i, attr := range attrs {
+		converted[i] = attr
+		for xattr, sattr := range xlistAttrs {
+			if strings.EqualFold(attr, sattr) {
+				converted[i] = xattr
+				break
+			}
+		}
+	}
+	return converted
+}
+
+// LIST selection options, defined in RFC 5258 section 3.1.
+const (
+	// Only mailboxes which are subscribed to are returned. Implies the
+	// SUBSCRIBED return option.
+	ListSelectSubscribed = "SUBSCRIBED"
+	// Remote mailboxes are returned too.
+	ListSelectRemote = "REMOTE"
+	// Mailboxes which don't match but have matching children are returned
+	// too. Must be combined with another selection option.
+	ListSelectRecursiveMatch = "RECURSIVEMATCH"
+)
+
+// LIST return options, defined in RFC 5258 section 3.2.
+const (
+	// The \Subscribed attribute is returned for subscribed mailboxes.
+	ListReturnSubscribed = "SUBSCRIBED"
+	// The \HasChildren or \HasNoChildren attribute is returned.
+	ListReturnChildren = "CHILDREN"
+)
+
 // Basic mailbox info.
 type MailboxInfo struct {
 	// The mailbox attributes.
@@ -46,6 +163,12 @@ type MailboxInfo struct {
 	Delimiter string
 	// The mailbox name.
 	Name string
+	// The selection options matched by children of the mailbox, sent in the
+	// CHILDINFO extended data item of LIST-EXTENDED responses (RFC 5258) when
+	// the RECURSIVEMATCH selection option is used.
+	ChildInfo []string
+	// Other LIST-EXTENDED data items, keyed by upper-case tag.
+	Extended map[string]interface{}
 }
 
 // Parse mailbox info from fields.
@@ -59,27 +182,117 @@ func (info *MailboxInfo) Parse(fields []interface{}) error {
 		return err
 	}
 
-	var ok bool
-	if info.Delimiter, ok = fields[1].(string); !ok {
+	if info.Delimiter, err = ParseString(fields[1]); err != nil {
 		return errors.New("Mailbox delimiter must be a string")
 	}
 
 	if name, err := ParseString(fields[2]); err != nil {
 		return err
-	} else if name, err := utf7.Encoding.NewDecoder().String(name); err != nil {
+	} else if name, err := DecodeMailboxName(name); err != nil {
 		return err
 	} else {
 		info.Name = CanonicalMailboxName(name)
 	}
 
+	info.ChildInfo = nil
+	info.Extended = nil
+	if len(fields) > 3 {
+		// Extended data is optional, don't reject the whole response if it's
+		// malformed
+		info.parseExtended(fields[3])
+	}
+
+	return nil
+}
+
+const childInfoTag = "CHILDINFO"
+
+// parseExtended parses LIST-EXTENDED data items.
+func (info *MailboxInfo) parseExtended(f interface{}) error {
+	items, ok := f.([]interface{})
+	if !ok || len(items)%2 != 0 {
+		return errors.New("Mailbox extended data must be a list of tags and values")
+	}
+
+	for i := 0; i < len(items); i += 2 {
+		tag, err := ParseString(items[i])
+		if err != nil {
+			return errors.New("Mailbox extended data tag must be a string")
+		}
+		tag = strings.ToUpper(tag)
+
+		if tag == childInfoTag {
+			opts, err := ParseStringList(items[i+1])
+			if err != nil {
+				return err
+			}
+			for _, opt := range opts {
+				info.ChildInfo = append(info.ChildInfo, strings.ToUpper(opt))
+			}
+			continue
+		}
+
+		if info.Extended == nil {
+			info.Extended = make(map[string]interface{})
+		}
+		info.Extended[tag] = items[i+1]
+	}
 	return nil
 }
 
 // Format mailbox info to fields.
 func (info *MailboxInfo) Format() []interface{} {
-	name, _ := utf7.Encoding.NewEncoder().String(info.Name)
+	name := FormatMailboxName(info.Name)
 	// Thunderbird doesn't understand delimiters if not quoted
-	return []interface{}{FormatStringList(info.Attributes), Quoted(info.Delimiter), name}
+	fields := []interface{}{FormatStringList(info.Attributes), Quoted(info.Delimiter), name}
+
+	var extended []interface{}
+	if len(info.ChildInfo) > 0 {
+		opts := make([]interface{}, len(info.ChildInfo))
+		for i, opt := range info.ChildInfo {
+			opts[i] = Quoted(opt)
+		}
+		extended = append(extended, Quoted(childInfoTag), opts)
+	}
+
+	tags := make([]string, 0, len(info.Extended))
+	for tag := range info.Extended {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		extended = append(extended, tag, info.Extended[tag])
+	}
+
+	if len(extended) > 0 {
+		fields = append(fields, extended)
+	}
+	return fields
+}
+
+// HasAttr checks if the mailbox has the attribute attr. Attributes are
+// case-insensitive.
+func (info *MailboxInfo) HasAttr(attr string) bool {
+	for _, a := range info.Attributes {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasChildren checks if the mailbox has child mailboxes, with the attributes
+// defined in RFC 3348. ok is false if the server didn't tell, e.g. because it
+// doesn't support the CHILDREN extension.
+func (info *MailboxInfo) HasChildren() (hasChildren, ok bool) {
+	switch {
+	case info.HasAttr(HasChildrenAttr):
+		return true, true
+	case info.HasAttr(HasNoChildrenAttr), info.HasAttr(NoInferiorsAttr):
+		return false, true
+	default:
+		return false, false
+	}
 }
 
 // TODO: optimize this
@@ -169,6 +382,33 @@ type MailboxStatus struct {
 	// Together with a UID, it is a unique identifier for a message.
 	// Must be greater than or equal to 1.
 	UidValidity uint32
+	// The maximum size in bytes of a message that can be appended to this
+	// mailbox, see RFC 7889. Zero means that there is no limit.
+	AppendLimit uint64
+	// The highest mod-sequence of all messages in this mailbox, see RFC 7162.
+	// Zero means that the mailbox doesn't support mod-sequences.
+	HighestModSeq uint64
+	// The unique identifier of this mailbox, see RFC 8474. It doesn't change
+	// when the mailbox is renamed.
+	MailboxId string
+	// The total size in bytes of the messages in this mailbox, see RFC 8438.
+	Size uint64
+	// The number of messages with the \Deleted flag, see RFC 9051.
+	Deleted uint32
+}
+
+// UidValidityError is returned when the UIDVALIDITY of a mailbox has changed.
+// UIDs obtained with the old value must be discarded, see RFC 3501 section
+// 2.3.1.1.
+type UidValidityError struct {
+	// The expected UIDVALIDITY.
+	Old uint32
+	// The UIDVALIDITY sent by the server.
+	New uint32
+}
+
+func (err *UidValidityError) Error() string {
+	return fmt.Sprintf("imap: UIDVALIDITY changed from %v to %v", err.Old, err.New)
 }
 
 // Create a new mailbox status that will contain the specified items.
@@ -185,13 +425,24 @@ func NewMailboxStatus(name string, items []StatusItem) *MailboxStatus {
 	return status
 }
 
+// CanCreateKeywords checks if new keywords can be permanently stored in the
+// mailbox, i.e. if PermanentFlags contains TryCreateFlag.
+func (status *MailboxStatus) CanCreateKeywords() bool {
+	for _, f := range status.PermanentFlags {
+		if f == TryCreateFlag {
+			return true
+		}
+	}
+	return false
+}
+
 func (status *MailboxStatus) Parse(fields []interface{}) error {
 	status.Items = make(map[StatusItem]interface{})
 
 	var k StatusItem
 	for i, f := range fields {
 		if i%2 == 0 {
-			if kstr, ok := f.(string); !ok {
+			if kstr, err := ParseString(f); err != nil {
 				return fmt.Errorf("cannot parse mailbox status: key is not a string, but a %T", f)
 			} else {
 				k = StatusItem(strings.ToUpper(kstr))
@@ -211,6 +462,19 @@ func (status *MailboxStatus) Parse(fields []interface{}) error {
 				status.UidNext, err = ParseNumber(f)
 			case StatusUidValidity:
 				status.UidValidity, err = ParseNumber(f)
+			case StatusAppendLimit:
+				// NIL means that there is no limit
+				if f != nil {
+					status.AppendLimit, err = ParseNumber64(f)
+				}
+			case StatusHighestModSeq:
+				status.HighestModSeq, err = ParseNumber64(f)
+			case StatusMailboxId:
+				status.MailboxId, err = ParseObjectId(f)
+			case StatusSize:
+				status.Size, err = ParseNumber64(f)
+			case StatusDeleted:
+				status.Deleted, err = ParseNumber(f)
 			default:
 				status.Items[k] = f
 			}
@@ -238,6 +502,19 @@ func (status *MailboxStatus) Format() []interface{} {
 			v = status.UidNext
 		case StatusUidValidity:
 			v = status.UidValidity
+		case StatusAppendLimit:
+			v = nil
+			if status.AppendLimit > 0 {
+				v = status.AppendLimit
+			}
+		case StatusHighestModSeq:
+			v = status.HighestModSeq
+		case StatusMailboxId:
+			v = FormatObjectId(status.MailboxId)
+		case StatusSize:
+			v = status.Size
+		case StatusDeleted:
+			v = status.Deleted
 		}
 
 		fields = append(fields, string(k), v)
@@ -17,6 +17,24 @@ func TestCanonicalMailboxName(t *testing.T) {
 	if got := imap.CanonicalMailboxName("Drafts"); got != "Drafts" {
 		t.Errorf("Invalid canonical mailbox name: expected %q but got %q", "Drafts", got)
 	}
+
+	tests := []struct {
+		name, canonical string
+	}{
+		{"inbox", "INBOX"},
+		{"inbox/Sub", "INBOX/Sub"},
+		{"Inbox.sub.Deeper", "INBOX.sub.Deeper"},
+		{"INBOX/inbox", "INBOX/inbox"},
+		{"Inboxes", "Inboxes"},
+		{"Archive/inbox", "Archive/inbox"},
+		{"inb", "inb"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := imap.CanonicalMailboxName(test.name); got != test.canonical {
+			t.Errorf("Invalid canonical mailbox name for %q: expected %q but got %q", test.name, test.canonical, got)
+		}
+	}
 }
 
 var mailboxInfoTests = []struct {
@@ -35,6 +53,20 @@ var mailboxInfoTests = []struct {
 			Name:       "INBOX",
 		},
 	},
+	{
+		fields: []interface{}{
+			[]interface{}{"\\HasChildren"},
+			"/",
+			"Archive",
+			[]interface{}{"CHILDINFO", []interface{}{"SUBSCRIBED"}},
+		},
+		info: &imap.MailboxInfo{
+			Attributes: []string{"\\HasChildren"},
+			Delimiter:  "/",
+			Name:       "Archive",
+			ChildInfo:  []string{"SUBSCRIBED"},
+		},
+	},
 }
 
 func TestMailboxInfo_Parse(t *testing.T) {
@@ -53,6 +85,9 @@ func TestMailboxInfo_Parse(t *testing.T) {
 		if info.Name != test.info.Name {
 			t.Fatal("Invalid name:", info.Name)
 		}
+		if !reflect.DeepEqual(info.ChildInfo, test.info.ChildInfo) {
+			t.Fatal("Invalid child info:", info.ChildInfo)
+		}
 	}
 }
 
@@ -110,6 +145,40 @@ func TestMailboxInfo_Match(t *testing.T) {
 	}
 }
 
+func TestMailboxInfo_HasChildren(t *testing.T) {
+	tests := []struct {
+		attrs       []string
+		hasChildren bool
+		ok          bool
+	}{
+		{nil, false, false},
+		{[]string{imap.MarkedAttr}, false, false},
+		{[]string{"\\haschildren"}, true, true},
+		{[]string{imap.MarkedAttr, imap.HasNoChildrenAttr}, false, true},
+		{[]string{imap.NoInferiorsAttr}, false, true},
+	}
+	for _, test := range tests {
+		info := &imap.MailboxInfo{Attributes: test.attrs}
+		hasChildren, ok := info.HasChildren()
+		if hasChildren != test.hasChildren || ok != test.ok {
+			t.Errorf("HasChildren() with attributes %v = %v, %v, want %v, %v", test.attrs, hasChildren, ok, test.hasChildren, test.ok)
+		}
+	}
+}
+
+func TestFromXListAttrs(t *testing.T) {
+	attrs := []string{"\\HasNoChildren", "\\AllMail", "\\spam", "\\Starred", "\\Sent", "\\Inbox"}
+	want := []string{imap.HasNoChildrenAttr, imap.AllAttr, imap.JunkAttr, imap.FlaggedAttr, imap.SentAttr, imap.XListInboxAttr}
+	if got := imap.FromXListAttrs(attrs); !reflect.DeepEqual(got, want) {
+		t.Errorf("FromXListAttrs(%v) = %v, want %v", attrs, got, want)
+	}
+
+	want = []string{"\\HasNoChildren", imap.XListAllMailAttr, imap.XListSpamAttr, imap.XListStarredAttr, "\\Sent", "\\Inbox"}
+	if got := imap.ToXListAttrs(imap.FromXListAttrs(attrs)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ToXListAttrs() = %v, want %v", got, want)
+	}
+}
+
 func TestNewMailboxStatus(t *testing.T) {
 	status := imap.NewMailboxStatus("INBOX", []imap.StatusItem{imap.StatusMessages, imap.StatusUnseen})
 
@@ -150,6 +219,72 @@ var mailboxStatusTests = [...]struct {
 			UidValidity: 4242,
 		},
 	},
+	{
+		fields: []interface{}{
+			"MESSAGES", uint32(42),
+			"APPENDLIMIT", uint64(5368709120),
+		},
+		status: &imap.MailboxStatus{
+			Items: map[imap.StatusItem]interface{}{
+				imap.StatusMessages:    nil,
+				imap.StatusAppendLimit: nil,
+			},
+			Messages:    42,
+			AppendLimit: 5368709120,
+		},
+	},
+	{
+		fields: []interface{}{
+			"MESSAGES", uint32(42),
+			"HIGHESTMODSEQ", uint64(7011231777),
+		},
+		status: &imap.MailboxStatus{
+			Items: map[imap.StatusItem]interface{}{
+				imap.StatusMessages:      nil,
+				imap.StatusHighestModSeq: nil,
+			},
+			Messages:      42,
+			HighestModSeq: 7011231777,
+		},
+	},
+	{
+		fields: []interface{}{
+			"MESSAGES", uint32(42),
+			"MAILBOXID", []interface{}{"F2212ea87-6097-4256-9d51-71338625"},
+		},
+		status: &imap.MailboxStatus{
+			Items: map[imap.StatusItem]interface{}{
+				imap.StatusMessages:  nil,
+				imap.StatusMailboxId: nil,
+			},
+			Messages:  42,
+			MailboxId: "F2212ea87-6097-4256-9d51-71338625",
+		},
+	},
+	{
+		fields: []interface{}{
+			"SIZE", uint64(44421),
+			"DELETED", uint32(3),
+		},
+		status: &imap.MailboxStatus{
+			Items: map[imap.StatusItem]interface{}{
+				imap.StatusSize:    nil,
+				imap.StatusDeleted: nil,
+			},
+			Size:    44421,
+			Deleted: 3,
+		},
+	},
+	{
+		fields: []interface{}{
+			"APPENDLIMIT", nil,
+		},
+		status: &imap.MailboxStatus{
+			Items: map[imap.StatusItem]interface{}{
+				imap.StatusAppendLimit: nil,
+			},
+		},
+	},
 }
 
 func TestMailboxStatus_Parse(t *testing.T) {
@@ -178,3 +313,15 @@ func TestMailboxStatus_Format(t *testing.T) {
 		}
 	}
 }
+
+func TestMailboxStatus_CanCreateKeywords(t *testing.T) {
+	status := &imap.MailboxStatus{PermanentFlags: []string{imap.SeenFlag, "$Forwarded"}}
+	if status.CanCreateKeywords() {
+		t.Error("Expected keywords not to be creatable without \\*")
+	}
+
+	status.PermanentFlags = append(status.PermanentFlags, imap.TryCreateFlag)
+	if !status.CanCreateKeywords() {
+		t.Error("Expected keywords to be creatable with \\*")
+	}
+}
@@ -1,11 +1,17 @@
 package imap
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"mime"
+	"net/textproto"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -21,6 +27,10 @@ const (
 	RecentFlag   = "\\Recent"
 )
 
+// TryCreateFlag is a special flag in MailboxStatus.PermanentFlags indicating
+// that new keywords can be created by storing them, see RFC 3501 section 7.1.
+const TryCreateFlag = "\\*"
+
 var flags = []string{
 	SeenFlag,
 	AnsweredFlag,
@@ -123,7 +133,95 @@ func parseHeaderParamList(fields []interface{}) (map[string]string, error) {
 	for k, v := range params {
 		params[k], _ = decodeHeader(v)
 	}
-	return params, nil
+	return decodeExtendedParams(params), nil
+}
+
+// An RFC 2231 parameter section, e.g. filename*1*=...
+type paramSection struct {
+	index    int
+	extended bool
+	value    string
+}
+
+// decodeExtendedParams decodes RFC 2231 parameters: continuations such as
+// filename*0 and filename*1 are reassembled, and values with a charset such as
+// filename*=utf-8''%C3%A9 are decoded. Decoded values replace plain parameters
+// with the same name.
+func decodeExtendedParams(params map[string]string) map[string]string {
+	sections := make(map[string][]paramSection)
+	for k, v := range params {
+		i := strings.IndexByte(k, '*')
+		if i < 0 {
+			continue
+		}
+
+		name, rest := k[:i], k[i+1:]
+		section := paramSection{value: v}
+		if strings.HasSuffix(rest, "*") {
+			section.extended = true
+			rest = strings.TrimSuffix(rest, "*")
+		} else if rest == "" {
+			// name* is an extended value without continuations
+			section.extended = true
+		}
+		if rest != "" {
+			n, err := strconv.Atoi(rest)
+			if err != nil {
+				continue
+			}
+			section.index = n
+		}
+
+		sections[name] = append(sections[name], section)
+		delete(params, k)
+	}
+
+	for name, parts := range sections {
+		sort.Slice(parts, func(i, j int) bool { return parts[i].index < parts[j].index })
+
+		var charset string
+		var b []byte
+		for i, part := range parts {
+			value := part.value
+			if part.extended {
+				if i == 0 {
+					// charset'language'value
+					if fields := strings.SplitN(value, "'", 3); len(fields) == 3 {
+						charset, value = fields[0], fields[2]
+					}
+				}
+				if unescaped, err := url.PathUnescape(value); err == nil {
+					value = unescaped
+				}
+			}
+			b = append(b, value...)
+		}
+
+		value, err := decodeCharset(charset, b)
+		if err != nil {
+			value = string(b)
+		}
+		params[name] = value
+	}
+
+	return params
+}
+
+func decodeCharset(charset string, b []byte) (string, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "us-ascii":
+		return string(b), nil
+	}
+
+	if CharsetReader == nil {
+		return "", fmt.Errorf("imap: unhandled charset %q", charset)
+	}
+	r, err := CharsetReader(charset, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	dec, err := ioutil.ReadAll(r)
+	return string(dec), err
 }
 
 func formatHeaderParamList(params map[string]string) []interface{} {
@@ -157,6 +255,23 @@ type Message struct {
 	Uid uint32
 	// The message body sections.
 	Body map[*BodySectionName]Literal
+	// The message mod-sequence, see RFC 7162.
+	ModSeq uint64
+	// The unique identifier of the message, see RFC 8474. Copies of a message
+	// may share the same identifier.
+	EmailId string
+	// The unique identifier of the thread the message belongs to, see RFC
+	// 8474. It is empty if the server doesn't support threads.
+	ThreadId string
+	// A short plain-text preview of the message, see RFC 8970. It is empty if
+	// the message has no text to preview.
+	Preview string
+	// The date the message was saved to its current mailbox, see RFC 8514.
+	// It is zero if the mailbox doesn't keep save dates.
+	SaveDate time.Time
+	// The message annotations, mapping entry names to attribute values, see
+	// RFC 5257.
+	Annotations map[string]map[string]string
 
 	// The order in which items were requested. This order must be preserved
 	// because some bad IMAP clients (looking at you, Outlook!) refuse responses
@@ -180,6 +295,27 @@ func NewMessage(seqNum uint32, items []FetchItem) *Message {
 	return msg
 }
 
+// Parse a message size. Sizes that don't fit in a uint32 are clamped to the
+// maximum value instead of overflowing.
+func parseSize(f interface{}) uint32 {
+	s, ok := f.(string)
+	if !ok {
+		n, _ := ParseNumber(f)
+		return n
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		return math.MaxUint32
+	} else if err != nil {
+		return 0
+	}
+	if n > math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(n)
+}
+
 // Parse a message from fields.
 func (m *Message) Parse(fields []interface{}) error {
 	m.Items = make(map[FetchItem]interface{})
@@ -232,11 +368,46 @@ func (m *Message) Parse(fields []interface{}) error {
 				}
 			case FetchInternalDate:
 				date, _ := f.(string)
-				m.InternalDate, _ = time.Parse(DateTimeLayout, date)
+				m.InternalDate, _ = parseDateTime(date)
 			case FetchRFC822Size:
-				m.Size, _ = ParseNumber(f)
+				m.Size = parseSize(f)
 			case FetchUid:
 				m.Uid, _ = ParseNumber(f)
+			case FetchModSeq:
+				// The mod-sequence is enclosed in parentheses
+				if l, ok := f.([]interface{}); ok && len(l) > 0 {
+					m.ModSeq, _ = ParseNumber64(l[0])
+				}
+			case FetchEmailId:
+				m.EmailId, _ = ParseObjectId(f)
+			case FetchThreadId:
+				m.ThreadId, _ = ParseObjectId(f)
+			case FetchPreview:
+				// NIL means that the preview isn't available
+				m.Preview, _ = ParseString(f)
+			case FetchSaveDate:
+				date, _ := f.(string)
+				m.SaveDate, _ = parseDateTime(date)
+			case FetchAnnotation:
+				l, ok := f.([]interface{})
+				if !ok {
+					return fmt.Errorf("cannot parse message: ANNOTATION is not a list, but a %T", f)
+				}
+				values, err := ParseAnnotationValues(l)
+				if err != nil {
+					return err
+				}
+
+				// NIL means that the attribute doesn't exist
+				m.Annotations = make(map[string]map[string]string, len(values))
+				for entry, attribs := range values {
+					m.Annotations[entry] = make(map[string]string, len(attribs))
+					for attrib, value := range attribs {
+						if value != nil {
+							m.Annotations[entry][attrib] = *value
+						}
+					}
+				}
 			default:
 				// Likely to be a section of the body
 				// First check that the section name is correct
@@ -253,6 +424,79 @@ func (m *Message) Parse(fields []interface{}) error {
 	return nil
 }
 
+// Merge copies the items of other into m. Items present in both messages are
+// replaced by the ones in other. This is useful when a server splits the data
+// of a single message across multiple FETCH responses.
+func (m *Message) Merge(other *Message) {
+	if m.Items == nil {
+		m.Items = make(map[FetchItem]interface{})
+	}
+	if m.Body == nil {
+		m.Body = make(map[*BodySectionName]Literal)
+	}
+
+	keys := append([]FetchItem(nil), other.itemsOrder...)
+	for k := range other.Items {
+		found := false
+		for _, kk := range keys {
+			if k == kk {
+				found = true
+				break
+			}
+		}
+		if !found {
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range keys {
+		v, ok := other.Items[k]
+		if !ok {
+			continue
+		}
+		if _, ok := m.Items[k]; !ok {
+			m.itemsOrder = append(m.itemsOrder, k)
+		}
+		m.Items[k] = v
+
+		switch k {
+		case FetchBody, FetchBodyStructure:
+			m.BodyStructure = other.BodyStructure
+		case FetchEnvelope:
+			m.Envelope = other.Envelope
+		case FetchFlags:
+			m.Flags = other.Flags
+		case FetchInternalDate:
+			m.InternalDate = other.InternalDate
+		case FetchRFC822Size:
+			m.Size = other.Size
+		case FetchUid:
+			m.Uid = other.Uid
+		case FetchModSeq:
+			m.ModSeq = other.ModSeq
+		case FetchEmailId:
+			m.EmailId = other.EmailId
+		case FetchThreadId:
+			m.ThreadId = other.ThreadId
+		case FetchPreview:
+			m.Preview = other.Preview
+		case FetchSaveDate:
+			m.SaveDate = other.SaveDate
+		case FetchAnnotation:
+			m.Annotations = other.Annotations
+		}
+	}
+
+	for section, literal := range other.Body {
+		for s := range m.Body {
+			if s.FetchItem() == section.FetchItem() {
+				delete(m.Body, s)
+			}
+		}
+		m.Body[section] = literal
+	}
+}
+
 func (m *Message) formatItem(k FetchItem) []interface{} {
 	v := m.Items[k]
 	var kk interface{} = string(k)
@@ -272,12 +516,35 @@ func (m *Message) formatItem(k FetchItem) []interface{} {
 		v = m.Size
 	case FetchUid:
 		v = m.Uid
+	case FetchModSeq:
+		v = []interface{}{m.ModSeq}
+	case FetchEmailId:
+		v = FormatObjectId(m.EmailId)
+	case FetchThreadId:
+		v = FormatObjectId(m.ThreadId)
+	case FetchPreview:
+		v = formatIDString(m.Preview)
+	case FetchSaveDate:
+		v = m.SaveDate
+	case FetchAnnotation:
+		v = FormatAnnotations(m.Annotations)
 	default:
+		if _, _, err := ParseAnnotationItem(k); err == nil {
+			// Requested annotations are returned in an ANNOTATION item
+			return []interface{}{string(FetchAnnotation), FormatAnnotations(m.Annotations)}
+		}
+
+		// Extension items may contain brackets, e.g. BINARY.SIZE[1]
+		kk = RawString(k)
 		for section, literal := range m.Body {
 			if section.value == k {
 				// This can contain spaces, so we can't pass it as a string directly
 				kk = section.resp()
 				v = literal
+				if _, ok := literal.(Literal8); section.Binary && literal != nil && !ok {
+					// Decoded data may contain NUL octets
+					v = Literal8{literal}
+				}
 				break
 			}
 		}
@@ -325,6 +592,10 @@ type BodySectionName struct {
 
 	// If set to true, do not implicitly set the \Seen flag.
 	Peek bool
+	// If set to true, the section is fetched with BINARY instead of BODY: the
+	// server decodes its content transfer encoding, see RFC 3516. Only the part
+	// path can be specified.
+	Binary bool
 	// The substring of the section requested. The first value is the position of
 	// the first desired octet and the second value is the maximum number of
 	// octets desired.
@@ -360,9 +631,16 @@ func (section *BodySectionName) parse(s string) (err error) {
 	part := s[partStart+1 : partEnd]
 	partial := s[partEnd+1:]
 
-	if name == "BODY.PEEK" {
+	switch name {
+	case "BODY":
+	case "BODY.PEEK":
 		section.Peek = true
-	} else if name != "BODY" {
+	case "BINARY":
+		section.Binary = true
+	case "BINARY.PEEK":
+		section.Binary = true
+		section.Peek = true
+	default:
 		return errors.New("Invalid body section name")
 	}
 
@@ -408,6 +686,9 @@ func (section *BodySectionName) FetchItem() FetchItem {
 	}
 
 	s := "BODY"
+	if section.Binary {
+		s = "BINARY"
+	}
 	if section.Peek {
 		s += ".PEEK"
 	}
@@ -475,6 +756,46 @@ func ParseBodySectionName(s FetchItem) (*BodySectionName, error) {
 	return section, err
 }
 
+// BinarySizeItem returns the item fetching the size of a body part once its
+// content transfer encoding is decoded, as defined in RFC 3516 section 4.2.
+func BinarySizeItem(path []int) FetchItem {
+	part := BodyPartName{Path: path}
+	return FetchItem("BINARY.SIZE[" + part.string() + "]")
+}
+
+// ParseBinarySizeItem parses a BINARY.SIZE fetch item and returns the body
+// part path.
+func ParseBinarySizeItem(item FetchItem) ([]int, error) {
+	s := string(item)
+	if !strings.HasPrefix(s, "BINARY.SIZE[") || !strings.HasSuffix(s, "]") {
+		return nil, errors.New("Invalid BINARY.SIZE item")
+	}
+
+	var part BodyPartName
+	if path := s[len("BINARY.SIZE[") : len(s)-1]; path != "" {
+		if err := part.parse([]interface{}{path}); err != nil {
+			return nil, err
+		}
+	}
+	if part.Specifier != EntireSpecifier {
+		return nil, errors.New("Invalid BINARY.SIZE item: only a part path is allowed")
+	}
+	return part.Path, nil
+}
+
+// BinarySize returns the decoded size of the body part with the provided path,
+// fetched with BinarySizeItem.
+func (m *Message) BinarySize(path []int) (uint32, bool) {
+	v, ok := m.Items[BinarySizeItem(path)]
+	if !ok || v == nil {
+		return 0, false
+	}
+	if n, ok := v.(uint32); ok {
+		return n, true
+	}
+	return parseSize(v), true
+}
+
 // A body part name.
 type BodyPartName struct {
 	// The specifier of the requested part.
@@ -624,6 +945,64 @@ func (addr *Address) Format() []interface{} {
 	return fields
 }
 
+// IsGroupStart returns true if the address marks the start of an RFC 5322
+// group, in which case MailboxName is the group name. The following addresses
+// belong to the group until the end marker. See RFC 3501 section 7.4.2.
+func (addr *Address) IsGroupStart() bool {
+	return addr.HostName == "" && addr.MailboxName != ""
+}
+
+// IsGroupEnd returns true if the address marks the end of an RFC 5322 group.
+func (addr *Address) IsGroupEnd() bool {
+	return addr.HostName == "" && addr.MailboxName == ""
+}
+
+// An AddressGroup is a list of addresses. If Name is not empty, it is an RFC
+// 5322 group, e.g. "undisclosed-recipients:;".
+type AddressGroup struct {
+	// The group name, empty for addresses which don't belong to a group.
+	Name string
+	// The addresses in the group. An RFC 5322 group can be empty.
+	Addresses []*Address
+}
+
+// GroupAddressList splits an address list into groups, using the group start
+// and end markers. Consecutive addresses outside of any group are gathered in
+// an AddressGroup with an empty name.
+//
+// Groups cannot be nested: a group start marker inside a group closes the
+// current group. An end marker outside of a group is ignored, and a group
+// without an end marker ends with the list.
+func GroupAddressList(addrs []*Address) []*AddressGroup {
+	var groups []*AddressGroup
+	var cur *AddressGroup
+	inGroup := false
+	for _, addr := range addrs {
+		if addr == nil {
+			continue
+		}
+
+		switch {
+		case addr.IsGroupStart():
+			cur = &AddressGroup{Name: addr.MailboxName, Addresses: []*Address{}}
+			groups = append(groups, cur)
+			inGroup = true
+		case addr.IsGroupEnd():
+			if inGroup {
+				cur = nil
+				inGroup = false
+			}
+		default:
+			if cur == nil {
+				cur = &AddressGroup{}
+				groups = append(groups, cur)
+			}
+			cur.Addresses = append(cur.Addresses, addr)
+		}
+	}
+	return groups
+}
+
 // Parse an address list from fields.
 func ParseAddressList(fields []interface{}) (addrs []*Address) {
 	addrs = make([]*Address, len(fields))
@@ -682,7 +1061,7 @@ func (e *Envelope) Parse(fields []interface{}) error {
 		return errors.New("ENVELOPE doesn't contain 10 fields")
 	}
 
-	if date, ok := fields[0].(string); ok {
+	if date, err := ParseString(fields[0]); err == nil {
 		e.Date, _ = parseMessageDateTime(date)
 	}
 	if subject, err := ParseString(fields[1]); err == nil {
@@ -706,10 +1085,10 @@ func (e *Envelope) Parse(fields []interface{}) error {
 	if bcc, ok := fields[7].([]interface{}); ok {
 		e.Bcc = ParseAddressList(bcc)
 	}
-	if inReplyTo, ok := fields[8].(string); ok {
+	if inReplyTo, err := ParseString(fields[8]); err == nil {
 		e.InReplyTo = inReplyTo
 	}
-	if msgId, ok := fields[9].(string); ok {
+	if msgId, err := ParseString(fields[9]); err == nil {
 		e.MessageId = msgId
 	}
 
@@ -782,6 +1161,30 @@ type BodyStructure struct {
 	MD5 string
 }
 
+// Filename returns the file name of the body part, from the Content-Disposition
+// filename parameter or else from the Content-Type name parameter. It returns
+// an empty string if the part has no file name.
+func (bs *BodyStructure) Filename() string {
+	if filename := lookupParam(bs.DispositionParams, "filename"); filename != "" {
+		return filename
+	}
+	return lookupParam(bs.Params, "name")
+}
+
+// lookupParam returns the value of a parameter. Parameter names are
+// case-insensitive.
+func lookupParam(params map[string]string, name string) string {
+	if v, ok := params[name]; ok {
+		return v
+	}
+	for k, v := range params {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
 func (bs *BodyStructure) Parse(fields []interface{}) error {
 	if len(fields) == 0 {
 		return nil
@@ -825,31 +1228,7 @@ func (bs *BodyStructure) Parse(fields []interface{}) error {
 			end++
 		}
 		if len(fields) > end {
-			if disp, ok := fields[end].([]interface{}); ok && len(disp) >= 2 {
-				if s, ok := disp[0].(string); ok {
-					bs.Disposition, _ = decodeHeader(s)
-				}
-				if params, ok := disp[1].([]interface{}); ok {
-					bs.DispositionParams, _ = parseHeaderParamList(params)
-				}
-			}
-			end++
-		}
-		if len(fields) > end {
-			switch langs := fields[end].(type) {
-			case string:
-				bs.Language = []string{langs}
-			case []interface{}:
-				bs.Language, _ = ParseStringList(langs)
-			default:
-				bs.Language = nil
-			}
-			end++
-		}
-		if len(fields) > end {
-			location, _ := fields[end].([]interface{})
-			bs.Location, _ = ParseStringList(location)
-			end++
+			bs.parseExtension(fields[end:])
 		}
 	case string: // A non-multipart body part
 		if len(fields) < 7 {
@@ -903,39 +1282,59 @@ func (bs *BodyStructure) Parse(fields []interface{}) error {
 		if len(fields) > end {
 			bs.Extended = true // Contains extension data
 
-			bs.MD5, _ = fields[end].(string)
+			bs.MD5, _ = ParseString(fields[end])
 			end++
 		}
 		if len(fields) > end {
-			if disp, ok := fields[end].([]interface{}); ok && len(disp) >= 2 {
-				if s, ok := disp[0].(string); ok {
-					bs.Disposition, _ = decodeHeader(s)
-				}
-				if params, ok := disp[1].([]interface{}); ok {
-					bs.DispositionParams, _ = parseHeaderParamList(params)
-				}
+			bs.parseExtension(fields[end:])
+		}
+	}
+
+	return nil
+}
+
+// parseExtension parses the extension data common to multipart and
+// non-multipart body parts: disposition, language and location. Any of them
+// can be missing or NIL.
+func (bs *BodyStructure) parseExtension(fields []interface{}) {
+	if len(fields) > 0 {
+		if disp, ok := fields[0].([]interface{}); ok && len(disp) >= 2 {
+			if s, err := ParseString(disp[0]); err == nil {
+				bs.Disposition, _ = decodeHeader(s)
+			}
+			if params, ok := disp[1].([]interface{}); ok {
+				bs.DispositionParams, _ = parseHeaderParamList(params)
 			}
-			end++
 		}
-		if len(fields) > end {
-			switch langs := fields[end].(type) {
-			case string:
-				bs.Language = []string{langs}
-			case []interface{}:
-				bs.Language, _ = ParseStringList(langs)
-			default:
-				bs.Language = nil
+	}
+	if len(fields) > 1 {
+		switch langs := fields[1].(type) {
+		case []interface{}:
+			bs.Language, _ = ParseStringList(langs)
+		default:
+			if lang, err := ParseString(langs); err == nil {
+				bs.Language = []string{lang}
 			}
-			end++
 		}
-		if len(fields) > end {
-			location, _ := fields[end].([]interface{})
+	}
+	if len(fields) > 2 {
+		// The location is a string, but some servers send a list
+		switch location := fields[2].(type) {
+		case []interface{}:
 			bs.Location, _ = ParseStringList(location)
-			end++
+		default:
+			if loc, err := ParseString(location); err == nil {
+				bs.Location = []string{loc}
+			}
 		}
 	}
+}
 
-	return nil
+func (bs *BodyStructure) formatLocation() interface{} {
+	if len(bs.Location) == 1 {
+		return bs.Location[0]
+	}
+	return FormatStringList(bs.Location)
 }
 
 func (bs *BodyStructure) Format() (fields []interface{}) {
@@ -962,7 +1361,7 @@ func (bs *BodyStructure) Format() (fields []interface{}) {
 				extended[2] = FormatStringList(bs.Language)
 			}
 			if bs.Location != nil {
-				extended[3] = FormatStringList(bs.Location)
+				extended[3] = bs.formatLocation()
 			}
 
 			fields = append(fields, extended...)
@@ -1020,7 +1419,7 @@ func (bs *BodyStructure) Format() (fields []interface{}) {
 				extended[2] = FormatStringList(bs.Language)
 			}
 			if bs.Location != nil {
-				extended[3] = FormatStringList(bs.Location)
+				extended[3] = bs.formatLocation()
 			}
 
 			fields = append(fields, extended...)
@@ -1029,3 +1428,36 @@ func (bs *BodyStructure) Format() (fields []interface{}) {
 
 	return
 }
+
+// MessageHeaders contains the parsed header fields of a message.
+type MessageHeaders struct {
+	// The message sequence number.
+	SeqNum uint32
+	// The message unique identifier. It is zero if the server didn't send it.
+	Uid uint32
+	// The header fields, keyed by canonical field names.
+	Header textproto.MIMEHeader
+}
+
+// ParseMessageHeader reads a message header, as returned by a BODY[HEADER]
+// section. Folded lines are unfolded and encoded words (RFC 2047) are decoded,
+// using CharsetReader for charsets other than UTF-8, US-ASCII and ISO-8859-1.
+// Values that cannot be decoded are left as is.
+func ParseMessageHeader(r io.Reader) (textproto.MIMEHeader, error) {
+	h, err := textproto.NewReader(bufio.NewReader(r)).ReadMIMEHeader()
+	// The blank line ending the header can be missing from header fields
+	// retrieved with HEADER.FIELDS
+	if err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, values := range h {
+		for i, v := range values {
+			values[i], _ = decodeHeader(v)
+		}
+	}
+	return h, nil
+}
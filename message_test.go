@@ -3,6 +3,7 @@ package imap
 import (
 	"bytes"
 	"fmt"
+	"net/textproto"
 	"reflect"
 	"testing"
 	"time"
@@ -73,6 +74,53 @@ var messageTests = []struct {
 			"UID", "2424",
 		},
 	},
+	{
+		message: &Message{
+			Items: map[FetchItem]interface{}{
+				FetchUid:    nil,
+				FetchModSeq: nil,
+			},
+			Body:       map[*BodySectionName]Literal{},
+			Uid:        6,
+			ModSeq:     90060115205545359,
+			itemsOrder: []FetchItem{FetchUid, FetchModSeq},
+		},
+		fields: []interface{}{
+			"UID", "6",
+			"MODSEQ", []interface{}{"90060115205545359"},
+		},
+	},
+	{
+		message: &Message{
+			Items: map[FetchItem]interface{}{
+				FetchEmailId:  nil,
+				FetchThreadId: nil,
+			},
+			Body:       map[*BodySectionName]Literal{},
+			EmailId:    "M6d99ac3275bb4e",
+			itemsOrder: []FetchItem{FetchEmailId, FetchThreadId},
+		},
+		fields: []interface{}{
+			"EMAILID", []interface{}{"M6d99ac3275bb4e"},
+			"THREADID", nil,
+		},
+	},
+	{
+		message: &Message{
+			Items: map[FetchItem]interface{}{
+				FetchUid:     nil,
+				FetchPreview: nil,
+			},
+			Body:       map[*BodySectionName]Literal{},
+			Uid:        1,
+			Preview:    "Hello world, this is a test",
+			itemsOrder: []FetchItem{FetchUid, FetchPreview},
+		},
+		fields: []interface{}{
+			"UID", "1",
+			"PREVIEW", "Hello world, this is a test",
+		},
+	},
 }
 
 func TestMessage_Parse(t *testing.T) {
@@ -86,6 +134,101 @@ func TestMessage_Parse(t *testing.T) {
 	}
 }
 
+func TestMessage_SaveDate(t *testing.T) {
+	m := &Message{}
+	if err := m.Parse([]interface{}{"SAVEDATE", "10-Nov-2009 23:00:00 +0000", "UID", "1"}); err != nil {
+		t.Fatal("Cannot parse message:", err)
+	}
+
+	want := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	if !m.SaveDate.Equal(want) {
+		t.Errorf("Invalid save date: got %v but expected %v", m.SaveDate, want)
+	}
+
+	got, err := formatFields(m.Format())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != `(SAVEDATE "10-Nov-2009 23:00:00 +0000" UID 1)` {
+		t.Errorf("Invalid formatted message: got %v", got)
+	}
+
+	m = &Message{}
+	if err := m.Parse([]interface{}{"SAVEDATE", nil}); err != nil {
+		t.Fatal("Cannot parse message:", err)
+	}
+	if !m.SaveDate.IsZero() {
+		t.Errorf("Expected a zero save date for NIL, got %v", m.SaveDate)
+	}
+}
+
+func TestMessage_Parse_internalDateAndSize(t *testing.T) {
+	utc := time.FixedZone("", 0)
+	pst := time.FixedZone("", -8*60*60)
+
+	tests := []struct {
+		date    string
+		size    interface{}
+		outDate time.Time
+		outSize uint32
+	}{
+		{"01-Jan-2020 10:00:00 +0000", "0", time.Date(2020, time.January, 1, 10, 0, 0, 0, utc), 0},
+		{" 1-Jan-2020 10:00:00 +0000", "4242", time.Date(2020, time.January, 1, 10, 0, 0, 0, utc), 4242},
+		{"1-Jan-2020 10:00:00 -0800", "4294967295", time.Date(2020, time.January, 1, 10, 0, 0, 0, pst), 4294967295},
+		{"1-JAN-2020 10:00:00 -0800", "4294967296", time.Date(2020, time.January, 1, 10, 0, 0, 0, pst), 4294967295},
+		{"1-Jan-2020  10:00:00 -08:00", "99999999999999999999999", time.Date(2020, time.January, 1, 10, 0, 0, 0, pst), 4294967295},
+		{"1-Jan-2020 10:00:00", uint32(42), time.Date(2020, time.January, 1, 10, 0, 0, 0, time.UTC), 42},
+		{"1-Jan-20 10:00:00 +0000", "-1", time.Date(2020, time.January, 1, 10, 0, 0, 0, utc), 0},
+		{"garbage", "abc", time.Time{}, 0},
+	}
+
+	for _, test := range tests {
+		m := &Message{}
+		if err := m.Parse([]interface{}{"INTERNALDATE", test.date, "RFC822.SIZE", test.size}); err != nil {
+			t.Errorf("Cannot parse message with date %q: %v", test.date, err)
+			continue
+		}
+
+		if !m.InternalDate.Equal(test.outDate) {
+			t.Errorf("Invalid internal date for %q: expected %v but got %v", test.date, test.outDate, m.InternalDate)
+		}
+		if m.Size != test.outSize {
+			t.Errorf("Invalid size for %v: expected %v but got %v", test.size, test.outSize, m.Size)
+		}
+	}
+}
+
+func TestMessage_Merge(t *testing.T) {
+	m := &Message{SeqNum: 42}
+	if err := m.Parse([]interface{}{"FLAGS", []interface{}{"\\Seen"}, "UID", "24"}); err != nil {
+		t.Fatal(err)
+	}
+
+	other := &Message{SeqNum: 42}
+	if err := other.Parse([]interface{}{"RFC822.SIZE", "4242", "FLAGS", []interface{}{"\\Seen", "\\Answered"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Merge(other)
+
+	expected := &Message{
+		SeqNum: 42,
+		Items: map[FetchItem]interface{}{
+			FetchFlags:      nil,
+			FetchUid:        nil,
+			FetchRFC822Size: nil,
+		},
+		Body:       map[*BodySectionName]Literal{},
+		Flags:      []string{SeenFlag, AnsweredFlag},
+		Size:       4242,
+		Uid:        24,
+		itemsOrder: []FetchItem{FetchFlags, FetchUid, FetchRFC822Size},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("Invalid merged message: expected \n%+v\n but got \n%+v", expected, m)
+	}
+}
+
 func TestMessage_Format(t *testing.T) {
 	for i, test := range messageTests {
 		fields := test.message.Format()
@@ -168,6 +311,14 @@ var bodySectionNameTests = []struct {
 		raw:    "BODY[HEADER.FIELDS.NOT (Content-Id)]",
 		parsed: &BodySectionName{BodyPartName: BodyPartName{Specifier: HeaderSpecifier, Fields: []string{"Content-Id"}, NotFields: true}},
 	},
+	{
+		raw:    "BINARY[1.2]",
+		parsed: &BodySectionName{BodyPartName: BodyPartName{Path: []int{1, 2}}, Binary: true},
+	},
+	{
+		raw:    "BINARY.PEEK[3]<0.512>",
+		parsed: &BodySectionName{BodyPartName: BodyPartName{Path: []int{3}}, Binary: true, Peek: true, Partial: []int{0, 512}},
+	},
 }
 
 func TestNewBodySectionName(t *testing.T) {
@@ -182,12 +333,41 @@ func TestNewBodySectionName(t *testing.T) {
 			t.Errorf("Invalid body part name for #%v: %#+v", i, bsn.BodyPartName)
 		} else if bsn.Peek != test.parsed.Peek {
 			t.Errorf("Invalid peek value for #%v: %#+v", i, bsn.Peek)
+		} else if bsn.Binary != test.parsed.Binary {
+			t.Errorf("Invalid binary value for #%v: %#+v", i, bsn.Binary)
 		} else if !reflect.DeepEqual(bsn.Partial, test.parsed.Partial) {
 			t.Errorf("Invalid partial for #%v: %#+v", i, bsn.Partial)
 		}
 	}
 }
 
+func TestBinarySizeItem(t *testing.T) {
+	item := BinarySizeItem([]int{1, 2})
+	if item != "BINARY.SIZE[1.2]" {
+		t.Fatalf("BinarySizeItem() = %v, want %v", item, "BINARY.SIZE[1.2]")
+	}
+
+	path, err := ParseBinarySizeItem(item)
+	if err != nil {
+		t.Fatal("ParseBinarySizeItem() =", err)
+	}
+	if !reflect.DeepEqual(path, []int{1, 2}) {
+		t.Errorf("ParseBinarySizeItem() = %v, want %v", path, []int{1, 2})
+	}
+
+	if _, err := ParseBinarySizeItem("BINARY.SIZE[1.HEADER]"); err == nil {
+		t.Error("Expected an error when parsing a BINARY.SIZE item with a specifier")
+	}
+
+	msg := &Message{}
+	if err := msg.Parse([]interface{}{"BINARY.SIZE[1.2]", "42"}); err != nil {
+		t.Fatal(err)
+	}
+	if size, ok := msg.BinarySize([]int{1, 2}); !ok || size != 42 {
+		t.Errorf("Message.BinarySize() = %v, %v, want %v, %v", size, ok, 42, true)
+	}
+}
+
 func TestBodySectionName_String(t *testing.T) {
 	for i, test := range bodySectionNameTests {
 		s := string(test.parsed.FetchItem())
@@ -600,3 +780,250 @@ func TestBodyStructure_Format(t *testing.T) {
 		}
 	}
 }
+
+func TestBodyStructure_Parse_extended(t *testing.T) {
+	// A multipart/mixed message with a text part, an attachment and an inline
+	// image, as sent by Dovecot
+	raw := `* 1 FETCH (BODYSTRUCTURE (` +
+		`("text" "plain" ("charset" "utf-8") NIL NIL "quoted-printable" 1315 42 NIL NIL NIL NIL)` +
+		`("application" "pdf" ("name" "report.pdf") NIL NIL "base64" 23528 NIL ("attachment" ("filename" "report.pdf" "size" "17183")) NIL NIL)` +
+		`("image" "png" ("name" "=?utf-8?q?caf=C3=A9.png?=") "<logo@example.org>" NIL "base64" 2064 "cc9b7ae2a5e4b8d39be12ed5ba1bf9c2" ("inline" ("filename" "=?utf-8?q?caf=C3=A9.png?=")) "fr" "http://example.org/logo.png")` +
+		` "mixed" ("boundary" "----=_Part_0") ("inline" NIL) ("en" "fr") NIL))` + "\r\n"
+
+	resp, err := ReadResp(NewReader(bytes.NewBufferString(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := resp.(*DataResp).Fields
+
+	msg := &Message{}
+	if err := msg.Parse(fields[2].([]interface{})); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &BodyStructure{
+		MIMEType:    "multipart",
+		MIMESubType: "mixed",
+		Params:      map[string]string{"boundary": "----=_Part_0"},
+		Parts: []*BodyStructure{
+			{
+				MIMEType:    "text",
+				MIMESubType: "plain",
+				Params:      map[string]string{"charset": "utf-8"},
+				Encoding:    "quoted-printable",
+				Size:        1315,
+				Lines:       42,
+				Extended:    true,
+			},
+			{
+				MIMEType:          "application",
+				MIMESubType:       "pdf",
+				Params:            map[string]string{"name": "report.pdf"},
+				Encoding:          "base64",
+				Size:              23528,
+				Extended:          true,
+				Disposition:       "attachment",
+				DispositionParams: map[string]string{"filename": "report.pdf", "size": "17183"},
+			},
+			{
+				MIMEType:          "image",
+				MIMESubType:       "png",
+				Params:            map[string]string{"name": "café.png"},
+				Id:                "<logo@example.org>",
+				Encoding:          "base64",
+				Size:              2064,
+				Extended:          true,
+				MD5:               "cc9b7ae2a5e4b8d39be12ed5ba1bf9c2",
+				Disposition:       "inline",
+				DispositionParams: map[string]string{"filename": "café.png"},
+				Language:          []string{"fr"},
+				Location:          []string{"http://example.org/logo.png"},
+			},
+		},
+		Extended:    true,
+		Disposition: "inline",
+		Language:    []string{"en", "fr"},
+	}
+
+	if !reflect.DeepEqual(msg.BodyStructure, want) {
+		t.Errorf("Invalid body structure: got \n%+v\n but expected \n%+v", msg.BodyStructure, want)
+		for i, part := range msg.BodyStructure.Parts {
+			t.Logf("Part #%v: %+v", i, part)
+		}
+	}
+}
+
+func TestBodyStructure_Parse_partialExtension(t *testing.T) {
+	// Only the MD5, like some servers do
+	fields := []interface{}{"application", "pdf", nil, nil, nil, "base64", "4242", nil}
+
+	bs := &BodyStructure{}
+	if err := bs.Parse(fields); err != nil {
+		t.Fatal(err)
+	}
+	if !bs.Extended || bs.MD5 != "" || bs.Disposition != "" || bs.Language != nil || bs.Location != nil {
+		t.Errorf("Invalid body structure: %+v", bs)
+	}
+}
+
+func TestBodyStructure_Parse_rfc2231(t *testing.T) {
+	fields := []interface{}{
+		"application", "pdf", []interface{}{"name*", "utf-8''r%C3%A9sum%C3%A9.pdf"}, nil, nil, "base64", "4242", nil,
+		[]interface{}{"attachment", []interface{}{
+			"filename*0*", "utf-8''Quarterly%20report%20",
+			"filename*1", "for the ",
+			"filename*2*", "%C3%A9quipe.pdf",
+			"size", "4242",
+		}},
+	}
+
+	bs := &BodyStructure{}
+	if err := bs.Parse(fields); err != nil {
+		t.Fatal(err)
+	}
+
+	wantParams := map[string]string{"name": "résumé.pdf"}
+	if !reflect.DeepEqual(bs.Params, wantParams) {
+		t.Errorf("Invalid params: got %v, want %v", bs.Params, wantParams)
+	}
+	wantDispositionParams := map[string]string{"filename": "Quarterly report for the équipe.pdf", "size": "4242"}
+	if !reflect.DeepEqual(bs.DispositionParams, wantDispositionParams) {
+		t.Errorf("Invalid disposition params: got %v, want %v", bs.DispositionParams, wantDispositionParams)
+	}
+
+	if filename := bs.Filename(); filename != "Quarterly report for the équipe.pdf" {
+		t.Errorf("Invalid filename: %q", filename)
+	}
+}
+
+func TestBodyStructure_Filename(t *testing.T) {
+	tests := []struct {
+		bs       *BodyStructure
+		filename string
+	}{
+		{&BodyStructure{}, ""},
+		{&BodyStructure{Params: map[string]string{"NAME": "a.txt"}}, "a.txt"},
+		{&BodyStructure{Params: map[string]string{"name": "a.txt"}, DispositionParams: map[string]string{"filename": "b.txt"}}, "b.txt"},
+		// Sections are reassembled in order
+		{&BodyStructure{DispositionParams: decodeExtendedParams(map[string]string{"filename*1": "b.txt", "filename*0": "a-"})}, "a-b.txt"},
+	}
+
+	for i, test := range tests {
+		if filename := test.bs.Filename(); filename != test.filename {
+			t.Errorf("Invalid filename for #%v: got %q, want %q", i, filename, test.filename)
+		}
+	}
+}
+
+func TestEnvelope_Parse_group(t *testing.T) {
+	fields := []interface{}{
+		nil, "Hi", nil, nil, nil,
+		[]interface{}{
+			[]interface{}{nil, nil, "undisclosed-recipients", nil},
+			[]interface{}{nil, nil, nil, nil},
+		},
+		nil, nil, nil, nil,
+	}
+
+	env := &Envelope{}
+	if err := env.Parse(fields); err != nil {
+		t.Fatal("Cannot parse envelope:", err)
+	}
+	if len(env.To) != 2 || !env.To[0].IsGroupStart() || !env.To[1].IsGroupEnd() {
+		t.Fatalf("Invalid group markers: %v", env.To)
+	}
+	if env.To[0].MailboxName != "undisclosed-recipients" {
+		t.Errorf("Invalid group name: %q", env.To[0].MailboxName)
+	}
+
+	groups := GroupAddressList(env.To)
+	if len(groups) != 1 || groups[0].Name != "undisclosed-recipients" || len(groups[0].Addresses) != 0 {
+		t.Errorf("Invalid groups: %v", groups)
+	}
+
+	// Group markers are formatted back to NIL fields
+	if got := FormatAddressList(env.To); !reflect.DeepEqual(got, fields[5]) {
+		t.Errorf("Invalid address list fields: got %v but expected %v", got, fields[5])
+	}
+}
+
+func TestGroupAddressList(t *testing.T) {
+	alice := &Address{MailboxName: "alice", HostName: "example.org"}
+	bob := &Address{MailboxName: "bob", HostName: "example.org"}
+	carol := &Address{MailboxName: "carol", HostName: "example.org"}
+	start := func(name string) *Address { return &Address{MailboxName: name} }
+	end := &Address{}
+
+	tests := []struct {
+		addrs  []*Address
+		groups []*AddressGroup
+	}{
+		{
+			addrs:  []*Address{alice, bob},
+			groups: []*AddressGroup{{Addresses: []*Address{alice, bob}}},
+		},
+		{
+			addrs: []*Address{alice, start("friends"), bob, carol, end, alice},
+			groups: []*AddressGroup{
+				{Addresses: []*Address{alice}},
+				{Name: "friends", Addresses: []*Address{bob, carol}},
+				{Addresses: []*Address{alice}},
+			},
+		},
+		{
+			// A group start inside a group closes it
+			addrs: []*Address{start("a"), alice, start("b"), bob, end},
+			groups: []*AddressGroup{
+				{Name: "a", Addresses: []*Address{alice}},
+				{Name: "b", Addresses: []*Address{bob}},
+			},
+		},
+		{
+			// Unbalanced end markers are ignored, unterminated groups end with
+			// the list
+			addrs: []*Address{end, alice, nil, start("empty"), end, start("open"), bob},
+			groups: []*AddressGroup{
+				{Addresses: []*Address{alice}},
+				{Name: "empty", Addresses: []*Address{}},
+				{Name: "open", Addresses: []*Address{bob}},
+			},
+		},
+	}
+
+	for i, test := range tests {
+		if groups := GroupAddressList(test.addrs); !reflect.DeepEqual(groups, test.groups) {
+			t.Errorf("Invalid groups for #%v: got %v but expected %v", i, groups, test.groups)
+		}
+	}
+}
+
+func TestParseMessageHeader(t *testing.T) {
+	header := "Subject: A very long subject\r\n" +
+		"\tfolded on two lines\r\n" +
+		"From: =?utf-8?q?Mitsuha_Miyamizu?=\r\n" +
+		" <mitsuha.miyamizu@example.org>\r\n" +
+		"to: taki.tachibana@example.org\r\n" +
+		"\r\n"
+
+	h, err := ParseMessageHeader(bytes.NewBufferString(header))
+	if err != nil {
+		t.Fatal("Cannot parse header:", err)
+	}
+
+	want := textproto.MIMEHeader{
+		"Subject": {"A very long subject folded on two lines"},
+		"From":    {"Mitsuha Miyamizu <mitsuha.miyamizu@example.org>"},
+		"To":      {"taki.tachibana@example.org"},
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("Invalid header: got %v but expected %v", h, want)
+	}
+
+	// The final blank line is optional
+	h, err = ParseMessageHeader(bytes.NewBufferString("Subject: Hi\r\n"))
+	if err != nil {
+		t.Fatal("Cannot parse header without blank line:", err)
+	} else if s := h.Get("Subject"); s != "Hi" {
+		t.Errorf("Invalid subject: got %q but expected %q", s, "Hi")
+	}
+}
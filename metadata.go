@@ -0,0 +1,147 @@
+package imap
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Metadata entry prefixes, as defined in RFC 5464 section 3.2. Private entries
+// are only visible to the user who set them, shared entries are visible to
+// all users.
+const (
+	MetadataPrivate = "/private"
+	MetadataShared  = "/shared"
+)
+
+// MetadataDepth is the DEPTH option of the GETMETADATA command, as defined in
+// RFC 5464 section 4.2.2.
+type MetadataDepth int
+
+const (
+	// Only the requested entries.
+	MetadataDepthZero MetadataDepth = 0
+	// The requested entries and their immediate children.
+	MetadataDepthOne MetadataDepth = 1
+	// The requested entries and all their descendants.
+	MetadataDepthInfinity MetadataDepth = -1
+)
+
+func (depth MetadataDepth) String() string {
+	switch depth {
+	case MetadataDepthZero:
+		return "0"
+	case MetadataDepthOne:
+		return "1"
+	case MetadataDepthInfinity:
+		return "infinity"
+	}
+	return ""
+}
+
+// ParseMetadataDepth parses a GETMETADATA DEPTH option.
+func ParseMetadataDepth(s string) (MetadataDepth, error) {
+	switch strings.ToLower(s) {
+	case "0":
+		return MetadataDepthZero, nil
+	case "1":
+		return MetadataDepthOne, nil
+	case "infinity":
+		return MetadataDepthInfinity, nil
+	}
+	return 0, errors.New("Invalid metadata depth: " + s)
+}
+
+// MetadataOptions contains GETMETADATA options, as defined in RFC 5464 section
+// 4.2.
+type MetadataOptions struct {
+	// Entries with values larger than MaxSize are not returned. Zero means
+	// that there is no limit.
+	MaxSize uint32
+	Depth   MetadataDepth
+}
+
+// CheckMetadataEntry checks that entry is a valid metadata entry name: it must
+// start with /private or /shared, and must not contain wildcards or empty
+// components. See RFC 5464 section 3.2.
+func CheckMetadataEntry(entry string) error {
+	lower := strings.ToLower(entry)
+	if lower != MetadataPrivate && lower != MetadataShared &&
+		!strings.HasPrefix(lower, MetadataPrivate+"/") && !strings.HasPrefix(lower, MetadataShared+"/") {
+		return errors.New("Metadata entry must start with /private or /shared: " + entry)
+	}
+	if strings.HasSuffix(entry, "/") || strings.Contains(entry, "//") || strings.ContainsAny(entry, "*%") {
+		return errors.New("Invalid metadata entry: " + entry)
+	}
+	return nil
+}
+
+// MatchMetadataEntry checks if entry is returned when requesting requested with
+// the provided depth. Entry names are case-insensitive.
+func MatchMetadataEntry(requested, entry string, depth MetadataDepth) bool {
+	requested, entry = strings.ToLower(requested), strings.ToLower(entry)
+	if entry == requested {
+		return true
+	}
+	if depth == MetadataDepthZero || !strings.HasPrefix(entry, requested+"/") {
+		return false
+	}
+	if depth == MetadataDepthOne {
+		return !strings.Contains(entry[len(requested)+1:], "/")
+	}
+	return true
+}
+
+// FormatMetadata formats metadata entries and their values to a list. A nil
+// value is formatted as NIL, which removes the entry when used with
+// SETMETADATA. Entries are sorted by name.
+func FormatMetadata(entries map[string]*string) []interface{} {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]interface{}, 0, 2*len(names))
+	for _, name := range names {
+		var v interface{}
+		if value := entries[name]; value != nil {
+			// Values are strings, they cannot be atoms
+			v = formatIDString(*value)
+		}
+		fields = append(fields, name, v)
+	}
+	return fields
+}
+
+// ParseMetadata parses a list of metadata entries and their values. NIL values
+// are parsed as nil pointers. Entry names are converted to lower case, since
+// they are case-insensitive.
+func ParseMetadata(f interface{}) (map[string]*string, error) {
+	fields, ok := f.([]interface{})
+	if !ok {
+		return nil, errors.New("Metadata entries must be a list")
+	} else if len(fields)%2 != 0 {
+		return nil, errors.New("Metadata entries list must have an even number of fields")
+	}
+
+	entries := make(map[string]*string, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		name, err := ParseString(fields[i])
+		if err != nil {
+			return nil, errors.New("Metadata entry name must be a string")
+		}
+
+		var value *string
+		if fields[i+1] != nil {
+			v, err := ParseString(fields[i+1])
+			if err != nil {
+				return nil, errors.New("Metadata entry value must be a string or NIL")
+			}
+			value = &v
+		}
+
+		entries[strings.ToLower(name)] = value
+	}
+	return entries, nil
+}
@@ -0,0 +1,82 @@
+package imap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMatchMetadataEntry(t *testing.T) {
+	tests := []struct {
+		requested, entry string
+		depth            MetadataDepth
+		match            bool
+	}{
+		{"/shared/comment", "/shared/comment", MetadataDepthZero, true},
+		{"/shared/comment", "/Shared/Comment", MetadataDepthZero, true},
+		{"/shared", "/shared/comment", MetadataDepthZero, false},
+		{"/shared", "/shared/comment", MetadataDepthOne, true},
+		{"/shared", "/shared/vendor/foo", MetadataDepthOne, false},
+		{"/shared", "/shared/vendor/foo", MetadataDepthInfinity, true},
+		{"/shared/com", "/shared/comment", MetadataDepthInfinity, false},
+	}
+
+	for _, test := range tests {
+		if match := MatchMetadataEntry(test.requested, test.entry, test.depth); match != test.match {
+			t.Errorf("MatchMetadataEntry(%q, %q, %v) = %v, want %v", test.requested, test.entry, test.depth, match, test.match)
+		}
+	}
+}
+
+func TestCheckMetadataEntry(t *testing.T) {
+	for _, entry := range []string{"/private/comment", "/shared", "/Shared/vendor/foo"} {
+		if err := CheckMetadataEntry(entry); err != nil {
+			t.Errorf("CheckMetadataEntry(%q) = %v", entry, err)
+		}
+	}
+	for _, entry := range []string{"comment", "/public/comment", "/shared/", "/shared//foo", "/shared/*"} {
+		if err := CheckMetadataEntry(entry); err == nil {
+			t.Errorf("CheckMetadataEntry(%q) = nil, want an error", entry)
+		}
+	}
+}
+
+func TestFormatMetadata(t *testing.T) {
+	comment := "My comment"
+	entries := map[string]*string{
+		"/shared/comment":  &comment,
+		"/private/comment": nil,
+	}
+
+	var b bytes.Buffer
+	w := NewWriter(&b)
+	if err := w.writeField(FormatMetadata(entries)); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	if s := b.String(); s != `(/private/comment NIL /shared/comment "My comment")` {
+		t.Errorf("Invalid metadata: %v", s)
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	fields := []interface{}{"/Shared/Comment", "My comment", "/private/comment", nil}
+	entries, err := ParseMetadata(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comment := "My comment"
+	want := map[string]*string{
+		"/shared/comment":  &comment,
+		"/private/comment": nil,
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("ParseMetadata() = %v, want %v", entries, want)
+	}
+
+	if _, err := ParseMetadata([]interface{}{"/shared/comment"}); err == nil {
+		t.Error("Expected an error for an odd number of fields")
+	}
+}
@@ -0,0 +1,65 @@
+package imap
+
+import (
+	"errors"
+)
+
+// A Namespace is a part of the mailbox hierarchy, as defined in RFC 2342
+// section 5.
+type Namespace struct {
+	// The prefix of mailbox names in the namespace, e.g. "" for the personal
+	// namespace or "Other Users/".
+	Prefix string
+	// The hierarchy delimiter, empty if the namespace is flat.
+	Delimiter string
+}
+
+// ParseNamespaces parses a list of namespaces. NIL is parsed as an empty list.
+func ParseNamespaces(f interface{}) ([]*Namespace, error) {
+	if f == nil {
+		return nil, nil
+	}
+	fields, ok := f.([]interface{})
+	if !ok {
+		return nil, errors.New("Namespaces must be a list")
+	}
+
+	namespaces := make([]*Namespace, 0, len(fields))
+	for _, f := range fields {
+		desc, ok := f.([]interface{})
+		if !ok || len(desc) < 2 {
+			return nil, errors.New("Namespace must be a list of at least 2 fields")
+		}
+
+		ns := new(Namespace)
+		var err error
+		if ns.Prefix, err = ParseString(desc[0]); err != nil {
+			return nil, errors.New("Namespace prefix must be a string")
+		}
+		if desc[1] != nil {
+			if ns.Delimiter, err = ParseString(desc[1]); err != nil {
+				return nil, errors.New("Namespace delimiter must be a string")
+			}
+		}
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces, nil
+}
+
+// FormatNamespaces formats a list of namespaces. An empty list is formatted as
+// NIL.
+func FormatNamespaces(namespaces []*Namespace) interface{} {
+	if len(namespaces) == 0 {
+		return nil
+	}
+
+	fields := make([]interface{}, len(namespaces))
+	for i, ns := range namespaces {
+		var delim interface{}
+		if ns.Delimiter != "" {
+			delim = Quoted(ns.Delimiter)
+		}
+		fields[i] = []interface{}{Quoted(ns.Prefix), delim}
+	}
+	return fields
+}
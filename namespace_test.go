@@ -0,0 +1,43 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNamespaces(t *testing.T) {
+	namespaces := []*Namespace{
+		{Prefix: "", Delimiter: "/"},
+		{Prefix: "#flat", Delimiter: ""},
+	}
+
+	fields := FormatNamespaces(namespaces)
+	want := []interface{}{
+		[]interface{}{Quoted(""), Quoted("/")},
+		[]interface{}{Quoted("#flat"), nil},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("FormatNamespaces() = %v, want %v", fields, want)
+	}
+
+	parsed, err := ParseNamespaces([]interface{}{
+		[]interface{}{"", "/"},
+		[]interface{}{"#flat", nil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, namespaces) {
+		t.Errorf("ParseNamespaces() = %v, want %v", parsed, namespaces)
+	}
+
+	if parsed, err := ParseNamespaces(nil); err != nil || len(parsed) != 0 {
+		t.Errorf("ParseNamespaces(nil) = %v, %v", parsed, err)
+	}
+	if FormatNamespaces(nil) != nil {
+		t.Error("FormatNamespaces(nil) should be NIL")
+	}
+	if _, err := ParseNamespaces([]interface{}{"INBOX"}); err == nil {
+		t.Error("Expected an error for an invalid namespace")
+	}
+}
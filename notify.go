@@ -0,0 +1,247 @@
+package imap
+
+import (
+	"errors"
+	"strings"
+)
+
+// A NOTIFY event, as defined in RFC 5465 section 5.
+type NotifyEvent string
+
+// NOTIFY events defined in RFC 5465 section 5.
+const (
+	NotifyMessageNew            NotifyEvent = "MessageNew"
+	NotifyMessageExpunge        NotifyEvent = "MessageExpunge"
+	NotifyFlagChange            NotifyEvent = "FlagChange"
+	NotifyAnnotationChange      NotifyEvent = "AnnotationChange"
+	NotifyMailboxName           NotifyEvent = "MailboxName"
+	NotifySubscriptionChange    NotifyEvent = "SubscriptionChange"
+	NotifyMailboxMetadataChange NotifyEvent = "MailboxMetadataChange"
+	NotifyServerMetadataChange  NotifyEvent = "ServerMetadataChange"
+)
+
+// A NotifyFilter selects the mailboxes a NOTIFY event group applies to.
+type NotifyFilter string
+
+// NOTIFY mailbox filters defined in RFC 5465 section 6.
+const (
+	// The selected mailbox.
+	NotifySelected NotifyFilter = "SELECTED"
+	// The selected mailbox, but expunges are only reported when the client
+	// can safely handle them.
+	NotifySelectedDelayed NotifyFilter = "SELECTED-DELAYED"
+	// All mailboxes messages are delivered to.
+	NotifyInboxes NotifyFilter = "INBOXES"
+	// All mailboxes in the personal namespace.
+	NotifyPersonal NotifyFilter = "PERSONAL"
+	// All subscribed mailboxes.
+	NotifySubscribed NotifyFilter = "SUBSCRIBED"
+	// The mailboxes listed in Mailboxes and all their children.
+	NotifySubtree NotifyFilter = "SUBTREE"
+	// The mailboxes listed in Mailboxes.
+	NotifyMailboxes NotifyFilter = "MAILBOXES"
+)
+
+// A NotifyEventGroup is a list of events to report for a set of mailboxes.
+type NotifyEventGroup struct {
+	// The mailboxes the events apply to.
+	Filter NotifyFilter
+	// The mailbox names, for the NotifySubtree and NotifyMailboxes filters.
+	Mailboxes []string
+	// The events to report. If empty, no events are reported for these
+	// mailboxes.
+	Events []NotifyEvent
+	// The message data items sent with MessageNew events in the selected
+	// mailbox.
+	FetchItems []FetchItem
+}
+
+func (g *NotifyEventGroup) hasMailboxes() bool {
+	return g.Filter == NotifySubtree || g.Filter == NotifyMailboxes
+}
+
+// Format an event group to fields.
+func (g *NotifyEventGroup) Format() []interface{} {
+	fields := []interface{}{string(g.Filter)}
+
+	if g.hasMailboxes() {
+		mailboxes := make([]interface{}, len(g.Mailboxes))
+		for i, name := range g.Mailboxes {
+			mailboxes[i] = FormatMailboxName(name)
+		}
+		fields = append(fields, mailboxes)
+	}
+
+	if len(g.Events) == 0 {
+		return append(fields, "NONE")
+	}
+
+	events := make([]interface{}, 0, len(g.Events))
+	for _, event := range g.Events {
+		events = append(events, string(event))
+		if event == NotifyMessageNew && len(g.FetchItems) > 0 {
+			items := make([]interface{}, len(g.FetchItems))
+			for i, item := range g.FetchItems {
+				if section, err := ParseBodySectionName(item); err == nil {
+					items[i] = section
+				} else {
+					items[i] = string(item)
+				}
+			}
+			events = append(events, items)
+		}
+	}
+	return append(fields, events)
+}
+
+// Parse an event group from fields.
+func (g *NotifyEventGroup) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("Event group must contain mailboxes and events")
+	}
+
+	filter, ok := fields[0].(string)
+	if !ok {
+		return errors.New("Event group mailbox filter must be an atom")
+	}
+	g.Filter = NotifyFilter(strings.ToUpper(filter))
+	fields = fields[1:]
+
+	switch g.Filter {
+	case NotifySelected, NotifySelectedDelayed, NotifyInboxes, NotifyPersonal, NotifySubscribed:
+	case NotifySubtree, NotifyMailboxes:
+		if len(fields) < 2 {
+			return errors.New("Event group must contain mailboxes and events")
+		}
+
+		var names []interface{}
+		if list, ok := fields[0].([]interface{}); ok {
+			names = list
+		} else {
+			names = []interface{}{fields[0]}
+		}
+
+		g.Mailboxes = make([]string, len(names))
+		for i, f := range names {
+			if name, err := ParseString(f); err != nil {
+				return err
+			} else if name, err := DecodeMailboxName(name); err != nil {
+				return err
+			} else {
+				g.Mailboxes[i] = CanonicalMailboxName(name)
+			}
+		}
+		fields = fields[1:]
+	default:
+		return errors.New("Unknown event group mailbox filter: " + filter)
+	}
+
+	g.Events = nil
+	g.FetchItems = nil
+	switch events := fields[0].(type) {
+	case string:
+		if strings.ToUpper(events) != "NONE" {
+			return errors.New("Event group events must be a list or NONE")
+		}
+	case []interface{}:
+		for i := 0; i < len(events); i++ {
+			event, ok := events[i].(string)
+			if !ok {
+				return errors.New("Event must be an atom")
+			}
+			g.Events = append(g.Events, NotifyEvent(event))
+
+			if NotifyEvent(event) != NotifyMessageNew || i+1 >= len(events) {
+				continue
+			}
+			if items, ok := events[i+1].([]interface{}); ok {
+				for _, item := range items {
+					s, _ := item.(string)
+					g.FetchItems = append(g.FetchItems, FetchItem(strings.ToUpper(s)))
+				}
+				i++
+			}
+		}
+	default:
+		return errors.New("Event group events must be a list or NONE")
+	}
+
+	return nil
+}
+
+// A NotifySpec is a list of events a client wants to be notified about, as
+// defined in RFC 5465.
+type NotifySpec struct {
+	// If true, the server sends the status of each mailbox matched by the
+	// event groups right away.
+	Status bool
+	// The event groups. A mailbox matched by several groups uses the first
+	// one.
+	Groups []*NotifyEventGroup
+}
+
+// Format a NOTIFY spec to fields, after the SET keyword.
+func (spec *NotifySpec) Format() []interface{} {
+	var fields []interface{}
+	if spec.Status {
+		fields = append(fields, "STATUS")
+	}
+	for _, g := range spec.Groups {
+		fields = append(fields, g.Format())
+	}
+	return fields
+}
+
+// Parse a NOTIFY spec from fields, after the SET keyword.
+func (spec *NotifySpec) Parse(fields []interface{}) error {
+	spec.Status = false
+	spec.Groups = nil
+
+	if len(fields) > 0 {
+		if s, ok := fields[0].(string); ok && strings.ToUpper(s) == "STATUS" {
+			spec.Status = true
+			fields = fields[1:]
+		}
+	}
+
+	for _, f := range fields {
+		list, ok := f.([]interface{})
+		if !ok {
+			return errors.New("Event group must be a list")
+		}
+
+		g := new(NotifyEventGroup)
+		if err := g.Parse(list); err != nil {
+			return err
+		}
+		spec.Groups = append(spec.Groups, g)
+	}
+
+	if len(spec.Groups) == 0 {
+		return errors.New("NOTIFY SET requires at least one event group")
+	}
+	return spec.Validate()
+}
+
+// Validate checks that the events of each group can be requested together, as
+// defined in RFC 5465 section 5: MessageNew and MessageExpunge must be
+// requested together, and are required by FlagChange and AnnotationChange.
+func (spec *NotifySpec) Validate() error {
+	for _, g := range spec.Groups {
+		events := make(map[NotifyEvent]bool, len(g.Events))
+		for _, e := range g.Events {
+			events[NotifyEvent(strings.ToLower(string(e)))] = true
+		}
+
+		has := func(e NotifyEvent) bool {
+			return events[NotifyEvent(strings.ToLower(string(e)))]
+		}
+		if has(NotifyMessageNew) != has(NotifyMessageExpunge) {
+			return errors.New("MessageNew and MessageExpunge must be requested together")
+		}
+		if (has(NotifyFlagChange) || has(NotifyAnnotationChange)) && !has(NotifyMessageNew) {
+			return errors.New("FlagChange and AnnotationChange require MessageNew and MessageExpunge")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package imap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var notifySpecTests = []struct {
+	fields []interface{}
+	spec   *NotifySpec
+}{
+	{
+		fields: []interface{}{
+			"STATUS",
+			[]interface{}{"SELECTED", []interface{}{"MessageNew", []interface{}{"UID", "FLAGS"}, "MessageExpunge"}},
+			[]interface{}{"MAILBOXES", []interface{}{"INBOX", "Sent"}, []interface{}{"MessageNew", "MessageExpunge"}},
+		},
+		spec: &NotifySpec{
+			Status: true,
+			Groups: []*NotifyEventGroup{
+				{
+					Filter:     NotifySelected,
+					Events:     []NotifyEvent{NotifyMessageNew, NotifyMessageExpunge},
+					FetchItems: []FetchItem{FetchUid, FetchFlags},
+				},
+				{
+					Filter:    NotifyMailboxes,
+					Mailboxes: []string{"INBOX", "Sent"},
+					Events:    []NotifyEvent{NotifyMessageNew, NotifyMessageExpunge},
+				},
+			},
+		},
+	},
+	{
+		fields: []interface{}{
+			[]interface{}{"SUBTREE", []interface{}{"Lists"}, []interface{}{"MessageNew", "MessageExpunge", "FlagChange"}},
+			[]interface{}{"PERSONAL", "NONE"},
+		},
+		spec: &NotifySpec{
+			Groups: []*NotifyEventGroup{
+				{
+					Filter:    NotifySubtree,
+					Mailboxes: []string{"Lists"},
+					Events:    []NotifyEvent{NotifyMessageNew, NotifyMessageExpunge, NotifyFlagChange},
+				},
+				{Filter: NotifyPersonal},
+			},
+		},
+	},
+}
+
+func TestNotifySpec_Format(t *testing.T) {
+	for i, test := range notifySpecTests {
+		// Mailbox names are encoded when written, compare the wire format
+		var got, want bytes.Buffer
+		NewWriter(&got).writeFields(test.spec.Format())
+		NewWriter(&want).writeFields(test.fields)
+		if got.String() != want.String() {
+			t.Errorf("Test #%v: invalid fields: expected %q but got %q", i, want.String(), got.String())
+		}
+	}
+}
+
+func TestNotifySpec_Parse(t *testing.T) {
+	for i, test := range notifySpecTests {
+		spec := new(NotifySpec)
+		if err := spec.Parse(test.fields); err != nil {
+			t.Errorf("Test #%v: cannot parse NOTIFY spec: %v", i, err)
+		} else if !reflect.DeepEqual(spec, test.spec) {
+			t.Errorf("Test #%v: invalid NOTIFY spec: expected %#v but got %#v", i, test.spec, spec)
+		}
+	}
+}
+
+func TestNotifySpec_Parse_single(t *testing.T) {
+	// A single mailbox doesn't need to be enclosed in a list
+	fields := []interface{}{[]interface{}{"mailboxes", "INBOX", []interface{}{"MessageNew", "MessageExpunge"}}}
+
+	spec := new(NotifySpec)
+	if err := spec.Parse(fields); err != nil {
+		t.Fatal("Cannot parse NOTIFY spec:", err)
+	}
+	if len(spec.Groups) != 1 || !reflect.DeepEqual(spec.Groups[0].Mailboxes, []string{"INBOX"}) {
+		t.Errorf("Invalid event groups: %#v", spec.Groups)
+	}
+
+	if err := spec.Parse(nil); err == nil {
+		t.Error("Expected an error when parsing an empty NOTIFY spec")
+	}
+}
+
+func TestNotifySpec_Validate(t *testing.T) {
+	invalid := [][]NotifyEvent{
+		{NotifyMessageNew},
+		{NotifyMessageExpunge},
+		{NotifyFlagChange},
+		{NotifyMailboxName, NotifyFlagChange},
+	}
+	for _, events := range invalid {
+		spec := &NotifySpec{Groups: []*NotifyEventGroup{{Filter: NotifyPersonal, Events: events}}}
+		if err := spec.Validate(); err == nil {
+			t.Errorf("Expected an error when validating events %v", events)
+		}
+	}
+
+	spec := &NotifySpec{Groups: []*NotifyEventGroup{
+		{Filter: NotifyPersonal, Events: []NotifyEvent{"messagenew", NotifyMessageExpunge, NotifyFlagChange}},
+		{Filter: NotifyInboxes, Events: []NotifyEvent{NotifyMailboxName}},
+	}}
+	if err := spec.Validate(); err != nil {
+		t.Errorf("spec.Validate() = %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+// Package oauth implements the OAUTHBEARER and XOAUTH2 SASL mechanisms, used
+// to authenticate with an OAuth 2.0 bearer token.
+//
+// OAUTHBEARER is defined in RFC 7628. XOAUTH2 is its non-standard predecessor,
+// still required by some providers such as Gmail and Office 365.
+//
+// When authentication fails, the server sends a challenge containing an error
+// in JSON, and the client must answer it with a dummy response before the
+// server ends the command. The clients returned by this package answer such
+// challenges and keep the error, which Client.Authenticate returns instead of
+// the less detailed status of the command.
+package oauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap/internal"
+	"github.com/emersion/go-sasl"
+)
+
+// SASL mechanism names.
+const (
+	OAuthBearer = "OAUTHBEARER"
+	XOAuth2     = "XOAUTH2"
+)
+
+// ErrMalformed is returned by servers if the client response can't be parsed.
+var ErrMalformed = errors.New("oauth: malformed client response")
+
+// Error is an authentication error, sent by the server in a challenge, as
+// defined in RFC 7628 section 3.2.2.
+type Error struct {
+	// The HTTP status or OAuth error code, e.g. "invalid_token" or "401".
+	Status string `json:"status"`
+	// The space-separated authentication schemes supported by the server.
+	Schemes string `json:"schemes,omitempty"`
+	// The scope the token must have.
+	Scope string `json:"scope,omitempty"`
+	// The OpenID Connect discovery document URL.
+	OpenIDConfiguration string `json:"openid-configuration,omitempty"`
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("oauth: authentication failed (%v)", err.Status)
+}
+
+// Options are the credentials sent by a client.
+type Options struct {
+	// The user name. It is optional with OAUTHBEARER, in which case the
+	// identity is derived from the token.
+	Username string
+	// The OAuth 2.0 bearer token.
+	Token string
+	// The host name and port the client connected to. They are only sent
+	// with OAUTHBEARER, and are optional.
+	Host string
+	Port int
+}
+
+// ErrorClient is a SASL client which keeps the error sent by the server.
+type ErrorClient interface {
+	sasl.Client
+
+	// Err returns the error sent by the server, nil if there isn't any.
+	Err() error
+}
+
+type client struct {
+	mech string
+	ir   []byte
+	// The dummy response to an error challenge.
+	ack []byte
+	err error
+}
+
+func (c *client) Start() (mech string, ir []byte, err error) {
+	return c.mech, c.ir, nil
+}
+
+func (c *client) Next(challenge []byte) ([]byte, error) {
+	if c.err != nil {
+		return nil, errors.New("oauth: unexpected challenge after error")
+	}
+
+	oauthErr := new(Error)
+	if err := json.Unmarshal(challenge, oauthErr); err != nil {
+		return nil, fmt.Errorf("oauth: invalid error challenge: %v", err)
+	}
+	c.err = oauthErr
+	return c.ack, nil
+}
+
+func (c *client) Err() error {
+	return c.err
+}
+
+// unescapeSaslName unescapes a name escaped with internal.EscapeSaslName.
+func unescapeSaslName(s string) (string, error) {
+	name, ok := internal.UnescapeSaslName(s)
+	if !ok {
+		return "", ErrMalformed
+	}
+	return name, nil
+}
+
+// NewOAuthBearerClient creates a client for the OAUTHBEARER mechanism.
+func NewOAuthBearerClient(opts *Options) ErrorClient {
+	var b bytes.Buffer
+	b.WriteString("n,")
+	if opts.Username != "" {
+		b.WriteString("a=" + internal.EscapeSaslName(opts.Username))
+	}
+	b.WriteString(",\x01")
+	if opts.Host != "" {
+		b.WriteString("host=" + opts.Host + "\x01")
+	}
+	if opts.Port != 0 {
+		b.WriteString("port=" + strconv.Itoa(opts.Port) + "\x01")
+	}
+	b.WriteString("auth=Bearer " + opts.Token + "\x01\x01")
+
+	return &client{mech: OAuthBearer, ir: b.Bytes(), ack: []byte{0x01}}
+}
+
+// NewXOAuth2Client creates a client for the XOAUTH2 mechanism.
+func NewXOAuth2Client(username, token string) ErrorClient {
+	ir := []byte("user=" + username + "\x01auth=Bearer " + token + "\x01\x01")
+	return &client{mech: XOAuth2, ir: ir, ack: []byte{}}
+}
+
+// Authenticator checks the credentials sent by a client. If it returns an
+// *Error, it is sent to the client, otherwise an "invalid_token" error is
+// sent. In both cases, the error ends the command.
+type Authenticator func(opts *Options) error
+
+type server struct {
+	parse func(response []byte) (*Options, error)
+	auth  Authenticator
+	err   error
+}
+
+func (s *server) Next(response []byte) (challenge []byte, done bool, err error) {
+	if s.err != nil {
+		// The client has answered the error challenge
+		return nil, true, s.err
+	}
+	if response == nil {
+		// Ask for the initial response
+		return []byte{}, false, nil
+	}
+
+	opts, err := s.parse(response)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if err := s.auth(opts); err != nil {
+		oauthErr, ok := err.(*Error)
+		if !ok {
+			oauthErr = &Error{Status: "invalid_token"}
+		}
+		challenge, jsonErr := json.Marshal(oauthErr)
+		if jsonErr != nil {
+			return nil, true, jsonErr
+		}
+		s.err = err
+		return challenge, false, nil
+	}
+	return nil, true, nil
+}
+
+// parseKVPairs parses key-value pairs separated and terminated by ^A, followed
+// by a final ^A.
+func parseKVPairs(s string) (map[string]string, error) {
+	if !strings.HasSuffix(s, "\x01\x01") {
+		return nil, ErrMalformed
+	}
+	s = strings.TrimSuffix(s, "\x01\x01")
+
+	pairs := make(map[string]string)
+	for _, kv := range strings.Split(s, "\x01") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, ErrMalformed
+		}
+		pairs[parts[0]] = parts[1]
+	}
+	return pairs, nil
+}
+
+// parseBearer extracts the token from the value of the auth key.
+func parseBearer(auth string) (string, error) {
+	parts := strings.SplitN(auth, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || parts[1] == "" {
+		return "", ErrMalformed
+	}
+	return parts[1], nil
+}
+
+func parseOAuthBearer(response []byte) (*Options, error) {
+	// The GS2 header: channel binding flag and authorization identity
+	parts := strings.SplitN(string(response), ",", 3)
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	if parts[0] != "n" && parts[0] != "y" {
+		return nil, errors.New("oauth: channel binding not supported")
+	}
+
+	opts := new(Options)
+	if parts[1] != "" {
+		if !strings.HasPrefix(parts[1], "a=") {
+			return nil, ErrMalformed
+		}
+		var err error
+		if opts.Username, err = unescapeSaslName(parts[1][2:]); err != nil {
+			return nil, err
+		}
+	}
+
+	if !strings.HasPrefix(parts[2], "\x01") {
+		return nil, ErrMalformed
+	}
+	pairs, err := parseKVPairs(parts[2][1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Token, err = parseBearer(pairs["auth"]); err != nil {
+		return nil, err
+	}
+	opts.Host = pairs["host"]
+	if port, ok := pairs["port"]; ok {
+		if opts.Port, err = strconv.Atoi(port); err != nil {
+			return nil, ErrMalformed
+		}
+	}
+	return opts, nil
+}
+
+func parseXOAuth2(response []byte) (*Options, error) {
+	pairs, err := parseKVPairs(string(response))
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &Options{Username: pairs["user"]}
+	if opts.Username == "" {
+		return nil, ErrMalformed
+	}
+	if opts.Token, err = parseBearer(pairs["auth"]); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// NewOAuthBearerServer creates a server for the OAUTHBEARER mechanism.
+func NewOAuthBearerServer(auth Authenticator) sasl.Server {
+	return &server{parse: parseOAuthBearer, auth: auth}
+}
+
+// NewXOAuth2Server creates a server for the XOAUTH2 mechanism.
+func NewXOAuth2Server(auth Authenticator) sasl.Server {
+	return &server{parse: parseXOAuth2, auth: auth}
+}
@@ -0,0 +1,155 @@
+package oauth_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/oauth"
+	"github.com/emersion/go-imap/server"
+)
+
+func TestNewOAuthBearerClient(t *testing.T) {
+	c := oauth.NewOAuthBearerClient(&oauth.Options{
+		Username: "user,name",
+		Token:    "vF9dft4qmTc2Nvb3RlckBhbHRhdmlzdGEuY29tCg==",
+		Host:     "server.example.com",
+		Port:     143,
+	})
+
+	mech, ir, err := c.Start()
+	if err != nil {
+		t.Fatal("Start() =", err)
+	}
+	if mech != oauth.OAuthBearer {
+		t.Errorf("Start() returned mechanism %v, want %v", mech, oauth.OAuthBearer)
+	}
+	want := "n,a=user=2Cname,\x01host=server.example.com\x01port=143\x01auth=Bearer vF9dft4qmTc2Nvb3RlckBhbHRhdmlzdGEuY29tCg==\x01\x01"
+	if string(ir) != want {
+		t.Errorf("Start() returned initial response %q, want %q", ir, want)
+	}
+
+	resp, err := c.Next([]byte(`{"status":"invalid_token","scope":"example_scope"}`))
+	if err != nil {
+		t.Fatal("Next() =", err)
+	}
+	if string(resp) != "\x01" {
+		t.Errorf("Next() = %q, want %q", resp, "\x01")
+	}
+	want2 := &oauth.Error{Status: "invalid_token", Scope: "example_scope"}
+	if err := c.Err(); !reflect.DeepEqual(err, want2) {
+		t.Errorf("Err() = %v, want %v", err, want2)
+	}
+}
+
+func TestNewXOAuth2Client(t *testing.T) {
+	c := oauth.NewXOAuth2Client("someuser@example.com", "ya29.vF9dft4qmTc2Nvb3RlckBhdHRhdmlzdGEuY29tCg")
+
+	mech, ir, err := c.Start()
+	if err != nil {
+		t.Fatal("Start() =", err)
+	}
+	if mech != oauth.XOAuth2 {
+		t.Errorf("Start() returned mechanism %v, want %v", mech, oauth.XOAuth2)
+	}
+	want := "user=someuser@example.com\x01auth=Bearer ya29.vF9dft4qmTc2Nvb3RlckBhdHRhdmlzdGEuY29tCg\x01\x01"
+	if string(ir) != want {
+		t.Errorf("Start() returned initial response %q, want %q", ir, want)
+	}
+}
+
+func TestServer_malformed(t *testing.T) {
+	auth := func(opts *oauth.Options) error {
+		t.Error("Authenticator called with a malformed response")
+		return nil
+	}
+
+	for _, resp := range []string{
+		"p=tls-unique,,\x01auth=Bearer token\x01\x01",
+		"n,,\x01auth=Basic token\x01\x01",
+		"n,,\x01auth=Bearer token\x01",
+		"n,a=bad=2name,\x01auth=Bearer token\x01\x01",
+	} {
+		s := oauth.NewOAuthBearerServer(auth)
+		if _, done, err := s.Next([]byte(resp)); err == nil || !done {
+			t.Errorf("Next(%q) = %v, %v, want an error", resp, done, err)
+		}
+	}
+
+	s := oauth.NewXOAuth2Server(auth)
+	if _, done, err := s.Next([]byte("auth=Bearer token\x01\x01")); err == nil || !done {
+		t.Errorf("Next() without user = %v, %v, want an error", done, err)
+	}
+}
+
+type oauthBackend struct {
+	backend.Backend
+}
+
+func (be *oauthBackend) LoginOAuth(username, token string) (backend.User, error) {
+	if token != "valid-token" {
+		return nil, &oauth.Error{Status: "invalid_token", Scope: "mail"}
+	}
+	if username == "" {
+		username = "username"
+	}
+	return be.Login(username, "password")
+}
+
+func testClient(t *testing.T) (*server.Server, *client.Client) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server.New(&oauthBackend{memory.New()})
+	s.AllowInsecureAuth = true
+	go s.Serve(l)
+
+	c, err := client.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+func TestAuthenticate(t *testing.T) {
+	mechs := map[string]func(token string) oauth.ErrorClient{
+		oauth.OAuthBearer: func(token string) oauth.ErrorClient {
+			return oauth.NewOAuthBearerClient(&oauth.Options{Token: token})
+		},
+		oauth.XOAuth2: func(token string) oauth.ErrorClient {
+			return oauth.NewXOAuth2Client("username", token)
+		},
+	}
+
+	for name, newClient := range mechs {
+		t.Run(name, func(t *testing.T) {
+			s, c := testClient(t)
+			defer s.Close()
+			defer c.Logout()
+
+			if ok, err := c.SupportAuth(name); err != nil {
+				t.Fatal("c.SupportAuth() =", err)
+			} else if !ok {
+				t.Fatalf("%v isn't advertised", name)
+			}
+
+			// The error sent by the server is returned
+			err := c.Authenticate(newClient("invalid-token"))
+			if oauthErr, ok := err.(*oauth.Error); !ok || oauthErr.Status != "invalid_token" || oauthErr.Scope != "mail" {
+				t.Fatalf("c.Authenticate() = %v, want an *oauth.Error", err)
+			}
+
+			if err := c.Authenticate(newClient("valid-token")); err != nil {
+				t.Fatal("c.Authenticate() =", err)
+			}
+			if _, err := c.Select("INBOX", true); err != nil {
+				t.Fatal("c.Select() =", err)
+			}
+		})
+	}
+}
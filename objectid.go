@@ -0,0 +1,29 @@
+package imap
+
+import (
+	"errors"
+)
+
+// ParseObjectId parses an object ID enclosed in parentheses, as used by the
+// MAILBOXID, EMAILID and THREADID items defined in RFC 8474. NIL is parsed as
+// an empty string.
+func ParseObjectId(f interface{}) (string, error) {
+	if f == nil {
+		return "", nil
+	}
+
+	l, ok := f.([]interface{})
+	if !ok || len(l) != 1 {
+		return "", errors.New("Object ID is not a list with a single item")
+	}
+	return ParseString(l[0])
+}
+
+// FormatObjectId formats an object ID enclosed in parentheses. An empty ID is
+// formatted as NIL.
+func FormatObjectId(id string) interface{} {
+	if id == "" {
+		return nil
+	}
+	return []interface{}{id}
+}
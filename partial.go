@@ -0,0 +1,74 @@
+package imap
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// PartialRange is a range of messages requested with PARTIAL, as defined in
+// RFC 9394 section 3.1. Positions are 1-based indexes in the ordered list of
+// matching messages. Negative positions count from the end of the list: -1 is
+// the last message. Both positions have the same sign and First is the
+// closest to the start (or to the end for negative positions) of the list.
+type PartialRange struct {
+	First int32
+	Last  int32
+}
+
+// ParsePartialRange parses a range such as "1:100" or "-1:-100".
+func ParsePartialRange(s string) (*PartialRange, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("Invalid partial range: missing colon")
+	}
+
+	var bounds [2]int32
+	for i, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 32)
+		if err != nil {
+			return nil, errors.New("Invalid partial range: " + err.Error())
+		}
+		if n == 0 {
+			return nil, errors.New("Invalid partial range: zero position")
+		}
+		bounds[i] = int32(n)
+	}
+	if (bounds[0] < 0) != (bounds[1] < 0) {
+		return nil, errors.New("Invalid partial range: positions have different signs")
+	}
+
+	r := &PartialRange{First: bounds[0], Last: bounds[1]}
+	if abs32(r.First) > abs32(r.Last) {
+		r.First, r.Last = r.Last, r.First
+	}
+	return r, nil
+}
+
+func abs32(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (r *PartialRange) String() string {
+	return strconv.Itoa(int(r.First)) + ":" + strconv.Itoa(int(r.Last))
+}
+
+// Apply returns the elements of ids in the range. ids must be sorted.
+func (r *PartialRange) Apply(ids []uint32) []uint32 {
+	n := len(ids)
+	first, last := int(abs32(r.First)), int(abs32(r.Last))
+	if first > n {
+		return nil
+	}
+	if last > n {
+		last = n
+	}
+
+	if r.First < 0 {
+		return ids[n-last : n-first+1]
+	}
+	return ids[first-1 : last]
+}
@@ -0,0 +1,63 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePartialRange(t *testing.T) {
+	tests := []struct {
+		s    string
+		want *PartialRange
+	}{
+		{"1:100", &PartialRange{First: 1, Last: 100}},
+		{"100:1", &PartialRange{First: 1, Last: 100}},
+		{"-1:-30", &PartialRange{First: -1, Last: -30}},
+		{"-30:-1", &PartialRange{First: -1, Last: -30}},
+		{"1", nil},
+		{"0:10", nil},
+		{"1:-10", nil},
+		{"a:b", nil},
+	}
+
+	for _, test := range tests {
+		r, err := ParsePartialRange(test.s)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("Expected an error when parsing %q", test.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Cannot parse %q: %v", test.s, err)
+		} else if !reflect.DeepEqual(r, test.want) {
+			t.Errorf("Invalid range for %q: got %v but expected %v", test.s, r, test.want)
+		}
+	}
+
+	if r, _ := ParsePartialRange("-30:-1"); r.String() != "-1:-30" {
+		t.Errorf("Invalid formatted range: got %q", r.String())
+	}
+}
+
+func TestPartialRange_Apply(t *testing.T) {
+	ids := []uint32{2, 4, 6, 8, 10}
+
+	tests := []struct {
+		r    PartialRange
+		want []uint32
+	}{
+		{PartialRange{1, 2}, []uint32{2, 4}},
+		{PartialRange{4, 100}, []uint32{8, 10}},
+		{PartialRange{6, 10}, nil},
+		{PartialRange{-1, -2}, []uint32{8, 10}},
+		{PartialRange{-3, -100}, []uint32{2, 4, 6}},
+		{PartialRange{-6, -10}, nil},
+	}
+
+	for _, test := range tests {
+		if got := test.r.Apply(ids); len(got) != len(test.want) || (len(got) > 0 && !reflect.DeepEqual(got, test.want)) {
+			t.Errorf("Invalid result for %v: got %v but expected %v", test.r.String(), got, test.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package imap
+
+import (
+	"errors"
+)
+
+// QResyncParams are the parameters of the QRESYNC SELECT parameter, as defined
+// in RFC 7162 section 3.2.5. They describe the state of the mailbox cached by
+// the client.
+type QResyncParams struct {
+	// The last known UIDVALIDITY of the mailbox.
+	UidValidity uint32
+	// The last known mod-sequence of the mailbox.
+	ModSeq uint64
+	// The UIDs known by the client. If nil, all UIDs are assumed to be known.
+	KnownUids *SeqSet
+
+	// KnownSeqNums and KnownSeqUids are the message sequence number and UID
+	// match data. They allow the server to compute a smaller set of expunged
+	// messages. Both must be set or unset, and must have the same number of
+	// messages.
+	KnownSeqNums *SeqSet
+	KnownSeqUids *SeqSet
+}
+
+// Format formats QRESYNC parameters to fields.
+func (p *QResyncParams) Format() []interface{} {
+	fields := []interface{}{p.UidValidity, p.ModSeq}
+	if p.KnownUids != nil {
+		fields = append(fields, p.KnownUids)
+		if p.KnownSeqNums != nil && p.KnownSeqUids != nil {
+			fields = append(fields, []interface{}{p.KnownSeqNums, p.KnownSeqUids})
+		}
+	}
+	return fields
+}
+
+// Parse parses QRESYNC parameters from fields.
+func (p *QResyncParams) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("QRESYNC parameters must contain UIDVALIDITY and MODSEQ")
+	}
+
+	var err error
+	if p.UidValidity, err = ParseNumber(fields[0]); err != nil {
+		return err
+	}
+	if p.ModSeq, err = ParseNumber64(fields[1]); err != nil {
+		return err
+	}
+
+	p.KnownUids, p.KnownSeqNums, p.KnownSeqUids = nil, nil, nil
+	if len(fields) > 2 {
+		if p.KnownUids, err = parseSeqSetField(fields[2]); err != nil {
+			return err
+		}
+	}
+	if len(fields) > 3 {
+		match, ok := fields[3].([]interface{})
+		if !ok || len(match) != 2 {
+			return errors.New("QRESYNC sequence match data must be a list of two sets")
+		}
+		if p.KnownSeqNums, err = parseSeqSetField(match[0]); err != nil {
+			return err
+		}
+		if p.KnownSeqUids, err = parseSeqSetField(match[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseSeqSetField(f interface{}) (*SeqSet, error) {
+	s, err := ParseString(f)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSeqSet(s)
+}
@@ -0,0 +1,56 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQResyncParams_Format(t *testing.T) {
+	uids, _ := ParseSeqSet("41,43:211,214:541")
+	seqNums, _ := ParseSeqSet("1:5,7,9")
+	seqUids, _ := ParseSeqSet("41,43,45,47,50,52,54")
+	params := &QResyncParams{
+		UidValidity:  67890007,
+		ModSeq:       20050715194045000,
+		KnownUids:    uids,
+		KnownSeqNums: seqNums,
+		KnownSeqUids: seqUids,
+	}
+
+	w, b := newWriter()
+	if err := w.writeField(params.Format()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "(67890007 20050715194045000 41,43:211,214:541 (1:5,7,9 41,43,45,47,50,52,54))"
+	if b.String() != want {
+		t.Errorf("Invalid formatted QRESYNC parameters: got %q but expected %q", b.String(), want)
+	}
+}
+
+func TestQResyncParams_Parse(t *testing.T) {
+	fields := []interface{}{"67890007", "20050715194045000", "41,43:211", []interface{}{"1:2", "41,43"}}
+
+	params := new(QResyncParams)
+	if err := params.Parse(fields); err != nil {
+		t.Fatal("Cannot parse QRESYNC parameters:", err)
+	}
+
+	uids, _ := ParseSeqSet("41,43:211")
+	seqNums, _ := ParseSeqSet("1:2")
+	seqUids, _ := ParseSeqSet("41,43")
+	want := &QResyncParams{
+		UidValidity:  67890007,
+		ModSeq:       20050715194045000,
+		KnownUids:    uids,
+		KnownSeqNums: seqNums,
+		KnownSeqUids: seqUids,
+	}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("Invalid parsed QRESYNC parameters: got %+v but expected %+v", params, want)
+	}
+
+	if err := params.Parse([]interface{}{"67890007"}); err == nil {
+		t.Error("Expected an error when parsing QRESYNC parameters without MODSEQ")
+	}
+}
@@ -0,0 +1,113 @@
+package imap
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Quota resources, as defined in RFC 9208 section 5.
+const (
+	// The sum of the sizes of messages, in units of 1024 octets.
+	QuotaStorage = "STORAGE"
+	// The number of messages.
+	QuotaMessage = "MESSAGE"
+	// The number of mailboxes.
+	QuotaMailbox = "MAILBOX"
+	// The sum of the sizes of annotations, in units of 1024 octets.
+	QuotaAnnotationStorage = "ANNOTATION-STORAGE"
+)
+
+// QuotaResource is the usage and limit of a resource in a quota root.
+type QuotaResource struct {
+	Usage uint64
+	Limit uint64
+}
+
+// Quota is the status of a quota root, as returned in a QUOTA response. See
+// RFC 9208 section 4.1.
+type Quota struct {
+	// The quota root name.
+	Root string
+	// The resources limited by this quota root, by resource name.
+	Resources map[string]*QuotaResource
+}
+
+// Format formats the quota resources to a list. Resources are sorted by name.
+func (quota *Quota) Format() []interface{} {
+	names := make([]string, 0, len(quota.Resources))
+	for name := range quota.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]interface{}, 0, 3*len(names))
+	for _, name := range names {
+		res := quota.Resources[name]
+		fields = append(fields, name, res.Usage, res.Limit)
+	}
+	return fields
+}
+
+// Parse parses a list of quota resources.
+func (quota *Quota) Parse(fields []interface{}) error {
+	if len(fields)%3 != 0 {
+		return errors.New("Quota resources list must contain triples")
+	}
+
+	quota.Resources = make(map[string]*QuotaResource, len(fields)/3)
+	for i := 0; i < len(fields); i += 3 {
+		name, ok := fields[i].(string)
+		if !ok {
+			return errors.New("Quota resource name must be an atom")
+		}
+
+		res := new(QuotaResource)
+		var err error
+		if res.Usage, err = ParseNumber64(fields[i+1]); err != nil {
+			return err
+		}
+		if res.Limit, err = ParseNumber64(fields[i+2]); err != nil {
+			return err
+		}
+		quota.Resources[strings.ToUpper(name)] = res
+	}
+	return nil
+}
+
+// FormatQuotaLimits formats quota limits, as sent with SETQUOTA. Resources are
+// sorted by name.
+func FormatQuotaLimits(limits map[string]uint64) []interface{} {
+	names := make([]string, 0, len(limits))
+	for name := range limits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]interface{}, 0, 2*len(names))
+	for _, name := range names {
+		fields = append(fields, name, limits[name])
+	}
+	return fields
+}
+
+// ParseQuotaLimits parses quota limits, as sent with SETQUOTA.
+func ParseQuotaLimits(fields []interface{}) (map[string]uint64, error) {
+	if len(fields)%2 != 0 {
+		return nil, errors.New("Quota limits list must have an even number of fields")
+	}
+
+	limits := make(map[string]uint64, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		name, ok := fields[i].(string)
+		if !ok {
+			return nil, errors.New("Quota resource name must be an atom")
+		}
+		limit, err := ParseNumber64(fields[i+1])
+		if err != nil {
+			return nil, err
+		}
+		limits[strings.ToUpper(name)] = limit
+	}
+	return limits, nil
+}
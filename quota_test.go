@@ -0,0 +1,52 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	quota := &Quota{
+		Root: "",
+		Resources: map[string]*QuotaResource{
+			QuotaStorage: {Usage: 10, Limit: 512},
+			QuotaMessage: {Usage: 3, Limit: 5000000000},
+		},
+	}
+
+	fields := quota.Format()
+	want := []interface{}{"MESSAGE", uint64(3), uint64(5000000000), "STORAGE", uint64(10), uint64(512)}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("Quota.Format() = %v, want %v", fields, want)
+	}
+
+	parsed := new(Quota)
+	if err := parsed.Parse([]interface{}{"storage", "10", "512", "MESSAGE", "3", "5000000000"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed.Resources, quota.Resources) {
+		t.Errorf("Quota.Parse() = %v, want %v", parsed.Resources, quota.Resources)
+	}
+
+	if err := parsed.Parse([]interface{}{"STORAGE", "10"}); err == nil {
+		t.Error("Expected an error for an incomplete resource")
+	}
+}
+
+func TestQuotaLimits(t *testing.T) {
+	limits := map[string]uint64{QuotaStorage: 512, QuotaMessage: 1000}
+
+	fields := FormatQuotaLimits(limits)
+	want := []interface{}{"MESSAGE", uint64(1000), "STORAGE", uint64(512)}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("FormatQuotaLimits() = %v, want %v", fields, want)
+	}
+
+	parsed, err := ParseQuotaLimits([]interface{}{"message", "1000", "STORAGE", "512"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, limits) {
+		t.Errorf("ParseQuotaLimits() = %v, want %v", parsed, limits)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"io/ioutil"
 	"strconv"
 	"strings"
 )
@@ -13,8 +14,10 @@ const (
 	cr            = '\r'
 	lf            = '\n'
 	dquote        = '"'
+	literal8Start = '~'
 	literalStart  = '{'
 	literalEnd    = '}'
+	literalPlus   = '+'
 	listStart     = '('
 	listEnd       = ')'
 	respCodeStart = '['
@@ -26,6 +29,17 @@ const (
 	nilAtom = "NIL"
 )
 
+const (
+	// maxListDepth is the maximum number of nested lists in a line. Real
+	// responses never come close, this prevents malformed ones from exhausting
+	// the stack.
+	maxListDepth = 100
+	// maxLiteralPrealloc is the maximum number of bytes allocated before
+	// reading a literal. Larger literals grow as data is received, so that a
+	// bogus literal length doesn't exhaust memory.
+	maxLiteralPrealloc = 64 * 1024
+)
+
 // TODO: add CTL to atomSpecials
 var (
 	quotedSpecials = string([]rune{dquote, '\\'})
@@ -33,6 +47,11 @@ var (
 	atomSpecials   = string([]rune{listStart, listEnd, literalStart, sp, '%', '*'}) + quotedSpecials + respSpecials
 )
 
+// ErrLiteralDesync is returned by Reader.DiscardLiteral when the contents of a
+// literal which couldn't be read can't be skipped either. The rest of the
+// stream can't be parsed.
+var ErrLiteralDesync = errors.New("imap: literal not fully read; connection desynchronized")
+
 type parseError struct {
 	error
 }
@@ -69,9 +88,9 @@ func ParseNumber(f interface{}) (uint32, error) {
 		return n, nil
 	}
 
-	s, ok := f.(string)
-	if !ok {
-		return 0, newParseError("expected a number, got a non-atom")
+	s, err := parseNumberString(f)
+	if err != nil {
+		return 0, err
 	}
 
 	nbr, err := strconv.ParseUint(s, 10, 32)
@@ -82,13 +101,55 @@ func ParseNumber(f interface{}) (uint32, error) {
 	return uint32(nbr), nil
 }
 
+// ParseNumber64 parses a 64-bit number, such as a mod-sequence defined in RFC
+// 7162.
+func ParseNumber64(f interface{}) (uint64, error) {
+	if n, ok := f.(uint64); ok {
+		return n, nil
+	}
+
+	s, err := parseNumberString(f)
+	if err != nil {
+		return 0, err
+	}
+
+	nbr, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, &parseError{err}
+	}
+
+	return nbr, nil
+}
+
+// parseNumberString returns the string representation of a number, which is
+// either an atom or, for some broken servers, a literal.
+func parseNumberString(f interface{}) (string, error) {
+	switch f := f.(type) {
+	case string:
+		return f, nil
+	case Literal:
+		return ParseString(f)
+	}
+	return "", newParseError("expected a number, got a non-atom")
+}
+
 // ParseString parses a string, which is either a literal, a quoted string or an
 // atom.
+//
+// Literals kept in memory, such as the ones returned by Reader, are not
+// consumed and can be parsed again. Other literals are read.
 func ParseString(f interface{}) (string, error) {
 	if s, ok := f.(string); ok {
 		return s, nil
 	}
 
+	if b, ok := f.(interface {
+		Literal
+		Bytes() []byte
+	}); ok {
+		return string(b.Bytes()), nil
+	}
+
 	if l, ok := f.(Literal); ok {
 		b := make([]byte, l.Len())
 		if _, err := io.ReadFull(l, b); err != nil {
@@ -124,6 +185,22 @@ func trimSuffix(str string, suffix rune) string {
 // An IMAP reader.
 type Reader struct {
 	MaxLiteralSize uint32 // The maximum literal size.
+	// The maximum size of non-synchronizing literals, as defined in RFC 7888.
+	// Zero means that the size is only limited by MaxLiteralSize.
+	MaxNonSyncLiteralSize uint32
+	// StreamLiteral, if not nil, is called before reading the contents of a
+	// literal which directly follows an atom in a list of the current line,
+	// such as a body section in a FETCH response. line contains the fields of
+	// the line read so far, the list excluded. If it returns a writer, the
+	// contents of the literal are copied to it instead of being kept in
+	// memory, MaxLiteralSize doesn't apply and the field is nil.
+	StreamLiteral func(line []interface{}, name string, size int64) io.Writer
+	// CheckLiteral, if not nil, is called before accepting a literal, with the
+	// fields of the current line read so far, lists excluded. If it returns an
+	// error, no continuation request is sent and reading the line fails with
+	// this error. The literal and the rest of the line must then be skipped
+	// with DiscardLiteral and DiscardLine.
+	CheckLiteral func(line []interface{}, size int64) error
 
 	reader
 
@@ -131,6 +208,13 @@ type Reader struct {
 
 	brackets   int
 	inRespCode bool
+	depth      int
+
+	// The number of bytes of the last literal which haven't been read.
+	unreadLiteral int64
+	// The fields of the current line, maintained if StreamLiteral or
+	// CheckLiteral is set.
+	line []interface{}
 }
 
 func (r *Reader) ReadSp() error {
@@ -167,7 +251,7 @@ func (r *Reader) ReadCrlf() (err error) {
 func (r *Reader) ReadAtom() (interface{}, error) {
 	r.brackets = 0
 
-	var atom string
+	var buf bytes.Buffer
 	for {
 		char, _, err := r.ReadRune()
 		if err != nil {
@@ -198,18 +282,57 @@ func (r *Reader) ReadAtom() (interface{}, error) {
 			r.brackets++
 		}
 
-		atom += string(char)
+		buf.WriteRune(char)
 	}
 
 	r.UnreadRune()
 
+	atom := buf.String()
 	if atom == "NIL" {
 		return nil, nil
 	}
 	return atom, nil
 }
 
+// readLiteral8OrAtom reads either a literal8 or an atom starting with a tilde.
+// name is passed to readLiteral.
+func (r *Reader) readLiteral8OrAtom(name string) (interface{}, error) {
+	if _, _, err := r.ReadRune(); err != nil {
+		return nil, err
+	}
+	char, _, err := r.ReadRune()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.UnreadRune(); err != nil {
+		return nil, err
+	}
+
+	if char == literalStart {
+		l, err := r.readLiteral(name)
+		if l == nil {
+			return nil, err
+		}
+		return Literal8{l}, err
+	}
+
+	atom, err := r.ReadAtom()
+	if err != nil {
+		return nil, err
+	}
+	if atom == nil {
+		return string(literal8Start) + "NIL", nil
+	}
+	return string(literal8Start) + atom.(string), nil
+}
+
 func (r *Reader) ReadLiteral() (Literal, error) {
+	return r.readLiteral("")
+}
+
+// readLiteral reads a literal. If name isn't empty, the literal follows this
+// atom and may be streamed with StreamLiteral, in which case nil is returned.
+func (r *Reader) readLiteral(name string) (Literal, error) {
 	char, _, err := r.ReadRune()
 	if err != nil {
 		return nil, err
@@ -222,29 +345,105 @@ func (r *Reader) ReadLiteral() (Literal, error) {
 		return nil, err
 	}
 	lstr = trimSuffix(lstr, literalEnd)
+	nonSync := strings.HasSuffix(lstr, string(literalPlus))
+	if nonSync {
+		lstr = trimSuffix(lstr, literalPlus)
+	}
 	n, err := strconv.ParseUint(lstr, 10, 32)
 	if err != nil {
 		return nil, newParseError("cannot parse literal length: " + err.Error())
 	}
-	if r.MaxLiteralSize > 0 && uint32(n) > r.MaxLiteralSize {
-		return nil, newParseError("literal exceeding maximum size")
-	}
-
 	if err := r.ReadCrlf(); err != nil {
 		return nil, err
 	}
 
+	if r.CheckLiteral != nil {
+		if err := r.CheckLiteral(r.line, int64(n)); err != nil {
+			if r.continues == nil || nonSync {
+				// The literal will be sent anyway, it needs to be discarded
+				r.unreadLiteral = int64(n)
+			}
+			return nil, err
+		}
+	}
+
+	if name != "" && r.StreamLiteral != nil {
+		if w := r.StreamLiteral(r.line, name, int64(n)); w != nil {
+			if r.continues != nil && !nonSync {
+				r.continues <- true
+			}
+			if copied, err := io.CopyN(w, r, int64(n)); err != nil {
+				r.unreadLiteral = int64(n) - copied
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+			return nil, nil
+		}
+	}
+
+	tooBig := r.MaxLiteralSize > 0 && uint32(n) > r.MaxLiteralSize
+	if nonSync && r.MaxNonSyncLiteralSize > 0 && uint32(n) > r.MaxNonSyncLiteralSize {
+		tooBig = true
+	}
+	if tooBig {
+		if r.continues == nil || nonSync {
+			// The literal will be sent anyway, it needs to be discarded
+			r.unreadLiteral = int64(n)
+		}
+		return nil, newParseError("literal exceeding maximum size")
+	}
+
 	// Send continuation request if necessary
-	if r.continues != nil {
+	if r.continues != nil && !nonSync {
 		r.continues <- true
 	}
 
 	// Read literal
-	b := make([]byte, n)
-	if _, err := io.ReadFull(r, b); err != nil {
+	prealloc := n
+	if prealloc > maxLiteralPrealloc {
+		prealloc = maxLiteralPrealloc
+	}
+	b := bytes.NewBuffer(make([]byte, 0, prealloc))
+	if copied, err := io.CopyN(b, r, int64(n)); err != nil {
+		r.unreadLiteral = int64(n) - copied
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
 		return nil, err
 	}
-	return bytes.NewBuffer(b), nil
+	return b, nil
+}
+
+// DiscardLiteral skips the contents of the last literal if ReadLiteral failed
+// before reading all of them, e.g. because it exceeded MaxLiteralSize. This
+// allows to keep reading the stream after an error. If the literal can't be
+// skipped, ErrLiteralDesync is returned.
+func (r *Reader) DiscardLiteral() error {
+	if r.unreadLiteral == 0 {
+		return nil
+	}
+
+	n := r.unreadLiteral
+	r.unreadLiteral = 0
+	if _, err := io.CopyN(ioutil.Discard, r, n); err != nil {
+		return ErrLiteralDesync
+	}
+	return nil
+}
+
+// DiscardLine skips the rest of the current line, e.g. after a parse error, so
+// that the next line can be read. DiscardLiteral must be called first if a
+// literal couldn't be read.
+func (r *Reader) DiscardLine() error {
+	// The parse error may have been caused by the line feed itself. This fails
+	// if the last character hasn't been read with ReadRune, in which case it
+	// wasn't a line feed.
+	r.UnreadRune()
+
+	_, err := r.ReadString(lf)
+	return err
 }
 
 func (r *Reader) ReadQuotedString() (string, error) {
@@ -295,11 +494,19 @@ func (r *Reader) ReadFields() (fields []interface{}, err error) {
 			return
 		}
 
+		// The name of the atom preceding a literal which may be streamed
+		var name string
+		if r.StreamLiteral != nil && r.depth == 1 && len(fields) > 0 {
+			name, _ = fields[len(fields)-1].(string)
+		}
+
 		var field interface{}
 		ok := true
 		switch char {
 		case literalStart:
-			field, err = r.ReadLiteral()
+			field, err = r.readLiteral(name)
+		case literal8Start:
+			field, err = r.readLiteral8OrAtom(name)
 		case dquote:
 			field, err = r.ReadQuotedString()
 		case listStart:
@@ -317,6 +524,9 @@ func (r *Reader) ReadFields() (fields []interface{}, err error) {
 		}
 		if ok {
 			fields = append(fields, field)
+			if (r.StreamLiteral != nil || r.CheckLiteral != nil) && r.depth == 0 && !r.inRespCode {
+				r.line = append(r.line, field)
+			}
 		}
 
 		if char, _, err = r.ReadRune(); err != nil {
@@ -346,7 +556,13 @@ func (r *Reader) ReadList() (fields []interface{}, err error) {
 		return
 	}
 
+	if r.depth >= maxListDepth {
+		err = newParseError("lists are nested too deeply")
+		return
+	}
+	r.depth++
 	fields, err = r.ReadFields()
+	r.depth--
 	if err != nil {
 		return
 	}
@@ -362,6 +578,12 @@ func (r *Reader) ReadList() (fields []interface{}, err error) {
 }
 
 func (r *Reader) ReadLine() (fields []interface{}, err error) {
+	r.line = nil
+	return r.readLine()
+}
+
+// readLine reads the rest of the current line.
+func (r *Reader) readLine() (fields []interface{}, err error) {
 	fields, err = r.ReadFields()
 	if err != nil {
 		return
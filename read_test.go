@@ -2,6 +2,7 @@ package imap_test
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
 	"reflect"
@@ -22,6 +23,7 @@ func TestParseNumber(t *testing.T) {
 		{f: "1.2", err: true},
 		{f: nil, err: true},
 		{f: bytes.NewBufferString("cc"), err: true},
+		{f: bytes.NewBufferString("42"), n: 42},
 	}
 
 	for _, test := range tests {
@@ -40,6 +42,19 @@ func TestParseNumber(t *testing.T) {
 	}
 }
 
+func TestParseString_literal(t *testing.T) {
+	l := bytes.NewBufferString("Hello World")
+
+	// The literal can be parsed several times
+	for i := 0; i < 2; i++ {
+		if s, err := imap.ParseString(l); err != nil {
+			t.Fatalf("imap.ParseString() = %v", err)
+		} else if s != "Hello World" {
+			t.Errorf("Invalid parsed string #%v: got %q but expected %q", i, s, "Hello World")
+		}
+	}
+}
+
 func TestParseStringList(t *testing.T) {
 	tests := []struct {
 		field interface{}
@@ -246,6 +261,177 @@ func TestReader_ReadLiteral(t *testing.T) {
 	}
 }
 
+func TestReader_ReadLiteral_NonSync(t *testing.T) {
+	continues := make(chan bool, 1)
+	r := imap.NewServerReader(bytes.NewBufferString("{7+}\r\nabcdefg"), continues)
+	if literal, err := r.ReadLiteral(); err != nil {
+		t.Fatal(err)
+	} else if contents, _ := ioutil.ReadAll(literal); string(contents) != "abcdefg" {
+		t.Error("Literal has not the expected value:", string(contents))
+	}
+	if len(continues) > 0 {
+		t.Error("A continuation request has been sent for a non-synchronizing literal")
+	}
+
+	// Rejected non-synchronizing literals are sent anyway
+	r = imap.NewServerReader(bytes.NewBufferString("{7+}\r\nabcdefg\r\n"), continues)
+	r.MaxNonSyncLiteralSize = 4
+	if _, err := r.ReadLiteral(); err == nil {
+		t.Fatal("Non-synchronizing literal exceeding maximum size didn't fail")
+	}
+	if err := r.DiscardLiteral(); err != nil {
+		t.Fatal("Cannot discard literal:", err)
+	}
+	if err := r.ReadCrlf(); err != nil {
+		t.Error("Literal has not been discarded:", err)
+	}
+
+	// The limit doesn't apply to synchronizing literals
+	r = imap.NewServerReader(bytes.NewBufferString("{7}\r\nabcdefg"), continues)
+	r.MaxNonSyncLiteralSize = 4
+	if _, err := r.ReadLiteral(); err != nil {
+		t.Fatal(err)
+	}
+	if len(continues) != 1 {
+		t.Error("No continuation request has been sent for a synchronizing literal")
+	}
+}
+
+func TestReader_DiscardLiteral(t *testing.T) {
+	_, r := newReader("{7}\r\nabcdefg\r\n")
+	r.MaxLiteralSize = 4
+	if _, err := r.ReadLiteral(); err == nil {
+		t.Fatal("Literal exceeding maximum size didn't fail")
+	}
+	if err := r.DiscardLiteral(); err != nil {
+		t.Fatal("Cannot discard literal:", err)
+	}
+	if err := r.ReadCrlf(); err != nil {
+		t.Error("Literal has not been discarded:", err)
+	}
+
+	// Nothing to discard
+	if err := r.DiscardLiteral(); err != nil {
+		t.Error("Cannot discard literal:", err)
+	}
+
+	_, r = newReader("{7}\r\nabc")
+	r.MaxLiteralSize = 4
+	if _, err := r.ReadLiteral(); err == nil {
+		t.Fatal("Literal exceeding maximum size didn't fail")
+	}
+	if err := r.DiscardLiteral(); err != imap.ErrLiteralDesync {
+		t.Errorf("DiscardLiteral() = %v, want %v", err, imap.ErrLiteralDesync)
+	}
+}
+
+func TestReader_StreamLiteral(t *testing.T) {
+	_, r := newReader("* 2 FETCH (UID 42 BODY[] {16}\r\nI love potatoes. BODY[HEADER] {3}\r\nabc)\r\n")
+	r.MaxLiteralSize = 8
+
+	var buf bytes.Buffer
+	r.StreamLiteral = func(line []interface{}, name string, size int64) io.Writer {
+		if len(line) != 2 || line[0] != "2" || line[1] != "FETCH" {
+			t.Errorf("Invalid line: %v", line)
+		}
+		if name != "BODY[]" {
+			return nil
+		}
+		if size != 16 {
+			t.Errorf("Invalid literal size: %v", size)
+		}
+		return &buf
+	}
+
+	resp, err := imap.ReadResp(r)
+	if err != nil {
+		t.Fatal("ReadResp() =", err)
+	}
+	if buf.String() != "I love potatoes." {
+		t.Errorf("Invalid streamed literal: %q", buf.String())
+	}
+
+	fields := resp.(*imap.DataResp).Fields[2].([]interface{})
+	if len(fields) != 6 {
+		t.Fatalf("Expected 6 fields, but got %v", len(fields))
+	}
+	if fields[3] != nil {
+		t.Errorf("Streamed literal field is %v, want nil", fields[3])
+	}
+	if l, ok := fields[5].(imap.Literal); !ok {
+		t.Errorf("Field 6 is a %T, not a literal", fields[5])
+	} else if b, _ := ioutil.ReadAll(l); string(b) != "abc" {
+		t.Errorf("Invalid literal contents: %q", b)
+	}
+}
+
+func TestReader_CheckLiteral(t *testing.T) {
+	continues := make(chan bool, 1)
+	r := imap.NewServerReader(bytes.NewBufferString("a1 APPEND INBOX {7}\r\na2 APPEND Drafts {3+}\r\nabc\r\n"), continues)
+
+	errRejected := errors.New("rejected")
+	r.CheckLiteral = func(line []interface{}, size int64) error {
+		if len(line) != 3 || line[0] != "a1" || line[1] != "APPEND" || line[2] != "INBOX" {
+			t.Errorf("Invalid line: %v", line)
+		}
+		if size != 7 {
+			t.Errorf("Invalid literal size: %v", size)
+		}
+		return errRejected
+	}
+
+	if _, err := r.ReadLine(); err != errRejected {
+		t.Fatalf("ReadLine() = %v, want %v", err, errRejected)
+	}
+	if len(continues) > 0 {
+		t.Error("A continuation request has been sent for a rejected literal")
+	}
+	if err := r.DiscardLiteral(); err != nil {
+		t.Fatal("Cannot discard literal:", err)
+	}
+	if err := r.DiscardLine(); err != nil {
+		t.Fatal("Cannot discard line:", err)
+	}
+
+	// Only the fields of the current line are passed
+	r.CheckLiteral = func(line []interface{}, size int64) error {
+		if len(line) != 3 || line[0] != "a2" || line[2] != "Drafts" {
+			t.Errorf("Invalid line: %v", line)
+		}
+		return nil
+	}
+	if fields, err := r.ReadLine(); err != nil {
+		t.Fatal("ReadLine() =", err)
+	} else if len(fields) != 4 {
+		t.Errorf("Expected 4 fields, but got %v", len(fields))
+	}
+}
+
+func TestReader_DiscardLine(t *testing.T) {
+	_, r := newReader("(abc\r\n* OK\r\n")
+	if _, err := r.ReadFields(); err == nil {
+		t.Fatal("Invalid read didn't fail")
+	}
+	if err := r.DiscardLine(); err != nil {
+		t.Fatal("Cannot discard line:", err)
+	}
+	if s, err := r.ReadString('\n'); err != nil || s != "* OK\r\n" {
+		t.Errorf("Read %q after discarding line, want %q", s, "* OK\r\n")
+	}
+
+	// The line feed caused the error
+	_, r = newReader("\n* OK\r\n")
+	if err := r.ReadSp(); err == nil {
+		t.Fatal("Invalid read didn't fail")
+	}
+	if err := r.DiscardLine(); err != nil {
+		t.Fatal("Cannot discard line:", err)
+	}
+	if s, err := r.ReadString('\n'); err != nil || s != "* OK\r\n" {
+		t.Errorf("Read %q after discarding line, want %q", s, "* OK\r\n")
+	}
+}
+
 func TestReader_ReadQuotedString(t *testing.T) {
 	b, r := newReader("\"hello gopher\"\r\n")
 	if s, err := r.ReadQuotedString(); err != nil {
@@ -289,6 +475,28 @@ func TestReader_ReadQuotedString(t *testing.T) {
 	}
 }
 
+func TestReader_ReadFields_Literal8(t *testing.T) {
+	_, r := newReader("~{11}\r\nhello\x00world ~atom\r\n")
+	fields, err := r.ReadFields()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 {
+		t.Fatal("Expected 2 fields, but got", len(fields))
+	}
+
+	l, ok := fields[0].(imap.Literal8)
+	if !ok {
+		t.Fatalf("Field 1 is a %T, not a literal8", fields[0])
+	}
+	if b, _ := ioutil.ReadAll(l); string(b) != "hello\x00world" {
+		t.Errorf("Invalid literal8 contents: %q", b)
+	}
+	if s, ok := fields[1].(string); !ok || s != "~atom" {
+		t.Error("Field 2 has not the expected value:", fields[1])
+	}
+}
+
 func TestReader_ReadFields(t *testing.T) {
 	b, r := newReader("field1 \"field2\"\r\n")
 	if fields, err := r.ReadFields(); err != nil {
@@ -1,6 +1,8 @@
 package imap
 
 import (
+	"bufio"
+	"io/ioutil"
 	"strings"
 )
 
@@ -12,6 +14,8 @@ type Resp interface {
 
 // ReadResp reads a single response from a Reader.
 func ReadResp(r *Reader) (Resp, error) {
+	r.line = nil
+
 	atom, err := r.ReadAtom()
 	if err != nil {
 		return nil, err
@@ -61,19 +65,18 @@ func ReadResp(r *Reader) (Resp, error) {
 					}
 					r.UnreadRune()
 
-					if char == '[' {
-						// Contains code & arguments
-						resp.Code, resp.Arguments, err = r.ReadRespCode()
-						if err != nil {
-							return nil, err
-						}
-					}
-
-					resp.Info, err = r.ReadInfo()
+					info, err := r.ReadInfo()
 					if err != nil {
 						return nil, err
 					}
 
+					if char == '[' {
+						// Contains code & arguments
+						resp.Code, resp.Arguments, resp.Info = parseRespCode(info)
+					} else {
+						resp.Info = info
+					}
+
 					return resp, nil
 				}
 			}
@@ -87,8 +90,12 @@ func ReadResp(r *Reader) (Resp, error) {
 	// Not a status so it's data
 	resp := &DataResp{Tag: tag}
 
+	if r.StreamLiteral != nil {
+		r.line = append(r.line, fields...)
+	}
+
 	var remaining []interface{}
-	remaining, err = r.ReadLine()
+	remaining, err = r.readLine()
 	if err != nil {
 		return nil, err
 	}
@@ -97,6 +104,37 @@ func ReadResp(r *Reader) (Resp, error) {
 	return resp, nil
 }
 
+// parseRespCode parses the response code at the beginning of the text of a
+// status response. Codes unknown to this package are returned as-is, so that
+// they can be inspected by callers.
+//
+// A malformed response code never prevents the text from being parsed: if the
+// code arguments cannot be parsed, they are returned as a single string. If
+// the code isn't terminated by a closing bracket, the whole line is returned as
+// the text.
+func parseRespCode(line string) (code StatusRespCode, args []interface{}, info string) {
+	r := NewReader(bufio.NewReader(strings.NewReader(line)))
+	if code, args, err := r.ReadRespCode(); err == nil {
+		rest, _ := ioutil.ReadAll(r)
+		return code, args, strings.TrimLeft(string(rest), " ")
+	}
+
+	end := strings.IndexRune(line, respCodeEnd)
+	if end < 0 {
+		return "", nil, line
+	}
+
+	fields := strings.SplitN(strings.TrimSpace(line[1:end]), " ", 2)
+	if fields[0] == "" {
+		return "", nil, line
+	}
+	code = StatusRespCode(strings.ToUpper(fields[0]))
+	if len(fields) > 1 {
+		args = []interface{}{fields[1]}
+	}
+	return code, args, strings.TrimLeft(line[end+1:], " ")
+}
+
 // DataResp is an IMAP response containing data.
 type DataResp struct {
 	// The response tag. Can be either "" for untagged responses, "+" for continuation
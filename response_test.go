@@ -182,6 +182,71 @@ func TestReadResp_StatusResp(t *testing.T) {
 				Info:      "LOGIN completed",
 			},
 		},
+		{
+			input: "* OK [X-VENDOR-THING foo (bar 42)] Vendor specific\r\n",
+			expected: &imap.StatusResp{
+				Tag:       "*",
+				Type:      imap.StatusRespOk,
+				Code:      "X-VENDOR-THING",
+				Arguments: []interface{}{"foo", []interface{}{"bar", "42"}},
+				Info:      "Vendor specific",
+			},
+		},
+		{
+			input: "a001 NO [x-unknown] Lowercase code\r\n",
+			expected: &imap.StatusResp{
+				Tag:  "a001",
+				Type: imap.StatusRespNo,
+				Code: "X-UNKNOWN",
+				Info: "Lowercase code",
+			},
+		},
+		{
+			input: "* OK [ALERT]\r\n",
+			expected: &imap.StatusResp{
+				Tag:  "*",
+				Type: imap.StatusRespOk,
+				Code: imap.CodeAlert,
+			},
+		},
+		{
+			// Malformed arguments are kept as a string
+			input: "* OK [X-BROKEN \"unterminated] Still readable\r\n",
+			expected: &imap.StatusResp{
+				Tag:       "*",
+				Type:      imap.StatusRespOk,
+				Code:      "X-BROKEN",
+				Arguments: []interface{}{"\"unterminated"},
+				Info:      "Still readable",
+			},
+		},
+		{
+			input: "* OK [X-BROKEN (a b] Still readable\r\n",
+			expected: &imap.StatusResp{
+				Tag:       "*",
+				Type:      imap.StatusRespOk,
+				Code:      "X-BROKEN",
+				Arguments: []interface{}{"(a b"},
+				Info:      "Still readable",
+			},
+		},
+		{
+			// Without a closing bracket, the whole line is the text
+			input: "* NO [UNCLOSED code\r\n",
+			expected: &imap.StatusResp{
+				Tag:  "*",
+				Type: imap.StatusRespNo,
+				Info: "[UNCLOSED code",
+			},
+		},
+		{
+			input: "* BAD [] Empty code\r\n",
+			expected: &imap.StatusResp{
+				Tag:  "*",
+				Type: imap.StatusRespBad,
+				Info: "[] Empty code",
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -207,7 +272,7 @@ func TestReadResp_StatusResp(t *testing.T) {
 		if status.Code != test.expected.Code {
 			t.Errorf("Invalid code: expected %v but got %v", status.Code, test.expected.Code)
 		}
-		if len(status.Arguments) != len(test.expected.Arguments) {
+		if len(status.Arguments) != len(test.expected.Arguments) || (len(status.Arguments) > 0 && !reflect.DeepEqual(status.Arguments, test.expected.Arguments)) {
 			t.Errorf("Invalid arguments: expected %v but got %v", status.Arguments, test.expected.Arguments)
 		}
 		if status.Info != test.expected.Info {
@@ -216,6 +281,30 @@ func TestReadResp_StatusResp(t *testing.T) {
 	}
 }
 
+func TestReadResp_StatusResp_malformedCode(t *testing.T) {
+	// A malformed response code must not prevent reading the next responses
+	b := bytes.NewBufferString("* OK [X-BROKEN \"a (b] Text\r\n* NO [UNCLOSED\r\n* 3 EXISTS\r\n")
+	r := imap.NewReader(b)
+
+	for i := 0; i < 2; i++ {
+		resp, err := imap.ReadResp(r)
+		if err != nil {
+			t.Fatalf("Cannot read response #%v: %v", i, err)
+		}
+		if _, ok := resp.(*imap.StatusResp); !ok {
+			t.Fatalf("Response #%v is not a status: %v", i, resp)
+		}
+	}
+
+	resp, err := imap.ReadResp(r)
+	if err != nil {
+		t.Fatal("Cannot read response:", err)
+	}
+	if name, fields, ok := imap.ParseNamedResp(resp); !ok || name != "EXISTS" || len(fields) != 1 {
+		t.Errorf("Invalid response: %v", resp)
+	}
+}
+
 func TestParseNamedResp(t *testing.T) {
 	tests := []struct{
 		resp *imap.DataResp
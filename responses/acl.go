@@ -0,0 +1,159 @@
+package responses
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/emersion/go-imap"
+)
+
+const (
+	aclName        = "ACL"
+	listRightsName = "LISTRIGHTS"
+	myRightsName   = "MYRIGHTS"
+)
+
+func parseACLMailbox(f interface{}) (string, error) {
+	mailbox, err := imap.ParseString(f)
+	if err != nil {
+		return "", err
+	}
+	if mailbox, err = imap.DecodeMailboxName(mailbox); err != nil {
+		return "", err
+	}
+	return imap.CanonicalMailboxName(mailbox), nil
+}
+
+func parseACLRights(f interface{}) (imap.ACLRights, error) {
+	rights, err := imap.ParseString(f)
+	return imap.ACLRights(rights), err
+}
+
+// An ACL response. Rights maps identifiers to their rights.
+// See RFC 4314 section 3.6
+type ACL struct {
+	Mailbox string
+	Rights  map[string]imap.ACLRights
+}
+
+func (r *ACL) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != aclName {
+		return ErrUnhandled
+	} else if len(fields) < 1 {
+		return errNotEnoughFields
+	} else if len(fields)%2 != 1 {
+		return errors.New("ACL response must contain identifier and rights pairs")
+	}
+
+	var err error
+	if r.Mailbox, err = parseACLMailbox(fields[0]); err != nil {
+		return err
+	}
+
+	r.Rights = make(map[string]imap.ACLRights, len(fields)/2)
+	for i := 1; i < len(fields); i += 2 {
+		identifier, err := imap.ParseString(fields[i])
+		if err != nil {
+			return err
+		}
+		if r.Rights[identifier], err = parseACLRights(fields[i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ACL) WriteTo(w *imap.Writer) error {
+	mailbox := imap.FormatMailboxName(r.Mailbox)
+
+	identifiers := make([]string, 0, len(r.Rights))
+	for identifier := range r.Rights {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+
+	fields := []interface{}{aclName, mailbox}
+	for _, identifier := range identifiers {
+		fields = append(fields, identifier, string(r.Rights[identifier]))
+	}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
+
+// A LISTRIGHTS response. Required rights are always granted to the identifier,
+// each set of optional rights can be granted independently.
+// See RFC 4314 section 3.7
+type ListRights struct {
+	Mailbox    string
+	Identifier string
+	Required   imap.ACLRights
+	Optional   []imap.ACLRights
+}
+
+func (r *ListRights) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != listRightsName {
+		return ErrUnhandled
+	} else if len(fields) < 3 {
+		return errNotEnoughFields
+	}
+
+	var err error
+	if r.Mailbox, err = parseACLMailbox(fields[0]); err != nil {
+		return err
+	}
+	if r.Identifier, err = imap.ParseString(fields[1]); err != nil {
+		return err
+	}
+	if r.Required, err = parseACLRights(fields[2]); err != nil {
+		return err
+	}
+
+	r.Optional = make([]imap.ACLRights, len(fields)-3)
+	for i, f := range fields[3:] {
+		if r.Optional[i], err = parseACLRights(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ListRights) WriteTo(w *imap.Writer) error {
+	mailbox := imap.FormatMailboxName(r.Mailbox)
+
+	fields := []interface{}{listRightsName, mailbox, r.Identifier, string(r.Required)}
+	for _, rights := range r.Optional {
+		fields = append(fields, string(rights))
+	}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
+
+// A MYRIGHTS response.
+// See RFC 4314 section 3.8
+type MyRights struct {
+	Mailbox string
+	Rights  imap.ACLRights
+}
+
+func (r *MyRights) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != myRightsName {
+		return ErrUnhandled
+	} else if len(fields) < 2 {
+		return errNotEnoughFields
+	}
+
+	var err error
+	if r.Mailbox, err = parseACLMailbox(fields[0]); err != nil {
+		return err
+	}
+	r.Rights, err = parseACLRights(fields[1])
+	return err
+}
+
+func (r *MyRights) WriteTo(w *imap.Writer) error {
+	mailbox := imap.FormatMailboxName(r.Mailbox)
+
+	fields := []interface{}{myRightsName, mailbox, string(r.Rights)}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
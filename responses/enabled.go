@@ -0,0 +1,36 @@
+package responses
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+const enabledName = "ENABLED"
+
+// An ENABLED response.
+// See RFC 5161 section 3.2
+type Enabled struct {
+	Caps []string
+}
+
+func (r *Enabled) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != enabledName {
+		return ErrUnhandled
+	}
+
+	caps, err := imap.ParseStringList(fields)
+	if err != nil {
+		return err
+	}
+	r.Caps = append(r.Caps, caps...)
+	return nil
+}
+
+func (r *Enabled) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{enabledName}
+	for _, cap := range r.Caps {
+		fields = append(fields, cap)
+	}
+
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
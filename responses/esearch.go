@@ -0,0 +1,237 @@
+package responses
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+const esearchName = "ESEARCH"
+
+// An ESEARCH response.
+// See RFC 4731 section 3.1
+//
+// Tag is the tag of the command the response is returned for. Options contains
+// the returned items, it is used when writing the response to know whether
+// COUNT must be sent if it is zero.
+//
+// Responses containing ADDTO or REMOVEFROM report changes to a result kept
+// updated with the UPDATE return option, they are sent after the command has
+// completed, see RFC 5267 section 4.3. They are only handled if Updates is
+// set, and only them.
+type ESearch struct {
+	Tag     string
+	Uid     bool
+	Options []string
+	Result  *imap.SearchResult
+	Updates bool
+}
+
+func (r *ESearch) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != esearchName {
+		return ErrUnhandled
+	}
+
+	r.Tag, r.Uid, r.Options = "", false, nil
+	r.Result = new(imap.SearchResult)
+
+	// Search correlator
+	if len(fields) > 0 {
+		if l, ok := fields[0].([]interface{}); ok {
+			if len(l) != 2 {
+				return errors.New("Invalid ESEARCH correlator")
+			} else if name, ok := l[0].(string); !ok || strings.ToUpper(name) != "TAG" {
+				return errors.New("Invalid ESEARCH correlator")
+			}
+			tag, err := imap.ParseString(l[1])
+			if err != nil {
+				return err
+			}
+			r.Tag = tag
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields) > 0 {
+		if s, ok := fields[0].(string); ok && strings.ToUpper(s) == "UID" {
+			r.Uid = true
+			fields = fields[1:]
+		}
+	}
+
+	if len(fields)%2 != 0 {
+		return errors.New("ESEARCH return data must contain pairs")
+	}
+	if isESearchUpdate(fields) != r.Updates {
+		return ErrUnhandled
+	}
+	for i := 0; i < len(fields); i += 2 {
+		name, ok := fields[i].(string)
+		if !ok {
+			return errors.New("ESEARCH return data name must be an atom")
+		}
+		name = strings.ToUpper(name)
+
+		var err error
+		switch name {
+		case imap.SearchReturnMin:
+			r.Result.Min, err = imap.ParseNumber(fields[i+1])
+		case imap.SearchReturnMax:
+			r.Result.Max, err = imap.ParseNumber(fields[i+1])
+		case imap.SearchReturnCount:
+			r.Result.Count, err = imap.ParseNumber(fields[i+1])
+		case imap.SearchReturnAll:
+			if s, ok := fields[i+1].(string); !ok {
+				err = errors.New("ESEARCH ALL must be a sequence set")
+			} else {
+				r.Result.All, err = imap.ParseSeqSet(s)
+			}
+		case imap.SearchReturnPartial:
+			r.Result.PartialRange, r.Result.Partial, err = parsePartial(fields[i+1])
+		case imap.SearchAddTo:
+			r.Result.AddTo, err = parseContextUpdates(fields[i+1])
+		case imap.SearchRemoveFrom:
+			r.Result.RemoveFrom, err = parseContextUpdates(fields[i+1])
+		case "MODSEQ":
+			r.Result.ModSeq, err = imap.ParseNumber64(fields[i+1])
+		default:
+			// Ignore unknown return data, defined by other extensions
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		r.Options = append(r.Options, name)
+	}
+
+	return nil
+}
+
+func (r *ESearch) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{esearchName}
+	if r.Tag != "" {
+		fields = append(fields, []interface{}{"TAG", imap.Quoted(r.Tag)})
+	}
+	if r.Uid {
+		fields = append(fields, "UID")
+	}
+
+	res := r.Result
+	for _, opt := range r.Options {
+		switch opt {
+		case imap.SearchReturnMin:
+			if res.Min > 0 {
+				fields = append(fields, opt, res.Min)
+			}
+		case imap.SearchReturnMax:
+			if res.Max > 0 {
+				fields = append(fields, opt, res.Max)
+			}
+		case imap.SearchReturnAll:
+			if res.All != nil && !res.All.Empty() {
+				fields = append(fields, opt, res.All)
+			}
+		case imap.SearchReturnCount:
+			fields = append(fields, opt, res.Count)
+		case imap.SearchReturnPartial:
+			if res.PartialRange != nil {
+				var set interface{}
+				if res.Partial != nil && !res.Partial.Empty() {
+					set = res.Partial
+				}
+				fields = append(fields, opt, []interface{}{res.PartialRange.String(), set})
+			}
+		case imap.SearchRemoveFrom:
+			if len(res.RemoveFrom) > 0 {
+				fields = append(fields, opt, formatContextUpdates(res.RemoveFrom))
+			}
+		case imap.SearchAddTo:
+			if len(res.AddTo) > 0 {
+				fields = append(fields, opt, formatContextUpdates(res.AddTo))
+			}
+		}
+	}
+	if res.ModSeq > 0 {
+		fields = append(fields, "MODSEQ", res.ModSeq)
+	}
+
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
+
+// parsePartial parses PARTIAL return data, as defined in RFC 9394 section
+// 3.1.
+func parsePartial(f interface{}) (*imap.PartialRange, *imap.SeqSet, error) {
+	l, ok := f.([]interface{})
+	if !ok || len(l) != 2 {
+		return nil, nil, errors.New("ESEARCH PARTIAL must be a list of a range and a sequence set")
+	}
+
+	s, ok := l[0].(string)
+	if !ok {
+		return nil, nil, errors.New("ESEARCH PARTIAL range must be an atom")
+	}
+	r, err := imap.ParsePartialRange(s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if l[1] == nil {
+		return r, nil, nil
+	}
+	if s, ok = l[1].(string); !ok {
+		return nil, nil, errors.New("ESEARCH PARTIAL must contain a sequence set")
+	}
+	set, err := imap.ParseSeqSet(s)
+	return r, set, err
+}
+
+// isESearchUpdate checks if ESEARCH return data reports changes to a result
+// kept updated, as defined in RFC 5267 section 4.3.
+func isESearchUpdate(fields []interface{}) bool {
+	for i := 0; i < len(fields); i += 2 {
+		if name, ok := fields[i].(string); ok {
+			name = strings.ToUpper(name)
+			if name == imap.SearchAddTo || name == imap.SearchRemoveFrom {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseContextUpdates parses ADDTO or REMOVEFROM return data, a list of
+// positions and sequence sets.
+func parseContextUpdates(f interface{}) ([]imap.SearchContextUpdate, error) {
+	l, ok := f.([]interface{})
+	if !ok || len(l)%2 != 0 {
+		return nil, errors.New("ESEARCH ADDTO and REMOVEFROM must be a list of positions and sequence sets")
+	}
+
+	updates := make([]imap.SearchContextUpdate, 0, len(l)/2)
+	for i := 0; i < len(l); i += 2 {
+		pos, err := imap.ParseNumber(l[i])
+		if err != nil {
+			return nil, err
+		}
+		s, ok := l[i+1].(string)
+		if !ok {
+			return nil, errors.New("ESEARCH ADDTO and REMOVEFROM must contain sequence sets")
+		}
+		ids, err := imap.ParseSeqSet(s)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, imap.SearchContextUpdate{Position: pos, Ids: ids})
+	}
+	return updates, nil
+}
+
+func formatContextUpdates(updates []imap.SearchContextUpdate) []interface{} {
+	l := make([]interface{}, 0, 2*len(updates))
+	for _, u := range updates {
+		l = append(l, u.Position, u.Ids)
+	}
+	return l
+}
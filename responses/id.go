@@ -0,0 +1,31 @@
+package responses
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+const idName = "ID"
+
+// An ID response.
+// See RFC 2971 section 3.2
+type ID struct {
+	ID map[string]string
+}
+
+func (r *ID) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != idName {
+		return ErrUnhandled
+	} else if len(fields) < 1 {
+		return errNotEnoughFields
+	}
+
+	var err error
+	r.ID, err = imap.ParseID(fields[0])
+	return err
+}
+
+func (r *ID) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{idName, imap.FormatID(r.ID)}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
@@ -0,0 +1,61 @@
+package responses
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+const metadataName = "METADATA"
+
+// A METADATA response. An empty Mailbox refers to server entries. Unsolicited
+// METADATA responses, which only contain entry names, are not handled.
+// See RFC 5464 section 4.4
+type Metadata struct {
+	Mailbox string
+	Entries map[string]*string
+}
+
+func (r *Metadata) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != metadataName {
+		return ErrUnhandled
+	} else if len(fields) < 2 {
+		return errNotEnoughFields
+	}
+
+	if _, ok := fields[1].([]interface{}); !ok {
+		// Unsolicited response listing changed entries
+		return ErrUnhandled
+	}
+
+	mailbox, err := imap.ParseString(fields[0])
+	if err != nil {
+		return err
+	}
+	if mailbox, err = imap.DecodeMailboxName(mailbox); err != nil {
+		return err
+	}
+	if mailbox != "" {
+		mailbox = imap.CanonicalMailboxName(mailbox)
+	}
+
+	entries, err := imap.ParseMetadata(fields[1])
+	if err != nil {
+		return err
+	}
+
+	// Several responses can be sent for a single command
+	if r.Entries == nil || r.Mailbox != mailbox {
+		r.Entries = make(map[string]*string, len(entries))
+	}
+	r.Mailbox = mailbox
+	for k, v := range entries {
+		r.Entries[k] = v
+	}
+	return nil
+}
+
+func (r *Metadata) WriteTo(w *imap.Writer) error {
+	mailbox := imap.FormatQuotedMailboxName(r.Mailbox)
+	fields := []interface{}{metadataName, mailbox, imap.FormatMetadata(r.Entries)}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
@@ -0,0 +1,44 @@
+package responses
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+const namespaceName = "NAMESPACE"
+
+// A NAMESPACE response.
+// See RFC 2342 section 5
+type Namespace struct {
+	Personal []*imap.Namespace
+	Other    []*imap.Namespace
+	Shared   []*imap.Namespace
+}
+
+func (r *Namespace) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != namespaceName {
+		return ErrUnhandled
+	} else if len(fields) < 3 {
+		return errNotEnoughFields
+	}
+
+	var err error
+	if r.Personal, err = imap.ParseNamespaces(fields[0]); err != nil {
+		return err
+	}
+	if r.Other, err = imap.ParseNamespaces(fields[1]); err != nil {
+		return err
+	}
+	r.Shared, err = imap.ParseNamespaces(fields[2])
+	return err
+}
+
+func (r *Namespace) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{
+		namespaceName,
+		imap.FormatNamespaces(r.Personal),
+		imap.FormatNamespaces(r.Other),
+		imap.FormatNamespaces(r.Shared),
+	}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
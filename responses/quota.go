@@ -0,0 +1,97 @@
+package responses
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+const (
+	quotaName     = "QUOTA"
+	quotaRootName = "QUOTAROOT"
+)
+
+// A QUOTA response. Quotas from several responses are accumulated.
+// See RFC 9208 section 5.1
+type Quota struct {
+	Quotas []*imap.Quota
+}
+
+func (r *Quota) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != quotaName {
+		return ErrUnhandled
+	} else if len(fields) < 2 {
+		return errNotEnoughFields
+	}
+
+	quota := new(imap.Quota)
+	var err error
+	if quota.Root, err = imap.ParseString(fields[0]); err != nil {
+		return err
+	}
+
+	resources, ok := fields[1].([]interface{})
+	if !ok {
+		return errors.New("QUOTA resources must be a list")
+	}
+	if err := quota.Parse(resources); err != nil {
+		return err
+	}
+
+	r.Quotas = append(r.Quotas, quota)
+	return nil
+}
+
+func (r *Quota) WriteTo(w *imap.Writer) error {
+	for _, quota := range r.Quotas {
+		fields := []interface{}{quotaName, imap.Quoted(quota.Root), quota.Format()}
+		if err := imap.NewUntaggedResp(fields).WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A QUOTAROOT response.
+// See RFC 9208 section 5.2
+type QuotaRoot struct {
+	Mailbox string
+	Roots   []string
+}
+
+func (r *QuotaRoot) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != quotaRootName {
+		return ErrUnhandled
+	} else if len(fields) < 1 {
+		return errNotEnoughFields
+	}
+
+	if mailbox, err := imap.ParseString(fields[0]); err != nil {
+		return err
+	} else if mailbox, err := imap.DecodeMailboxName(mailbox); err != nil {
+		return err
+	} else {
+		r.Mailbox = imap.CanonicalMailboxName(mailbox)
+	}
+
+	r.Roots = make([]string, len(fields)-1)
+	for i, f := range fields[1:] {
+		var err error
+		if r.Roots[i], err = imap.ParseString(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *QuotaRoot) WriteTo(w *imap.Writer) error {
+	mailbox := imap.FormatMailboxName(r.Mailbox)
+
+	fields := []interface{}{quotaRootName, mailbox}
+	for _, root := range r.Roots {
+		fields = append(fields, imap.Quoted(root))
+	}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
@@ -1,6 +1,9 @@
 package responses
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/emersion/go-imap"
 )
 
@@ -8,8 +11,12 @@ const searchName = "SEARCH"
 
 // A SEARCH response.
 // See RFC 3501 section 7.2.5
+//
+// ModSeq is the highest mod-sequence of the returned messages, sent when the
+// search criteria contain MODSEQ. See RFC 7162 section 3.1.5.
 type Search struct {
-	Ids []uint32
+	Ids    []uint32
+	ModSeq uint64
 }
 
 func (r *Search) Handle(resp imap.Resp) error {
@@ -18,6 +25,23 @@ func (r *Search) Handle(resp imap.Resp) error {
 		return ErrUnhandled
 	}
 
+	r.ModSeq = 0
+	if len(fields) > 0 {
+		if l, ok := fields[len(fields)-1].([]interface{}); ok {
+			fields = fields[:len(fields)-1]
+			if len(l) != 2 {
+				return errors.New("Invalid SEARCH MODSEQ")
+			} else if name, ok := l[0].(string); !ok || strings.ToUpper(name) != "MODSEQ" {
+				return errors.New("Invalid SEARCH MODSEQ")
+			}
+			modSeq, err := imap.ParseNumber64(l[1])
+			if err != nil {
+				return err
+			}
+			r.ModSeq = modSeq
+		}
+	}
+
 	r.Ids = make([]uint32, len(fields))
 	for i, f := range fields {
 		if id, err := imap.ParseNumber(f); err != nil {
@@ -35,6 +59,9 @@ func (r *Search) WriteTo(w *imap.Writer) (err error) {
 	for _, id := range r.Ids {
 		fields = append(fields, id)
 	}
+	if r.ModSeq > 0 {
+		fields = append(fields, []interface{}{"MODSEQ", r.ModSeq})
+	}
 
 	resp := imap.NewUntaggedResp(fields)
 	return resp.WriteTo(w)
@@ -6,6 +6,25 @@ import (
 	"github.com/emersion/go-imap"
 )
 
+// ParseFlagList parses a FLAGS or PERMANENTFLAGS list. Flags are kept
+// verbatim, including TryCreateFlag and keywords such as $Forwarded. Invalid
+// items are skipped instead of discarding the whole list. nil is returned if f
+// isn't a list.
+func ParseFlagList(f interface{}) []string {
+	fields, ok := f.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	flags := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if flag, err := imap.ParseString(f); err == nil {
+			flags = append(flags, flag)
+		}
+	}
+	return flags
+}
+
 // A SELECT response.
 type Select struct {
 	Mailbox *imap.MailboxStatus
@@ -26,9 +45,15 @@ func (r *Select) Handle(resp imap.Resp) error {
 			return errNotEnoughFields
 		}
 
-		flags, _ := fields[0].([]interface{})
-		mbox.Flags, _ = imap.ParseStringList(flags)
+		mbox.Flags = ParseFlagList(fields[0])
 	case *imap.StatusResp:
+		if resp.Code == imap.CodeNoModSeq {
+			mbox.HighestModSeq = 0
+			mbox.ItemsLocker.Lock()
+			mbox.Items[imap.StatusHighestModSeq] = nil
+			mbox.ItemsLocker.Unlock()
+			return nil
+		}
 		if len(resp.Arguments) < 1 {
 			return ErrUnhandled
 		}
@@ -38,14 +63,19 @@ func (r *Select) Handle(resp imap.Resp) error {
 		case "UNSEEN":
 			mbox.UnseenSeqNum, _ = imap.ParseNumber(resp.Arguments[0])
 		case "PERMANENTFLAGS":
-			flags, _ := resp.Arguments[0].([]interface{})
-			mbox.PermanentFlags, _ = imap.ParseStringList(flags)
+			mbox.PermanentFlags = ParseFlagList(resp.Arguments[0])
 		case "UIDNEXT":
 			mbox.UidNext, _ = imap.ParseNumber(resp.Arguments[0])
 			item = imap.StatusUidNext
 		case "UIDVALIDITY":
 			mbox.UidValidity, _ = imap.ParseNumber(resp.Arguments[0])
 			item = imap.StatusUidValidity
+		case "HIGHESTMODSEQ":
+			mbox.HighestModSeq, _ = imap.ParseNumber64(resp.Arguments[0])
+			item = imap.StatusHighestModSeq
+		case "MAILBOXID":
+			mbox.MailboxId, _ = imap.ParseObjectId(resp.Arguments[0])
+			item = imap.StatusMailboxId
 		default:
 			return ErrUnhandled
 		}
@@ -135,6 +165,34 @@ func (r *Select) WriteTo(w *imap.Writer) error {
 			if err := statusRes.WriteTo(w); err != nil {
 				return err
 			}
+		case imap.StatusHighestModSeq:
+			statusRes := &imap.StatusResp{
+				Type:      imap.StatusRespOk,
+				Code:      imap.CodeHighestModSeq,
+				Arguments: []interface{}{mbox.HighestModSeq},
+				Info:      "Highest mod-sequence",
+			}
+			if mbox.HighestModSeq == 0 {
+				statusRes.Code = imap.CodeNoModSeq
+				statusRes.Arguments = nil
+				statusRes.Info = "Sorry, this mailbox format doesn't support modsequences"
+			}
+			if err := statusRes.WriteTo(w); err != nil {
+				return err
+			}
+		case imap.StatusMailboxId:
+			if mbox.MailboxId == "" {
+				break
+			}
+			statusRes := &imap.StatusResp{
+				Type:      imap.StatusRespOk,
+				Code:      imap.CodeMailboxId,
+				Arguments: []interface{}{imap.FormatObjectId(mbox.MailboxId)},
+				Info:      "Mailbox ID",
+			}
+			if err := statusRes.WriteTo(w); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -4,7 +4,6 @@ import (
 	"errors"
 
 	"github.com/emersion/go-imap"
-	"github.com/emersion/go-imap/utf7"
 )
 
 const statusName = "STATUS"
@@ -30,7 +29,7 @@ func (r *Status) Handle(resp imap.Resp) error {
 
 	if name, err := imap.ParseString(fields[0]); err != nil {
 		return err
-	} else if name, err := utf7.Encoding.NewDecoder().String(name); err != nil {
+	} else if name, err := imap.DecodeMailboxName(name); err != nil {
 		return err
 	} else {
 		mbox.Name = imap.CanonicalMailboxName(name)
@@ -51,7 +50,7 @@ func (r *Status) Handle(resp imap.Resp) error {
 
 func (r *Status) WriteTo(w *imap.Writer) error {
 	mbox := r.Mailbox
-	name, _ := utf7.Encoding.NewEncoder().String(mbox.Name)
+	name := imap.FormatMailboxName(mbox.Name)
 	fields := []interface{}{statusName, name, mbox.Format()}
 	return imap.NewUntaggedResp(fields).WriteTo(w)
 }
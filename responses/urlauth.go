@@ -0,0 +1,95 @@
+package responses
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/emersion/go-imap"
+)
+
+const (
+	genURLAuthName = "GENURLAUTH"
+	urlFetchName   = "URLFETCH"
+)
+
+// A GENURLAUTH response.
+// See RFC 4467 section 8
+type GenURLAuth struct {
+	URLs []string
+}
+
+func (r *GenURLAuth) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != genURLAuthName {
+		return ErrUnhandled
+	}
+
+	urls, err := imap.ParseStringList(fields)
+	if err != nil {
+		return err
+	}
+	r.URLs = append(r.URLs, urls...)
+	return nil
+}
+
+func (r *GenURLAuth) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{genURLAuthName}
+	for _, url := range r.URLs {
+		fields = append(fields, imap.Quoted(url))
+	}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
+
+// An URLFETCH response. Data maps URLs to the data they reference, a nil value
+// means that the URL is invalid. URLs is the order in which they are written.
+// See RFC 4467 section 8
+type URLFetch struct {
+	URLs []string
+	Data map[string]imap.Literal
+}
+
+func (r *URLFetch) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != urlFetchName {
+		return ErrUnhandled
+	} else if len(fields)%2 != 0 {
+		return errors.New("URLFETCH response must contain URL and data pairs")
+	}
+
+	if r.Data == nil {
+		r.Data = make(map[string]imap.Literal)
+	}
+	for i := 0; i < len(fields); i += 2 {
+		url, err := imap.ParseString(fields[i])
+		if err != nil {
+			return err
+		}
+
+		var data imap.Literal
+		switch f := fields[i+1].(type) {
+		case nil:
+		case imap.Literal:
+			data = f
+		case string:
+			data = bytes.NewBufferString(f)
+		default:
+			return errors.New("URLFETCH data must be a string")
+		}
+
+		r.URLs = append(r.URLs, url)
+		r.Data[url] = data
+	}
+	return nil
+}
+
+func (r *URLFetch) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{urlFetchName}
+	for _, url := range r.URLs {
+		var v interface{}
+		if data := r.Data[url]; data != nil {
+			v = data
+		}
+		fields = append(fields, imap.Quoted(url), v)
+	}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
@@ -0,0 +1,59 @@
+package responses
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-imap"
+)
+
+const vanishedName = "VANISHED"
+
+// A VANISHED response, sent instead of EXPUNGE once QRESYNC is enabled. If
+// Earlier is true, the messages may have been expunged before the current
+// session.
+// See RFC 7162 section 3.2.10
+type Vanished struct {
+	Earlier bool
+	Uids    *imap.SeqSet
+}
+
+func (r *Vanished) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != vanishedName {
+		return ErrUnhandled
+	}
+
+	r.Earlier = false
+	if len(fields) > 0 {
+		if tag, ok := fields[0].([]interface{}); ok {
+			if len(tag) != 1 {
+				return errors.New("Invalid VANISHED tag")
+			} else if s, ok := tag[0].(string); !ok || strings.ToUpper(s) != "EARLIER" {
+				return errors.New("Invalid VANISHED tag")
+			}
+			r.Earlier = true
+			fields = fields[1:]
+		}
+	}
+	if len(fields) < 1 {
+		return errNotEnoughFields
+	}
+
+	s, err := imap.ParseString(fields[0])
+	if err != nil {
+		return err
+	}
+	r.Uids, err = imap.ParseSeqSet(s)
+	return err
+}
+
+func (r *Vanished) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{vanishedName}
+	if r.Earlier {
+		fields = append(fields, []interface{}{"EARLIER"})
+	}
+	fields = append(fields, r.Uids)
+
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
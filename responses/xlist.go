@@ -0,0 +1,48 @@
+package responses
+
+import (
+	"github.com/emersion/go-imap"
+)
+
+const xlistName = "XLIST"
+
+// An XLIST response, returned by legacy servers for the XLIST command. XLIST
+// attributes are converted to the special-use attributes defined in RFC 6154
+// when handling the response, and back when writing it. See
+// imap.FromXListAttrs.
+type XList struct {
+	Mailboxes chan *imap.MailboxInfo
+}
+
+func (r *XList) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != xlistName {
+		return ErrUnhandled
+	}
+
+	mbox := &imap.MailboxInfo{}
+	if err := mbox.Parse(fields); err != nil {
+		return err
+	}
+	mbox.Attributes = imap.FromXListAttrs(mbox.Attributes)
+
+	r.Mailboxes <- mbox
+	return nil
+}
+
+func (r *XList) WriteTo(w *imap.Writer) error {
+	for mbox := range r.Mailboxes {
+		info := *mbox
+		info.Attributes = imap.ToXListAttrs(mbox.Attributes)
+
+		fields := []interface{}{xlistName}
+		fields = append(fields, info.Format()...)
+
+		resp := imap.NewUntaggedResp(fields)
+		if err := resp.WriteTo(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
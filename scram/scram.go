@@ -0,0 +1,481 @@
+// Package scram implements the SCRAM-SHA-256 and SCRAM-SHA-256-PLUS SASL
+// mechanisms, as defined in RFC 5802 and RFC 7677.
+//
+// SCRAM authenticates the client without sending the password, and the
+// server without storing it: servers only keep Credentials derived from the
+// password. The -PLUS variant binds the authentication to the TLS connection,
+// so that it can't be relayed by a man in the middle.
+package scram
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap/internal"
+	"github.com/emersion/go-sasl"
+	"golang.org/x/text/secure/precis"
+)
+
+// SASL mechanism names.
+const (
+	SHA256     = "SCRAM-SHA-256"
+	SHA256Plus = "SCRAM-SHA-256-PLUS"
+)
+
+// DefaultIterations is the number of iterations used by NewCredentials if
+// none is specified, as recommended by RFC 7677.
+const DefaultIterations = 4096
+
+var (
+	// ErrMalformed is returned if a message can't be parsed.
+	ErrMalformed = errors.New("scram: malformed message")
+	// ErrInvalidProof is returned by servers if the client doesn't know the
+	// password.
+	ErrInvalidProof = errors.New("scram: invalid client proof")
+	// ErrInvalidSignature is returned by clients if the server doesn't know
+	// the credentials of the user.
+	ErrInvalidSignature = errors.New("scram: invalid server signature")
+	// ErrChannelBinding is returned if channel binding is missing or doesn't
+	// match the TLS connection.
+	ErrChannelBinding = errors.New("scram: channel binding mismatch")
+)
+
+const (
+	nonceLen = 18
+	saltLen  = 16
+)
+
+// ChannelBinding is the channel binding data of a TLS connection, as defined
+// in RFC 5056.
+type ChannelBinding struct {
+	// The channel binding type, e.g. "tls-exporter".
+	Type string
+	Data []byte
+}
+
+// TLSChannelBinding returns the channel binding of a TLS connection:
+// tls-exporter, defined in RFC 9266, for TLS 1.3 and tls-unique, defined in
+// RFC 5929, for earlier versions. Both ends of the connection compute the same
+// data.
+func TLSChannelBinding(cs *tls.ConnectionState) (*ChannelBinding, error) {
+	if cs.Version >= tls.VersionTLS13 {
+		data, err := cs.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+		if err != nil {
+			return nil, err
+		}
+		return &ChannelBinding{Type: "tls-exporter", Data: data}, nil
+	}
+
+	if len(cs.TLSUnique) == 0 {
+		return nil, errors.New("scram: channel binding not available")
+	}
+	return &ChannelBinding{Type: "tls-unique", Data: cs.TLSUnique}, nil
+}
+
+// Credentials are the data a server stores instead of the password of a user.
+type Credentials struct {
+	Salt       []byte
+	Iterations int
+	StoredKey  []byte
+	ServerKey  []byte
+}
+
+// NewCredentials derives credentials from a password, with a random salt. If
+// iterations is zero, DefaultIterations is used.
+func NewCredentials(password string, iterations int) (*Credentials, error) {
+	if iterations <= 0 {
+		iterations = DefaultIterations
+	}
+
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	salted, err := saltPassword(password, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	clientKey := computeHMAC(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	return &Credentials{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  storedKey[:],
+		ServerKey:  computeHMAC(salted, "Server Key"),
+	}, nil
+}
+
+func computeHMAC(key []byte, s string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+// saltPassword computes Hi(Normalize(password), salt, iterations), which is
+// PBKDF2 with HMAC-SHA-256.
+func saltPassword(password string, salt []byte, iterations int) ([]byte, error) {
+	// RFC 8265 supersedes SASLprep, used by RFC 5802
+	password, err := precis.OpaqueString.String(password)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+
+	result := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result, nil
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, nonceLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(b), nil
+}
+
+// unescapeSaslName unescapes a name escaped with internal.EscapeSaslName.
+func unescapeSaslName(s string) (string, error) {
+	name, ok := internal.UnescapeSaslName(s)
+	if !ok {
+		return "", ErrMalformed
+	}
+	return name, nil
+}
+
+// parseAttrs parses a message made of comma-separated attributes. Each
+// attribute is a letter followed by an equal sign and a value.
+func parseAttrs(s string) ([][2]string, error) {
+	var attrs [][2]string
+	for _, attr := range strings.Split(s, ",") {
+		if len(attr) < 2 || attr[1] != '=' {
+			return nil, ErrMalformed
+		}
+		attrs = append(attrs, [2]string{attr[:1], attr[2:]})
+	}
+	return attrs, nil
+}
+
+// cbindInput returns the value of the c attribute: the GS2 header followed by
+// the channel binding data, if used.
+func cbindInput(gs2Header string, cb *ChannelBinding) string {
+	b := []byte(gs2Header)
+	if strings.HasPrefix(gs2Header, "p=") {
+		b = append(b, cb.Data...)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+type client struct {
+	username string
+	password string
+	cb       *ChannelBinding
+
+	gs2Header       string
+	clientFirstBare string
+	nonce           string
+	serverSignature []byte
+	step            int
+}
+
+// NewClient creates a client for the SCRAM-SHA-256 mechanism.
+func NewClient(username, password string) sasl.Client {
+	return &client{username: username, password: password}
+}
+
+// NewPlusClient creates a client for the SCRAM-SHA-256-PLUS mechanism, which
+// binds the authentication to the TLS connection described by cb, see
+// TLSChannelBinding. It must only be used if the server advertises it.
+func NewPlusClient(username, password string, cb *ChannelBinding) sasl.Client {
+	return &client{username: username, password: password, cb: cb}
+}
+
+func (c *client) Start() (mech string, ir []byte, err error) {
+	c.nonce, err = newNonce()
+	if err != nil {
+		return "", nil, err
+	}
+
+	mech = SHA256
+	c.gs2Header = "n,,"
+	if c.cb != nil {
+		mech = SHA256Plus
+		c.gs2Header = "p=" + c.cb.Type + ",,"
+	}
+	c.clientFirstBare = "n=" + internal.EscapeSaslName(c.username) + ",r=" + c.nonce
+	return mech, []byte(c.gs2Header + c.clientFirstBare), nil
+}
+
+func (c *client) Next(challenge []byte) ([]byte, error) {
+	c.step++
+	switch c.step {
+	case 1:
+		return c.clientFinal(string(challenge))
+	case 2:
+		return c.verifyServerFinal(string(challenge))
+	default:
+		return nil, errors.New("scram: unexpected challenge")
+	}
+}
+
+func (c *client) clientFinal(serverFirst string) ([]byte, error) {
+	attrs, err := parseAttrs(serverFirst)
+	if err != nil {
+		return nil, err
+	}
+	if len(attrs) < 3 || attrs[0][0] != "r" || attrs[1][0] != "s" || attrs[2][0] != "i" {
+		return nil, ErrMalformed
+	}
+
+	nonce := attrs[0][1]
+	if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+		return nil, errors.New("scram: invalid server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs[1][1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	iterations, err := strconv.Atoi(attrs[2][1])
+	if err != nil || iterations <= 0 {
+		return nil, ErrMalformed
+	}
+
+	salted, err := saltPassword(c.password, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	clientFinal := "c=" + cbindInput(c.gs2Header, c.cb) + ",r=" + nonce
+	authMessage := c.clientFirstBare + "," + serverFirst + "," + clientFinal
+
+	clientKey := computeHMAC(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	proof := computeHMAC(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	c.serverSignature = computeHMAC(computeHMAC(salted, "Server Key"), authMessage)
+
+	clientFinal += ",p=" + base64.StdEncoding.EncodeToString(proof)
+	return []byte(clientFinal), nil
+}
+
+func (c *client) verifyServerFinal(serverFinal string) ([]byte, error) {
+	attrs, err := parseAttrs(serverFinal)
+	if err != nil {
+		return nil, err
+	}
+
+	switch attrs[0][0] {
+	case "e":
+		return nil, fmt.Errorf("scram: server error: %v", attrs[0][1])
+	case "v":
+		signature, err := base64.StdEncoding.DecodeString(attrs[0][1])
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		if !hmac.Equal(signature, c.serverSignature) {
+			return nil, ErrInvalidSignature
+		}
+		return []byte{}, nil
+	default:
+		return nil, ErrMalformed
+	}
+}
+
+// ServerOptions holds the parameters of a server.
+type ServerOptions struct {
+	// Credentials returns the stored credentials of a user. It must be set.
+	Credentials func(username string) (*Credentials, error)
+	// Authenticated is called once the client has proven that it knows the
+	// password of the user. If it returns an error, authentication fails.
+	Authenticated func(username string) error
+	// ChannelBinding is the channel binding of the TLS connection, nil if the
+	// connection doesn't use TLS. If it isn't nil, the server is assumed to
+	// advertise SCRAM-SHA-256-PLUS: SCRAM-SHA-256 clients claiming that the
+	// server doesn't support channel binding are rejected, since this
+	// indicates a downgrade attack.
+	ChannelBinding *ChannelBinding
+}
+
+type server struct {
+	opts *ServerOptions
+	plus bool
+
+	username    string
+	gs2Header   string
+	nonce       string
+	authMessage string
+	creds       *Credentials
+	step        int
+	done        bool
+}
+
+// NewServer creates a server for the SCRAM-SHA-256 mechanism.
+func NewServer(opts *ServerOptions) sasl.Server {
+	return &server{opts: opts}
+}
+
+// NewPlusServer creates a server for the SCRAM-SHA-256-PLUS mechanism.
+// opts.ChannelBinding must be set.
+func NewPlusServer(opts *ServerOptions) sasl.Server {
+	return &server{opts: opts, plus: true}
+}
+
+func (s *server) Next(response []byte) (challenge []byte, done bool, err error) {
+	if s.done {
+		// The client has acknowledged the server signature
+		return nil, true, nil
+	}
+	if response == nil && s.step == 0 {
+		// Ask for the initial response
+		return []byte{}, false, nil
+	}
+
+	s.step++
+	switch s.step {
+	case 1:
+		challenge, err = s.serverFirst(string(response))
+	case 2:
+		challenge, err = s.serverFinal(string(response))
+		s.done = err == nil
+	default:
+		err = errors.New("scram: unexpected response")
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	return challenge, false, nil
+}
+
+func (s *server) serverFirst(clientFirst string) ([]byte, error) {
+	parts := strings.SplitN(clientFirst, ",", 3)
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	s.gs2Header = parts[0] + "," + parts[1] + ","
+
+	cb := s.opts.ChannelBinding
+	switch flag := parts[0]; {
+	case strings.HasPrefix(flag, "p="):
+		if !s.plus || cb == nil || flag[2:] != cb.Type {
+			return nil, ErrChannelBinding
+		}
+	case flag == "y":
+		// The client supports channel binding but thinks the server doesn't
+		if s.plus || cb != nil {
+			return nil, ErrChannelBinding
+		}
+	case flag == "n":
+		if s.plus {
+			return nil, ErrChannelBinding
+		}
+	default:
+		return nil, ErrMalformed
+	}
+
+	attrs, err := parseAttrs(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	if len(attrs) < 2 || attrs[0][0] != "n" || attrs[1][0] != "r" || attrs[1][1] == "" {
+		// Mandatory extensions ("m") aren't supported
+		return nil, ErrMalformed
+	}
+	if s.username, err = unescapeSaslName(attrs[0][1]); err != nil {
+		return nil, err
+	}
+	if authzid := parts[1]; authzid != "" {
+		if !strings.HasPrefix(authzid, "a=") {
+			return nil, ErrMalformed
+		}
+		if name, err := unescapeSaslName(authzid[2:]); err != nil {
+			return nil, err
+		} else if name != s.username {
+			return nil, errors.New("scram: authorization identities not supported")
+		}
+	}
+
+	if s.creds, err = s.opts.Credentials(s.username); err != nil {
+		return nil, err
+	}
+
+	serverNonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	s.nonce = attrs[1][1] + serverNonce
+
+	serverFirst := "r=" + s.nonce + ",s=" + base64.StdEncoding.EncodeToString(s.creds.Salt) + ",i=" + strconv.Itoa(s.creds.Iterations)
+	s.authMessage = parts[2] + "," + serverFirst
+	return []byte(serverFirst), nil
+}
+
+func (s *server) serverFinal(clientFinal string) ([]byte, error) {
+	i := strings.LastIndex(clientFinal, ",p=")
+	if i < 0 {
+		return nil, ErrMalformed
+	}
+	withoutProof := clientFinal[:i]
+	proof, err := base64.StdEncoding.DecodeString(clientFinal[i+len(",p="):])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	attrs, err := parseAttrs(withoutProof)
+	if err != nil {
+		return nil, err
+	}
+	if len(attrs) < 2 || attrs[0][0] != "c" || attrs[1][0] != "r" {
+		return nil, ErrMalformed
+	}
+	if attrs[0][1] != cbindInput(s.gs2Header, s.opts.ChannelBinding) {
+		return nil, ErrChannelBinding
+	}
+	if attrs[1][1] != s.nonce {
+		return nil, errors.New("scram: invalid nonce")
+	}
+
+	authMessage := s.authMessage + "," + withoutProof
+	signature := computeHMAC(s.creds.StoredKey, authMessage)
+	if len(proof) != len(signature) {
+		return nil, ErrInvalidProof
+	}
+	clientKey := make([]byte, len(proof))
+	for i := range proof {
+		clientKey[i] = proof[i] ^ signature[i]
+	}
+	storedKey := sha256.Sum256(clientKey)
+	if subtle.ConstantTimeCompare(storedKey[:], s.creds.StoredKey) != 1 {
+		return nil, ErrInvalidProof
+	}
+
+	if s.opts.Authenticated != nil {
+		if err := s.opts.Authenticated(s.username); err != nil {
+			return nil, err
+		}
+	}
+
+	serverSignature := computeHMAC(s.creds.ServerKey, authMessage)
+	return []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature)), nil
+}
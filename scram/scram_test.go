@@ -0,0 +1,134 @@
+package scram
+
+import (
+	"testing"
+)
+
+// Test vector from RFC 7677 section 3.
+func TestClient(t *testing.T) {
+	c := NewClient("user", "pencil").(*client)
+
+	mech, _, err := c.Start()
+	if err != nil {
+		t.Fatal("Start() =", err)
+	}
+	if mech != SHA256 {
+		t.Errorf("Start() returned mechanism %v, want %v", mech, SHA256)
+	}
+
+	c.nonce = "rOprNGfwEbeRWgbNEkqO"
+	c.clientFirstBare = "n=user,r=" + c.nonce
+
+	resp, err := c.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+	if err != nil {
+		t.Fatal("Next() =", err)
+	}
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if string(resp) != want {
+		t.Errorf("Next() = %q, want %q", resp, want)
+	}
+
+	if _, err := c.Next([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err != nil {
+		t.Error("Next() with a valid server signature =", err)
+	}
+}
+
+func TestClient_invalidSignature(t *testing.T) {
+	c := NewClient("user", "pencil").(*client)
+	c.Start()
+	c.nonce = "rOprNGfwEbeRWgbNEkqO"
+	c.clientFirstBare = "n=user,r=" + c.nonce
+
+	if _, err := c.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")); err != nil {
+		t.Fatal("Next() =", err)
+	}
+	if _, err := c.Next([]byte("v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err != ErrInvalidSignature {
+		t.Errorf("Next() = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+// exchange runs a SCRAM exchange between c and s. It returns the first error.
+func exchange(c *client, s *server) error {
+	_, ir, err := c.Start()
+	if err != nil {
+		return err
+	}
+
+	response := ir
+	for {
+		challenge, done, err := s.Next(response)
+		if err != nil || done {
+			return err
+		}
+		if response, err = c.Next(challenge); err != nil {
+			return err
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	creds, err := NewCredentials("pencil", 0)
+	if err != nil {
+		t.Fatal("NewCredentials() =", err)
+	}
+	if creds.Iterations != DefaultIterations {
+		t.Errorf("NewCredentials() iterations = %v, want %v", creds.Iterations, DefaultIterations)
+	}
+
+	var authenticated string
+	opts := &ServerOptions{
+		Credentials: func(username string) (*Credentials, error) {
+			return creds, nil
+		},
+		Authenticated: func(username string) error {
+			authenticated = username
+			return nil
+		},
+	}
+
+	c := NewClient("us,er", "pencil").(*client)
+	if err := exchange(c, NewServer(opts).(*server)); err != nil {
+		t.Fatal("Exchange failed:", err)
+	}
+	if authenticated != "us,er" {
+		t.Errorf("Authenticated user is %q, want %q", authenticated, "us,er")
+	}
+
+	c = NewClient("user", "pen").(*client)
+	if err := exchange(c, NewServer(opts).(*server)); err != ErrInvalidProof {
+		t.Errorf("Exchange with a wrong password = %v, want %v", err, ErrInvalidProof)
+	}
+}
+
+func TestServer_channelBinding(t *testing.T) {
+	creds, err := NewCredentials("pencil", 4096)
+	if err != nil {
+		t.Fatal("NewCredentials() =", err)
+	}
+
+	cb := &ChannelBinding{Type: "tls-exporter", Data: []byte("binding")}
+	opts := &ServerOptions{
+		Credentials: func(username string) (*Credentials, error) {
+			return creds, nil
+		},
+		ChannelBinding: cb,
+	}
+
+	c := NewPlusClient("user", "pencil", cb).(*client)
+	if err := exchange(c, NewPlusServer(opts).(*server)); err != nil {
+		t.Fatal("Exchange failed:", err)
+	}
+
+	// The channel binding of a relayed connection doesn't match
+	other := &ChannelBinding{Type: "tls-exporter", Data: []byte("other")}
+	c = NewPlusClient("user", "pencil", other).(*client)
+	if err := exchange(c, NewPlusServer(opts).(*server)); err != ErrChannelBinding {
+		t.Errorf("Exchange with another channel binding = %v, want %v", err, ErrChannelBinding)
+	}
+
+	// Clients must use channel binding with the -PLUS mechanism
+	c = NewClient("user", "pencil").(*client)
+	if err := exchange(c, NewPlusServer(opts).(*server)); err != ErrChannelBinding {
+		t.Errorf("Exchange without channel binding = %v, want %v", err, ErrChannelBinding)
+	}
+}
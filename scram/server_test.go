@@ -0,0 +1,115 @@
+package scram_test
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/internal"
+	"github.com/emersion/go-imap/scram"
+	"github.com/emersion/go-imap/server"
+)
+
+type scramBackend struct {
+	backend.Backend
+	creds *scram.Credentials
+}
+
+func (be *scramBackend) SCRAMCredentials(username string) (*scram.Credentials, error) {
+	return be.creds, nil
+}
+
+func (be *scramBackend) LoginSCRAM(username string) (backend.User, error) {
+	return be.Login(username, "password")
+}
+
+func testServer(t *testing.T, useTLS bool) (*server.Server, *client.Client) {
+	creds, err := scram.NewCredentials("password", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server.New(&scramBackend{memory.New(), creds})
+	s.AllowInsecureAuth = true
+
+	if !useTLS {
+		go s.Serve(l)
+
+		c, err := client.Dial(l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s, c
+	}
+
+	cert, err := tls.X509KeyPair(internal.LocalhostCert, internal.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(tls.NewListener(l, &tls.Config{Certificates: []tls.Certificate{cert}}))
+
+	c, err := client.DialTLS(l.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+func TestAuthenticate(t *testing.T) {
+	s, c := testServer(t, false)
+	defer s.Close()
+	defer c.Logout()
+
+	// Channel binding is only available with TLS
+	if ok, err := c.SupportAuth(scram.SHA256Plus); err != nil {
+		t.Fatal("c.SupportAuth() =", err)
+	} else if ok {
+		t.Errorf("%v is advertised without TLS", scram.SHA256Plus)
+	}
+
+	if err := c.Authenticate(scram.NewClient("username", "wrong")); err == nil {
+		t.Fatal("c.Authenticate() with a wrong password didn't fail")
+	}
+	if err := c.Authenticate(scram.NewClient("username", "password")); err != nil {
+		t.Fatal("c.Authenticate() =", err)
+	}
+	if _, err := c.Select("INBOX", true); err != nil {
+		t.Fatal("c.Select() =", err)
+	}
+}
+
+func TestAuthenticate_Plus(t *testing.T) {
+	s, c := testServer(t, true)
+	defer s.Close()
+	defer c.Logout()
+
+	if ok, err := c.SupportAuth(scram.SHA256Plus); err != nil {
+		t.Fatal("c.SupportAuth() =", err)
+	} else if !ok {
+		t.Fatalf("%v isn't advertised", scram.SHA256Plus)
+	}
+
+	state, ok := c.TLSConnectionState()
+	if !ok {
+		t.Fatal("c.TLSConnectionState() returned no state")
+	}
+	cb, err := scram.TLSChannelBinding(&state)
+	if err != nil {
+		t.Fatal("TLSChannelBinding() =", err)
+	}
+
+	if err := c.Authenticate(scram.NewPlusClient("username", "password", cb)); err != nil {
+		t.Fatal("c.Authenticate() =", err)
+	}
+	if _, err := c.Select("INBOX", true); err != nil {
+		t.Fatal("c.Select() =", err)
+	}
+}
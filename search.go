@@ -56,6 +56,16 @@ func popSearchField(fields []interface{}) (interface{}, []interface{}, error) {
 	return fields[0], fields[1:], nil
 }
 
+// durationSeconds converts a duration to a number of seconds, as used by the
+// WITHIN extension. Non-zero durations are at least one second.
+func durationSeconds(d time.Duration) uint32 {
+	n := uint32(d / time.Second)
+	if n == 0 {
+		n = 1
+	}
+	return n
+}
+
 // SearchCriteria is a search criteria. A message matches the criteria if and
 // only if it matches each one of its fields.
 type SearchCriteria struct {
@@ -68,6 +78,17 @@ type SearchCriteria struct {
 	SentSince  time.Time // Date header field is since this date
 	SentBefore time.Time // Date header field is before this date
 
+	// Relative to the server's clock, rounded to seconds. Requires the WITHIN
+	// extension, defined in RFC 5032.
+	Younger time.Duration // Internal date is within this duration from now
+	Older   time.Duration // Internal date is earlier than this duration from now
+
+	// Requires the SAVEDATE extension, defined in RFC 8514. Time and timezone
+	// are ignored. Messages without a save date don't match.
+	SavedSince         time.Time // Save date is since this date
+	SavedBefore        time.Time // Save date is before this date
+	SavedDateSupported bool      // Message has a save date
+
 	Header textproto.MIMEHeader // Each header field value is present
 	Body   []string             // Each string is in the body
 	Text   []string             // Each string is in the text (header + body)
@@ -78,6 +99,12 @@ type SearchCriteria struct {
 	Larger  uint32 // Size is larger than this number
 	Smaller uint32 // Size is smaller than this number
 
+	// Requires the CONDSTORE extension, defined in RFC 7162.
+	ModSeq uint64 // Mod-sequence is greater than or equal to this number
+
+	// Requires the ANNOTATE-EXPERIMENT-1 extension, defined in RFC 5257.
+	Annotations []SearchAnnotation // Each annotation attribute contains its value
+
 	Not []*SearchCriteria    // Each criteria doesn't match
 	Or  [][2]*SearchCriteria // Each criteria pair has at least one match of two
 }
@@ -109,6 +136,20 @@ func (c *SearchCriteria) parseField(fields []interface{}, charsetReader func(io.
 	switch key {
 	case "ALL":
 		// Nothing to do
+	case "ANNOTATION":
+		var f1, f2, f3 interface{}
+		if f1, fields, err = popSearchField(fields); err != nil {
+			return nil, err
+		} else if f2, fields, err = popSearchField(fields); err != nil {
+			return nil, err
+		} else if f3, fields, err = popSearchField(fields); err != nil {
+			return nil, err
+		}
+		c.Annotations = append(c.Annotations, SearchAnnotation{
+			Entry:     maybeString(f1),
+			Attribute: maybeString(f2),
+			Value:     convertField(f3, charsetReader),
+		})
 	case "ANSWERED", "DELETED", "DRAFT", "FLAGGED", "RECENT", "SEEN":
 		c.WithFlags = append(c.WithFlags, CanonicalFlag("\\"+key))
 	case "BCC", "CC", "FROM", "SUBJECT", "TO":
@@ -159,6 +200,21 @@ func (c *SearchCriteria) parseField(fields []interface{}, charsetReader func(io.
 		} else if c.Larger == 0 || n > c.Larger {
 			c.Larger = n
 		}
+	case "MODSEQ":
+		// The optional entry name and type are ignored, since metadata items
+		// aren't supported
+		if len(fields) >= 3 {
+			if _, err := ParseNumber64(fields[0]); err != nil {
+				fields = fields[2:]
+			}
+		}
+		if f, fields, err = popSearchField(fields); err != nil {
+			return nil, err
+		} else if n, err := ParseNumber64(f); err != nil {
+			return nil, err
+		} else if n > c.ModSeq {
+			c.ModSeq = n
+		}
 	case "NEW":
 		c.WithFlags = append(c.WithFlags, RecentFlag)
 		c.WithoutFlags = append(c.WithoutFlags, SeenFlag)
@@ -170,6 +226,14 @@ func (c *SearchCriteria) parseField(fields []interface{}, charsetReader func(io.
 		c.Not = append(c.Not, not)
 	case "OLD":
 		c.WithoutFlags = append(c.WithoutFlags, RecentFlag)
+	case "OLDER":
+		if f, fields, err = popSearchField(fields); err != nil {
+			return nil, err
+		} else if n, err := ParseNumber(f); err != nil {
+			return nil, err
+		} else if d := time.Duration(n) * time.Second; c.Older == 0 || d > c.Older {
+			c.Older = d
+		}
 	case "ON":
 		if f, fields, err = popSearchField(fields); err != nil {
 			return nil, err
@@ -187,6 +251,33 @@ func (c *SearchCriteria) parseField(fields []interface{}, charsetReader func(io.
 			return nil, err
 		}
 		c.Or = append(c.Or, [2]*SearchCriteria{c1, c2})
+	case "SAVEDATESUPPORTED":
+		c.SavedDateSupported = true
+	case "SAVEDBEFORE":
+		if f, fields, err = popSearchField(fields); err != nil {
+			return nil, err
+		} else if t, err := time.Parse(DateLayout, maybeString(f)); err != nil {
+			return nil, err
+		} else if c.SavedBefore.IsZero() || t.Before(c.SavedBefore) {
+			c.SavedBefore = t
+		}
+	case "SAVEDON":
+		if f, fields, err = popSearchField(fields); err != nil {
+			return nil, err
+		} else if t, err := time.Parse(DateLayout, maybeString(f)); err != nil {
+			return nil, err
+		} else {
+			c.SavedSince = t
+			c.SavedBefore = t.Add(24 * time.Hour)
+		}
+	case "SAVEDSINCE":
+		if f, fields, err = popSearchField(fields); err != nil {
+			return nil, err
+		} else if t, err := time.Parse(DateLayout, maybeString(f)); err != nil {
+			return nil, err
+		} else if c.SavedSince.IsZero() || t.After(c.SavedSince) {
+			c.SavedSince = t
+		}
 	case "SENTBEFORE":
 		if f, fields, err = popSearchField(fields); err != nil {
 			return nil, err
@@ -249,6 +340,14 @@ func (c *SearchCriteria) parseField(fields []interface{}, charsetReader func(io.
 		} else {
 			c.WithoutFlags = append(c.WithoutFlags, CanonicalFlag(maybeString(f)))
 		}
+	case "YOUNGER":
+		if f, fields, err = popSearchField(fields); err != nil {
+			return nil, err
+		} else if n, err := ParseNumber(f); err != nil {
+			return nil, err
+		} else if d := time.Duration(n) * time.Second; c.Younger == 0 || d < c.Younger {
+			c.Younger = d
+		}
 	default: // Try to parse a sequence set
 		if c.SeqNum, err = ParseSeqSet(key); err != nil {
 			return nil, err
@@ -303,6 +402,27 @@ func (c *SearchCriteria) Format() []interface{} {
 		}
 	}
 
+	if !c.SavedSince.IsZero() && !c.SavedBefore.IsZero() && c.SavedBefore.Sub(c.SavedSince) == 24*time.Hour {
+		fields = append(fields, "SAVEDON", searchDate(c.SavedSince))
+	} else {
+		if !c.SavedSince.IsZero() {
+			fields = append(fields, "SAVEDSINCE", searchDate(c.SavedSince))
+		}
+		if !c.SavedBefore.IsZero() {
+			fields = append(fields, "SAVEDBEFORE", searchDate(c.SavedBefore))
+		}
+	}
+	if c.SavedDateSupported {
+		fields = append(fields, "SAVEDATESUPPORTED")
+	}
+
+	if c.Younger > 0 {
+		fields = append(fields, "YOUNGER", durationSeconds(c.Younger))
+	}
+	if c.Older > 0 {
+		fields = append(fields, "OLDER", durationSeconds(c.Older))
+	}
+
 	for key, values := range c.Header {
 		var prefields []interface{}
 		switch key {
@@ -317,6 +437,9 @@ func (c *SearchCriteria) Format() []interface{} {
 		}
 	}
 
+	for _, sa := range c.Annotations {
+		fields = append(fields, "ANNOTATION", Quoted(sa.Entry), Quoted(sa.Attribute), sa.Value)
+	}
 	for _, value := range c.Body {
 		fields = append(fields, "BODY", value)
 	}
@@ -354,6 +477,10 @@ func (c *SearchCriteria) Format() []interface{} {
 		fields = append(fields, "SMALLER", c.Smaller)
 	}
 
+	if c.ModSeq > 0 {
+		fields = append(fields, "MODSEQ", c.ModSeq)
+	}
+
 	for _, not := range c.Not {
 		fields = append(fields, "NOT", not.Format())
 	}
@@ -364,3 +491,110 @@ func (c *SearchCriteria) Format() []interface{} {
 
 	return fields
 }
+
+// Search return options, as defined in RFC 4731 section 3.1.
+const (
+	// The lowest matching message.
+	SearchReturnMin = "MIN"
+	// The highest matching message.
+	SearchReturnMax = "MAX"
+	// All matching messages, as a sequence set.
+	SearchReturnAll = "ALL"
+	// The number of matching messages.
+	SearchReturnCount = "COUNT"
+	// Save the result on the server, to refer to it later with "$". See RFC
+	// 5182.
+	SearchReturnSave = "SAVE"
+	// The matching messages in a range, see RFC 9394. The range is set in
+	// commands.Search.Partial.
+	SearchReturnPartial = "PARTIAL"
+	// Keep the result updated: changes are reported with ADDTO and REMOVEFROM
+	// until the update is cancelled. See RFC 5267 section 4.
+	SearchReturnUpdate = "UPDATE"
+	// Hint that the result will be updated or refined later, see RFC 5267
+	// section 4.2.
+	SearchReturnContext = "CONTEXT"
+)
+
+// Search result changes, sent in ESEARCH responses for results kept updated
+// with the UPDATE return option. See RFC 5267 section 4.3.
+const (
+	SearchAddTo      = "ADDTO"
+	SearchRemoveFrom = "REMOVEFROM"
+)
+
+// SearchContextUpdate is a change to a search result kept updated with the
+// UPDATE return option, as defined in RFC 5267 section 4.3. Position is the
+// position of the first message of Ids in a sorted result, starting at 1, or
+// zero if the result isn't sorted.
+type SearchContextUpdate struct {
+	Position uint32
+	Ids      *SeqSet
+}
+
+// SearchResult is the result of an extended search, as returned in an ESEARCH
+// response defined in RFC 4731 section 3.1. Only the items requested with
+// return options are set. Min, Max and All are zero if no message matches.
+type SearchResult struct {
+	Min   uint32
+	Max   uint32
+	All   *SeqSet
+	Count uint32
+	// The highest mod-sequence of the matching messages, set when the search
+	// criteria contain MODSEQ. See RFC 7162 section 3.1.5.
+	ModSeq uint64
+	// The range requested with PARTIAL and the matching messages in this
+	// range, see RFC 9394. Partial is nil if no message is in the range.
+	PartialRange *PartialRange
+	Partial      *SeqSet
+	// Changes to a result kept updated with the UPDATE return option, in the
+	// order they must be applied, removals first. See RFC 5267 section 4.3.
+	RemoveFrom []SearchContextUpdate
+	AddTo      []SearchContextUpdate
+}
+
+// NewSearchResult computes the result of an extended search from the matching
+// sequence numbers or UIDs, keeping only the items requested with options. If
+// options is empty, ALL is returned. Unknown options are ignored.
+func NewSearchResult(ids []uint32, options []string) *SearchResult {
+	if len(options) == 0 {
+		options = []string{SearchReturnAll}
+	}
+
+	res := new(SearchResult)
+	for _, opt := range options {
+		switch strings.ToUpper(opt) {
+		case SearchReturnMin:
+			for _, id := range ids {
+				if res.Min == 0 || id < res.Min {
+					res.Min = id
+				}
+			}
+		case SearchReturnMax:
+			for _, id := range ids {
+				if id > res.Max {
+					res.Max = id
+				}
+			}
+		case SearchReturnAll:
+			if len(ids) > 0 {
+				res.All = new(SeqSet)
+				res.All.AddNum(ids...)
+			}
+		case SearchReturnCount:
+			res.Count = uint32(len(ids))
+		}
+	}
+	return res
+}
+
+// SetPartial sets the PARTIAL result for the range r, from the sorted matching
+// sequence numbers or UIDs.
+func (res *SearchResult) SetPartial(ids []uint32, r *PartialRange) {
+	res.PartialRange = r
+	res.Partial = nil
+	if ids = r.Apply(ids); len(ids) > 0 {
+		res.Partial = new(SeqSet)
+		res.Partial.AddNum(ids...)
+	}
+}
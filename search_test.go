@@ -65,6 +65,43 @@ var searchCriteriaTests = []struct {
 			}},
 		},
 	},
+	{
+		expected: `(YOUNGER 86400 OLDER 3600 NOT (YOUNGER 60))`,
+		criteria: &SearchCriteria{
+			Younger: 24 * time.Hour,
+			Older:   time.Hour,
+			Not: []*SearchCriteria{{
+				Younger: time.Minute,
+			}},
+		},
+	},
+	{
+		expected: `(SAVEDSINCE "5-Nov-1984" SAVEDBEFORE "21-Nov-1997" SAVEDATESUPPORTED NOT (SAVEDON "21-Nov-1997"))`,
+		criteria: &SearchCriteria{
+			SavedSince:         searchDate2,
+			SavedBefore:        searchDate1,
+			SavedDateSupported: true,
+			Not: []*SearchCriteria{{
+				SavedSince:  searchDate1,
+				SavedBefore: searchDate1.Add(24 * time.Hour),
+			}},
+		},
+	},
+	{
+		expected: `(ANNOTATION "/comment" "value" IMAP4)`,
+		criteria: &SearchCriteria{
+			Annotations: []SearchAnnotation{{Entry: "/comment", Attribute: "value", Value: "IMAP4"}},
+		},
+	},
+	{
+		expected: `(MODSEQ 620162338 NOT (MODSEQ 720162338))`,
+		criteria: &SearchCriteria{
+			ModSeq: 620162338,
+			Not: []*SearchCriteria{{
+				ModSeq: 720162338,
+			}},
+		},
+	},
 }
 
 func TestSearchCriteria_Format(t *testing.T) {
@@ -123,6 +160,12 @@ var searchCriteriaParseTests = []struct {
 			return r
 		},
 	},
+	{
+		fields: []interface{}{"MODSEQ", Quoted("/flags/\\draft"), "all", "620162338"},
+		criteria: &SearchCriteria{
+			ModSeq: 620162338,
+		},
+	},
 }
 
 func TestSearchCriteria_Parse_others(t *testing.T) {
@@ -135,3 +178,23 @@ func TestSearchCriteria_Parse_others(t *testing.T) {
 		}
 	}
 }
+
+func TestNewSearchResult(t *testing.T) {
+	all, _ := ParseSeqSet("2:4,8")
+
+	res := NewSearchResult([]uint32{8, 2, 3, 4}, []string{SearchReturnMin, SearchReturnMax, SearchReturnAll, SearchReturnCount})
+	want := &SearchResult{Min: 2, Max: 8, All: all, Count: 4}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("NewSearchResult() = %+v, want %+v", res, want)
+	}
+
+	// ALL is the default
+	res = NewSearchResult([]uint32{8, 2, 3, 4}, nil)
+	if res.All == nil || res.All.String() != "2:4,8" || res.Count != 0 {
+		t.Errorf("NewSearchResult() = %+v, want ALL only", res)
+	}
+
+	if res := NewSearchResult(nil, []string{SearchReturnMin, SearchReturnAll}); res.Min != 0 || res.All != nil {
+		t.Errorf("NewSearchResult() = %+v, want an empty result", res)
+	}
+}
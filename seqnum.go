@@ -0,0 +1,140 @@
+package imap
+
+import (
+	"sync"
+)
+
+// ApplyExpunge updates seqMap after the message with the sequence number
+// expunged has been removed. seqMap maps sequence numbers to UIDs: the UID of
+// the message with sequence number n is seqMap[n-1]. The updated map is
+// returned in a new slice: seqMap is never modified.
+//
+// When a message is expunged, the sequence number of each message after it is
+// decremented by one. Thus expunge responses must be applied in the order they
+// have been received, otherwise the wrong messages are removed. For instance,
+// expunging messages 3 and 4 is reported by the server as two "3 EXPUNGE"
+// responses.
+func ApplyExpunge(seqMap []uint32, expunged uint32) []uint32 {
+	if expunged == 0 || int(expunged) > len(seqMap) {
+		return seqMap
+	}
+	updated := make([]uint32, 0, len(seqMap)-1)
+	updated = append(updated, seqMap[:expunged-1]...)
+	return append(updated, seqMap[expunged:]...)
+}
+
+// SeqNumTracker maintains a mapping between sequence numbers and UIDs for a
+// mailbox, as unilateral updates are received. It is safe to use from
+// multiple goroutines.
+type SeqNumTracker struct {
+	locker sync.Mutex
+	// uids[n-1] is the UID of the message with sequence number n, or zero if
+	// unknown.
+	uids []uint32
+}
+
+// NewSeqNumTracker creates a new tracker for a mailbox containing messages with
+// the provided UIDs, in sequence number order. A zero UID stands for an
+// unknown UID.
+func NewSeqNumTracker(uids []uint32) *SeqNumTracker {
+	t := &SeqNumTracker{uids: make([]uint32, len(uids))}
+	copy(t.uids, uids)
+	return t
+}
+
+// Len returns the number of messages in the mailbox.
+func (t *SeqNumTracker) Len() uint32 {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	return uint32(len(t.uids))
+}
+
+// Exists handles an EXISTS response reporting that the mailbox contains n
+// messages. New messages have unknown UIDs until SetUid is called. The number
+// of messages can only decrease with EXPUNGE or VANISHED responses, so a
+// smaller value is ignored.
+func (t *SeqNumTracker) Exists(n uint32) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	for uint32(len(t.uids)) < n {
+		t.uids = append(t.uids, 0)
+	}
+}
+
+// Expunge handles an EXPUNGE response for the message with sequence number
+// seqNum. Responses must be applied in the order they have been received.
+func (t *SeqNumTracker) Expunge(seqNum uint32) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	if seqNum > 0 && int(seqNum) <= len(t.uids) {
+		// t.uids isn't shared, update it in place
+		t.uids = append(t.uids[:seqNum-1], t.uids[seqNum:]...)
+	}
+}
+
+// Vanished handles a VANISHED response (RFC 7162) reporting that the messages
+// with the provided UIDs have been expunged.
+func (t *SeqNumTracker) Vanished(uids *SeqSet) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	kept := t.uids[:0]
+	for _, uid := range t.uids {
+		if uid == 0 || !uids.Contains(uid) {
+			kept = append(kept, uid)
+		}
+	}
+	t.uids = kept
+}
+
+// SetUid records the UID of the message with sequence number seqNum, e.g. when
+// a FETCH response containing a UID is received.
+func (t *SeqNumTracker) SetUid(seqNum, uid uint32) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	if seqNum == 0 {
+		return
+	}
+	for uint32(len(t.uids)) < seqNum {
+		t.uids = append(t.uids, 0)
+	}
+	t.uids[seqNum-1] = uid
+}
+
+// Uid returns the UID of the message with sequence number seqNum. ok is false
+// if the message doesn't exist or if its UID is unknown.
+func (t *SeqNumTracker) Uid(seqNum uint32) (uid uint32, ok bool) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	if seqNum == 0 || int(seqNum) > len(t.uids) {
+		return 0, false
+	}
+	uid = t.uids[seqNum-1]
+	return uid, uid != 0
+}
+
+// SeqNum returns the sequence number of the message with the UID uid. ok is
+// false if no such message is known.
+func (t *SeqNumTracker) SeqNum(uid uint32) (seqNum uint32, ok bool) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	if uid == 0 {
+		return 0, false
+	}
+	for i, u := range t.uids {
+		if u == uid {
+			return uint32(i + 1), true
+		}
+	}
+	return 0, false
+}
+
+// Uids returns the UIDs of all messages, in sequence number order. Unknown
+// UIDs are zero.
+func (t *SeqNumTracker) Uids() []uint32 {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+	uids := make([]uint32, len(t.uids))
+	copy(uids, t.uids)
+	return uids
+}
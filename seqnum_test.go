@@ -0,0 +1,156 @@
+package imap
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestApplyExpunge(t *testing.T) {
+	tests := []struct {
+		in       []uint32
+		expunged []uint32
+		out      []uint32
+	}{
+		{[]uint32{10, 20, 30}, []uint32{1}, []uint32{20, 30}},
+		{[]uint32{10, 20, 30}, []uint32{3}, []uint32{10, 20}},
+		// Expunging messages 3 and 4 is reported as "3 EXPUNGE" twice
+		{[]uint32{10, 20, 30, 40, 50}, []uint32{3, 3}, []uint32{10, 20, 50}},
+		{[]uint32{10, 20, 30, 40, 50}, []uint32{5, 1, 2}, []uint32{20, 40}},
+		{[]uint32{10, 20, 30}, []uint32{1, 1, 1}, []uint32{}},
+		// Out of range
+		{[]uint32{10, 20, 30}, []uint32{0}, []uint32{10, 20, 30}},
+		{[]uint32{10, 20, 30}, []uint32{4}, []uint32{10, 20, 30}},
+		{nil, []uint32{1}, nil},
+	}
+
+	for i, test := range tests {
+		seqMap := append([]uint32(nil), test.in...)
+		for _, seqNum := range test.expunged {
+			seqMap = ApplyExpunge(seqMap, seqNum)
+		}
+
+		if len(seqMap) != len(test.out) || (len(seqMap) > 0 && !reflect.DeepEqual(seqMap, test.out)) {
+			t.Errorf("Test #%v: invalid sequence map: expected %v but got %v", i, test.out, seqMap)
+		}
+	}
+}
+
+func TestApplyExpunge_Unmodified(t *testing.T) {
+	seqMap := []uint32{10, 20, 30}
+	updated := ApplyExpunge(seqMap, 1)
+
+	if !reflect.DeepEqual(seqMap, []uint32{10, 20, 30}) {
+		t.Errorf("ApplyExpunge modified its input: got %v", seqMap)
+	}
+	if !reflect.DeepEqual(updated, []uint32{20, 30}) {
+		t.Errorf("Invalid sequence map: expected %v but got %v", []uint32{20, 30}, updated)
+	}
+}
+
+// seqNumOracle keeps the set of UIDs in the mailbox. The sequence number of a
+// message is its rank in the sorted list of UIDs.
+type seqNumOracle map[uint32]bool
+
+func (o seqNumOracle) uids() []uint32 {
+	var uids []uint32
+	for uid := range o {
+		uids = append(uids, uid)
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids
+}
+
+func TestSeqNumTracker(t *testing.T) {
+	prng := rand.New(rand.NewSource(19860201))
+
+	oracle := make(seqNumOracle)
+	var initial []uint32
+	for uid := uint32(1); uid <= 20; uid++ {
+		oracle[uid] = true
+		initial = append(initial, uid)
+	}
+	uidNext := uint32(21)
+
+	tracker := NewSeqNumTracker(initial)
+
+	for i := 0; i < 1000; i++ {
+		uids := oracle.uids()
+
+		switch op := prng.Intn(4); {
+		case op == 0 || len(uids) == 0:
+			// New messages: EXISTS followed by FETCH responses with UIDs
+			n := prng.Intn(3) + 1
+			tracker.Exists(uint32(len(uids) + n))
+			for j := 0; j < n; j++ {
+				oracle[uidNext] = true
+				tracker.SetUid(uint32(len(uids)+j+1), uidNext)
+				uidNext++
+			}
+		case op == 1 || op == 2:
+			// A batch of EXPUNGE responses, applied in received order
+			for n := prng.Intn(3) + 1; n > 0 && len(uids) > 0; n-- {
+				seqNum := prng.Intn(len(uids)) + 1
+				delete(oracle, uids[seqNum-1])
+				uids = append(uids[:seqNum-1], uids[seqNum:]...)
+				tracker.Expunge(uint32(seqNum))
+			}
+		case op == 3:
+			// VANISHED, possibly containing already expunged UIDs
+			set := new(SeqSet)
+			for n := prng.Intn(4) + 1; n > 0; n-- {
+				uid := uint32(prng.Intn(int(uidNext))) + 1
+				set.AddNum(uid)
+				delete(oracle, uid)
+			}
+			tracker.Vanished(set)
+		}
+
+		want := oracle.uids()
+		if got := tracker.Uids(); len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+			t.Fatalf("Step #%v: invalid UIDs: expected %v but got %v", i, want, got)
+		}
+		if n := tracker.Len(); n != uint32(len(want)) {
+			t.Fatalf("Step #%v: invalid length: expected %v but got %v", i, len(want), n)
+		}
+		for j, uid := range want {
+			seqNum := uint32(j + 1)
+			if got, ok := tracker.Uid(seqNum); !ok || got != uid {
+				t.Fatalf("Step #%v: invalid UID for message %v: expected %v but got %v", i, seqNum, uid, got)
+			}
+			if got, ok := tracker.SeqNum(uid); !ok || got != seqNum {
+				t.Fatalf("Step #%v: invalid sequence number for UID %v: expected %v but got %v", i, uid, seqNum, got)
+			}
+		}
+	}
+}
+
+func TestSeqNumTracker_unknownUid(t *testing.T) {
+	tracker := NewSeqNumTracker([]uint32{4, 8})
+	tracker.Exists(4)
+
+	if uid, ok := tracker.Uid(3); ok {
+		t.Errorf("Expected UID of new message to be unknown, got %v", uid)
+	}
+	if _, ok := tracker.Uid(5); ok {
+		t.Error("Expected non-existing message to have no UID")
+	}
+
+	// A smaller EXISTS count is ignored
+	tracker.Exists(1)
+	if n := tracker.Len(); n != 4 {
+		t.Errorf("Expected 4 messages, got %v", n)
+	}
+
+	// Messages with unknown UIDs are kept by VANISHED
+	tracker.Vanished(&SeqSet{Set: []Seq{{1, 100}}})
+	if n := tracker.Len(); n != 2 {
+		t.Errorf("Expected 2 messages, got %v", n)
+	}
+
+	tracker.SetUid(2, 15)
+	if seqNum, ok := tracker.SeqNum(15); !ok || seqNum != 2 {
+		t.Errorf("Expected UID 15 to be message 2, got %v", seqNum)
+	}
+}
@@ -120,6 +120,10 @@ func (s Seq) String() string {
 // sequence-set ABNF rule). The zero value is an empty set.
 type SeqSet struct {
 	Set []Seq
+	// Saved is true if the set is a reference to the result of the last
+	// search saved with SEARCH RETURN (SAVE), formatted as "$" (RFC 5182). Set
+	// is ignored in this case.
+	Saved bool
 }
 
 // ParseSeqSet returns a new SeqSet instance after parsing the set string.
@@ -132,6 +136,11 @@ func ParseSeqSet(set string) (s *SeqSet, err error) {
 // by RFC 3501 sequence-set ABNF rule. If an error is encountered, all values
 // inserted successfully prior to the error remain in the set.
 func (s *SeqSet) Add(set string) error {
+	if set == "$" {
+		s.Saved = true
+		return nil
+	}
+
 	for _, sv := range strings.Split(set, ",") {
 		v, err := parseSeq(sv)
 		if err != nil {
@@ -194,6 +203,9 @@ func (s SeqSet) Contains(q uint32) bool {
 
 // String returns a sorted representation of all contained sequence values.
 func (s SeqSet) String() string {
+	if s.Saved {
+		return "$"
+	}
 	if len(s.Set) == 0 {
 		return ""
 	}
@@ -722,3 +722,20 @@ func TestSeqSetAddNumRangeSet(t *testing.T) {
 		}
 	}
 }
+
+func TestSeqSetSaved(t *testing.T) {
+	s, err := ParseSeqSet("$")
+	if err != nil {
+		t.Fatal("Cannot parse saved search result reference:", err)
+	}
+	if !s.Saved {
+		t.Error("Expected the set to be a saved search result reference")
+	}
+	if str := s.String(); str != "$" {
+		t.Errorf("Expected saved search result reference to be formatted as $, got %q", str)
+	}
+
+	if _, err := ParseSeqSet("$,1"); err == nil {
+		t.Error("Expected an error when mixing $ with other values")
+	}
+}
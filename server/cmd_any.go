@@ -1,6 +1,8 @@
 package server
 
 import (
+	"errors"
+
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/backend"
 	"github.com/emersion/go-imap/commands"
@@ -50,3 +52,33 @@ func (cmd *Logout) Handle(conn Conn) error {
 	conn.Context().State = imap.LogoutState
 	return nil
 }
+
+type ID struct {
+	commands.ID
+}
+
+func (cmd *ID) Handle(conn Conn) error {
+	be, ok := conn.Server().Backend.(backend.IDBackend)
+	if !ok {
+		return errors.New("ID is not supported")
+	}
+
+	ctx := conn.Context()
+	ctx.ClientID = cmd.ID.ID
+
+	serverID, err := be.ID(cmd.ID.ID)
+	if err != nil {
+		res := &imap.StatusResp{
+			Type: imap.StatusRespBye,
+			Info: err.Error(),
+		}
+		if err := conn.WriteResp(res); err != nil {
+			return err
+		}
+
+		ctx.State = imap.LogoutState
+		return ErrNoStatusResp()
+	}
+
+	return conn.WriteResp(&responses.ID{ID: serverID})
+}
@@ -2,11 +2,16 @@ package server_test
 
 import (
 	"bufio"
+	"crypto/tls"
+	"errors"
 	"io"
 	"net"
 	"strings"
 	"testing"
 
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/internal"
 	"github.com/emersion/go-imap/server"
 	"github.com/emersion/go-sasl"
 )
@@ -27,7 +32,7 @@ func TestCapability(t *testing.T) {
 	io.WriteString(c, "a001 CAPABILITY\r\n")
 
 	scanner.Scan()
-	if scanner.Text() != "* CAPABILITY IMAP4rev1 AUTH=PLAIN" {
+	if scanner.Text() != "* CAPABILITY IMAP4rev1 LITERAL+ SASL-IR AUTH=PLAIN" {
 		t.Fatal("Bad capability:", scanner.Text())
 	}
 
@@ -37,6 +42,80 @@ func TestCapability(t *testing.T) {
 	}
 }
 
+func setTestCapabilities(s *server.Server) {
+	s.SetCapabilities(func(conn server.Conn, state imap.ConnState) []string {
+		if state&imap.AuthenticatedState != 0 {
+			return []string{"IDLE", "XPOSTAUTH"}
+		}
+		return []string{"STARTTLS", "AUTH=PLAIN", "XPREAUTH"}
+	})
+}
+
+func TestCapability_Custom(t *testing.T) {
+	s, c, scanner := testServerGreeted(t)
+	defer c.Close()
+	defer s.Close()
+
+	setTestCapabilities(s)
+
+	io.WriteString(c, "a001 CAPABILITY\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* CAPABILITY IMAP4rev1 AUTH=PLAIN XPREAUTH" {
+		t.Fatal("Bad capability:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Bad status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 LOGIN username password\r\n")
+	scanner.Scan()
+	if scanner.Text() != "a002 OK [CAPABILITY IMAP4rev1 IDLE XPOSTAUTH] LOGIN completed" {
+		t.Fatal("Bad status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 CAPABILITY\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* CAPABILITY IMAP4rev1 IDLE XPOSTAUTH" {
+		t.Fatal("Bad capability:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Bad status response:", scanner.Text())
+	}
+}
+
+func TestCapability_CustomInsecure(t *testing.T) {
+	s, c, scanner := testServerGreeted(t)
+	defer c.Close()
+	defer s.Close()
+
+	cert, err := tls.X509KeyPair(internal.LocalhostCert, internal.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.AllowInsecureAuth = false
+	s.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	setTestCapabilities(s)
+
+	io.WriteString(c, "a001 CAPABILITY\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED XPREAUTH" {
+		t.Fatal("Bad capability:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Bad status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 NO ") {
+		t.Fatal("Bad status response:", scanner.Text())
+	}
+}
+
 func TestNoop(t *testing.T) {
 	s, c, scanner := testServerGreeted(t)
 	defer c.Close()
@@ -88,7 +167,7 @@ func TestServer_Enable(t *testing.T) {
 	io.WriteString(c, "a001 CAPABILITY\r\n")
 
 	scanner.Scan()
-	if scanner.Text() != "* CAPABILITY IMAP4rev1 AUTH=PLAIN XNOOP" {
+	if scanner.Text() != "* CAPABILITY IMAP4rev1 LITERAL+ SASL-IR AUTH=PLAIN XNOOP" {
 		t.Fatal("Bad capability:", scanner.Text())
 	}
 
@@ -117,8 +196,8 @@ func TestServer_EnableAuth(t *testing.T) {
 	io.WriteString(c, "a001 CAPABILITY\r\n")
 
 	scanner.Scan()
-	if scanner.Text() != "* CAPABILITY IMAP4rev1 AUTH=PLAIN AUTH=XNOOP" &&
-		scanner.Text() != "* CAPABILITY IMAP4rev1 AUTH=XNOOP AUTH=PLAIN" {
+	if scanner.Text() != "* CAPABILITY IMAP4rev1 LITERAL+ SASL-IR AUTH=PLAIN AUTH=XNOOP" &&
+		scanner.Text() != "* CAPABILITY IMAP4rev1 LITERAL+ SASL-IR AUTH=XNOOP AUTH=PLAIN" {
 		t.Fatal("Bad capability:", scanner.Text())
 	}
 
@@ -127,3 +206,61 @@ func TestServer_EnableAuth(t *testing.T) {
 		t.Fatal("Bad status response:", scanner.Text())
 	}
 }
+
+type idBackend struct {
+	*memory.Backend
+}
+
+func (be *idBackend) ID(clientID map[string]string) (map[string]string, error) {
+	if clientID[imap.IDName] == "BrokenClient" {
+		return nil, errors.New("Client not supported")
+	}
+	return map[string]string{imap.IDName: "TestServer"}, nil
+}
+
+func TestID(t *testing.T) {
+	s, c := testServerBackend(t, &idBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a001 CAPABILITY\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " ID") {
+		t.Fatal("ID not advertised:", scanner.Text())
+	}
+	scanner.Scan()
+
+	io.WriteString(c, "a002 ID (\"name\" \"TestClient\")\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ID (\"name\" \"TestServer\")" {
+		t.Fatal("Invalid ID response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 ID (\"name\" \"BrokenClient\")\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* BYE Client not supported" {
+		t.Fatal("Invalid BYE response:", scanner.Text())
+	}
+	if scanner.Scan() {
+		t.Fatal("Connection not closed:", scanner.Text())
+	}
+}
+
+func TestID_Unsupported(t *testing.T) {
+	s, c, scanner := testServerGreeted(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 ID NIL\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
@@ -1,11 +1,15 @@
 package server
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"strings"
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/backend"
 	"github.com/emersion/go-imap/commands"
+	"github.com/emersion/go-imap/imapurl"
 	"github.com/emersion/go-imap/responses"
 )
 
@@ -24,14 +28,40 @@ func (cmd *Select) Handle(conn Conn) error {
 		return ErrNotAuthenticated
 	}
 
+	if cmd.QResync != nil && !ctx.Enabled["QRESYNC"] {
+		return errors.New("QRESYNC must be enabled first")
+	}
+	if cmd.CondStore {
+		if !conn.Server().supportModSeq() {
+			return errors.New("CONDSTORE is not supported")
+		}
+		enableCondStore(ctx)
+	}
+
 	mbox, err := ctx.User.GetMailbox(cmd.Mailbox)
 	if err != nil {
 		return err
 	}
+	if err := checkRights(conn, mbox, "r"); err != nil {
+		return err
+	}
+
+	// IMAP4rev2 removes RECENT and the UNSEEN response code, see RFC 9051
+	// appendix E
+	rev2 := rev2Enabled(ctx)
+	items := []imap.StatusItem{imap.StatusMessages}
+	if !rev2 {
+		items = append(items, imap.StatusRecent, imap.StatusUnseen)
+	}
+	items = append(items, imap.StatusUidNext, imap.StatusUidValidity)
 
-	items := []imap.StatusItem{
-		imap.StatusMessages, imap.StatusRecent, imap.StatusUnseen,
-		imap.StatusUidNext, imap.StatusUidValidity,
+	supportModSeq := conn.Server().supportModSeq()
+	_, modSeq := mbox.(backend.ModSeqMailbox)
+	if supportModSeq && modSeq {
+		items = append(items, imap.StatusHighestModSeq)
+	}
+	if conn.Server().supportObjectId() {
+		items = append(items, imap.StatusMailboxId)
 	}
 
 	status, err := mbox.Status(items)
@@ -39,14 +69,50 @@ func (cmd *Select) Handle(conn Conn) error {
 		return err
 	}
 
+	if supportModSeq && !modSeq {
+		// Send NOMODSEQ
+		status.ItemsLocker.Lock()
+		status.Items[imap.StatusHighestModSeq] = nil
+		status.ItemsLocker.Unlock()
+		status.HighestModSeq = 0
+	}
+
 	ctx.Mailbox = mbox
 	ctx.MailboxReadOnly = cmd.ReadOnly || status.ReadOnly
+	ctx.SavedSearch = nil
+	ctx.SearchUpdates = nil
+
+	if rev2 {
+		status.UnseenSeqNum = 0
+	}
 
 	res := &responses.Select{Mailbox: status}
 	if err := conn.WriteResp(res); err != nil {
 		return err
 	}
 
+	if rev2 {
+		// The mailbox name is sent in a LIST response, see RFC 9051 section
+		// 6.3.2
+		info, err := mbox.Info()
+		if err != nil {
+			return err
+		}
+
+		ch := make(chan *imap.MailboxInfo, 1)
+		ch <- info
+		close(ch)
+		if err := conn.WriteResp(&responses.List{Mailboxes: ch}); err != nil {
+			return err
+		}
+	}
+
+	if cmd.QResync != nil && cmd.QResync.UidValidity == status.UidValidity {
+		if err := qresync(conn, mbox, cmd.QResync); err != nil {
+			return err
+		}
+	}
+
 	var code imap.StatusRespCode = imap.CodeReadWrite
 	if ctx.MailboxReadOnly {
 		code = imap.CodeReadOnly
@@ -57,6 +123,258 @@ func (cmd *Select) Handle(conn Conn) error {
 	})
 }
 
+// qresync sends the changes made to mbox since the state described by params,
+// as defined in RFC 7162 section 3.2.5.1.
+func qresync(conn Conn, mbox backend.Mailbox, params *imap.QResyncParams) error {
+	qmbox, ok := mbox.(backend.QResyncMailbox)
+	if !ok {
+		return nil
+	}
+
+	uids := params.KnownUids
+	if uids == nil {
+		uids, _ = imap.ParseSeqSet("1:*")
+	}
+
+	if err := writeVanished(conn, qmbox, uids, params.ModSeq); err != nil {
+		return err
+	}
+
+	ch := make(chan *imap.Message)
+	res := &responses.Fetch{Messages: ch}
+
+	done := make(chan error, 1)
+	go (func() {
+		done <- conn.WriteResp(res)
+	})()
+
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchFlags, imap.FetchModSeq}
+	if err := qmbox.ListMessagesChangedSince(true, uids, params.ModSeq, items, ch); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// writeVanished sends a VANISHED (EARLIER) response containing the UIDs in
+// uids of the messages expunged after modSeq.
+func writeVanished(conn Conn, mbox backend.QResyncMailbox, uids *imap.SeqSet, modSeq uint64) error {
+	expunged, err := mbox.ExpungedSince(modSeq)
+	if err != nil {
+		return err
+	}
+
+	vanished := new(imap.SeqSet)
+	for _, uid := range expunged {
+		if uids.Contains(uid) {
+			vanished.AddNum(uid)
+		}
+	}
+	if vanished.Empty() {
+		return nil
+	}
+
+	return conn.WriteResp(&responses.Vanished{Earlier: true, Uids: vanished})
+}
+
+type Enable struct {
+	commands.Enable
+}
+
+func (cmd *Enable) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+	if ctx.Mailbox != nil {
+		return errors.New("ENABLE is only valid in the authenticated state")
+	}
+
+	res := &responses.Enabled{}
+	for _, cap := range cmd.Caps {
+		cap = strings.ToUpper(cap)
+
+		var supported bool
+		switch cap {
+		case "CONDSTORE":
+			supported = conn.Server().supportModSeq()
+		case "QRESYNC":
+			supported = conn.Server().supportQResync()
+		case imap.UTF8Accept:
+			supported = conn.Server().UTF8Accept
+		case strings.ToUpper(imap.IMAP4rev2):
+			supported = conn.Server().supportIMAP4rev2()
+		}
+		if !supported || ctx.Enabled[cap] {
+			continue
+		}
+
+		if ctx.Enabled == nil {
+			ctx.Enabled = make(map[string]bool)
+		}
+		ctx.Enabled[cap] = true
+		if cap == "QRESYNC" {
+			// QRESYNC implies CONDSTORE
+			ctx.Enabled["CONDSTORE"] = true
+		}
+		res.Caps = append(res.Caps, cap)
+	}
+
+	return conn.WriteResp(res)
+}
+
+type Namespace struct {
+	commands.Namespace
+}
+
+func (cmd *Namespace) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+
+	// All mailboxes are in the personal namespace
+	mbox, err := ctx.User.GetMailbox("INBOX")
+	if err != nil {
+		return err
+	}
+	info, err := mbox.Info()
+	if err != nil {
+		return err
+	}
+
+	res := &responses.Namespace{
+		Personal: []*imap.Namespace{{Prefix: "", Delimiter: info.Delimiter}},
+	}
+	return conn.WriteResp(res)
+}
+
+type Unauthenticate struct {
+	commands.Unauthenticate
+}
+
+func (cmd *Unauthenticate) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+	if !conn.Server().Unauthenticate {
+		return errors.New("UNAUTHENTICATE is not supported")
+	}
+
+	if err := ctx.User.Logout(); err != nil {
+		return err
+	}
+
+	// All the state associated with the user is discarded, see RFC 8437
+	// section 3
+	ctx.State = imap.NotAuthenticatedState
+	ctx.User = nil
+	ctx.Mailbox = nil
+	ctx.MailboxReadOnly = false
+	ctx.Enabled = nil
+	ctx.Notify = nil
+	ctx.SavedSearch = nil
+	ctx.SearchUpdates = nil
+	return nil
+}
+
+// notifyEvents are the NOTIFY events supported by the server.
+var notifyEvents = []imap.NotifyEvent{
+	imap.NotifyMessageNew, imap.NotifyMessageExpunge, imap.NotifyFlagChange,
+	imap.NotifyMailboxName,
+}
+
+type Notify struct {
+	commands.Notify
+}
+
+func (cmd *Notify) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+	if !conn.Server().supportNotify() {
+		return errors.New("NOTIFY is not supported")
+	}
+
+	if cmd.Spec == nil {
+		ctx.Notify = nil
+		return nil
+	}
+
+	for _, g := range cmd.Spec.Groups {
+		if err := checkNotifyEvents(g); err != nil {
+			return err
+		}
+	}
+
+	ctx.Notify = cmd.Spec
+	if !cmd.Spec.Status {
+		return nil
+	}
+	uc := newUpdateContext(ctx)
+
+	mailboxes, err := ctx.User.ListMailboxes(false)
+	if err != nil {
+		return err
+	}
+	for _, mbox := range mailboxes {
+		if ctx.Mailbox != nil && ctx.Mailbox.Name() == mbox.Name() {
+			continue
+		}
+		if g := notifyGroup(uc, mbox.Name()); g == nil || len(g.Events) == 0 {
+			continue
+		}
+
+		info, err := mbox.Info()
+		if err != nil {
+			return err
+		}
+		if hasAttr(info.Attributes, imap.NoSelectAttr) {
+			continue
+		}
+
+		status, err := mbox.Status(notifyStatusItems)
+		if err != nil {
+			return err
+		}
+		if err := conn.WriteResp(&responses.Status{Mailbox: status}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNotifyEvents checks that the events of g are supported, as defined in
+// RFC 5465 section 3.1. Events which must be requested together are checked
+// when parsing the command.
+func checkNotifyEvents(g *imap.NotifyEventGroup) error {
+	for _, e := range g.Events {
+		supported := false
+		for _, se := range notifyEvents {
+			if strings.EqualFold(string(e), string(se)) {
+				supported = true
+				break
+			}
+		}
+		if supported {
+			continue
+		}
+
+		args := make([]interface{}, len(notifyEvents))
+		for i, se := range notifyEvents {
+			args[i] = string(se)
+		}
+		return ErrStatusResp(&imap.StatusResp{
+			Type:      imap.StatusRespNo,
+			Code:      imap.CodeBadEvent,
+			Arguments: []interface{}{args},
+			Info:      "Unsupported event: " + string(e),
+		})
+	}
+	return nil
+}
+
 type Create struct {
 	commands.Create
 }
@@ -66,8 +384,61 @@ func (cmd *Create) Handle(conn Conn) error {
 	if ctx.User == nil {
 		return ErrNotAuthenticated
 	}
+	if err := checkParentRights(conn, cmd.Mailbox); err != nil {
+		return err
+	}
 
-	return ctx.User.CreateMailbox(cmd.Mailbox)
+	if len(cmd.SpecialUse) > 0 {
+		if err := cmd.createSpecialUse(ctx.User); err != nil {
+			return err
+		}
+	} else if err := ctx.User.CreateMailbox(cmd.Mailbox); err != nil {
+		return err
+	}
+
+	if !conn.Server().supportObjectId() {
+		return nil
+	}
+
+	// Return the ID of the new mailbox, see RFC 8474 section 4.1
+	mbox, err := ctx.User.GetMailbox(cmd.Mailbox)
+	if err != nil {
+		return err
+	}
+	status, err := mbox.Status([]imap.StatusItem{imap.StatusMailboxId})
+	if err != nil {
+		return err
+	}
+	if status.MailboxId == "" {
+		return nil
+	}
+	return ErrStatusResp(&imap.StatusResp{
+		Type:      imap.StatusRespOk,
+		Code:      imap.CodeMailboxId,
+		Arguments: []interface{}{imap.FormatObjectId(status.MailboxId)},
+	})
+}
+
+// createSpecialUse creates a mailbox with special-use attributes, see RFC 6154
+// section 3.
+func (cmd *Create) createSpecialUse(u backend.User) error {
+	su, ok := u.(backend.SpecialUseUser)
+	if !ok {
+		return ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespBad,
+			Info: "CREATE-SPECIAL-USE not supported",
+		})
+	}
+
+	err := su.CreateMailboxWithAttributes(cmd.Mailbox, cmd.SpecialUse)
+	if err == backend.ErrUnsupportedUseAttr {
+		return ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespNo,
+			Code: imap.CodeUseAttr,
+			Info: err.Error(),
+		})
+	}
+	return err
 }
 
 type Delete struct {
@@ -80,6 +451,12 @@ func (cmd *Delete) Handle(conn Conn) error {
 		return ErrNotAuthenticated
 	}
 
+	if mbox, err := ctx.User.GetMailbox(cmd.Mailbox); err == nil {
+		if err := checkRights(conn, mbox, "x"); err != nil {
+			return err
+		}
+	}
+
 	return ctx.User.DeleteMailbox(cmd.Mailbox)
 }
 
@@ -93,6 +470,15 @@ func (cmd *Rename) Handle(conn Conn) error {
 		return ErrNotAuthenticated
 	}
 
+	if mbox, err := ctx.User.GetMailbox(cmd.Existing); err == nil {
+		if err := checkRights(conn, mbox, "x"); err != nil {
+			return err
+		}
+	}
+	if err := checkParentRights(conn, cmd.New); err != nil {
+		return err
+	}
+
 	return ctx.User.RenameMailbox(cmd.Existing, cmd.New)
 }
 
@@ -142,6 +528,10 @@ func (cmd *List) Handle(conn Conn) error {
 		return ErrNotAuthenticated
 	}
 
+	if cmd.SelectOpts != nil || cmd.ReturnOpts != nil || len(cmd.Patterns) > 1 {
+		return cmd.handleExtended(conn)
+	}
+
 	ch := make(chan *imap.MailboxInfo)
 	res := &responses.List{Mailboxes: ch, Subscribed: cmd.Subscribed}
 
@@ -151,19 +541,13 @@ func (cmd *List) Handle(conn Conn) error {
 		close(done)
 	})()
 
-	mailboxes, err := ctx.User.ListMailboxes(cmd.Subscribed)
+	mailboxes, infos, err := listMailboxes(conn, cmd.Subscribed)
 	if err != nil {
 		close(ch)
 		return err
 	}
 
-	for _, mbox := range mailboxes {
-		info, err := mbox.Info()
-		if err != nil {
-			close(ch)
-			return err
-		}
-
+	for i, info := range infos {
 		// An empty ("" string) mailbox name argument is a special request to return
 		// the hierarchy delimiter and the root name of the name given in the
 		// reference.
@@ -176,9 +560,19 @@ func (cmd *List) Handle(conn Conn) error {
 			break
 		}
 
-		if info.Match(cmd.Reference, cmd.Mailbox) {
-			ch <- info
+		if !info.Match(cmd.Reference, cmd.Mailbox) {
+			continue
+		}
+
+		// LSUB responses only include subscribed mailboxes, children
+		// attributes wouldn't be reliable
+		if !cmd.Subscribed {
+			if info, err = withChildrenAttr(mailboxes[i], info, infos); err != nil {
+				close(ch)
+				return err
+			}
 		}
+		ch <- info
 	}
 
 	close(ch)
@@ -186,78 +580,1093 @@ func (cmd *List) Handle(conn Conn) error {
 	return <-done
 }
 
-type Status struct {
-	commands.Status
+type XList struct {
+	commands.XList
 }
 
-func (cmd *Status) Handle(conn Conn) error {
+func (cmd *XList) Handle(conn Conn) error {
 	ctx := conn.Context()
 	if ctx.User == nil {
 		return ErrNotAuthenticated
 	}
-
-	mbox, err := ctx.User.GetMailbox(cmd.Mailbox)
-	if err != nil {
-		return err
+	if !conn.Server().XList {
+		return errors.New("XLIST is not supported")
 	}
 
-	status, err := mbox.Status(cmd.Items)
+	mailboxes, all, err := listMailboxes(conn, false)
 	if err != nil {
 		return err
 	}
 
-	// Only keep items thqat have been requested
-	items := make(map[imap.StatusItem]interface{})
-	for _, k := range cmd.Items {
-		items[k] = status.Items[k]
+	var infos []*imap.MailboxInfo
+	for i, info := range all {
+		if !info.Match(cmd.Reference, cmd.Mailbox) {
+			continue
+		}
+
+		info, err := withChildrenAttr(mailboxes[i], info, all)
+		if err != nil {
+			return err
+		}
+		if info.Name == imap.InboxName {
+			attrs := append([]string{}, info.Attributes...)
+			info.Attributes = append(attrs, imap.XListInboxAttr)
+		}
+		infos = append(infos, info)
 	}
-	status.Items = items
 
-	res := &responses.Status{Mailbox: status}
-	return conn.WriteResp(res)
-}
+	ch := make(chan *imap.MailboxInfo, len(infos))
+	for _, info := range infos {
+		ch <- info
+	}
+	close(ch)
 
-type Append struct {
-	commands.Append
+	return conn.WriteResp(&responses.XList{Mailboxes: ch})
 }
 
-func (cmd *Append) Handle(conn Conn) error {
+// handleExtended handles a LIST command with LIST-EXTENDED arguments, as
+// defined in RFC 5258.
+func (cmd *List) handleExtended(conn Conn) error {
 	ctx := conn.Context()
-	if ctx.User == nil {
-		return ErrNotAuthenticated
+
+	if cmd.Subscribed {
+		return ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespBad,
+			Info: "LSUB doesn't accept LIST-EXTENDED arguments",
+		})
 	}
 
-	mbox, err := ctx.User.GetMailbox(cmd.Mailbox)
-	if err == backend.ErrNoSuchMailbox {
+	var selectSubscribed, recursiveMatch, returnSubscribed bool
+	for _, opt := range cmd.SelectOpts {
+		switch opt {
+		case imap.ListSelectSubscribed:
+			selectSubscribed = true
+			returnSubscribed = true
+		case imap.ListSelectRemote:
+			// There are no remote mailboxes
+		case imap.ListSelectRecursiveMatch:
+			recursiveMatch = true
+		default:
+			return ErrStatusResp(&imap.StatusResp{
+				Type: imap.StatusRespBad,
+				Info: "Unsupported LIST selection option: " + opt,
+			})
+		}
+	}
+	if recursiveMatch && !selectSubscribed {
 		return ErrStatusResp(&imap.StatusResp{
-			Type: imap.StatusRespNo,
-			Code: imap.CodeTryCreate,
-			Info: err.Error(),
+			Type: imap.StatusRespBad,
+			Info: "RECURSIVEMATCH must be combined with another selection option",
 		})
-	} else if err != nil {
+	}
+	for _, opt := range cmd.ReturnOpts {
+		switch opt {
+		case imap.ListReturnSubscribed:
+			returnSubscribed = true
+		case imap.ListReturnChildren:
+			// Children attributes are always returned
+		default:
+			return ErrStatusResp(&imap.StatusResp{
+				Type: imap.StatusRespBad,
+				Info: "Unsupported LIST return option: " + opt,
+			})
+		}
+	}
+	if err := checkStatusItems(conn.Server(), cmd.ReturnStatus); err != nil {
 		return err
 	}
 
-	if err := mbox.CreateMessage(cmd.Flags, cmd.Date, cmd.Message); err != nil {
+	patterns := cmd.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{cmd.Mailbox}
+	}
+
+	mailboxes, infos, err := listMailboxes(conn, false)
+	if err != nil {
 		return err
 	}
 
-	// If APPEND targets the currently selected mailbox, send an untagged EXISTS
-	// Do this only if the backend doesn't send updates itself
-	if conn.Server().Updates == nil && ctx.Mailbox != nil && ctx.Mailbox.Name() == mbox.Name() {
-		status, err := mbox.Status([]imap.StatusItem{imap.StatusMessages})
+	subscribed := make(map[string]bool)
+	if returnSubscribed {
+		mailboxes, err := ctx.User.ListMailboxes(true)
 		if err != nil {
 			return err
 		}
-		status.Flags = nil
-		status.PermanentFlags = nil
-		status.UnseenSeqNum = 0
+		for _, mbox := range mailboxes {
+			subscribed[mbox.Name()] = true
+		}
+	}
 
-		res := &responses.Select{Mailbox: status}
+	for i, info := range infos {
+		matches := false
+		for _, pattern := range patterns {
+			if info.Match(cmd.Reference, pattern) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		withChildren, err := withChildrenAttr(mailboxes[i], info, infos)
+		if err != nil {
+			return err
+		}
+		resp := *withChildren
+		resp.Attributes = append([]string(nil), withChildren.Attributes...)
+		resp.ChildInfo = nil
+
+		selected := !selectSubscribed || subscribed[info.Name]
+		if !selected {
+			// Mailboxes with subscribed children are returned with
+			// RECURSIVEMATCH, see RFC 5258 section 3.5
+			if !recursiveMatch || !hasChild(infos, info, func(child *imap.MailboxInfo) bool {
+				return subscribed[child.Name]
+			}) {
+				continue
+			}
+			resp.ChildInfo = []string{imap.ListSelectSubscribed}
+		}
+
+		if returnSubscribed && subscribed[info.Name] && !hasAttr(resp.Attributes, imap.SubscribedAttr) {
+			resp.Attributes = append(resp.Attributes, imap.SubscribedAttr)
+		}
+
+		ch := make(chan *imap.MailboxInfo, 1)
+		ch <- &resp
+		close(ch)
+		if err := conn.WriteResp(&responses.List{Mailboxes: ch}); err != nil {
+			return err
+		}
+
+		// STATUS responses follow LIST responses, see RFC 5819 section 2
+		if cmd.ReturnStatus == nil || !selected || hasAttr(resp.Attributes, imap.NoSelectAttr) {
+			continue
+		}
+		status, err := mailboxStatus(conn.Server(), mailboxes[i], cmd.ReturnStatus)
+		if err != nil {
+			// Errors are not fatal, unavailable mailboxes are only listed
+			continue
+		}
+		if err := conn.WriteResp(&responses.Status{Mailbox: status}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listMailboxes returns the mailboxes the user is allowed to list, along with
+// their info.
+func listMailboxes(conn Conn, subscribed bool) ([]backend.Mailbox, []*imap.MailboxInfo, error) {
+	all, err := conn.Context().User.ListMailboxes(subscribed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mailboxes := make([]backend.Mailbox, 0, len(all))
+	infos := make([]*imap.MailboxInfo, 0, len(all))
+	for _, mbox := range all {
+		if ok, err := hasRights(conn, mbox, "l"); err != nil {
+			return nil, nil, err
+		} else if !ok {
+			continue
+		}
+
+		info, err := mbox.Info()
+		if err != nil {
+			return nil, nil, err
+		}
+		mailboxes = append(mailboxes, mbox)
+		infos = append(infos, info)
+	}
+	return mailboxes, infos, nil
+}
+
+// withChildrenAttr returns info with the \HasChildren or \HasNoChildren
+// attribute, as defined in RFC 3348. info is left untouched. If the backend
+// doesn't implement ChildrenMailbox, children are looked up in infos.
+func withChildrenAttr(mbox backend.Mailbox, info *imap.MailboxInfo, infos []*imap.MailboxInfo) (*imap.MailboxInfo, error) {
+	if hasAttr(info.Attributes, imap.HasChildrenAttr) || hasAttr(info.Attributes, imap.HasNoChildrenAttr) || hasAttr(info.Attributes, imap.NoInferiorsAttr) {
+		return info, nil
+	}
+
+	var children bool
+	if mbox, ok := mbox.(backend.ChildrenMailbox); ok {
+		var err error
+		if children, err = mbox.HasChildren(); err != nil {
+			return nil, err
+		}
+	} else {
+		children = hasChild(infos, info, nil)
+	}
+
+	attr := imap.HasNoChildrenAttr
+	if children {
+		attr = imap.HasChildrenAttr
+	}
+
+	resp := *info
+	resp.Attributes = append(append([]string(nil), info.Attributes...), attr)
+	return &resp, nil
+}
+
+// hasChild returns true if one of the descendants of parent in infos satisfies
+// f. If f is nil, any descendant is accepted.
+func hasChild(infos []*imap.MailboxInfo, parent *imap.MailboxInfo, f func(*imap.MailboxInfo) bool) bool {
+	if parent.Delimiter == "" {
+		return false
+	}
+
+	prefix := parent.Name + parent.Delimiter
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name, prefix) && (f == nil || f(info)) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAttr checks if a mailbox attribute is in attrs. Attributes are
+// case-insensitive.
+func hasAttr(attrs []string, attr string) bool {
+	for _, a := range attrs {
+		if strings.EqualFold(a, attr) {
+			return true
+		}
+	}
+	return false
+}
+
+type Status struct {
+	commands.Status
+}
+
+func (cmd *Status) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+
+	if err := checkStatusItems(conn.Server(), cmd.Items); err != nil {
+		return err
+	}
+
+	mbox, err := ctx.User.GetMailbox(cmd.Mailbox)
+	if err != nil {
+		return err
+	}
+	if err := checkRights(conn, mbox, "r"); err != nil {
+		return err
+	}
+
+	status, err := mailboxStatus(conn.Server(), mbox, cmd.Items)
+	if err != nil {
+		return err
+	}
+
+	res := &responses.Status{Mailbox: status}
+	return conn.WriteResp(res)
+}
+
+// checkStatusItems returns an error if one of the status items requires an
+// extension not supported by the backend.
+func checkStatusItems(s *Server, items []imap.StatusItem) error {
+	for _, item := range items {
+		switch item {
+		case imap.StatusMailboxId:
+			if !s.supportObjectId() {
+				return errors.New("OBJECTID is not supported")
+			}
+		case imap.StatusSize, imap.StatusDeleted:
+			if !s.supportStatusSize() {
+				return errors.New("STATUS=SIZE is not supported")
+			}
+		case imap.StatusAppendLimit:
+			if !s.supportAppendLimit() {
+				return errors.New("APPENDLIMIT is not supported")
+			}
+		}
+	}
+	return nil
+}
+
+// mailboxStatus returns the status of a mailbox, keeping only the requested
+// items.
+func mailboxStatus(s *Server, mbox backend.Mailbox, items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	status, err := mbox.Status(items)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only keep items thqat have been requested
+	requested := make(map[imap.StatusItem]interface{})
+	for _, k := range items {
+		requested[k] = status.Items[k]
+		if k == imap.StatusAppendLimit {
+			status.AppendLimit = s.appendLimit(mbox)
+		}
+	}
+	status.Items = requested
+	return status, nil
+}
+
+type Append struct {
+	commands.Append
+}
+
+func (cmd *Append) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+
+	mbox, err := ctx.User.GetMailbox(cmd.Mailbox)
+	if err == backend.ErrNoSuchMailbox {
+		return ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespNo,
+			Code: imap.CodeTryCreate,
+			Info: err.Error(),
+		})
+	} else if err != nil {
+		return err
+	}
+	if err := checkRights(conn, mbox, "i"); err != nil {
+		return err
+	}
+
+	msgs := cmd.Messages()
+	if err := prepareAppend(conn, mbox, msgs); err != nil {
+		return err
+	}
+
+	var appendUid *imap.AppendUid
+	if len(msgs) > 1 && !conn.Server().supportMultiAppend() {
+		return errors.New("MULTIAPPEND is not supported")
+	}
+	if umbox, ok := mbox.(backend.UidPlusMailbox); ok && conn.Server().supportUidPlus() {
+		appendUid, err = umbox.CreateMessagesUid(msgs)
+	} else if len(msgs) > 1 {
+		// Several messages must be appended atomically, see RFC 3502
+		mmbox, ok := mbox.(backend.MultiAppendMailbox)
+		if !ok {
+			return errors.New("MULTIAPPEND is not supported")
+		}
+		err = mmbox.CreateMessages(msgs)
+	} else {
+		err = mbox.CreateMessage(msgs[0].Flags, msgs[0].Date, msgs[0].Body)
+	}
+	if err == backend.ErrQuotaExceeded {
+		return errOverQuota
+	} else if err == backend.ErrTooBig {
+		return errTooBig
+	} else if err != nil {
+		return err
+	}
+
+	// If APPEND targets the currently selected mailbox, send an untagged EXISTS
+	// Do this only if the backend doesn't send updates itself
+	if conn.Server().Updates == nil && ctx.Mailbox != nil && ctx.Mailbox.Name() == mbox.Name() {
+		if err := writeExists(conn, mbox); err != nil {
+			return err
+		}
+	}
+
+	if appendUid != nil {
+		return ErrStatusResp(&imap.StatusResp{
+			Type:      imap.StatusRespOk,
+			Code:      imap.CodeAppendUid,
+			Arguments: appendUid.Format(),
+		})
+	}
+	return nil
+}
+
+// writeExists sends an untagged EXISTS response with the number of messages
+// in mbox.
+func writeExists(conn Conn, mbox backend.Mailbox) error {
+	status, err := mbox.Status([]imap.StatusItem{imap.StatusMessages})
+	if err != nil {
+		return err
+	}
+	status.Flags = nil
+	status.PermanentFlags = nil
+	status.UnseenSeqNum = 0
+
+	return conn.WriteResp(&responses.Select{Mailbox: status})
+}
+
+var errTooBig = ErrStatusResp(&imap.StatusResp{
+	Type: imap.StatusRespNo,
+	Code: imap.CodeTooBig,
+	Info: backend.ErrTooBig.Error(),
+})
+
+// prepareAppend checks that msgs can be appended to mbox and builds the
+// messages using CATENATE.
+func prepareAppend(conn Conn, mbox backend.Mailbox, msgs []*imap.AppendMessage) error {
+	ctx := conn.Context()
+	limit := conn.Server().appendLimit(mbox)
+	for _, msg := range msgs {
+		if msg.UTF8 && !ctx.Enabled[imap.UTF8Accept] {
+			return ErrStatusResp(&imap.StatusResp{
+				Type: imap.StatusRespBad,
+				Info: "UTF8=ACCEPT must be enabled to append UTF-8 messages",
+			})
+		}
+		if msg.Catenate == nil {
+			continue
+		}
+		user, ok := ctx.User.(backend.CatenateUser)
+		if !ok {
+			return errors.New("CATENATE is not supported")
+		}
+		var err error
+		if msg.Body, err = catenate(user, msg.Catenate); err != nil {
+			return err
+		}
+	}
+
+	// Messages larger than APPENDLIMIT are rejected with TOOBIG, see RFC 7889
+	// section 4
+	if limit > 0 {
+		for _, msg := range msgs {
+			if uint64(msg.Body.Len()) > limit {
+				return errTooBig
+			}
+		}
+	}
+
+	if user, ok := ctx.User.(backend.QuotaUser); ok {
+		size := 0
+		for _, msg := range msgs {
+			size += msg.Body.Len()
+		}
+		if err := checkQuota(user, mbox.Name(), len(msgs), size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type Idle struct {
+	commands.Idle
+}
+
+func (cmd *Idle) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+
+	if err := conn.WriteResp(&imap.ContinuationReq{Info: "idling"}); err != nil {
+		return err
+	}
+
+	doneLine := make(chan error, 1)
+	go func() {
+		doneLine <- readIdleDone(conn)
+	}()
+
+	// Updates sent by the backend through Updater are written to the client
+	// while this handler runs. Mailboxes implementing MailboxUpdater can also
+	// push updates to idling clients.
+	var updates chan interface{}
+	done := make(chan struct{})
+	idleReturned := make(chan struct{})
+	if mbox, ok := ctx.Mailbox.(backend.MailboxUpdater); ok {
+		updates = make(chan interface{})
+		go func() {
+			mbox.Idle(updates, done)
+			close(idleReturned)
+		}()
+	} else {
+		close(idleReturned)
+	}
+
+	lineRead := false
+	defer func() {
+		close(done)
+
+		// Forward updates sent before Idle returned, so that the mailbox
+		// isn't blocked
+	forward:
+		for {
+			select {
+			case item := <-updates:
+				writeIdleUpdate(conn, item)
+			case <-idleReturned:
+				break forward
+			}
+		}
+
+		if !lineRead {
+			// The connection cannot be written to anymore: close it so that
+			// readIdleDone doesn't consume the next command
+			conn.Close()
+			<-doneLine
+		}
+	}()
+
+	for {
+		select {
+		case item := <-updates:
+			if err := writeIdleUpdate(conn, item); err != nil {
+				return err
+			}
+		case err := <-doneLine:
+			lineRead = true
+			return err
+		}
+	}
+}
+
+func writeIdleUpdate(conn Conn, item interface{}) error {
+	update, res := updateResponse(item)
+	if update == nil || res == nil {
+		conn.Server().ErrorLog.Printf("unhandled update: %T\n", item)
+		return nil
+	}
+	defer backend.DoneUpdate(update)
+
+	if err := conn.WriteResp(enabledUpdateResponse(conn.Context().Enabled, item, res)); err != nil {
+		return err
+	}
+	return updateSearches(conn)
+}
+
+type GetMetadata struct {
+	commands.GetMetadata
+}
+
+func (cmd *GetMetadata) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+	if !conn.Server().supportMetadata() {
+		return errors.New("METADATA is not supported")
+	}
+
+	depth := imap.MetadataDepthZero
+	var maxSize uint32
+	if cmd.Options != nil {
+		depth, maxSize = cmd.Options.Depth, cmd.Options.MaxSize
+	}
+
+	var values map[string]string
+	var err error
+	if cmd.Mailbox == "" {
+		user, ok := ctx.User.(backend.MetadataUser)
+		if !ok {
+			return errors.New("Server metadata is not supported")
+		}
+		values, err = user.GetMetadata(cmd.Entries, depth)
+	} else {
+		var mbox backend.Mailbox
+		if mbox, err = ctx.User.GetMailbox(cmd.Mailbox); err != nil {
+			return err
+		}
+		mmbox, ok := mbox.(backend.MetadataMailbox)
+		if !ok {
+			return errors.New("Mailbox metadata is not supported")
+		}
+		values, err = mmbox.GetMetadata(cmd.Entries, depth)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Entries larger than MAXSIZE are skipped, the size of the longest one is
+	// reported, see RFC 5464 section 4.2.1
+	var longest int
+	entries := make(map[string]*string, len(values))
+	for k, v := range values {
+		if maxSize > 0 && len(v) > int(maxSize) {
+			if len(v) > longest {
+				longest = len(v)
+			}
+			continue
+		}
+		v := v
+		entries[k] = &v
+	}
+
+	if len(entries) > 0 {
+		res := &responses.Metadata{Mailbox: cmd.Mailbox, Entries: entries}
 		if err := conn.WriteResp(res); err != nil {
 			return err
 		}
 	}
 
+	if longest > 0 {
+		return ErrStatusResp(&imap.StatusResp{
+			Type:      imap.StatusRespOk,
+			Code:      imap.CodeMetadata,
+			Arguments: []interface{}{"LONGENTRIES", uint32(longest)},
+			Info:      "GETMETADATA completed",
+		})
+	}
+	return nil
+}
+
+type SetMetadata struct {
+	commands.SetMetadata
+}
+
+func (cmd *SetMetadata) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+	if !conn.Server().supportMetadata() {
+		return errors.New("METADATA is not supported")
+	}
+
+	if cmd.Mailbox == "" {
+		user, ok := ctx.User.(backend.MetadataUser)
+		if !ok {
+			return errors.New("Server metadata is not supported")
+		}
+		return user.SetMetadata(cmd.Entries)
+	}
+
+	mbox, err := ctx.User.GetMailbox(cmd.Mailbox)
+	if err != nil {
+		return err
+	}
+	mmbox, ok := mbox.(backend.MetadataMailbox)
+	if !ok {
+		return errors.New("Mailbox metadata is not supported")
+	}
+	return mmbox.SetMetadata(cmd.Entries)
+}
+
+var errOverQuota = ErrStatusResp(&imap.StatusResp{
+	Type: imap.StatusRespNo,
+	Code: imap.CodeOverQuota,
+	Info: backend.ErrQuotaExceeded.Error(),
+})
+
+// checkQuota returns errOverQuota if appending n messages whose total size is
+// size to a mailbox would exceed one of its quota roots.
+func checkQuota(user backend.QuotaUser, mailbox string, n, size int) error {
+	roots, err := user.GetQuotaRoots(mailbox)
+	if err != nil {
+		return err
+	}
+
+	for _, root := range roots {
+		quota, err := user.GetQuota(root)
+		if err != nil {
+			return err
+		}
+
+		// STORAGE is counted in units of 1024 octets
+		if res, ok := quota.Resources[imap.QuotaStorage]; ok && res.Usage+(uint64(size)+1023)/1024 > res.Limit {
+			return errOverQuota
+		}
+		if res, ok := quota.Resources[imap.QuotaMessage]; ok && res.Usage+uint64(n) > res.Limit {
+			return errOverQuota
+		}
+	}
+	return nil
+}
+
+type GetQuota struct {
+	commands.GetQuota
+}
+
+func (cmd *GetQuota) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+	user, ok := ctx.User.(backend.QuotaUser)
+	if !ok {
+		return errors.New("QUOTA is not supported")
+	}
+
+	quota, err := user.GetQuota(cmd.Root)
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteResp(&responses.Quota{Quotas: []*imap.Quota{quota}})
+}
+
+type GetQuotaRoot struct {
+	commands.GetQuotaRoot
+}
+
+func (cmd *GetQuotaRoot) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+	user, ok := ctx.User.(backend.QuotaUser)
+	if !ok {
+		return errors.New("QUOTA is not supported")
+	}
+
+	roots, err := user.GetQuotaRoots(cmd.Mailbox)
+	if err != nil {
+		return err
+	}
+
+	quotas := make([]*imap.Quota, 0, len(roots))
+	for _, root := range roots {
+		quota, err := user.GetQuota(root)
+		if err != nil {
+			return err
+		}
+		quotas = append(quotas, quota)
+	}
+
+	res := &responses.QuotaRoot{Mailbox: cmd.Mailbox, Roots: roots}
+	if err := conn.WriteResp(res); err != nil {
+		return err
+	}
+	return conn.WriteResp(&responses.Quota{Quotas: quotas})
+}
+
+type SetQuota struct {
+	commands.SetQuota
+}
+
+func (cmd *SetQuota) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return ErrNotAuthenticated
+	}
+	user, ok := ctx.User.(backend.QuotaUser)
+	if !ok {
+		return errors.New("QUOTA is not supported")
+	}
+
+	if err := user.SetQuota(cmd.Root, cmd.Limits); err != nil {
+		return err
+	}
+
+	// Send the new quota status, see RFC 9208 section 4.4
+	quota, err := user.GetQuota(cmd.Root)
+	if err != nil {
+		return err
+	}
+	return conn.WriteResp(&responses.Quota{Quotas: []*imap.Quota{quota}})
+}
+
+// readIdleDone waits for the client to end IDLE by sending DONE.
+func readIdleDone(conn Conn) error {
+	var line string
+	if r, ok := conn.(imap.StringReader); ok {
+		var err error
+		if line, err = r.ReadString('\n'); err != nil {
+			return err
+		}
+	} else {
+		// Read byte by byte so that the next command isn't consumed
+		b := make([]byte, 1)
+		for b[0] != '\n' {
+			if _, err := io.ReadFull(conn, b); err != nil {
+				return err
+			}
+			line += string(b)
+		}
+	}
+
+	if !strings.EqualFold(strings.TrimRight(line, "\r\n"), "DONE") {
+		return errors.New("Expected DONE")
+	}
+	return nil
+}
+
+// catenate builds a message from CATENATE parts. If an URL can't be resolved, a
+// BADURL response code is returned.
+func catenate(user backend.CatenateUser, parts []*imap.CatenatePart) (imap.Literal, error) {
+	var b bytes.Buffer
+	for _, part := range parts {
+		lit := part.Text
+		if lit == nil {
+			// URLs must reference a message or a body part, see RFC 4469
+			// section 5
+			var err error
+			if u, parseErr := imapurl.Parse(part.URL); parseErr != nil || u.Uid == 0 {
+				err = backend.ErrBadURL
+			} else {
+				lit, err = user.ResolveURL(part.URL)
+			}
+			if err == backend.ErrBadURL {
+				return nil, ErrStatusResp(&imap.StatusResp{
+					Type:      imap.StatusRespNo,
+					Code:      imap.CodeBadURL,
+					Arguments: []interface{}{part.URL},
+					Info:      err.Error(),
+				})
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := io.Copy(&b, lit); err != nil {
+			return nil, err
+		}
+	}
+	return &b, nil
+}
+
+var errNoPerm = ErrStatusResp(&imap.StatusResp{
+	Type: imap.StatusRespNo,
+	Code: imap.CodeNoPerm,
+	Info: "Permission denied",
+})
+
+// hasRights checks if the user has all of the rights on a mailbox. It always
+// returns true if the backend doesn't support ACL.
+func hasRights(conn Conn, mbox backend.Mailbox, rights imap.ACLRights) (bool, error) {
+	amb, ok := mbox.(backend.ACLMailbox)
+	if !ok || !conn.Server().supportACL() {
+		return true, nil
+	}
+
+	my, err := amb.MyRights()
+	if err != nil {
+		return false, err
+	}
+	return my.HasAll(rights), nil
+}
+
+// checkRights returns errNoPerm if the user lacks one of the rights on a
+// mailbox, see RFC 4314 section 4.
+func checkRights(conn Conn, mbox backend.Mailbox, rights imap.ACLRights) error {
+	if ok, err := hasRights(conn, mbox, rights); err != nil {
+		return err
+	} else if !ok {
+		return errNoPerm
+	}
 	return nil
 }
+
+// checkParentRights returns errNoPerm if the user lacks the "k" right on the
+// parent of a mailbox to be created, see RFC 4314 section 4. The nearest
+// existing ancestor is checked, top-level mailboxes aren't.
+func checkParentRights(conn Conn, name string) error {
+	u := conn.Context().User
+	if !conn.Server().supportACL() {
+		return nil
+	}
+
+	// All mailboxes are in the personal namespace
+	inbox, err := u.GetMailbox("INBOX")
+	if err != nil {
+		return nil
+	}
+	info, err := inbox.Info()
+	if err != nil || info.Delimiter == "" {
+		return nil
+	}
+
+	name = strings.TrimSuffix(name, info.Delimiter)
+	for {
+		i := strings.LastIndex(name, info.Delimiter)
+		if i <= 0 {
+			return nil
+		}
+		name = name[:i]
+
+		if mbox, err := u.GetMailbox(name); err == nil {
+			return checkRights(conn, mbox, "k")
+		}
+	}
+}
+
+// getACLMailbox returns the mailbox targeted by an ACL command, after checking
+// the user has one of the rights.
+func getACLMailbox(conn Conn, name string, rights imap.ACLRights) (backend.ACLMailbox, error) {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return nil, ErrNotAuthenticated
+	}
+	if !conn.Server().supportACL() {
+		return nil, errors.New("ACL is not supported")
+	}
+
+	mbox, err := ctx.User.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	amb, ok := mbox.(backend.ACLMailbox)
+	if !ok {
+		return nil, errors.New("ACL is not supported for this mailbox")
+	}
+
+	my, err := amb.MyRights()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(rights); i++ {
+		if my.Has(imap.ACLRight(rights[i])) {
+			return amb, nil
+		}
+	}
+	return nil, errNoPerm
+}
+
+type SetACL struct {
+	commands.SetACL
+}
+
+func (cmd *SetACL) Handle(conn Conn) error {
+	mbox, err := getACLMailbox(conn, cmd.Mailbox, "a")
+	if err != nil {
+		return err
+	}
+	return mbox.SetACL(cmd.Identifier, cmd.Mode, cmd.Rights)
+}
+
+type DeleteACL struct {
+	commands.DeleteACL
+}
+
+func (cmd *DeleteACL) Handle(conn Conn) error {
+	mbox, err := getACLMailbox(conn, cmd.Mailbox, "a")
+	if err != nil {
+		return err
+	}
+	return mbox.DeleteACL(cmd.Identifier)
+}
+
+type GetACL struct {
+	commands.GetACL
+}
+
+func (cmd *GetACL) Handle(conn Conn) error {
+	mbox, err := getACLMailbox(conn, cmd.Mailbox, "a")
+	if err != nil {
+		return err
+	}
+
+	rights, err := mbox.GetACL()
+	if err != nil {
+		return err
+	}
+	return conn.WriteResp(&responses.ACL{Mailbox: cmd.Mailbox, Rights: rights})
+}
+
+type ListRights struct {
+	commands.ListRights
+}
+
+func (cmd *ListRights) Handle(conn Conn) error {
+	mbox, err := getACLMailbox(conn, cmd.Mailbox, "a")
+	if err != nil {
+		return err
+	}
+
+	required, optional, err := mbox.ListRights(cmd.Identifier)
+	if err != nil {
+		return err
+	}
+	return conn.WriteResp(&responses.ListRights{
+		Mailbox:    cmd.Mailbox,
+		Identifier: cmd.Identifier,
+		Required:   required,
+		Optional:   optional,
+	})
+}
+
+type MyRights struct {
+	commands.MyRights
+}
+
+func (cmd *MyRights) Handle(conn Conn) error {
+	// Any right allowing to access the mailbox is enough, see RFC 4314 section
+	// 4
+	mbox, err := getACLMailbox(conn, cmd.Mailbox, "lrikxa")
+	if err != nil {
+		return err
+	}
+
+	rights, err := mbox.MyRights()
+	if err != nil {
+		return err
+	}
+	return conn.WriteResp(&responses.MyRights{Mailbox: cmd.Mailbox, Rights: rights})
+}
+
+func urlAuthUser(conn Conn) (backend.URLAuthUser, error) {
+	ctx := conn.Context()
+	if ctx.User == nil {
+		return nil, ErrNotAuthenticated
+	}
+	user, ok := ctx.User.(backend.URLAuthUser)
+	if !ok {
+		return nil, errors.New("URLAUTH is not supported")
+	}
+	return user, nil
+}
+
+type GenURLAuth struct {
+	commands.GenURLAuth
+}
+
+func (cmd *GenURLAuth) Handle(conn Conn) error {
+	user, err := urlAuthUser(conn)
+	if err != nil {
+		return err
+	}
+
+	res := &responses.GenURLAuth{URLs: make([]string, 0, len(cmd.Requests))}
+	for _, req := range cmd.Requests {
+		if !imap.IsURLAuthRump(req.URL) {
+			return ErrStatusResp(&imap.StatusResp{
+				Type: imap.StatusRespBad,
+				Info: "Not a rump URL: " + req.URL,
+			})
+		}
+
+		token, err := user.GenURLAuth(req.URL, req.Mechanism)
+		if err != nil {
+			return err
+		}
+		res.URLs = append(res.URLs, imap.FormatURLAuth(req.URL, req.Mechanism, token))
+	}
+	return conn.WriteResp(res)
+}
+
+type URLFetch struct {
+	commands.URLFetch
+}
+
+func (cmd *URLFetch) Handle(conn Conn) error {
+	user, err := urlAuthUser(conn)
+	if err != nil {
+		return err
+	}
+
+	// Invalid URLs are returned with NIL data, see RFC 4467 section 7
+	res := &responses.URLFetch{URLs: cmd.URLs, Data: make(map[string]imap.Literal)}
+	for _, url := range cmd.URLs {
+		data, err := user.URLFetch(url)
+		if err == backend.ErrBadURL {
+			continue
+		} else if err != nil {
+			return err
+		}
+		res.Data[url] = data
+	}
+	return conn.WriteResp(res)
+}
+
+type ResetKey struct {
+	commands.ResetKey
+}
+
+func (cmd *ResetKey) Handle(conn Conn) error {
+	user, err := urlAuthUser(conn)
+	if err != nil {
+		return err
+	}
+	return user.ResetKey(cmd.Mailbox, cmd.Mechanisms)
+}
@@ -2,11 +2,22 @@ package server_test
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/backendutil"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/imapurl"
 	"github.com/emersion/go-imap/server"
 )
 
@@ -126,6 +137,49 @@ func TestCreate(t *testing.T) {
 	}
 }
 
+func TestCreate_UTF8Accept(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+	s.UTF8Accept = true
+
+	io.WriteString(c, "a001 CREATE Entw&APw-rfe\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 ENABLE UTF8=ACCEPT\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ENABLED UTF8=ACCEPT" {
+		t.Fatal("Invalid ENABLED response:", scanner.Text())
+	}
+	scanner.Scan()
+
+	io.WriteString(c, "a003 CREATE \"Entwürfe/Neu\"\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 LIST \"\" Entw*\r\n")
+	var lines []string
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a004 ") {
+			break
+		}
+		lines = append(lines, scanner.Text())
+	}
+	sort.Strings(lines)
+	want := []string{
+		"* LIST (\\HasChildren) \"/\" \"Entwürfe\"",
+		"* LIST (\\HasNoChildren) \"/\" \"Entwürfe/Neu\"",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("Invalid LIST responses: %q", lines)
+	}
+}
+
 func TestCreate_NotAuthenticated(t *testing.T) {
 	s, c, scanner := testServerGreeted(t)
 	defer c.Close()
@@ -138,6 +192,88 @@ func TestCreate_NotAuthenticated(t *testing.T) {
 	}
 }
 
+// specialUseBackend is a memory backend whose users can create mailboxes with
+// the \Sent and \Trash special-use attributes.
+type specialUseBackend struct {
+	*memory.Backend
+	attrs map[string][]string
+}
+
+func (be *specialUseBackend) Login(username, password string) (backend.User, error) {
+	u, err := be.Backend.Login(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &specialUseUser{u, be}, nil
+}
+
+type specialUseUser struct {
+	backend.User
+	be *specialUseBackend
+}
+
+func (u *specialUseUser) CreateMailboxWithAttributes(name string, attrs []string) error {
+	for _, attr := range attrs {
+		if attr != imap.SentAttr && attr != imap.TrashAttr {
+			return backend.ErrUnsupportedUseAttr
+		}
+	}
+	if err := u.CreateMailbox(name); err != nil {
+		return err
+	}
+	u.be.attrs[name] = attrs
+	return nil
+}
+
+func TestCreate_SpecialUse(t *testing.T) {
+	bkd := &specialUseBackend{memory.New(), make(map[string][]string)}
+	s, c := testServerBackend(t, bkd)
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " CREATE-SPECIAL-USE") {
+		t.Fatal("CREATE-SPECIAL-USE not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 CREATE Sent (USE (\\Sent))\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+	if attrs := bkd.attrs["Sent"]; len(attrs) != 1 || attrs[0] != imap.SentAttr {
+		t.Fatalf("Invalid mailbox attributes: %v", attrs)
+	}
+
+	io.WriteString(c, "a002 CREATE Everything (USE (\\All))\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 NO [USEATTR] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 CREATE Junk (FOO (\\Junk))\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 BAD ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestCreate_SpecialUseUnsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 CREATE Sent (USE (\\Sent))\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 BAD ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
 func TestDelete(t *testing.T) {
 	s, c, scanner := testServerAuthenticated(t)
 	defer c.Close()
@@ -289,14 +425,233 @@ func TestList(t *testing.T) {
 	io.WriteString(c, "a001 LIST \"\" *\r\n")
 
 	scanner.Scan()
-	if scanner.Text() != "* LIST () \"/\" INBOX" {
+	if scanner.Text() != "* LIST (\\HasNoChildren) \"/\" INBOX" {
+		t.Fatal("Invalid LIST response:", scanner.Text())
+	}
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestXList(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 XLIST \"\" *\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	s.XList = true
+
+	io.WriteString(c, "a002 CAPABILITY\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " XLIST") {
+		t.Fatal("XLIST not advertised:", scanner.Text())
+	}
+	scanner.Scan()
+
+	io.WriteString(c, "a003 XLIST \"\" *\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* XLIST (\\HasNoChildren \\Inbox) \"/\" INBOX" {
+		t.Fatal("Invalid XLIST response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+// scanListResponses reads LIST responses until the tagged response, which is
+// returned.
+func scanListResponses(scanner *bufio.Scanner, tag string) (map[string]bool, string) {
+	lines := make(map[string]bool)
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), tag+" ") {
+			return lines, scanner.Text()
+		}
+		lines[scanner.Text()] = true
+	}
+	return lines, ""
+}
+
+// childrenBackend is a memory backend whose mailboxes implement
+// backend.ChildrenMailbox, claiming to have children hidden from the user.
+type childrenBackend struct {
+	backend.Backend
+}
+
+func (be *childrenBackend) Login(username, password string) (backend.User, error) {
+	u, err := be.Backend.Login(username, password)
+	return &childrenUser{u}, err
+}
+
+type childrenUser struct {
+	backend.User
+}
+
+func (u *childrenUser) ListMailboxes(subscribed bool) ([]backend.Mailbox, error) {
+	mailboxes, err := u.User.ListMailboxes(subscribed)
+	for i, mbox := range mailboxes {
+		mailboxes[i] = &childrenMailbox{mbox}
+	}
+	return mailboxes, err
+}
+
+type childrenMailbox struct {
+	backend.Mailbox
+}
+
+func (mbox *childrenMailbox) HasChildren() (bool, error) {
+	return true, nil
+}
+
+func TestList_ChildrenMailbox(t *testing.T) {
+	s, c := testServerBackend(t, &childrenBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " CHILDREN") {
+		t.Fatal("CHILDREN not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 LIST \"\" *\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* LIST (\\HasChildren) \"/\" INBOX" {
 		t.Fatal("Invalid LIST response:", scanner.Text())
 	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SUBSCRIBE INBOX\r\n")
+	scanner.Scan()
+
+	io.WriteString(c, "a003 LSUB \"\" *\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* LSUB () \"/\" INBOX" {
+		t.Fatal("Invalid LSUB response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestList_Extended(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	for _, name := range []string{"Parent", "Parent/Child", "Other"} {
+		io.WriteString(c, "a001 CREATE "+name+"\r\n")
+		scanner.Scan()
+	}
+	io.WriteString(c, "a001 SUBSCRIBE Parent/Child\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	tests := []struct {
+		cmd   string
+		lines []string
+	}{
+		{
+			cmd: "LIST \"\" (INBOX Parent) RETURN (CHILDREN)",
+			lines: []string{
+				"* LIST (\\HasNoChildren) \"/\" INBOX",
+				"* LIST (\\HasChildren) \"/\" Parent",
+			},
+		},
+		{
+			cmd: "LIST (SUBSCRIBED) \"\" *",
+			lines: []string{
+				"* LIST (\\HasNoChildren \\Subscribed) \"/\" Parent/Child",
+			},
+		},
+		{
+			cmd: "LIST (SUBSCRIBED RECURSIVEMATCH) \"\" %",
+			lines: []string{
+				"* LIST (\\HasChildren) \"/\" Parent (\"CHILDINFO\" (\"SUBSCRIBED\"))",
+			},
+		},
+		{
+			cmd: "LIST \"\" Other RETURN (SUBSCRIBED)",
+			lines: []string{
+				"* LIST (\\HasNoChildren) \"/\" Other",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		io.WriteString(c, "a002 "+test.cmd+"\r\n")
+		lines, status := scanListResponses(scanner, "a002")
+		if !strings.HasPrefix(status, "a002 OK ") {
+			t.Fatalf("Invalid status response for %v: %v", test.cmd, status)
+		}
+		if len(lines) != len(test.lines) {
+			t.Errorf("Invalid LIST responses for %v: got %v", test.cmd, lines)
+		}
+		for _, line := range test.lines {
+			if !lines[line] {
+				t.Errorf("Missing LIST response for %v: %v (got %v)", test.cmd, line, lines)
+			}
+		}
+	}
+}
 
+func TestList_Status(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 LIST \"\" INBOX RETURN (STATUS (MESSAGES UIDNEXT))\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* LIST (\\HasNoChildren) \"/\" INBOX" {
+		t.Fatal("Invalid LIST response:", scanner.Text())
+	}
+	scanner.Scan()
+	if scanner.Text() != "* STATUS INBOX (MESSAGES 1 UIDNEXT 7)" && scanner.Text() != "* STATUS INBOX (UIDNEXT 7 MESSAGES 1)" {
+		t.Fatal("Invalid STATUS response:", scanner.Text())
+	}
 	scanner.Scan()
 	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
 		t.Fatal("Invalid status response:", scanner.Text())
 	}
+
+	io.WriteString(c, "a002 LIST \"\" INBOX RETURN (STATUS (SIZE))\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestList_ExtendedInvalid(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	for _, cmd := range []string{
+		"LIST (RECURSIVEMATCH) \"\" *",
+		"LIST (UNKNOWN) \"\" *",
+		"LIST \"\" * RETURN (UNKNOWN)",
+	} {
+		io.WriteString(c, "a001 "+cmd+"\r\n")
+		scanner.Scan()
+		if !strings.HasPrefix(scanner.Text(), "a001 BAD ") {
+			t.Fatalf("Invalid status response for %v: %v", cmd, scanner.Text())
+		}
+	}
 }
 
 func TestList_Nested(t *testing.T) {
@@ -579,6 +934,65 @@ func TestAppend_InvalidMailbox(t *testing.T) {
 	}
 }
 
+// partialReadBackend is a memory backend whose mailboxes stop reading appended
+// messages after a few bytes and fail.
+type partialReadBackend struct {
+	backend.Backend
+}
+
+func (be *partialReadBackend) Login(username, password string) (backend.User, error) {
+	u, err := be.Backend.Login(username, password)
+	return &partialReadUser{u}, err
+}
+
+type partialReadUser struct {
+	backend.User
+}
+
+func (u *partialReadUser) GetMailbox(name string) (backend.Mailbox, error) {
+	mbox, err := u.User.GetMailbox(name)
+	return &partialReadMailbox{mbox}, err
+}
+
+type partialReadMailbox struct {
+	backend.Mailbox
+}
+
+func (mbox *partialReadMailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) error {
+	io.ReadFull(body, make([]byte, 4))
+	return errors.New("Cannot create message")
+}
+
+func TestAppend_PartiallyRead(t *testing.T) {
+	s, c := testServerBackend(t, &partialReadBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+
+	io.WriteString(c, "a001 APPEND INBOX {11}\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "+ ") {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+	io.WriteString(c, "Hello World\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// The rest of the literal must not be parsed as a command
+	io.WriteString(c, "a002 NOOP\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
 func TestAppend_NotAuthenticated(t *testing.T) {
 	s, c, scanner := testServerGreeted(t)
 	defer c.Close()
@@ -597,3 +1011,1588 @@ func TestAppend_NotAuthenticated(t *testing.T) {
 		t.Fatal("Invalid status response:", scanner.Text())
 	}
 }
+
+// idleBackend wraps a backend so that its mailboxes implement
+// backend.MailboxUpdater. When a client starts idling, the updates channel is
+// sent to idling.
+type idleBackend struct {
+	backend.Backend
+	idling chan chan<- interface{}
+}
+
+func (be *idleBackend) Login(username, password string) (backend.User, error) {
+	u, err := be.Backend.Login(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &idleUser{u, be.idling}, nil
+}
+
+type idleUser struct {
+	backend.User
+	idling chan chan<- interface{}
+}
+
+func (u *idleUser) GetMailbox(name string) (backend.Mailbox, error) {
+	mbox, err := u.User.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	return &idleMailbox{mbox, u.idling}, nil
+}
+
+type idleMailbox struct {
+	backend.Mailbox
+	idling chan chan<- interface{}
+}
+
+func (mbox *idleMailbox) Idle(updates chan<- interface{}, done <-chan struct{}) {
+	mbox.idling <- updates
+	<-done
+}
+
+func testServerIdling(t *testing.T) (s *server.Server, c net.Conn, scanner *bufio.Scanner, updates chan<- interface{}) {
+	bkd := &idleBackend{memory.New(), make(chan chan<- interface{}, 1)}
+	s, c, scanner = testServerLoggedIn(t, bkd, "INBOX")
+
+	io.WriteString(c, "a001 IDLE\r\n")
+	scanner.Scan()
+	if scanner.Text() != "+ idling" {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+
+	updates = <-bkd.idling
+	return
+}
+
+func TestIdle(t *testing.T) {
+	s, c, scanner, updates := testServerIdling(t)
+	defer c.Close()
+	defer s.Close()
+
+	status := imap.NewMailboxStatus("INBOX", []imap.StatusItem{imap.StatusMessages})
+	status.Messages = 2
+	mboxUpdate := &backend.MailboxUpdate{MailboxStatus: status}
+	mboxDone := backend.WaitUpdates(mboxUpdate)
+	updates <- mboxUpdate
+
+	scanner.Scan()
+	if scanner.Text() != "* 2 EXISTS" {
+		t.Fatal("Invalid mailbox update:", scanner.Text())
+	}
+
+	msg := imap.NewMessage(2, []imap.FetchItem{imap.FetchFlags})
+	msg.Flags = []string{imap.SeenFlag}
+	updates <- &backend.MessageUpdate{Message: msg}
+
+	scanner.Scan()
+	if scanner.Text() != "* 2 FETCH (FLAGS (\\Seen))" {
+		t.Fatal("Invalid message update:", scanner.Text())
+	}
+
+	updates <- &backend.ExpungeUpdate{SeqNum: 1}
+
+	scanner.Scan()
+	if scanner.Text() != "* 1 EXPUNGE" {
+		t.Fatal("Invalid expunge update:", scanner.Text())
+	}
+
+	<-mboxDone
+
+	io.WriteString(c, "DONE\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// The connection must still be usable
+	io.WriteString(c, "a002 NOOP\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestIdle_InvalidDone(t *testing.T) {
+	s, c, scanner, _ := testServerIdling(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a002 NOOP\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestIdle_ClientGone(t *testing.T) {
+	bkd := memory.New()
+	s, c := testServerBackend(t, bkd)
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan() // OK response
+
+	io.WriteString(c, "a001 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a001 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a002 IDLE\r\n")
+	scanner.Scan()
+	if scanner.Text() != "+ idling" {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+
+	c.Close()
+
+	// The mailbox must not be blocked by the client which has gone away
+	user, err := bkd.Login("username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- mbox.CreateMessage(nil, time.Now(), bytes.NewBufferString("Subject: Hi\r\n\r\nHi"))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal("Cannot create message:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout while creating message")
+	}
+}
+
+func TestIdle_NotAuthenticated(t *testing.T) {
+	s, c, scanner := testServerGreeted(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 IDLE\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+// updaterBackend wraps a backend so that it implements backend.Updater.
+type updaterBackend struct {
+	backend.Backend
+	updates chan interface{}
+}
+
+func (be *updaterBackend) Updates() <-chan interface{} {
+	return be.updates
+}
+
+func testServerNotify(t *testing.T) (s *server.Server, c net.Conn, scanner *bufio.Scanner, updates chan<- interface{}) {
+	bkd := &updaterBackend{memory.New(), make(chan interface{})}
+	s, c, scanner = testServerLoggedIn(t, bkd, "")
+
+	updates = bkd.updates
+	return
+}
+
+func TestNotify(t *testing.T) {
+	s, c, scanner, updates := testServerNotify(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 NOTIFY SET STATUS (MAILBOXES INBOX (MessageNew MessageExpunge MailboxName))\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "* STATUS INBOX (") || !strings.Contains(scanner.Text(), "MESSAGES 1") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	status := imap.NewMailboxStatus("INBOX", []imap.StatusItem{imap.StatusMessages})
+	status.Messages = 2
+	updates <- &backend.MailboxUpdate{
+		Update:        backend.Update{Mailbox: "INBOX"},
+		MailboxStatus: status,
+	}
+
+	// INBOX isn't selected: the update is reported with a STATUS response
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "* STATUS INBOX (") {
+		t.Fatal("Invalid mailbox update:", scanner.Text())
+	}
+
+	// FlagChange hasn't been requested
+	msg := imap.NewMessage(1, []imap.FetchItem{imap.FetchFlags})
+	updates <- &backend.MessageUpdate{
+		Update:  backend.Update{Mailbox: "INBOX"},
+		Message: msg,
+	}
+
+	updates <- &backend.MailboxNameUpdate{
+		Update: backend.Update{Mailbox: "INBOX"},
+		MailboxInfo: &imap.MailboxInfo{
+			Attributes: []string{imap.NonExistentAttr},
+			Delimiter:  "/",
+			Name:       "INBOX",
+		},
+	}
+
+	scanner.Scan()
+	if scanner.Text() != "* LIST (\\NonExistent) \"/\" INBOX" {
+		t.Fatal("Invalid mailbox name update:", scanner.Text())
+	}
+}
+
+func TestNotify_BadEvent(t *testing.T) {
+	s, c, scanner, _ := testServerNotify(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 NOTIFY SET (PERSONAL (MessageNew MessageExpunge SubscriptionChange))\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO [BADEVENT (") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// MessageNew requires MessageExpunge
+	io.WriteString(c, "a002 NOTIFY SET (PERSONAL (MessageNew))\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 BAD ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+// noSelectBackend is a memory backend reporting all mailboxes but INBOX with a
+// \NoSelect attribute.
+type noSelectBackend struct {
+	*memory.Backend
+}
+
+func (be *noSelectBackend) Login(username, password string) (backend.User, error) {
+	u, err := be.Backend.Login(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &noSelectUser{u}, nil
+}
+
+type noSelectUser struct {
+	backend.User
+}
+
+func (u *noSelectUser) ListMailboxes(subscribed bool) ([]backend.Mailbox, error) {
+	mailboxes, err := u.User.ListMailboxes(subscribed)
+	if err != nil {
+		return nil, err
+	}
+	for i, mbox := range mailboxes {
+		if mbox.Name() != "INBOX" {
+			mailboxes[i] = &noSelectMailbox{mbox}
+		}
+	}
+	return mailboxes, nil
+}
+
+type noSelectMailbox struct {
+	backend.Mailbox
+}
+
+func (mbox *noSelectMailbox) Info() (*imap.MailboxInfo, error) {
+	info, err := mbox.Mailbox.Info()
+	if err != nil {
+		return nil, err
+	}
+	// Attributes are case-insensitive
+	info.Attributes = append(info.Attributes, "\\NoSelect")
+	return info, nil
+}
+
+func TestNotify_NoSelect(t *testing.T) {
+	mem := memory.New()
+	u, err := mem.Login("username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := u.CreateMailbox("Folder"); err != nil {
+		t.Fatal(err)
+	}
+
+	bkd := &updaterBackend{&noSelectBackend{mem}, make(chan interface{})}
+	s, c, scanner := testServerLoggedIn(t, bkd, "")
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 NOTIFY SET STATUS (PERSONAL (MessageNew MessageExpunge))\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "* STATUS INBOX (") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestNotify_Unsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 NOTIFY NONE\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+// metadataBackend is a memory backend storing server and mailbox metadata.
+type metadataBackend struct {
+	*memory.Backend
+	entries map[string]map[string]string
+}
+
+func (be *metadataBackend) SupportMetadata() bool {
+	return true
+}
+
+func (be *metadataBackend) Login(username, password string) (backend.User, error) {
+	u, err := be.Backend.Login(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &metadataUser{u, be.entries}, nil
+}
+
+type metadataUser struct {
+	backend.User
+	entries map[string]map[string]string
+}
+
+func getMetadata(stored map[string]string, entries []string, depth imap.MetadataDepth) map[string]string {
+	values := make(map[string]string)
+	for _, requested := range entries {
+		for k, v := range stored {
+			if imap.MatchMetadataEntry(requested, k, depth) {
+				values[k] = v
+			}
+		}
+	}
+	return values
+}
+
+func setMetadata(stored map[string]string, entries map[string]*string) {
+	for k, v := range entries {
+		if v == nil {
+			delete(stored, k)
+		} else {
+			stored[k] = *v
+		}
+	}
+}
+
+func (u *metadataUser) GetMetadata(entries []string, depth imap.MetadataDepth) (map[string]string, error) {
+	return getMetadata(u.entries[""], entries, depth), nil
+}
+
+func (u *metadataUser) SetMetadata(entries map[string]*string) error {
+	setMetadata(u.entries[""], entries)
+	return nil
+}
+
+func (u *metadataUser) GetMailbox(name string) (backend.Mailbox, error) {
+	mbox, err := u.User.GetMailbox(name)
+	if err != nil {
+		return nil, err
+	}
+	if u.entries[name] == nil {
+		u.entries[name] = make(map[string]string)
+	}
+	return &metadataMailbox{mbox, u.entries[name]}, nil
+}
+
+type metadataMailbox struct {
+	backend.Mailbox
+	entries map[string]string
+}
+
+func (mbox *metadataMailbox) GetMetadata(entries []string, depth imap.MetadataDepth) (map[string]string, error) {
+	return getMetadata(mbox.entries, entries, depth), nil
+}
+
+func (mbox *metadataMailbox) SetMetadata(entries map[string]*string) error {
+	setMetadata(mbox.entries, entries)
+	return nil
+}
+
+func testServerMetadata(t *testing.T) (s *server.Server, c net.Conn, scanner *bufio.Scanner) {
+	bkd := &metadataBackend{memory.New(), map[string]map[string]string{
+		"": {"/shared/admin": "mailto:admin@example.org"},
+	}}
+	return testServerLoggedIn(t, bkd, "", "METADATA")
+}
+
+func TestMetadata_Server(t *testing.T) {
+	s, c, scanner := testServerMetadata(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 GETMETADATA \"\" /shared/admin\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* METADATA \"\" (/shared/admin \"mailto:admin@example.org\")" {
+		t.Fatal("Invalid METADATA response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestMetadata_Mailbox(t *testing.T) {
+	s, c, scanner := testServerMetadata(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 SETMETADATA INBOX (/private/comment \"My comment\" /shared/vendor/foo/bar \"A longer value\")\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 GETMETADATA (MAXSIZE 10 DEPTH infinity) INBOX (/private /shared)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* METADATA \"INBOX\" (/private/comment \"My comment\")" {
+		t.Fatal("Invalid METADATA response:", scanner.Text())
+	}
+	scanner.Scan()
+	if scanner.Text() != "a002 OK [METADATA LONGENTRIES 14] GETMETADATA completed" {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 SETMETADATA INBOX (/private/comment NIL)\r\n")
+	scanner.Scan()
+	io.WriteString(c, "a004 GETMETADATA INBOX /private/comment\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestMetadata_InvalidEntry(t *testing.T) {
+	s, c, scanner := testServerMetadata(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 GETMETADATA INBOX /comment\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 BAD ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestMetadata_Unsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 GETMETADATA INBOX /shared/comment\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+// quotaBackend is a memory backend whose users have a single quota root, "",
+// shared by all mailboxes.
+type quotaBackend struct {
+	*memory.Backend
+	quota *imap.Quota
+}
+
+func (be *quotaBackend) Login(username, password string) (backend.User, error) {
+	u, err := be.Backend.Login(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &quotaUser{u, be.quota}, nil
+}
+
+type quotaUser struct {
+	backend.User
+	quota *imap.Quota
+}
+
+func (u *quotaUser) GetQuota(root string) (*imap.Quota, error) {
+	if root != u.quota.Root {
+		return nil, backend.ErrNoSuchQuotaRoot
+	}
+	return u.quota, nil
+}
+
+func (u *quotaUser) GetQuotaRoots(mailbox string) ([]string, error) {
+	if _, err := u.GetMailbox(mailbox); err != nil {
+		return nil, err
+	}
+	return []string{u.quota.Root}, nil
+}
+
+func (u *quotaUser) SetQuota(root string, limits map[string]uint64) error {
+	if root != u.quota.Root {
+		return backend.ErrNoSuchQuotaRoot
+	}
+	resources := make(map[string]*imap.QuotaResource, len(limits))
+	for name, limit := range limits {
+		res := &imap.QuotaResource{Limit: limit}
+		if old, ok := u.quota.Resources[name]; ok {
+			res.Usage = old.Usage
+		}
+		resources[name] = res
+	}
+	u.quota.Resources = resources
+	return nil
+}
+
+func testServerQuota(t *testing.T) (s *server.Server, c net.Conn, scanner *bufio.Scanner) {
+	bkd := &quotaBackend{memory.New(), &imap.Quota{
+		Root: "",
+		Resources: map[string]*imap.QuotaResource{
+			imap.QuotaStorage: {Usage: 10, Limit: 11},
+		},
+	}}
+	return testServerLoggedIn(t, bkd, "", "QUOTA")
+}
+
+func TestQuota(t *testing.T) {
+	s, c, scanner := testServerQuota(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 GETQUOTAROOT INBOX\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* QUOTAROOT INBOX \"\"" {
+		t.Fatal("Invalid QUOTAROOT response:", scanner.Text())
+	}
+	scanner.Scan()
+	if scanner.Text() != "* QUOTA \"\" (STORAGE 10 11)" {
+		t.Fatal("Invalid QUOTA response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SETQUOTA \"\" (STORAGE 512 MESSAGE 100)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* QUOTA \"\" (MESSAGE 0 100 STORAGE 10 512)" {
+		t.Fatal("Invalid QUOTA response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 GETQUOTA idontexist\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestAppend_OverQuota(t *testing.T) {
+	s, c, scanner := testServerQuota(t)
+	defer c.Close()
+	defer s.Close()
+
+	// 11 octets are counted as one STORAGE unit: the message fits
+	io.WriteString(c, "a001 APPEND INBOX {11}\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "+ ") {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+	io.WriteString(c, "Hello World\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 APPEND INBOX {1025}\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "+ ") {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+	io.WriteString(c, strings.Repeat("a", 1025)+"\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 NO [OVERQUOTA] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestQuota_Unsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 GETQUOTAROOT INBOX\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type multiAppendBackend struct {
+	*memory.Backend
+}
+
+func (be *multiAppendBackend) SupportMultiAppend() bool {
+	return true
+}
+
+func TestAppend_Multiple(t *testing.T) {
+	s, c := testServerBackend(t, &multiAppendBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " MULTIAPPEND") {
+		t.Fatal("MULTIAPPEND not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 APPEND INBOX {11}\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "+ ") {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+
+	io.WriteString(c, "Hello World (\\Draft) \"5-Nov-1984 13:37:00 -0700\" {5}\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "+ ") {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+
+	io.WriteString(c, "Hello\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 STATUS INBOX (MESSAGES)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* STATUS INBOX (MESSAGES 3)" {
+		t.Fatal("Invalid STATUS response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestAppend_MultipleUnsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 APPEND INBOX {11}\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "+ ") {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+
+	io.WriteString(c, "Hello World {5}\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "+ ") {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+
+	io.WriteString(c, "Hello\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+// catenateBackend is a memory backend whose users can resolve URLs of the form
+// "/<mailbox>/;UID=<uid>", referencing a whole message.
+type catenateBackend struct {
+	*memory.Backend
+}
+
+func (be *catenateBackend) Login(username, password string) (backend.User, error) {
+	u, err := be.Backend.Login(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &catenateUser{u}, nil
+}
+
+type catenateUser struct {
+	backend.User
+}
+
+func (u *catenateUser) ResolveURL(url string) (imap.Literal, error) {
+	parsed, err := imapurl.Parse(url)
+	if err != nil || parsed.Host != "" || parsed.Section != "" {
+		return nil, backend.ErrBadURL
+	}
+	return resolveMessage(u, parsed)
+}
+
+// resolveMessage returns the body of the message referenced by an IMAP URL.
+func resolveMessage(u backend.User, url *imapurl.URL) (imap.Literal, error) {
+	mbox, err := u.GetMailbox(url.Mailbox)
+	if err != nil {
+		return nil, backend.ErrBadURL
+	}
+	for _, msg := range mbox.(*memory.Mailbox).Messages {
+		if msg.Uid == url.Uid {
+			return bytes.NewReader(msg.Body), nil
+		}
+	}
+	return nil, backend.ErrBadURL
+}
+
+func testServerCatenate(t *testing.T) (s *server.Server, c net.Conn, scanner *bufio.Scanner, bkd *catenateBackend) {
+	bkd = &catenateBackend{memory.New()}
+	s, c, scanner = testServerLoggedIn(t, bkd, "", "CATENATE")
+	return
+}
+
+func TestAppend_Catenate(t *testing.T) {
+	s, c, scanner, bkd := testServerCatenate(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 APPEND INBOX (\\Draft) CATENATE (URL \"/INBOX/;UID=6\" TEXT {6}\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "+ ") {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+
+	io.WriteString(c, "Footer)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	u, err := bkd.Backend.Login("username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mbox, err := u.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := mbox.(*memory.Mailbox).Messages
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 messages, got %v", len(msgs))
+	}
+	want := string(msgs[0].Body) + "Footer"
+	if string(msgs[1].Body) != want {
+		t.Fatalf("Invalid catenated message: got %q, want %q", msgs[1].Body, want)
+	}
+	if len(msgs[1].Flags) != 1 || msgs[1].Flags[0] != imap.DraftFlag {
+		t.Fatalf("Invalid catenated message flags: %v", msgs[1].Flags)
+	}
+}
+
+func TestAppend_CatenateBadURL(t *testing.T) {
+	s, c, scanner, _ := testServerCatenate(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 APPEND INBOX CATENATE (URL \"/INBOX/;UID=42\")\r\n")
+	scanner.Scan()
+	if scanner.Text() != "a001 NO [BADURL /INBOX/;UID=42] Invalid URL" {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// URLs which don't reference a message are rejected by the server
+	io.WriteString(c, "a002 APPEND INBOX CATENATE (URL \"/INBOX\")\r\n")
+	scanner.Scan()
+	if scanner.Text() != "a002 NO [BADURL /INBOX] Invalid URL" {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestAppend_CatenateUnsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 APPEND INBOX CATENATE (URL \"/INBOX/;UID=6\")\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestAppend_NonSyncLiteral(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	// The server must not send a continuation request
+	io.WriteString(c, "a001 APPEND INBOX {11+}\r\nHello World\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestAppend_LiteralMinus(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot listen:", err)
+	}
+
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.LiteralMinus = true
+	go s.Serve(l)
+	defer s.Close()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("Cannot connect to server:", err)
+	}
+	defer c.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+	if !strings.Contains(scanner.Text(), " LITERAL- ") {
+		t.Fatal("LITERAL- not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+
+	large := strings.Repeat("a", imap.LiteralMinusMax+1)
+	io.WriteString(c, "a001 APPEND INBOX {"+fmt.Sprint(len(large))+"+}\r\n"+large+"\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "* BAD ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// The literal must have been discarded
+	io.WriteString(c, "a002 NOOP\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type objectIdBackend struct {
+	*memory.Backend
+}
+
+func (be *objectIdBackend) SupportObjectId() bool {
+	return true
+}
+
+func TestObjectId(t *testing.T) {
+	s, c := testServerBackend(t, &objectIdBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " OBJECTID") {
+		t.Fatal("OBJECTID not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 CREATE Drafts\r\n")
+	scanner.Scan()
+	if scanner.Text() != "a001 OK [MAILBOXID (F1)] CREATE completed" {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 RENAME Drafts Templates\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 STATUS Templates (MAILBOXID)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* STATUS Templates (MAILBOXID (F1))" {
+		t.Fatal("Invalid STATUS response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 SELECT INBOX\r\n")
+	found := false
+	for scanner.Scan() {
+		if scanner.Text() == "* OK [MAILBOXID (F2)] Mailbox ID" {
+			found = true
+		}
+		if strings.HasPrefix(scanner.Text(), "a004 ") {
+			break
+		}
+	}
+	if !found {
+		t.Error("MAILBOXID not returned by SELECT")
+	}
+
+	io.WriteString(c, "a005 FETCH 1 (EMAILID THREADID)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "* 1 FETCH (EMAILID (M") || !strings.HasSuffix(scanner.Text(), ") THREADID NIL)") {
+		t.Fatal("Invalid FETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a005 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestObjectId_Unsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 STATUS INBOX (MAILBOXID)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a002 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a003 FETCH 1 (EMAILID)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type statusSizeBackend struct {
+	*memory.Backend
+}
+
+func (be *statusSizeBackend) SupportStatusSize() bool {
+	return true
+}
+
+func TestStatus_Size(t *testing.T) {
+	s, c := testServerBackend(t, &statusSizeBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " STATUS=SIZE") {
+		t.Fatal("STATUS=SIZE not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 APPEND INBOX (\\Deleted) {5}\r\n")
+	scanner.Scan()
+	io.WriteString(c, "Hello\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 STATUS INBOX (DELETED)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* STATUS INBOX (DELETED 1)" {
+		t.Fatal("Invalid STATUS response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 STATUS INBOX (SIZE)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "* STATUS INBOX (SIZE ") {
+		t.Fatal("Invalid STATUS response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestStatus_SizeUnsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 STATUS INBOX (MESSAGES SIZE)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type aclBackend struct {
+	*memory.Backend
+}
+
+func (be *aclBackend) SupportACL() bool {
+	return true
+}
+
+// scanTagged scans lines until the tagged response with the provided tag.
+func scanTagged(scanner *bufio.Scanner, tag string) string {
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), tag+" ") {
+			return scanner.Text()
+		}
+	}
+	return ""
+}
+
+func TestACL(t *testing.T) {
+	s, c := testServerBackend(t, &aclBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " ACL RIGHTS=texk") {
+		t.Fatal("ACL not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 MYRIGHTS INBOX\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* MYRIGHTS INBOX lrswipkxtea" {
+		t.Fatal("Invalid MYRIGHTS response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SETACL INBOX anyone +lr\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 GETACL INBOX\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ACL INBOX anyone lr username lrswipkxtea" {
+		t.Fatal("Invalid ACL response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 LISTRIGHTS INBOX anyone\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* LISTRIGHTS INBOX anyone \"\" l r s w i p k x t e a" {
+		t.Fatal("Invalid LISTRIGHTS response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a005 DELETEACL INBOX anyone\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a005 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestACL_Rights(t *testing.T) {
+	s, c := testServerBackend(t, &aclBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+
+	io.WriteString(c, "a001 SETACL INBOX username lra\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SELECT INBOX\r\n")
+	if resp := scanTagged(scanner, "a002"); !strings.HasPrefix(resp, "a002 OK ") {
+		t.Fatal("Invalid status response:", resp)
+	}
+
+	io.WriteString(c, "a003 STORE 1 +FLAGS (\\Deleted)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 NO [NOPERM] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 EXPUNGE\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 NO [NOPERM] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a005 APPEND INBOX {5}\r\n")
+	scanner.Scan() // Continuation request
+	io.WriteString(c, "Hello\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a005 NO [NOPERM] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a006 SETACL INBOX username -lr\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a006 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a007 STATUS INBOX (MESSAGES)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a007 NO [NOPERM] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a008 LIST \"\" *\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a008 OK ") {
+		t.Fatal("Expected no mailbox to be listed:", scanner.Text())
+	}
+
+	io.WriteString(c, "a009 SETACL INBOX username -a\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a009 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a010 GETACL INBOX\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a010 NO [NOPERM] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestACL_Close(t *testing.T) {
+	s, c := testServerBackend(t, &aclBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+
+	io.WriteString(c, "a001 SETACL INBOX username -e\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SELECT INBOX\r\n")
+	if resp := scanTagged(scanner, "a002"); !strings.HasPrefix(resp, "a002 OK ") {
+		t.Fatal("Invalid status response:", resp)
+	}
+
+	io.WriteString(c, "a003 STORE 1 +FLAGS.SILENT (\\Deleted)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// The mailbox is closed without expunging messages
+	io.WriteString(c, "a004 CLOSE\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a005 STATUS INBOX (MESSAGES)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* STATUS INBOX (MESSAGES 1)" {
+		t.Fatal("Invalid STATUS response:", scanner.Text())
+	}
+	scanner.Scan()
+
+	// Nor are they if the mailbox is read-only
+	io.WriteString(c, "a006 SETACL INBOX username +e\r\n")
+	scanner.Scan()
+	io.WriteString(c, "a007 EXAMINE INBOX\r\n")
+	if resp := scanTagged(scanner, "a007"); !strings.HasPrefix(resp, "a007 OK ") {
+		t.Fatal("Invalid status response:", resp)
+	}
+	io.WriteString(c, "a008 CLOSE\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a008 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a009 STATUS INBOX (MESSAGES)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* STATUS INBOX (MESSAGES 1)" {
+		t.Fatal("Invalid STATUS response:", scanner.Text())
+	}
+}
+
+func TestACL_CreateRename(t *testing.T) {
+	s, c := testServerBackend(t, &aclBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+
+	io.WriteString(c, "a001 CREATE Archive\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SETACL Archive username -k\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 CREATE Archive/2017\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 NO [NOPERM] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// The nearest existing ancestor is checked
+	io.WriteString(c, "a004 CREATE Archive/2017/Q1\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 NO [NOPERM] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a005 CREATE Drafts\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a005 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a006 RENAME Drafts Archive/Drafts\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a006 NO [NOPERM] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a007 SETACL Archive username +k\r\n")
+	scanner.Scan()
+	io.WriteString(c, "a008 RENAME Drafts Archive/Drafts\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a008 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestACL_Unsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 GETACL INBOX\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+// urlAuthBackend is a memory backend whose users can authorize URLs of the form
+// "imap://username@localhost/<mailbox>/;uid=<uid>;urlauth=<access>".
+type urlAuthBackend struct {
+	*memory.Backend
+	key []byte
+}
+
+func (be *urlAuthBackend) Login(username, password string) (backend.User, error) {
+	u, err := be.Backend.Login(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &urlAuthUser{u, be}, nil
+}
+
+type urlAuthUser struct {
+	backend.User
+	be *urlAuthBackend
+}
+
+func (u *urlAuthUser) GenURLAuth(rump, mechanism string) (string, error) {
+	if mechanism != imap.URLAuthInternal || !strings.HasPrefix(rump, "imap://"+u.Username()+"@localhost/") {
+		return "", backend.ErrURLAuthUnsupported
+	}
+	return backendutil.URLAuthToken(u.be.key, rump), nil
+}
+
+func (u *urlAuthUser) URLFetch(url string) (imap.Literal, error) {
+	rump, ok := backendutil.CheckURLAuth(u.be.key, url)
+	if !ok {
+		return nil, backend.ErrBadURL
+	}
+
+	parsed, err := imapurl.Parse(rump)
+	if err != nil || parsed.User != u.Username() || parsed.Host != "localhost" {
+		return nil, backend.ErrBadURL
+	}
+	return resolveMessage(u, parsed)
+}
+
+func (u *urlAuthUser) ResetKey(mailbox string, mechanisms []string) error {
+	u.be.key = append(u.be.key, 'x')
+	return nil
+}
+
+func TestURLAuth(t *testing.T) {
+	s, c := testServerBackend(t, &urlAuthBackend{memory.New(), []byte("secret")})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " URLAUTH") {
+		t.Fatal("URLAUTH not advertised:", scanner.Text())
+	}
+
+	rump := "imap://username@localhost/INBOX/;uid=6;urlauth=anonymous"
+	io.WriteString(c, "a001 GENURLAUTH \""+rump+"\" INTERNAL\r\n")
+	scanner.Scan()
+	prefix := "* GENURLAUTH \"" + rump + ":INTERNAL:"
+	if !strings.HasPrefix(scanner.Text(), prefix) {
+		t.Fatal("Invalid GENURLAUTH response:", scanner.Text())
+	}
+	url := strings.TrimSuffix(strings.TrimPrefix(scanner.Text(), "* GENURLAUTH \""), "\"")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 URLFETCH \""+url+"\" \""+rump+":INTERNAL:0000\"\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "* URLFETCH \""+url+"\" {") {
+		t.Fatal("Invalid URLFETCH response:", scanner.Text())
+	}
+	for scanner.Scan() {
+		if strings.HasSuffix(scanner.Text(), ":INTERNAL:0000\" NIL") {
+			break
+		}
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 RESETKEY\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 URLFETCH \""+url+"\"\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* URLFETCH \""+url+"\" NIL" {
+		t.Fatal("Invalid URLFETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+
+	io.WriteString(c, "a005 GENURLAUTH \"imap://username@localhost/INBOX/;uid=6\" INTERNAL\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a005 BAD ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a006 GENURLAUTH \"imap://fred@localhost/INBOX/;uid=6;urlauth=anonymous\" INTERNAL\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a006 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestURLAuth_Unsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 URLFETCH \"imap://username@localhost/INBOX/;uid=6;urlauth=anonymous:INTERNAL:0000\"\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 NAMESPACE\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* NAMESPACE ((\"\" \"/\")) NIL NIL" {
+		t.Fatal("Invalid NAMESPACE response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestUnauthenticate(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+	s.Unauthenticate = true
+
+	io.WriteString(c, "a001 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a001 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a002 UNAUTHENTICATE\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 SELECT INBOX\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestUnauthenticate_Unsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 UNAUTHENTICATE\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type appendLimitBackend struct {
+	*memory.Backend
+}
+
+func (be *appendLimitBackend) AppendLimit() uint64 {
+	return 10
+}
+
+func TestAppend_AppendLimit(t *testing.T) {
+	s, c := testServerBackend(t, &appendLimitBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " APPENDLIMIT=10") {
+		t.Fatal("APPENDLIMIT not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 STATUS INBOX (APPENDLIMIT)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* STATUS INBOX (APPENDLIMIT 10)" {
+		t.Fatal("Invalid STATUS response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 APPEND INBOX {11+}\r\nHello World\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 NO [TOOBIG] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 APPEND INBOX {5+}\r\nHello\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// Synchronizing literals are rejected before being sent
+	io.WriteString(c, "a004 APPEND INBOX (\\Seen) {11}\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 NO [TOOBIG] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a005 NOOP\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a005 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestStatus_AppendLimitUnsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 STATUS INBOX (APPENDLIMIT)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
@@ -7,6 +7,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
 	"github.com/emersion/go-imap/internal"
 )
 
@@ -30,7 +33,7 @@ func TestStartTLS(t *testing.T) {
 
 	io.WriteString(c, "a001 CAPABILITY\r\n")
 	scanner.Scan()
-	if scanner.Text() != "* CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED" {
+	if scanner.Text() != "* CAPABILITY IMAP4rev1 LITERAL+ STARTTLS LOGINDISABLED" {
 		t.Fatal("Bad CAPABILITY response:", scanner.Text())
 	}
 	scanner.Scan()
@@ -50,7 +53,7 @@ func TestStartTLS(t *testing.T) {
 	scanner = bufio.NewScanner(sc)
 
 	scanner.Scan()
-	if scanner.Text() != "* CAPABILITY IMAP4rev1 AUTH=PLAIN" {
+	if scanner.Text() != "* CAPABILITY IMAP4rev1 LITERAL+ SASL-IR AUTH=PLAIN" {
 		t.Fatal("Bad CAPABILITY response:", scanner.Text())
 	}
 }
@@ -81,6 +84,44 @@ func TestLogin_No(t *testing.T) {
 	}
 }
 
+type referralBackend struct {
+	*memory.Backend
+}
+
+func (be *referralBackend) SupportLoginReferrals() bool {
+	return true
+}
+
+func (be *referralBackend) SupportMailboxReferrals() bool {
+	return false
+}
+
+func (be *referralBackend) Login(username, password string) (backend.User, error) {
+	if username == "fred" {
+		return nil, &imap.ReferralError{URL: "imap://fred@server2/"}
+	}
+	return be.Backend.Login(username, password)
+}
+
+func TestLogin_Referral(t *testing.T) {
+	s, c := testServerBackend(t, &referralBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+	if !strings.Contains(scanner.Text(), " LOGIN-REFERRALS") {
+		t.Fatal("LOGIN-REFERRALS not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 LOGIN fred password\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO [REFERRAL imap://fred@server2/] ") {
+		t.Fatal("Bad status response:", scanner.Text())
+	}
+}
+
 func TestAuthenticate_Plain_Ok(t *testing.T) {
 	s, c, scanner := testServerGreeted(t)
 	defer c.Close()
@@ -102,6 +143,33 @@ func TestAuthenticate_Plain_Ok(t *testing.T) {
 	}
 }
 
+func TestAuthenticate_Plain_InitialResponse(t *testing.T) {
+	s, c, scanner := testServerGreeted(t)
+	defer c.Close()
+	defer s.Close()
+
+	// The exchange completes without any continuation request
+	io.WriteString(c, "a001 AUTHENTICATE PLAIN AHVzZXJuYW1lAHBhc3N3b3Jk\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Bad status response:", scanner.Text())
+	}
+}
+
+func TestAuthenticate_Plain_InvalidInitialResponse(t *testing.T) {
+	s, c, scanner := testServerGreeted(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 AUTHENTICATE PLAIN AHVzZXJuYW1lAHBhc3N3b6Jk\r\n")
+
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Bad status response:", scanner.Text())
+	}
+}
+
 func TestAuthenticate_Plain_No(t *testing.T) {
 	s, c, scanner := testServerGreeted(t)
 	defer c.Close()
@@ -2,8 +2,10 @@ package server
 
 import (
 	"errors"
+	"sort"
 
 	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
 	"github.com/emersion/go-imap/commands"
 	"github.com/emersion/go-imap/responses"
 )
@@ -49,9 +51,23 @@ func (cmd *Close) Handle(conn Conn) error {
 	}
 
 	mailbox := ctx.Mailbox
+	readOnly := ctx.MailboxReadOnly
 	ctx.Mailbox = nil
 	ctx.MailboxReadOnly = false
+	ctx.SavedSearch = nil
+	ctx.SearchUpdates = nil
 
+	// Messages aren't expunged if the mailbox is read-only or if the user
+	// lacks the "e" right, but the mailbox is closed anyway, see RFC 4314
+	// section 4
+	if readOnly {
+		return nil
+	}
+	if ok, err := hasRights(conn, mailbox, "e"); err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
 	if err := mailbox.Expunge(); err != nil {
 		return err
 	}
@@ -60,11 +76,29 @@ func (cmd *Close) Handle(conn Conn) error {
 	return nil
 }
 
+type Unselect struct {
+	commands.Unselect
+}
+
+func (cmd *Unselect) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return ErrNoMailboxSelected
+	}
+
+	// Same as CLOSE, without expunging messages, see RFC 3691 section 2
+	ctx.Mailbox = nil
+	ctx.MailboxReadOnly = false
+	ctx.SavedSearch = nil
+	ctx.SearchUpdates = nil
+	return nil
+}
+
 type Expunge struct {
 	commands.Expunge
 }
 
-func (cmd *Expunge) Handle(conn Conn) error {
+func (cmd *Expunge) handle(uid bool, conn Conn) error {
 	ctx := conn.Context()
 	if ctx.Mailbox == nil {
 		return ErrNoMailboxSelected
@@ -73,50 +107,98 @@ func (cmd *Expunge) Handle(conn Conn) error {
 		return ErrMailboxReadOnly
 	}
 
+	// UID EXPUNGE only expunges the messages in SeqSet, see RFC 4315 section
+	// 2.1
+	var mbox backend.UidPlusMailbox
+	if uid {
+		var ok bool
+		if mbox, ok = ctx.Mailbox.(backend.UidPlusMailbox); !ok || !conn.Server().supportUidPlus() {
+			return errors.New("UID EXPUNGE is not supported")
+		}
+		if cmd.SeqSet == nil {
+			return errors.New("Missing UID EXPUNGE sequence set")
+		}
+	} else if cmd.SeqSet != nil {
+		return errors.New("EXPUNGE doesn't take any argument")
+	}
+	if err := checkRights(conn, ctx.Mailbox, "e"); err != nil {
+		return err
+	}
+
 	// Get a list of messages that will be deleted
 	// That will allow us to send expunge updates if the backend doesn't support it
+	// Once QRESYNC is enabled, UIDs are sent in a VANISHED response instead
+	vanished := ctx.Enabled["QRESYNC"]
 	var seqnums []uint32
 	if conn.Server().Updates == nil {
 		criteria := &imap.SearchCriteria{
 			WithFlags: []string{imap.DeletedFlag},
+			Uid:       cmd.SeqSet,
 		}
 
 		var err error
-		seqnums, err = ctx.Mailbox.SearchMessages(false, criteria)
+		seqnums, err = ctx.Mailbox.SearchMessages(vanished, criteria)
 		if err != nil {
 			return err
 		}
 	}
 
-	if err := ctx.Mailbox.Expunge(); err != nil {
+	var err error
+	if uid {
+		err = mbox.UidExpunge(cmd.SeqSet)
+	} else {
+		err = ctx.Mailbox.Expunge()
+	}
+	if err != nil {
 		return err
 	}
 
-	// If the backend doesn't support expunge updates, let's do it ourselves
 	if conn.Server().Updates == nil {
-		done := make(chan error)
-		defer close(done)
+		return writeExpunged(conn, vanished, seqnums)
+	}
+	return nil
+}
 
-		ch := make(chan uint32)
-		res := &responses.Expunge{SeqNums: ch}
+// writeExpunged sends EXPUNGE responses for the messages with the sequence
+// numbers ids, or a VANISHED response if vanished is true and ids are UIDs.
+// This is used if the backend doesn't support expunge updates.
+func writeExpunged(conn Conn, vanished bool, ids []uint32) error {
+	if vanished {
+		if len(ids) == 0 {
+			return nil
+		}
 
-		go (func() {
-			done <- conn.WriteResp(res)
-		})()
+		uids := new(imap.SeqSet)
+		uids.AddNum(ids...)
+		return conn.WriteResp(&responses.Vanished{Uids: uids})
+	}
 
-		// Iterate sequence numbers from the last one to the first one, as deleting
-		// messages changes their respective numbers
-		for i := len(seqnums) - 1; i >= 0; i-- {
-			ch <- seqnums[i]
-		}
-		close(ch)
+	done := make(chan error)
+	defer close(done)
 
-		if err := <-done; err != nil {
-			return err
-		}
+	ch := make(chan uint32)
+	res := &responses.Expunge{SeqNums: ch}
+
+	go (func() {
+		done <- conn.WriteResp(res)
+	})()
+
+	// Iterate sequence numbers from the last one to the first one, as deleting
+	// messages changes their respective numbers
+	for i := len(ids) - 1; i >= 0; i-- {
+		ch <- ids[i]
 	}
+	close(ch)
 
-	return nil
+	return <-done
+}
+
+func (cmd *Expunge) Handle(conn Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Expunge) UidHandle(conn Conn) error {
+	return cmd.handle(true, conn)
 }
 
 type Search struct {
@@ -129,13 +211,519 @@ func (cmd *Search) handle(uid bool, conn Conn) error {
 		return ErrNoMailboxSelected
 	}
 
-	ids, err := ctx.Mailbox.SearchMessages(uid, cmd.Criteria)
+	var mbox backend.ModSeqMailbox
+	if hasModSeqCriteria(cmd.Criteria) {
+		var ok bool
+		if mbox, ok = ctx.Mailbox.(backend.ModSeqMailbox); !ok || !conn.Server().supportModSeq() {
+			return errors.New("MODSEQ search criterion is not supported")
+		}
+		enableCondStore(ctx)
+	}
+	if hasSaveDateCriteria(cmd.Criteria) && !conn.Server().supportSaveDate() {
+		return errors.New("SAVEDATE search criteria are not supported")
+	}
+	if hasAnnotationCriteria(cmd.Criteria) && !conn.Server().supportAnnotate() {
+		return errors.New("ANNOTATION search criteria are not supported")
+	}
+	if hasWithinCriteria(cmd.Criteria) && !conn.Server().supportWithin() {
+		return errors.New("YOUNGER and OLDER search criteria are not supported")
+	}
+
+	save, update := false, false
+	var opts []string
+	for _, opt := range cmd.Return {
+		switch opt {
+		case imap.SearchReturnMin, imap.SearchReturnMax, imap.SearchReturnAll, imap.SearchReturnCount:
+			opts = append(opts, opt)
+		case imap.SearchReturnSave:
+			save = true
+		case imap.SearchReturnUpdate:
+			update = true
+		case imap.SearchReturnContext:
+			// Only a hint, see RFC 5267 section 4.2
+		default:
+			return errors.New("Unsupported search return option: " + opt)
+		}
+	}
+
+	criteria, err := resolveSavedCriteria(ctx, cmd.Criteria)
 	if err != nil {
 		return err
 	}
 
-	res := &responses.Search{Ids: ids}
-	return conn.WriteResp(res)
+	// The saved result is reset if the search fails, see RFC 5182 section 2.1
+	if save {
+		ctx.SavedSearch = nil
+	}
+
+	ids, err := ctx.Mailbox.SearchMessages(uid, criteria)
+	if err != nil {
+		return err
+	}
+
+	if update {
+		mbox := ctx.Mailbox
+		err := AddSearchUpdate(ctx, &SearchUpdate{
+			Tag: ctx.Tag,
+			Uid: uid,
+			Search: func() ([]uint32, error) {
+				return mbox.SearchMessages(true, criteria)
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if save {
+		if ctx.SavedSearch, err = saveSearch(ctx, uid, ids, opts); err != nil {
+			return err
+		}
+		// SAVE alone doesn't return anything, see RFC 5182 section 2.4
+		if len(opts) == 0 && cmd.Partial == nil {
+			return nil
+		}
+	}
+
+	var modSeq uint64
+	if mbox != nil && len(ids) > 0 {
+		if modSeq, err = highestModSeq(mbox, uid, ids); err != nil {
+			return err
+		}
+	}
+
+	// Return options require an ESEARCH response, see RFC 4731 section 3.1.
+	// IMAP4rev2 doesn't have the SEARCH response, see RFC 9051 section 6.4.4.
+	if cmd.Return != nil || cmd.Partial != nil || rev2Enabled(ctx) {
+		if len(opts) == 0 && cmd.Partial == nil {
+			opts = []string{imap.SearchReturnAll}
+		}
+
+		result := imap.NewSearchResult(ids, opts)
+		result.ModSeq = modSeq
+		if cmd.Partial != nil {
+			sorted := append([]uint32(nil), ids...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+			result.SetPartial(sorted, cmd.Partial)
+			opts = append(opts, imap.SearchReturnPartial)
+		}
+		return conn.WriteResp(&responses.ESearch{
+			Tag:     ctx.Tag,
+			Uid:     uid,
+			Options: opts,
+			Result:  result,
+		})
+	}
+
+	return conn.WriteResp(&responses.Search{Ids: ids, ModSeq: modSeq})
+}
+
+// SearchUpdate is a search result kept updated with the UPDATE return option,
+// as defined in RFC 5267 section 4. Changes are reported with ESEARCH
+// responses once a command has been handled, and while idling.
+type SearchUpdate struct {
+	// The tag of the command which requested updates. It identifies the
+	// result in ESEARCH responses and in the CANCELUPDATE command.
+	Tag string
+	// Whether changes are reported with UIDs instead of sequence numbers.
+	Uid bool
+	// Whether the result is sorted. Changes to a sorted result are reported
+	// with the positions of the messages, see RFC 5267 section 4.4.
+	Sorted bool
+	// Search returns the UIDs of the messages in the result, in the order of
+	// the result if it is sorted.
+	Search func() ([]uint32, error)
+
+	uids []uint32
+}
+
+// AddSearchUpdate computes the current result of a search and keeps it
+// updated until the client cancels updates or closes the mailbox.
+func AddSearchUpdate(ctx *Context, u *SearchUpdate) error {
+	if ctx.Mailbox == nil {
+		return ErrNoMailboxSelected
+	}
+
+	uids, err := u.Search()
+	if err != nil {
+		return err
+	}
+	u.uids = uids
+
+	ctx.SearchUpdates = append(ctx.SearchUpdates, u)
+	return nil
+}
+
+// updateSearches sends the changes to the search results kept updated, as
+// defined in RFC 5267 section 4.3.
+func updateSearches(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return nil
+	}
+
+	for _, u := range ctx.SearchUpdates {
+		res, err := u.update(ctx.Mailbox)
+		if err != nil {
+			return err
+		} else if res == nil {
+			continue
+		}
+
+		var opts []string
+		if len(res.RemoveFrom) > 0 {
+			opts = append(opts, imap.SearchRemoveFrom)
+		}
+		if len(res.AddTo) > 0 {
+			opts = append(opts, imap.SearchAddTo)
+		}
+		if len(opts) == 0 {
+			continue
+		}
+
+		err = conn.WriteResp(&responses.ESearch{
+			Tag:     u.Tag,
+			Uid:     u.Uid,
+			Options: opts,
+			Result:  res,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update searches messages again and returns the changes since the last
+// update, or nil if the result is unchanged. Expunged messages are not
+// reported: the client removes them from the result when receiving EXPUNGE.
+func (u *SearchUpdate) update(mbox backend.Mailbox) (*imap.SearchResult, error) {
+	uids, err := u.Search()
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(map[uint32]bool, len(uids))
+	for _, uid := range uids {
+		current[uid] = true
+	}
+	previous := make(map[uint32]bool, len(u.uids))
+	var changed []uint32
+	for _, uid := range u.uids {
+		previous[uid] = true
+		if !current[uid] {
+			changed = append(changed, uid)
+		}
+	}
+	for _, uid := range uids {
+		if !previous[uid] {
+			changed = append(changed, uid)
+		}
+	}
+
+	old := u.uids
+	u.uids = uids
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	seqNums, err := lookupSeqNums(mbox, changed)
+	if err != nil {
+		return nil, err
+	}
+	id := func(uid uint32) *imap.SeqSet {
+		set := new(imap.SeqSet)
+		if u.Uid {
+			set.AddNum(uid)
+		} else {
+			set.AddNum(seqNums[uid])
+		}
+		return set
+	}
+
+	// The result known by the client, without expunged messages
+	var known []uint32
+	for _, uid := range old {
+		if _, ok := seqNums[uid]; ok || current[uid] {
+			known = append(known, uid)
+		}
+	}
+
+	res := new(imap.SearchResult)
+	if !u.Sorted {
+		removed, added := new(imap.SeqSet), new(imap.SeqSet)
+		for _, uid := range known {
+			if !current[uid] {
+				removed.AddSet(id(uid))
+			}
+		}
+		for _, uid := range uids {
+			if _, ok := seqNums[uid]; ok && !previous[uid] {
+				added.AddSet(id(uid))
+			}
+		}
+		if !removed.Empty() {
+			res.RemoveFrom = []imap.SearchContextUpdate{{Ids: removed}}
+		}
+		if !added.Empty() {
+			res.AddTo = []imap.SearchContextUpdate{{Ids: added}}
+		}
+		return res, nil
+	}
+
+	// Messages are removed from the end so that positions of the remaining
+	// ones are unchanged, then added in the order of the new result
+	for i := len(known) - 1; i >= 0; i-- {
+		if uid := known[i]; !current[uid] {
+			res.RemoveFrom = append(res.RemoveFrom, imap.SearchContextUpdate{
+				Position: uint32(i + 1),
+				Ids:      id(uid),
+			})
+		}
+	}
+	for i, uid := range uids {
+		if _, ok := seqNums[uid]; ok && !previous[uid] {
+			res.AddTo = append(res.AddTo, imap.SearchContextUpdate{
+				Position: uint32(i + 1),
+				Ids:      id(uid),
+			})
+		}
+	}
+	return res, nil
+}
+
+// lookupSeqNums returns the sequence numbers of the messages identified by
+// UIDs. Messages which don't exist anymore are omitted.
+func lookupSeqNums(mbox backend.Mailbox, uids []uint32) (map[uint32]uint32, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+
+	ch := make(chan *imap.Message)
+	done := make(chan error, 1)
+	go func() {
+		done <- mbox.ListMessages(true, seqset, []imap.FetchItem{imap.FetchUid}, ch)
+	}()
+
+	seqNums := make(map[uint32]uint32, len(uids))
+	for msg := range ch {
+		seqNums[msg.Uid] = msg.SeqNum
+	}
+	return seqNums, <-done
+}
+
+type CancelUpdate struct {
+	commands.CancelUpdate
+}
+
+func (cmd *CancelUpdate) Handle(conn Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return ErrNoMailboxSelected
+	}
+
+	for _, tag := range cmd.Tags {
+		found := false
+		for i, u := range ctx.SearchUpdates {
+			if u.Tag == tag {
+				ctx.SearchUpdates = append(ctx.SearchUpdates[:i], ctx.SearchUpdates[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("No search result is updated for tag " + tag)
+		}
+	}
+	return nil
+}
+
+// saveSearch returns the UIDs of the messages to save for a SEARCH RETURN
+// (SAVE). If MIN and MAX are the only other options, only these messages are
+// saved, see RFC 5182 section 2.4.
+func saveSearch(ctx *Context, uid bool, ids []uint32, opts []string) (*imap.SeqSet, error) {
+	minMax := len(opts) > 0
+	for _, opt := range opts {
+		if opt != imap.SearchReturnMin && opt != imap.SearchReturnMax {
+			minMax = false
+		}
+	}
+	if minMax {
+		res := imap.NewSearchResult(ids, opts)
+		ids = nil
+		for _, id := range []uint32{res.Min, res.Max} {
+			if id > 0 {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	saved := new(imap.SeqSet)
+	if uid || len(ids) == 0 {
+		saved.AddNum(ids...)
+		return saved, nil
+	}
+
+	seqNums := new(imap.SeqSet)
+	seqNums.AddNum(ids...)
+	uids, err := ctx.Mailbox.SearchMessages(true, &imap.SearchCriteria{SeqNum: seqNums})
+	if err != nil {
+		return nil, err
+	}
+	saved.AddNum(uids...)
+	return saved, nil
+}
+
+// resolveSavedSeqSet replaces a reference to the saved search result ("$")
+// with the saved messages, as defined in RFC 5182 section 2.1. Sequence
+// numbers are looked up if uid is false.
+func resolveSavedSeqSet(ctx *Context, uid bool, seqset *imap.SeqSet) (*imap.SeqSet, error) {
+	if seqset == nil || !seqset.Saved {
+		return seqset, nil
+	}
+
+	saved := ctx.SavedSearch
+	if saved == nil {
+		saved = new(imap.SeqSet)
+	}
+	if uid || saved.Empty() {
+		return saved, nil
+	}
+
+	seqNums, err := ctx.Mailbox.SearchMessages(false, &imap.SearchCriteria{Uid: saved})
+	if err != nil {
+		return nil, err
+	}
+	resolved := new(imap.SeqSet)
+	resolved.AddNum(seqNums...)
+	return resolved, nil
+}
+
+// resolveSavedCriteria returns a copy of c where references to the saved
+// search result have been resolved.
+func resolveSavedCriteria(ctx *Context, c *imap.SearchCriteria) (*imap.SearchCriteria, error) {
+	resolved := *c
+
+	var err error
+	if resolved.SeqNum, err = resolveSavedSeqSet(ctx, false, c.SeqNum); err != nil {
+		return nil, err
+	}
+	if resolved.Uid, err = resolveSavedSeqSet(ctx, true, c.Uid); err != nil {
+		return nil, err
+	}
+
+	resolved.Not = nil
+	for _, not := range c.Not {
+		not, err := resolveSavedCriteria(ctx, not)
+		if err != nil {
+			return nil, err
+		}
+		resolved.Not = append(resolved.Not, not)
+	}
+	if len(c.Or) > 0 {
+		resolved.Or = make([][2]*imap.SearchCriteria, len(c.Or))
+	}
+	for i, or := range c.Or {
+		for j := range or {
+			if resolved.Or[i][j], err = resolveSavedCriteria(ctx, or[j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &resolved, nil
+}
+
+// hasModSeqCriteria returns true if c contains a MODSEQ search key.
+func hasModSeqCriteria(c *imap.SearchCriteria) bool {
+	if c.ModSeq > 0 {
+		return true
+	}
+	for _, not := range c.Not {
+		if hasModSeqCriteria(not) {
+			return true
+		}
+	}
+	for _, or := range c.Or {
+		if hasModSeqCriteria(or[0]) || hasModSeqCriteria(or[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSaveDateCriteria returns true if c contains a SAVEDBEFORE, SAVEDON,
+// SAVEDSINCE or SAVEDATESUPPORTED search key.
+func hasSaveDateCriteria(c *imap.SearchCriteria) bool {
+	if !c.SavedSince.IsZero() || !c.SavedBefore.IsZero() || c.SavedDateSupported {
+		return true
+	}
+	for _, not := range c.Not {
+		if hasSaveDateCriteria(not) {
+			return true
+		}
+	}
+	for _, or := range c.Or {
+		if hasSaveDateCriteria(or[0]) || hasSaveDateCriteria(or[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWithinCriteria returns true if c contains a YOUNGER or OLDER search key.
+func hasWithinCriteria(c *imap.SearchCriteria) bool {
+	if c.Younger > 0 || c.Older > 0 {
+		return true
+	}
+	for _, not := range c.Not {
+		if hasWithinCriteria(not) {
+			return true
+		}
+	}
+	for _, or := range c.Or {
+		if hasWithinCriteria(or[0]) || hasWithinCriteria(or[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnnotationCriteria returns true if c contains an ANNOTATION search key.
+func hasAnnotationCriteria(c *imap.SearchCriteria) bool {
+	if len(c.Annotations) > 0 {
+		return true
+	}
+	for _, not := range c.Not {
+		if hasAnnotationCriteria(not) {
+			return true
+		}
+	}
+	for _, or := range c.Or {
+		if hasAnnotationCriteria(or[0]) || hasAnnotationCriteria(or[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// highestModSeq returns the highest mod-sequence of the messages identified by
+// ids, as required in SEARCH responses by RFC 7162 section 3.1.5.
+func highestModSeq(mbox backend.ModSeqMailbox, uid bool, ids []uint32) (uint64, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(ids...)
+
+	ch := make(chan *imap.Message)
+	done := make(chan error, 1)
+	go func() {
+		done <- mbox.ListMessages(uid, seqset, []imap.FetchItem{imap.FetchModSeq}, ch)
+	}()
+
+	var modSeq uint64
+	for msg := range ch {
+		if msg.ModSeq > modSeq {
+			modSeq = msg.ModSeq
+		}
+	}
+	return modSeq, <-done
 }
 
 func (cmd *Search) Handle(conn Conn) error {
@@ -156,6 +744,89 @@ func (cmd *Fetch) handle(uid bool, conn Conn) error {
 		return ErrNoMailboxSelected
 	}
 
+	var err error
+	if cmd.SeqSet, err = resolveSavedSeqSet(ctx, uid, cmd.SeqSet); err != nil {
+		return err
+	}
+
+	if !conn.Server().supportBinary() {
+		for _, item := range cmd.Items {
+			if isBinaryItem(item) {
+				return errors.New("BINARY is not supported")
+			}
+		}
+	}
+	if !conn.Server().supportObjectId() {
+		for _, item := range cmd.Items {
+			if item == imap.FetchEmailId || item == imap.FetchThreadId {
+				return errors.New("OBJECTID is not supported")
+			}
+		}
+	}
+	if !conn.Server().supportPreview() {
+		for _, item := range cmd.Items {
+			if item == imap.FetchPreview {
+				return errors.New("PREVIEW is not supported")
+			}
+		}
+	}
+	if !conn.Server().supportSaveDate() {
+		for _, item := range cmd.Items {
+			if item == imap.FetchSaveDate {
+				return errors.New("SAVEDATE is not supported")
+			}
+		}
+	}
+	if !conn.Server().supportAnnotate() {
+		for _, item := range cmd.Items {
+			if _, _, err := imap.ParseAnnotationItem(item); err == nil {
+				return errors.New("ANNOTATE-EXPERIMENT-1 is not supported")
+			}
+		}
+	}
+
+	var mbox backend.ModSeqMailbox
+	if cmd.ChangedSince > 0 {
+		var ok bool
+		if mbox, ok = ctx.Mailbox.(backend.ModSeqMailbox); !ok || !conn.Server().supportModSeq() {
+			return errors.New("CHANGEDSINCE is not supported")
+		}
+		enableCondStore(ctx)
+
+		// CHANGEDSINCE implies MODSEQ, see RFC 7162 section 3.1.4.1
+		hasModSeq := false
+		for _, item := range cmd.Items {
+			if item == imap.FetchModSeq {
+				hasModSeq = true
+				break
+			}
+		}
+		if !hasModSeq {
+			cmd.Items = append(cmd.Items, imap.FetchModSeq)
+		}
+	}
+
+	if cmd.Vanished {
+		// VANISHED requires CHANGEDSINCE and UID FETCH, see RFC 7162 section
+		// 3.2.6
+		qmbox, ok := mbox.(backend.QResyncMailbox)
+		if !uid || !ok || !conn.Context().Enabled["QRESYNC"] {
+			return errors.New("VANISHED is not supported")
+		}
+
+		if err := writeVanished(conn, qmbox, cmd.SeqSet, cmd.ChangedSince); err != nil {
+			return err
+		}
+	}
+
+	if cmd.Partial != nil {
+		if cmd.SeqSet, err = partialSeqSet(ctx.Mailbox, uid, cmd.SeqSet, cmd.Partial); err != nil {
+			return err
+		} else if cmd.SeqSet.Empty() {
+			return nil
+		}
+	}
+
 	ch := make(chan *imap.Message)
 	res := &responses.Fetch{Messages: ch}
 
@@ -164,7 +835,25 @@ func (cmd *Fetch) handle(uid bool, conn Conn) error {
 		done <- conn.WriteResp(res)
 	})()
 
-	err := ctx.Mailbox.ListMessages(uid, cmd.SeqSet, cmd.Items, ch)
+	list := ch
+	if rev2Enabled(ctx) {
+		// The \Recent flag doesn't exist in IMAP4rev2, see RFC 9051 section
+		// 2.3.2
+		list = make(chan *imap.Message)
+		go (func(in <-chan *imap.Message) {
+			for msg := range in {
+				msg.Flags = withoutFlag(msg.Flags, imap.RecentFlag)
+				ch <- msg
+			}
+			close(ch)
+		})(list)
+	}
+
+	if mbox != nil {
+		err = mbox.ListMessagesChangedSince(uid, cmd.SeqSet, cmd.ChangedSince, cmd.Items, list)
+	} else {
+		err = ctx.Mailbox.ListMessages(uid, cmd.SeqSet, cmd.Items, list)
+	}
 	if err != nil {
 		return err
 	}
@@ -172,6 +861,38 @@ func (cmd *Fetch) handle(uid bool, conn Conn) error {
 	return <-done
 }
 
+// partialSeqSet returns the messages of seqset in the range r, as defined in
+// RFC 9394 section 3.2.
+func partialSeqSet(mbox backend.Mailbox, uid bool, seqset *imap.SeqSet, r *imap.PartialRange) (*imap.SeqSet, error) {
+	criteria := &imap.SearchCriteria{}
+	if uid {
+		criteria.Uid = seqset
+	} else {
+		criteria.SeqNum = seqset
+	}
+
+	ids, err := mbox.SearchMessages(uid, criteria)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	res := new(imap.SeqSet)
+	res.AddNum(r.Apply(ids)...)
+	return res, nil
+}
+
+// withoutFlag returns flags without flag.
+func withoutFlag(flags []string, flag string) []string {
+	var res []string
+	for _, f := range flags {
+		if f != flag {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
 func (cmd *Fetch) Handle(conn Conn) error {
 	return cmd.handle(false, conn)
 }
@@ -205,12 +926,20 @@ func (cmd *Store) handle(uid bool, conn Conn) error {
 		return ErrMailboxReadOnly
 	}
 
-	// Only flags operations are supported
+	if cmd.Item == imap.StoreAnnotation {
+		return cmd.handleAnnotation(uid, conn)
+	}
+
+	// Only other supported operations are flags operations
 	op, silent, err := imap.ParseFlagsOp(cmd.Item)
 	if err != nil {
 		return err
 	}
 
+	if cmd.SeqSet, err = resolveSavedSeqSet(ctx, uid, cmd.SeqSet); err != nil {
+		return err
+	}
+
 	flagsList, ok := cmd.Value.([]interface{})
 	if !ok {
 		return errors.New("Flags must be a list")
@@ -222,35 +951,120 @@ func (cmd *Store) handle(uid bool, conn Conn) error {
 	for i, flag := range flags {
 		flags[i] = imap.CanonicalFlag(flag)
 	}
+	if err := checkRights(conn, ctx.Mailbox, flagsRights(flags)); err != nil {
+		return err
+	}
+
+	var mbox backend.ModSeqMailbox
+	if cmd.UnchangedSince > 0 {
+		var ok bool
+		if mbox, ok = ctx.Mailbox.(backend.ModSeqMailbox); !ok || !conn.Server().supportModSeq() {
+			return errors.New("UNCHANGEDSINCE is not supported")
+		}
+		enableCondStore(ctx)
+	}
 
 	// If the backend supports message updates, this will prevent this connection
 	// from receiving them
 	// TODO: find a better way to do this, without conn.silent
+	var modified *imap.SeqSet
 	*conn.silent() = silent
-	err = ctx.Mailbox.UpdateMessagesFlags(uid, cmd.SeqSet, op, flags)
+	if mbox != nil {
+		modified, err = mbox.UpdateMessagesFlagsUnchangedSince(uid, cmd.SeqSet, cmd.UnchangedSince, op, flags)
+	} else {
+		err = ctx.Mailbox.UpdateMessagesFlags(uid, cmd.SeqSet, op, flags)
+	}
 	*conn.silent() = false
 	if err != nil {
 		return err
 	}
 
-	// Not silent: send FETCH updates if the backend doesn't support message
-	// updates
-	if conn.Server().Updates == nil && !silent {
+	// Send FETCH updates if the backend doesn't support message updates. Once
+	// CONDSTORE is enabled, the new mod-sequences are sent even if silent,
+	// see RFC 7162 section 3.1.3
+	condStore := ctx.Enabled["CONDSTORE"]
+	if conn.Server().Updates == nil && (!silent || condStore) {
 		inner := &Fetch{}
 		inner.SeqSet = cmd.SeqSet
-		inner.Items = []imap.FetchItem{imap.FetchFlags}
+		if !silent {
+			inner.Items = append(inner.Items, imap.FetchFlags)
+		}
 		if uid {
 			inner.Items = append(inner.Items, "UID")
 		}
+		if condStore {
+			inner.Items = append(inner.Items, imap.FetchModSeq)
+		}
 
 		if err := inner.handle(uid, conn); err != nil {
 			return err
 		}
 	}
 
+	if modified != nil && !modified.Empty() {
+		return ErrStatusResp(&imap.StatusResp{
+			Type:      imap.StatusRespOk,
+			Code:      imap.CodeModified,
+			Arguments: []interface{}{modified},
+			Info:      "Conditional STORE failed",
+		})
+	}
 	return nil
 }
 
+// flagsRights returns the rights needed to store flags, see RFC 4314 section 4.
+func flagsRights(flags []string) imap.ACLRights {
+	var rights imap.ACLRights
+	for _, flag := range flags {
+		switch flag {
+		case imap.SeenFlag:
+			rights += "s"
+		case imap.DeletedFlag:
+			rights += "t"
+		default:
+			rights += "w"
+		}
+	}
+	return rights
+}
+
+// handleAnnotation changes message annotations, see RFC 5257 section 4.3.
+func (cmd *Store) handleAnnotation(uid bool, conn Conn) error {
+	ctx := conn.Context()
+	mbox, ok := ctx.Mailbox.(backend.AnnotateMailbox)
+	if !ok || !conn.Server().supportAnnotate() {
+		return errors.New("ANNOTATE-EXPERIMENT-1 is not supported")
+	}
+	if cmd.UnchangedSince > 0 {
+		return errors.New("UNCHANGEDSINCE is not supported with ANNOTATION")
+	}
+
+	seqset, err := resolveSavedSeqSet(ctx, uid, cmd.SeqSet)
+	if err != nil {
+		return err
+	}
+
+	values, ok := cmd.Value.([]interface{})
+	if !ok {
+		return errors.New("Annotations must be a list")
+	}
+	annotations, err := imap.ParseAnnotationValues(values)
+	if err != nil {
+		return err
+	}
+
+	err = mbox.SetAnnotations(uid, seqset, annotations)
+	if err == backend.ErrAnnotationTooBig {
+		return ErrStatusResp(&imap.StatusResp{
+			Type:      imap.StatusRespNo,
+			Code:      imap.CodeAnnotate,
+			Arguments: []interface{}{"TOOBIG"},
+			Info:      err.Error(),
+		})
+	}
+	return err
+}
+
 func (cmd *Store) Handle(conn Conn) error {
 	return cmd.handle(false, conn)
 }
@@ -269,7 +1083,34 @@ func (cmd *Copy) handle(uid bool, conn Conn) error {
 		return ErrNoMailboxSelected
 	}
 
-	return ctx.Mailbox.CopyMessages(uid, cmd.SeqSet, cmd.Mailbox)
+	seqset, err := resolveSavedSeqSet(ctx, uid, cmd.SeqSet)
+	if err != nil {
+		return err
+	}
+
+	if dest, err := ctx.User.GetMailbox(cmd.Mailbox); err == nil {
+		if err := checkRights(conn, dest, "i"); err != nil {
+			return err
+		}
+	}
+
+	mbox, ok := ctx.Mailbox.(backend.UidPlusMailbox)
+	if !ok || !conn.Server().supportUidPlus() {
+		return ctx.Mailbox.CopyMessages(uid, seqset, cmd.Mailbox)
+	}
+
+	data, err := mbox.CopyMessagesUid(uid, seqset, cmd.Mailbox)
+	if err != nil {
+		return err
+	}
+	if data.SourceUids.Empty() {
+		return nil
+	}
+	return ErrStatusResp(&imap.StatusResp{
+		Type:      imap.StatusRespOk,
+		Code:      imap.CodeCopyUid,
+		Arguments: data.Format(),
+	})
 }
 
 func (cmd *Copy) Handle(conn Conn) error {
@@ -280,15 +1121,205 @@ func (cmd *Copy) UidHandle(conn Conn) error {
 	return cmd.handle(true, conn)
 }
 
+type Move struct {
+	commands.Move
+}
+
+func (cmd *Move) handle(uid bool, conn Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return ErrNoMailboxSelected
+	}
+	if ctx.MailboxReadOnly {
+		return ErrMailboxReadOnly
+	}
+
+	mbox, ok := ctx.Mailbox.(backend.MoveMailbox)
+	if !ok || !conn.Server().supportMove() {
+		return errors.New("MOVE is not supported")
+	}
+
+	seqset, err := resolveSavedSeqSet(ctx, uid, cmd.SeqSet)
+	if err != nil {
+		return err
+	}
+
+	if err := checkRights(conn, ctx.Mailbox, "te"); err != nil {
+		return err
+	}
+	if dest, err := ctx.User.GetMailbox(cmd.Mailbox); err == nil {
+		if err := checkRights(conn, dest, "i"); err != nil {
+			return err
+		}
+	}
+
+	// Get a list of messages that will be moved, to send expunge updates if
+	// the backend doesn't support it
+	vanished := ctx.Enabled["QRESYNC"]
+	var ids []uint32
+	if conn.Server().Updates == nil {
+		criteria := &imap.SearchCriteria{}
+		if uid {
+			criteria.Uid = seqset
+		} else {
+			criteria.SeqNum = seqset
+		}
+
+		if ids, err = ctx.Mailbox.SearchMessages(vanished, criteria); err != nil {
+			return err
+		}
+	}
+
+	data, err := mbox.MoveMessages(uid, seqset, cmd.Mailbox)
+	if err != nil {
+		return err
+	}
+
+	// COPYUID is sent in an untagged response before the expunged messages,
+	// see RFC 6851 section 4.3
+	if data != nil && !data.SourceUids.Empty() && conn.Server().supportUidPlus() {
+		res := &imap.StatusResp{
+			Type:      imap.StatusRespOk,
+			Code:      imap.CodeCopyUid,
+			Arguments: data.Format(),
+			Info:      "Messages moved",
+		}
+		if err := conn.WriteResp(res); err != nil {
+			return err
+		}
+	}
+
+	if conn.Server().Updates == nil {
+		return writeExpunged(conn, vanished, ids)
+	}
+	return nil
+}
+
+func (cmd *Move) Handle(conn Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Move) UidHandle(conn Conn) error {
+	return cmd.handle(true, conn)
+}
+
+type Replace struct {
+	commands.Replace
+}
+
+func (cmd *Replace) handle(uid bool, conn Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return ErrNoMailboxSelected
+	}
+	if ctx.MailboxReadOnly {
+		return ErrMailboxReadOnly
+	}
+
+	mbox, ok := ctx.Mailbox.(backend.ReplaceMailbox)
+	if !ok || !conn.Server().supportReplace() {
+		return errors.New("REPLACE is not supported")
+	}
+
+	dest, err := ctx.User.GetMailbox(cmd.Mailbox)
+	if err == backend.ErrNoSuchMailbox {
+		return ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespNo,
+			Code: imap.CodeTryCreate,
+			Info: err.Error(),
+		})
+	} else if err != nil {
+		return err
+	}
+	if err := checkRights(conn, ctx.Mailbox, "te"); err != nil {
+		return err
+	}
+	if err := checkRights(conn, dest, "i"); err != nil {
+		return err
+	}
+
+	// The message to replace must exist, see RFC 8508 section 3.3
+	vanished := ctx.Enabled["QRESYNC"]
+	criteria := &imap.SearchCriteria{}
+	if uid {
+		criteria.Uid = new(imap.SeqSet)
+		criteria.Uid.AddNum(cmd.SeqNum)
+	} else {
+		criteria.SeqNum = new(imap.SeqSet)
+		criteria.SeqNum.AddNum(cmd.SeqNum)
+	}
+	ids, err := ctx.Mailbox.SearchMessages(vanished, criteria)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return errors.New("No such message")
+	}
+
+	if err := prepareAppend(conn, dest, []*imap.AppendMessage{cmd.Message}); err != nil {
+		return err
+	}
+
+	appendUid, err := mbox.ReplaceMessage(uid, cmd.SeqNum, cmd.Mailbox, cmd.Message)
+	if err == backend.ErrQuotaExceeded {
+		return errOverQuota
+	} else if err == backend.ErrTooBig {
+		return errTooBig
+	} else if err != nil {
+		return err
+	}
+
+	// APPENDUID is sent in an untagged response before the expunged message,
+	// see RFC 8508 section 3.3
+	if appendUid != nil && conn.Server().supportUidPlus() {
+		res := &imap.StatusResp{
+			Type:      imap.StatusRespOk,
+			Code:      imap.CodeAppendUid,
+			Arguments: appendUid.Format(),
+			Info:      "Replacement message appended",
+		}
+		if err := conn.WriteResp(res); err != nil {
+			return err
+		}
+	}
+
+	if conn.Server().Updates == nil {
+		if err := writeExpunged(conn, vanished, ids); err != nil {
+			return err
+		}
+		if dest.Name() == ctx.Mailbox.Name() {
+			return writeExists(conn, dest)
+		}
+	}
+	return nil
+}
+
+func (cmd *Replace) Handle(conn Conn) error {
+	return cmd.handle(false, conn)
+}
+
+func (cmd *Replace) UidHandle(conn Conn) error {
+	return cmd.handle(true, conn)
+}
+
 type Uid struct {
 	commands.Uid
 }
 
 func (cmd *Uid) Handle(conn Conn) error {
 	inner := cmd.Cmd.Command()
-	hdlr, err := conn.commandHandler(inner)
-	if err != nil {
-		return err
+	newHandler := conn.Server().Command(inner.Name)
+	if newHandler == nil {
+		return errors.New("Unknown command")
+	}
+
+	hdlr := newHandler()
+	if err := hdlr.Parse(inner.Arguments); err != nil {
+		// Reply with BAD to invalid arguments, like for other commands
+		return ErrStatusResp(&imap.StatusResp{
+			Type: imap.StatusRespBad,
+			Info: err.Error(),
+		})
 	}
 
 	uidHdlr, ok := hdlr.(UidHandler)
@@ -297,6 +1328,10 @@ func (cmd *Uid) Handle(conn Conn) error {
 	}
 
 	if err := uidHdlr.UidHandle(conn); err != nil {
+		// Handlers can return a custom OK response, e.g. with a response code
+		if statusErr, ok := err.(*errStatusResp); ok && statusErr.resp.Type == imap.StatusRespOk && statusErr.resp.Info == "" {
+			statusErr.resp.Info = "UID " + inner.Name + " completed"
+		}
 		return err
 	}
 
@@ -305,3 +1340,12 @@ func (cmd *Uid) Handle(conn Conn) error {
 		Info: "UID " + inner.Name + " completed",
 	})
 }
+
+// isBinaryItem returns true if item is a BINARY fetch item, see RFC 3516.
+func isBinaryItem(item imap.FetchItem) bool {
+	if _, err := imap.ParseBinarySizeItem(item); err == nil {
+		return true
+	}
+	section, err := imap.ParseBodySectionName(item)
+	return err == nil && section.Binary
+}
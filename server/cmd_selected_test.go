@@ -4,9 +4,12 @@ import (
 	"bufio"
 	"io"
 	"net"
+	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
 	"github.com/emersion/go-imap/server"
 )
 
@@ -92,6 +95,38 @@ func TestClose_NotSelected(t *testing.T) {
 	}
 }
 
+func TestUnselect(t *testing.T) {
+	s, c, scanner := testServerSelected(t, false)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 STORE 1 +FLAGS.SILENT (\\Deleted)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 UNSELECT\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// Deleted messages aren't expunged
+	io.WriteString(c, "a003 STATUS INBOX (MESSAGES)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* STATUS INBOX (MESSAGES 1)" {
+		t.Fatal("Invalid STATUS response:", scanner.Text())
+	}
+	scanner.Scan()
+
+	io.WriteString(c, "a004 UNSELECT\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
 func TestExpunge(t *testing.T) {
 	s, c, scanner := testServerSelected(t, false)
 	defer c.Close()
@@ -204,6 +239,49 @@ func TestSearch_Uid(t *testing.T) {
 	}
 }
 
+func TestSearch_Return(t *testing.T) {
+	s, c, scanner := testServerSelected(t, true)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 UID SEARCH RETURN (MIN COUNT) UNDELETED\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ESEARCH (TAG \"a001\") UID MIN 6 COUNT 1" {
+		t.Fatal("Invalid ESEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SEARCH RETURN () UNDELETED\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ESEARCH (TAG \"a002\") ALL 1" {
+		t.Fatal("Invalid ESEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// MIN, MAX and ALL are omitted if no message matches
+	io.WriteString(c, "a003 SEARCH RETURN (MIN MAX ALL COUNT) DELETED\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ESEARCH (TAG \"a003\") COUNT 0" {
+		t.Fatal("Invalid ESEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 SEARCH RETURN (PARTIAL) ALL\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
 func TestFetch(t *testing.T) {
 	s, c, scanner := testServerSelected(t, true)
 	defer c.Close()
@@ -451,6 +529,62 @@ func TestCopy_Uid(t *testing.T) {
 	}
 }
 
+func TestSearchRes(t *testing.T) {
+	s, c, scanner := testServerSelected(t, false)
+	defer c.Close()
+	defer s.Close()
+
+	// Nothing has been saved yet, "$" is empty
+	io.WriteString(c, "a001 FETCH $ (UID)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// SAVE alone doesn't return anything
+	io.WriteString(c, "a002 SEARCH RETURN (SAVE) SEEN\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 FETCH $ (UID)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* 1 FETCH (UID 6)" {
+		t.Fatal("Invalid FETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 UID SEARCH UID $\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* SEARCH 6" {
+		t.Fatal("Invalid SEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a005 SEARCH RETURN (COUNT SAVE) NOT $\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ESEARCH (TAG \"a005\") COUNT 0" {
+		t.Fatal("Invalid ESEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a005 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a006 UID FETCH $ (UID)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a006 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
 func TestUid_InvalidCommand(t *testing.T) {
 	s, c, scanner := testServerSelected(t, false)
 	defer c.Close()
@@ -468,3 +602,1137 @@ func TestUid_InvalidCommand(t *testing.T) {
 		t.Fatal("Invalid status response:", scanner.Text())
 	}
 }
+
+// modSeqBackend is a memory backend advertising mod-sequences support.
+type modSeqBackend struct {
+	*memory.Backend
+}
+
+func (be *modSeqBackend) SupportModSeq() bool {
+	return true
+}
+
+func testServerModSeq(t *testing.T) (s *server.Server, c net.Conn, scanner *bufio.Scanner) {
+	s, c, scanner = testServerLoggedIn(t, &modSeqBackend{memory.New()}, "", "CONDSTORE", "ENABLE")
+
+	io.WriteString(c, "a000 SELECT INBOX\r\n")
+	highestModSeq := false
+	for scanner.Scan() {
+		if scanner.Text() == "* OK [HIGHESTMODSEQ 1] Highest mod-sequence" {
+			highestModSeq = true
+		}
+		if strings.HasPrefix(scanner.Text(), "a000 ") {
+			break
+		}
+	}
+	if !highestModSeq {
+		t.Fatal("Missing HIGHESTMODSEQ in SELECT response")
+	}
+	return
+}
+
+func TestFetch_ChangedSince(t *testing.T) {
+	s, c, scanner := testServerModSeq(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 STORE 1 +FLAGS.SILENT (\\Flagged)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 FETCH 1:* (FLAGS) (CHANGEDSINCE 1)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* 1 FETCH (FLAGS (\\Seen \\Flagged) MODSEQ (2))" {
+		t.Fatal("Invalid FETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 FETCH 1:* (FLAGS) (CHANGEDSINCE 2)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestStore_UnchangedSince(t *testing.T) {
+	s, c, scanner := testServerModSeq(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 STORE 1 (UNCHANGEDSINCE 1) +FLAGS (\\Flagged)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* 1 FETCH (FLAGS (\\Seen \\Flagged) MODSEQ (2))" {
+		t.Fatal("Invalid FETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") || strings.Contains(scanner.Text(), "MODIFIED") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	// The message has been modified since mod-sequence 1
+	io.WriteString(c, "a002 STORE 1 (UNCHANGEDSINCE 1) -FLAGS.SILENT (\\Flagged)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* 1 FETCH (MODSEQ (2))" {
+		t.Fatal("Invalid FETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if scanner.Text() != "a002 OK [MODIFIED 1] Conditional STORE failed" {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestStore_UnchangedSinceUnsupported(t *testing.T) {
+	s, c, scanner := testServerSelected(t, false)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 STORE 1 (UNCHANGEDSINCE 1) +FLAGS (\\Flagged)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestFetch_ChangedSinceUnsupported(t *testing.T) {
+	s, c, scanner := testServerSelected(t, true)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 FETCH 1:* (FLAGS) (CHANGEDSINCE 1)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestSearch_ModSeq(t *testing.T) {
+	s, c, scanner := testServerModSeq(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 SEARCH MODSEQ 1\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* SEARCH 1 (MODSEQ 1)" {
+		t.Fatal("Invalid SEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SEARCH MODSEQ 2\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* SEARCH" {
+		t.Fatal("Invalid SEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+// qresyncBackend is a memory backend advertising QRESYNC support.
+type qresyncBackend struct {
+	modSeqBackend
+}
+
+func (be *qresyncBackend) SupportQResync() bool {
+	return true
+}
+
+func testServerQResync(t *testing.T) (s *server.Server, c net.Conn, scanner *bufio.Scanner) {
+	s, c, scanner = testServerLoggedIn(t, &qresyncBackend{modSeqBackend{memory.New()}}, "", "QRESYNC")
+
+	io.WriteString(c, "a000 ENABLE QRESYNC\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ENABLED QRESYNC" {
+		t.Fatal("Invalid ENABLED response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a000 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+	return
+}
+
+func TestSelect_QResync(t *testing.T) {
+	s, c, scanner := testServerQResync(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 SELECT INBOX (QRESYNC (1 0 1:10))\r\n")
+
+	gotFetch := false
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a001 ") {
+			break
+		}
+		if scanner.Text() == "* 1 FETCH (UID 6 FLAGS (\\Seen) MODSEQ (1))" {
+			gotFetch = true
+		}
+	}
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+	if !gotFetch {
+		t.Error("Missing FETCH response for changed message")
+	}
+
+	io.WriteString(c, "a002 STORE 1 +FLAGS.SILENT (\\Deleted)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* 1 FETCH (MODSEQ (2))" {
+		t.Fatal("Invalid FETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	io.WriteString(c, "a003 EXPUNGE\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* VANISHED 6" {
+		t.Fatal("Invalid VANISHED response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 SELECT INBOX (QRESYNC (1 1))\r\n")
+
+	gotVanished := false
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a004 ") {
+			break
+		}
+		if scanner.Text() == "* VANISHED (EARLIER) 6" {
+			gotVanished = true
+		}
+	}
+	if !gotVanished {
+		t.Error("Missing VANISHED (EARLIER) response for expunged message")
+	}
+}
+
+func TestIdle_QResync(t *testing.T) {
+	s, c, scanner := testServerQResync(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a001 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a002 IDLE\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "+ ") {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+
+	u, err := s.Backend.Login("username", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mbox, err := u.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seqset, _ := imap.ParseSeqSet("6")
+	if err := mbox.UpdateMessagesFlags(true, seqset, imap.AddFlags, []string{imap.DeletedFlag}); err != nil {
+		t.Fatal(err)
+	}
+	scanner.Scan()
+	if scanner.Text() != "* 1 FETCH (FLAGS (\\Seen \\Deleted) UID 6 MODSEQ (2))" {
+		t.Fatal("Invalid message update:", scanner.Text())
+	}
+
+	if err := mbox.Expunge(); err != nil {
+		t.Fatal(err)
+	}
+	scanner.Scan()
+	if scanner.Text() != "* VANISHED 6" {
+		t.Fatal("Invalid expunge update:", scanner.Text())
+	}
+
+	io.WriteString(c, "DONE\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestSelect_QResyncNotEnabled(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 SELECT INBOX (QRESYNC (1 0))\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestFetch_Vanished(t *testing.T) {
+	s, c, scanner := testServerQResync(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a001 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a002 APPEND INBOX {7}\r\n")
+	scanner.Scan() // Continuation request
+	io.WriteString(c, "Hello\r\n\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a002 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a003 UID STORE 6 +FLAGS.SILENT (\\Deleted)\r\n")
+	scanner.Scan() // FETCH with MODSEQ, since QRESYNC is enabled
+	scanner.Scan()
+	io.WriteString(c, "a004 EXPUNGE\r\n")
+	scanner.Scan() // VANISHED
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a005 UID FETCH 1:* (FLAGS) (CHANGEDSINCE 1 VANISHED)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* VANISHED (EARLIER) 6" {
+		t.Fatal("Invalid VANISHED response:", scanner.Text())
+	}
+	scanner.Scan()
+	if scanner.Text() != "* 1 FETCH (FLAGS () UID 7 MODSEQ (2))" {
+		t.Fatal("Invalid FETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a005 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a006 FETCH 1:* (FLAGS) (CHANGEDSINCE 1 VANISHED)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a006 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type binaryBackend struct {
+	*memory.Backend
+}
+
+func (be *binaryBackend) SupportBinary() bool {
+	return true
+}
+
+const binaryMessage = "Content-Type: multipart/mixed; boundary=message-boundary\r\n" +
+	"\r\n" +
+	"--message-boundary\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Hi there :)\r\n" +
+	"--message-boundary\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"SGVsbG8AV29ybGQ=\r\n" +
+	"--message-boundary--\r\n"
+
+func TestFetch_Binary(t *testing.T) {
+	s, c := testServerBackend(t, &binaryBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " BINARY") {
+		t.Fatal("BINARY not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 APPEND INBOX ~{"+strconv.Itoa(len(binaryMessage))+"}\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "+ ") {
+		t.Fatal("Invalid continuation request:", scanner.Text())
+	}
+	io.WriteString(c, binaryMessage+"\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a002 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a003 FETCH 2 (BINARY.SIZE[2] BINARY.PEEK[2])\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* 2 FETCH (BINARY.SIZE[2] 11 BINARY[2] ~{11}" {
+		t.Fatal("Invalid FETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if scanner.Text() != "Hello\x00World)" {
+		t.Fatalf("Invalid FETCH response: %q", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestFetch_BinaryUnsupported(t *testing.T) {
+	s, c, scanner := testServerSelected(t, true)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 FETCH 1 (BINARY[1])\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type uidPlusBackend struct {
+	*memory.Backend
+}
+
+func (be *uidPlusBackend) SupportUidPlus() bool {
+	return true
+}
+
+func testServerUidPlus(t *testing.T) (s *server.Server, c net.Conn, scanner *bufio.Scanner) {
+	return testServerLoggedIn(t, &uidPlusBackend{memory.New()}, "INBOX", "UIDPLUS")
+}
+
+func TestAppend_UidPlus(t *testing.T) {
+	s, c, scanner := testServerUidPlus(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 APPEND INBOX {5+}\r\nHello\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* 2 EXISTS" {
+		t.Fatal("Invalid EXISTS response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK [APPENDUID 1 7] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestCopy_UidPlus(t *testing.T) {
+	s, c, scanner := testServerUidPlus(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 CREATE CopyDest\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 COPY 1 CopyDest\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK [COPYUID 1 6 1] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 UID COPY 6 CopyDest\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK [COPYUID 1 6 2] ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestExpunge_Uid(t *testing.T) {
+	s, c, scanner := testServerUidPlus(t)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 STORE 1 +FLAGS.SILENT (\\Deleted)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 UID EXPUNGE 1:5\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 UID EXPUNGE 6\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* 1 EXPUNGE" {
+		t.Fatal("Invalid EXPUNGE response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestExpunge_UidUnsupported(t *testing.T) {
+	s, c, scanner := testServerSelected(t, false)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 UID EXPUNGE 6\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type previewBackend struct {
+	*memory.Backend
+}
+
+func (be *previewBackend) SupportPreview() bool {
+	return true
+}
+
+func TestFetch_Preview(t *testing.T) {
+	s, c := testServerBackend(t, &previewBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " PREVIEW") {
+		t.Fatal("PREVIEW not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a001 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a002 FETCH 1 (PREVIEW)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* 1 FETCH (PREVIEW \"Hi there :)\")" {
+		t.Fatal("Invalid FETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestFetch_PreviewUnsupported(t *testing.T) {
+	s, c, scanner := testServerSelected(t, true)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 FETCH 1 (PREVIEW)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type saveDateBackend struct {
+	*memory.Backend
+}
+
+func (be *saveDateBackend) SupportSaveDate() bool {
+	return true
+}
+
+func TestSaveDate(t *testing.T) {
+	s, c := testServerBackend(t, &saveDateBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " SAVEDATE") {
+		t.Fatal("SAVEDATE not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a001 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a002 FETCH 1 (SAVEDATE)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "* 1 FETCH (SAVEDATE \"") {
+		t.Fatal("Invalid FETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 SEARCH SAVEDATESUPPORTED SAVEDSINCE 1-Jan-2000\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* SEARCH 1" {
+		t.Fatal("Invalid SEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 SEARCH SAVEDBEFORE 1-Jan-2000\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* SEARCH" {
+		t.Fatal("Invalid SEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestSaveDate_Unsupported(t *testing.T) {
+	s, c, scanner := testServerSelected(t, true)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 FETCH 1 (SAVEDATE)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SEARCH NOT SAVEDON 1-Jan-2000\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type annotateBackend struct {
+	*memory.Backend
+}
+
+func (be *annotateBackend) SupportAnnotate() bool {
+	return true
+}
+
+func TestAnnotate(t *testing.T) {
+	s, c := testServerBackend(t, &annotateBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " ANNOTATE-EXPERIMENT-1") {
+		t.Fatal("ANNOTATE-EXPERIMENT-1 not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a001 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a002 STORE 1 ANNOTATION (/comment (value.priv \"My comment\" value.shared \"Shared\"))\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 FETCH 1 (UID ANNOTATION (/comment value.priv))\r\n")
+	scanner.Scan()
+	if want := "* 1 FETCH (UID 6 ANNOTATION (\"/comment\" (\"value.priv\" \"My comment\")))"; scanner.Text() != want {
+		t.Fatalf("Invalid FETCH response: got %v, want %v", scanner.Text(), want)
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 FETCH 1 ANNOTATION (/* value)\r\n")
+	scanner.Scan()
+	if want := "* 1 FETCH (ANNOTATION (\"/comment\" (\"value.priv\" \"My comment\" \"value.shared\" \"Shared\")))"; scanner.Text() != want {
+		t.Fatalf("Invalid FETCH response: got %v, want %v", scanner.Text(), want)
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a005 SEARCH ANNOTATION /comment value \"my COMMENT\"\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* SEARCH 1" {
+		t.Fatal("Invalid SEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+
+	io.WriteString(c, "a006 STORE 1 ANNOTATION (/comment (value.priv NIL))\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a006 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a007 SEARCH ANNOTATION /comment value.priv comment\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* SEARCH" {
+		t.Fatal("Invalid SEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a007 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestAnnotate_Unsupported(t *testing.T) {
+	s, c, scanner := testServerSelected(t, false)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 FETCH 1 (ANNOTATION (/comment value))\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 STORE 1 ANNOTATION (/comment (value.priv \"My comment\"))\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 SEARCH ANNOTATION /comment value comment\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type moveBackend struct {
+	*memory.Backend
+}
+
+func (be *moveBackend) SupportMove() bool {
+	return true
+}
+
+func (be *moveBackend) SupportUidPlus() bool {
+	return true
+}
+
+func TestMove(t *testing.T) {
+	s, c := testServerBackend(t, &moveBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " MOVE") {
+		t.Fatal("MOVE not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 CREATE MoveDest\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a002 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a003 MOVE 1 MoveDest\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "* OK [COPYUID 1 6 1] ") {
+		t.Fatal("Invalid COPYUID response:", scanner.Text())
+	}
+	scanner.Scan()
+	if scanner.Text() != "* 1 EXPUNGE" {
+		t.Fatal("Invalid EXPUNGE response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 STATUS MoveDest (MESSAGES)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* STATUS MoveDest (MESSAGES 1)" {
+		t.Fatal("Invalid STATUS response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestIMAP4rev2_Unsupported(t *testing.T) {
+	s, c, scanner := testServerAuthenticated(t)
+	defer c.Close()
+	defer s.Close()
+	s.IMAP4rev2 = true
+
+	io.WriteString(c, "a001 CAPABILITY\r\n")
+	scanner.Scan()
+	if strings.Contains(scanner.Text(), " IMAP4rev2") {
+		t.Fatal("IMAP4rev2 advertised without MOVE and UIDPLUS:", scanner.Text())
+	}
+	scanner.Scan()
+
+	io.WriteString(c, "a002 ENABLE IMAP4rev2\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ENABLED" {
+		t.Fatal("Invalid ENABLED response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestMove_Unsupported(t *testing.T) {
+	s, c, scanner := testServerSelected(t, false)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 MOVE 1 INBOX\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+// rev2Backend is a memory backend supporting the extensions required by
+// IMAP4rev2.
+type rev2Backend struct {
+	moveBackend
+}
+
+func (be *rev2Backend) SupportBinary() bool {
+	return true
+}
+
+func (be *rev2Backend) SupportStatusSize() bool {
+	return true
+}
+
+func TestIMAP4rev2(t *testing.T) {
+	s, c, scanner := testServerLoggedIn(t, &rev2Backend{moveBackend{memory.New()}}, "")
+	defer c.Close()
+	defer s.Close()
+	s.IMAP4rev2 = true
+
+	io.WriteString(c, "a000 CAPABILITY\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " IMAP4rev2") {
+		t.Fatal("IMAP4rev2 not advertised:", scanner.Text())
+	}
+	scanner.Scan()
+
+	io.WriteString(c, "a001 ENABLE IMAP4rev2\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ENABLED IMAP4REV2" {
+		t.Fatal("Invalid ENABLED response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SELECT INBOX\r\n")
+	var list bool
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a002 ") {
+			break
+		}
+		if strings.HasSuffix(scanner.Text(), " RECENT") || strings.Contains(scanner.Text(), "[UNSEEN ") {
+			t.Fatal("Unexpected SELECT response:", scanner.Text())
+		}
+		if strings.HasPrefix(scanner.Text(), "* LIST ") {
+			list = true
+		}
+	}
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+	if !list {
+		t.Fatal("No LIST response sent")
+	}
+
+	io.WriteString(c, "a003 SEARCH UNDELETED\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ESEARCH (TAG \"a003\") ALL 1" {
+		t.Fatal("Invalid ESEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type replaceBackend struct {
+	*memory.Backend
+}
+
+func (be *replaceBackend) SupportReplace() bool {
+	return true
+}
+
+func (be *replaceBackend) SupportUidPlus() bool {
+	return true
+}
+
+func TestReplace(t *testing.T) {
+	s, c := testServerBackend(t, &replaceBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " REPLACE") {
+		t.Fatal("REPLACE not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a001 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a002 UID REPLACE 6 INBOX (\\Draft) {5+}\r\nHello\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "* OK [APPENDUID 1 7] ") {
+		t.Fatal("Invalid APPENDUID response:", scanner.Text())
+	}
+	scanner.Scan()
+	if scanner.Text() != "* 1 EXPUNGE" {
+		t.Fatal("Invalid EXPUNGE response:", scanner.Text())
+	}
+	scanner.Scan()
+	if scanner.Text() != "* 1 EXISTS" {
+		t.Fatal("Invalid EXISTS response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 REPLACE 2 INBOX {5+}\r\nHello\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestReplace_Unsupported(t *testing.T) {
+	s, c, scanner := testServerSelected(t, false)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 REPLACE 1 INBOX {5+}\r\nHello\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+type withinBackend struct {
+	*memory.Backend
+}
+
+func (be *withinBackend) SupportWithin() bool {
+	return true
+}
+
+func TestSearch_Within(t *testing.T) {
+	s, c := testServerBackend(t, &withinBackend{memory.New()})
+	defer c.Close()
+	defer s.Close()
+
+	scanner := bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	if !strings.Contains(scanner.Text(), " WITHIN") {
+		t.Fatal("WITHIN not advertised:", scanner.Text())
+	}
+
+	io.WriteString(c, "a001 SELECT INBOX\r\n")
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "a001 ") {
+			break
+		}
+	}
+
+	io.WriteString(c, "a002 SEARCH YOUNGER 60\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* SEARCH 1" {
+		t.Fatal("Invalid SEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 SEARCH OLDER 60\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* SEARCH" {
+		t.Fatal("Invalid SEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestSearch_WithinUnsupported(t *testing.T) {
+	s, c, scanner := testServerSelected(t, true)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 SEARCH NOT YOUNGER 60\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestSearch_Partial(t *testing.T) {
+	s, c, scanner := testServerSelected(t, true)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 UID SEARCH RETURN (COUNT PARTIAL -1:-10) ALL\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ESEARCH (TAG \"a001\") UID COUNT 1 PARTIAL (-1:-10 6)" {
+		t.Fatal("Invalid ESEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 SEARCH RETURN (PARTIAL 2:10) ALL\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ESEARCH (TAG \"a002\") PARTIAL (2:10 NIL)" {
+		t.Fatal("Invalid ESEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestSearch_Update(t *testing.T) {
+	s, c, scanner := testServerSelected(t, false)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 UID SEARCH RETURN (CONTEXT UPDATE) UNSEEN\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ESEARCH (TAG \"a001\") UID" {
+		t.Fatal("Invalid ESEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 STORE 1 -FLAGS.SILENT (\\Seen)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ESEARCH (TAG \"a001\") UID ADDTO (0 6)" {
+		t.Fatal("Invalid ESEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a003 STORE 1 +FLAGS.SILENT (\\Seen)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* ESEARCH (TAG \"a001\") UID REMOVEFROM (0 6)" {
+		t.Fatal("Invalid ESEARCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a003 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a004 CANCELUPDATE \"a001\"\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a004 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a005 STORE 1 -FLAGS.SILENT (\\Seen)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a005 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a006 CANCELUPDATE \"a001\"\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a006 NO ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
+
+func TestFetch_Partial(t *testing.T) {
+	s, c, scanner := testServerSelected(t, true)
+	defer c.Close()
+	defer s.Close()
+
+	io.WriteString(c, "a001 UID FETCH 1:* (FLAGS) (PARTIAL -1:-10)\r\n")
+	scanner.Scan()
+	if scanner.Text() != "* 1 FETCH (FLAGS (\\Seen) UID 6)" {
+		t.Fatal("Invalid FETCH response:", scanner.Text())
+	}
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a001 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+
+	io.WriteString(c, "a002 UID FETCH 1:* (FLAGS) (PARTIAL 2:10)\r\n")
+	scanner.Scan()
+	if !strings.HasPrefix(scanner.Text(), "a002 OK ") {
+		t.Fatal("Invalid status response:", scanner.Text())
+	}
+}
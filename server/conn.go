@@ -5,6 +5,9 @@ import (
 	"errors"
 	"io"
 	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -36,6 +39,7 @@ type Conn interface {
 
 	setTLSConn(*tls.Conn)
 	silent() *bool // TODO: remove this
+	updateContext() *updateContext
 	serve() error
 	commandHandler(cmd *imap.Command) (hdlr Handler, err error)
 }
@@ -50,6 +54,24 @@ type Context struct {
 	Mailbox backend.Mailbox
 	// True if the currently selected mailbox has been opened in read-only mode.
 	MailboxReadOnly bool
+	// Extensions enabled by the client with the ENABLE command, defined in RFC
+	// 5161.
+	Enabled map[string]bool
+	// Events requested by the client with the NOTIFY command, defined in RFC
+	// 5465. Nil if notifications are disabled.
+	Notify *imap.NotifySpec
+	// The UIDs of the messages saved with SEARCH RETURN (SAVE), as defined in
+	// RFC 5182. Nil if no search result has been saved in the selected mailbox.
+	SavedSearch *imap.SeqSet
+	// Search results kept updated with the UPDATE return option, as defined
+	// in RFC 5267 section 4. They are discarded when the mailbox is closed.
+	SearchUpdates []*SearchUpdate
+	// The identification sent by the client with the ID command, as defined
+	// in RFC 2971. Nil if the client hasn't identified itself.
+	ClientID map[string]string
+	// The tag of the command being handled, used by responses which refer to
+	// it such as ESEARCH.
+	Tag string
 	// Responses to send to the client.
 	Responses chan<- imap.WriterTo
 	// Closed when the client is logged out.
@@ -67,6 +89,9 @@ type conn struct {
 	responses chan imap.WriterTo
 	loggedOut chan struct{}
 	silentVal bool
+
+	updateLocker sync.Mutex
+	updateCtx    *updateContext
 }
 
 func newConn(s *Server, c net.Conn) *conn {
@@ -90,6 +115,7 @@ func newConn(s *Server, c net.Conn) *conn {
 			Responses: responses,
 			LoggedOut: loggedOut,
 		},
+		updateCtx: &updateContext{},
 		tlsConn:   tlsConn,
 		continues: continues,
 		responses: responses,
@@ -102,6 +128,11 @@ func newConn(s *Server, c net.Conn) *conn {
 	if s.MaxLiteralSize > 0 {
 		conn.Conn.MaxLiteralSize = s.MaxLiteralSize
 	}
+	if s.LiteralMinus {
+		conn.Conn.MaxNonSyncLiteralSize = imap.LiteralMinusMax
+	}
+
+	r.CheckLiteral = conn.checkLiteral
 
 	conn.l.Lock()
 	go conn.send()
@@ -119,13 +150,12 @@ func (c *conn) Context() *Context {
 
 type response struct {
 	response imap.WriterTo
-	done     chan struct{}
+	// Closed by the sending goroutine once the response has been flushed
+	done chan struct{}
 }
 
 func (r *response) WriteTo(w *imap.Writer) error {
-	err := r.response.WriteTo(w)
-	close(r.done)
-	return err
+	return r.response.WriteTo(w)
 }
 
 func (c *conn) setDeadline() {
@@ -159,7 +189,27 @@ func (c *conn) Close() error {
 }
 
 func (c *conn) Capabilities() []string {
+	if c.s.capabilities != nil {
+		return c.customCapabilities()
+	}
+
 	caps := []string{"IMAP4rev1"}
+	if c.s.supportIMAP4rev2() {
+		caps = append(caps, imap.IMAP4rev2)
+	}
+
+	// Non-synchronizing literals can be used in all states
+	if c.s.LiteralMinus {
+		caps = append(caps, "LITERAL-")
+	} else {
+		caps = append(caps, "LITERAL+")
+	}
+	if c.s.supportLoginReferrals() {
+		caps = append(caps, "LOGIN-REFERRALS")
+	}
+	if _, ok := c.s.Backend.(backend.IDBackend); ok {
+		caps = append(caps, "ID")
+	}
 
 	if c.ctx.State == imap.NotAuthenticatedState {
 		if !c.IsTLS() && c.s.TLSConfig != nil {
@@ -169,10 +219,107 @@ func (c *conn) Capabilities() []string {
 		if !c.canAuth() {
 			caps = append(caps, "LOGINDISABLED")
 		} else {
+			caps = append(caps, "SASL-IR")
+			var auths []string
 			for name := range c.s.auths {
-				caps = append(caps, "AUTH="+name)
+				// Channel binding requires TLS
+				if strings.HasSuffix(name, "-PLUS") && !c.IsTLS() {
+					continue
+				}
+				auths = append(auths, "AUTH="+name)
+			}
+			sort.Strings(auths)
+			caps = append(caps, auths...)
+		}
+	}
+
+	if c.ctx.State&imap.AuthenticatedState != 0 {
+		caps = append(caps, "IDLE", "ESEARCH", "SEARCHRES", "PARTIAL", "CONTEXT=SEARCH", "LIST-EXTENDED", "LIST-STATUS", "CHILDREN", "NAMESPACE", "UNSELECT")
+
+		// ENABLE is advertised as soon as there is an extension to enable
+		if c.s.supportModSeq() {
+			caps = append(caps, "CONDSTORE", "ENABLE")
+		} else if c.s.UTF8Accept || c.s.supportIMAP4rev2() {
+			caps = append(caps, "ENABLE")
+		}
+		if c.s.UTF8Accept {
+			caps = append(caps, imap.UTF8Accept)
+		}
+		if c.s.supportQResync() {
+			caps = append(caps, "QRESYNC")
+		}
+		if c.s.supportNotify() {
+			caps = append(caps, "NOTIFY")
+		}
+		if c.s.supportMetadata() {
+			caps = append(caps, "METADATA")
+		}
+		if c.s.supportBinary() {
+			caps = append(caps, "BINARY")
+		}
+		if c.s.supportUidPlus() {
+			caps = append(caps, "UIDPLUS")
+		}
+		if c.s.supportMultiAppend() {
+			caps = append(caps, "MULTIAPPEND")
+		}
+		if c.s.supportObjectId() {
+			caps = append(caps, "OBJECTID")
+		}
+		if c.s.supportPreview() {
+			caps = append(caps, "PREVIEW")
+		}
+		if c.s.supportSaveDate() {
+			caps = append(caps, "SAVEDATE")
+		}
+		if c.s.supportWithin() {
+			caps = append(caps, "WITHIN")
+		}
+		if c.s.supportStatusSize() {
+			caps = append(caps, "STATUS=SIZE")
+		}
+		if c.s.supportACL() {
+			caps = append(caps, "ACL", "RIGHTS=texk")
+		}
+		if c.s.supportAnnotate() {
+			caps = append(caps, "ANNOTATE-EXPERIMENT-1")
+		}
+		if be, ok := c.s.Backend.(backend.AppendLimitBackend); ok {
+			// Without a value, the limit is returned per mailbox by STATUS,
+			// see RFC 7889 section 3
+			if limit := be.AppendLimit(); limit > 0 {
+				caps = append(caps, "APPENDLIMIT="+strconv.FormatUint(limit, 10))
+			} else {
+				caps = append(caps, "APPENDLIMIT")
 			}
 		}
+		if c.s.Unauthenticate {
+			caps = append(caps, "UNAUTHENTICATE")
+		}
+		if c.s.XList {
+			caps = append(caps, "XLIST")
+		}
+		if c.s.supportMove() {
+			caps = append(caps, "MOVE")
+		}
+		if c.s.supportReplace() {
+			caps = append(caps, "REPLACE")
+		}
+		if c.s.supportMailboxReferrals() {
+			caps = append(caps, "MAILBOX-REFERRALS")
+		}
+		if _, ok := c.ctx.User.(backend.QuotaUser); ok {
+			caps = append(caps, "QUOTA")
+		}
+		if _, ok := c.ctx.User.(backend.CatenateUser); ok {
+			caps = append(caps, "CATENATE")
+		}
+		if _, ok := c.ctx.User.(backend.SpecialUseUser); ok {
+			caps = append(caps, "CREATE-SPECIAL-USE")
+		}
+		if _, ok := c.ctx.User.(backend.URLAuthUser); ok {
+			caps = append(caps, "URLAUTH")
+		}
 	}
 
 	for _, ext := range c.s.extensions {
@@ -182,6 +329,37 @@ func (c *conn) Capabilities() []string {
 	return caps
 }
 
+// customCapabilities returns the capabilities returned by the function set
+// with Server.SetCapabilities. STARTTLS and LOGINDISABLED are always computed
+// by the server, and authentication mechanisms are only advertised when they
+// can be used.
+func (c *conn) customCapabilities() []string {
+	caps := []string{"IMAP4rev1"}
+
+	notAuthenticated := c.ctx.State == imap.NotAuthenticatedState
+	if notAuthenticated {
+		if !c.IsTLS() && c.s.TLSConfig != nil {
+			caps = append(caps, "STARTTLS")
+		}
+		if !c.canAuth() {
+			caps = append(caps, "LOGINDISABLED")
+		}
+	}
+
+	for _, cap := range c.s.capabilities(c, c.ctx.State) {
+		name := strings.ToUpper(cap)
+		switch {
+		case name == "IMAP4REV1", name == "STARTTLS", name == "LOGINDISABLED":
+			continue
+		case strings.HasPrefix(name, "AUTH=") && (!notAuthenticated || !c.canAuth()):
+			continue
+		}
+		caps = append(caps, cap)
+	}
+
+	return caps
+}
+
 func (c *conn) send() {
 	// Send continuation requests
 	go func() {
@@ -211,6 +389,13 @@ func (c *conn) send() {
 			}
 
 			c.l.Unlock()
+
+			// WriteResp only returns once the response has been flushed, so
+			// that the connection can be upgraded right after, e.g. by
+			// STARTTLS or COMPRESS
+			if r, ok := res.(*response); ok {
+				close(r.done)
+			}
 		case <-c.loggedOut:
 			return
 		}
@@ -285,18 +470,44 @@ func (c *conn) serve() error {
 		var up Upgrader
 
 		c.Wait()
+
+		// Unilateral updates are only sent while a command is running, except
+		// for clients which requested notifications with NOTIFY: these must
+		// be sent as soon as possible, as defined in RFC 5465 section 3
+		notify := c.ctx.Notify != nil
+		if notify {
+			c.l.Unlock()
+		}
 		fields, err := c.ReadLine()
+		if notify {
+			c.l.Lock()
+		}
 		if err == io.EOF || c.ctx.State == imap.LogoutState {
 			return nil
 		}
 		c.setDeadline()
 
 		if err != nil {
-			if imap.IsParseError(err) {
-				res = &imap.StatusResp{
-					Type: imap.StatusRespBad,
-					Info: err.Error(),
+			statusErr, rejected := err.(*errStatusResp)
+			if imap.IsParseError(err) || rejected {
+				if rejected {
+					// A literal has been rejected by checkLiteral
+					res = statusErr.resp
+				} else {
+					res = &imap.StatusResp{
+						Type: imap.StatusRespBad,
+						Info: err.Error(),
+					}
+				}
+
+				// Skip the rest of the invalid command, including a rejected
+				// non-synchronizing literal which is sent anyway
+				if err := c.DiscardLiteral(); err != nil {
+					c.s.ErrorLog.Println("cannot discard literal:", err)
+					return err
 				}
+				// If this fails, the next read fails as well
+				c.DiscardLine()
 			} else {
 				c.s.ErrorLog.Println("cannot read command:", err)
 				return err
@@ -312,6 +523,8 @@ func (c *conn) serve() error {
 			} else {
 				var err error
 				res, up, err = c.handleCommand(cmd)
+				// Mailbox names are sent in UTF-8 once UTF8=ACCEPT is enabled
+				c.Writer.UTF8 = c.ctx.Enabled[imap.UTF8Accept]
 				if err != nil {
 					res = &imap.StatusResp{
 						Tag:  cmd.Tag,
@@ -343,6 +556,70 @@ func (c *conn) serve() error {
 	}
 }
 
+// updateContext returns the snapshot of the context taken after the last
+// command, used to send backend updates.
+func (c *conn) updateContext() *updateContext {
+	c.updateLocker.Lock()
+	defer c.updateLocker.Unlock()
+	return c.updateCtx
+}
+
+// saveUpdateContext takes a snapshot of the context. It must be called from
+// the connection's goroutine once a command has completed.
+func (c *conn) saveUpdateContext() {
+	uc := newUpdateContext(c.ctx)
+
+	c.updateLocker.Lock()
+	c.updateCtx = uc
+	c.updateLocker.Unlock()
+}
+
+// checkLiteral rejects messages larger than APPENDLIMIT before the client is
+// asked to send them, see RFC 7889 section 4. The limit is checked again once
+// the command has been read.
+func (c *conn) checkLiteral(line []interface{}, size int64) error {
+	if c.ctx.User == nil || len(line) < 3 {
+		return nil
+	}
+
+	args := line[1:]
+	if name, _ := args[0].(string); strings.EqualFold(name, "UID") {
+		args = args[1:]
+	}
+	var mailbox interface{}
+	if name, _ := args[0].(string); strings.EqualFold(name, "APPEND") && len(args) > 1 {
+		mailbox = args[1]
+	} else if strings.EqualFold(name, "REPLACE") && len(args) > 2 {
+		mailbox = args[2]
+	} else {
+		return nil
+	}
+
+	name, err := imap.ParseString(mailbox)
+	if err != nil {
+		return nil
+	}
+	if name, err = imap.DecodeMailboxName(name); err != nil {
+		return nil
+	}
+	// Other errors are reported by the command
+	mbox, err := c.ctx.User.GetMailbox(imap.CanonicalMailboxName(name))
+	if err != nil {
+		return nil
+	}
+
+	if limit := c.s.appendLimit(mbox); limit > 0 && uint64(size) > limit {
+		tag, _ := line[0].(string)
+		return &errStatusResp{&imap.StatusResp{
+			Tag:  tag,
+			Type: imap.StatusRespNo,
+			Code: imap.CodeTooBig,
+			Info: backend.ErrTooBig.Error(),
+		}}
+	}
+	return nil
+}
+
 func (c *conn) commandHandler(cmd *imap.Command) (hdlr Handler, err error) {
 	newHandler := c.s.Command(cmd.Name)
 	if newHandler == nil {
@@ -361,12 +638,20 @@ func (c *conn) handleCommand(cmd *imap.Command) (res *imap.StatusResp, up Upgrad
 		return
 	}
 
+	c.ctx.Tag = cmd.Tag
+
 	c.l.Unlock()
 	defer c.l.Lock()
 
 	hdlrErr := hdlr.Handle(c)
+	if err := updateSearches(c); err != nil {
+		c.s.ErrorLog.Println("cannot update search results:", err)
+	}
+	c.saveUpdateContext()
 	if statusErr, ok := hdlrErr.(*errStatusResp); ok {
 		res = statusErr.resp
+	} else if referralErr, ok := hdlrErr.(*imap.ReferralError); ok {
+		res = referralResp(referralErr)
 	} else if hdlrErr != nil {
 		res = &imap.StatusResp{
 			Type: imap.StatusRespNo,
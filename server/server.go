@@ -8,12 +8,16 @@ import (
 	"log"
 	"net"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/oauth"
 	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/scram"
 	"github.com/emersion/go-sasl"
 )
 
@@ -93,9 +97,10 @@ type Server struct {
 	listeners map[net.Listener]struct{}
 	conns     map[Conn]struct{}
 
-	commands   map[string]HandlerFactory
-	auths      map[string]SASLServerFactory
-	extensions []Extension
+	commands     map[string]HandlerFactory
+	auths        map[string]SASLServerFactory
+	extensions   []Extension
+	capabilities func(conn Conn, state imap.ConnState) []string
 
 	// TCP address to listen on.
 	Addr string
@@ -121,6 +126,31 @@ type Server struct {
 	// The maximum literal size, in bytes. Literals exceeding this size will be
 	// rejected. A value of zero disables the limit (this is the default).
 	MaxLiteralSize uint32
+	// If set to true, the server advertises LITERAL- instead of LITERAL+ and
+	// rejects non-synchronizing literals larger than imap.LiteralMinusMax
+	// bytes, see RFC 7888.
+	LiteralMinus bool
+	// If set to true, the server advertises UTF8=ACCEPT. Once enabled by a
+	// client, mailbox names are sent in UTF-8 instead of modified UTF-7 and
+	// UTF-8 messages can be appended, see RFC 6855. The backend must accept
+	// messages with UTF-8 headers.
+	UTF8Accept bool
+	// If set to true, the server advertises IMAP4rev2 and clients can switch
+	// to IMAP4rev2 with ENABLE, see RFC 9051 section 6.3.1. Once enabled,
+	// RECENT and the \Recent flag aren't sent anymore, SEARCH returns an
+	// ESEARCH response and SELECT returns a LIST response. IMAP4rev2 is only
+	// advertised if the backend supports MOVE, UIDPLUS, BINARY and
+	// STATUS=SIZE.
+	IMAP4rev2 bool
+	// If set to true, the server advertises UNAUTHENTICATE and clients can go
+	// back to the not authenticated state to log in as another user, see RFC
+	// 8437. This allows proxies to reuse connections.
+	Unauthenticate bool
+	// If set to true, the server advertises XLIST and handles the XLIST
+	// command, an alias of LIST returning XLIST attributes for special-use
+	// mailboxes. This is only useful for legacy clients which don't support
+	// RFC 6154.
+	XList bool
 }
 
 // Create a new IMAP server from an existing listener.
@@ -152,10 +182,62 @@ func New(bkd backend.Backend) *Server {
 		},
 	}
 
+	if be, ok := bkd.(backend.OAuthBackend); ok {
+		login := func(conn Conn) oauth.Authenticator {
+			return func(opts *oauth.Options) error {
+				user, err := be.LoginOAuth(opts.Username, opts.Token)
+				if err != nil {
+					return err
+				}
+
+				ctx := conn.Context()
+				ctx.State = imap.AuthenticatedState
+				ctx.User = user
+				return nil
+			}
+		}
+		s.auths[oauth.OAuthBearer] = func(conn Conn) sasl.Server {
+			return oauth.NewOAuthBearerServer(login(conn))
+		}
+		s.auths[oauth.XOAuth2] = func(conn Conn) sasl.Server {
+			return oauth.NewXOAuth2Server(login(conn))
+		}
+	}
+
+	if be, ok := bkd.(backend.SCRAMBackend); ok {
+		options := func(conn Conn) *scram.ServerOptions {
+			opts := &scram.ServerOptions{
+				Credentials: be.SCRAMCredentials,
+				Authenticated: func(username string) error {
+					user, err := be.LoginSCRAM(username)
+					if err != nil {
+						return err
+					}
+
+					ctx := conn.Context()
+					ctx.State = imap.AuthenticatedState
+					ctx.User = user
+					return nil
+				},
+			}
+			if state := conn.TLSState(); state != nil {
+				opts.ChannelBinding, _ = scram.TLSChannelBinding(state)
+			}
+			return opts
+		}
+		s.auths[scram.SHA256] = func(conn Conn) sasl.Server {
+			return scram.NewServer(options(conn))
+		}
+		s.auths[scram.SHA256Plus] = func(conn Conn) sasl.Server {
+			return scram.NewPlusServer(options(conn))
+		}
+	}
+
 	s.commands = map[string]HandlerFactory{
 		"NOOP":       func() Handler { return &Noop{} },
 		"CAPABILITY": func() Handler { return &Capability{} },
 		"LOGOUT":     func() Handler { return &Logout{} },
+		"ID":         func() Handler { return &ID{} },
 
 		"STARTTLS":     func() Handler { return &StartTLS{} },
 		"LOGIN":        func() Handler { return &Login{} },
@@ -178,17 +260,51 @@ func New(bkd backend.Backend) *Server {
 			hdlr.Subscribed = true
 			return hdlr
 		},
-		"STATUS": func() Handler { return &Status{} },
-		"APPEND": func() Handler { return &Append{} },
-
-		"CHECK":   func() Handler { return &Check{} },
-		"CLOSE":   func() Handler { return &Close{} },
-		"EXPUNGE": func() Handler { return &Expunge{} },
-		"SEARCH":  func() Handler { return &Search{} },
-		"FETCH":   func() Handler { return &Fetch{} },
-		"STORE":   func() Handler { return &Store{} },
-		"COPY":    func() Handler { return &Copy{} },
-		"UID":     func() Handler { return &Uid{} },
+		// RLIST and RLSUB also list remote mailboxes, see RFC 2193 section 5.
+		// Backends supporting mailbox referrals are expected to always do so.
+		"RLIST": func() Handler { return &List{} },
+		"RLSUB": func() Handler {
+			hdlr := &List{}
+			hdlr.Subscribed = true
+			return hdlr
+		},
+		"STATUS":    func() Handler { return &Status{} },
+		"APPEND":    func() Handler { return &Append{} },
+		"IDLE":      func() Handler { return &Idle{} },
+		"ENABLE":    func() Handler { return &Enable{} },
+		"NOTIFY":    func() Handler { return &Notify{} },
+		"NAMESPACE": func() Handler { return &Namespace{} },
+
+		"CANCELUPDATE": func() Handler { return &CancelUpdate{} },
+
+		"GETMETADATA":  func() Handler { return &GetMetadata{} },
+		"SETMETADATA":  func() Handler { return &SetMetadata{} },
+		"GETQUOTA":     func() Handler { return &GetQuota{} },
+		"GETQUOTAROOT": func() Handler { return &GetQuotaRoot{} },
+		"SETQUOTA":     func() Handler { return &SetQuota{} },
+		"SETACL":       func() Handler { return &SetACL{} },
+		"DELETEACL":    func() Handler { return &DeleteACL{} },
+		"GETACL":       func() Handler { return &GetACL{} },
+		"LISTRIGHTS":   func() Handler { return &ListRights{} },
+		"MYRIGHTS":     func() Handler { return &MyRights{} },
+		"GENURLAUTH":   func() Handler { return &GenURLAuth{} },
+		"URLFETCH":     func() Handler { return &URLFetch{} },
+		"RESETKEY":     func() Handler { return &ResetKey{} },
+
+		"UNAUTHENTICATE": func() Handler { return &Unauthenticate{} },
+		"XLIST":          func() Handler { return &XList{} },
+
+		"CHECK":    func() Handler { return &Check{} },
+		"CLOSE":    func() Handler { return &Close{} },
+		"UNSELECT": func() Handler { return &Unselect{} },
+		"EXPUNGE":  func() Handler { return &Expunge{} },
+		"SEARCH":   func() Handler { return &Search{} },
+		"FETCH":    func() Handler { return &Fetch{} },
+		"STORE":    func() Handler { return &Store{} },
+		"COPY":     func() Handler { return &Copy{} },
+		"MOVE":     func() Handler { return &Move{} },
+		"REPLACE":  func() Handler { return &Replace{} },
+		"UID":      func() Handler { return &Uid{} },
 	}
 
 	return s
@@ -289,6 +405,243 @@ func (s *Server) Command(name string) HandlerFactory {
 	return s.commands[name]
 }
 
+// updateResponse converts a backend update to a response. It returns nil if
+// the update is unknown.
+func updateResponse(item interface{}) (*backend.Update, imap.WriterTo) {
+	switch item := item.(type) {
+	case *backend.StatusUpdate:
+		return &item.Update, item.StatusResp
+	case *backend.MailboxUpdate:
+		return &item.Update, &responses.Select{Mailbox: item.MailboxStatus}
+	case *backend.MessageUpdate:
+		ch := make(chan *imap.Message, 1)
+		ch <- item.Message
+		close(ch)
+
+		return &item.Update, &responses.Fetch{Messages: ch}
+	case *backend.ExpungeUpdate:
+		ch := make(chan uint32, 1)
+		ch <- item.SeqNum
+		close(ch)
+
+		return &item.Update, &responses.Expunge{SeqNums: ch}
+	case *backend.MailboxNameUpdate:
+		return &item.Update, mailboxNameResponse(item.MailboxInfo)
+	default:
+		return nil, nil
+	}
+}
+
+// enabledUpdateResponse adapts the response to a backend update to the
+// extensions enabled by the client, as defined in RFC 7162 section 3. Once
+// CONDSTORE is enabled, unsolicited FETCH responses include the UID and
+// mod-sequence of the message. Once QRESYNC is enabled, VANISHED is sent
+// instead of EXPUNGE.
+func enabledUpdateResponse(enabled map[string]bool, item interface{}, res imap.WriterTo) imap.WriterTo {
+	switch item := item.(type) {
+	case *backend.MessageUpdate:
+		if !enabled["CONDSTORE"] {
+			break
+		}
+
+		var items []imap.FetchItem
+		for k := range item.Message.Items {
+			if k != imap.FetchUid && k != imap.FetchModSeq {
+				items = append(items, k)
+			}
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i] < items[j] })
+		if item.Uid > 0 {
+			items = append(items, imap.FetchUid)
+		}
+		if item.ModSeq > 0 {
+			items = append(items, imap.FetchModSeq)
+		}
+
+		msg := imap.NewMessage(item.SeqNum, items)
+		msg.Envelope = item.Envelope
+		msg.BodyStructure = item.BodyStructure
+		msg.Flags = item.Flags
+		msg.InternalDate = item.InternalDate
+		msg.Size = item.Size
+		msg.Uid = item.Uid
+		msg.Body = item.Body
+		msg.ModSeq = item.ModSeq
+
+		ch := make(chan *imap.Message, 1)
+		ch <- msg
+		close(ch)
+		return &responses.Fetch{Messages: ch}
+	case *backend.ExpungeUpdate:
+		if !enabled["QRESYNC"] || item.Uid == 0 {
+			break
+		}
+
+		uids := new(imap.SeqSet)
+		uids.AddNum(item.Uid)
+		return &responses.Vanished{Uids: uids}
+	}
+	return res
+}
+
+func mailboxNameResponse(info *imap.MailboxInfo) imap.WriterTo {
+	ch := make(chan *imap.MailboxInfo, 1)
+	ch <- info
+	close(ch)
+
+	return &responses.List{Mailboxes: ch}
+}
+
+// updateContext is a snapshot of the parts of a connection's context needed
+// to convert backend updates to responses. Updates are converted in their own
+// goroutines, which can't read the context while a command is running.
+type updateContext struct {
+	user    backend.User
+	mailbox string // Name of the selected mailbox, empty if none
+	notify  *imap.NotifySpec
+	enabled map[string]bool
+}
+
+func newUpdateContext(ctx *Context) *updateContext {
+	uc := &updateContext{user: ctx.User, notify: ctx.Notify}
+	if ctx.Mailbox != nil {
+		uc.mailbox = ctx.Mailbox.Name()
+	}
+	if len(ctx.Enabled) > 0 {
+		uc.enabled = make(map[string]bool, len(ctx.Enabled))
+		for k, v := range ctx.Enabled {
+			uc.enabled[k] = v
+		}
+	}
+	return uc
+}
+
+// notifyStatusItems are the items sent in STATUS responses to clients which
+// requested notifications with NOTIFY.
+var notifyStatusItems = []imap.StatusItem{
+	imap.StatusMessages, imap.StatusUidNext, imap.StatusUidValidity, imap.StatusUnseen,
+}
+
+// notifyResponse converts a backend update to a response for a client which
+// requested notifications with NOTIFY, as defined in RFC 5465 section 5.
+// Changes in mailboxes other than the selected one are reported with STATUS
+// responses. It returns nil if the client hasn't requested this event.
+func notifyResponse(uc *updateContext, item interface{}) imap.WriterTo {
+	var update *backend.Update
+	var event imap.NotifyEvent
+	switch item := item.(type) {
+	case *backend.MailboxUpdate:
+		update, event = &item.Update, imap.NotifyMessageNew
+	case *backend.MessageUpdate:
+		update, event = &item.Update, imap.NotifyFlagChange
+	case *backend.ExpungeUpdate:
+		update, event = &item.Update, imap.NotifyMessageExpunge
+	case *backend.MailboxNameUpdate:
+		if !notifyEvent(uc, item.Update.Mailbox, imap.NotifyMailboxName) {
+			return nil
+		}
+		return mailboxNameResponse(item.MailboxInfo)
+	default:
+		return nil
+	}
+
+	if !notifyEvent(uc, update.Mailbox, event) {
+		return nil
+	}
+
+	mbox, err := uc.user.GetMailbox(update.Mailbox)
+	if err != nil {
+		return nil
+	}
+	status, err := mbox.Status(notifyStatusItems)
+	if err != nil {
+		return nil
+	}
+	return &responses.Status{Mailbox: status}
+}
+
+// notifyEvent checks if the client requested to be notified about event in
+// the mailbox name.
+func notifyEvent(uc *updateContext, name string, event imap.NotifyEvent) bool {
+	g := notifyGroup(uc, name)
+	if g == nil {
+		return false
+	}
+
+	for _, e := range g.Events {
+		if strings.EqualFold(string(e), string(event)) {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyGroup returns the first NOTIFY event group matching the mailbox name,
+// or nil if there is none.
+func notifyGroup(uc *updateContext, name string) *imap.NotifyEventGroup {
+	if uc.notify == nil || uc.user == nil {
+		return nil
+	}
+
+	for _, g := range uc.notify.Groups {
+		var match bool
+		switch g.Filter {
+		case imap.NotifySelected, imap.NotifySelectedDelayed:
+			match = uc.mailbox != "" && uc.mailbox == name
+		case imap.NotifyInboxes:
+			match = name == imap.InboxName
+		case imap.NotifyPersonal:
+			match = true
+		case imap.NotifySubscribed:
+			mailboxes, err := uc.user.ListMailboxes(true)
+			if err != nil {
+				break
+			}
+			for _, mbox := range mailboxes {
+				if mbox.Name() == name {
+					match = true
+					break
+				}
+			}
+		case imap.NotifyMailboxes:
+			for _, mbox := range g.Mailboxes {
+				if mbox == name {
+					match = true
+					break
+				}
+			}
+		case imap.NotifySubtree:
+			for _, mbox := range g.Mailboxes {
+				if mbox == name || isSubtree(uc.user, mbox, name) {
+					match = true
+					break
+				}
+			}
+		}
+		if match {
+			return g
+		}
+	}
+	return nil
+}
+
+// isSubtree checks if the mailbox name is a child of the mailbox parent.
+func isSubtree(user backend.User, parent, name string) bool {
+	if !strings.HasPrefix(name, parent) || len(name) == len(parent) {
+		return false
+	}
+
+	mbox, err := user.GetMailbox(parent)
+	if err != nil {
+		return false
+	}
+	info, err := mbox.Info()
+	if err != nil || info.Delimiter == "" {
+		return false
+	}
+	return strings.HasPrefix(name[len(parent):], info.Delimiter)
+}
+
 func (s *Server) listenUpdates() (err error) {
 	updater, ok := s.Backend.(backend.Updater)
 	if !ok {
@@ -299,39 +652,9 @@ func (s *Server) listenUpdates() (err error) {
 	for {
 		item := <-s.Updates
 
-		var (
-			update *backend.Update
-			res    imap.WriterTo
-		)
-
-		switch item := item.(type) {
-		case *backend.StatusUpdate:
-			update = &item.Update
-			res = item.StatusResp
-		case *backend.MailboxUpdate:
-			update = &item.Update
-			res = &responses.Select{Mailbox: item.MailboxStatus}
-		case *backend.MessageUpdate:
-			update = &item.Update
-
-			ch := make(chan *imap.Message, 1)
-			ch <- item.Message
-			close(ch)
-
-			res = &responses.Fetch{Messages: ch}
-		case *backend.ExpungeUpdate:
-			update = &item.Update
-
-			ch := make(chan uint32, 1)
-			ch <- item.SeqNum
-			close(ch)
-
-			res = &responses.Expunge{SeqNums: ch}
-		default:
-			s.ErrorLog.Printf("unhandled update: %T\n", item)
-		}
-
+		update, res := updateResponse(item)
 		if update == nil || res == nil {
+			s.ErrorLog.Printf("unhandled update: %T\n", item)
 			continue
 		}
 
@@ -339,12 +662,20 @@ func (s *Server) listenUpdates() (err error) {
 		wait := 0
 		s.locker.Lock()
 		for conn := range s.conns {
-			ctx := conn.Context()
+			uc := conn.updateContext()
 
-			if update.Username != "" && (ctx.User == nil || ctx.User.Username() != update.Username) {
+			if update.Username != "" && (uc.user == nil || uc.user.Username() != update.Username) {
 				continue
 			}
-			if update.Mailbox != "" && (ctx.Mailbox == nil || ctx.Mailbox.Name() != update.Mailbox) {
+
+			// Mailbox name updates and updates for mailboxes other than the
+			// selected one are only sent to clients which requested them
+			// with NOTIFY
+			_, notify := item.(*backend.MailboxNameUpdate)
+			if update.Mailbox != "" && uc.mailbox != update.Mailbox {
+				notify = true
+			}
+			if notify && uc.notify == nil {
 				continue
 			}
 			if *conn.silent() {
@@ -356,12 +687,21 @@ func (s *Server) listenUpdates() (err error) {
 
 			conn := conn // Copy conn to a local variable
 			go func() {
-				done := make(chan struct{})
-				conn.Context().Responses <- &response{
-					response: res,
-					done:     done,
+				res := res
+				if notify {
+					res = notifyResponse(uc, item)
+				} else {
+					res = enabledUpdateResponse(uc.enabled, item, res)
+				}
+
+				if res != nil {
+					done := make(chan struct{})
+					conn.Context().Responses <- &response{
+						response: res,
+						done:     done,
+					}
+					<-done
 				}
-				<-done
 				sends <- struct{}{}
 			}()
 
@@ -409,6 +749,186 @@ func (s *Server) Close() error {
 	return nil
 }
 
+// supportModSeq returns true if the backend supports mod-sequences.
+func (s *Server) supportModSeq() bool {
+	be, ok := s.Backend.(backend.ModSeqBackend)
+	return ok && be.SupportModSeq()
+}
+
+// enableCondStore enables CONDSTORE for the rest of the session. This is done
+// by commands using CONDSTORE features, see RFC 7162 section 3.1.
+func enableCondStore(ctx *Context) {
+	if ctx.Enabled == nil {
+		ctx.Enabled = make(map[string]bool)
+	}
+	ctx.Enabled["CONDSTORE"] = true
+}
+
+// supportQResync returns true if the backend supports QRESYNC.
+func (s *Server) supportQResync() bool {
+	be, ok := s.Backend.(backend.QResyncBackend)
+	return ok && be.SupportModSeq() && be.SupportQResync()
+}
+
+// supportMetadata returns true if the backend supports metadata.
+func (s *Server) supportMetadata() bool {
+	be, ok := s.Backend.(backend.MetadataBackend)
+	return ok && be.SupportMetadata()
+}
+
+// supportBinary returns true if the backend is able to fetch decoded body
+// parts.
+func (s *Server) supportBinary() bool {
+	be, ok := s.Backend.(backend.BinaryBackend)
+	return ok && be.SupportBinary()
+}
+
+// supportUidPlus returns true if the backend reports the UIDs of appended
+// and copied messages.
+func (s *Server) supportUidPlus() bool {
+	be, ok := s.Backend.(backend.UidPlusBackend)
+	return ok && be.SupportUidPlus()
+}
+
+// supportObjectId returns true if the backend assigns unique identifiers to
+// mailboxes and messages.
+func (s *Server) supportObjectId() bool {
+	be, ok := s.Backend.(backend.ObjectIdBackend)
+	return ok && be.SupportObjectId()
+}
+
+// supportPreview returns true if the backend is able to generate message
+// previews.
+func (s *Server) supportPreview() bool {
+	be, ok := s.Backend.(backend.PreviewBackend)
+	return ok && be.SupportPreview()
+}
+
+// supportWithin returns true if the backend can search messages by age.
+func (s *Server) supportWithin() bool {
+	be, ok := s.Backend.(backend.WithinBackend)
+	return ok && be.SupportWithin()
+}
+
+// supportSaveDate returns true if the backend keeps the date messages were
+// saved to their mailbox.
+func (s *Server) supportSaveDate() bool {
+	be, ok := s.Backend.(backend.SaveDateBackend)
+	return ok && be.SupportSaveDate()
+}
+
+// supportStatusSize returns true if the backend can report the size of
+// mailboxes.
+func (s *Server) supportStatusSize() bool {
+	be, ok := s.Backend.(backend.StatusSizeBackend)
+	return ok && be.SupportStatusSize()
+}
+
+// supportACL returns true if the backend controls access to mailboxes with
+// access control lists.
+func (s *Server) supportACL() bool {
+	be, ok := s.Backend.(backend.ACLBackend)
+	return ok && be.SupportACL()
+}
+
+// supportIMAP4rev2 returns true if IMAP4rev2 is enabled and the backend
+// supports the extensions it requires, see RFC 9051 appendix E.
+func (s *Server) supportIMAP4rev2() bool {
+	return s.IMAP4rev2 && s.supportMove() && s.supportUidPlus() &&
+		s.supportBinary() && s.supportStatusSize()
+}
+
+// rev2Enabled returns true if the client has switched to IMAP4rev2.
+func rev2Enabled(ctx *Context) bool {
+	return ctx.Enabled[strings.ToUpper(imap.IMAP4rev2)]
+}
+
+// supportMove returns true if the backend can move messages between
+// mailboxes.
+func (s *Server) supportMove() bool {
+	be, ok := s.Backend.(backend.MoveBackend)
+	return ok && be.SupportMove()
+}
+
+// supportReplace returns true if the backend can replace messages.
+func (s *Server) supportReplace() bool {
+	be, ok := s.Backend.(backend.ReplaceBackend)
+	return ok && be.SupportReplace()
+}
+
+// supportAppendLimit returns true if the backend limits the size of appended
+// messages.
+func (s *Server) supportAppendLimit() bool {
+	_, ok := s.Backend.(backend.AppendLimitBackend)
+	return ok
+}
+
+// appendLimit returns the maximum size of a message appended to mbox, or zero
+// if there is no limit.
+func (s *Server) appendLimit(mbox backend.Mailbox) uint64 {
+	if lmbox, ok := mbox.(backend.AppendLimitMailbox); ok {
+		if limit := lmbox.AppendLimit(); limit > 0 {
+			return limit
+		}
+	}
+	if be, ok := s.Backend.(backend.AppendLimitBackend); ok {
+		return be.AppendLimit()
+	}
+	return 0
+}
+
+// supportLoginReferrals returns true if the backend may refer users to other
+// servers when they log in.
+func (s *Server) supportLoginReferrals() bool {
+	be, ok := s.Backend.(backend.ReferralBackend)
+	return ok && be.SupportLoginReferrals()
+}
+
+// supportMailboxReferrals returns true if the backend may refer users to
+// other servers when they access mailboxes.
+func (s *Server) supportMailboxReferrals() bool {
+	be, ok := s.Backend.(backend.ReferralBackend)
+	return ok && be.SupportMailboxReferrals()
+}
+
+// referralResp returns the status response for a referral error.
+func referralResp(err *imap.ReferralError) *imap.StatusResp {
+	typ := err.Type
+	if typ == "" {
+		typ = imap.StatusRespNo
+	}
+	info := err.Info
+	if info == "" {
+		info = "Try another server"
+	}
+	return &imap.StatusResp{
+		Type:      typ,
+		Code:      imap.CodeReferral,
+		Arguments: []interface{}{imap.RawString(err.URL)},
+		Info:      info,
+	}
+}
+
+// supportAnnotate returns true if the backend supports message annotations.
+func (s *Server) supportAnnotate() bool {
+	be, ok := s.Backend.(backend.AnnotateBackend)
+	return ok && be.SupportAnnotate()
+}
+
+// supportMultiAppend returns true if the backend supports appending several
+// messages atomically.
+func (s *Server) supportMultiAppend() bool {
+	be, ok := s.Backend.(backend.MultiAppendBackend)
+	return ok && be.SupportMultiAppend()
+}
+
+// supportNotify returns true if the backend is able to send the updates
+// reported with NOTIFY.
+func (s *Server) supportNotify() bool {
+	_, ok := s.Backend.(backend.Updater)
+	return ok
+}
+
 // Enable some IMAP extensions on this server.
 //
 // This function should not be called directly, it must only be used by
@@ -417,6 +937,23 @@ func (s *Server) Enable(extensions ...Extension) {
 	s.extensions = append(s.extensions, extensions...)
 }
 
+// SetCapabilities replaces the capabilities advertised to clients by the ones
+// returned by f, which is called with the connection and its current state
+// each time capabilities are sent. This allows to advertise capabilities
+// depending on whether the client is authenticated, or to advertise custom
+// extensions. It must be called before the server starts serving connections.
+//
+// IMAP4rev1 is always advertised first. STARTTLS and LOGINDISABLED are added by
+// the server depending on the TLS state of the connection, and are ignored if
+// returned by f. Authentication mechanisms returned by f, such as AUTH=PLAIN,
+// are only advertised before authentication and if authentication is allowed
+// on the connection. LOGIN is rejected if AUTH=PLAIN isn't advertised.
+//
+// If f is nil, the default capabilities are advertised.
+func (s *Server) SetCapabilities(f func(conn Conn, state imap.ConnState) []string) {
+	s.capabilities = f
+}
+
 // Enable an authentication mechanism on this server.
 //
 // This function should not be called directly, it must only be used by
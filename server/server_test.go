@@ -2,16 +2,21 @@ package server_test
 
 import (
 	"bufio"
+	"io"
 	"net"
+	"strings"
 	"testing"
 
+	"github.com/emersion/go-imap/backend"
 	"github.com/emersion/go-imap/backend/memory"
 	"github.com/emersion/go-imap/server"
 )
 
 func testServer(t *testing.T) (s *server.Server, conn net.Conn) {
-	bkd := memory.New()
+	return testServerBackend(t, memory.New())
+}
 
+func testServerBackend(t *testing.T, bkd backend.Backend) (s *server.Server, conn net.Conn) {
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		t.Fatal("Cannot listen:", err)
@@ -30,6 +35,32 @@ func testServer(t *testing.T) (s *server.Server, conn net.Conn) {
 	return
 }
 
+// testServerLoggedIn starts a server with bkd and logs in, checking that caps
+// are advertised. If mailbox isn't empty, it's then selected.
+func testServerLoggedIn(t *testing.T, bkd backend.Backend, mailbox string, caps ...string) (s *server.Server, c net.Conn, scanner *bufio.Scanner) {
+	s, c = testServerBackend(t, bkd)
+	scanner = bufio.NewScanner(c)
+	scanner.Scan() // Greeting
+
+	io.WriteString(c, "a000 LOGIN username password\r\n")
+	scanner.Scan()
+	for _, cap := range caps {
+		if !strings.Contains(scanner.Text(), " "+cap) {
+			t.Fatal(cap+" not advertised:", scanner.Text())
+		}
+	}
+
+	if mailbox != "" {
+		io.WriteString(c, "a000 SELECT "+mailbox+"\r\n")
+		for scanner.Scan() {
+			if strings.HasPrefix(scanner.Text(), "a000 ") {
+				break
+			}
+		}
+	}
+	return
+}
+
 func TestServer_greeting(t *testing.T) {
 	s, conn := testServer(t)
 	defer conn.Close()
@@ -40,7 +71,7 @@ func TestServer_greeting(t *testing.T) {
 	scanner.Scan() // Wait for greeting
 	greeting := scanner.Text()
 
-	if greeting != "* OK [CAPABILITY IMAP4rev1 AUTH=PLAIN] IMAP4rev1 Service Ready" {
+	if greeting != "* OK [CAPABILITY IMAP4rev1 LITERAL+ SASL-IR AUTH=PLAIN] IMAP4rev1 Service Ready" {
 		t.Fatal("Bad greeting:", greeting)
 	}
 }
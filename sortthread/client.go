@@ -0,0 +1,205 @@
+package sortthread
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+)
+
+var (
+	// ErrSortNotSupported is returned if the server doesn't support SORT.
+	ErrSortNotSupported = errors.New("SORT is not supported by the server")
+	// ErrESortNotSupported is returned if the server doesn't support ESORT.
+	ErrESortNotSupported = errors.New("ESORT is not supported by the server")
+	// ErrContextSortNotSupported is returned if a sorted result is kept
+	// updated and the server doesn't support CONTEXT=SORT.
+	ErrContextSortNotSupported = errors.New("CONTEXT=SORT is not supported by the server")
+	// ErrThreadNotSupported is returned if the server doesn't support the
+	// requested threading algorithm.
+	ErrThreadNotSupported = errors.New("Threading algorithm is not supported by the server")
+)
+
+// Client is a SORT and THREAD client.
+type Client struct {
+	c *client.Client
+}
+
+// NewClient creates a new client.
+func NewClient(c *client.Client) *Client {
+	return &Client{c: c}
+}
+
+// SupportSort checks if the server supports the SORT extension.
+func (c *Client) SupportSort() (bool, error) {
+	return c.c.Support(SortCapability)
+}
+
+func (c *Client) sort(uid bool, sortCriteria []SortCriterion, searchCriteria *imap.SearchCriteria) ([]uint32, error) {
+	if c.c.State() != imap.SelectedState {
+		return nil, client.ErrNoMailboxSelected
+	}
+	if ok, err := c.SupportSort(); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrSortNotSupported
+	}
+
+	var cmd imap.Commander = &SortCommand{
+		SortCriteria:   sortCriteria,
+		Charset:        "UTF-8",
+		SearchCriteria: searchCriteria,
+	}
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	res := new(SortResponse)
+
+	status, err := c.c.Execute(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+	return res.Ids, nil
+}
+
+// Sort searches messages matching searchCriteria and returns their sequence
+// numbers sorted by sortCriteria. searchCriteria can be nil, in which case all
+// messages are sorted.
+func (c *Client) Sort(sortCriteria []SortCriterion, searchCriteria *imap.SearchCriteria) ([]uint32, error) {
+	return c.sort(false, sortCriteria, searchCriteria)
+}
+
+// UidSort is identical to Sort, but UIDs are returned instead of sequence
+// numbers.
+func (c *Client) UidSort(sortCriteria []SortCriterion, searchCriteria *imap.SearchCriteria) ([]uint32, error) {
+	return c.sort(true, sortCriteria, searchCriteria)
+}
+
+// SortResult is the result of a SORT command with result options, as defined
+// in RFC 5267 section 3. Only the requested items are set, Min and Max are the
+// first and last messages in the sort order.
+type SortResult struct {
+	// The tag of the SORT command. If the result is kept updated, changes are
+	// delivered to Client.Updates as *client.SearchUpdate values with the
+	// same tag.
+	Tag   string
+	Min   uint32
+	Max   uint32
+	Count uint32
+	// The matching messages in the sort order, returned with ALL.
+	Ids []uint32
+}
+
+func (c *Client) sortExtended(uid bool, sortCriteria []SortCriterion, searchCriteria *imap.SearchCriteria, options []string) (*SortResult, error) {
+	if c.c.State() != imap.SelectedState {
+		return nil, client.ErrNoMailboxSelected
+	}
+	if ok, err := c.c.Support(ESortCapability); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrESortNotSupported
+	}
+	for _, opt := range options {
+		if opt != imap.SearchReturnUpdate {
+			continue
+		}
+		if ok, err := c.c.Support(ContextSortCapability); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, ErrContextSortNotSupported
+		}
+	}
+
+	var cmd imap.Commander = &SortCommand{
+		SortCriteria:   sortCriteria,
+		Charset:        "UTF-8",
+		SearchCriteria: searchCriteria,
+		Return:         append([]string{}, options...),
+	}
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	res := new(ESortResponse)
+
+	status, err := c.c.Execute(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &SortResult{Tag: status.Tag, Ids: res.Ids}
+	if res.Result != nil {
+		result.Min, result.Max, result.Count = res.Result.Min, res.Result.Max, res.Result.Count
+	}
+	return result, nil
+}
+
+// SortExtended is like Sort, but only the items requested with options are
+// returned, as defined in RFC 5267 section 3. If options contains
+// imap.SearchReturnUpdate, the server keeps the result updated, see
+// client.Client.SearchContext. The server must support ESORT, and
+// CONTEXT=SORT for updates.
+func (c *Client) SortExtended(sortCriteria []SortCriterion, searchCriteria *imap.SearchCriteria, options []string) (*SortResult, error) {
+	return c.sortExtended(false, sortCriteria, searchCriteria, options)
+}
+
+// UidSortExtended is identical to SortExtended, but UIDs are returned instead
+// of sequence numbers.
+func (c *Client) UidSortExtended(sortCriteria []SortCriterion, searchCriteria *imap.SearchCriteria, options []string) (*SortResult, error) {
+	return c.sortExtended(true, sortCriteria, searchCriteria, options)
+}
+
+// SupportThread checks if the server supports the THREAD extension with the
+// provided algorithm.
+func (c *Client) SupportThread(algo ThreadAlgorithm) (bool, error) {
+	return c.c.Support(ThreadCapability + "=" + string(algo))
+}
+
+func (c *Client) thread(uid bool, algo ThreadAlgorithm, criteria *imap.SearchCriteria) ([]*Thread, error) {
+	if c.c.State() != imap.SelectedState {
+		return nil, client.ErrNoMailboxSelected
+	}
+	if ok, err := c.SupportThread(algo); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrThreadNotSupported
+	}
+
+	var cmd imap.Commander = &ThreadCommand{
+		Algorithm:      algo,
+		Charset:        "UTF-8",
+		SearchCriteria: criteria,
+	}
+	if uid {
+		cmd = &commands.Uid{Cmd: cmd}
+	}
+
+	res := new(ThreadResponse)
+
+	status, err := c.c.Execute(cmd, res)
+	if err != nil {
+		return nil, err
+	} else if err := status.Err(); err != nil {
+		return nil, err
+	}
+	return res.Threads, nil
+}
+
+// Thread searches messages matching criteria and threads them with the
+// provided algorithm. Thread nodes contain sequence numbers. criteria can be
+// nil, in which case all messages are threaded.
+func (c *Client) Thread(algo ThreadAlgorithm, criteria *imap.SearchCriteria) ([]*Thread, error) {
+	return c.thread(false, algo, criteria)
+}
+
+// UidThread is identical to Thread, but thread nodes contain UIDs instead of
+// sequence numbers.
+func (c *Client) UidThread(algo ThreadAlgorithm, criteria *imap.SearchCriteria) ([]*Thread, error) {
+	return c.thread(true, algo, criteria)
+}
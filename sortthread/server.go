@@ -0,0 +1,221 @@
+package sortthread
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/responses"
+	"github.com/emersion/go-imap/server"
+)
+
+// SortMailbox is a mailbox that supports SORT. backendutil.Sort can be used
+// to implement it.
+type SortMailbox interface {
+	backend.Mailbox
+
+	// Sort searches messages matching searchCriteria and returns their
+	// sequence numbers, or UIDs if uid is set to true, sorted by sortCriteria.
+	// Messages with the same sort keys are sorted by sequence number.
+	Sort(uid bool, sortCriteria []SortCriterion, searchCriteria *imap.SearchCriteria) ([]uint32, error)
+}
+
+type sortHandler struct {
+	SortCommand
+}
+
+func (h *sortHandler) handle(uid bool, conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+
+	mbox, ok := ctx.Mailbox.(SortMailbox)
+	if !ok {
+		return errors.New("SORT is not supported by this mailbox")
+	}
+
+	update := false
+	var opts []string
+	for _, opt := range h.Return {
+		switch opt {
+		case imap.SearchReturnMin, imap.SearchReturnMax, imap.SearchReturnAll, imap.SearchReturnCount:
+			opts = append(opts, opt)
+		case imap.SearchReturnUpdate:
+			update = true
+		case imap.SearchReturnContext:
+			// Only a hint, see RFC 5267 section 4.2
+		default:
+			return errors.New("Unsupported sort return option: " + opt)
+		}
+	}
+
+	ids, err := mbox.Sort(uid, h.SortCriteria, h.SearchCriteria)
+	if err != nil {
+		return err
+	}
+
+	if update {
+		err := server.AddSearchUpdate(ctx, &server.SearchUpdate{
+			Tag:    ctx.Tag,
+			Uid:    uid,
+			Sorted: true,
+			Search: func() ([]uint32, error) {
+				return mbox.Sort(true, h.SortCriteria, h.SearchCriteria)
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if h.Return == nil {
+		return conn.WriteResp(&SortResponse{Ids: ids})
+	}
+
+	if len(opts) == 0 {
+		opts = []string{imap.SearchReturnAll}
+	}
+	return conn.WriteResp(&responses.ESearch{
+		Tag:     ctx.Tag,
+		Uid:     uid,
+		Options: opts,
+		Result:  sortResult(ids, opts),
+	})
+}
+
+// sortResult computes the result of a SORT command with result options. MIN
+// and MAX are the first and last messages in the sort order, see RFC 5267
+// section 3.
+func sortResult(ids []uint32, opts []string) *imap.SearchResult {
+	res := imap.NewSearchResult(ids, opts)
+	for _, opt := range opts {
+		switch opt {
+		case imap.SearchReturnMin:
+			if len(ids) > 0 {
+				res.Min = ids[0]
+			}
+		case imap.SearchReturnMax:
+			if len(ids) > 0 {
+				res.Max = ids[len(ids)-1]
+			}
+		case imap.SearchReturnAll:
+			if len(ids) > 0 {
+				res.All = orderedSeqSet(ids)
+			}
+		}
+	}
+	return res
+}
+
+func (h *sortHandler) Handle(conn server.Conn) error {
+	return h.handle(false, conn)
+}
+
+func (h *sortHandler) UidHandle(conn server.Conn) error {
+	return h.handle(true, conn)
+}
+
+type sortExtension struct{}
+
+// NewSortExtension creates a server extension advertising SORT, ESORT and
+// CONTEXT=SORT and handling the SORT command. Mailboxes must implement
+// SortMailbox.
+func NewSortExtension() server.Extension {
+	return &sortExtension{}
+}
+
+func (ext *sortExtension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{SortCapability, ESortCapability, ContextSortCapability}
+	}
+	return nil
+}
+
+func (ext *sortExtension) Command(name string) server.HandlerFactory {
+	if name != SortCapability {
+		return nil
+	}
+
+	return func() server.Handler {
+		return &sortHandler{}
+	}
+}
+
+// ThreadMailbox is a mailbox that supports THREAD. Mailboxes that don't
+// implement it are threaded by the server with the ORDEREDSUBJECT and
+// REFERENCES algorithms, using SearchMessages and ListMessages.
+type ThreadMailbox interface {
+	backend.Mailbox
+
+	// Thread searches messages matching criteria and threads them with the
+	// provided algorithm. Thread nodes contain sequence numbers, or UIDs if uid
+	// is set to true.
+	Thread(uid bool, algorithm ThreadAlgorithm, criteria *imap.SearchCriteria) ([]*Thread, error)
+}
+
+type threadHandler struct {
+	ThreadCommand
+}
+
+func (h *threadHandler) handle(uid bool, conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+
+	var threads []*Thread
+	var err error
+	if mbox, ok := ctx.Mailbox.(ThreadMailbox); ok {
+		threads, err = mbox.Thread(uid, h.Algorithm, h.SearchCriteria)
+	} else {
+		var supported bool
+		threads, supported, err = threadMailbox(ctx.Mailbox, uid, h.Algorithm, h.SearchCriteria)
+		if !supported {
+			return errors.New("Unsupported threading algorithm")
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteResp(&ThreadResponse{Threads: threads})
+}
+
+func (h *threadHandler) Handle(conn server.Conn) error {
+	return h.handle(false, conn)
+}
+
+func (h *threadHandler) UidHandle(conn server.Conn) error {
+	return h.handle(true, conn)
+}
+
+type threadExtension struct{}
+
+// NewThreadExtension creates a server extension advertising
+// THREAD=ORDEREDSUBJECT and THREAD=REFERENCES and handling the THREAD command.
+// Mailboxes implementing ThreadMailbox are threaded by the backend, other
+// mailboxes by the server.
+func NewThreadExtension() server.Extension {
+	return &threadExtension{}
+}
+
+func (ext *threadExtension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{
+			ThreadCapability + "=" + string(ThreadOrderedSubject),
+			ThreadCapability + "=" + string(ThreadReferences),
+		}
+	}
+	return nil
+}
+
+func (ext *threadExtension) Command(name string) server.HandlerFactory {
+	if name != ThreadCapability {
+		return nil
+	}
+
+	return func() server.Handler {
+		return &threadHandler{}
+	}
+}
@@ -0,0 +1,274 @@
+package sortthread
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+)
+
+// SortField is a sort key, as defined in RFC 5256 section 3.
+type SortField string
+
+const (
+	// The internal date and time of the message.
+	SortArrival SortField = "ARRIVAL"
+	// The mailbox of the first Cc address.
+	SortCc SortField = "CC"
+	// The sent date and time of the message, or the internal date if the
+	// message has no Date header field.
+	SortDate SortField = "DATE"
+	// The mailbox of the first From address.
+	SortFrom SortField = "FROM"
+	// The size of the message.
+	SortSize SortField = "SIZE"
+	// The base subject of the message, see BaseSubject.
+	SortSubject SortField = "SUBJECT"
+	// The mailbox of the first To address.
+	SortTo SortField = "TO"
+)
+
+// SortCriterion is a sort key, optionally in reverse order.
+type SortCriterion struct {
+	Field   SortField
+	Reverse bool
+}
+
+// FormatSortCriteria formats sort criteria to a list.
+func FormatSortCriteria(criteria []SortCriterion) []interface{} {
+	fields := make([]interface{}, 0, len(criteria))
+	for _, c := range criteria {
+		if c.Reverse {
+			fields = append(fields, "REVERSE")
+		}
+		fields = append(fields, string(c.Field))
+	}
+	return fields
+}
+
+// ParseSortCriteria parses a list of sort criteria.
+func ParseSortCriteria(fields []interface{}) ([]SortCriterion, error) {
+	var criteria []SortCriterion
+	reverse := false
+	for _, f := range fields {
+		s, ok := f.(string)
+		if !ok {
+			return nil, errors.New("Sort criterion must be an atom")
+		}
+
+		field := SortField(strings.ToUpper(s))
+		switch field {
+		case "REVERSE":
+			if reverse {
+				return nil, errors.New("REVERSE must be followed by a sort key")
+			}
+			reverse = true
+			continue
+		case SortArrival, SortCc, SortDate, SortFrom, SortSize, SortSubject, SortTo:
+		default:
+			return nil, errors.New("Unknown sort key: " + s)
+		}
+
+		criteria = append(criteria, SortCriterion{Field: field, Reverse: reverse})
+		reverse = false
+	}
+
+	if reverse {
+		return nil, errors.New("REVERSE must be followed by a sort key")
+	} else if len(criteria) == 0 {
+		return nil, errors.New("Missing sort criteria")
+	}
+	return criteria, nil
+}
+
+// SortCommand is a SORT command, as defined in RFC 5256 section 3.
+type SortCommand struct {
+	SortCriteria   []SortCriterion
+	Charset        string
+	SearchCriteria *imap.SearchCriteria
+	// Return contains the result options, as defined in RFC 5267 section 3.
+	// If it is not nil, the result is returned in an ESEARCH response.
+	Return []string
+}
+
+func (cmd *SortCommand) Command() *imap.Command {
+	charset := cmd.Charset
+	if charset == "" {
+		charset = "UTF-8"
+	}
+
+	var args []interface{}
+	if cmd.Return != nil {
+		ret := make([]interface{}, len(cmd.Return))
+		for i, opt := range cmd.Return {
+			ret[i] = opt
+		}
+		args = append(args, "RETURN", ret)
+	}
+	args = append(args, FormatSortCriteria(cmd.SortCriteria), charset)
+	args = append(args, formatSearchCriteria(cmd.SearchCriteria)...)
+
+	return &imap.Command{
+		Name:      SortCapability,
+		Arguments: args,
+	}
+}
+
+func (cmd *SortCommand) Parse(fields []interface{}) error {
+	if len(fields) > 0 {
+		if f, ok := fields[0].(string); ok && strings.EqualFold(f, "RETURN") {
+			if len(fields) < 2 {
+				return errors.New("Missing RETURN options")
+			}
+			opts, ok := fields[1].([]interface{})
+			if !ok {
+				return errors.New("RETURN options must be a list")
+			}
+			cmd.Return = make([]string, len(opts))
+			for i, opt := range opts {
+				s, ok := opt.(string)
+				if !ok {
+					return errors.New("RETURN option must be an atom")
+				}
+				cmd.Return[i] = strings.ToUpper(s)
+			}
+			fields = fields[2:]
+		}
+	}
+
+	if len(fields) < 3 {
+		return errors.New("No enough arguments")
+	}
+
+	list, ok := fields[0].([]interface{})
+	if !ok {
+		return errors.New("Sort criteria must be a list")
+	}
+	var err error
+	if cmd.SortCriteria, err = ParseSortCriteria(list); err != nil {
+		return err
+	}
+
+	if cmd.Charset, ok = fields[1].(string); !ok {
+		return errors.New("Charset must be a string")
+	}
+
+	cmd.SearchCriteria, err = parseSearchCriteria(cmd.Charset, fields[2:])
+	return err
+}
+
+// formatSearchCriteria formats search criteria. The search key ALL is used for
+// empty criteria, since at least one key is required.
+func formatSearchCriteria(c *imap.SearchCriteria) []interface{} {
+	var fields []interface{}
+	if c != nil {
+		fields = c.Format()
+	}
+	if len(fields) == 0 {
+		fields = []interface{}{"ALL"}
+	}
+	return fields
+}
+
+func parseSearchCriteria(charset string, fields []interface{}) (*imap.SearchCriteria, error) {
+	var charsetReader func(io.Reader) io.Reader
+	charset = strings.ToLower(charset)
+	if charset != "utf-8" && charset != "us-ascii" && charset != "" {
+		charsetReader = func(r io.Reader) io.Reader {
+			r, _ = imap.CharsetReader(charset, r)
+			return r
+		}
+	}
+
+	c := new(imap.SearchCriteria)
+	if err := c.ParseWithCharset(fields, charsetReader); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SortResponse is a SORT response, as defined in RFC 5256 section 4.
+type SortResponse struct {
+	Ids []uint32
+}
+
+func (r *SortResponse) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != SortCapability {
+		return responses.ErrUnhandled
+	}
+
+	r.Ids = make([]uint32, len(fields))
+	for i, f := range fields {
+		id, err := imap.ParseNumber(f)
+		if err != nil {
+			return err
+		}
+		r.Ids[i] = id
+	}
+	return nil
+}
+
+func (r *SortResponse) WriteTo(w *imap.Writer) error {
+	fields := []interface{}{SortCapability}
+	for _, id := range r.Ids {
+		fields = append(fields, id)
+	}
+	return imap.NewUntaggedResp(fields).WriteTo(w)
+}
+
+// ESortResponse is an ESEARCH response to a SORT command with result options,
+// as defined in RFC 5267 section 3. Ids contains the messages returned with
+// ALL, in the sort order.
+type ESortResponse struct {
+	responses.ESearch
+	Ids []uint32
+}
+
+func (r *ESortResponse) Handle(resp imap.Resp) error {
+	if err := r.ESearch.Handle(resp); err != nil {
+		return err
+	}
+
+	// The sequence set returned with ALL is in the sort order
+	r.Ids = nil
+	_, fields, _ := imap.ParseNamedResp(resp)
+	for i := 0; i+1 < len(fields); i++ {
+		if name, ok := fields[i].(string); !ok || !strings.EqualFold(name, imap.SearchReturnAll) {
+			continue
+		}
+		s, ok := fields[i+1].(string)
+		if !ok {
+			return errors.New("ESEARCH ALL must be a sequence set")
+		}
+		for _, part := range strings.Split(s, ",") {
+			set, err := imap.ParseSeqSet(part)
+			if err != nil {
+				return err
+			}
+			for _, seq := range set.Set {
+				for id := seq.Start; id <= seq.Stop && id != 0; id++ {
+					r.Ids = append(r.Ids, id)
+				}
+			}
+		}
+		break
+	}
+	return nil
+}
+
+// orderedSeqSet returns a sequence set containing ids in the same order, as
+// required for the ALL result of a SORT command, see RFC 5267 section 3.
+func orderedSeqSet(ids []uint32) *imap.SeqSet {
+	set := new(imap.SeqSet)
+	for _, id := range ids {
+		if n := len(set.Set); n > 0 && set.Set[n-1].Stop+1 == id {
+			set.Set[n-1].Stop = id
+			continue
+		}
+		set.Set = append(set.Set, imap.Seq{Start: id, Stop: id})
+	}
+	return set
+}
@@ -0,0 +1,118 @@
+// Package sortthread implements the IMAP SORT and THREAD extensions, as
+// defined in RFC 5256.
+package sortthread
+
+import (
+	"strings"
+)
+
+// The SORT capability.
+const SortCapability = "SORT"
+
+// The ESORT capability, enabling result options in the SORT command, as
+// defined in RFC 5267 section 3.
+const ESortCapability = "ESORT"
+
+// The CONTEXT=SORT capability, enabling sorted results kept updated with the
+// UPDATE result option, as defined in RFC 5267 section 4.
+const ContextSortCapability = "CONTEXT=SORT"
+
+// The THREAD capability prefix. The capability advertised for an algorithm is
+// ThreadCapability + "=" + algorithm, e.g. "THREAD=REFERENCES".
+const ThreadCapability = "THREAD"
+
+// BaseSubject extracts the base subject of a message, as defined in RFC 5256
+// section 2.1. Subjects are compared with the i;ascii-casemap collation: the
+// base subject should be compared case-insensitively.
+//
+// subject must have been decoded already.
+func BaseSubject(subject string) string {
+	s, _ := baseSubject(subject)
+	return s
+}
+
+// baseSubject returns the base subject and whether the message is a reply or a
+// forward, i.e. whether a subj-refwd, a subj-trailer or a [fwd: ...] wrapper
+// has been removed.
+func baseSubject(subject string) (s string, isReply bool) {
+	// (1) Normalize whitespace
+	s = strings.Join(strings.Fields(subject), " ")
+
+	for {
+		// (2) Remove trailers
+		for {
+			s = strings.TrimRight(s, " ")
+			if !strings.HasSuffix(strings.ToLower(s), "(fwd)") {
+				break
+			}
+			s = s[:len(s)-len("(fwd)")]
+			isReply = true
+		}
+
+		// (3) and (4) Remove leaders and leading blobs, as long as they don't
+		// make the subject empty
+		for {
+			s = strings.TrimLeft(s, " ")
+			if rest, ok := trimSubjectRefwd(s); ok {
+				s = rest
+				isReply = true
+			} else if rest, ok := trimSubjectBlob(s); ok && rest != "" {
+				s = rest
+			} else {
+				break
+			}
+		}
+
+		// (6) Remove the [fwd: ...] wrapper and start over
+		if strings.HasPrefix(strings.ToLower(s), "[fwd:") && strings.HasSuffix(s, "]") {
+			s = s[len("[fwd:") : len(s)-1]
+			isReply = true
+			continue
+		}
+
+		return s, isReply
+	}
+}
+
+// trimSubjectBlob removes a leading subj-blob.
+func trimSubjectBlob(s string) (string, bool) {
+	if !strings.HasPrefix(s, "[") {
+		return s, false
+	}
+	i := strings.IndexAny(s[1:], "[]")
+	if i < 0 || s[1+i] != ']' {
+		return s, false
+	}
+	return strings.TrimLeft(s[i+2:], " "), true
+}
+
+// trimSubjectRefwd removes a leading subj-leader, i.e. blobs followed by a
+// subj-refwd.
+func trimSubjectRefwd(s string) (string, bool) {
+	rest := s
+	for {
+		var ok bool
+		if rest, ok = trimSubjectBlob(rest); !ok {
+			break
+		}
+	}
+
+	l := strings.ToLower(rest)
+	switch {
+	case strings.HasPrefix(l, "re"):
+		rest = rest[2:]
+	case strings.HasPrefix(l, "fwd"):
+		rest = rest[3:]
+	case strings.HasPrefix(l, "fw"):
+		rest = rest[2:]
+	default:
+		return s, false
+	}
+
+	rest = strings.TrimLeft(rest, " ")
+	rest, _ = trimSubjectBlob(rest)
+	if !strings.HasPrefix(rest, ":") {
+		return s, false
+	}
+	return rest[1:], true
+}
@@ -0,0 +1,269 @@
+package sortthread_test
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+	"github.com/emersion/go-imap/sortthread"
+)
+
+var baseSubjectTests = []struct {
+	subject, want string
+}{
+	{"Your Name.", "Your Name."},
+	{"Re: Your Name.", "Your Name."},
+	{"RE:  re: Your   Name.", "Your Name."},
+	{"Fwd: Your Name. (fwd)", "Your Name."},
+	{"[list] Re: [list] Your Name.", "Your Name."},
+	{"Re [list]: Your Name.", "Your Name."},
+	{"[fwd: Re: Your Name.]", "Your Name."},
+	{"[list]", "[list]"},
+	{"Re: ", ""},
+}
+
+func TestBaseSubject(t *testing.T) {
+	for _, test := range baseSubjectTests {
+		if got := sortthread.BaseSubject(test.subject); got != test.want {
+			t.Errorf("BaseSubject(%q) = %q, want %q", test.subject, got, test.want)
+		}
+	}
+}
+
+func TestSortCommand(t *testing.T) {
+	cmd := &sortthread.SortCommand{
+		SortCriteria: []sortthread.SortCriterion{
+			{Field: sortthread.SortSubject, Reverse: true},
+			{Field: sortthread.SortDate},
+		},
+		Charset:        "UTF-8",
+		SearchCriteria: &imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}},
+	}
+
+	parsed := new(sortthread.SortCommand)
+	if err := parsed.Parse(cmd.Command().Arguments); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed.SortCriteria, cmd.SortCriteria) {
+		t.Errorf("Invalid sort criteria: got %v, want %v", parsed.SortCriteria, cmd.SortCriteria)
+	}
+	if !reflect.DeepEqual(parsed.SearchCriteria.WithoutFlags, cmd.SearchCriteria.WithoutFlags) {
+		t.Errorf("Invalid search criteria: got %v, want %v", parsed.SearchCriteria, cmd.SearchCriteria)
+	}
+
+	invalid := [][]interface{}{
+		{[]interface{}{"REVERSE"}, "UTF-8", "ALL"},
+		{[]interface{}{"COLOR"}, "UTF-8", "ALL"},
+		{[]interface{}{}, "UTF-8", "ALL"},
+		{[]interface{}{"DATE"}, "UTF-8"},
+	}
+	for _, fields := range invalid {
+		if err := new(sortthread.SortCommand).Parse(fields); err == nil {
+			t.Errorf("Expected an error when parsing %v", fields)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot listen:", err)
+	}
+
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.Enable(sortthread.NewSortExtension())
+	defer s.Close()
+
+	go s.Serve(l)
+
+	c, err := client.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal("Cannot connect to server:", err)
+	}
+	defer c.Logout()
+
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatal("Cannot login:", err)
+	}
+
+	sc := sortthread.NewClient(c)
+	if ok, err := sc.SupportSort(); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("Server doesn't advertise SORT")
+	}
+
+	// INBOX already contains "A little message, just for you"
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, subject := range []string{"Re: Zebras", "Re: Aardvarks"} {
+		body := "From: contact@example.org\r\nSubject: " + subject + "\r\n\r\nHi"
+		if err := c.Append("INBOX", nil, date.Add(time.Duration(i)*time.Hour), bytes.NewBufferString(body)); err != nil {
+			t.Fatal("Cannot append:", err)
+		}
+	}
+
+	if _, err := sc.Sort([]sortthread.SortCriterion{{Field: sortthread.SortSubject}}, nil); err != client.ErrNoMailboxSelected {
+		t.Fatalf("sc.Sort() = %v, want %v", err, client.ErrNoMailboxSelected)
+	}
+
+	if _, err := c.Select("INBOX", false); err != nil {
+		t.Fatal("Cannot select INBOX:", err)
+	}
+
+	ids, err := sc.Sort([]sortthread.SortCriterion{{Field: sortthread.SortSubject}}, nil)
+	if err != nil {
+		t.Fatal("Cannot sort:", err)
+	}
+	if want := []uint32{1, 3, 2}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("sc.Sort() = %v, want %v", ids, want)
+	}
+
+	uids, err := sc.UidSort([]sortthread.SortCriterion{{Field: sortthread.SortArrival, Reverse: true}}, &imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}})
+	if err != nil {
+		t.Fatal("Cannot sort:", err)
+	}
+	if want := []uint32{8, 7}; !reflect.DeepEqual(uids, want) {
+		t.Errorf("sc.UidSort() = %v, want %v", uids, want)
+	}
+}
+
+func TestSortExtended(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot listen:", err)
+	}
+
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.Enable(sortthread.NewSortExtension())
+	defer s.Close()
+
+	go s.Serve(l)
+
+	c, err := client.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal("Cannot connect to server:", err)
+	}
+	defer c.Logout()
+
+	updates := make(chan interface{}, 10)
+	c.Updates = updates
+
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatal("Cannot login:", err)
+	}
+
+	appendSubject := func(subject string) {
+		body := "From: contact@example.org\r\nSubject: " + subject + "\r\n\r\nHi"
+		if err := c.Append("INBOX", nil, time.Now(), bytes.NewBufferString(body)); err != nil {
+			t.Fatal("Cannot append:", err)
+		}
+	}
+
+	// INBOX already contains "A little message, just for you"
+	appendSubject("Re: Zebras")
+	appendSubject("Re: Aardvarks")
+
+	if _, err := c.Select("INBOX", false); err != nil {
+		t.Fatal("Cannot select INBOX:", err)
+	}
+
+	sc := sortthread.NewClient(c)
+	options := []string{imap.SearchReturnMin, imap.SearchReturnAll, imap.SearchReturnCount, imap.SearchReturnUpdate}
+	res, err := sc.UidSortExtended([]sortthread.SortCriterion{{Field: sortthread.SortSubject}}, nil, options)
+	if err != nil {
+		t.Fatal("Cannot sort:", err)
+	}
+	want := &sortthread.SortResult{Tag: res.Tag, Min: 6, Count: 3, Ids: []uint32{6, 8, 7}}
+	if res.Tag == "" || !reflect.DeepEqual(res, want) {
+		t.Errorf("sc.UidSortExtended() = %+v, want %+v", res, want)
+	}
+
+	appendSubject("Re: Monkeys")
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case item := <-updates:
+			update, ok := item.(*client.SearchUpdate)
+			if !ok {
+				continue
+			}
+			if update.Tag != res.Tag || !update.Uid || len(update.Result.AddTo) != 1 {
+				t.Fatalf("Invalid update: %+v", update)
+			}
+			if added := update.Result.AddTo[0]; added.Position != 3 || added.Ids.String() != "9" {
+				t.Errorf("Invalid ADDTO: got %v %v, want 3 9", added.Position, added.Ids)
+			}
+			return
+		case <-timeout:
+			t.Fatal("Timeout waiting for search update")
+		}
+	}
+}
+
+func TestThread(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Cannot listen:", err)
+	}
+
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	s.Enable(sortthread.NewThreadExtension())
+	defer s.Close()
+
+	go s.Serve(l)
+
+	c, err := client.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal("Cannot connect to server:", err)
+	}
+	defer c.Logout()
+
+	if err := c.Login("username", "password"); err != nil {
+		t.Fatal("Cannot login:", err)
+	}
+
+	tc := sortthread.NewClient(c)
+	if ok, err := tc.SupportThread(sortthread.ThreadReferences); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("Server doesn't advertise THREAD=REFERENCES")
+	}
+
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	bodies := []string{
+		"Message-Id: <zebras@example.org>\r\nSubject: Zebras\r\n\r\nHi",
+		"Message-Id: <re-zebras@example.org>\r\nReferences: <zebras@example.org>\r\nSubject: Giraffes\r\n\r\nHi",
+	}
+	for i, body := range bodies {
+		if err := c.Append("INBOX", nil, date.Add(time.Duration(i)*time.Hour), bytes.NewBufferString(body)); err != nil {
+			t.Fatal("Cannot append:", err)
+		}
+	}
+
+	if _, err := c.Select("INBOX", false); err != nil {
+		t.Fatal("Cannot select INBOX:", err)
+	}
+
+	threads, err := tc.UidThread(sortthread.ThreadReferences, &imap.SearchCriteria{WithoutFlags: []string{imap.SeenFlag}})
+	if err != nil {
+		t.Fatal("Cannot thread:", err)
+	}
+	want := []*sortthread.Thread{{Id: 7, Children: []*sortthread.Thread{{Id: 8}}}}
+	if !reflect.DeepEqual(threads, want) {
+		t.Errorf("tc.UidThread() = %v, want %v", threads, want)
+	}
+
+	if _, err := tc.Thread("UNKNOWN", nil); err != sortthread.ErrThreadNotSupported {
+		t.Errorf("tc.Thread() = %v, want %v", err, sortthread.ErrThreadNotSupported)
+	}
+}
@@ -0,0 +1,188 @@
+package sortthread
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/responses"
+)
+
+// ThreadAlgorithm is a threading algorithm, as defined in RFC 5256 section 3.
+type ThreadAlgorithm string
+
+const (
+	// Messages are grouped by base subject, then sorted by sent date.
+	ThreadOrderedSubject ThreadAlgorithm = "ORDEREDSUBJECT"
+	// Messages are threaded with their References and In-Reply-To header
+	// fields, then grouped by base subject.
+	ThreadReferences ThreadAlgorithm = "REFERENCES"
+)
+
+// Thread is a node of a thread tree. Id is a sequence number or a UID, it is
+// zero if the message is missing from the mailbox or from the search results:
+// such a node only groups its children.
+type Thread struct {
+	Id       uint32
+	Children []*Thread
+}
+
+// String formats the thread as a thread-list: a chain of messages with a
+// single child, followed by nested threads if the last one has several
+// children. Nested threads aren't separated by spaces, e.g.
+// "(3 6 (4 23)(44 7 96))".
+func (t *Thread) String() string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for {
+		if t.Id != 0 {
+			if b.Len() > 1 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(strconv.FormatUint(uint64(t.Id), 10))
+		}
+		if len(t.Children) != 1 {
+			break
+		}
+		t = t.Children[0]
+	}
+
+	if len(t.Children) > 0 && b.Len() > 1 {
+		b.WriteByte(' ')
+	}
+	for _, child := range t.Children {
+		b.WriteString(child.String())
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+func parseThread(fields []interface{}) (*Thread, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("Thread must not be empty")
+	}
+
+	root := new(Thread)
+	var last *Thread
+	nested := false
+	for _, f := range fields {
+		if l, ok := f.([]interface{}); ok {
+			child, err := parseThread(l)
+			if err != nil {
+				return nil, err
+			}
+
+			parent := last
+			if parent == nil {
+				parent = root
+			}
+			parent.Children = append(parent.Children, child)
+			nested = true
+			continue
+		}
+
+		if nested {
+			return nil, errors.New("Thread members must not follow nested threads")
+		}
+		id, err := imap.ParseNumber(f)
+		if err != nil {
+			return nil, err
+		}
+
+		node := &Thread{Id: id}
+		if last == nil {
+			root = node
+		} else {
+			last.Children = append(last.Children, node)
+		}
+		last = node
+	}
+	return root, nil
+}
+
+// ThreadCommand is a THREAD command, as defined in RFC 5256 section 3.
+type ThreadCommand struct {
+	Algorithm      ThreadAlgorithm
+	Charset        string
+	SearchCriteria *imap.SearchCriteria
+}
+
+func (cmd *ThreadCommand) Command() *imap.Command {
+	charset := cmd.Charset
+	if charset == "" {
+		charset = "UTF-8"
+	}
+
+	args := []interface{}{string(cmd.Algorithm), charset}
+	args = append(args, formatSearchCriteria(cmd.SearchCriteria)...)
+
+	return &imap.Command{
+		Name:      ThreadCapability,
+		Arguments: args,
+	}
+}
+
+func (cmd *ThreadCommand) Parse(fields []interface{}) error {
+	if len(fields) < 3 {
+		return errors.New("No enough arguments")
+	}
+
+	algo, ok := fields[0].(string)
+	if !ok {
+		return errors.New("Thread algorithm must be an atom")
+	}
+	cmd.Algorithm = ThreadAlgorithm(strings.ToUpper(algo))
+
+	if cmd.Charset, ok = fields[1].(string); !ok {
+		return errors.New("Charset must be a string")
+	}
+
+	var err error
+	cmd.SearchCriteria, err = parseSearchCriteria(cmd.Charset, fields[2:])
+	return err
+}
+
+// ThreadResponse is a THREAD response, as defined in RFC 5256 section 4.
+type ThreadResponse struct {
+	Threads []*Thread
+}
+
+func (r *ThreadResponse) Handle(resp imap.Resp) error {
+	name, fields, ok := imap.ParseNamedResp(resp)
+	if !ok || name != ThreadCapability {
+		return responses.ErrUnhandled
+	}
+
+	r.Threads = make([]*Thread, len(fields))
+	for i, f := range fields {
+		l, ok := f.([]interface{})
+		if !ok {
+			return errors.New("Thread must be a list")
+		}
+		var err error
+		if r.Threads[i], err = parseThread(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ThreadResponse) WriteTo(w *imap.Writer) error {
+	// Threads aren't separated by spaces, imap.Writer can't format them
+	var b strings.Builder
+	b.WriteString("* " + ThreadCapability)
+	if len(r.Threads) > 0 {
+		b.WriteByte(' ')
+	}
+	for _, t := range r.Threads {
+		b.WriteString(t.String())
+	}
+	b.WriteString("\r\n")
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	return w.Flush()
+}
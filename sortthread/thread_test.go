@@ -0,0 +1,121 @@
+package sortthread
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+)
+
+func TestThreadResponse(t *testing.T) {
+	// Example from RFC 5256 section 4
+	const resp = "* THREAD (2)(3 6 (4 23)(44 7 96))\r\n"
+
+	r := imap.NewReader(bufio.NewReader(strings.NewReader(resp)))
+	data, err := imap.ReadResp(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := new(ThreadResponse)
+	if err := res.Handle(data); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*Thread{
+		{Id: 2},
+		{Id: 3, Children: []*Thread{{Id: 6, Children: []*Thread{
+			{Id: 4, Children: []*Thread{{Id: 23}}},
+			{Id: 44, Children: []*Thread{{Id: 7, Children: []*Thread{{Id: 96}}}}},
+		}}}},
+	}
+	if !reflect.DeepEqual(res.Threads, want) {
+		t.Fatalf("Invalid threads: got %v, want %v", res.Threads, want)
+	}
+
+	var b bytes.Buffer
+	if err := res.WriteTo(imap.NewWriter(&b)); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != resp {
+		t.Errorf("Invalid formatted response: got %q, want %q", b.String(), resp)
+	}
+}
+
+func TestThread_String(t *testing.T) {
+	// A thread whose parent is missing
+	thread := &Thread{Children: []*Thread{{Id: 3}, {Id: 5}}}
+	if s := thread.String(); s != "((3)(5))" {
+		t.Errorf("Thread.String() = %q, want %q", s, "((3)(5))")
+	}
+}
+
+var testThreadDate = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestThreadMessage(id uint32, subject, messageId string, references ...string) *threadMessage {
+	return &threadMessage{
+		id:         id,
+		seqNum:     id,
+		date:       testThreadDate.Add(time.Duration(id) * time.Hour),
+		subject:    subject,
+		messageId:  messageId,
+		references: references,
+	}
+}
+
+func TestThreadOrderedSubject(t *testing.T) {
+	msgs := []*threadMessage{
+		newTestThreadMessage(1, "Zebras", ""),
+		newTestThreadMessage(2, "Aardvarks", ""),
+		newTestThreadMessage(3, "Re: zebras", ""),
+		newTestThreadMessage(4, "Fwd: Zebras", ""),
+	}
+	msgs[0].date = testThreadDate.Add(10 * time.Hour)
+
+	threads := threadOrderedSubject(msgs)
+	want := []*Thread{
+		{Id: 2},
+		{Id: 3, Children: []*Thread{{Id: 4}, {Id: 1}}},
+	}
+	if !reflect.DeepEqual(threads, want) {
+		t.Errorf("threadOrderedSubject() = %v, want %v", threads, want)
+	}
+}
+
+func TestThreadReferences(t *testing.T) {
+	msgs := []*threadMessage{
+		newTestThreadMessage(1, "Zebras", "<1@example.org>"),
+		newTestThreadMessage(2, "Re: Zebras", "<2@example.org>", "<1@example.org>"),
+		newTestThreadMessage(3, "Aardvarks", "<3@example.org>", "<missing@example.org>"),
+		newTestThreadMessage(4, "Re: Zebras", "<4@example.org>", "<1@example.org>", "<2@example.org>"),
+		newTestThreadMessage(5, "Re: Zebras", "<5@example.org>", "<1@example.org>"),
+		// Not in the same thread, but grouped by subject
+		newTestThreadMessage(6, "Re: Aardvarks", "<6@example.org>"),
+		newTestThreadMessage(7, "Re: Eels", "<7@example.org>", "<eels@example.org>"),
+		newTestThreadMessage(8, "Re: Eels", "<8@example.org>", "<eels@example.org>"),
+		// Loop
+		newTestThreadMessage(9, "Loop", "<9@example.org>", "<9@example.org>"),
+	}
+
+	threads := threadReferences(msgs)
+	want := []*Thread{
+		{Id: 1, Children: []*Thread{
+			{Id: 2, Children: []*Thread{{Id: 4}}},
+			{Id: 5},
+		}},
+		{Id: 3, Children: []*Thread{{Id: 6}}},
+		{Children: []*Thread{{Id: 7}, {Id: 8}}},
+		{Id: 9},
+	}
+	if !reflect.DeepEqual(threads, want) {
+		formatted := make([]string, len(threads))
+		for i, t := range threads {
+			formatted[i] = t.String()
+		}
+		t.Errorf("threadReferences() = %v, want %v", formatted, want)
+	}
+}
@@ -0,0 +1,407 @@
+package sortthread
+
+import (
+	"bufio"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+)
+
+// threadMessage contains the message data used by threading algorithms.
+type threadMessage struct {
+	id         uint32
+	seqNum     uint32
+	date       time.Time
+	subject    string
+	messageId  string
+	references []string
+}
+
+var referencesSection = &imap.BodySectionName{
+	BodyPartName: imap.BodyPartName{
+		Specifier: imap.HeaderSpecifier,
+		Fields:    []string{"References"},
+	},
+	Peek: true,
+}
+
+// parseMessageIds returns the msg-ids contained in s.
+func parseMessageIds(s string) []string {
+	var ids []string
+	for {
+		start := strings.IndexByte(s, '<')
+		if start < 0 {
+			return ids
+		}
+		end := strings.IndexByte(s[start:], '>')
+		if end < 0 {
+			return ids
+		}
+		ids = append(ids, s[start:start+end+1])
+		s = s[start+end+1:]
+	}
+}
+
+func newThreadMessage(uid bool, msg *imap.Message) *threadMessage {
+	tm := &threadMessage{id: msg.SeqNum, seqNum: msg.SeqNum, date: msg.InternalDate}
+	if uid {
+		tm.id = msg.Uid
+	}
+
+	if env := msg.Envelope; env != nil {
+		if !env.Date.IsZero() {
+			tm.date = env.Date
+		}
+		tm.subject = env.Subject
+		if ids := parseMessageIds(env.MessageId); len(ids) > 0 {
+			tm.messageId = ids[0]
+		}
+		// In-Reply-To is used if there is no References header field
+		if ids := parseMessageIds(env.InReplyTo); len(ids) > 0 {
+			tm.references = ids[:1]
+		}
+	}
+
+	for _, l := range msg.Body {
+		h, err := textproto.NewReader(bufio.NewReader(l)).ReadMIMEHeader()
+		if err != nil && len(h) == 0 {
+			continue
+		}
+		if ids := parseMessageIds(h.Get("References")); len(ids) > 0 {
+			tm.references = ids
+		}
+	}
+
+	return tm
+}
+
+// fetchThreadMessages searches messages matching criteria in mbox and fetches
+// the data needed to thread them.
+func fetchThreadMessages(mbox backend.Mailbox, uid bool, criteria *imap.SearchCriteria) ([]*threadMessage, error) {
+	ids, err := mbox.SearchMessages(uid, criteria)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(ids...)
+	items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchInternalDate, imap.FetchUid, referencesSection.FetchItem()}
+
+	ch := make(chan *imap.Message)
+	done := make(chan error, 1)
+	go func() {
+		done <- mbox.ListMessages(uid, seqset, items, ch)
+	}()
+
+	var msgs []*threadMessage
+	for msg := range ch {
+		msgs = append(msgs, newThreadMessage(uid, msg))
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].seqNum < msgs[j].seqNum
+	})
+	return msgs, nil
+}
+
+// threadMailbox threads messages of a mailbox which doesn't implement
+// ThreadMailbox. It returns false if the algorithm isn't supported.
+func threadMailbox(mbox backend.Mailbox, uid bool, algo ThreadAlgorithm, criteria *imap.SearchCriteria) ([]*Thread, bool, error) {
+	var f func([]*threadMessage) []*Thread
+	switch algo {
+	case ThreadOrderedSubject:
+		f = threadOrderedSubject
+	case ThreadReferences:
+		f = threadReferences
+	default:
+		return nil, false, nil
+	}
+
+	msgs, err := fetchThreadMessages(mbox, uid, criteria)
+	if err != nil {
+		return nil, true, err
+	}
+	return f(msgs), true, nil
+}
+
+func upperBaseSubject(subject string) string {
+	return strings.ToUpper(BaseSubject(subject))
+}
+
+func sentBefore(a, b *threadMessage) bool {
+	if !a.date.Equal(b.date) {
+		return a.date.Before(b.date)
+	}
+	return a.seqNum < b.seqNum
+}
+
+// threadOrderedSubject implements the ORDEREDSUBJECT algorithm, see RFC 5256
+// section 3: messages with the same base subject are children of the first one
+// sent.
+func threadOrderedSubject(msgs []*threadMessage) []*Thread {
+	msgs = append([]*threadMessage(nil), msgs...)
+	subjects := make(map[*threadMessage]string, len(msgs))
+	for _, msg := range msgs {
+		subjects[msg] = upperBaseSubject(msg.subject)
+	}
+	sort.SliceStable(msgs, func(i, j int) bool {
+		if subjects[msgs[i]] != subjects[msgs[j]] {
+			return subjects[msgs[i]] < subjects[msgs[j]]
+		}
+		return sentBefore(msgs[i], msgs[j])
+	})
+
+	var threads []*Thread
+	var firsts []*threadMessage
+	for i, msg := range msgs {
+		t := &Thread{Id: msg.id}
+		if i > 0 && subjects[msg] == subjects[msgs[i-1]] {
+			parent := threads[len(threads)-1]
+			parent.Children = append(parent.Children, t)
+			continue
+		}
+		threads = append(threads, t)
+		firsts = append(firsts, msg)
+	}
+
+	// Threads are sorted by the sent date of their first message
+	sort.Sort(&threadsBySentDate{threads, firsts})
+	return threads
+}
+
+type threadsBySentDate struct {
+	threads []*Thread
+	firsts  []*threadMessage
+}
+
+func (s *threadsBySentDate) Len() int {
+	return len(s.threads)
+}
+
+func (s *threadsBySentDate) Less(i, j int) bool {
+	return sentBefore(s.firsts[i], s.firsts[j])
+}
+
+func (s *threadsBySentDate) Swap(i, j int) {
+	s.threads[i], s.threads[j] = s.threads[j], s.threads[i]
+	s.firsts[i], s.firsts[j] = s.firsts[j], s.firsts[i]
+}
+
+// container is a node of the tree built by the REFERENCES algorithm. msg is
+// nil for dummy containers.
+type container struct {
+	msg      *threadMessage
+	parent   *container
+	children []*container
+}
+
+func (c *container) hasDescendant(d *container) bool {
+	for _, child := range c.children {
+		if child == d || child.hasDescendant(d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *container) setParent(parent *container) {
+	if c.parent != nil {
+		siblings := c.parent.children
+		for i, sibling := range siblings {
+			if sibling == c {
+				c.parent.children = append(siblings[:i:i], siblings[i+1:]...)
+				break
+			}
+		}
+	}
+
+	c.parent = parent
+	if parent != nil {
+		parent.children = append(parent.children, c)
+	}
+}
+
+// first returns the message of the container, or the one of its first child
+// for a dummy.
+func (c *container) first() *threadMessage {
+	for c.msg == nil && len(c.children) > 0 {
+		c = c.children[0]
+	}
+	return c.msg
+}
+
+func (c *container) thread() *Thread {
+	t := new(Thread)
+	if c.msg != nil {
+		t.Id = c.msg.id
+	}
+	for _, child := range c.children {
+		t.Children = append(t.Children, child.thread())
+	}
+	return t
+}
+
+func sortContainers(cs []*container) {
+	for _, c := range cs {
+		sortContainers(c.children)
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		a, b := cs[i].first(), cs[j].first()
+		return b != nil && (a == nil || sentBefore(a, b))
+	})
+}
+
+// pruneContainers removes dummy containers without children, and replaces the
+// other ones with their children, except at the root level if they have
+// several children.
+func pruneContainers(cs []*container, root bool) []*container {
+	var pruned []*container
+	for _, c := range cs {
+		c.children = pruneContainers(c.children, false)
+		if c.msg == nil {
+			if len(c.children) == 0 {
+				continue
+			}
+			if !root || len(c.children) == 1 {
+				for _, child := range c.children {
+					child.parent = c.parent
+				}
+				pruned = append(pruned, c.children...)
+				continue
+			}
+		}
+		pruned = append(pruned, c)
+	}
+	return pruned
+}
+
+// threadReferences implements the REFERENCES algorithm, see RFC 5256 section
+// 3.
+func threadReferences(msgs []*threadMessage) []*Thread {
+	// (1) Link messages with their references
+	var containers []*container
+	ids := make(map[string]*container)
+	getContainer := func(id string) *container {
+		c, ok := ids[id]
+		if !ok {
+			c = new(container)
+			ids[id] = c
+			containers = append(containers, c)
+		}
+		return c
+	}
+
+	for _, msg := range msgs {
+		var c *container
+		if msg.messageId != "" {
+			c = getContainer(msg.messageId)
+		}
+		if c == nil || c.msg != nil {
+			// Missing or duplicate Message-ID
+			c = new(container)
+			containers = append(containers, c)
+		}
+		c.msg = msg
+
+		var prev *container
+		for _, ref := range msg.references {
+			rc := getContainer(ref)
+			if prev != nil && rc.parent == nil && rc != prev && !rc.hasDescendant(prev) {
+				rc.setParent(prev)
+			}
+			prev = rc
+		}
+
+		if prev == c || (prev != nil && c.hasDescendant(prev)) {
+			prev = nil
+		}
+		c.setParent(prev)
+	}
+
+	// (2) Gather the root set
+	var roots []*container
+	for _, c := range containers {
+		if c.parent == nil {
+			roots = append(roots, c)
+		}
+	}
+
+	// (3) Prune dummy containers
+	roots = pruneContainers(roots, true)
+
+	// (4) Sort the root set by sent date
+	sortContainers(roots)
+
+	// (5) Group threads with the same base subject
+	subjects := make(map[string]*container)
+	for _, c := range roots {
+		subject, isReply := baseSubject(c.first().subject)
+		subject = strings.ToUpper(subject)
+		if subject == "" {
+			continue
+		}
+
+		t, ok := subjects[subject]
+		if !ok || (c.msg == nil && t.msg != nil) {
+			subjects[subject] = c
+		} else if t.msg != nil && c.msg != nil && !isReply {
+			if _, tIsReply := baseSubject(t.msg.subject); tIsReply {
+				subjects[subject] = c
+			}
+		}
+	}
+
+	index := make(map[*container]int, len(roots))
+	for i, c := range roots {
+		index[c] = i
+	}
+	for _, c := range append([]*container(nil), roots...) {
+		if c.parent != nil {
+			continue
+		}
+
+		subject, isReply := baseSubject(c.first().subject)
+		subject = strings.ToUpper(subject)
+		t, ok := subjects[subject]
+		if !ok || t == c {
+			continue
+		}
+
+		_, tIsReply := baseSubject(t.first().subject)
+		switch {
+		case t.msg == nil && c.msg == nil:
+			for _, child := range append([]*container(nil), c.children...) {
+				child.setParent(t)
+			}
+		case t.msg == nil:
+			c.setParent(t)
+		case !tIsReply && isReply:
+			c.setParent(t)
+		default:
+			dummy := new(container)
+			roots[index[t]] = dummy
+			index[dummy] = index[t]
+			t.setParent(dummy)
+			c.setParent(dummy)
+			subjects[subject] = dummy
+		}
+	}
+
+	// (6) Sort siblings by sent date, the root set stays sorted as in (4)
+	var threads []*Thread
+	for _, c := range roots {
+		if c.parent != nil || (c.msg == nil && len(c.children) == 0) {
+			continue
+		}
+		sortContainers(c.children)
+		threads = append(threads, c.thread())
+	}
+	return threads
+}
@@ -56,6 +56,77 @@ const (
 	CodeUnseen         = "UNSEEN"
 )
 
+// Status response codes defined in RFC 2221 section 3 and RFC 2193 section 4.
+// The REFERRAL code argument is an IMAP URL designating the server the client
+// should use instead, see ReferralError.
+const (
+	CodeReferral StatusRespCode = "REFERRAL"
+)
+
+// Status response codes defined in RFC 5182 section 2.1.
+const (
+	CodeNotSaved StatusRespCode = "NOTSAVED"
+)
+
+// Status response codes defined in RFC 4315 section 3. The APPENDUID and
+// COPYUID codes arguments can be parsed with AppendUid and CopyUid.
+const (
+	CodeAppendUid    StatusRespCode = "APPENDUID"
+	CodeCopyUid                     = "COPYUID"
+	CodeUidNotSticky                = "UIDNOTSTICKY"
+)
+
+// Status response codes defined in RFC 4469 section 6. The BADURL code
+// argument is the URL that couldn't be resolved.
+const (
+	CodeBadURL StatusRespCode = "BADURL"
+	CodeTooBig                = "TOOBIG"
+)
+
+// Status response codes defined in RFC 5257 section 4.3. The ANNOTATE code
+// argument is TOOBIG or TOOMANY.
+const (
+	CodeAnnotate StatusRespCode = "ANNOTATE"
+)
+
+// Status response codes defined in RFC 5530 section 3.
+const (
+	CodeInUse     StatusRespCode = "INUSE"
+	CodeNoPerm                   = "NOPERM"
+	CodeOverQuota                = "OVERQUOTA"
+	CodeServerBug                = "SERVERBUG"
+)
+
+// Status response codes defined in RFC 5465 section 5.
+const (
+	CodeBadEvent             StatusRespCode = "BADEVENT"
+	CodeNotificationOverflow                = "NOTIFICATIONOVERFLOW"
+)
+
+// Status response codes defined in RFC 5464 section 4. The METADATA code
+// arguments are LONGENTRIES, MAXSIZE, TOOMANY or NOPRIVATE.
+const (
+	CodeMetadata StatusRespCode = "METADATA"
+)
+
+// Status response codes defined in RFC 7162 section 7.
+const (
+	CodeHighestModSeq StatusRespCode = "HIGHESTMODSEQ"
+	CodeNoModSeq                     = "NOMODSEQ"
+	CodeModified                     = "MODIFIED"
+)
+
+// Status response codes defined in RFC 6154 section 6.
+const (
+	CodeUseAttr StatusRespCode = "USEATTR"
+)
+
+// Status response codes defined in RFC 8474 section 4.1. The MAILBOXID code
+// argument is a list containing the mailbox object ID.
+const (
+	CodeMailboxId StatusRespCode = "MAILBOXID"
+)
+
 // A status response.
 // See RFC 3501 section 7.1
 type StatusResp struct {
@@ -65,8 +136,12 @@ type StatusResp struct {
 	Type StatusRespType
 	// The status code.
 	// See https://www.iana.org/assignments/imap-response-codes/imap-response-codes.xhtml
+	//
+	// Codes which are not known by this package, such as vendor extensions,
+	// are preserved along with their arguments.
 	Code StatusRespCode
-	// Arguments provided with the status code.
+	// Arguments provided with the status code. If they cannot be parsed, they
+	// are provided as a single string.
 	Arguments []interface{}
 	// The status info.
 	Info string
@@ -74,7 +149,7 @@ type StatusResp struct {
 
 func (r *StatusResp) resp() {}
 
-// If this status is NO or BAD, returns an error with the status info.
+// If this status is NO or BAD, returns a *StatusError with the status info.
 // Otherwise, returns nil.
 func (r *StatusResp) Err() error {
 	if r == nil {
@@ -83,11 +158,83 @@ func (r *StatusResp) Err() error {
 	}
 
 	if r.Type == StatusRespNo || r.Type == StatusRespBad {
-		return errors.New(r.Info)
+		statusErr := StatusError{Type: r.Type, Code: r.Code, Info: r.Info}
+		if url, ok := r.Referral(); ok {
+			return &ReferralError{StatusError: statusErr, URL: url}
+		}
+		return &statusErr
 	}
 	return nil
 }
 
+// StatusError is returned when a command fails with a NO or BAD status
+// response. Its message is the status info.
+type StatusError struct {
+	// The status type, either NO or BAD.
+	Type StatusRespType
+	// The status code, e.g. TRYCREATE. It can be empty.
+	Code StatusRespCode
+	// The status info.
+	Info string
+}
+
+func (err *StatusError) Error() string {
+	return err.Info
+}
+
+// ReferralError is returned when a command fails with a REFERRAL status code,
+// see RFC 2221 and RFC 2193. The command should be retried on the server
+// designated by URL.
+//
+// A server Handler or backend can return a ReferralError to send a REFERRAL
+// response code. If Type is empty, it defaults to NO.
+type ReferralError struct {
+	StatusError
+	// The IMAP URL of the server to use, e.g. "imap://fred@server2/".
+	URL string
+}
+
+func (err *ReferralError) Error() string {
+	if err.Info == "" {
+		return "imap: referral to " + err.URL
+	}
+	return err.Info
+}
+
+// Unwrap returns the underlying *StatusError.
+func (err *ReferralError) Unwrap() error {
+	return &err.StatusError
+}
+
+// ByeError is returned when the server closes the connection with a BYE
+// response.
+type ByeError struct {
+	// The status code, e.g. UNAVAILABLE.
+	Code StatusRespCode
+	// The status info.
+	Info string
+}
+
+func (err *ByeError) Error() string {
+	msg := "imap: connection closed by server"
+	if err.Code != "" {
+		msg += " [" + string(err.Code) + "]"
+	}
+	if err.Info != "" {
+		msg += ": " + err.Info
+	}
+	return msg
+}
+
+// Referral returns the IMAP URL of a REFERRAL status code.
+func (r *StatusResp) Referral() (url string, ok bool) {
+	if r.Code != CodeReferral || len(r.Arguments) != 1 {
+		return "", false
+	}
+	url, err := ParseString(r.Arguments[0])
+	return url, err == nil && url != ""
+}
+
 func (r *StatusResp) WriteTo(w *Writer) error {
 	tag := r.Tag
 	if tag == "" {
@@ -91,4 +91,30 @@ func TestStatus_Err(t *testing.T) {
 	} else if err.Error() != "NO!" {
 		t.Error("NO status returned incorrect error message:", err)
 	}
+
+	status = &imap.StatusResp{Type: imap.StatusRespNo, Code: imap.CodeInUse, Info: "Mailbox locked"}
+	if err, ok := status.Err().(*imap.StatusError); !ok {
+		t.Error("NO status didn't return a *StatusError:", err)
+	} else if err.Type != imap.StatusRespNo || err.Code != imap.CodeInUse || err.Info != "Mailbox locked" {
+		t.Error("NO status returned incorrect error:", err)
+	}
+}
+
+func TestStatus_Err_Referral(t *testing.T) {
+	status := &imap.StatusResp{
+		Type:      imap.StatusRespNo,
+		Code:      imap.CodeReferral,
+		Arguments: []interface{}{"IMAP://user;AUTH=*@SERVER2/"},
+		Info:      "Specified user is invalid on this server. Try SERVER2.",
+	}
+	if err, ok := status.Err().(*imap.ReferralError); !ok {
+		t.Error("NO status didn't return a *ReferralError:", err)
+	} else if err.URL != "IMAP://user;AUTH=*@SERVER2/" || err.Code != imap.CodeReferral || err.Info != status.Info {
+		t.Error("NO status returned incorrect error:", err)
+	}
+
+	status = &imap.StatusResp{Type: imap.StatusRespNo, Code: imap.CodeReferral, Info: "Missing URL"}
+	if err, ok := status.Err().(*imap.StatusError); !ok {
+		t.Error("NO status without a URL didn't return a *StatusError:", err)
+	}
 }
@@ -0,0 +1,75 @@
+package imap
+
+import (
+	"errors"
+)
+
+// AppendUid is the data of an APPENDUID response code, returned when messages
+// are appended to a mailbox. See RFC 4315 section 3.
+type AppendUid struct {
+	// The UIDVALIDITY of the destination mailbox.
+	UidValidity uint32
+	// The UIDs assigned to the appended messages. It contains a single UID,
+	// unless several messages have been appended with MULTIAPPEND.
+	Uids *SeqSet
+}
+
+// Format formats the APPENDUID response code arguments.
+func (data *AppendUid) Format() []interface{} {
+	return []interface{}{data.UidValidity, data.Uids}
+}
+
+// Parse parses the APPENDUID response code arguments.
+func (data *AppendUid) Parse(fields []interface{}) error {
+	if len(fields) < 2 {
+		return errors.New("APPENDUID response code must have two arguments")
+	}
+
+	var err error
+	if data.UidValidity, err = ParseNumber(fields[0]); err != nil {
+		return err
+	}
+	data.Uids, err = parseUidSet(fields[1])
+	return err
+}
+
+// CopyUid is the data of a COPYUID response code, returned when messages are
+// copied to a mailbox. See RFC 4315 section 3.
+type CopyUid struct {
+	// The UIDVALIDITY of the destination mailbox.
+	UidValidity uint32
+	// The UIDs of the source messages.
+	SourceUids *SeqSet
+	// The UIDs assigned to the copies, in the same order as SourceUids.
+	DestUids *SeqSet
+}
+
+// Format formats the COPYUID response code arguments.
+func (data *CopyUid) Format() []interface{} {
+	return []interface{}{data.UidValidity, data.SourceUids, data.DestUids}
+}
+
+// Parse parses the COPYUID response code arguments.
+func (data *CopyUid) Parse(fields []interface{}) error {
+	if len(fields) < 3 {
+		return errors.New("COPYUID response code must have three arguments")
+	}
+
+	var err error
+	if data.UidValidity, err = ParseNumber(fields[0]); err != nil {
+		return err
+	}
+	if data.SourceUids, err = parseUidSet(fields[1]); err != nil {
+		return err
+	}
+	data.DestUids, err = parseUidSet(fields[2])
+	return err
+}
+
+func parseUidSet(f interface{}) (*SeqSet, error) {
+	s, err := parseNumberString(f)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSeqSet(s)
+}
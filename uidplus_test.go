@@ -0,0 +1,75 @@
+package imap
+
+import (
+	"testing"
+)
+
+func TestAppendUid_Format(t *testing.T) {
+	uids, _ := ParseSeqSet("3955")
+	data := &AppendUid{UidValidity: 38505, Uids: uids}
+
+	w, b := newWriter()
+	if err := w.writeList(data.Format()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "(38505 3955)"
+	if b.String() != want {
+		t.Errorf("Invalid formatted APPENDUID: got %q but expected %q", b.String(), want)
+	}
+}
+
+func TestAppendUid_Parse(t *testing.T) {
+	data := new(AppendUid)
+	if err := data.Parse([]interface{}{"38505", "3955:3957"}); err != nil {
+		t.Fatal("Cannot parse APPENDUID:", err)
+	}
+
+	if data.UidValidity != 38505 {
+		t.Errorf("Invalid UIDVALIDITY: got %v", data.UidValidity)
+	}
+	if data.Uids.String() != "3955:3957" {
+		t.Errorf("Invalid UIDs: got %v", data.Uids)
+	}
+
+	if err := data.Parse([]interface{}{"38505"}); err == nil {
+		t.Error("Expected an error when parsing APPENDUID with a missing argument")
+	}
+}
+
+func TestCopyUid_Format(t *testing.T) {
+	src, _ := ParseSeqSet("304,319:320")
+	dest, _ := ParseSeqSet("3956:3958")
+	data := &CopyUid{UidValidity: 38505, SourceUids: src, DestUids: dest}
+
+	w, b := newWriter()
+	if err := w.writeList(data.Format()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "(38505 304,319:320 3956:3958)"
+	if b.String() != want {
+		t.Errorf("Invalid formatted COPYUID: got %q but expected %q", b.String(), want)
+	}
+}
+
+func TestCopyUid_Parse(t *testing.T) {
+	data := new(CopyUid)
+	if err := data.Parse([]interface{}{"38505", "304,319:320", "3956:3958"}); err != nil {
+		t.Fatal("Cannot parse COPYUID:", err)
+	}
+
+	if data.UidValidity != 38505 {
+		t.Errorf("Invalid UIDVALIDITY: got %v", data.UidValidity)
+	}
+	if data.SourceUids.String() != "304,319:320" {
+		t.Errorf("Invalid source UIDs: got %v", data.SourceUids)
+	}
+	if data.DestUids.String() != "3956:3958" {
+		t.Errorf("Invalid destination UIDs: got %v", data.DestUids)
+	}
+
+	if err := data.Parse([]interface{}{"38505", "invalid", "3956"}); err == nil {
+		t.Error("Expected an error when parsing COPYUID with an invalid UID set")
+	}
+}
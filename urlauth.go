@@ -0,0 +1,53 @@
+package imap
+
+import (
+	"errors"
+	"time"
+
+	"github.com/emersion/go-imap/imapurl"
+)
+
+// URLAuthInternal is the INTERNAL URLAUTH mechanism, which every server
+// supporting URLAUTH implements, see RFC 4467 section 7.
+const URLAuthInternal = "INTERNAL"
+
+// ErrBadURLAuth is returned by SplitURLAuth if the URL isn't authorized.
+var ErrBadURLAuth = errors.New("imap: URL doesn't contain an URLAUTH component")
+
+// IsURLAuthRump checks if a URL is a rump URL, i.e. an URL ending with an
+// ";urlauth=" access identifier but without a mechanism and a token, as
+// accepted by GENURLAUTH. See RFC 4467 section 3.
+func IsURLAuthRump(url string) bool {
+	u, err := imapurl.Parse(url)
+	return err == nil && u.Access != "" && u.Mechanism == ""
+}
+
+// SplitURLAuth splits an authorized URL into the rump URL, the mechanism and
+// the token, see RFC 4467 section 3.
+func SplitURLAuth(url string) (rump, mechanism, token string, err error) {
+	u, err := imapurl.Parse(url)
+	if err != nil || u.Mechanism == "" {
+		return "", "", "", ErrBadURLAuth
+	}
+
+	// The token is computed from the rump URL as sent by the client, it can't
+	// be formatted again
+	rump = url[:len(url)-len(":"+u.Mechanism+":"+u.Token)]
+	return rump, u.Mechanism, u.Token, nil
+}
+
+// FormatURLAuth returns the authorized URL for a rump URL, a mechanism and a
+// token.
+func FormatURLAuth(rump, mechanism, token string) string {
+	return rump + ":" + mechanism + ":" + token
+}
+
+// URLAuthExpire returns the expiration date of a rump URL. It returns a zero
+// time if the URL doesn't contain an ";expire=" component.
+func URLAuthExpire(rump string) (time.Time, error) {
+	u, err := imapurl.Parse(rump)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return u.Expire, nil
+}
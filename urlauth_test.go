@@ -0,0 +1,65 @@
+package imap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsURLAuthRump(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"imap://joe@example.com/INBOX/;uid=20/;section=1.2;urlauth=submit+fred", true},
+		{"imap://joe@example.com/INBOX/;uid=20;urlauth=anonymous", true},
+		{"imap://joe@example.com/INBOX/;uid=20;urlauth=anonymous:internal:91354a47", false},
+		{"imap://joe@example.com/INBOX/;uid=20", false},
+		{"imap://joe@example.com/INBOX/;uid=20;urlauth=", false},
+		{"imap://joe@example.com/INBOX;urlauth=anonymous", false},
+		{"imap://joe@example.com/INBOX/;uid=20;urlauth=anonymous/;section=1", false},
+	}
+
+	for _, test := range tests {
+		if got := IsURLAuthRump(test.url); got != test.want {
+			t.Errorf("IsURLAuthRump(%q) = %v, want %v", test.url, got, test.want)
+		}
+	}
+}
+
+func TestSplitURLAuth(t *testing.T) {
+	rump := "imap://joe@example.com/INBOX/;uid=20/;section=1.2;urlauth=submit+fred"
+	url := FormatURLAuth(rump, URLAuthInternal, "91354a473744909de610943775f92038")
+
+	gotRump, mechanism, token, err := SplitURLAuth(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotRump != rump || mechanism != URLAuthInternal || token != "91354a473744909de610943775f92038" {
+		t.Errorf("SplitURLAuth() = %q, %q, %q", gotRump, mechanism, token)
+	}
+
+	if _, _, _, err := SplitURLAuth(rump); err != ErrBadURLAuth {
+		t.Errorf("SplitURLAuth(rump) = %v, want %v", err, ErrBadURLAuth)
+	}
+
+	// The rump URL isn't normalized
+	gotRump, mechanism, _, err = SplitURLAuth(rump + ":internal:91354a47")
+	if err != nil || gotRump != rump || mechanism != URLAuthInternal {
+		t.Errorf("SplitURLAuth() = %q, %q, %v", gotRump, mechanism, err)
+	}
+}
+
+func TestURLAuthExpire(t *testing.T) {
+	rump := "imap://joe@example.com/INBOX/;uid=20;expire=2004-04-29T10:00:00Z;urlauth=anonymous"
+	expire, err := URLAuthExpire(rump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2004, 4, 29, 10, 0, 0, 0, time.UTC); !expire.Equal(want) {
+		t.Errorf("URLAuthExpire() = %v, want %v", expire, want)
+	}
+
+	if expire, err := URLAuthExpire("imap://joe@example.com/INBOX/;uid=20;urlauth=anonymous"); err != nil || !expire.IsZero() {
+		t.Errorf("URLAuthExpire() = %v, %v, want zero time", expire, err)
+	}
+}
@@ -0,0 +1,64 @@
+package imap
+
+import (
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/emersion/go-imap/utf7"
+)
+
+// UTF8Accept is the extension enabling UTF-8 strings and mailbox names, as
+// defined in RFC 6855.
+const UTF8Accept = "UTF8=ACCEPT"
+
+// mailboxName is a mailbox name field. It is encoded when written, see
+// FormatMailboxName.
+type mailboxName string
+
+// quotedMailboxName is a mailbox name field written as a quoted string.
+type quotedMailboxName string
+
+// FormatMailboxName formats a mailbox name to a field. The name is written in
+// modified UTF-7, or in UTF-8 if the Writer has UTF8 set, see RFC 6855 section
+// 3.
+func FormatMailboxName(name string) interface{} {
+	return mailboxName(name)
+}
+
+// FormatQuotedMailboxName is like FormatMailboxName, but the name is always
+// written as a quoted string.
+func FormatQuotedMailboxName(name string) interface{} {
+	return quotedMailboxName(name)
+}
+
+// DecodeMailboxName decodes a mailbox name sent by the other party. Names
+// containing 8-bit characters can only have been sent after UTF8=ACCEPT has
+// been enabled and are returned as is, other names are decoded from modified
+// UTF-7.
+func DecodeMailboxName(name string) (string, error) {
+	if !isAscii(name) && utf8.ValidString(name) {
+		return name, nil
+	}
+	return utf7.Encoding.NewDecoder().String(name)
+}
+
+// isQuotableUTF8 checks if a string can be sent as a UTF-8 quoted string.
+func isQuotableUTF8(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, c := range s {
+		if unicode.IsControl(c) || !strconv.IsPrint(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *Writer) encodeMailboxName(name string) string {
+	if !w.UTF8 {
+		name, _ = utf7.Encoding.NewEncoder().String(name)
+	}
+	return name
+}
@@ -0,0 +1,27 @@
+package imap
+
+import (
+	"testing"
+)
+
+func TestDecodeMailboxName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"INBOX", "INBOX"},
+		{"Entw&APw-rfe", "Entwürfe"},
+		{"Entwürfe", "Entwürfe"},
+	}
+
+	for _, test := range tests {
+		if got, err := DecodeMailboxName(test.name); err != nil {
+			t.Errorf("DecodeMailboxName(%q) = %v", test.name, err)
+		} else if got != test.want {
+			t.Errorf("DecodeMailboxName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	if _, err := DecodeMailboxName("Entw&APw"); err == nil {
+		t.Error("Expected an error for an invalid modified UTF-7 name")
+	}
+}
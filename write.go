@@ -17,6 +17,10 @@ type flusher interface {
 // A string that will be quoted.
 type Quoted string
 
+// A string that will be written as is, without quoting. It must only contain
+// valid atom characters, but may contain brackets.
+type RawString string
+
 type WriterTo interface {
 	WriteTo(w *Writer) error
 }
@@ -44,10 +48,26 @@ func isAscii(s string) bool {
 	return true
 }
 
+// LiteralMinusMax is the maximum size of non-synchronizing literals when only
+// LITERAL- is supported, see RFC 7888 section 4.
+const LiteralMinusMax = 4096
+
 // An IMAP writer.
 type Writer struct {
 	io.Writer
 
+	// If set to true, literals are sent as non-synchronizing literals, without
+	// waiting for a continuation request, as defined in RFC 7888 (LITERAL+).
+	LiteralPlus bool
+	// If set to true, literals that are at most LiteralMinusMax bytes long are
+	// sent as non-synchronizing literals (LITERAL-).
+	LiteralMinus bool
+	// If set to true, strings containing UTF-8 are sent as quoted strings
+	// instead of literals and mailbox names aren't encoded in modified UTF-7.
+	// This must only be enabled when UTF8=ACCEPT has been enabled, as defined
+	// in RFC 6855 section 3.
+	UTF8 bool
+
 	continues <-chan bool
 }
 
@@ -79,7 +99,11 @@ func (w *Writer) writeAtom(s string) error {
 
 func (w *Writer) writeAstring(s string) error {
 	if !isAscii(s) {
-		// IMAP doesn't allow 8-bit data outside literals
+		// IMAP doesn't allow 8-bit data outside literals, except UTF-8 in quoted
+		// strings if UTF8=ACCEPT is enabled
+		if w.UTF8 && isQuotableUTF8(s) {
+			return w.writeQuoted(s)
+		}
 		return w.writeLiteral(bytes.NewBufferString(s))
 	}
 
@@ -127,17 +151,29 @@ func (w *Writer) writeList(fields []interface{}) error {
 }
 
 func (w *Writer) writeLiteral(l Literal) error {
+	return w.writeLiteralWithPrefix("", l)
+}
+
+func (w *Writer) writeLiteralWithPrefix(prefix string, l Literal) error {
 	if l == nil {
 		return w.writeString(nilAtom)
 	}
 
-	header := string(literalStart) + strconv.Itoa(l.Len()) + string(literalEnd) + crlf
+	// Non-synchronizing literals are only useful when a continuation request
+	// would be expected
+	nonSync := w.continues != nil && (w.LiteralPlus || (w.LiteralMinus && l.Len() <= LiteralMinusMax))
+
+	header := prefix + string(literalStart) + strconv.Itoa(l.Len())
+	if nonSync {
+		header += string(literalPlus)
+	}
+	header += string(literalEnd) + crlf
 	if err := w.writeString(header); err != nil {
 		return err
 	}
 
 	// If a channel is available, wait for a continuation request before sending data
-	if w.continues != nil {
+	if w.continues != nil && !nonSync {
 		// Make sure to flush the writer, otherwise we may never receive a continuation request
 		if err := w.Flush(); err != nil {
 			return err
@@ -162,10 +198,20 @@ func (w *Writer) writeField(field interface{}) error {
 		return w.writeAstring(field)
 	case Quoted:
 		return w.writeQuoted(string(field))
+	case RawString:
+		return w.writeString(string(field))
 	case int:
 		return w.writeNumber(uint32(field))
 	case uint32:
 		return w.writeNumber(field)
+	case uint64:
+		return w.writeString(strconv.FormatUint(field, 10))
+	case mailboxName:
+		return w.writeAstring(w.encodeMailboxName(string(field)))
+	case quotedMailboxName:
+		return w.writeQuoted(w.encodeMailboxName(string(field)))
+	case Literal8:
+		return w.writeLiteralWithPrefix(string(literal8Start), field.Literal)
 	case Literal:
 		return w.writeLiteral(field)
 	case []interface{}:
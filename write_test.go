@@ -2,6 +2,7 @@ package imap
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 	"time"
 )
@@ -100,6 +101,38 @@ func TestWriter_WriteField_8bitString(t *testing.T) {
 	}
 }
 
+func TestWriter_WriteField_UTF8String(t *testing.T) {
+	w, b := newWriter()
+	w.UTF8 = true
+
+	if err := w.writeField("☺"); err != nil {
+		t.Error(err)
+	}
+	if b.String() != "\"☺\"" {
+		t.Error("Not the expected quoted string:", b.String())
+	}
+}
+
+func TestWriter_WriteField_MailboxName(t *testing.T) {
+	w, b := newWriter()
+
+	if err := w.writeField(FormatMailboxName("Entwürfe")); err != nil {
+		t.Error(err)
+	}
+	if b.String() != "Entw&APw-rfe" {
+		t.Error("Not the expected modified UTF-7 name:", b.String())
+	}
+
+	b.Reset()
+	w.UTF8 = true
+	if err := w.writeField(FormatMailboxName("Entwürfe")); err != nil {
+		t.Error(err)
+	}
+	if b.String() != "\"Entwürfe\"" {
+		t.Error("Not the expected UTF-8 name:", b.String())
+	}
+}
+
 func TestWriter_WriteField_NilString(t *testing.T) {
 	w, b := newWriter()
 
@@ -201,6 +234,58 @@ func TestWriter_WriteField_Literal(t *testing.T) {
 	}
 }
 
+func TestWriter_WriteField_NonSyncLiteral(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := NewClientWriter(b, make(chan bool))
+	w.LiteralPlus = true
+
+	if err := w.writeField(bytes.NewBufferString("hello world")); err != nil {
+		t.Error(err)
+	}
+	if b.String() != "{11+}\r\nhello world" {
+		t.Error("Not the expected literal:", b.String())
+	}
+
+	// With LITERAL-, large literals are synchronizing
+	continues := make(chan bool, 1)
+	continues <- true
+	b.Reset()
+	w = NewClientWriter(b, continues)
+	w.LiteralMinus = true
+
+	large := strings.Repeat("a", LiteralMinusMax+1)
+	if err := w.writeField(bytes.NewBufferString(large)); err != nil {
+		t.Error(err)
+	}
+	if b.String() != "{4097}\r\n"+large {
+		t.Error("Not the expected literal header:", b.String()[:10])
+	}
+}
+
+func TestWriter_WriteField_Literal8(t *testing.T) {
+	w, b := newWriter()
+
+	literal := Literal8{bytes.NewBufferString("hello\x00world")}
+
+	if err := w.writeField(literal); err != nil {
+		t.Error(err)
+	}
+	if b.String() != "~{11}\r\nhello\x00world" {
+		t.Error("Not the expected literal8:", b.String())
+	}
+}
+
+func TestWriter_WriteField_RawString(t *testing.T) {
+	w, b := newWriter()
+
+	if err := w.writeField(RawString("BINARY.SIZE[1]")); err != nil {
+		t.Error(err)
+	}
+	if b.String() != "BINARY.SIZE[1]" {
+		t.Error("Not the expected raw string:", b.String())
+	}
+}
+
 func TestWriter_WriteField_SeqSet(t *testing.T) {
 	w, b := newWriter()
 